@@ -27,6 +27,10 @@ import (
 type SPIAccessCheckSpec struct {
 	RepoUrl     string      `json:"repoUrl"`
 	Permissions Permissions `json:"permissions,omitempty"`
+	// Ref is the branch, tag or commit in the repository to check the access to. The ref is resolved to the SHA of
+	// the commit, which is reported in the status so that the build systems can pin exactly what they fetch.
+	// +optional
+	Ref string `json:"ref,omitempty"`
 }
 
 // SPIAccessCheckStatus defines the observed state of SPIAccessCheck
@@ -37,8 +41,34 @@ type SPIAccessCheckStatus struct {
 	ServiceProvider ServiceProviderType         `json:"serviceProvider"`
 	ErrorReason     SPIAccessCheckErrorReason   `json:"errorReason,omitempty"`
 	ErrorMessage    string                      `json:"errorMessage,omitempty"`
+	// Ref describes the ref requested in the spec as resolved by the service provider. It is only set if the ref
+	// could be resolved.
+	// +optional
+	Ref *SPIAccessCheckRefStatus `json:"ref,omitempty"`
 }
 
+// SPIAccessCheckRefStatus describes the ref the access was checked to.
+type SPIAccessCheckRefStatus struct {
+	// Name is the ref requested in the spec.
+	Name string `json:"name"`
+	// Type is the type of the ref.
+	Type SPIAccessCheckRefType `json:"type"`
+	// Sha is the SHA of the commit the ref resolved to.
+	Sha string `json:"sha"`
+	// Protected is true if the ref is a branch protected in the service provider.
+	// +optional
+	Protected bool `json:"protected,omitempty"`
+}
+
+// SPIAccessCheckRefType is the type of the ref in the repository.
+type SPIAccessCheckRefType string
+
+const (
+	SPIAccessCheckRefTypeBranch SPIAccessCheckRefType = "branch"
+	SPIAccessCheckRefTypeTag    SPIAccessCheckRefType = "tag"
+	SPIAccessCheckRefTypeCommit SPIAccessCheckRefType = "commit"
+)
+
 type SPIRepoType string
 
 const (
@@ -53,6 +83,11 @@ const (
 	SPIAccessCheckErrorRepoNotFound           SPIAccessCheckErrorReason = "RepositoryNotFound"
 	SPIAccessCheckErrorBadURL                 SPIAccessCheckErrorReason = "BadURL"
 	SPIAccessCheckErrorNotImplemented         SPIAccessCheckErrorReason = "NotImplemented"
+	SPIAccessCheckErrorOAuthNotConfigured     SPIAccessCheckErrorReason = "OAuthNotConfigured"
+	SPIAccessCheckErrorRefNotFound            SPIAccessCheckErrorReason = "RefNotFound"
+	// SPIAccessCheckErrorAuthenticationRequired means there's no token for the repository and the repository is
+	// private (or might be private if the service provider doesn't tell the private repositories from the missing ones).
+	SPIAccessCheckErrorAuthenticationRequired SPIAccessCheckErrorReason = "AuthenticationRequired"
 )
 
 type SPIAccessCheckAccessibility string
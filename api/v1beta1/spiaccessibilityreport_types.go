@@ -0,0 +1,99 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SPIAccessibilityReportSpec defines the desired state of SPIAccessibilityReport
+type SPIAccessibilityReportSpec struct {
+	// ServiceProviderUrl optionally limits the report to the tokens of the service provider with this base URL.
+	// +optional
+	ServiceProviderUrl string `json:"serviceProviderUrl,omitempty"`
+}
+
+// SPIAccessibilityReportStatus defines the observed state of SPIAccessibilityReport
+type SPIAccessibilityReportStatus struct {
+	// Accounts lists the accounts in the service providers that the tokens in the namespace are connected to
+	// together with what they can access.
+	Accounts []AccessibleAccount `json:"accounts,omitempty"`
+	// Truncated is true if there are more accounts than MaxAccessibilityReportAccounts and only the first of them
+	// (ordered by the token name) are listed.
+	// +optional
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+const (
+	// MaxAccessibilityReportAccounts is the maximum number of the accounts listed in a report. Together with
+	// MaxAccessibleResourcesPerAccount it keeps the size of the status bounded.
+	MaxAccessibilityReportAccounts = 100
+	// MaxAccessibleResourcesPerAccount is the maximum number of the organizations and of the repositories listed for
+	// a single account.
+	MaxAccessibleResourcesPerAccount = 50
+)
+
+// AccessibleAccount describes what a single token can access. The information is based solely on the metadata cached
+// in the token and may therefore be incomplete or slightly out of date.
+type AccessibleAccount struct {
+	// TokenName is the name of the SPIAccessToken representing the account
+	TokenName string `json:"tokenName"`
+	// ServiceProviderType is the type of the service provider of the account
+	ServiceProviderType ServiceProviderType `json:"serviceProviderType"`
+	// ServiceProviderUrl is the base URL of the service provider of the account
+	ServiceProviderUrl string `json:"serviceProviderUrl"`
+	// Username is the username of the account in the service provider
+	// +optional
+	Username string `json:"username,omitempty"`
+	// Scopes is the list of scopes the token possesses
+	// +optional
+	Scopes []string `json:"scopes,omitempty"`
+	// Organizations is the list of the names of the organizations the token is known to be able to access
+	// +optional
+	Organizations []string `json:"organizations,omitempty"`
+	// Repositories is the list of the URLs of the repositories the token is known to be able to access
+	// +optional
+	Repositories []string `json:"repositories,omitempty"`
+	// Truncated is true if the token can access more organizations or repositories than
+	// MaxAccessibleResourcesPerAccount and only the first of them are listed.
+	// +optional
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+
+// SPIAccessibilityReport is the Schema for the spiaccessibilityreports API. It summarizes the accounts and
+// repositories the SPIAccessTokens in its namespace can access.
+type SPIAccessibilityReport struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SPIAccessibilityReportSpec   `json:"spec,omitempty"`
+	Status SPIAccessibilityReportStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// SPIAccessibilityReportList contains a list of SPIAccessibilityReport
+type SPIAccessibilityReportList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SPIAccessibilityReport `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SPIAccessibilityReport{}, &SPIAccessibilityReportList{})
+}
@@ -18,13 +18,63 @@ package v1beta1
 
 import (
 	"net/url"
+	"strconv"
+	"strings"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 const (
+	// ServiceProviderTypeLabel is the label containing the type of the service provider of the token. It is set by the
+	// operator once the service provider of the token is determined.
 	ServiceProviderTypeLabel = "spi.appstudio.redhat.com/service-provider-type"
+	// ServiceProviderHostLabel is the label containing the host (including the port, if any) of the service provider URL
+	// of the token. We can't use the full URL as a label value, because K8s doesn't allow :// in label values.
 	ServiceProviderHostLabel = "spi.appstudio.redhat.com/service-provider-host"
+	// ServiceProviderUsernameLabel is the label containing the username in the service provider the token impersonates
+	// as, taken from the metadata of the token. It is not set if the username is not known or cannot be used as a label
+	// value.
+	ServiceProviderUsernameLabel = "spi.appstudio.redhat.com/service-provider-username"
+	// InvalidateTokenDataAnnotation is the annotation the users can put on the token to request its data to be wiped
+	// from the token storage, e.g. after the token has leaked. The token is then flipped back to the AwaitingTokenData
+	// phase and stays linked to its bindings. The operator removes the annotation once the data is wiped.
+	InvalidateTokenDataAnnotation = "spi.appstudio.redhat.com/invalidate-token-data"
+	// RollbackTokenDataAnnotation is the annotation the users can put on the token to request its data to be replaced
+	// by one of the previous versions of the data, e.g. after uploading wrong data. The value of the annotation is
+	// the version to roll back to as listed in the status. The rollback stores the old data as a new version. The
+	// operator removes the annotation once the rollback is done.
+	RollbackTokenDataAnnotation = "spi.appstudio.redhat.com/rollback-token-data"
+	// GeneratedForBindingAnnotation is put by the operator on the tokens it creates for the bindings for which no
+	// matching token exists. The value is the name of the binding. Such tokens are deleted by the operator once their
+	// bindings are relinked to other tokens.
+	GeneratedForBindingAnnotation = "spi.appstudio.redhat.com/generated-for-binding"
+	// TokenOwnerAnnotation is put on the token by the OAuth service and contains the name of the Kubernetes user that
+	// completed the OAuth flow of the token (see oauthstate.EnrichedOAuthState). The owned tokens can only be used by
+	// the bindings created by their owner or by the token ownership admins. Only the admins can change it.
+	TokenOwnerAnnotation = "spi.appstudio.redhat.com/owner"
+	// NotificationContactAnnotation is the annotation of the namespace declaring the contact (e.g. a Slack handle) of
+	// the owners of the namespace that is notified when the tokens in the namespace become invalid or are about to
+	// expire. The tokens in the namespaces without it are not notified about.
+	NotificationContactAnnotation = "spi.appstudio.redhat.com/notification-contact"
+	// ExpiryNotifiedAnnotation is put on the token by the operator once the owners are notified about the upcoming
+	// expiry of its data. The value is the expiry of the data (in seconds since the epoch) the notification was sent
+	// for, so that the notification is only sent once for each data.
+	ExpiryNotifiedAnnotation = "spi.appstudio.redhat.com/expiry-notified"
+	// HibernatedNamespaceLabel is the label of the namespaces of the suspended (hibernated) AppStudio workspaces. While
+	// the namespace is labeled with "true", the operator doesn't call the service providers for the tokens and
+	// bindings in it and doesn't refresh their tokens. They are left as they are and reconciled once the label is
+	// removed.
+	HibernatedNamespaceLabel = "appstudio.redhat.com/hibernated"
+	// ObservedUIDAnnotation is put on the token by the operator and contains the UID of the token. It is included in
+	// the backups of the token (e.g. by Velero), so a token whose UID differs from the annotation was restored from
+	// a backup. The operator then checks that the data of the token survived the restore before trusting its status.
+	ObservedUIDAnnotation = "spi.appstudio.redhat.com/observed-uid"
+	// TokenPriorityAnnotation can be put on the token by the users to make the token lookup prefer it over the other
+	// tokens matching the same binding, e.g. to prefer the shared bot tokens of an organization over the personal tokens
+	// of the developers. The value is an integer, the tokens with higher values are preferred. The tokens without
+	// the annotation (or with an invalid value) have the priority 0.
+	TokenPriorityAnnotation = "spi.appstudio.redhat.com/priority"
 )
 
 // SPIAccessTokenSpec defines the desired state of SPIAccessToken
@@ -43,6 +93,63 @@ type Token struct {
 	TokenType    string `json:"token_type,omitempty"`
 	RefreshToken string `json:"refresh_token,omitempty"`
 	Expiry       uint64 `json:"expiry,omitempty"`
+	// Credentials are the additional credentials stored together with the access token, e.g. the SSH key or
+	// the password for the same account. The AccessToken and RefreshToken are not duplicated in here.
+	Credentials map[CredentialFlavor]string `json:"credentials,omitempty"`
+	// Version is the version of the token data. It is increased by the token storage every time the data is stored.
+	Version uint64 `json:"version,omitempty"`
+	// PreviousVersions are the previous versions of the token data kept by the token storage so that the data can be
+	// rolled back. The most recent version comes first.
+	PreviousVersions []Token `json:"previous_versions,omitempty"`
+}
+
+// CredentialFlavor is the kind of credential stored in the token data. The bindings use it to choose which of
+// the credentials of the linked token they need.
+type CredentialFlavor string
+
+const (
+	CredentialFlavorAccessToken  CredentialFlavor = "AccessToken"
+	CredentialFlavorRefreshToken CredentialFlavor = "RefreshToken"
+	CredentialFlavorPassword     CredentialFlavor = "Password"
+	CredentialFlavorSSHKey       CredentialFlavor = "SSHKey"
+	// CredentialFlavorCosignKey is the (typically encrypted) cosign private key used for signing the images.
+	CredentialFlavorCosignKey CredentialFlavor = "CosignKey"
+	// CredentialFlavorCosignPassword is the password of the cosign private key. It is injected together with the key.
+	CredentialFlavorCosignPassword CredentialFlavor = "CosignPassword"
+	// CredentialFlavorCosignPublicKey is the public key of the cosign private key. It is injected together with the key.
+	CredentialFlavorCosignPublicKey CredentialFlavor = "CosignPublicKey"
+	// CredentialFlavorOIDCToken is the OIDC identity token used for the keyless signing with Sigstore.
+	CredentialFlavorOIDCToken CredentialFlavor = "OIDCToken"
+)
+
+// Credential returns the credential of the provided flavor and true if the token data contains it. An empty flavor
+// means the access token. The password of the basic auth credentials is the access token.
+func (t *Token) Credential(flavor CredentialFlavor) (string, bool) {
+	var cred string
+	switch flavor {
+	case "", CredentialFlavorAccessToken:
+		cred = t.AccessToken
+	case CredentialFlavorRefreshToken:
+		cred = t.RefreshToken
+	case CredentialFlavorPassword:
+		cred = t.Credentials[flavor]
+		if cred == "" && t.IsBasicAuth() {
+			cred = t.AccessToken
+		}
+	default:
+		cred = t.Credentials[flavor]
+	}
+
+	return cred, cred != ""
+}
+
+// BasicAuthTokenType is the TokenType of the username and password credentials (e.g. app passwords or robot accounts)
+// as opposed to the OAuth access tokens. The password of such credentials is stored in the AccessToken field.
+const BasicAuthTokenType = "basic"
+
+// IsBasicAuth returns true if the token represents username and password credentials rather than an OAuth token.
+func (t *Token) IsBasicAuth() bool {
+	return strings.EqualFold(t.TokenType, BasicAuthTokenType)
 }
 
 // TokenMetadata is data about the token retrieved from the service provider. This data can be used for matching the
@@ -61,12 +168,26 @@ type TokenMetadata struct {
 	// uses during token matching, etc.
 	// +optional
 	ServiceProviderState []byte `json:"serviceProviderState"`
+	// ServiceProviderStateRef is the SHA-256 hash of the ServiceProviderState moved out of the status because of its
+	// size, in the form "sha256:<hex digest>". The state is stored in the "spi-state-<token name>" secret in
+	// the namespace of the token and the ServiceProviderState is left empty in the cluster.
+	// +optional
+	ServiceProviderStateRef string `json:"serviceProviderStateRef,omitempty"`
 	// LastRefreshTime is the Unix-epoch timestamp of the last time the metadata has been refreshed from the service
 	// provider. The operator is configured with a TTL for this information and automatically refreshes the metadata
 	// when it is needed but is found stale.
 	LastRefreshTime int64 `json:"lastRefreshTime"`
+	// RepositoryPermissions maps the URLs of the repositories to the permissions that the token has in them. It is
+	// only filled in for the tokens that have no OAuth scopes and are granted the permissions per repository instead,
+	// like the GitHub fine-grained personal access tokens.
+	// +optional
+	RepositoryPermissions map[string]RepositoryPermissions `json:"repositoryPermissions,omitempty"`
 }
 
+// RepositoryPermissions maps the names of the service-provider-specific repository permissions to the access levels
+// granted for them, e.g. "contents": "write".
+type RepositoryPermissions map[string]string
+
 // Permissions is a collection of operator-defined permissions (which are translated to service-provider-specific
 // scopes) and potentially additional service-provider-specific scopes that are not covered by the operator defined
 // abstraction. The permissions are used in SPIAccessTokenBinding objects to express the requirements on the tokens as
@@ -80,8 +201,11 @@ type Permissions struct {
 type ServiceProviderType string
 
 const (
-	ServiceProviderTypeGitHub ServiceProviderType = "GitHub"
-	ServiceProviderTypeQuay   ServiceProviderType = "Quay"
+	ServiceProviderTypeGitHub     ServiceProviderType = "GitHub"
+	ServiceProviderTypeQuay       ServiceProviderType = "Quay"
+	ServiceProviderTypeKubernetes ServiceProviderType = "Kubernetes"
+	ServiceProviderTypeNexus      ServiceProviderType = "Nexus"
+	ServiceProviderTypeEcho       ServiceProviderType = "Echo"
 )
 
 // Permission is an element of Permissions and express a requirement on the service provider scopes in an agnostic
@@ -124,6 +248,9 @@ const (
 	PermissionAreaRepositoryMetadata PermissionArea = "repositoryMetadata"
 	PermissionAreaWebhooks           PermissionArea = "webhooks"
 	PermissionAreaUser               PermissionArea = "user"
+	// PermissionAreaSigning is the permission to sign artifacts, e.g. using the cosign key or the OIDC identity token
+	// the service provider issues.
+	PermissionAreaSigning PermissionArea = "signing"
 )
 
 // SPIAccessTokenStatus defines the observed state of SPIAccessToken
@@ -132,7 +259,67 @@ type SPIAccessTokenStatus struct {
 	ErrorReason   SPIAccessTokenErrorReason `json:"errorReason"`
 	ErrorMessage  string                    `json:"errorMessage"`
 	OAuthUrl      string                    `json:"oAuthUrl"`
+	UploadUrl     string                    `json:"uploadUrl,omitempty"`
 	TokenMetadata *TokenMetadata            `json:"tokenMetadata,omitempty"`
+	// ServiceProviderError contains the details of the failed call to the service provider if it caused the error
+	// of the token.
+	// +optional
+	ServiceProviderError *ServiceProviderErrorDetails `json:"serviceProviderError,omitempty"`
+	// DataVersion is the version of the token data currently in the token storage. It is 0 if there is no data.
+	// +optional
+	DataVersion uint64 `json:"dataVersion,omitempty"`
+	// PreviousDataVersions are the versions of the token data that the token can be rolled back to using
+	// the RollbackTokenDataAnnotation.
+	// +optional
+	PreviousDataVersions []uint64 `json:"previousDataVersions,omitempty"`
+	// History contains the most recent phase transitions of the token, the most recent first. The number of
+	// the recorded transitions is limited by the configuration of the operator.
+	// +optional
+	History []SPIAccessTokenPhaseTransition `json:"history,omitempty"`
+	// Conditions contain the ValidityWarning condition if the service provider of the token is configured with
+	// a maximum token validity, the Suspended condition while the service provider is under maintenance and
+	// the ReauthenticationRequired condition if the token data lacks the scopes required by the permissions.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// LinkedBindings are the names of the SPIAccessTokenBindings (in the namespace of the token) currently linked to
+	// the token, sorted alphabetically. It is maintained by the binding controller so that the users can see what
+	// depends on the token before deleting it.
+	// +optional
+	LinkedBindings []string `json:"linkedBindings,omitempty"`
+	// LinkedBindingCount is the number of the bindings currently linked to the token.
+	// +optional
+	LinkedBindingCount int `json:"linkedBindingCount,omitempty"`
+}
+
+// SPIAccessTokenPhaseTransition records the change of the phase of the token.
+type SPIAccessTokenPhaseTransition struct {
+	// Phase is the phase the token transitioned to.
+	Phase SPIAccessTokenPhase `json:"phase"`
+	// PreviousPhase is the phase the token transitioned from. It is empty for the first transition of the token.
+	// +optional
+	PreviousPhase SPIAccessTokenPhase `json:"previousPhase,omitempty"`
+	// Reason is the error reason for the Error and Invalid phases. Otherwise, it is one of the
+	// SPIAccessTokenTransitionReason* values.
+	Reason string `json:"reason"`
+	// Message describes the error for the Error and Invalid phases.
+	// +optional
+	Message string `json:"message,omitempty"`
+	// Time is when the transition happened.
+	Time metav1.Time `json:"time"`
+}
+
+// ServiceProviderErrorDetails describes the failure of a call to the service provider.
+type ServiceProviderErrorDetails struct {
+	// StatusCode is the HTTP status code of the response of the service provider.
+	StatusCode int `json:"statusCode"`
+	// Message is the error message returned by the service provider.
+	// +optional
+	Message string `json:"message,omitempty"`
+	// DocumentationUrl is the link to the documentation of the error, if the service provider returned it.
+	// +optional
+	DocumentationUrl string `json:"documentationUrl,omitempty"`
 }
 
 // SPIAccessTokenPhase is the reconciliation phase of the SPIAccessToken object
@@ -152,6 +339,61 @@ const (
 	SPIAccessTokenErrorReasonUnknownServiceProvider SPIAccessTokenErrorReason = "UnknownServiceProvider"
 	SPIAccessTokenErrorReasonMetadataFailure        SPIAccessTokenErrorReason = "MetadataFailure"
 	SPIAccessTokenErrorReasonUnsupportedPermissions SPIAccessTokenErrorReason = "UnsupportedPermissions"
+	SPIAccessTokenErrorReasonOAuthNotConfigured     SPIAccessTokenErrorReason = "OAuthNotConfigured"
+	SPIAccessTokenErrorReasonTokenDataRollback      SPIAccessTokenErrorReason = "TokenDataRollback"
+	SPIAccessTokenErrorReasonReservedName           SPIAccessTokenErrorReason = "ReservedName"
+	// SPIAccessTokenErrorReasonServiceProviderUrlNotAllowed means the host of the service provider URL is not allowed
+	// by the configuration of the operator.
+	SPIAccessTokenErrorReasonServiceProviderUrlNotAllowed SPIAccessTokenErrorReason = "ServiceProviderUrlNotAllowed"
+	// SPIAccessTokenErrorReasonCredentialsValidation means the newly stored token data failed the validation by
+	// the service provider (see ServiceProvider.ValidateCredentials).
+	SPIAccessTokenErrorReasonCredentialsValidation SPIAccessTokenErrorReason = "CredentialsValidation"
+)
+
+const (
+	// SPIAccessTokenTransitionReasonTokenDataMissing means the token has no data in the token storage.
+	SPIAccessTokenTransitionReasonTokenDataMissing = "TokenDataMissing"
+	// SPIAccessTokenTransitionReasonMetadataMissing means the token has data, but the service provider didn't
+	// identify the user. This typically happens when the metadata of the token expired and couldn't be refreshed.
+	SPIAccessTokenTransitionReasonMetadataMissing = "MetadataMissing"
+	// SPIAccessTokenTransitionReasonTokenDataInvalidated means the data was removed using
+	// the InvalidateTokenDataAnnotation.
+	SPIAccessTokenTransitionReasonTokenDataInvalidated = "TokenDataInvalidated"
+	// SPIAccessTokenTransitionReasonMetadataPresent means the service provider identified the user of the token data.
+	SPIAccessTokenTransitionReasonMetadataPresent = "MetadataPresent"
+	// SPIAccessTokenTransitionReasonRestoredWithoutData means the token was restored from a backup, but its data was
+	// not restored to the token storage, so it needs to be authenticated again.
+	SPIAccessTokenTransitionReasonRestoredWithoutData = "RestoredWithoutData"
+	// SPIAccessTokenTransitionReasonPermissionsIncreased means the permissions in the spec of the token require scopes
+	// that the token data doesn't have, so the token needs to be authenticated again.
+	SPIAccessTokenTransitionReasonPermissionsIncreased = "PermissionsIncreased"
+)
+
+const (
+	// SPIAccessTokenConditionValidityWarning is true if the token data doesn't expire or expires later than
+	// the maximum token validity configured for the service provider of the token allows.
+	SPIAccessTokenConditionValidityWarning = "ValidityWarning"
+	// SPIAccessTokenConditionSuspended is true while the service provider of the token is in a configured
+	// maintenance window. The token keeps its last known phase and metadata until the maintenance ends.
+	SPIAccessTokenConditionSuspended = "Suspended"
+	// SPIAccessTokenConditionReauthenticationRequired is true if the permissions in the spec of the token require
+	// scopes that the token data doesn't have. The message lists the missing scopes. The token waits in
+	// the AwaitingTokenData phase until the user goes through the OAuth flow again.
+	SPIAccessTokenConditionReauthenticationRequired = "ReauthenticationRequired"
+
+	// SPIAccessTokenValidityReasonNoExpiry means the token data has no expiry.
+	SPIAccessTokenValidityReasonNoExpiry = "NoExpiry"
+	// SPIAccessTokenValidityReasonExpiryTooLate means the token data expires after the maximum token validity.
+	SPIAccessTokenValidityReasonExpiryTooLate = "ExpiryTooLate"
+	// SPIAccessTokenValidityReasonWithinLimit means the token data expires within the maximum token validity.
+	SPIAccessTokenValidityReasonWithinLimit = "WithinLimit"
+
+	// SPIAccessTokenSuspendedReasonProviderMaintenance means the service provider of the token is under maintenance.
+	SPIAccessTokenSuspendedReasonProviderMaintenance = "ProviderMaintenance"
+
+	// SPIAccessTokenReauthenticationReasonPermissionsIncreased means the permissions in the spec of the token were
+	// changed to require more scopes than the token data has.
+	SPIAccessTokenReauthenticationReasonPermissionsIncreased = "PermissionsIncreased"
 )
 
 //+kubebuilder:object:root=true
@@ -175,8 +417,9 @@ type SPIAccessTokenList struct {
 	Items           []SPIAccessToken `json:"items"`
 }
 
-// EnsureLabels makes sure that the object has labels set according to its spec. The labels are used for faster lookup during
-// token matching with bindings. Returns `true` if the labels were changed, `false` otherwise.
+// EnsureLabels makes sure that the object has labels set according to its spec and metadata. The labels are used for faster
+// lookup during token matching with bindings and for querying the tokens by the users. Returns `true` if the labels were
+// changed, `false` otherwise.
 func (t *SPIAccessToken) EnsureLabels(detectedType ServiceProviderType) (changed bool) {
 	if t.Labels == nil {
 		t.Labels = map[string]string{}
@@ -198,6 +441,18 @@ func (t *SPIAccessToken) EnsureLabels(detectedType ServiceProviderType) (changed
 		}
 	}
 
+	username := ""
+	if t.Status.TokenMetadata != nil && len(validation.IsValidLabelValue(t.Status.TokenMetadata.Username)) == 0 {
+		username = t.Status.TokenMetadata.Username
+	}
+	if current, ok := t.Labels[ServiceProviderUsernameLabel]; username != "" && current != username {
+		t.Labels[ServiceProviderUsernameLabel] = username
+		changed = true
+	} else if username == "" && ok {
+		delete(t.Labels, ServiceProviderUsernameLabel)
+		changed = true
+	}
+
 	return
 }
 
@@ -208,3 +463,12 @@ func init() {
 func (in *SPIAccessToken) Permissions() *Permissions {
 	return &in.Spec.Permissions
 }
+
+// Priority returns the priority of the token in the token lookup as declared by the TokenPriorityAnnotation.
+func (in *SPIAccessToken) Priority() int {
+	priority, err := strconv.Atoi(in.Annotations[TokenPriorityAnnotation])
+	if err != nil {
+		return 0
+	}
+	return priority
+}
@@ -38,6 +38,36 @@ func TestPermissions(t *testing.T) {
 	assert.True(t, pt.IsWrite())
 }
 
+func TestTokenCredential(t *testing.T) {
+	token := Token{
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		Credentials: map[CredentialFlavor]string{
+			CredentialFlavorSSHKey: "key",
+		},
+	}
+
+	cred, ok := token.Credential("")
+	assert.True(t, ok)
+	assert.Equal(t, "access", cred)
+
+	cred, ok = token.Credential(CredentialFlavorRefreshToken)
+	assert.True(t, ok)
+	assert.Equal(t, "refresh", cred)
+
+	cred, ok = token.Credential(CredentialFlavorSSHKey)
+	assert.True(t, ok)
+	assert.Equal(t, "key", cred)
+
+	_, ok = token.Credential(CredentialFlavorPassword)
+	assert.False(t, ok)
+
+	token.TokenType = BasicAuthTokenType
+	cred, ok = token.Credential(CredentialFlavorPassword)
+	assert.True(t, ok)
+	assert.Equal(t, "access", cred)
+}
+
 func TestEnsureLabels(t *testing.T) {
 	t.Run("sets the predefined", func(t *testing.T) {
 		at := SPIAccessToken{
@@ -71,4 +101,42 @@ func TestEnsureLabels(t *testing.T) {
 		assert.Equal(t, "av", at.Labels["a"])
 		assert.Equal(t, "bv", at.Labels["b"])
 	})
+
+	t.Run("sets the username from metadata", func(t *testing.T) {
+		at := SPIAccessToken{
+			Spec: SPIAccessTokenSpec{
+				ServiceProviderUrl: "https://hello",
+			},
+			Status: SPIAccessTokenStatus{
+				TokenMetadata: &TokenMetadata{Username: "alois"},
+			},
+		}
+
+		assert.True(t, at.EnsureLabels("sp_type"))
+		assert.Equal(t, "alois", at.Labels[ServiceProviderUsernameLabel])
+		assert.False(t, at.EnsureLabels("sp_type"))
+
+		// not a valid label value
+		at.Status.TokenMetadata.Username = "acme+robot"
+		assert.True(t, at.EnsureLabels("sp_type"))
+		assert.NotContains(t, at.Labels, ServiceProviderUsernameLabel)
+
+		at.Status.TokenMetadata.Username = "alois"
+		assert.True(t, at.EnsureLabels("sp_type"))
+		at.Status.TokenMetadata = nil
+		assert.True(t, at.EnsureLabels("sp_type"))
+		assert.NotContains(t, at.Labels, ServiceProviderUsernameLabel)
+	})
+}
+
+func TestPriority(t *testing.T) {
+	priority := func(annotations map[string]string) int {
+		at := SPIAccessToken{ObjectMeta: metav1.ObjectMeta{Annotations: annotations}}
+		return at.Priority()
+	}
+
+	assert.Equal(t, 0, priority(nil))
+	assert.Equal(t, 10, priority(map[string]string{TokenPriorityAnnotation: "10"}))
+	assert.Equal(t, -5, priority(map[string]string{TokenPriorityAnnotation: "-5"}))
+	assert.Equal(t, 0, priority(map[string]string{TokenPriorityAnnotation: "high"}))
 }
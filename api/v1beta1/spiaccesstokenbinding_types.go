@@ -19,6 +19,42 @@ package v1beta1
 import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// BindingCreatorAnnotation is put on the bindings by the token ownership webhook and contains the name of the user
+	// that created the binding. It cannot be changed.
+	BindingCreatorAnnotation = "spi.appstudio.redhat.com/created-by"
+	// BindingCreatedByAdminAnnotation is put on the bindings created by the token ownership admins by the token
+	// ownership webhook. Such bindings can use the tokens of any owner.
+	BindingCreatedByAdminAnnotation = "spi.appstudio.redhat.com/created-by-admin"
+	// InjectBindingAnnotation is put on the pods by the users and contains the name of the binding with the "Pod"
+	// delivery whose data should be mounted into the containers of the pod. The pod and the binding must live in the
+	// same namespace.
+	InjectBindingAnnotation = "spi.appstudio.redhat.com/inject-binding"
+	// CredentialsMountPathAnnotation can be put on the pods with the InjectBindingAnnotation to change the directory
+	// in which the data of the binding is mounted into the containers. Defaults to /var/run/spi/credentials.
+	CredentialsMountPathAnnotation = "spi.appstudio.redhat.com/credentials-mount-path"
+	// InjectPullSecretsLabel is put on the namespaces by the users to opt in to the injection of the pull secrets into
+	// the pods based on their images. The value must be "true".
+	InjectPullSecretsLabel = "spi.appstudio.redhat.com/inject-pull-secrets"
+	// BindingExpiresAtAnnotation can be put on the bindings to have them deleted by the operator, together with their
+	// secrets, at the given time. The value is an RFC 3339 timestamp.
+	BindingExpiresAtAnnotation = "spi.appstudio.redhat.com/expires-at"
+	// BindingRequestedByAnnotation is put on the bindings created by the credentials lookup API and contains the name
+	// of the trusted service that requested the credentials.
+	BindingRequestedByAnnotation = "spi.appstudio.redhat.com/requested-by"
+	// WaitForBindingsAnnotation is put on the pods by the users and contains the comma-separated names of the bindings
+	// in the namespace of the pod that must be injected before the pod becomes ready. The pods get the readiness gate
+	// with the BindingsReadyPodCondition.
+	WaitForBindingsAnnotation = "spi.appstudio.redhat.com/wait-for-bindings"
+	// BindingReadinessGateLabel is put on the pods with the readiness gate of the bindings so that the operator only
+	// needs to watch those pods.
+	BindingReadinessGateLabel = "spi.appstudio.redhat.com/binding-readiness-gate"
+	// BindingsReadyPodCondition is the type of the pod condition that is true once all the bindings in
+	// the WaitForBindingsAnnotation of the pod are injected.
+	BindingsReadyPodCondition = "spi.appstudio.redhat.com/bindings-ready"
 )
 
 // SPIAccessTokenBindingSpec defines the desired state of SPIAccessTokenBinding
@@ -26,8 +62,90 @@ type SPIAccessTokenBindingSpec struct {
 	RepoUrl     string      `json:"repoUrl"`
 	Permissions Permissions `json:"permissions"`
 	Secret      SecretSpec  `json:"secret"`
+	// TokenPolicy controls which token is linked to the binding if no existing token matches its requirements. If not
+	// specified, a new token with exactly the binding's permissions is created.
+	// +optional
+	TokenPolicy TokenPolicy `json:"tokenPolicy,omitempty"`
+	// TokenRef pins the binding to the SPIAccessToken with the given name in the namespace of the binding. No token
+	// lookup is involved, the token is linked as long as it exists and is for the service provider of the repository,
+	// regardless of its permissions. It cannot be combined with the "Superset" or "Named" token policies.
+	// +optional
+	TokenRef *TokenReference `json:"tokenRef,omitempty"`
+	// Ephemeral requests that a short-lived token minted by the service provider from the linked token is injected
+	// instead of the long-lived linked token itself. The injected secret is refreshed before the short-lived token
+	// expires. The binding fails if the service provider doesn't support minting the short-lived tokens.
+	// +optional
+	Ephemeral bool `json:"ephemeral,omitempty"`
+	// CredentialFlavor is the kind of the credential of the linked token that is injected into the secret. Defaults to
+	// the access token. The binding fails if the linked token doesn't contain the credential. Only the access token can
+	// be used with ephemeral bindings.
+	// +kubebuilder:validation:Enum=AccessToken;RefreshToken;Password;SSHKey;CosignKey;OIDCToken
+	// +optional
+	CredentialFlavor CredentialFlavor `json:"credentialFlavor,omitempty"`
+	// WriteBack specifies the location in an external secret store the data of the secret is written to in addition to
+	// the secret itself. The written data is deleted together with the binding.
+	// +optional
+	WriteBack *WriteBackTarget `json:"writeBack,omitempty"`
+	// Lease checks the token out for a limited time. The secret is synced as usual, but it is deleted once the lease
+	// expires unless the lease is renewed before that. The binding then stays in the "LeaseExpired" phase.
+	// +optional
+	Lease *BindingLease `json:"lease,omitempty"`
+}
+
+// BindingLease is the time-bound checkout of the token of the binding.
+type BindingLease struct {
+	// Duration is how long the secret is kept after it was first synced or after the lease was renewed.
+	Duration metav1.Duration `json:"duration"`
+	// RenewTime renews the lease, i.e. the lease expires Duration after this time. The times in the future are ignored
+	// so that the lease cannot be extended beyond Duration from now. Renewing the expired lease syncs the secret again.
+	// +optional
+	RenewTime *metav1.Time `json:"renewTime,omitempty"`
+}
+
+// WriteBackTarget is the location in an external secret store the data of the binding is written to.
+type WriteBackTarget struct {
+	// Vault is the path of the secret in the Vault KV secrets engine configured for the write-back in the operator.
+	// The path is relative to the namespace of the binding, i.e. the data is written to
+	// "<configured mount>/<binding namespace>/<path>". The bindings delivering the secret using an ExternalSecret write
+	// to the path named after the binding if not specified.
+	// +kubebuilder:validation:MinLength=1
+	Vault string `json:"vault"`
 }
 
+// TokenReference references an SPIAccessToken in the namespace of the binding.
+type TokenReference struct {
+	// Name is the name of the SPIAccessToken.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+}
+
+// TokenPolicy controls how the SPIAccessToken linked to a binding is obtained.
+type TokenPolicy struct {
+	// Type is the type of the policy. "Exact" (the default) creates new tokens with exactly the permissions of
+	// the binding. "Superset" creates new tokens with the permissions of the binding together with
+	// the AdditionalPermissions so that the tokens can be reused by bindings with more permissions. "Named" doesn't
+	// create any tokens but links the existing token called TokenName if it has the permissions of the binding.
+	// +kubebuilder:validation:Enum=Exact;Superset;Named
+	// +optional
+	Type TokenPolicyType `json:"type,omitempty"`
+	// AdditionalPermissions are the permissions given to the newly created tokens in addition to the permissions
+	// of the binding. Only used with the "Superset" policy type.
+	// +optional
+	AdditionalPermissions Permissions `json:"additionalPermissions,omitempty"`
+	// TokenName is the name of the existing SPIAccessToken to link the binding to. Only used with the "Named" policy
+	// type. The token is only linked if it has the permissions required by the binding.
+	// +optional
+	TokenName string `json:"tokenName,omitempty"`
+}
+
+type TokenPolicyType string
+
+const (
+	TokenPolicyTypeExact    TokenPolicyType = "Exact"
+	TokenPolicyTypeSuperset TokenPolicyType = "Superset"
+	TokenPolicyTypeNamed    TokenPolicyType = "Named"
+)
+
 // SPIAccessTokenBindingStatus defines the observed state of SPIAccessTokenBinding
 type SPIAccessTokenBindingStatus struct {
 	Phase                 SPIAccessTokenBindingPhase       `json:"phase"`
@@ -36,14 +154,47 @@ type SPIAccessTokenBindingStatus struct {
 	LinkedAccessTokenName string                           `json:"linkedAccessTokenName"`
 	OAuthUrl              string                           `json:"oAuthUrl"`
 	SyncedObjectRef       TargetObjectRef                  `json:"syncedObjectRef"`
+	// FirstSyncTime is the time the secret of the binding was synced for the first time.
+	// +optional
+	FirstSyncTime *metav1.Time `json:"firstSyncTime,omitempty"`
+	// LeaseExpirationTime is the time the lease requested in the spec expires and the secret is deleted.
+	// +optional
+	LeaseExpirationTime *metav1.Time `json:"leaseExpirationTime,omitempty"`
+	// ServiceProviderError contains the details of the failed call to the service provider if it caused the error
+	// of the binding.
+	// +optional
+	ServiceProviderError *ServiceProviderErrorDetails `json:"serviceProviderError,omitempty"`
+	// WriteBackPath is the path in the external secret store the data of the binding has been written to.
+	// +optional
+	WriteBackPath string `json:"writeBackPath,omitempty"`
+	// Conditions describe the stages of the synchronization of the secret, in the order they happen: TokenMatched,
+	// TokenDataAvailable, SecretRendered and SecretSynced. The first condition that is not true is the stage the binding
+	// is stuck at, the following stages are unknown.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
+const (
+	// SPIAccessTokenBindingConditionTokenMatched is true when the binding is linked to a token matching it.
+	SPIAccessTokenBindingConditionTokenMatched = "TokenMatched"
+	// SPIAccessTokenBindingConditionTokenDataAvailable is true when the data of the linked token could be read.
+	SPIAccessTokenBindingConditionTokenDataAvailable = "TokenDataAvailable"
+	// SPIAccessTokenBindingConditionSecretRendered is true when the data of the secret was produced from the token data.
+	SPIAccessTokenBindingConditionSecretRendered = "SecretRendered"
+	// SPIAccessTokenBindingConditionSecretSynced is true when the secret was synced to the cluster.
+	SPIAccessTokenBindingConditionSecretSynced = "SecretSynced"
+)
+
 type SPIAccessTokenBindingPhase string
 
 const (
 	SPIAccessTokenBindingPhaseAwaitingTokenData SPIAccessTokenBindingPhase = "AwaitingTokenData"
 	SPIAccessTokenBindingPhaseInjected          SPIAccessTokenBindingPhase = "Injected"
 	SPIAccessTokenBindingPhaseError             SPIAccessTokenBindingPhase = "Error"
+	// SPIAccessTokenBindingPhaseLeaseExpired means the lease of the binding expired and its secret was deleted.
+	SPIAccessTokenBindingPhaseLeaseExpired SPIAccessTokenBindingPhase = "LeaseExpired"
 )
 
 type SPIAccessTokenBindingErrorReason string
@@ -56,6 +207,28 @@ const (
 	SPIAccessTokenBindingErrorReasonTokenSync                  SPIAccessTokenBindingErrorReason = "TokenSync"
 	SPIAccessTokenBindingErrorReasonTokenAnalysis              SPIAccessTokenBindingErrorReason = "TokenAnalysis"
 	SPIAccessTokenBindingErrorReasonUnsupportedPermissions     SPIAccessTokenBindingErrorReason = "UnsupportedPermissions"
+	SPIAccessTokenBindingErrorReasonTokenPolicy                SPIAccessTokenBindingErrorReason = "TokenPolicy"
+	SPIAccessTokenBindingErrorReasonTokenRef                   SPIAccessTokenBindingErrorReason = "TokenRef"
+	SPIAccessTokenBindingErrorReasonOAuthNotConfigured         SPIAccessTokenBindingErrorReason = "OAuthNotConfigured"
+	SPIAccessTokenBindingErrorReasonEphemeralTokenUnsupported  SPIAccessTokenBindingErrorReason = "EphemeralTokenUnsupported"
+	SPIAccessTokenBindingErrorReasonEphemeralTokenMinting      SPIAccessTokenBindingErrorReason = "EphemeralTokenMinting"
+	SPIAccessTokenBindingErrorReasonMissingCredential          SPIAccessTokenBindingErrorReason = "MissingCredential"
+	SPIAccessTokenBindingErrorReasonWriteBack                  SPIAccessTokenBindingErrorReason = "WriteBack"
+	SPIAccessTokenBindingErrorReasonPolicy                     SPIAccessTokenBindingErrorReason = "Policy"
+	SPIAccessTokenBindingErrorReasonTokenOwnership             SPIAccessTokenBindingErrorReason = "TokenOwnership"
+	// SPIAccessTokenBindingErrorReasonSecretConflict means the secret requested by the binding exists and is not
+	// controlled by the binding (e.g. it belongs to another binding or it was created by the user).
+	SPIAccessTokenBindingErrorReasonSecretConflict SPIAccessTokenBindingErrorReason = "SecretConflict"
+	// SPIAccessTokenBindingErrorReasonPodDelivery means the binding requests the "Pod" delivery, but the delivery of
+	// the data directly into the pods is not enabled in the operator.
+	SPIAccessTokenBindingErrorReasonPodDelivery SPIAccessTokenBindingErrorReason = "PodDelivery"
+	// SPIAccessTokenBindingErrorReasonTokenPermissionsReduced means the permissions of the token the binding synced
+	// its secret from were reduced on the service provider side (e.g. by the user in the UI of the service provider)
+	// and no other token has the permissions required by the binding.
+	SPIAccessTokenBindingErrorReasonTokenPermissionsReduced SPIAccessTokenBindingErrorReason = "TokenPermissionsReduced"
+	// SPIAccessTokenBindingErrorReasonRepoUrlNotAllowed means the host of the repository URL is not allowed by
+	// the configuration of the operator.
+	SPIAccessTokenBindingErrorReasonRepoUrlNotAllowed SPIAccessTokenBindingErrorReason = "RepoUrlNotAllowed"
 )
 
 //+kubebuilder:object:root=true
@@ -93,11 +266,95 @@ type SecretSpec struct {
 	// according to the documentation https://kubernetes.io/docs/concepts/configuration/secret/#secret-types.
 	// Only kubernetes.io/service-account-token, kubernetes.io/dockercfg, kubernetes.io/dockerconfigjson and kubernetes.io/basic-auth
 	// are supported. All other secret types need to have their mapping specified manually using the Fields.
+	// Additionally, the sigstore.dev/cosign and sigstore.dev/oidc-token types produce the secrets usable by cosign for
+	// signing the images. The npmjs.com/npmrc type produces the .npmrc file configuring npm to use the registry
+	// at the repository URL of the binding with the credentials. The maven.apache.org/settings type produces
+	// the Maven settings.xml file with the credentials of the server with the MavenServerId. The pypa.io/pip type
+	// produces the PIP_INDEX_URL environment variable and the pip.conf file using the Python package index at
+	// the repository URL of the binding with the credentials. The helm.sh/repository type produces the Helm
+	// registry config.json for the OCI repository URLs (oci://) and the Helm repositories.yaml with
+	// the HelmRepositoryName for the other chart repository URLs.
 	Type corev1.SecretType `json:"type,omitempty"`
 	// Fields specifies the mapping from the token record fields to the keys in the secret data.
 	Fields TokenFieldMapping `json:"fields,omitempty"`
+	// MavenServerId is the id of the server in the settings.xml of the secrets of the maven.apache.org/settings type.
+	// It must match the id of the repository in the Maven project. Defaults to the host of the repository URL.
+	// +optional
+	MavenServerId string `json:"mavenServerId,omitempty"`
+	// HelmRepositoryName is the name of the chart repository in the repositories.yaml of the secrets of
+	// the helm.sh/repository type. Defaults to the host of the repository URL.
+	// +optional
+	HelmRepositoryName string `json:"helmRepositoryName,omitempty"`
+	// Delivery specifies how the secret is delivered. "Secret" (the default) creates the secret directly.
+	// "ExternalSecret" writes the data back to Vault and creates an ExternalSecret of the External Secrets Operator
+	// producing the secret from it instead. "Pod" doesn't create any object at all. The data is only rendered when
+	// a pod annotated with the spi.appstudio.redhat.com/inject-binding annotation starts and is mounted into it
+	// in memory, so that it is never persisted in the cluster.
+	// +kubebuilder:validation:Enum=Secret;ExternalSecret;Pod
+	// +optional
+	Delivery SecretDelivery `json:"delivery,omitempty"`
+	// EnvKeys makes the token data also rendered into the keys named like environment variables, so that the secret
+	// can be used as is in the envFrom of the containers. The git service providers produce the GIT_USERNAME and
+	// GIT_TOKEN keys, the image registries the REGISTRY_USERNAME, REGISTRY_TOKEN and REGISTRY_AUTH (the base64-encoded
+	// "username:token" as used in the docker configuration) keys and Kubernetes the KUBE_USERNAME and KUBE_TOKEN keys.
+	// +optional
+	EnvKeys bool `json:"envKeys,omitempty"`
+	// EnvPrefix is prepended to the names of the keys produced by the EnvKeys, e.g. "UPSTREAM_" produces
+	// the UPSTREAM_GIT_TOKEN key. It must only contain the characters allowed in the names of environment variables.
+	// +kubebuilder:validation:Pattern=`^[A-Za-z_][A-Za-z0-9_]*$`
+	// +optional
+	EnvPrefix string `json:"envPrefix,omitempty"`
+	// LinkedServiceAccounts selects the service accounts in the namespace of the binding the secret is added to as
+	// an image pull secret once it is injected, including the service accounts created later. An empty selector
+	// selects all the service accounts. Only the secrets of the kubernetes.io/dockerconfigjson and
+	// kubernetes.io/dockercfg types can be linked to the service accounts.
+	// +optional
+	LinkedServiceAccounts *metav1.LabelSelector `json:"linkedServiceAccounts,omitempty"`
 }
 
+const (
+	// SecretTypeCosign is the type of the secrets with the cosign key pair in the format of the secrets created by
+	// "cosign generate-key-pair k8s://...", i.e. with the cosign.key, cosign.password and cosign.pub keys. Requires
+	// the CosignKey credential flavor.
+	SecretTypeCosign corev1.SecretType = "sigstore.dev/cosign"
+	// SecretTypeSigstoreOIDCToken is the type of the secrets with the OIDC identity token for the keyless signing in
+	// the oidc-token key. Requires the OIDCToken credential flavor.
+	SecretTypeSigstoreOIDCToken corev1.SecretType = "sigstore.dev/oidc-token"
+	// SecretTypeNpmrc is the type of the secrets with the npm configuration in the .npmrc key that points npm to
+	// the registry at the repository URL of the binding and authenticates to it using the token.
+	SecretTypeNpmrc corev1.SecretType = "npmjs.com/npmrc"
+	// SecretTypeMavenSettings is the type of the secrets with the Maven settings in the settings.xml key that contain
+	// the username and the token as the password of a single server.
+	SecretTypeMavenSettings corev1.SecretType = "maven.apache.org/settings"
+	// SecretTypePip is the type of the secrets with the URL of the Python package index with the credentials in
+	// the PIP_INDEX_URL key, usable as an environment variable, and the same in the pip.conf key.
+	SecretTypePip corev1.SecretType = "pypa.io/pip"
+	// SecretTypeHelmRepository is the type of the secrets with the credentials of the Helm chart repository at
+	// the repository URL of the binding. The OCI repositories (with the oci:// URLs) get the Helm registry
+	// configuration in the config.json key, the classic chart repositories the Helm repository configuration with
+	// the single repository in the repositories.yaml key.
+	SecretTypeHelmRepository corev1.SecretType = "helm.sh/repository"
+
+	CosignPrivateKeyKey   = "cosign.key"
+	CosignPasswordKey     = "cosign.password"
+	CosignPublicKeyKey    = "cosign.pub"
+	SigstoreOIDCTokenKey  = "oidc-token"
+	NpmrcKey              = ".npmrc"
+	MavenSettingsKey      = "settings.xml"
+	PipIndexUrlKey        = "PIP_INDEX_URL"
+	PipConfKey            = "pip.conf"
+	HelmRegistryConfigKey = "config.json"
+	HelmRepositoriesKey   = "repositories.yaml"
+)
+
+type SecretDelivery string
+
+const (
+	SecretDeliverySecret         SecretDelivery = "Secret"
+	SecretDeliveryExternalSecret SecretDelivery = "ExternalSecret"
+	SecretDeliveryPod            SecretDelivery = "Pod"
+)
+
 type TokenFieldMapping struct {
 	// Token specifies the data key in which the token should be stored.
 	Token string `json:"token,omitempty"`
@@ -121,11 +378,28 @@ type TokenFieldMapping struct {
 
 type TargetObjectRef struct {
 	// Name is the name of the object with the injected data. This always lives in the same namespace as the AccessTokenSecret object.
+	// With the "Pod" delivery, no object is created and the reference points to the binding itself.
 	Name string `json:"name"`
 	// Kind is the kind of the object with the injected data.
 	Kind string `json:"kind"`
 	// ApiVersion is the api version of the object with the injected data.
 	ApiVersion string `json:"apiVersion"`
+	// UID is the UID of the object with the injected data.
+	// +optional
+	UID types.UID `json:"uid,omitempty"`
+	// DataChecksum is the hex-encoded SHA-256 checksum of the injected data. It is computed over the data keys in
+	// the lexicographical order, each key and each value being followed by a zero byte.
+	// +optional
+	DataChecksum string `json:"dataChecksum,omitempty"`
+	// LastSyncTime is the time the injected data last changed.
+	// +optional
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+	// ExpirationTime is the time the injected data expires. Only set for ephemeral bindings.
+	// +optional
+	ExpirationTime *metav1.Time `json:"expirationTime,omitempty"`
+	// SyncedGeneration is the generation of the binding the object was last synced for.
+	// +optional
+	SyncedGeneration int64 `json:"syncedGeneration,omitempty"`
 }
 
 func init() {
@@ -140,6 +414,17 @@ func (in *SPIAccessTokenBinding) ObjNamespace() string {
 	return in.Namespace
 }
 
+// MayUseToken checks whether the binding may use the token given the ownership of the token. The tokens without
+// an owner can be used by any binding, the owned tokens only by the bindings created by their owner or by an admin.
+func (in *SPIAccessTokenBinding) MayUseToken(token *SPIAccessToken) bool {
+	owner := token.Annotations[TokenOwnerAnnotation]
+	if owner == "" {
+		return true
+	}
+
+	return in.Annotations[BindingCreatedByAdminAnnotation] == "true" || in.Annotations[BindingCreatorAnnotation] == owner
+}
+
 func (in *SPIAccessTokenBinding) Permissions() *Permissions {
 	return &in.Spec.Permissions
 }
@@ -0,0 +1,108 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SPIAdminOverrideSpec defines the desired state of SPIAdminOverride
+type SPIAdminOverrideSpec struct {
+	// Action is the action forced on the target.
+	Action SPIAdminOverrideAction `json:"action"`
+	// Target is the object in the same namespace the action is forced on.
+	Target SPIAdminOverrideTarget `json:"target"`
+	// Finalizer is the finalizer removed from the target by the RemoveFinalizer action.
+	// +optional
+	Finalizer string `json:"finalizer,omitempty"`
+	// Reason is the justification of the override. It is recorded in the events emitted for the override and
+	// the target.
+	// +kubebuilder:validation:MinLength=1
+	Reason string `json:"reason"`
+}
+
+// SPIAdminOverrideTarget identifies the object the override is performed on.
+type SPIAdminOverrideTarget struct {
+	// +kubebuilder:validation:Enum=SPIAccessToken;SPIAccessTokenBinding;SPIRepositoryWebhook
+	Kind string `json:"kind"`
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+}
+
+// SPIAdminOverrideAction is the action forced by an SPIAdminOverride.
+// +kubebuilder:validation:Enum=RemoveFinalizer;DeleteTokenData;RefreshMetadata;RecoverTokenData
+type SPIAdminOverrideAction string
+
+const (
+	// SPIAdminOverrideActionRemoveFinalizer removes the finalizer from the target without running the finalization.
+	SPIAdminOverrideActionRemoveFinalizer SPIAdminOverrideAction = "RemoveFinalizer"
+	// SPIAdminOverrideActionDeleteTokenData deletes the data of the target SPIAccessToken from the token storage.
+	SPIAdminOverrideActionDeleteTokenData SPIAdminOverrideAction = "DeleteTokenData"
+	// SPIAdminOverrideActionRefreshMetadata marks the metadata of the target SPIAccessToken as stale so that they are
+	// read again from the service provider.
+	SPIAdminOverrideActionRefreshMetadata SPIAdminOverrideAction = "RefreshMetadata"
+	// SPIAdminOverrideActionRecoverTokenData moves the data of the most recently deleted token with the same name as
+	// the target SPIAccessToken back to the target. The data of the deleted tokens is only kept if tokenDataRetention
+	// is configured.
+	SPIAdminOverrideActionRecoverTokenData SPIAdminOverrideAction = "RecoverTokenData"
+)
+
+// SPIAdminOverrideStatus defines the observed state of SPIAdminOverride
+type SPIAdminOverrideStatus struct {
+	Phase SPIAdminOverridePhase `json:"phase"`
+	// +optional
+	ErrorMessage string `json:"errorMessage,omitempty"`
+	// CompletionTime is the time the action was performed.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// ObservedGeneration is the generation of the spec the action was performed for. The action is not repeated
+	// until the spec changes.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+}
+
+type SPIAdminOverridePhase string
+
+const (
+	SPIAdminOverridePhaseCompleted SPIAdminOverridePhase = "Completed"
+	SPIAdminOverridePhaseFailed    SPIAdminOverridePhase = "Failed"
+)
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+
+// SPIAdminOverride is the Schema for the spiadminoverrides API. It lets the cluster admins force an action on an SPI
+// object that is stuck, for example during an incident, instead of patching the object manually. Every performed
+// action is recorded in the events of the override and the target.
+type SPIAdminOverride struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SPIAdminOverrideSpec   `json:"spec,omitempty"`
+	Status SPIAdminOverrideStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// SPIAdminOverrideList contains a list of SPIAdminOverride
+type SPIAdminOverrideList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SPIAdminOverride `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SPIAdminOverride{}, &SPIAdminOverrideList{})
+}
@@ -0,0 +1,100 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SPIRepositoryDiscoverySpec defines the desired state of SPIRepositoryDiscovery
+type SPIRepositoryDiscoverySpec struct {
+	// TokenName is the name of the ready SPIAccessToken in the same namespace whose accessible repositories are listed.
+	// +kubebuilder:validation:MinLength=1
+	TokenName string `json:"tokenName"`
+	// Page is the number of the page of the listing, starting at 1. Defaults to the first page.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Page int `json:"page,omitempty"`
+	// PerPage is the maximum number of the repositories on a page. Defaults to 30.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	PerPage int `json:"perPage,omitempty"`
+}
+
+// SPIRepositoryDiscoveryStatus defines the observed state of SPIRepositoryDiscovery
+type SPIRepositoryDiscoveryStatus struct {
+	// Repositories is the list of the URLs of the repositories on the requested page of the listing.
+	// +optional
+	Repositories []string `json:"repositories,omitempty"`
+	// HasNextPage is true if there are more repositories on the next page of the listing.
+	// +optional
+	HasNextPage bool `json:"hasNextPage,omitempty"`
+	// ObservedGeneration is the generation of the spec the repositories were listed for.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// LastRefreshTime is the time the repositories were listed in the service provider. The listing is refreshed
+	// once it is older than the token lookup cache TTL configured in the operator.
+	// +optional
+	LastRefreshTime *metav1.Time `json:"lastRefreshTime,omitempty"`
+	// +optional
+	ErrorReason SPIRepositoryDiscoveryErrorReason `json:"errorReason,omitempty"`
+	// +optional
+	ErrorMessage string `json:"errorMessage,omitempty"`
+}
+
+type SPIRepositoryDiscoveryErrorReason string
+
+const (
+	// DefaultRepositoryDiscoveryPerPage is the number of the repositories on a page if not specified.
+	DefaultRepositoryDiscoveryPerPage = 30
+	// MaxRepositoryDiscoveryPerPage is the maximum number of the repositories on a page. It keeps the size of
+	// the status bounded.
+	MaxRepositoryDiscoveryPerPage = 100
+)
+
+const (
+	SPIRepositoryDiscoveryErrorReasonTokenNotReady          SPIRepositoryDiscoveryErrorReason = "TokenNotReady"
+	SPIRepositoryDiscoveryErrorReasonUnknownServiceProvider SPIRepositoryDiscoveryErrorReason = "UnknownServiceProvider"
+	SPIRepositoryDiscoveryErrorReasonUnsupported            SPIRepositoryDiscoveryErrorReason = "Unsupported"
+	SPIRepositoryDiscoveryErrorReasonServiceProviderError   SPIRepositoryDiscoveryErrorReason = "ServiceProviderError"
+)
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+
+// SPIRepositoryDiscovery is the Schema for the spirepositorydiscoveries API. It lists a page of the repositories
+// accessible using an SPIAccessToken so that the UIs can offer them to the user instead of requiring the repository
+// URLs to be typed in.
+type SPIRepositoryDiscovery struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SPIRepositoryDiscoverySpec   `json:"spec,omitempty"`
+	Status SPIRepositoryDiscoveryStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// SPIRepositoryDiscoveryList contains a list of SPIRepositoryDiscovery
+type SPIRepositoryDiscoveryList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SPIRepositoryDiscovery `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SPIRepositoryDiscovery{}, &SPIRepositoryDiscoveryList{})
+}
@@ -0,0 +1,114 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SPIRepositoryWebhookSpec defines the desired state of SPIRepositoryWebhook
+type SPIRepositoryWebhookSpec struct {
+	// BindingName is the name of the SPIAccessTokenBinding in the same namespace. The webhook is created in
+	// the repository of the binding using the token linked to it. The token needs to have the write permission in
+	// the webhooks area.
+	// +kubebuilder:validation:MinLength=1
+	BindingName string `json:"bindingName"`
+	// Url is the URL the service provider delivers the events to.
+	// +kubebuilder:validation:MinLength=1
+	Url string `json:"url"`
+	// Events is the list of the events that trigger the webhook in the format of the service provider. Defaults to
+	// the push events.
+	// +optional
+	Events []string `json:"events,omitempty"`
+	// SecretName is the name of the secret in the same namespace with the secret used to sign the deliveries of
+	// the webhook in the "secret" key. The deliveries are not signed if not specified.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+}
+
+// SPIRepositoryWebhookStatus defines the observed state of SPIRepositoryWebhook
+type SPIRepositoryWebhookStatus struct {
+	Phase SPIRepositoryWebhookPhase `json:"phase"`
+	// +optional
+	ErrorReason SPIRepositoryWebhookErrorReason `json:"errorReason,omitempty"`
+	// +optional
+	ErrorMessage string `json:"errorMessage,omitempty"`
+	// RepoUrl is the URL of the repository the webhook was created in.
+	// +optional
+	RepoUrl string `json:"repoUrl,omitempty"`
+	// TokenName is the name of the SPIAccessToken the webhook was created with. It is used to delete the webhook.
+	// +optional
+	TokenName string `json:"tokenName,omitempty"`
+	// WebhookId is the ID of the webhook in the service provider.
+	// +optional
+	WebhookId string `json:"webhookId,omitempty"`
+	// SecretChecksum is the SHA-256 checksum of the secret the webhook was created or updated with. It is used to
+	// detect the rotation of the secret.
+	// +optional
+	SecretChecksum string `json:"secretChecksum,omitempty"`
+	// ObservedGeneration is the generation of the spec the webhook was created or updated for.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+}
+
+type SPIRepositoryWebhookPhase string
+
+const (
+	SPIRepositoryWebhookPhasePending SPIRepositoryWebhookPhase = "Pending"
+	SPIRepositoryWebhookPhaseReady   SPIRepositoryWebhookPhase = "Ready"
+	SPIRepositoryWebhookPhaseError   SPIRepositoryWebhookPhase = "Error"
+)
+
+type SPIRepositoryWebhookErrorReason string
+
+const (
+	SPIRepositoryWebhookErrorReasonBindingNotReady         SPIRepositoryWebhookErrorReason = "BindingNotReady"
+	SPIRepositoryWebhookErrorReasonInsufficientPermissions SPIRepositoryWebhookErrorReason = "InsufficientPermissions"
+	SPIRepositoryWebhookErrorReasonUnknownServiceProvider  SPIRepositoryWebhookErrorReason = "UnknownServiceProvider"
+	SPIRepositoryWebhookErrorReasonUnsupported             SPIRepositoryWebhookErrorReason = "Unsupported"
+	SPIRepositoryWebhookErrorReasonSecretNotFound          SPIRepositoryWebhookErrorReason = "SecretNotFound"
+	SPIRepositoryWebhookErrorReasonServiceProviderError    SPIRepositoryWebhookErrorReason = "ServiceProviderError"
+	SPIRepositoryWebhookErrorReasonTokenNotFound           SPIRepositoryWebhookErrorReason = "TokenNotFound"
+)
+
+// RepositoryWebhookSecretKey is the key in the secret referenced by SPIRepositoryWebhookSpec.SecretName with the secret
+// used to sign the deliveries of the webhook.
+const RepositoryWebhookSecretKey = "secret"
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+
+// SPIRepositoryWebhook is the Schema for the spirepositorywebhooks API. It ensures a webhook exists in the repository
+// of an SPIAccessTokenBinding. The webhook is deleted from the repository together with the SPIRepositoryWebhook.
+type SPIRepositoryWebhook struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SPIRepositoryWebhookSpec   `json:"spec,omitempty"`
+	Status SPIRepositoryWebhookStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// SPIRepositoryWebhookList contains a list of SPIRepositoryWebhook
+type SPIRepositoryWebhookList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SPIRepositoryWebhook `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SPIRepositoryWebhook{}, &SPIRepositoryWebhookList{})
+}
@@ -0,0 +1,123 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SPISelfTestSpec defines the desired state of SPISelfTest
+type SPISelfTestSpec struct {
+	// ServiceProviderUrl is the URL of the service provider the test credential is uploaded for. It must be the base URL
+	// of a service provider of type Echo in the operator configuration. Defaults to the selfTestServiceProviderUrl of
+	// the operator configuration.
+	// +optional
+	ServiceProviderUrl string `json:"serviceProviderUrl,omitempty"`
+	// RepoUrl is the URL of the repository the test binding is created for. Defaults to the ServiceProviderUrl.
+	// +optional
+	RepoUrl string `json:"repoUrl,omitempty"`
+	// Timeout is how long the test waits for the steps before the cleanup to complete. The cleanup gets the same time
+	// on its own. Defaults to 5 minutes.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// SPISelfTestStep is a step of the self-test. The steps are performed in the order of their declaration below.
+type SPISelfTestStep string
+
+const (
+	// SPISelfTestStepCreateToken creates the test SPIAccessToken and waits for it to await the token data.
+	SPISelfTestStepCreateToken SPISelfTestStep = "CreateToken"
+	// SPISelfTestStepUploadCredential stores the test credential for the test token and waits for the token to become
+	// ready.
+	SPISelfTestStepUploadCredential SPISelfTestStep = "UploadCredential"
+	// SPISelfTestStepCreateBinding creates the test SPIAccessTokenBinding linked to the test token and waits for its
+	// secret to be injected.
+	SPISelfTestStepCreateBinding SPISelfTestStep = "CreateBinding"
+	// SPISelfTestStepVerifySecret checks that the secret of the test binding contains the test credential.
+	SPISelfTestStepVerifySecret SPISelfTestStep = "VerifySecret"
+	// SPISelfTestStepCleanup deletes the test binding and token and waits for them to be gone. It is performed even if
+	// some of the previous steps failed.
+	SPISelfTestStepCleanup SPISelfTestStep = "Cleanup"
+)
+
+// SPISelfTestStepOutcome is the outcome of a step of the self-test.
+type SPISelfTestStepOutcome string
+
+const (
+	SPISelfTestStepOutcomePassed  SPISelfTestStepOutcome = "Passed"
+	SPISelfTestStepOutcomeFailed  SPISelfTestStepOutcome = "Failed"
+	SPISelfTestStepOutcomeSkipped SPISelfTestStepOutcome = "Skipped"
+)
+
+// SPISelfTestStepResult is the result of a finished step of the self-test.
+type SPISelfTestStepResult struct {
+	Step    SPISelfTestStep        `json:"step"`
+	Outcome SPISelfTestStepOutcome `json:"outcome"`
+	// +optional
+	Message        string      `json:"message,omitempty"`
+	CompletionTime metav1.Time `json:"completionTime"`
+}
+
+// SPISelfTestStatus defines the observed state of SPISelfTest
+type SPISelfTestStatus struct {
+	Phase SPISelfTestPhase `json:"phase"`
+	// +optional
+	ErrorMessage string `json:"errorMessage,omitempty"`
+	// StartTime is the time the test started.
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// CompletionTime is the time the test finished, including the cleanup.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Steps are the results of the finished steps in the order they were performed.
+	// +optional
+	Steps []SPISelfTestStepResult `json:"steps,omitempty"`
+}
+
+type SPISelfTestPhase string
+
+const (
+	SPISelfTestPhaseRunning   SPISelfTestPhase = "Running"
+	SPISelfTestPhaseSucceeded SPISelfTestPhase = "Succeeded"
+	SPISelfTestPhaseFailed    SPISelfTestPhase = "Failed"
+)
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+
+// SPISelfTest is the Schema for the spiselftests API. It runs an end-to-end check of the operator in its namespace
+// using an echo service provider, e.g. to verify a fresh installation. The test is run once, it has to be recreated to
+// run the test again.
+type SPISelfTest struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SPISelfTestSpec   `json:"spec,omitempty"`
+	Status SPISelfTestStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// SPISelfTestList contains a list of SPISelfTest
+type SPISelfTestList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SPISelfTest `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SPISelfTest{}, &SPISelfTestList{})
+}
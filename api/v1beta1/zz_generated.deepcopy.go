@@ -22,9 +22,60 @@ limitations under the License.
 package v1beta1
 
 import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AccessibleAccount) DeepCopyInto(out *AccessibleAccount) {
+	*out = *in
+	if in.Scopes != nil {
+		in, out := &in.Scopes, &out.Scopes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Organizations != nil {
+		in, out := &in.Organizations, &out.Organizations
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Repositories != nil {
+		in, out := &in.Repositories, &out.Repositories
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AccessibleAccount.
+func (in *AccessibleAccount) DeepCopy() *AccessibleAccount {
+	if in == nil {
+		return nil
+	}
+	out := new(AccessibleAccount)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BindingLease) DeepCopyInto(out *BindingLease) {
+	*out = *in
+	out.Duration = in.Duration
+	if in.RenewTime != nil {
+		in, out := &in.RenewTime, &out.RenewTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BindingLease.
+func (in *BindingLease) DeepCopy() *BindingLease {
+	if in == nil {
+		return nil
+	}
+	out := new(BindingLease)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Permission) DeepCopyInto(out *Permission) {
 	*out = *in
@@ -65,13 +116,34 @@ func (in *Permissions) DeepCopy() *Permissions {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in RepositoryPermissions) DeepCopyInto(out *RepositoryPermissions) {
+	{
+		in := &in
+		*out = make(RepositoryPermissions, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RepositoryPermissions.
+func (in RepositoryPermissions) DeepCopy() RepositoryPermissions {
+	if in == nil {
+		return nil
+	}
+	out := new(RepositoryPermissions)
+	in.DeepCopyInto(out)
+	return *out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SPIAccessCheck) DeepCopyInto(out *SPIAccessCheck) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPIAccessCheck.
@@ -124,6 +196,21 @@ func (in *SPIAccessCheckList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SPIAccessCheckRefStatus) DeepCopyInto(out *SPIAccessCheckRefStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPIAccessCheckRefStatus.
+func (in *SPIAccessCheckRefStatus) DeepCopy() *SPIAccessCheckRefStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SPIAccessCheckRefStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SPIAccessCheckSpec) DeepCopyInto(out *SPIAccessCheckSpec) {
 	*out = *in
@@ -143,6 +230,11 @@ func (in *SPIAccessCheckSpec) DeepCopy() *SPIAccessCheckSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SPIAccessCheckStatus) DeepCopyInto(out *SPIAccessCheckStatus) {
 	*out = *in
+	if in.Ref != nil {
+		in, out := &in.Ref, &out.Ref
+		*out = new(SPIAccessCheckRefStatus)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPIAccessCheckStatus.
@@ -188,7 +280,7 @@ func (in *SPIAccessTokenBinding) DeepCopyInto(out *SPIAccessTokenBinding) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPIAccessTokenBinding.
@@ -246,6 +338,22 @@ func (in *SPIAccessTokenBindingSpec) DeepCopyInto(out *SPIAccessTokenBindingSpec
 	*out = *in
 	in.Permissions.DeepCopyInto(&out.Permissions)
 	in.Secret.DeepCopyInto(&out.Secret)
+	in.TokenPolicy.DeepCopyInto(&out.TokenPolicy)
+	if in.TokenRef != nil {
+		in, out := &in.TokenRef, &out.TokenRef
+		*out = new(TokenReference)
+		**out = **in
+	}
+	if in.WriteBack != nil {
+		in, out := &in.WriteBack, &out.WriteBack
+		*out = new(WriteBackTarget)
+		**out = **in
+	}
+	if in.Lease != nil {
+		in, out := &in.Lease, &out.Lease
+		*out = new(BindingLease)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPIAccessTokenBindingSpec.
@@ -261,7 +369,27 @@ func (in *SPIAccessTokenBindingSpec) DeepCopy() *SPIAccessTokenBindingSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SPIAccessTokenBindingStatus) DeepCopyInto(out *SPIAccessTokenBindingStatus) {
 	*out = *in
-	out.SyncedObjectRef = in.SyncedObjectRef
+	in.SyncedObjectRef.DeepCopyInto(&out.SyncedObjectRef)
+	if in.FirstSyncTime != nil {
+		in, out := &in.FirstSyncTime, &out.FirstSyncTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LeaseExpirationTime != nil {
+		in, out := &in.LeaseExpirationTime, &out.LeaseExpirationTime
+		*out = (*in).DeepCopy()
+	}
+	if in.ServiceProviderError != nil {
+		in, out := &in.ServiceProviderError, &out.ServiceProviderError
+		*out = new(ServiceProviderErrorDetails)
+		**out = **in
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPIAccessTokenBindingStatus.
@@ -379,6 +507,22 @@ func (in *SPIAccessTokenList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SPIAccessTokenPhaseTransition) DeepCopyInto(out *SPIAccessTokenPhaseTransition) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPIAccessTokenPhaseTransition.
+func (in *SPIAccessTokenPhaseTransition) DeepCopy() *SPIAccessTokenPhaseTransition {
+	if in == nil {
+		return nil
+	}
+	out := new(SPIAccessTokenPhaseTransition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SPIAccessTokenSpec) DeepCopyInto(out *SPIAccessTokenSpec) {
 	*out = *in
@@ -403,6 +547,35 @@ func (in *SPIAccessTokenStatus) DeepCopyInto(out *SPIAccessTokenStatus) {
 		*out = new(TokenMetadata)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.ServiceProviderError != nil {
+		in, out := &in.ServiceProviderError, &out.ServiceProviderError
+		*out = new(ServiceProviderErrorDetails)
+		**out = **in
+	}
+	if in.PreviousDataVersions != nil {
+		in, out := &in.PreviousDataVersions, &out.PreviousDataVersions
+		*out = make([]uint64, len(*in))
+		copy(*out, *in)
+	}
+	if in.History != nil {
+		in, out := &in.History, &out.History
+		*out = make([]SPIAccessTokenPhaseTransition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.LinkedBindings != nil {
+		in, out := &in.LinkedBindings, &out.LinkedBindings
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPIAccessTokenStatus.
@@ -416,101 +589,728 @@ func (in *SPIAccessTokenStatus) DeepCopy() *SPIAccessTokenStatus {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *SecretSpec) DeepCopyInto(out *SecretSpec) {
+func (in *SPIAccessibilityReport) DeepCopyInto(out *SPIAccessibilityReport) {
 	*out = *in
-	if in.Labels != nil {
-		in, out := &in.Labels, &out.Labels
-		*out = make(map[string]string, len(*in))
-		for key, val := range *in {
-			(*out)[key] = val
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPIAccessibilityReport.
+func (in *SPIAccessibilityReport) DeepCopy() *SPIAccessibilityReport {
+	if in == nil {
+		return nil
+	}
+	out := new(SPIAccessibilityReport)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SPIAccessibilityReport) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SPIAccessibilityReportList) DeepCopyInto(out *SPIAccessibilityReportList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]SPIAccessibilityReport, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
-	if in.Annotations != nil {
-		in, out := &in.Annotations, &out.Annotations
-		*out = make(map[string]string, len(*in))
-		for key, val := range *in {
-			(*out)[key] = val
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPIAccessibilityReportList.
+func (in *SPIAccessibilityReportList) DeepCopy() *SPIAccessibilityReportList {
+	if in == nil {
+		return nil
+	}
+	out := new(SPIAccessibilityReportList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SPIAccessibilityReportList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SPIAccessibilityReportSpec) DeepCopyInto(out *SPIAccessibilityReportSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPIAccessibilityReportSpec.
+func (in *SPIAccessibilityReportSpec) DeepCopy() *SPIAccessibilityReportSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SPIAccessibilityReportSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SPIAccessibilityReportStatus) DeepCopyInto(out *SPIAccessibilityReportStatus) {
+	*out = *in
+	if in.Accounts != nil {
+		in, out := &in.Accounts, &out.Accounts
+		*out = make([]AccessibleAccount, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
-	out.Fields = in.Fields
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretSpec.
-func (in *SecretSpec) DeepCopy() *SecretSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPIAccessibilityReportStatus.
+func (in *SPIAccessibilityReportStatus) DeepCopy() *SPIAccessibilityReportStatus {
 	if in == nil {
 		return nil
 	}
-	out := new(SecretSpec)
+	out := new(SPIAccessibilityReportStatus)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *TargetObjectRef) DeepCopyInto(out *TargetObjectRef) {
+func (in *SPIAdminOverride) DeepCopyInto(out *SPIAdminOverride) {
 	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TargetObjectRef.
-func (in *TargetObjectRef) DeepCopy() *TargetObjectRef {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPIAdminOverride.
+func (in *SPIAdminOverride) DeepCopy() *SPIAdminOverride {
 	if in == nil {
 		return nil
 	}
-	out := new(TargetObjectRef)
+	out := new(SPIAdminOverride)
 	in.DeepCopyInto(out)
 	return out
 }
 
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SPIAdminOverride) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *Token) DeepCopyInto(out *Token) {
+func (in *SPIAdminOverrideList) DeepCopyInto(out *SPIAdminOverrideList) {
 	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]SPIAdminOverride, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Token.
-func (in *Token) DeepCopy() *Token {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPIAdminOverrideList.
+func (in *SPIAdminOverrideList) DeepCopy() *SPIAdminOverrideList {
 	if in == nil {
 		return nil
 	}
-	out := new(Token)
+	out := new(SPIAdminOverrideList)
 	in.DeepCopyInto(out)
 	return out
 }
 
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SPIAdminOverrideList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *TokenFieldMapping) DeepCopyInto(out *TokenFieldMapping) {
+func (in *SPIAdminOverrideSpec) DeepCopyInto(out *SPIAdminOverrideSpec) {
 	*out = *in
+	out.Target = in.Target
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenFieldMapping.
-func (in *TokenFieldMapping) DeepCopy() *TokenFieldMapping {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPIAdminOverrideSpec.
+func (in *SPIAdminOverrideSpec) DeepCopy() *SPIAdminOverrideSpec {
 	if in == nil {
 		return nil
 	}
-	out := new(TokenFieldMapping)
+	out := new(SPIAdminOverrideSpec)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *TokenMetadata) DeepCopyInto(out *TokenMetadata) {
+func (in *SPIAdminOverrideStatus) DeepCopyInto(out *SPIAdminOverrideStatus) {
 	*out = *in
-	if in.Scopes != nil {
-		in, out := &in.Scopes, &out.Scopes
-		*out = make([]string, len(*in))
-		copy(*out, *in)
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
 	}
-	if in.ServiceProviderState != nil {
-		in, out := &in.ServiceProviderState, &out.ServiceProviderState
-		*out = make([]byte, len(*in))
-		copy(*out, *in)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPIAdminOverrideStatus.
+func (in *SPIAdminOverrideStatus) DeepCopy() *SPIAdminOverrideStatus {
+	if in == nil {
+		return nil
 	}
+	out := new(SPIAdminOverrideStatus)
+	in.DeepCopyInto(out)
+	return out
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenMetadata.
-func (in *TokenMetadata) DeepCopy() *TokenMetadata {
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SPIAdminOverrideTarget) DeepCopyInto(out *SPIAdminOverrideTarget) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPIAdminOverrideTarget.
+func (in *SPIAdminOverrideTarget) DeepCopy() *SPIAdminOverrideTarget {
 	if in == nil {
 		return nil
 	}
-	out := new(TokenMetadata)
+	out := new(SPIAdminOverrideTarget)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SPIRepositoryDiscovery) DeepCopyInto(out *SPIRepositoryDiscovery) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPIRepositoryDiscovery.
+func (in *SPIRepositoryDiscovery) DeepCopy() *SPIRepositoryDiscovery {
+	if in == nil {
+		return nil
+	}
+	out := new(SPIRepositoryDiscovery)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SPIRepositoryDiscovery) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SPIRepositoryDiscoveryList) DeepCopyInto(out *SPIRepositoryDiscoveryList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]SPIRepositoryDiscovery, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPIRepositoryDiscoveryList.
+func (in *SPIRepositoryDiscoveryList) DeepCopy() *SPIRepositoryDiscoveryList {
+	if in == nil {
+		return nil
+	}
+	out := new(SPIRepositoryDiscoveryList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SPIRepositoryDiscoveryList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SPIRepositoryDiscoverySpec) DeepCopyInto(out *SPIRepositoryDiscoverySpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPIRepositoryDiscoverySpec.
+func (in *SPIRepositoryDiscoverySpec) DeepCopy() *SPIRepositoryDiscoverySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SPIRepositoryDiscoverySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SPIRepositoryDiscoveryStatus) DeepCopyInto(out *SPIRepositoryDiscoveryStatus) {
+	*out = *in
+	if in.Repositories != nil {
+		in, out := &in.Repositories, &out.Repositories
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.LastRefreshTime != nil {
+		in, out := &in.LastRefreshTime, &out.LastRefreshTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPIRepositoryDiscoveryStatus.
+func (in *SPIRepositoryDiscoveryStatus) DeepCopy() *SPIRepositoryDiscoveryStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SPIRepositoryDiscoveryStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SPIRepositoryWebhook) DeepCopyInto(out *SPIRepositoryWebhook) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	out.Status = in.Status
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPIRepositoryWebhook.
+func (in *SPIRepositoryWebhook) DeepCopy() *SPIRepositoryWebhook {
+	if in == nil {
+		return nil
+	}
+	out := new(SPIRepositoryWebhook)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SPIRepositoryWebhook) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SPIRepositoryWebhookList) DeepCopyInto(out *SPIRepositoryWebhookList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]SPIRepositoryWebhook, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPIRepositoryWebhookList.
+func (in *SPIRepositoryWebhookList) DeepCopy() *SPIRepositoryWebhookList {
+	if in == nil {
+		return nil
+	}
+	out := new(SPIRepositoryWebhookList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SPIRepositoryWebhookList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SPIRepositoryWebhookSpec) DeepCopyInto(out *SPIRepositoryWebhookSpec) {
+	*out = *in
+	if in.Events != nil {
+		in, out := &in.Events, &out.Events
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPIRepositoryWebhookSpec.
+func (in *SPIRepositoryWebhookSpec) DeepCopy() *SPIRepositoryWebhookSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SPIRepositoryWebhookSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SPIRepositoryWebhookStatus) DeepCopyInto(out *SPIRepositoryWebhookStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPIRepositoryWebhookStatus.
+func (in *SPIRepositoryWebhookStatus) DeepCopy() *SPIRepositoryWebhookStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SPIRepositoryWebhookStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SPISelfTest) DeepCopyInto(out *SPISelfTest) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPISelfTest.
+func (in *SPISelfTest) DeepCopy() *SPISelfTest {
+	if in == nil {
+		return nil
+	}
+	out := new(SPISelfTest)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SPISelfTest) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SPISelfTestList) DeepCopyInto(out *SPISelfTestList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]SPISelfTest, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPISelfTestList.
+func (in *SPISelfTestList) DeepCopy() *SPISelfTestList {
+	if in == nil {
+		return nil
+	}
+	out := new(SPISelfTestList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SPISelfTestList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SPISelfTestSpec) DeepCopyInto(out *SPISelfTestSpec) {
+	*out = *in
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPISelfTestSpec.
+func (in *SPISelfTestSpec) DeepCopy() *SPISelfTestSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SPISelfTestSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SPISelfTestStatus) DeepCopyInto(out *SPISelfTestStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Steps != nil {
+		in, out := &in.Steps, &out.Steps
+		*out = make([]SPISelfTestStepResult, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPISelfTestStatus.
+func (in *SPISelfTestStatus) DeepCopy() *SPISelfTestStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SPISelfTestStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SPISelfTestStepResult) DeepCopyInto(out *SPISelfTestStepResult) {
+	*out = *in
+	in.CompletionTime.DeepCopyInto(&out.CompletionTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SPISelfTestStepResult.
+func (in *SPISelfTestStepResult) DeepCopy() *SPISelfTestStepResult {
+	if in == nil {
+		return nil
+	}
+	out := new(SPISelfTestStepResult)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretSpec) DeepCopyInto(out *SecretSpec) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	out.Fields = in.Fields
+	if in.LinkedServiceAccounts != nil {
+		in, out := &in.LinkedServiceAccounts, &out.LinkedServiceAccounts
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretSpec.
+func (in *SecretSpec) DeepCopy() *SecretSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceProviderErrorDetails) DeepCopyInto(out *ServiceProviderErrorDetails) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceProviderErrorDetails.
+func (in *ServiceProviderErrorDetails) DeepCopy() *ServiceProviderErrorDetails {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceProviderErrorDetails)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TargetObjectRef) DeepCopyInto(out *TargetObjectRef) {
+	*out = *in
+	if in.LastSyncTime != nil {
+		in, out := &in.LastSyncTime, &out.LastSyncTime
+		*out = (*in).DeepCopy()
+	}
+	if in.ExpirationTime != nil {
+		in, out := &in.ExpirationTime, &out.ExpirationTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TargetObjectRef.
+func (in *TargetObjectRef) DeepCopy() *TargetObjectRef {
+	if in == nil {
+		return nil
+	}
+	out := new(TargetObjectRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Token) DeepCopyInto(out *Token) {
+	*out = *in
+	if in.Credentials != nil {
+		in, out := &in.Credentials, &out.Credentials
+		*out = make(map[CredentialFlavor]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.PreviousVersions != nil {
+		in, out := &in.PreviousVersions, &out.PreviousVersions
+		*out = make([]Token, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Token.
+func (in *Token) DeepCopy() *Token {
+	if in == nil {
+		return nil
+	}
+	out := new(Token)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TokenFieldMapping) DeepCopyInto(out *TokenFieldMapping) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenFieldMapping.
+func (in *TokenFieldMapping) DeepCopy() *TokenFieldMapping {
+	if in == nil {
+		return nil
+	}
+	out := new(TokenFieldMapping)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TokenMetadata) DeepCopyInto(out *TokenMetadata) {
+	*out = *in
+	if in.Scopes != nil {
+		in, out := &in.Scopes, &out.Scopes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ServiceProviderState != nil {
+		in, out := &in.ServiceProviderState, &out.ServiceProviderState
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+	if in.RepositoryPermissions != nil {
+		in, out := &in.RepositoryPermissions, &out.RepositoryPermissions
+		*out = make(map[string]RepositoryPermissions, len(*in))
+		for key, val := range *in {
+			var outVal map[string]string
+			if val == nil {
+				(*out)[key] = nil
+			} else {
+				in, out := &val, &outVal
+				*out = make(RepositoryPermissions, len(*in))
+				for key, val := range *in {
+					(*out)[key] = val
+				}
+			}
+			(*out)[key] = outVal
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenMetadata.
+func (in *TokenMetadata) DeepCopy() *TokenMetadata {
+	if in == nil {
+		return nil
+	}
+	out := new(TokenMetadata)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TokenPolicy) DeepCopyInto(out *TokenPolicy) {
+	*out = *in
+	in.AdditionalPermissions.DeepCopyInto(&out.AdditionalPermissions)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenPolicy.
+func (in *TokenPolicy) DeepCopy() *TokenPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(TokenPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TokenReference) DeepCopyInto(out *TokenReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenReference.
+func (in *TokenReference) DeepCopy() *TokenReference {
+	if in == nil {
+		return nil
+	}
+	out := new(TokenReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WriteBackTarget) DeepCopyInto(out *WriteBackTarget) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WriteBackTarget.
+func (in *WriteBackTarget) DeepCopy() *WriteBackTarget {
+	if in == nil {
+		return nil
+	}
+	out := new(WriteBackTarget)
 	in.DeepCopyInto(out)
 	return out
 }
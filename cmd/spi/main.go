@@ -0,0 +1,545 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The spi command contains the tools for working with the SPI objects outside of the cluster.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/matching"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/oauthstate"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/stateoffload"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/webhook"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+const usage = `Usage: spi <command> [flags]
+
+Commands:
+  match         checks whether a token would be matched to a binding
+  invalidate    wipes the data of a token in the cluster without deleting the token
+  fetch-credentials
+                fetches the data of the binding injected into the pod (used by the injected init container)
+  migrate-state re-persists the service provider state of the tokens in the current version of its schema
+  inspect-state decodes an OAuth state and checks whether it is valid
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the command with the provided arguments and returns the exit code.
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	switch args[0] {
+	case "match":
+		return runMatch(args[1:], stdout, stderr)
+	case "invalidate":
+		return runInvalidate(args[1:], stdout, stderr)
+	case "fetch-credentials":
+		return runFetchCredentials(args[1:], stdout, stderr)
+	case "migrate-state":
+		return runMigrateState(args[1:], stdout, stderr)
+	case "inspect-state":
+		return runInspectState(args[1:], stdout, stderr)
+	default:
+		fmt.Fprintf(stderr, "unknown command '%s'\n\n%s", args[0], usage)
+		return 2
+	}
+}
+
+// runMatch implements the match command. The exit code is 0 if the token matches the binding, 1 if it doesn't and 2
+// on errors.
+func runMatch(args []string, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("match", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	bindingFile := fs.String("binding", "", "The YAML file with the SPIAccessTokenBinding.")
+	tokenFile := fs.String("token", "", "The YAML file with the SPIAccessToken including its status.")
+	configFile := fs.String("config", "", "The configuration file of the operator. It is needed to recognize the repositories of the service providers without any well-known URL, like Kubernetes.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *bindingFile == "" || *tokenFile == "" {
+		fmt.Fprintln(stderr, "both --binding and --token are required")
+		return 2
+	}
+
+	binding := &api.SPIAccessTokenBinding{}
+	if err := readObject(*bindingFile, binding); err != nil {
+		fmt.Fprintf(stderr, "failed to read the binding: %s\n", err)
+		return 2
+	}
+
+	token := &api.SPIAccessToken{}
+	if err := readObject(*tokenFile, token); err != nil {
+		fmt.Fprintf(stderr, "failed to read the token: %s\n", err)
+		return 2
+	}
+
+	var serviceProviders []config.ServiceProviderConfiguration
+	if *configFile != "" {
+		cfg, err := config.LoadFrom(*configFile)
+		if err != nil {
+			fmt.Fprintf(stderr, "failed to read the configuration: %s\n", err)
+			return 2
+		}
+		serviceProviders = cfg.ServiceProviders
+	}
+
+	result, err := matching.Match(context.Background(), serviceProviders, binding, token)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to match: %s\n", err)
+		return 2
+	}
+
+	if !result.Matches {
+		fmt.Fprintf(stdout, "no match: %s\n", result.Reason)
+		return 1
+	}
+
+	fmt.Fprintln(stdout, "match")
+	return 0
+}
+
+// runInvalidate implements the invalidate command. It requests the data of the token to be wiped from the token storage
+// using the api.InvalidateTokenDataAnnotation. The operator then flips the token back to the AwaitingTokenData phase and
+// removes the annotation. The exit code is 0 on success and 2 on errors.
+func runInvalidate(args []string, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("invalidate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	tokenName := fs.String("token", "", "The name of the SPIAccessToken.")
+	namespace := fs.String("namespace", "", "The namespace of the SPIAccessToken. Defaults to the namespace of the current context.")
+	kubeconfig := fs.String("kubeconfig", "", "The kubeconfig file. Defaults to the standard kubectl configuration.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *tokenName == "" {
+		fmt.Fprintln(stderr, "--token is required")
+		return 2
+	}
+
+	cl, ns, err := newClient(*kubeconfig, *namespace)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	if err := invalidateToken(context.Background(), cl, types.NamespacedName{Name: *tokenName, Namespace: ns}); err != nil {
+		fmt.Fprintf(stderr, "failed to invalidate the token: %s\n", err)
+		return 2
+	}
+
+	fmt.Fprintf(stdout, "requested the invalidation of the data of the token %s/%s\n", ns, *tokenName)
+	return 0
+}
+
+// invalidateToken annotates the token with api.InvalidateTokenDataAnnotation. The token is patched rather than updated so
+// that the concurrent changes of the token made by the operator are not overwritten.
+func invalidateToken(ctx context.Context, cl client.Client, key types.NamespacedName) error {
+	token := &api.SPIAccessToken{}
+	if err := cl.Get(ctx, key, token); err != nil {
+		return err
+	}
+
+	patch := client.MergeFrom(token.DeepCopy())
+	if token.Annotations == nil {
+		token.Annotations = map[string]string{}
+	}
+	token.Annotations[api.InvalidateTokenDataAnnotation] = "true"
+
+	return cl.Patch(ctx, token, patch)
+}
+
+// runMigrateState implements the migrate-state command. The service provider state of the tokens is migrated to
+// the current version when the operator reads it, but it is only persisted in the new version once the operator
+// refreshes the metadata of the token. This command re-persists the state of all the tokens at once, so that the
+// migrations of the old versions can be removed from the operator. The exit code is 0 on success and 2 on errors.
+func runMigrateState(args []string, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("migrate-state", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	namespace := fs.String("namespace", "", "The namespace of the SPIAccessTokens. Defaults to the namespace of the current context.")
+	allNamespaces := fs.Bool("all-namespaces", false, "Migrate the SPIAccessTokens in all namespaces.")
+	configFile := fs.String("config", "", "The configuration file of the operator. It is needed to recognize the service providers without any well-known URL, like Kubernetes.")
+	dryRun := fs.Bool("dry-run", false, "Only print the tokens that would be migrated.")
+	kubeconfig := fs.String("kubeconfig", "", "The kubeconfig file. Defaults to the standard kubectl configuration.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	var serviceProviders []config.ServiceProviderConfiguration
+	stateSizeLimit := config.DefaultServiceProviderStateSizeLimit
+	if *configFile != "" {
+		cfg, err := config.LoadFrom(*configFile)
+		if err != nil {
+			fmt.Fprintf(stderr, "failed to read the configuration: %s\n", err)
+			return 2
+		}
+		serviceProviders = cfg.ServiceProviders
+		stateSizeLimit = cfg.ServiceProviderStateSizeLimit
+	}
+
+	cl, ns, err := newClient(*kubeconfig, *namespace)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if *allNamespaces {
+		ns = ""
+	}
+
+	// the states moved out of the status of the tokens by the operator need to be migrated too
+	migrated, err := migrateStates(context.Background(), &stateoffload.Client{Client: cl, SizeLimit: stateSizeLimit}, ns, serviceProviders, *dryRun, stdout)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to migrate the tokens: %s\n", err)
+		return 2
+	}
+
+	fmt.Fprintf(stdout, "migrated the state of %d tokens\n", migrated)
+	return 0
+}
+
+// migrateStates migrates the service provider state of the tokens in the namespace, or in all namespaces if it is
+// empty, and returns the number of the migrated tokens. The statuses are patched rather than updated so that
+// the concurrent changes of the tokens made by the operator are not overwritten. All the tokens are attempted even if
+// some of them fail.
+func migrateStates(ctx context.Context, cl client.Client, namespace string, serviceProviders []config.ServiceProviderConfiguration, dryRun bool, stdout io.Writer) (int, error) {
+	tokens := &api.SPIAccessTokenList{}
+	if err := cl.List(ctx, tokens, client.InNamespace(namespace)); err != nil {
+		return 0, fmt.Errorf("failed to list the tokens: %w", err)
+	}
+
+	migrated := 0
+	var errs []string
+	for i := range tokens.Items {
+		token := &tokens.Items[i]
+		patch := client.MergeFrom(token.DeepCopy())
+
+		changed, err := matching.MigrateState(serviceProviders, token)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s/%s: %s", token.Namespace, token.Name, err))
+			continue
+		}
+		if !changed {
+			continue
+		}
+
+		if !dryRun {
+			if err := cl.Status().Patch(ctx, token, patch); err != nil {
+				errs = append(errs, fmt.Sprintf("%s/%s: %s", token.Namespace, token.Name, err))
+				continue
+			}
+		}
+
+		fmt.Fprintf(stdout, "migrated %s/%s\n", token.Namespace, token.Name)
+		migrated++
+	}
+
+	if len(errs) > 0 {
+		return migrated, fmt.Errorf("failed to migrate %d tokens: %s", len(errs), strings.Join(errs, "; "))
+	}
+	return migrated, nil
+}
+
+// runInspectState implements the inspect-state command. It decodes the OAuth state using the signing keys from
+// the configuration of the operator and prints it together with the results of its validation. The exit code is 0 if
+// the state is valid, 1 if it isn't and 2 on errors.
+func runInspectState(args []string, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("inspect-state", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	state := fs.String("state", "", "The OAuth state or the whole OAuth URL with the state query parameter.")
+	configFile := fs.String("config", "", "The configuration file of the operator with the keys the states are signed with. "+
+		"If the states are signed using the Vault transit key, Vault is reached using the VAULT_ADDR (defaults to vaultHost "+
+		"from the configuration) and VAULT_TOKEN environment variables.")
+	maxAge := fs.Duration("max-age", 0, "The age after which the state is considered expired. The expiration is not checked if 0.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *state == "" || *configFile == "" {
+		fmt.Fprintln(stderr, "both --state and --config are required")
+		return 2
+	}
+
+	cfg, err := config.LoadFrom(*configFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to read the configuration: %s\n", err)
+		return 2
+	}
+
+	var transit *oauthstate.VaultTransit
+	if cfg.OAuthStateVaultTransitKey != "" {
+		vaultConfig := vaultapi.DefaultConfig()
+		if os.Getenv(vaultapi.EnvVaultAddress) == "" {
+			vaultConfig.Address = cfg.VaultHost
+		}
+		vaultClient, err := vaultapi.NewClient(vaultConfig)
+		if err != nil {
+			fmt.Fprintf(stderr, "failed to create the Vault client: %s\n", err)
+			return 2
+		}
+		transit = &oauthstate.VaultTransit{Client: vaultClient, Mount: cfg.OAuthStateVaultTransitMount, Key: cfg.OAuthStateVaultTransitKey}
+	}
+
+	codec, err := oauthstate.NewCodecFromConfiguration(cfg, transit)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to instantiate the OAuth state codec: %s\n", err)
+		return 2
+	}
+
+	valid, err := inspectState(&codec, *state, time.Now(), *maxAge, stdout)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to inspect the state: %s\n", err)
+		return 2
+	}
+
+	if !valid {
+		return 1
+	}
+	return 0
+}
+
+// inspectState prints the inspection of the state as YAML and returns whether the state is valid. The state can also
+// be provided as the OAuth URL, as found in the status of the tokens.
+func inspectState(codec *oauthstate.Codec, state string, now time.Time, maxAge time.Duration, stdout io.Writer) (bool, error) {
+	if strings.Contains(state, "?") {
+		u, err := url.Parse(state)
+		if err != nil {
+			return false, fmt.Errorf("failed to parse the OAuth URL: %w", err)
+		}
+		state = u.Query().Get("state")
+		if state == "" {
+			return false, fmt.Errorf("the OAuth URL has no state query parameter")
+		}
+	}
+
+	inspection, err := codec.Inspect(state, now, maxAge)
+	if err != nil {
+		return false, err
+	}
+
+	out, err := yaml.Marshal(&inspection)
+	if err != nil {
+		return false, fmt.Errorf("failed to print the inspection: %w", err)
+	}
+	if _, err := stdout.Write(out); err != nil {
+		return false, err
+	}
+
+	return inspection.Valid, nil
+}
+
+// defaultFetchRetryInterval is how long the fetch-credentials command waits before asking for the data of the binding
+// again if the server doesn't say otherwise.
+const defaultFetchRetryInterval = 5 * time.Second
+
+// runFetchCredentials implements the fetch-credentials command. It asks the pod credentials endpoint of the operator for
+// the data of the binding injected into the pod and writes it into the provided directory, one file per data key.
+// The request is repeated until the data is available or the timeout expires. The exit code is 0 on success and 2 on
+// errors.
+func runFetchCredentials(args []string, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("fetch-credentials", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	url := fs.String("url", "", "The URL of the pod credentials endpoint of the operator.")
+	tokenFile := fs.String("token-file", "", "The file with the service account token of the pod issued for the pod credentials endpoint.")
+	dir := fs.String("dir", "", "The directory to write the data to.")
+	caFile := fs.String("ca-file", "", "The file with the CA certificate of the endpoint. Defaults to the certificate in the SPI_CA_CERT environment variable or to the system CAs if not set.")
+	timeout := fs.Duration("timeout", 5*time.Minute, "How long to wait for the data of the binding to become available.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *url == "" || *tokenFile == "" || *dir == "" {
+		fmt.Fprintln(stderr, "--url, --token-file and --dir are required")
+		return 2
+	}
+
+	caCert := []byte(os.Getenv("SPI_CA_CERT"))
+	if *caFile != "" {
+		var err error
+		if caCert, err = os.ReadFile(*caFile); err != nil {
+			fmt.Fprintf(stderr, "failed to read the CA certificate: %s\n", err)
+			return 2
+		}
+	}
+
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+	if len(caCert) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			fmt.Fprintln(stderr, "failed to parse the CA certificate")
+			return 2
+		}
+		httpClient.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	data, err := fetchCredentials(ctx, httpClient, *url, *tokenFile, stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to fetch the credentials: %s\n", err)
+		return 2
+	}
+
+	if err := writeCredentials(*dir, data); err != nil {
+		fmt.Fprintf(stderr, "failed to write the credentials: %s\n", err)
+		return 2
+	}
+
+	fmt.Fprintf(stdout, "fetched %d credential files into %s\n", len(data), *dir)
+	return 0
+}
+
+// fetchCredentials requests the data of the binding until it is available or the context is done. The token is read
+// from the file before each request, because the kubelet rotates it.
+func fetchCredentials(ctx context.Context, httpClient *http.Client, url string, tokenFile string, stderr io.Writer) (map[string]string, error) {
+	for {
+		token, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the token: %w", err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the response: %w", err)
+		}
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			result := webhook.PodCredentialsResponse{}
+			if err := json.Unmarshal(body, &result); err != nil {
+				return nil, fmt.Errorf("failed to parse the response: %w", err)
+			}
+			return result.Data, nil
+		case http.StatusServiceUnavailable:
+			fmt.Fprintf(stderr, "the credentials are not available yet: %s", body)
+		default:
+			return nil, fmt.Errorf("the server responded with %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		}
+
+		retryInterval := defaultFetchRetryInterval
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			retryInterval = time.Duration(seconds) * time.Second
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("gave up waiting for the credentials: %w", ctx.Err())
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// writeCredentials writes each data key into a file of the same name in the directory. The keys that are not plain
+// file names are refused so that the data cannot be written outside the directory.
+func writeCredentials(dir string, data map[string]string) error {
+	for k := range data {
+		if k == "" || k == "." || k == ".." || filepath.Base(k) != k {
+			return fmt.Errorf("the data key '%s' is not a valid file name", k)
+		}
+	}
+
+	for k, v := range data {
+		// the directory is only shared by the containers of the same pod, which might run as different users
+		if err := os.WriteFile(filepath.Join(dir, k), []byte(v), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newClient creates the client using the kubeconfig and returns it together with the provided namespace or
+// the namespace of the current context if none is provided.
+func newClient(kubeconfig string, namespace string) (client.Client, string, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = kubeconfig
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{})
+
+	if namespace == "" {
+		ns, _, err := clientConfig.Namespace()
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to determine the namespace: %w", err)
+		}
+		namespace = ns
+	}
+
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read the kubeconfig: %w", err)
+	}
+
+	scheme := runtime.NewScheme()
+	if err := api.AddToScheme(scheme); err != nil {
+		return nil, "", fmt.Errorf("failed to initialize the scheme: %w", err)
+	}
+	// the secrets hold the service provider states moved out of the tokens
+	if err := corev1.AddToScheme(scheme); err != nil {
+		return nil, "", fmt.Errorf("failed to initialize the scheme: %w", err)
+	}
+
+	cl, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create the client: %w", err)
+	}
+
+	return cl, namespace, nil
+}
+
+func readObject(path string, obj interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return yaml.UnmarshalStrict(data, obj)
+}
@@ -0,0 +1,173 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/oauthstate"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestInvalidateToken(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, api.AddToScheme(sch))
+	cl := fake.NewClientBuilder().WithScheme(sch).WithObjects(&api.SPIAccessToken{
+		ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "ns", Annotations: map[string]string{"other": "value"}},
+	}).Build()
+
+	key := types.NamespacedName{Name: "token", Namespace: "ns"}
+	assert.NoError(t, invalidateToken(context.TODO(), cl, key))
+
+	token := &api.SPIAccessToken{}
+	assert.NoError(t, cl.Get(context.TODO(), key, token))
+	assert.Equal(t, map[string]string{"other": "value", api.InvalidateTokenDataAnnotation: "true"}, token.Annotations)
+
+	assert.Error(t, invalidateToken(context.TODO(), cl, types.NamespacedName{Name: "missing", Namespace: "ns"}))
+}
+
+func TestMigrateStates(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, api.AddToScheme(sch))
+	githubToken := func(name string, state string) *api.SPIAccessToken {
+		return &api.SPIAccessToken{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns"},
+			Spec:       api.SPIAccessTokenSpec{ServiceProviderUrl: "https://github.com"},
+			Status: api.SPIAccessTokenStatus{
+				TokenMetadata: &api.TokenMetadata{ServiceProviderState: []byte(state)},
+			},
+		}
+	}
+	cl := fake.NewClientBuilder().WithScheme(sch).WithObjects(
+		githubToken("legacy", `{"AccessibleRepos":{}}`),
+		githubToken("current", `{"version":1,"state":{"AccessibleRepos":{}}}`),
+		&api.SPIAccessToken{ObjectMeta: metav1.ObjectMeta{Name: "empty", Namespace: "ns"}},
+	).Build()
+
+	migrated, err := migrateStates(context.TODO(), cl, "ns", nil, true, io.Discard)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, migrated)
+
+	token := &api.SPIAccessToken{}
+	assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: "legacy", Namespace: "ns"}, token))
+	assert.JSONEq(t, `{"AccessibleRepos":{}}`, string(token.Status.TokenMetadata.ServiceProviderState))
+
+	migrated, err = migrateStates(context.TODO(), cl, "ns", nil, false, io.Discard)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, migrated)
+
+	assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: "legacy", Namespace: "ns"}, token))
+	assert.JSONEq(t, `{"version":1,"state":{"AccessibleRepos":{}}}`, string(token.Status.TokenMetadata.ServiceProviderState))
+
+	migrated, err = migrateStates(context.TODO(), cl, "ns", nil, false, io.Discard)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, migrated)
+}
+
+func TestInspectState(t *testing.T) {
+	now := time.Now()
+	codec, err := oauthstate.NewCodec([]byte("secret"))
+	assert.NoError(t, err)
+	state, err := codec.Encode(&oauthstate.AnonymousOAuthState{
+		TokenName:      "token",
+		TokenNamespace: "ns",
+		IssuedAt:       now.Add(-time.Hour).Unix(),
+	})
+	assert.NoError(t, err)
+
+	t.Run("valid state", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		valid, err := inspectState(&codec, state, now, 0, out)
+		assert.NoError(t, err)
+		assert.True(t, valid)
+		assert.Contains(t, out.String(), "tokenName: token")
+		assert.Contains(t, out.String(), "signatureValid: true")
+	})
+
+	t.Run("expired state in OAuth URL", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		valid, err := inspectState(&codec, "https://spi-oauth/github/authenticate?state="+state, now, 15*time.Minute, out)
+		assert.NoError(t, err)
+		assert.False(t, valid)
+		assert.Contains(t, out.String(), "the state expired 45m0s ago")
+	})
+
+	t.Run("OAuth URL without state", func(t *testing.T) {
+		_, err := inspectState(&codec, "https://spi-oauth/github/authenticate?other=1", now, 0, &bytes.Buffer{})
+		assert.Error(t, err)
+	})
+}
+
+func TestFetchCredentials(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(tokenFile, []byte("pod-token\n"), 0600))
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") != "Bearer pod-token" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if requests == 1 {
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "not injected yet", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"password":"secret"}}`))
+	}))
+	defer server.Close()
+
+	data, err := fetchCredentials(context.TODO(), server.Client(), server.URL, tokenFile, io.Discard)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"password": "secret"}, data)
+	assert.Equal(t, 2, requests)
+
+	t.Run("fails on errors", func(t *testing.T) {
+		_, err := fetchCredentials(context.TODO(), server.Client(), server.URL, filepath.Join(t.TempDir(), "missing"), io.Discard)
+		assert.Error(t, err)
+
+		assert.NoError(t, os.WriteFile(tokenFile, []byte("other-token"), 0600))
+		_, err = fetchCredentials(context.TODO(), server.Client(), server.URL, tokenFile, io.Discard)
+		assert.Error(t, err)
+	})
+}
+
+func TestWriteCredentials(t *testing.T) {
+	dir := t.TempDir()
+
+	assert.NoError(t, writeCredentials(dir, map[string]string{"username": "alice", ".dockerconfigjson": "{}"}))
+	content, err := os.ReadFile(filepath.Join(dir, ".dockerconfigjson"))
+	assert.NoError(t, err)
+	assert.Equal(t, "{}", string(content))
+
+	assert.Error(t, writeCredentials(dir, map[string]string{"../escape": "data"}))
+	assert.Error(t, writeCredentials(dir, map[string]string{"..": "data"}))
+	_, err = os.Stat(filepath.Join(filepath.Dir(dir), "escape"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,81 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"sync"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+)
+
+// accessCheckCache shares the results of the SPIAccessChecks of the public repositories across the cluster. HAC
+// creates an access check for every onboarding attempt and the checks of a public repository are the same regardless
+// of their namespace and the tokens in it, so there's no need to ask the service provider again. The results of
+// the private repositories depend on the tokens in the namespace of the check and are never cached. The zero value is
+// ready to use.
+type accessCheckCache struct {
+	lock    sync.Mutex
+	entries map[accessCheckCacheKey]accessCheckCacheEntry
+}
+
+// accessCheckCacheKey identifies the checks with the same result.
+type accessCheckCacheKey struct {
+	repoUrl string
+	ref     string
+}
+
+type accessCheckCacheEntry struct {
+	status  api.SPIAccessCheckStatus
+	expires time.Time
+}
+
+func accessCheckCacheKeyOf(ac *api.SPIAccessCheck) accessCheckCacheKey {
+	return accessCheckCacheKey{repoUrl: ac.Spec.RepoUrl, ref: ac.Spec.Ref}
+}
+
+// get returns the cached status of the check of the same repository and ref, if any.
+func (c *accessCheckCache) get(ac *api.SPIAccessCheck, now time.Time) (*api.SPIAccessCheckStatus, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, ok := c.entries[accessCheckCacheKeyOf(ac)]
+	if !ok || !now.Before(entry.expires) {
+		return nil, false
+	}
+	return entry.status.DeepCopy(), true
+}
+
+// put caches the status of the check for the provided time if it can be shared, i.e. if it is the successful check
+// of a public repository. The expired entries are dropped on each write, so that the cache doesn't grow with
+// the repositories that are no longer checked.
+func (c *accessCheckCache) put(ac *api.SPIAccessCheck, status *api.SPIAccessCheckStatus, ttl time.Duration, now time.Time) {
+	if ttl <= 0 || status.Accessibility != api.SPIAccessCheckAccessibilityPublic || status.ErrorReason != "" {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.entries == nil {
+		c.entries = map[accessCheckCacheKey]accessCheckCacheEntry{}
+	}
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+	c.entries[accessCheckCacheKeyOf(ac)] = accessCheckCacheEntry{status: *status.DeepCopy(), expires: now.Add(ttl)}
+}
@@ -0,0 +1,71 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAccessCheckCache(t *testing.T) {
+	check := func(namespace string, ref string) *api.SPIAccessCheck {
+		return &api.SPIAccessCheck{
+			ObjectMeta: metav1.ObjectMeta{Name: "check", Namespace: namespace},
+			Spec:       api.SPIAccessCheckSpec{RepoUrl: "https://github.com/acme/repo", Ref: ref},
+		}
+	}
+	public := &api.SPIAccessCheckStatus{Accessible: true, Accessibility: api.SPIAccessCheckAccessibilityPublic, ServiceProvider: api.ServiceProviderTypeGitHub}
+	now := time.Now()
+
+	t.Run("shares public results across namespaces", func(t *testing.T) {
+		cache := accessCheckCache{}
+		cache.put(check("a", ""), public, time.Minute, now)
+
+		status, ok := cache.get(check("b", ""), now.Add(30*time.Second))
+		assert.True(t, ok)
+		assert.Equal(t, public, status)
+
+		_, ok = cache.get(check("b", "main"), now)
+		assert.False(t, ok)
+	})
+
+	t.Run("expires", func(t *testing.T) {
+		cache := accessCheckCache{}
+		cache.put(check("a", ""), public, time.Minute, now)
+
+		_, ok := cache.get(check("a", ""), now.Add(time.Minute))
+		assert.False(t, ok)
+
+		cache.put(check("a", "main"), public, time.Minute, now.Add(time.Minute))
+		assert.Len(t, cache.entries, 1)
+	})
+
+	t.Run("doesn't cache private or failed results", func(t *testing.T) {
+		cache := accessCheckCache{}
+		cache.put(check("a", ""), &api.SPIAccessCheckStatus{Accessible: true, Accessibility: api.SPIAccessCheckAccessibilityPrivate}, time.Minute, now)
+		cache.put(check("a", "missing"), &api.SPIAccessCheckStatus{Accessibility: api.SPIAccessCheckAccessibilityPublic, ErrorReason: api.SPIAccessCheckErrorRefNotFound}, time.Minute, now)
+		assert.Empty(t, cache.entries)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		cache := accessCheckCache{}
+		cache.put(check("a", ""), public, 0, now)
+		assert.Empty(t, cache.entries)
+	})
+}
@@ -0,0 +1,87 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// bindingStages are the condition types of the stages of the binding reconciliation in the order they happen.
+var bindingStages = []string{
+	api.SPIAccessTokenBindingConditionTokenMatched,
+	api.SPIAccessTokenBindingConditionTokenDataAvailable,
+	api.SPIAccessTokenBindingConditionSecretRendered,
+	api.SPIAccessTokenBindingConditionSecretSynced,
+}
+
+// bindingErrorStages maps the error reasons of the bindings to the stages failing with them.
+var bindingErrorStages = map[api.SPIAccessTokenBindingErrorReason]string{
+	api.SPIAccessTokenBindingErrorReasonUnknownServiceProviderType: api.SPIAccessTokenBindingConditionTokenMatched,
+	api.SPIAccessTokenBindingErrorReasonUnsupportedPermissions:     api.SPIAccessTokenBindingConditionTokenMatched,
+	api.SPIAccessTokenBindingErrorReasonEphemeralTokenUnsupported:  api.SPIAccessTokenBindingConditionTokenMatched,
+	api.SPIAccessTokenBindingErrorReasonTokenLookup:                api.SPIAccessTokenBindingConditionTokenMatched,
+	api.SPIAccessTokenBindingErrorReasonLinkedToken:                api.SPIAccessTokenBindingConditionTokenMatched,
+	api.SPIAccessTokenBindingErrorReasonTokenPolicy:                api.SPIAccessTokenBindingConditionTokenMatched,
+	api.SPIAccessTokenBindingErrorReasonOAuthNotConfigured:         api.SPIAccessTokenBindingConditionTokenMatched,
+	api.SPIAccessTokenBindingErrorReasonRepoUrlNotAllowed:          api.SPIAccessTokenBindingConditionTokenMatched,
+	api.SPIAccessTokenBindingErrorReasonPolicy:                     api.SPIAccessTokenBindingConditionTokenMatched,
+	api.SPIAccessTokenBindingErrorReasonTokenOwnership:             api.SPIAccessTokenBindingConditionTokenMatched,
+	api.SPIAccessTokenBindingErrorReasonTokenRetrieval:             api.SPIAccessTokenBindingConditionTokenDataAvailable,
+	api.SPIAccessTokenBindingErrorReasonEphemeralTokenMinting:      api.SPIAccessTokenBindingConditionSecretRendered,
+	api.SPIAccessTokenBindingErrorReasonMissingCredential:          api.SPIAccessTokenBindingConditionSecretRendered,
+	api.SPIAccessTokenBindingErrorReasonTokenAnalysis:              api.SPIAccessTokenBindingConditionSecretRendered,
+	api.SPIAccessTokenBindingErrorReasonTokenSync:                  api.SPIAccessTokenBindingConditionSecretSynced,
+	api.SPIAccessTokenBindingErrorReasonWriteBack:                  api.SPIAccessTokenBindingConditionSecretSynced,
+	api.SPIAccessTokenBindingErrorReasonSecretConflict:             api.SPIAccessTokenBindingConditionSecretSynced,
+}
+
+// passBindingStage marks the stage of the binding as passed.
+func passBindingStage(binding *api.SPIAccessTokenBinding, stage string, reason string) {
+	setBindingStage(binding, stage, metav1.ConditionTrue, reason, "")
+}
+
+// failBindingStage marks the stage of the binding as failed (or not passed yet) and the following stages as unknown.
+// The stages preceding the failed one are left as they are.
+func failBindingStage(binding *api.SPIAccessTokenBinding, stage string, reason string, message string) {
+	failed := false
+	for _, s := range bindingStages {
+		if s == stage {
+			failed = true
+			setBindingStage(binding, s, metav1.ConditionFalse, reason, message)
+		} else if failed {
+			setBindingStage(binding, s, metav1.ConditionUnknown, "PreviousStageNotPassed", "waiting for the "+stage+" stage")
+		}
+	}
+}
+
+// failBindingStageWithError marks the stage failing with the provided error reason as failed. The bindings failing
+// with an unknown reason are left untouched.
+func failBindingStageWithError(binding *api.SPIAccessTokenBinding, reason api.SPIAccessTokenBindingErrorReason, message string) {
+	if stage, ok := bindingErrorStages[reason]; ok {
+		failBindingStage(binding, stage, string(reason), message)
+	}
+}
+
+func setBindingStage(binding *api.SPIAccessTokenBinding, stage string, status metav1.ConditionStatus, reason string, message string) {
+	meta.SetStatusCondition(&binding.Status.Conditions, metav1.Condition{
+		Type:               stage,
+		Status:             status,
+		ObservedGeneration: binding.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
@@ -0,0 +1,67 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestBindingStages(t *testing.T) {
+	binding := &api.SPIAccessTokenBinding{}
+
+	status := func(stage string) metav1.ConditionStatus {
+		cond := meta.FindStatusCondition(binding.Status.Conditions, stage)
+		if cond == nil {
+			return ""
+		}
+		return cond.Status
+	}
+
+	passBindingStage(binding, api.SPIAccessTokenBindingConditionTokenMatched, "TokenLinked")
+	passBindingStage(binding, api.SPIAccessTokenBindingConditionTokenDataAvailable, "TokenDataRead")
+	failBindingStageWithError(binding, api.SPIAccessTokenBindingErrorReasonMissingCredential, "no password")
+
+	assert.Equal(t, metav1.ConditionTrue, status(api.SPIAccessTokenBindingConditionTokenMatched))
+	assert.Equal(t, metav1.ConditionTrue, status(api.SPIAccessTokenBindingConditionTokenDataAvailable))
+	assert.Equal(t, metav1.ConditionFalse, status(api.SPIAccessTokenBindingConditionSecretRendered))
+	assert.Equal(t, metav1.ConditionUnknown, status(api.SPIAccessTokenBindingConditionSecretSynced))
+
+	rendered := meta.FindStatusCondition(binding.Status.Conditions, api.SPIAccessTokenBindingConditionSecretRendered)
+	assert.Equal(t, string(api.SPIAccessTokenBindingErrorReasonMissingCredential), rendered.Reason)
+	assert.Equal(t, "no password", rendered.Message)
+
+	// the binding waiting for the token data
+	failBindingStage(binding, api.SPIAccessTokenBindingConditionTokenDataAvailable, "AwaitingTokenData", "")
+	assert.Equal(t, metav1.ConditionTrue, status(api.SPIAccessTokenBindingConditionTokenMatched))
+	assert.Equal(t, metav1.ConditionFalse, status(api.SPIAccessTokenBindingConditionTokenDataAvailable))
+	assert.Equal(t, metav1.ConditionUnknown, status(api.SPIAccessTokenBindingConditionSecretRendered))
+	assert.Equal(t, metav1.ConditionUnknown, status(api.SPIAccessTokenBindingConditionSecretSynced))
+
+	// the unknown reasons don't touch the conditions
+	before := append([]metav1.Condition{}, binding.Status.Conditions...)
+	failBindingStageWithError(binding, "Unknown", "whatever")
+	assert.Equal(t, before, binding.Status.Conditions)
+}
+
+func TestBindingErrorStagesAreKnown(t *testing.T) {
+	for reason, stage := range bindingErrorStages {
+		assert.Contains(t, bindingStages, stage, "unknown stage of %s", reason)
+	}
+}
@@ -0,0 +1,91 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/tokenstorage"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// BindingDataRenderer renders the data of the bindings with the "Pod" delivery on demand for the
+// webhook.PodCredentialsServer, so that the data is never stored in the cluster. The reconciler of the bindings still
+// takes care of linking the token and of checking that the binding may use it. The data is only rendered for
+// the bindings it has injected.
+type BindingDataRenderer struct {
+	Client                 client.Client
+	TokenStorage           tokenstorage.TokenStorage
+	ServiceProviderFactory serviceprovider.Factory
+}
+
+var _ webhook.BindingDataRenderer = (*BindingDataRenderer)(nil)
+
+func (r *BindingDataRenderer) Render(ctx context.Context, namespace string, name string) (map[string]string, error) {
+	binding := &api.SPIAccessTokenBinding{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: name, Namespace: namespace}, binding); err != nil {
+		return nil, fmt.Errorf("failed to read the binding: %w", err)
+	}
+
+	if binding.Spec.Secret.Delivery != api.SecretDeliveryPod {
+		return nil, fmt.Errorf("%w: the binding doesn't deliver its data into the pods", webhook.ErrBindingDataForbidden)
+	}
+
+	if binding.Status.Phase != api.SPIAccessTokenBindingPhaseInjected || binding.Status.LinkedAccessTokenName == "" {
+		return nil, fmt.Errorf("%w: the binding is in the %s phase", webhook.ErrBindingDataUnavailable, binding.Status.Phase)
+	}
+
+	token := &api.SPIAccessToken{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: binding.Status.LinkedAccessTokenName, Namespace: namespace}, token); err != nil {
+		return nil, fmt.Errorf("failed to read the linked token: %w", err)
+	}
+
+	if token.Status.Phase != api.SPIAccessTokenPhaseReady {
+		return nil, fmt.Errorf("%w: the linked token is in the %s phase", webhook.ErrBindingDataUnavailable, token.Status.Phase)
+	}
+
+	if !binding.MayUseToken(token) {
+		return nil, fmt.Errorf("%w: the linked token is owned by another user", webhook.ErrBindingDataForbidden)
+	}
+
+	data, err := r.TokenStorage.Get(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the token data from token storage: %w", err)
+	}
+	if data == nil {
+		return nil, fmt.Errorf("%w: access token data not found", webhook.ErrBindingDataUnavailable)
+	}
+
+	data, err = withCredential(data, binding.Spec.CredentialFlavor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", webhook.ErrBindingDataConflict, err)
+	}
+
+	sp, err := r.ServiceProviderFactory.FromRepoUrlInNamespace(ctx, binding.Spec.RepoUrl, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the service provider: %w", err)
+	}
+
+	stringData, err := renderSecretData(ctx, sp, binding, token, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to analyze the token to produce the mapping to the secret: %w", err)
+	}
+
+	return stringData, nil
+}
@@ -0,0 +1,130 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/webhook"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// mappingServiceProvider only implements the methods used by the BindingDataRenderer.
+type mappingServiceProvider struct {
+	serviceprovider.ServiceProvider
+}
+
+func (p mappingServiceProvider) GetType() api.ServiceProviderType {
+	return api.ServiceProviderTypeGitHub
+}
+
+func (p mappingServiceProvider) MapToken(_ context.Context, _ *api.SPIAccessTokenBinding, token *api.SPIAccessToken, tokenData *api.Token) (serviceprovider.AccessTokenMapper, error) {
+	return serviceprovider.DefaultMapToken(token, tokenData)
+}
+
+func TestBindingDataRenderer_Render(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, api.AddToScheme(sch))
+	assert.NoError(t, corev1.AddToScheme(sch))
+
+	newBinding := func(name string, delivery api.SecretDelivery, phase api.SPIAccessTokenBindingPhase) *api.SPIAccessTokenBinding {
+		return &api.SPIAccessTokenBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns", Annotations: map[string]string{api.BindingCreatorAnnotation: "alice"}},
+			Spec: api.SPIAccessTokenBindingSpec{
+				RepoUrl: "https://acme.com/repo",
+				Secret: api.SecretSpec{
+					Type:     corev1.SecretTypeBasicAuth,
+					Delivery: delivery,
+				},
+			},
+			Status: api.SPIAccessTokenBindingStatus{
+				Phase:                 phase,
+				LinkedAccessTokenName: "token",
+			},
+		}
+	}
+
+	newRenderer := func(owner string, tokenPhase api.SPIAccessTokenPhase) *BindingDataRenderer {
+		token := &api.SPIAccessToken{
+			ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "ns", Annotations: map[string]string{api.TokenOwnerAnnotation: owner}},
+			Status:     api.SPIAccessTokenStatus{Phase: tokenPhase},
+		}
+		cl := fake.NewClientBuilder().WithScheme(sch).WithObjects(token,
+			newBinding("pod", api.SecretDeliveryPod, api.SPIAccessTokenBindingPhaseInjected),
+			newBinding("secret", api.SecretDeliverySecret, api.SPIAccessTokenBindingPhaseInjected),
+			newBinding("waiting", api.SecretDeliveryPod, api.SPIAccessTokenBindingPhaseAwaitingTokenData),
+		).Build()
+
+		return &BindingDataRenderer{
+			Client:       cl,
+			TokenStorage: tombstoneTestStorage(map[string]string{"token": "secret-token"}),
+			ServiceProviderFactory: serviceprovider.Factory{
+				Configuration:    config.NewLiveConfiguration(config.Configuration{ServiceProviders: []config.ServiceProviderConfiguration{{ServiceProviderType: "Acme"}}}),
+				KubernetesClient: cl,
+				Initializers: map[config.ServiceProviderType]serviceprovider.Initializer{
+					"Acme": {
+						Probe: serviceprovider.ProbeFunc(func(_ *http.Client, _ string) (string, error) {
+							return "https://acme.com", nil
+						}),
+						Constructor: serviceprovider.ConstructorFunc(func(_ *serviceprovider.Factory, _ string) (serviceprovider.ServiceProvider, error) {
+							return mappingServiceProvider{}, nil
+						}),
+					},
+				},
+			},
+		}
+	}
+
+	t.Run("renders the data of the injected binding", func(t *testing.T) {
+		data, err := newRenderer("alice", api.SPIAccessTokenPhaseReady).Render(context.TODO(), "ns", "pod")
+		assert.NoError(t, err)
+		assert.Equal(t, "secret-token", data[corev1.BasicAuthPasswordKey])
+	})
+
+	t.Run("refuses the bindings delivered otherwise", func(t *testing.T) {
+		_, err := newRenderer("alice", api.SPIAccessTokenPhaseReady).Render(context.TODO(), "ns", "secret")
+		assert.ErrorIs(t, err, webhook.ErrBindingDataForbidden)
+	})
+
+	t.Run("waits for the binding to be injected", func(t *testing.T) {
+		_, err := newRenderer("alice", api.SPIAccessTokenPhaseReady).Render(context.TODO(), "ns", "waiting")
+		assert.ErrorIs(t, err, webhook.ErrBindingDataUnavailable)
+	})
+
+	t.Run("waits for the token to be ready", func(t *testing.T) {
+		_, err := newRenderer("alice", api.SPIAccessTokenPhaseAwaitingTokenData).Render(context.TODO(), "ns", "pod")
+		assert.ErrorIs(t, err, webhook.ErrBindingDataUnavailable)
+	})
+
+	t.Run("refuses the token of another user", func(t *testing.T) {
+		_, err := newRenderer("bob", api.SPIAccessTokenPhaseReady).Render(context.TODO(), "ns", "pod")
+		assert.ErrorIs(t, err, webhook.ErrBindingDataForbidden)
+	})
+
+	t.Run("missing binding is an error", func(t *testing.T) {
+		_, err := newRenderer("alice", api.SPIAccessTokenPhaseReady).Render(context.TODO(), "ns", "missing")
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, webhook.ErrBindingDataUnavailable)
+	})
+}
@@ -0,0 +1,54 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// bindingExpiresIn returns how long the binding has left until it expires according to its
+// api.BindingExpiresAtAnnotation. The returned duration is not positive for the expired bindings. The bindings without
+// the annotation or with an invalid value never expire.
+func bindingExpiresIn(ctx context.Context, binding *api.SPIAccessTokenBinding, now time.Time) (time.Duration, bool) {
+	value, ok := binding.Annotations[api.BindingExpiresAtAnnotation]
+	if !ok {
+		return 0, false
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		log.FromContext(ctx).Info("ignoring the invalid expiration time of the binding", "annotation", api.BindingExpiresAtAnnotation, "value", value)
+		return 0, false
+	}
+
+	return expiresAt.Sub(now), true
+}
+
+// deleteExpiredBinding deletes the binding whose expiration time has passed. The secret of the binding is deleted
+// with it by the garbage collector.
+func deleteExpiredBinding(ctx context.Context, cl client.Client, binding *api.SPIAccessTokenBinding) error {
+	log.FromContext(ctx).Info("deleting the expired binding", "expiresAt", binding.Annotations[api.BindingExpiresAtAnnotation])
+	if err := cl.Delete(ctx, binding); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete the expired binding: %w", err)
+	}
+	return nil
+}
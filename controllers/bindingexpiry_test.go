@@ -0,0 +1,68 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func expiringTestBinding(expiresAt string) *api.SPIAccessTokenBinding {
+	binding := &api.SPIAccessTokenBinding{ObjectMeta: metav1.ObjectMeta{Name: "binding", Namespace: "ns"}}
+	if expiresAt != "" {
+		binding.Annotations = map[string]string{api.BindingExpiresAtAnnotation: expiresAt}
+	}
+	return binding
+}
+
+func TestBindingExpiresIn(t *testing.T) {
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	expiresIn, ok := bindingExpiresIn(context.TODO(), expiringTestBinding("2023-01-01T12:10:00Z"), now)
+	assert.True(t, ok)
+	assert.Equal(t, 10*time.Minute, expiresIn)
+
+	expiresIn, ok = bindingExpiresIn(context.TODO(), expiringTestBinding("2023-01-01T11:00:00Z"), now)
+	assert.True(t, ok)
+	assert.Equal(t, -time.Hour, expiresIn)
+
+	_, ok = bindingExpiresIn(context.TODO(), expiringTestBinding("tomorrow"), now)
+	assert.False(t, ok)
+
+	_, ok = bindingExpiresIn(context.TODO(), expiringTestBinding(""), now)
+	assert.False(t, ok)
+}
+
+func TestDeleteExpiredBinding(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, api.AddToScheme(sch))
+	binding := expiringTestBinding("2023-01-01T11:00:00Z")
+	cl := fake.NewClientBuilder().WithScheme(sch).WithObjects(binding).Build()
+
+	assert.NoError(t, deleteExpiredBinding(context.TODO(), cl, binding))
+	assert.True(t, errors.IsNotFound(cl.Get(context.TODO(), client.ObjectKeyFromObject(binding), &api.SPIAccessTokenBinding{})))
+
+	// deleting the binding that is already gone is fine
+	assert.NoError(t, deleteExpiredBinding(context.TODO(), cl, binding))
+}
@@ -0,0 +1,82 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// bindingLeaseExpiresIn returns how long the lease of the binding has left. The expiration time recorded in the status
+// is moved if the lease was renewed in the spec since. The returned duration is not positive for the expired leases.
+// The bindings without a lease and the bindings whose lease didn't start yet, because their secret was never synced,
+// report false.
+func bindingLeaseExpiresIn(binding *api.SPIAccessTokenBinding, now time.Time) (time.Duration, bool) {
+	lease := binding.Spec.Lease
+	if lease == nil || binding.Status.LeaseExpirationTime == nil {
+		return 0, false
+	}
+
+	if lease.RenewTime != nil && !lease.RenewTime.After(now) {
+		renewedExpiration := lease.RenewTime.Add(lease.Duration.Duration)
+		if renewedExpiration.After(binding.Status.LeaseExpirationTime.Time) {
+			binding.Status.LeaseExpirationTime = &metav1.Time{Time: renewedExpiration}
+		}
+	}
+
+	return binding.Status.LeaseExpirationTime.Sub(now), true
+}
+
+// startBindingLease records the expiration time of the lease of the binding whose secret was just synced, unless
+// the lease already started. The expiration time is forgotten if the lease was removed from the spec.
+func startBindingLease(binding *api.SPIAccessTokenBinding, now time.Time) {
+	if binding.Spec.Lease == nil {
+		binding.Status.LeaseExpirationTime = nil
+		return
+	}
+
+	if binding.Status.LeaseExpirationTime == nil {
+		binding.Status.LeaseExpirationTime = &metav1.Time{Time: now.Add(binding.Spec.Lease.Duration.Duration)}
+	}
+}
+
+// expireBindingLease deletes the data the binding has synced because its lease expired and records that in the status
+// of the binding.
+func (r *SPIAccessTokenBindingReconciler) expireBindingLease(ctx context.Context, binding *api.SPIAccessTokenBinding) error {
+	if binding.Status.Phase == api.SPIAccessTokenBindingPhaseLeaseExpired {
+		return nil
+	}
+
+	log.FromContext(ctx).Info("the lease of the binding expired, deleting the synced data", "expiredAt", binding.Status.LeaseExpirationTime)
+
+	if err := r.deleteSyncedObject(ctx, binding.Status.SyncedObjectRef, binding.Namespace); err != nil {
+		return fmt.Errorf("failed to delete the synced object: %w", err)
+	}
+	if err := r.deleteWriteBack(ctx, binding); err != nil {
+		return err
+	}
+
+	binding.Status.Phase = api.SPIAccessTokenBindingPhaseLeaseExpired
+	binding.Status.SyncedObjectRef = api.TargetObjectRef{}
+	failBindingStage(binding, api.SPIAccessTokenBindingConditionSecretSynced, string(api.SPIAccessTokenBindingPhaseLeaseExpired),
+		fmt.Sprintf("the lease expired at %s", binding.Status.LeaseExpirationTime.Format(time.RFC3339)))
+
+	return r.updateBindingStatusSuccess(ctx, binding)
+}
@@ -0,0 +1,151 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/statusupdate"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func leasedTestBinding(duration time.Duration, renewTime *time.Time, expiration *time.Time) *api.SPIAccessTokenBinding {
+	binding := &api.SPIAccessTokenBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "binding", Namespace: "ns"},
+		Spec: api.SPIAccessTokenBindingSpec{
+			Lease: &api.BindingLease{Duration: metav1.Duration{Duration: duration}},
+		},
+	}
+	if renewTime != nil {
+		binding.Spec.Lease.RenewTime = &metav1.Time{Time: *renewTime}
+	}
+	if expiration != nil {
+		binding.Status.LeaseExpirationTime = &metav1.Time{Time: *expiration}
+	}
+	return binding
+}
+
+func TestBindingLeaseExpiresIn(t *testing.T) {
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+
+	t.Run("no lease", func(t *testing.T) {
+		_, ok := bindingLeaseExpiresIn(&api.SPIAccessTokenBinding{}, now)
+		assert.False(t, ok)
+	})
+
+	t.Run("not started", func(t *testing.T) {
+		_, ok := bindingLeaseExpiresIn(leasedTestBinding(time.Hour, nil, nil), now)
+		assert.False(t, ok)
+	})
+
+	t.Run("running", func(t *testing.T) {
+		expiresIn, ok := bindingLeaseExpiresIn(leasedTestBinding(time.Hour, nil, at(10*time.Minute)), now)
+		assert.True(t, ok)
+		assert.Equal(t, 10*time.Minute, expiresIn)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		expiresIn, ok := bindingLeaseExpiresIn(leasedTestBinding(time.Hour, nil, at(-time.Minute)), now)
+		assert.True(t, ok)
+		assert.Equal(t, -time.Minute, expiresIn)
+	})
+
+	t.Run("renewed", func(t *testing.T) {
+		binding := leasedTestBinding(time.Hour, at(-time.Minute), at(-time.Minute))
+		expiresIn, ok := bindingLeaseExpiresIn(binding, now)
+		assert.True(t, ok)
+		assert.Equal(t, 59*time.Minute, expiresIn)
+		assert.Equal(t, *at(59 * time.Minute), binding.Status.LeaseExpirationTime.Time)
+	})
+
+	t.Run("renewal older than the expiration", func(t *testing.T) {
+		binding := leasedTestBinding(time.Hour, at(-2*time.Hour), at(10*time.Minute))
+		expiresIn, ok := bindingLeaseExpiresIn(binding, now)
+		assert.True(t, ok)
+		assert.Equal(t, 10*time.Minute, expiresIn)
+	})
+
+	t.Run("renewal in the future ignored", func(t *testing.T) {
+		binding := leasedTestBinding(time.Hour, at(24*time.Hour), at(-time.Minute))
+		expiresIn, ok := bindingLeaseExpiresIn(binding, now)
+		assert.True(t, ok)
+		assert.Equal(t, -time.Minute, expiresIn)
+	})
+}
+
+func TestStartBindingLease(t *testing.T) {
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	binding := leasedTestBinding(time.Hour, nil, nil)
+	startBindingLease(binding, now)
+	assert.Equal(t, now.Add(time.Hour), binding.Status.LeaseExpirationTime.Time)
+
+	// the lease that already started is not extended by the later syncs
+	startBindingLease(binding, now.Add(time.Minute))
+	assert.Equal(t, now.Add(time.Hour), binding.Status.LeaseExpirationTime.Time)
+
+	binding.Spec.Lease = nil
+	startBindingLease(binding, now)
+	assert.Nil(t, binding.Status.LeaseExpirationTime)
+}
+
+func TestExpireBindingLease(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, corev1.AddToScheme(sch))
+	assert.NoError(t, api.AddToScheme(sch))
+
+	expiration := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "ns"}}
+	binding := leasedTestBinding(time.Hour, nil, &expiration)
+	binding.Status.Phase = api.SPIAccessTokenBindingPhaseInjected
+	binding.Status.SyncedObjectRef = api.TargetObjectRef{Name: "secret", Kind: "Secret", ApiVersion: "v1"}
+	cl := statusupdate.FakeApplyClient{Client: fake.NewClientBuilder().WithScheme(sch).WithObjects(secret, binding).Build()}
+	assert.NoError(t, cl.Get(context.TODO(), client.ObjectKeyFromObject(binding), binding))
+
+	r := &SPIAccessTokenBindingReconciler{
+		Client: cl,
+		ServiceProviderFactory: serviceprovider.Factory{
+			Configuration: config.NewLiveConfiguration(config.Configuration{}),
+		},
+	}
+	assert.NoError(t, r.expireBindingLease(context.TODO(), binding))
+
+	current := &api.SPIAccessTokenBinding{}
+	assert.NoError(t, cl.Get(context.TODO(), client.ObjectKeyFromObject(binding), current))
+	assert.Equal(t, api.SPIAccessTokenBindingPhaseLeaseExpired, current.Status.Phase)
+	assert.Empty(t, current.Status.SyncedObjectRef.Name)
+	assert.Equal(t, expiration, current.Status.LeaseExpirationTime.UTC())
+
+	err := cl.Get(context.TODO(), client.ObjectKeyFromObject(secret), &corev1.Secret{})
+	assert.True(t, errors.IsNotFound(err))
+
+	// expiring the expired lease again is a no-op
+	assert.NoError(t, r.expireBindingLease(context.TODO(), current))
+}
@@ -0,0 +1,105 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// bindingPolicyRecheckInterval is the interval in which the bindings denied by the binding policy are checked again,
+// because the decisions of the policy can change without any change of the bindings.
+const bindingPolicyRecheckInterval = 5 * time.Minute
+
+// BindingPolicyReview is the request sent to the binding policy webhook. The webhook decides whether the binding may
+// use the data of the token.
+type BindingPolicyReview struct {
+	Binding   *api.SPIAccessTokenBinding `json:"binding"`
+	Token     *api.SPIAccessToken        `json:"token"`
+	Namespace *corev1.Namespace          `json:"namespace"`
+}
+
+// BindingPolicyDecision is the response of the binding policy webhook.
+type BindingPolicyDecision struct {
+	Allowed bool `json:"allowed"`
+	// Reason explains the decision. It is recorded in the status of the denied bindings.
+	Reason string `json:"reason,omitempty"`
+}
+
+// checkBindingPolicy consults the binding policy webhook, if configured, whether the binding may use the token.
+// The bindings are allowed to use their tokens if there is no policy webhook configured.
+func (r *SPIAccessTokenBindingReconciler) checkBindingPolicy(ctx context.Context, binding *api.SPIAccessTokenBinding, token *api.SPIAccessToken) (*BindingPolicyDecision, error) {
+	url := r.ServiceProviderFactory.Configuration.Get().BindingPolicyWebhookUrl
+	if url == "" {
+		return &BindingPolicyDecision{Allowed: true}, nil
+	}
+
+	namespace := &corev1.Namespace{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: binding.Namespace}, namespace); err != nil {
+		return nil, fmt.Errorf("failed to read the namespace of the binding: %w", err)
+	}
+
+	return reviewBindingPolicy(ctx, r.ServiceProviderFactory.HttpClient, url, &BindingPolicyReview{
+		Binding:   binding,
+		Token:     token,
+		Namespace: namespace,
+	})
+}
+
+// reviewBindingPolicy posts the review to the binding policy webhook at the provided URL and returns its decision.
+func reviewBindingPolicy(ctx context.Context, cl *http.Client, url string, review *BindingPolicyReview) (*BindingPolicyDecision, error) {
+	lg := log.FromContext(ctx)
+
+	body, err := json.Marshal(review)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize the binding policy review: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the binding policy review request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := cl.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call the binding policy webhook: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			lg.Error(err, "failed to close the response body of the binding policy webhook")
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the binding policy webhook responded with unexpected status code %d", resp.StatusCode)
+	}
+
+	decision := &BindingPolicyDecision{}
+	if err := json.NewDecoder(resp.Body).Decode(decision); err != nil {
+		return nil, fmt.Errorf("failed to parse the response of the binding policy webhook: %w", err)
+	}
+
+	return decision, nil
+}
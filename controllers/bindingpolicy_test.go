@@ -0,0 +1,149 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/statusupdate"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCheckBindingPolicy(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, corev1.AddToScheme(sch))
+	assert.NoError(t, api.AddToScheme(sch))
+
+	// the policy only allows the tokens of alois in the namespaces of team alois
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		review := BindingPolicyReview{}
+		if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		decision := BindingPolicyDecision{Allowed: true}
+		if review.Namespace.Labels["team"] != review.Token.Status.TokenMetadata.Username {
+			decision = BindingPolicyDecision{Allowed: false, Reason: "the token belongs to another team"}
+		}
+		assert.NoError(t, json.NewEncoder(w).Encode(decision))
+	}))
+	defer server.Close()
+
+	token := &api.SPIAccessToken{
+		ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "alois-ns"},
+		Status:     api.SPIAccessTokenStatus{TokenMetadata: &api.TokenMetadata{Username: "alois"}},
+	}
+
+	reconciler := func(url string) *SPIAccessTokenBindingReconciler {
+		cl := fake.NewClientBuilder().WithScheme(sch).WithObjects(
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "alois-ns", Labels: map[string]string{"team": "alois"}}},
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "other-ns", Labels: map[string]string{"team": "other"}}},
+		).Build()
+		return &SPIAccessTokenBindingReconciler{
+			Client: cl,
+			ServiceProviderFactory: serviceprovider.Factory{
+				Configuration: config.NewLiveConfiguration(config.Configuration{BindingPolicyWebhookUrl: url}),
+				HttpClient:    server.Client(),
+			},
+		}
+	}
+
+	binding := func(namespace string) *api.SPIAccessTokenBinding {
+		return &api.SPIAccessTokenBinding{ObjectMeta: metav1.ObjectMeta{Name: "binding", Namespace: namespace}}
+	}
+
+	t.Run("allowed without policy", func(t *testing.T) {
+		decision, err := reconciler("").checkBindingPolicy(context.TODO(), binding("other-ns"), token)
+		assert.NoError(t, err)
+		assert.True(t, decision.Allowed)
+	})
+
+	t.Run("allowed by policy", func(t *testing.T) {
+		decision, err := reconciler(server.URL).checkBindingPolicy(context.TODO(), binding("alois-ns"), token)
+		assert.NoError(t, err)
+		assert.True(t, decision.Allowed)
+	})
+
+	t.Run("denied by policy", func(t *testing.T) {
+		decision, err := reconciler(server.URL).checkBindingPolicy(context.TODO(), binding("other-ns"), token)
+		assert.NoError(t, err)
+		assert.False(t, decision.Allowed)
+		assert.Equal(t, "the token belongs to another team", decision.Reason)
+	})
+
+	t.Run("fails with unknown namespace", func(t *testing.T) {
+		_, err := reconciler(server.URL).checkBindingPolicy(context.TODO(), binding("unknown-ns"), token)
+		assert.Error(t, err)
+	})
+
+	t.Run("fails with failing webhook", func(t *testing.T) {
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer failing.Close()
+
+		_, err := reconciler(failing.URL).checkBindingPolicy(context.TODO(), binding("alois-ns"), token)
+		assert.Error(t, err)
+	})
+}
+
+func TestDenyTokenUse(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, corev1.AddToScheme(sch))
+	assert.NoError(t, api.AddToScheme(sch))
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "ns"}}
+	binding := &api.SPIAccessTokenBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "binding", Namespace: "ns"},
+		Status: api.SPIAccessTokenBindingStatus{
+			Phase:           api.SPIAccessTokenBindingPhaseInjected,
+			SyncedObjectRef: api.TargetObjectRef{Name: "secret", Kind: "Secret", ApiVersion: "v1"},
+		},
+	}
+	cl := statusupdate.FakeApplyClient{Client: fake.NewClientBuilder().WithScheme(sch).WithObjects(secret, binding).Build()}
+	assert.NoError(t, cl.Get(context.TODO(), client.ObjectKeyFromObject(binding), binding))
+
+	r := &SPIAccessTokenBindingReconciler{
+		Client: cl,
+		ServiceProviderFactory: serviceprovider.Factory{
+			Configuration: config.NewLiveConfiguration(config.Configuration{}),
+		},
+	}
+	r.denyTokenUse(context.TODO(), binding, api.SPIAccessTokenBindingErrorReasonPolicy, fmt.Errorf("nope"))
+
+	current := &api.SPIAccessTokenBinding{}
+	assert.NoError(t, cl.Get(context.TODO(), client.ObjectKeyFromObject(binding), current))
+	assert.Equal(t, api.SPIAccessTokenBindingPhaseError, current.Status.Phase)
+	assert.Equal(t, api.SPIAccessTokenBindingErrorReasonPolicy, current.Status.ErrorReason)
+	assert.Contains(t, current.Status.ErrorMessage, "nope")
+	assert.Empty(t, current.Status.SyncedObjectRef.Name)
+
+	err := cl.Get(context.TODO(), client.ObjectKeyFromObject(secret), &corev1.Secret{})
+	assert.True(t, errors.IsNotFound(err))
+}
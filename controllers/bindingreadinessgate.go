@@ -0,0 +1,172 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/webhook"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	bindingsReadyReason    = "BindingsInjected"
+	bindingsNotReadyReason = "BindingsNotInjected"
+)
+
+// BindingReadinessGateReconciler maintains the api.BindingsReadyPodCondition of the pods with the readiness gate
+// added by the webhook.BindingReadinessGateInjector. The condition is true once all the bindings the pod waits for
+// are injected. It goes back to false if any of them stops being injected, e.g. because the token data was lost, so
+// that the traffic is not routed to the pods that lost the credentials.
+type BindingReadinessGateReconciler struct {
+	client.Client
+}
+
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=pods/status,verbs=patch
+//+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spiaccesstokenbindings,verbs=get;list;watch
+
+// SetupWithManager sets up the controller with the Manager. The cache of the manager is expected to only contain
+// the pods with the api.BindingReadinessGateLabel.
+func (r *BindingReadinessGateReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("bindingreadinessgate").
+		For(&corev1.Pod{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(o client.Object) bool {
+			return o.GetLabels()[api.BindingReadinessGateLabel] == "true"
+		}))).
+		Watches(&source.Kind{Type: &api.SPIAccessTokenBinding{}}, handler.EnqueueRequestsFromMapFunc(r.waitingPods)).
+		Complete(monitored(mgr, "BindingReadinessGate", &corev1.Pod{}, r))
+}
+
+func (r *BindingReadinessGateReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	lg := log.FromContext(ctx)
+
+	pod := &corev1.Pod{}
+	if err := r.Get(ctx, req.NamespacedName, pod); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, NewReconcileError(err, "failed to read the pod")
+	}
+	if pod.DeletionTimestamp != nil {
+		return ctrl.Result{}, nil
+	}
+
+	notInjected, err := r.notInjectedBindings(ctx, pod)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	condition := corev1.PodCondition{
+		Type:   api.BindingsReadyPodCondition,
+		Status: corev1.ConditionTrue,
+		Reason: bindingsReadyReason,
+	}
+	if len(notInjected) > 0 {
+		condition.Status = corev1.ConditionFalse
+		condition.Reason = bindingsNotReadyReason
+		condition.Message = fmt.Sprintf("waiting for the bindings to be injected: %s", strings.Join(notInjected, ", "))
+	}
+
+	patch := client.StrategicMergeFrom(pod.DeepCopy())
+	if !setPodCondition(pod, condition) {
+		return ctrl.Result{}, nil
+	}
+
+	if err := r.Status().Patch(ctx, pod, patch); err != nil {
+		return ctrl.Result{}, NewReconcileError(err, "failed to update the readiness condition of the pod")
+	}
+	lg.Info("updated the bindings readiness condition of the pod", "status", condition.Status, "notInjected", notInjected)
+
+	return ctrl.Result{}, nil
+}
+
+// notInjectedBindings returns the names of the bindings the pod waits for that are not injected (or don't exist).
+func (r *BindingReadinessGateReconciler) notInjectedBindings(ctx context.Context, pod *corev1.Pod) ([]string, error) {
+	notInjected := []string{}
+	for _, name := range webhook.WaitedBindings(pod) {
+		binding := &api.SPIAccessTokenBinding{}
+		if err := r.Get(ctx, client.ObjectKey{Name: name, Namespace: pod.Namespace}, binding); err != nil {
+			if errors.IsNotFound(err) {
+				notInjected = append(notInjected, name)
+				continue
+			}
+			return nil, NewReconcileError(err, "failed to read the binding the pod waits for")
+		}
+		if binding.DeletionTimestamp != nil || binding.Status.Phase != api.SPIAccessTokenBindingPhaseInjected {
+			notInjected = append(notInjected, name)
+		}
+	}
+	return notInjected, nil
+}
+
+// waitingPods maps the binding to the requests of the pods waiting for it.
+func (r *BindingReadinessGateReconciler) waitingPods(o client.Object) []reconcile.Request {
+	pods := &corev1.PodList{}
+	if err := r.List(context.TODO(), pods, client.InNamespace(o.GetNamespace()), client.MatchingLabels{api.BindingReadinessGateLabel: "true"}); err != nil {
+		log.Log.Error(err, "failed to list the pods waiting for the binding", "binding", client.ObjectKeyFromObject(o))
+		return []reconcile.Request{}
+	}
+
+	ret := []reconcile.Request{}
+	for i := range pods.Items {
+		for _, name := range webhook.WaitedBindings(&pods.Items[i]) {
+			if name == o.GetName() {
+				ret = append(ret, reconcile.Request{NamespacedName: types.NamespacedName{Name: pods.Items[i].Name, Namespace: pods.Items[i].Namespace}})
+				break
+			}
+		}
+	}
+	return ret
+}
+
+// setPodCondition sets the condition in the status of the pod. The transition time only changes with the status.
+// Returns true if the condition changed.
+func setPodCondition(pod *corev1.Pod, condition corev1.PodCondition) bool {
+	for i := range pod.Status.Conditions {
+		existing := &pod.Status.Conditions[i]
+		if existing.Type != condition.Type {
+			continue
+		}
+		if existing.Status == condition.Status && existing.Reason == condition.Reason && existing.Message == condition.Message {
+			return false
+		}
+		if existing.Status == condition.Status {
+			condition.LastTransitionTime = existing.LastTransitionTime
+		} else {
+			condition.LastTransitionTime = metav1.Now()
+		}
+		*existing = condition
+		return true
+	}
+
+	condition.LastTransitionTime = metav1.Now()
+	pod.Status.Conditions = append(pod.Status.Conditions, condition)
+	return true
+}
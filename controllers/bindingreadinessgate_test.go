@@ -0,0 +1,106 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func readinessGateTestPod(name string, waitFor string) *corev1.Pod {
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:        name,
+		Namespace:   "ns",
+		Labels:      map[string]string{api.BindingReadinessGateLabel: "true"},
+		Annotations: map[string]string{api.WaitForBindingsAnnotation: waitFor},
+	}}
+}
+
+func readinessGateTestBinding(name string, phase api.SPIAccessTokenBindingPhase) *api.SPIAccessTokenBinding {
+	return &api.SPIAccessTokenBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns"},
+		Status:     api.SPIAccessTokenBindingStatus{Phase: phase},
+	}
+}
+
+func TestBindingReadinessGateReconciler(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, corev1.AddToScheme(sch))
+	assert.NoError(t, api.AddToScheme(sch))
+
+	cl := fake.NewClientBuilder().WithScheme(sch).WithObjects(
+		readinessGateTestBinding("git", api.SPIAccessTokenBindingPhaseInjected),
+		readinessGateTestBinding("registry", api.SPIAccessTokenBindingPhaseAwaitingTokenData),
+		readinessGateTestPod("ready", "git"),
+		readinessGateTestPod("waiting", "git,registry,missing"),
+	).Build()
+
+	r := &BindingReadinessGateReconciler{Client: cl}
+
+	condition := func(name string) *corev1.PodCondition {
+		_, err := r.Reconcile(context.TODO(), reconcile.Request{NamespacedName: client.ObjectKey{Name: name, Namespace: "ns"}})
+		assert.NoError(t, err)
+
+		pod := &corev1.Pod{}
+		assert.NoError(t, cl.Get(context.TODO(), client.ObjectKey{Name: name, Namespace: "ns"}, pod))
+		for i := range pod.Status.Conditions {
+			if pod.Status.Conditions[i].Type == api.BindingsReadyPodCondition {
+				return &pod.Status.Conditions[i]
+			}
+		}
+		return nil
+	}
+
+	ready := condition("ready")
+	assert.NotNil(t, ready)
+	assert.Equal(t, corev1.ConditionTrue, ready.Status)
+
+	waiting := condition("waiting")
+	assert.NotNil(t, waiting)
+	assert.Equal(t, corev1.ConditionFalse, waiting.Status)
+	assert.Equal(t, "waiting for the bindings to be injected: registry, missing", waiting.Message)
+
+	t.Run("maps the bindings to the waiting pods", func(t *testing.T) {
+		assert.ElementsMatch(t, []reconcile.Request{
+			{NamespacedName: client.ObjectKey{Name: "ready", Namespace: "ns"}},
+			{NamespacedName: client.ObjectKey{Name: "waiting", Namespace: "ns"}},
+		}, r.waitingPods(readinessGateTestBinding("git", api.SPIAccessTokenBindingPhaseInjected)))
+		assert.Equal(t, []reconcile.Request{{NamespacedName: client.ObjectKey{Name: "waiting", Namespace: "ns"}}},
+			r.waitingPods(readinessGateTestBinding("missing", "")))
+	})
+}
+
+func TestSetPodCondition(t *testing.T) {
+	pod := &corev1.Pod{}
+	cond := corev1.PodCondition{Type: api.BindingsReadyPodCondition, Status: corev1.ConditionFalse, Reason: "a"}
+
+	assert.True(t, setPodCondition(pod, cond))
+	assert.False(t, setPodCondition(pod, cond))
+	transition := pod.Status.Conditions[0].LastTransitionTime
+
+	cond.Message = "changed"
+	assert.True(t, setPodCondition(pod, cond))
+	assert.Equal(t, transition, pod.Status.Conditions[0].LastTransitionTime)
+	assert.Len(t, pod.Status.Conditions, 1)
+}
@@ -0,0 +1,61 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/cloudevents"
+)
+
+// emitTokenEvent emits the event of the provided type about the token if the emitter is configured.
+func emitTokenEvent(ctx context.Context, emitter cloudevents.Emitter, eventType string, token *api.SPIAccessToken) {
+	if emitter == nil {
+		return
+	}
+
+	emitter.Emit(ctx, cloudevents.Event{
+		Type: eventType,
+		Data: cloudevents.ObjectData{
+			Kind:               "SPIAccessToken",
+			Namespace:          token.Namespace,
+			Name:               token.Name,
+			UID:                token.UID,
+			Phase:              string(token.Status.Phase),
+			ServiceProviderUrl: token.Spec.ServiceProviderUrl,
+			Message:            token.Status.ErrorMessage,
+		},
+	})
+}
+
+// emitBindingEvent emits the event of the provided type about the binding if the emitter is configured.
+func emitBindingEvent(ctx context.Context, emitter cloudevents.Emitter, eventType string, binding *api.SPIAccessTokenBinding) {
+	if emitter == nil {
+		return
+	}
+
+	emitter.Emit(ctx, cloudevents.Event{
+		Type: eventType,
+		Data: cloudevents.ObjectData{
+			Kind:       "SPIAccessTokenBinding",
+			Namespace:  binding.Namespace,
+			Name:       binding.Name,
+			UID:        binding.UID,
+			Phase:      string(binding.Status.Phase),
+			SecretName: binding.Status.SyncedObjectRef.Name,
+		},
+	})
+}
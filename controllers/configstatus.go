@@ -0,0 +1,100 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// ConfigurationStatusReporter writes the result of the last validation of the configuration into the config map
+// configured using configurationStatusConfigMap so that the problems with the configuration can be found without
+// access to the logs or metrics. Nothing is written if the config map is not configured.
+type ConfigurationStatusReporter struct {
+	Client        client.Client
+	Configuration *config.LiveConfiguration
+
+	lock     sync.Mutex
+	err      error
+	time     time.Time
+	reported chan struct{}
+}
+
+// Report records the result of the validation of the configuration to be written into the config map. It can be used
+// as the OnReload function of the configuration file watcher.
+func (r *ConfigurationStatusReporter) Report(err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.err = err
+	r.time = time.Now()
+
+	if r.reported == nil {
+		r.reported = make(chan struct{}, 1)
+	}
+	select {
+	case r.reported <- struct{}{}:
+	default:
+		// the config map is going to be written anyway
+	}
+}
+
+// Start writes the config map each time a new result is reported until the provided context is done.
+func (r *ConfigurationStatusReporter) Start(ctx context.Context) error {
+	lg := log.FromContext(ctx)
+
+	r.lock.Lock()
+	if r.reported == nil {
+		r.reported = make(chan struct{}, 1)
+	}
+	reported := r.reported
+	r.lock.Unlock()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-reported:
+			if err := r.report(ctx); err != nil {
+				lg.Error(err, "failed to update the configuration status config map")
+			}
+		}
+	}
+}
+
+func (r *ConfigurationStatusReporter) report(ctx context.Context) error {
+	cmRef := r.Configuration.Get().ConfigurationStatusConfigMap
+	if cmRef == "" {
+		return nil
+	}
+
+	r.lock.Lock()
+	data := map[string]string{
+		"valid": strconv.FormatBool(r.err == nil),
+		"time":  r.time.UTC().Format(time.RFC3339),
+	}
+	if r.err != nil {
+		data["errors"] = r.err.Error()
+	}
+	r.lock.Unlock()
+
+	return writeStatusConfigMap(ctx, r.Client, cmRef, data)
+}
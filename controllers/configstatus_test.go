@@ -0,0 +1,58 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestConfigurationStatusReporter_Report(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, corev1.AddToScheme(sch))
+
+	cl := fake.NewClientBuilder().WithScheme(sch).Build()
+	r := &ConfigurationStatusReporter{
+		Client:        cl,
+		Configuration: config.NewLiveConfiguration(config.Configuration{ConfigurationStatusConfigMap: "spi-system/spi-config-status"}),
+	}
+
+	getStatus := func() map[string]string {
+		cm := &corev1.ConfigMap{}
+		assert.NoError(t, cl.Get(context.TODO(), client.ObjectKey{Name: "spi-config-status", Namespace: "spi-system"}, cm))
+		return cm.Data
+	}
+
+	r.Report(errors.New("clientId is required"))
+	assert.NoError(t, r.report(context.TODO()))
+	status := getStatus()
+	assert.Equal(t, "false", status["valid"])
+	assert.Equal(t, "clientId is required", status["errors"])
+	assert.NotEmpty(t, status["time"])
+
+	r.Report(nil)
+	assert.NoError(t, r.report(context.TODO()))
+	status = getStatus()
+	assert.Equal(t, "true", status["valid"])
+	assert.NotContains(t, status, "errors")
+}
@@ -0,0 +1,83 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// EgressReporter periodically writes the network endpoints the operator needs to reach into the config map configured
+// using egressReportConfigMap. The NetworkPolicies cannot restrict the egress by the host names, so the report is
+// meant as the input for the egress firewalls or the policies of the CNI plugins supporting the host names. Only
+// the service providers in the configuration file are taken into account, not their overrides in the namespaces.
+// Nothing is written if the config map is not configured.
+type EgressReporter struct {
+	Client        client.Client
+	Configuration *config.LiveConfiguration
+	Initializers  map[config.ServiceProviderType]serviceprovider.Initializer
+	// Interval is the interval in which the config map is updated.
+	Interval time.Duration
+}
+
+// Start updates the egress report until the provided context is done.
+func (r *EgressReporter) Start(ctx context.Context) error {
+	lg := log.FromContext(ctx)
+
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := r.report(ctx); err != nil {
+				lg.Error(err, "failed to update the egress report config map")
+			}
+		}
+	}
+}
+
+func (r *EgressReporter) report(ctx context.Context) error {
+	cfg := r.Configuration.Get()
+	if cfg.EgressReportConfigMap == "" {
+		return nil
+	}
+
+	data := map[string]string{
+		"serviceProviders": strings.Join(serviceprovider.EgressEndpoints(cfg, r.Initializers), "\n"),
+	}
+
+	// the key is named after the original use of Vault, but it is reported for all of them
+	if usesVault(&cfg) {
+		data["tokenStorage"] = serviceprovider.UrlEndpoint(cfg.VaultHost)
+	}
+
+	return writeStatusConfigMap(ctx, r.Client, cfg.EgressReportConfigMap, data)
+}
+
+// usesVault tells whether the operator talks to Vault with the provided configuration, i.e. whether Vault stores
+// the token data (also as the source of the migration), the written back binding data or the OAuth state signing key.
+func usesVault(cfg *config.Configuration) bool {
+	return cfg.TokenStorage == config.TokenStorageTypeVault || cfg.TokenStorageMigrationSource == config.TokenStorageTypeVault ||
+		cfg.BindingWriteBackVaultMount != "" || cfg.OAuthStateVaultTransitKey != ""
+}
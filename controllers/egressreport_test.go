@@ -0,0 +1,66 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestEgressReporter_Report(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, corev1.AddToScheme(sch))
+
+	cl := fake.NewClientBuilder().WithScheme(sch).Build()
+	r := &EgressReporter{
+		Client: cl,
+		Configuration: config.NewLiveConfiguration(config.Configuration{
+			ServiceProviders: []config.ServiceProviderConfiguration{
+				{ServiceProviderType: config.ServiceProviderTypeGitHub},
+			},
+			TokenStorage:          config.TokenStorageTypeVault,
+			VaultHost:             "http://spi-vault:8200",
+			EgressReportConfigMap: "spi-system/spi-egress",
+		}),
+		Initializers: map[config.ServiceProviderType]serviceprovider.Initializer{
+			config.ServiceProviderTypeGitHub: {EgressEndpoints: []string{"github.com:443", "api.github.com:443"}},
+		},
+		Interval: time.Minute,
+	}
+
+	assert.NoError(t, r.report(context.TODO()))
+
+	cm := &corev1.ConfigMap{}
+	assert.NoError(t, cl.Get(context.TODO(), client.ObjectKey{Name: "spi-egress", Namespace: "spi-system"}, cm))
+	assert.Equal(t, "api.github.com:443\ngithub.com:443", cm.Data["serviceProviders"])
+	assert.Equal(t, "spi-vault:8200", cm.Data["tokenStorage"])
+}
+
+func TestUsesVault(t *testing.T) {
+	assert.False(t, usesVault(&config.Configuration{TokenStorage: config.TokenStorageTypeSecrets, VaultHost: "http://spi-vault:8200"}))
+	assert.True(t, usesVault(&config.Configuration{TokenStorage: config.TokenStorageTypeVault}))
+	assert.True(t, usesVault(&config.Configuration{TokenStorage: config.TokenStorageTypeSecrets, TokenStorageMigrationSource: config.TokenStorageTypeVault}))
+	assert.True(t, usesVault(&config.Configuration{TokenStorage: config.TokenStorageTypeSecrets, BindingWriteBackVaultMount: "spi-bindings"}))
+	assert.True(t, usesVault(&config.Configuration{TokenStorage: config.TokenStorageTypeSecrets, OAuthStateVaultTransitKey: "spi-oauth-state"}))
+}
@@ -0,0 +1,249 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+//+kubebuilder:rbac:groups=external-secrets.io,resources=externalsecrets,verbs=get;list;watch;create;update;delete
+//+kubebuilder:rbac:groups=external-secrets.io,resources=secretstores,verbs=get;list;watch;create;update
+
+// externalSecretsGroup is the API group of the External Secrets Operator. The operator doesn't depend on the Go types of
+// the External Secrets Operator, so its objects are handled as unstructured objects in the version preferred by
+// the cluster.
+const externalSecretsGroup = "external-secrets.io"
+
+// externalSecretRefreshInterval is how often the External Secrets Operator re-reads the data from Vault. The data
+// changes when the token is refreshed, so the interval is kept short.
+const externalSecretRefreshInterval = "1m"
+
+// externalSecretKinds are the kinds of the External Secrets Operator objects in the versions served by the cluster.
+type externalSecretKinds struct {
+	externalSecret schema.GroupVersionKind
+	secretStore    schema.GroupVersionKind
+}
+
+// findExternalSecretKinds looks up the preferred versions of the ExternalSecrets and SecretStores in the cluster.
+func findExternalSecretKinds(mapper meta.RESTMapper) (*externalSecretKinds, error) {
+	kinds := &externalSecretKinds{}
+	for kind, gvk := range map[string]*schema.GroupVersionKind{"ExternalSecret": &kinds.externalSecret, "SecretStore": &kinds.secretStore} {
+		mapping, err := mapper.RESTMapping(schema.GroupKind{Group: externalSecretsGroup, Kind: kind})
+		if err != nil {
+			return nil, fmt.Errorf("failed to find the %s kind of the External Secrets Operator: %w", kind, err)
+		}
+		*gvk = mapping.GroupVersionKind
+	}
+	return kinds, nil
+}
+
+func newUnstructured(gvk schema.GroupVersionKind) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	return obj
+}
+
+// syncExternalSecret creates or updates the ExternalSecret producing the secret of the binding from the data the binding
+// wrote back to Vault together with the SecretStore in the namespace of the binding the ExternalSecret reads through.
+func (r *SPIAccessTokenBindingReconciler) syncExternalSecret(ctx context.Context, binding *api.SPIAccessTokenBinding, name string) (client.Object, error) {
+	if name == "" {
+		name = binding.Name + "-secret"
+	}
+
+	cfg := r.ServiceProviderFactory.Configuration.Get()
+
+	if err := r.syncUnstructured(ctx, secretStoreFor(r.externalSecrets.secretStore, binding.Namespace, &cfg), nil); err != nil {
+		return nil, fmt.Errorf("failed to sync the SecretStore: %w", err)
+	}
+
+	es := externalSecretFor(r.externalSecrets.externalSecret, binding, name, cfg.ExternalSecretStore)
+	existing := newUnstructured(es.GroupVersionKind())
+	existing.SetNamespace(es.GetNamespace())
+	existing.SetName(es.GetName())
+	if err := r.checkSecretOwnership(ctx, binding, existing); err != nil {
+		return nil, err
+	}
+	if err := r.syncUnstructured(ctx, es, binding); err != nil {
+		return nil, fmt.Errorf("failed to sync the ExternalSecret: %w", err)
+	}
+
+	return es, nil
+}
+
+// syncUnstructured creates the object or updates its spec if it differs from the blueprint. The blueprint is updated
+// with the actual state of the object. The object is controlled by the owner, if any.
+func (r *SPIAccessTokenBindingReconciler) syncUnstructured(ctx context.Context, blueprint *unstructured.Unstructured, owner client.Object) error {
+	actual := newUnstructured(blueprint.GroupVersionKind())
+	if err := r.Client.Get(ctx, client.ObjectKeyFromObject(blueprint), actual); err != nil {
+		if !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to read the object: %w", err)
+		}
+
+		if owner != nil {
+			if err := controllerutil.SetControllerReference(owner, blueprint, r.Scheme); err != nil {
+				return fmt.Errorf("failed to set the owner of the object: %w", err)
+			}
+		}
+		if err := r.Client.Create(ctx, blueprint); err != nil {
+			return fmt.Errorf("failed to create the object: %w", err)
+		}
+		return nil
+	}
+
+	// the External Secrets Operator defaults some fields of the spec, so only the fields we set are compared
+	if !isSubset(blueprint.Object["spec"], actual.Object["spec"]) {
+		actual.Object["spec"] = blueprint.Object["spec"]
+		if owner != nil {
+			if err := controllerutil.SetControllerReference(owner, actual, r.Scheme); err != nil {
+				return fmt.Errorf("failed to set the owner of the object: %w", err)
+			}
+		}
+		if err := r.Client.Update(ctx, actual); err != nil {
+			return fmt.Errorf("failed to update the object: %w", err)
+		}
+	}
+
+	actual.DeepCopyInto(blueprint)
+	return nil
+}
+
+// secretStoreFor creates the SecretStore the ExternalSecrets in the namespace read the data written back by the bindings
+// through. The store authenticates to Vault with the role of the namespace so that the ExternalSecrets cannot read
+// the data of the bindings in other namespaces. The store is shared by all the bindings in the namespace and is
+// therefore not owned by any of them.
+func secretStoreFor(gvk schema.GroupVersionKind, namespace string, cfg *config.Configuration) *unstructured.Unstructured {
+	store := newUnstructured(gvk)
+	store.SetName(cfg.ExternalSecretStore)
+	store.SetNamespace(namespace)
+	store.Object["spec"] = map[string]interface{}{
+		"provider": map[string]interface{}{
+			"vault": map[string]interface{}{
+				"server":  cfg.VaultHost,
+				"path":    cfg.BindingWriteBackVaultMount,
+				"version": "v2",
+				"auth": map[string]interface{}{
+					"kubernetes": map[string]interface{}{
+						"mountPath": "kubernetes",
+						"role":      cfg.ExternalSecretVaultRolePrefix + namespace,
+						"serviceAccountRef": map[string]interface{}{
+							"name": cfg.ExternalSecretServiceAccount,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	return store
+}
+
+// externalSecretFor creates the ExternalSecret producing the secret of the binding using the SecretStore with
+// the provided name in the namespace of the binding.
+func externalSecretFor(gvk schema.GroupVersionKind, binding *api.SPIAccessTokenBinding, name string, store string) *unstructured.Unstructured {
+	metadata := map[string]interface{}{}
+	if len(binding.Spec.Secret.Labels) > 0 {
+		metadata["labels"] = toInterfaceMap(binding.Spec.Secret.Labels)
+	}
+	if len(binding.Spec.Secret.Annotations) > 0 {
+		metadata["annotations"] = toInterfaceMap(binding.Spec.Secret.Annotations)
+	}
+
+	template := map[string]interface{}{}
+	if len(metadata) > 0 {
+		template["metadata"] = metadata
+	}
+	if binding.Spec.Secret.Type != "" {
+		template["type"] = string(binding.Spec.Secret.Type)
+	}
+
+	target := map[string]interface{}{
+		"name":           name,
+		"creationPolicy": "Owner",
+	}
+	if len(template) > 0 {
+		target["template"] = template
+	}
+
+	es := newUnstructured(gvk)
+	es.SetName(name)
+	es.SetNamespace(binding.Namespace)
+	es.Object["spec"] = map[string]interface{}{
+		"refreshInterval": externalSecretRefreshInterval,
+		"secretStoreRef": map[string]interface{}{
+			"kind": "SecretStore",
+			"name": store,
+		},
+		"target": target,
+		"dataFrom": []interface{}{
+			map[string]interface{}{
+				"extract": map[string]interface{}{
+					"key": binding.Namespace + "/" + writeBackPath(binding),
+				},
+			},
+		},
+	}
+
+	return es
+}
+
+// isSubset checks whether all the fields of the expected value are present with the same values in the actual value.
+// The lists must have the same length and their items are compared in order.
+func isSubset(expected interface{}, actual interface{}) bool {
+	switch e := expected.(type) {
+	case map[string]interface{}:
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, v := range e {
+			if !isSubset(v, a[k]) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		a, ok := actual.([]interface{})
+		if !ok || len(a) != len(e) {
+			return false
+		}
+		for i := range e {
+			if !isSubset(e[i], a[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return equality.Semantic.DeepEqual(expected, actual)
+	}
+}
+
+func toInterfaceMap(m map[string]string) map[string]interface{} {
+	ret := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		ret[k] = v
+	}
+	return ret
+}
@@ -0,0 +1,157 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestSyncExternalSecret(t *testing.T) {
+	kinds := &externalSecretKinds{
+		externalSecret: schema.GroupVersionKind{Group: externalSecretsGroup, Version: "v1beta1", Kind: "ExternalSecret"},
+		secretStore:    schema.GroupVersionKind{Group: externalSecretsGroup, Version: "v1beta1", Kind: "SecretStore"},
+	}
+	sch := runtime.NewScheme()
+	assert.NoError(t, api.AddToScheme(sch))
+	sch.AddKnownTypeWithName(kinds.externalSecret, &unstructured.Unstructured{})
+	sch.AddKnownTypeWithName(kinds.secretStore, &unstructured.Unstructured{})
+
+	binding := &api.SPIAccessTokenBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "binding", Namespace: "ns", UID: "binding-uid"},
+		Spec: api.SPIAccessTokenBindingSpec{
+			Secret: api.SecretSpec{
+				Type:     corev1.SecretTypeBasicAuth,
+				Labels:   map[string]string{"app": "test"},
+				Delivery: api.SecretDeliveryExternalSecret,
+			},
+		},
+	}
+
+	cl := fake.NewClientBuilder().WithScheme(sch).Build()
+	r := &SPIAccessTokenBindingReconciler{
+		Client: cl,
+		Scheme: sch,
+		ServiceProviderFactory: serviceprovider.Factory{
+			Configuration: config.NewLiveConfiguration(config.Configuration{
+				VaultHost:                     "http://vault:8200",
+				BindingWriteBackVaultMount:    "spi-bindings",
+				ExternalSecretStore:           "spi-bindings",
+				ExternalSecretVaultRolePrefix: "spi-bindings-",
+				ExternalSecretServiceAccount:  "default",
+			}),
+		},
+		externalSecrets: kinds,
+	}
+
+	obj, err := r.syncExternalSecret(context.TODO(), binding, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "binding-secret", obj.GetName())
+
+	es := newUnstructured(kinds.externalSecret)
+	assert.NoError(t, cl.Get(context.TODO(), client.ObjectKey{Name: "binding-secret", Namespace: "ns"}, es))
+	assert.Equal(t, "binding", es.GetOwnerReferences()[0].Name)
+
+	dataFrom, _, _ := unstructured.NestedSlice(es.Object, "spec", "dataFrom")
+	assert.Equal(t, []interface{}{map[string]interface{}{"extract": map[string]interface{}{"key": "ns/binding"}}}, dataFrom)
+	storeKind, _, _ := unstructured.NestedString(es.Object, "spec", "secretStoreRef", "kind")
+	assert.Equal(t, "SecretStore", storeKind)
+	storeName, _, _ := unstructured.NestedString(es.Object, "spec", "secretStoreRef", "name")
+	assert.Equal(t, "spi-bindings", storeName)
+	secretType, _, _ := unstructured.NestedString(es.Object, "spec", "target", "template", "type")
+	assert.Equal(t, "kubernetes.io/basic-auth", secretType)
+
+	t.Run("creates the SecretStore of the namespace", func(t *testing.T) {
+		store := newUnstructured(kinds.secretStore)
+		assert.NoError(t, cl.Get(context.TODO(), client.ObjectKey{Name: "spi-bindings", Namespace: "ns"}, store))
+		assert.Empty(t, store.GetOwnerReferences())
+
+		vault, _, _ := unstructured.NestedMap(store.Object, "spec", "provider", "vault")
+		assert.Equal(t, "http://vault:8200", vault["server"])
+		assert.Equal(t, "spi-bindings", vault["path"])
+		role, _, _ := unstructured.NestedString(vault, "auth", "kubernetes", "role")
+		assert.Equal(t, "spi-bindings-ns", role)
+		sa, _, _ := unstructured.NestedString(vault, "auth", "kubernetes", "serviceAccountRef", "name")
+		assert.Equal(t, "default", sa)
+	})
+
+	t.Run("keeps the fields defaulted by the External Secrets Operator", func(t *testing.T) {
+		assert.NoError(t, unstructured.SetNestedField(es.Object, "Retain", "spec", "target", "deletionPolicy"))
+		assert.NoError(t, cl.Update(context.TODO(), es))
+
+		_, err := r.syncExternalSecret(context.TODO(), binding, "binding-secret")
+		assert.NoError(t, err)
+
+		actual := newUnstructured(kinds.externalSecret)
+		assert.NoError(t, cl.Get(context.TODO(), client.ObjectKey{Name: "binding-secret", Namespace: "ns"}, actual))
+		assert.Equal(t, es.GetResourceVersion(), actual.GetResourceVersion())
+	})
+
+	t.Run("updates the changed spec", func(t *testing.T) {
+		binding.Spec.WriteBack = &api.WriteBackTarget{Vault: "app/git"}
+
+		_, err := r.syncExternalSecret(context.TODO(), binding, "binding-secret")
+		assert.NoError(t, err)
+
+		actual := newUnstructured(kinds.externalSecret)
+		assert.NoError(t, cl.Get(context.TODO(), client.ObjectKey{Name: "binding-secret", Namespace: "ns"}, actual))
+		dataFrom, _, _ := unstructured.NestedSlice(actual.Object, "spec", "dataFrom")
+		assert.Equal(t, []interface{}{map[string]interface{}{"extract": map[string]interface{}{"key": "ns/app/git"}}}, dataFrom)
+	})
+}
+
+func TestIsSubset(t *testing.T) {
+	actual := map[string]interface{}{
+		"a": "b",
+		"c": map[string]interface{}{"d": "e", "f": "g"},
+		"h": []interface{}{map[string]interface{}{"i": "j", "k": "l"}},
+	}
+
+	assert.True(t, isSubset(map[string]interface{}{"a": "b"}, actual))
+	assert.True(t, isSubset(map[string]interface{}{"c": map[string]interface{}{"d": "e"}}, actual))
+	assert.True(t, isSubset(map[string]interface{}{"h": []interface{}{map[string]interface{}{"i": "j"}}}, actual))
+
+	assert.False(t, isSubset(map[string]interface{}{"a": "x"}, actual))
+	assert.False(t, isSubset(map[string]interface{}{"x": "y"}, actual))
+	assert.False(t, isSubset(map[string]interface{}{"c": "d"}, actual))
+	assert.False(t, isSubset(map[string]interface{}{"h": []interface{}{}}, actual))
+}
+
+func TestFindExternalSecretKinds(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{{Group: externalSecretsGroup, Version: "v1"}})
+	mapper.Add(schema.GroupVersionKind{Group: externalSecretsGroup, Version: "v1", Kind: "ExternalSecret"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: externalSecretsGroup, Version: "v1", Kind: "SecretStore"}, meta.RESTScopeNamespace)
+
+	kinds, err := findExternalSecretKinds(mapper)
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", kinds.externalSecret.Version)
+	assert.Equal(t, "v1", kinds.secretStore.Version)
+
+	_, err = findExternalSecretKinds(meta.NewDefaultRESTMapper(nil))
+	assert.Error(t, err)
+}
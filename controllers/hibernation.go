@@ -0,0 +1,80 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// namespaceHibernated returns true if the namespace with the provided name is labeled as hibernated. The missing
+// namespaces are not hibernated.
+func namespaceHibernated(ctx context.Context, cl client.Client, name string) (bool, error) {
+	ns := &corev1.Namespace{}
+	if err := cl.Get(ctx, client.ObjectKey{Name: name}, ns); err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to read the namespace %s: %w", name, err)
+	}
+	return isHibernated(ns), nil
+}
+
+func isHibernated(ns client.Object) bool {
+	return ns.GetLabels()[api.HibernatedNamespaceLabel] == "true"
+}
+
+// hibernationChanged passes the updates of the namespaces that were hibernated or woken up, so that the objects in
+// the namespaces are reconciled once the namespaces wake up.
+var hibernationChanged = predicate.Funcs{
+	CreateFunc:  func(event.CreateEvent) bool { return false },
+	DeleteFunc:  func(event.DeleteEvent) bool { return false },
+	GenericFunc: func(event.GenericEvent) bool { return false },
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		return isHibernated(e.ObjectOld) != isHibernated(e.ObjectNew)
+	},
+}
+
+// requestsForObjectsInNamespace returns a function mapping a namespace to the reconcile requests of all the objects
+// of the provided list type in it.
+func requestsForObjectsInNamespace(cl client.Client, newList func() client.ObjectList) func(client.Object) []reconcile.Request {
+	return func(ns client.Object) []reconcile.Request {
+		list := newList()
+		if err := cl.List(context.TODO(), list, client.InNamespace(ns.GetName())); err != nil {
+			log.Log.Error(err, "failed to list the objects in the namespace that woke up", "namespace", ns.GetName())
+			return []reconcile.Request{}
+		}
+
+		ret := []reconcile.Request{}
+		_ = apimeta.EachListItem(list, func(o runtime.Object) error {
+			if obj, ok := o.(client.Object); ok {
+				ret = append(ret, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(obj)})
+			}
+			return nil
+		})
+		return ret
+	}
+}
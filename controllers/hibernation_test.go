@@ -0,0 +1,80 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func hibernationTestNamespace(name string, hibernated bool) *corev1.Namespace {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	if hibernated {
+		ns.Labels = map[string]string{api.HibernatedNamespaceLabel: "true"}
+	}
+	return ns
+}
+
+func TestNamespaceHibernated(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, corev1.AddToScheme(sch))
+	cl := fake.NewClientBuilder().WithScheme(sch).WithObjects(hibernationTestNamespace("sleeping", true), hibernationTestNamespace("awake", false)).Build()
+
+	hibernated, err := namespaceHibernated(context.TODO(), cl, "sleeping")
+	assert.NoError(t, err)
+	assert.True(t, hibernated)
+
+	hibernated, err = namespaceHibernated(context.TODO(), cl, "awake")
+	assert.NoError(t, err)
+	assert.False(t, hibernated)
+
+	hibernated, err = namespaceHibernated(context.TODO(), cl, "missing")
+	assert.NoError(t, err)
+	assert.False(t, hibernated)
+}
+
+func TestHibernationChanged(t *testing.T) {
+	assert.True(t, hibernationChanged.Update(event.UpdateEvent{ObjectOld: hibernationTestNamespace("ns", true), ObjectNew: hibernationTestNamespace("ns", false)}))
+	assert.True(t, hibernationChanged.Update(event.UpdateEvent{ObjectOld: hibernationTestNamespace("ns", false), ObjectNew: hibernationTestNamespace("ns", true)}))
+	assert.False(t, hibernationChanged.Update(event.UpdateEvent{ObjectOld: hibernationTestNamespace("ns", false), ObjectNew: hibernationTestNamespace("ns", false)}))
+	assert.False(t, hibernationChanged.Create(event.CreateEvent{Object: hibernationTestNamespace("ns", false)}))
+}
+
+func TestRequestsForObjectsInNamespace(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, api.AddToScheme(sch))
+	cl := fake.NewClientBuilder().WithScheme(sch).WithObjects(
+		&api.SPIAccessToken{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "ns"}},
+		&api.SPIAccessToken{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "ns"}},
+		&api.SPIAccessToken{ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: "other"}},
+	).Build()
+
+	requests := requestsForObjectsInNamespace(cl, func() client.ObjectList { return &api.SPIAccessTokenList{} })(hibernationTestNamespace("ns", false))
+	assert.ElementsMatch(t, []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Namespace: "ns", Name: "a"}},
+		{NamespacedName: types.NamespacedName{Namespace: "ns", Name: "b"}},
+	}, requests)
+}
@@ -0,0 +1,108 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"sort"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/config"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/statusupdate"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// syncLinkedBindings records the bindings currently linked to the token in its status. The changed binding is the one
+// being reconciled. Its link is taken from the binding itself rather than from the listing, because the listing comes
+// from the cache that might not reflect the most recent changes of the binding yet.
+func syncLinkedBindings(ctx context.Context, cl client.Client, tokenKey client.ObjectKey, changed *api.SPIAccessTokenBinding) error {
+	if tokenKey.Name == "" {
+		return nil
+	}
+
+	list := &api.SPIAccessTokenBindingList{}
+	if err := cl.List(ctx, list, client.InNamespace(tokenKey.Namespace), client.MatchingLabels{
+		config.SPIAccessTokenLinkLabel: tokenKey.Name,
+	}); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(list.Items)+1)
+	for i := range list.Items {
+		b := &list.Items[i]
+		if b.DeletionTimestamp == nil && (changed == nil || b.Name != changed.Name) {
+			names = append(names, b.Name)
+		}
+	}
+	if changed != nil && changed.DeletionTimestamp == nil && changed.Labels[config.SPIAccessTokenLinkLabel] == tokenKey.Name {
+		names = append(names, changed.Name)
+	}
+	sort.Strings(names)
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		token := &api.SPIAccessToken{}
+		if err := cl.Get(ctx, tokenKey, token); err != nil {
+			if errors.IsNotFound(err) {
+				return nil
+			}
+			return err
+		}
+
+		if linkedBindingsEqual(token.Status.LinkedBindings, names) && token.Status.LinkedBindingCount == len(names) {
+			return nil
+		}
+
+		token.Status.LinkedBindings = names
+		token.Status.LinkedBindingCount = len(names)
+		return statusupdate.Apply(ctx, cl, token)
+	})
+}
+
+// pruneDeletedBinding removes the binding that no longer exists from the status of the tokens still listing it as
+// linked. The deleted binding doesn't tell which token it was linked to, so all the tokens in the namespace are checked.
+func pruneDeletedBinding(ctx context.Context, cl client.Client, bindingKey client.ObjectKey) error {
+	tokens := &api.SPIAccessTokenList{}
+	if err := cl.List(ctx, tokens, client.InNamespace(bindingKey.Namespace)); err != nil {
+		return err
+	}
+
+	for i := range tokens.Items {
+		token := &tokens.Items[i]
+		for _, name := range token.Status.LinkedBindings {
+			if name == bindingKey.Name {
+				if err := syncLinkedBindings(ctx, cl, client.ObjectKeyFromObject(token), nil); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+func linkedBindingsEqual(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
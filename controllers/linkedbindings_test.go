@@ -0,0 +1,92 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/config"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/statusupdate"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func linkedBinding(name string, tokenName string) *api.SPIAccessTokenBinding {
+	return &api.SPIAccessTokenBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "ns",
+			Labels:    map[string]string{config.SPIAccessTokenLinkLabel: tokenName},
+		},
+	}
+}
+
+func TestSyncLinkedBindings(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, api.AddToScheme(sch))
+
+	token := &api.SPIAccessToken{ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "ns"}}
+	deleted := linkedBinding("deleted", "token")
+	deleted.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	deleted.Finalizers = []string{"test"}
+
+	cl := statusupdate.FakeApplyClient{Client: fake.NewClientBuilder().WithScheme(sch).WithObjects(
+		token, linkedBinding("b", "token"), linkedBinding("other", "other-token"), deleted,
+	).Build()}
+
+	// the binding "a" is not in the cache yet
+	assert.NoError(t, syncLinkedBindings(context.TODO(), cl, client.ObjectKeyFromObject(token), linkedBinding("a", "token")))
+
+	assert.NoError(t, cl.Get(context.TODO(), client.ObjectKeyFromObject(token), token))
+	assert.Equal(t, []string{"a", "b"}, token.Status.LinkedBindings)
+	assert.Equal(t, 2, token.Status.LinkedBindingCount)
+
+	// "b" was relinked elsewhere
+	assert.NoError(t, cl.Create(context.TODO(), linkedBinding("a", "token")))
+	assert.NoError(t, syncLinkedBindings(context.TODO(), cl, client.ObjectKeyFromObject(token), linkedBinding("b", "other-token")))
+
+	assert.NoError(t, cl.Get(context.TODO(), client.ObjectKeyFromObject(token), token))
+	assert.Equal(t, []string{"a"}, token.Status.LinkedBindings)
+	assert.Equal(t, 1, token.Status.LinkedBindingCount)
+
+	assert.NoError(t, syncLinkedBindings(context.TODO(), cl, client.ObjectKey{Name: "missing", Namespace: "ns"}, nil))
+}
+
+func TestPruneDeletedBinding(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, api.AddToScheme(sch))
+
+	token := &api.SPIAccessToken{
+		ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "ns"},
+		Status: api.SPIAccessTokenStatus{
+			LinkedBindings:     []string{"gone", "kept"},
+			LinkedBindingCount: 2,
+		},
+	}
+
+	cl := statusupdate.FakeApplyClient{Client: fake.NewClientBuilder().WithScheme(sch).WithObjects(token, linkedBinding("kept", "token")).Build()}
+
+	assert.NoError(t, pruneDeletedBinding(context.TODO(), cl, client.ObjectKey{Name: "gone", Namespace: "ns"}))
+
+	assert.NoError(t, cl.Get(context.TODO(), client.ObjectKeyFromObject(token), token))
+	assert.Equal(t, []string{"kept"}, token.Status.LinkedBindings)
+	assert.Equal(t, 1, token.Status.LinkedBindingCount)
+}
@@ -0,0 +1,42 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// setSuspended sets the Suspended condition of the token while the service provider is in the maintenance window and
+// removes it otherwise.
+func setSuspended(at *api.SPIAccessToken, window *config.MaintenanceWindow) {
+	if window == nil {
+		apimeta.RemoveStatusCondition(&at.Status.Conditions, api.SPIAccessTokenConditionSuspended)
+		return
+	}
+
+	apimeta.SetStatusCondition(&at.Status.Conditions, metav1.Condition{
+		Type:               api.SPIAccessTokenConditionSuspended,
+		Status:             metav1.ConditionTrue,
+		Reason:             api.SPIAccessTokenSuspendedReasonProviderMaintenance,
+		Message:            fmt.Sprintf("the service provider is under maintenance until %s", window.End.UTC().Format(time.RFC3339)),
+		ObservedGeneration: at.Generation,
+	})
+}
@@ -0,0 +1,43 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/stretchr/testify/assert"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSetSuspended(t *testing.T) {
+	at := &api.SPIAccessToken{Status: api.SPIAccessTokenStatus{Phase: api.SPIAccessTokenPhaseReady}}
+	end := time.Date(2023, 6, 11, 2, 0, 0, 0, time.UTC)
+
+	setSuspended(at, &config.MaintenanceWindow{Start: end.Add(-6 * time.Hour), End: end})
+	condition := apimeta.FindStatusCondition(at.Status.Conditions, api.SPIAccessTokenConditionSuspended)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, metav1.ConditionTrue, condition.Status)
+		assert.Equal(t, api.SPIAccessTokenSuspendedReasonProviderMaintenance, condition.Reason)
+		assert.Equal(t, "the service provider is under maintenance until 2023-06-11T02:00:00Z", condition.Message)
+	}
+	assert.Equal(t, api.SPIAccessTokenPhaseReady, at.Status.Phase)
+
+	setSuspended(at, nil)
+	assert.Nil(t, apimeta.FindStatusCondition(at.Status.Conditions, api.SPIAccessTokenConditionSuspended))
+}
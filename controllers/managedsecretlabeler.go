@@ -0,0 +1,110 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// managedSecretsListPageSize is the number of the secrets listed at once when looking for the unlabeled secrets.
+const managedSecretsListPageSize = 500
+
+// ManagedSecretLabeler adds the config.ManagedSecretLabel to the secrets created by SPI before it started labeling
+// them. The operator only caches the labeled secrets, so it cannot see such secrets at all. The secrets are therefore
+// listed directly from the cluster, which is the only place where the operator reads the secrets it manages
+// without the cache. It runs once on each start of the leader, the subsequent runs only list the unlabeled secrets.
+type ManagedSecretLabeler struct {
+	Client client.Client
+	// APIReader reads the secrets directly from the cluster.
+	APIReader client.Reader
+}
+
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=list;patch
+
+// Start labels the secrets created by SPI. The failures are only logged, the secrets that failed to be labeled are
+// retried on the next start.
+func (l *ManagedSecretLabeler) Start(ctx context.Context) error {
+	lg := log.FromContext(ctx)
+
+	labeled, err := l.labelSecrets(ctx)
+	if err != nil {
+		lg.Error(err, "failed to label the secrets created by SPI", "labeled", labeled)
+		return nil
+	}
+
+	if labeled > 0 {
+		lg.Info("labeled the secrets created by SPI", "labeled", labeled)
+	}
+	return nil
+}
+
+func (l *ManagedSecretLabeler) labelSecrets(ctx context.Context) (int, error) {
+	unlabeled, err := labels.NewRequirement(config.ManagedSecretLabel, selection.DoesNotExist, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to construct the label selector: %w", err)
+	}
+	selector := labels.NewSelector().Add(*unlabeled)
+
+	labeled := 0
+	continueToken := ""
+	for {
+		secrets := &corev1.SecretList{}
+		if err := l.APIReader.List(ctx, secrets, client.MatchingLabelsSelector{Selector: selector}, client.Limit(managedSecretsListPageSize), client.Continue(continueToken)); err != nil {
+			return labeled, fmt.Errorf("failed to list the unlabeled secrets: %w", err)
+		}
+
+		for i := range secrets.Items {
+			secret := &secrets.Items[i]
+			if !createdBySPI(secret) {
+				continue
+			}
+
+			patch := client.MergeFrom(secret.DeepCopy())
+			if secret.Labels == nil {
+				secret.Labels = map[string]string{}
+			}
+			secret.Labels[config.ManagedSecretLabel] = config.ManagedSecretLabelValue
+			if err := l.Client.Patch(ctx, secret, patch); err != nil {
+				return labeled, fmt.Errorf("failed to label the secret %s/%s: %w", secret.Namespace, secret.Name, err)
+			}
+			labeled++
+		}
+
+		continueToken = secrets.Continue
+		if continueToken == "" {
+			return labeled, nil
+		}
+	}
+}
+
+// createdBySPI checks whether the secret was created by SPI, i.e. whether it is the secret of a binding or of
+// the secrets token storage.
+func createdBySPI(secret *corev1.Secret) bool {
+	for _, ref := range secret.OwnerReferences {
+		if ref.APIVersion == api.GroupVersion.String() && (ref.Kind == "SPIAccessTokenBinding" || ref.Kind == "SPIAccessToken") {
+			return true
+		}
+	}
+	return false
+}
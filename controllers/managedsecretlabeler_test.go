@@ -0,0 +1,65 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestManagedSecretLabeler(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, corev1.AddToScheme(sch))
+
+	secret := func(name string, ownerKind string) *corev1.Secret {
+		s := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns", Labels: map[string]string{"app": "test"}},
+		}
+		if ownerKind != "" {
+			s.OwnerReferences = []metav1.OwnerReference{{APIVersion: api.GroupVersion.String(), Kind: ownerKind, Name: "owner", UID: "42"}}
+		}
+		return s
+	}
+
+	cl := fake.NewClientBuilder().WithScheme(sch).WithObjects(
+		secret("binding-secret", "SPIAccessTokenBinding"),
+		secret("spi-storage-token", "SPIAccessToken"),
+		secret("user-secret", ""),
+		secret("other-owner", "SPIAccessCheck"),
+	).Build()
+
+	labeler := &ManagedSecretLabeler{Client: cl, APIReader: cl}
+	assert.NoError(t, labeler.Start(context.TODO()))
+
+	labelsOf := func(name string) map[string]string {
+		s := &corev1.Secret{}
+		assert.NoError(t, cl.Get(context.TODO(), client.ObjectKey{Name: name, Namespace: "ns"}, s))
+		return s.Labels
+	}
+
+	assert.Equal(t, map[string]string{"app": "test", config.ManagedSecretLabel: config.ManagedSecretLabelValue}, labelsOf("binding-secret"))
+	assert.Equal(t, map[string]string{"app": "test", config.ManagedSecretLabel: config.ManagedSecretLabelValue}, labelsOf("spi-storage-token"))
+	assert.Equal(t, map[string]string{"app": "test"}, labelsOf("user-secret"))
+	assert.Equal(t, map[string]string{"app": "test"}, labelsOf("other-owner"))
+}
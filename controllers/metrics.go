@@ -0,0 +1,77 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	sperrors "github.com/redhat-appstudio/service-provider-integration-operator/pkg/errors"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// oauthNotConfiguredCounter counts the reconciliations that failed because the object referenced a supported service
+// provider without any OAuth application configured. The administrators can alert on this to find out that users need
+// a service provider that is not configured.
+var oauthNotConfiguredCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "spi_oauth_not_configured_total",
+	Help: "The number of times an object referenced a supported service provider that has no OAuth application configured.",
+}, []string{"sp_type", "sp_url"})
+
+// bindingFirstSyncHistogram measures the time from the creation of the binding to the first sync of its secret, i.e.
+// how long the users wait for their credentials. The bindings that had to wait for a new token to be created for them
+// (and for the user to complete its OAuth flow or upload its data) are distinguished by the new_token label.
+var bindingFirstSyncHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "spi_binding_first_sync_seconds",
+	Help:    "The time from the creation of the binding to the first sync of its secret.",
+	Buckets: prometheus.ExponentialBuckets(1, 2, 15),
+}, []string{"sp_type", "new_token"})
+
+// tokenScopesReducedCounter counts the tokens the scopes of which were found reduced on the service provider side when
+// refreshing their metadata, e.g. because the user removed them in the UI of the service provider.
+var tokenScopesReducedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "spi_token_scopes_reduced_total",
+	Help: "The number of times the scopes of a token were found reduced on the service provider side.",
+}, []string{"sp_type"})
+
+func init() {
+	metrics.Registry.MustRegister(oauthNotConfiguredCounter, bindingFirstSyncHistogram, tokenScopesReducedCounter)
+}
+
+// reportBindingFirstSync observes the time between the creation of the binding and its first sync time in
+// the bindingFirstSyncHistogram.
+func reportBindingFirstSync(binding *api.SPIAccessTokenBinding, token *api.SPIAccessToken, spType string) {
+	if binding.Status.FirstSyncTime == nil {
+		return
+	}
+
+	newToken := token.Annotations[api.GeneratedForBindingAnnotation] == binding.Name
+	bindingFirstSyncHistogram.WithLabelValues(spType, strconv.FormatBool(newToken)).
+		Observe(binding.Status.FirstSyncTime.Sub(binding.CreationTimestamp.Time).Seconds())
+}
+
+// reportOAuthNotConfigured increments the oauthNotConfiguredCounter if the provided error is
+// the OAuthNotConfiguredError. Returns true if it is, false otherwise.
+func reportOAuthNotConfigured(err error) bool {
+	onc := &sperrors.OAuthNotConfiguredError{}
+	if !errors.As(err, &onc) {
+		return false
+	}
+
+	oauthNotConfiguredCounter.WithLabelValues(onc.ServiceProviderType, onc.ServiceProviderUrl).Inc()
+	return true
+}
@@ -0,0 +1,70 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	sperrors "github.com/redhat-appstudio/service-provider-integration-operator/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReportOAuthNotConfigured(t *testing.T) {
+	counter := oauthNotConfiguredCounter.WithLabelValues("GitHub", "https://github.com")
+	before := testutil.ToFloat64(counter)
+
+	assert.True(t, reportOAuthNotConfigured(fmt.Errorf("wrapped: %w", &sperrors.OAuthNotConfiguredError{
+		ServiceProviderType: "GitHub",
+		ServiceProviderUrl:  "https://github.com",
+	})))
+	assert.False(t, reportOAuthNotConfigured(fmt.Errorf("other error")))
+
+	assert.Equal(t, before+1, testutil.ToFloat64(counter))
+}
+
+func TestReportBindingFirstSync(t *testing.T) {
+	created := time.Now().Add(-time.Hour)
+	synced := metav1.NewTime(created.Add(30 * time.Second))
+	binding := &api.SPIAccessTokenBinding{ObjectMeta: metav1.ObjectMeta{Name: "binding", CreationTimestamp: metav1.NewTime(created)}}
+
+	// not synced yet
+	reportBindingFirstSync(binding, &api.SPIAccessToken{}, "Acme")
+	assert.Equal(t, 0, testutil.CollectAndCount(bindingFirstSyncHistogram))
+
+	binding.Status.FirstSyncTime = &synced
+	reportBindingFirstSync(binding, &api.SPIAccessToken{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{api.GeneratedForBindingAnnotation: "binding"}}}, "Acme")
+
+	expected := &strings.Builder{}
+	expected.WriteString("# HELP spi_binding_first_sync_seconds The time from the creation of the binding to the first sync of its secret.\n")
+	expected.WriteString("# TYPE spi_binding_first_sync_seconds histogram\n")
+	for bound := 1; bound <= 16384; bound *= 2 {
+		count := 0
+		if bound >= 30 {
+			count = 1
+		}
+		fmt.Fprintf(expected, "spi_binding_first_sync_seconds_bucket{new_token=\"true\",sp_type=\"Acme\",le=\"%d\"} %d\n", bound, count)
+	}
+	expected.WriteString("spi_binding_first_sync_seconds_bucket{new_token=\"true\",sp_type=\"Acme\",le=\"+Inf\"} 1\n")
+	expected.WriteString("spi_binding_first_sync_seconds_sum{new_token=\"true\",sp_type=\"Acme\"} 30\n")
+	expected.WriteString("spi_binding_first_sync_seconds_count{new_token=\"true\",sp_type=\"Acme\"} 1\n")
+
+	assert.NoError(t, testutil.CollectAndCompare(bindingFirstSyncHistogram, strings.NewReader(expected.String())))
+}
@@ -0,0 +1,214 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/tokenstorage"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/util"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/writeback"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// namespaceCleanupFinalizers are the finalizers of the SPI objects removed by the NamespaceCleanupReconciler.
+var namespaceCleanupFinalizers = []string{linkedBindingsFinalizerName, tokenStorageFinalizerName, writeBackFinalizerName}
+
+// beingDeleted passes the events of the objects marked for deletion.
+var beingDeleted = predicate.NewPredicateFuncs(func(o client.Object) bool {
+	return o.GetDeletionTimestamp() != nil
+})
+
+// NamespaceCleanupReconciler finalizes the SPIAccessTokens and SPIAccessTokenBindings of the namespaces being deleted.
+// The token and binding controllers finalize the objects one by one and the tokens wait for their bindings to be gone
+// first, which makes the deletion of the namespaces with many SPI objects slow. Everything in the namespace is being
+// deleted, so there's no need for any ordering and all the objects are finalized at once: the data of all the tokens
+// is deleted from the token storage in bulk and the finalizers are removed concurrently.
+type NamespaceCleanupReconciler struct {
+	client.Client
+	TokenStorage           tokenstorage.TokenStorage
+	Configuration          *config.LiveConfiguration
+	ServiceProviderFactory serviceprovider.Factory
+	// WriteBackStore is the external secret store the bindings write their data back to. As with the binding
+	// controller, the data written back is left in place if the write-back is not enabled.
+	WriteBackStore writeback.Store
+}
+
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+//+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spiaccesstokens,verbs=get;list;watch;patch
+//+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spiaccesstokenbindings,verbs=get;list;watch;patch
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *NamespaceCleanupReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("namespacecleanup").
+		For(&corev1.Namespace{}, builder.WithPredicates(beingDeleted)).
+		Watches(&source.Kind{Type: &api.SPIAccessToken{}}, handler.EnqueueRequestsFromMapFunc(requestForNamespace), builder.WithPredicates(beingDeleted)).
+		Watches(&source.Kind{Type: &api.SPIAccessTokenBinding{}}, handler.EnqueueRequestsFromMapFunc(requestForNamespace), builder.WithPredicates(beingDeleted)).
+		Complete(monitored(mgr, "NamespaceCleanup", &corev1.Namespace{}, r))
+}
+
+// requestForNamespace returns the request for the namespace of the object.
+func requestForNamespace(o client.Object) []reconcile.Request {
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: o.GetNamespace()}}}
+}
+
+func (r *NamespaceCleanupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	lg := log.FromContext(ctx)
+
+	deleted, err := namespaceDeleted(ctx, r.Client, req.Name)
+	if err != nil {
+		return ctrl.Result{}, NewReconcileError(err, "failed to read the namespace")
+	}
+	if !deleted {
+		return ctrl.Result{}, nil
+	}
+
+	bindings := &api.SPIAccessTokenBindingList{}
+	if err := r.List(ctx, bindings, client.InNamespace(req.Name)); err != nil {
+		return ctrl.Result{}, NewReconcileError(err, "failed to list the bindings of the deleted namespace")
+	}
+	tokens := &api.SPIAccessTokenList{}
+	if err := r.List(ctx, tokens, client.InNamespace(req.Name)); err != nil {
+		return ctrl.Result{}, NewReconcileError(err, "failed to list the tokens of the deleted namespace")
+	}
+
+	start := time.Now()
+	concurrency := r.Configuration.Get().NamespaceCleanupConcurrency
+	if concurrency <= 0 {
+		concurrency = config.DefaultNamespaceCleanupConcurrency
+	}
+
+	finalizedBindings, err := r.finalizeBindings(ctx, bindings.Items, concurrency)
+	if err != nil {
+		return ctrl.Result{}, NewReconcileError(err, "failed to finalize the bindings of the deleted namespace")
+	}
+	finalizedTokens, err := r.finalizeTokens(ctx, tokens.Items, concurrency)
+	if err != nil {
+		return ctrl.Result{}, NewReconcileError(err, "failed to finalize the tokens of the deleted namespace")
+	}
+
+	if finalizedBindings > 0 || finalizedTokens > 0 {
+		lg.Info("finalized the SPI objects of the deleted namespace", "bindings", finalizedBindings, "tokens", finalizedTokens, "duration", time.Since(start))
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// finalizeBindings deletes the data the deleted bindings wrote back to the external secret store and removes their
+// finalizers. Returns the number of the bindings finalized.
+func (r *NamespaceCleanupReconciler) finalizeBindings(ctx context.Context, bindings []api.SPIAccessTokenBinding, concurrency int) (int, error) {
+	pending := make([]*api.SPIAccessTokenBinding, 0, len(bindings))
+	for i := range bindings {
+		if needsNamespaceCleanup(&bindings[i]) {
+			pending = append(pending, &bindings[i])
+		}
+	}
+
+	return len(pending), util.RunConcurrently(len(pending), concurrency, func(i int) error {
+		binding := pending[i]
+		if r.WriteBackStore != nil && controllerutil.ContainsFinalizer(binding, writeBackFinalizerName) {
+			if err := deleteWrittenBackData(ctx, r.WriteBackStore, binding); err != nil {
+				return fmt.Errorf("failed to delete the data written back by the binding %s: %w", binding.Name, err)
+			}
+		}
+		return removeNamespaceCleanupFinalizers(ctx, r.Client, binding)
+	})
+}
+
+// finalizeTokens deletes the data of the deleted tokens from the token storage and removes their finalizers. The grants
+// of the tokens are revoked first if the configuration requires it. The finalizers are only removed once the data of
+// all the tokens is deleted. Returns the number of the tokens finalized.
+func (r *NamespaceCleanupReconciler) finalizeTokens(ctx context.Context, tokens []api.SPIAccessToken, concurrency int) (int, error) {
+	pending := make([]*api.SPIAccessToken, 0, len(tokens))
+	withData := make([]*api.SPIAccessToken, 0, len(tokens))
+	for i := range tokens {
+		token := &tokens[i]
+		if !needsNamespaceCleanup(token) {
+			continue
+		}
+		pending = append(pending, token)
+		// the data of the tombstones belongs to the deleted tokens they were created for
+		if controllerutil.ContainsFinalizer(token, tokenStorageFinalizerName) && !isTombstoneName(token.Name) {
+			withData = append(withData, token)
+		}
+	}
+
+	storageFinalizer := &tokenStorageFinalizer{
+		client:                 r.Client,
+		storage:                r.TokenStorage,
+		configuration:          r.Configuration,
+		serviceProviderFactory: r.ServiceProviderFactory,
+	}
+	// the grant can only be revoked while the token data still exists
+	_ = util.RunConcurrently(len(withData), concurrency, func(i int) error {
+		storageFinalizer.revokeGrantIfNeeded(ctx, withData[i])
+		return nil
+	})
+
+	if err := tokenstorage.DeleteAll(ctx, r.TokenStorage, withData, concurrency); err != nil {
+		return 0, fmt.Errorf("failed to delete the token data: %w", err)
+	}
+
+	return len(pending), util.RunConcurrently(len(pending), concurrency, func(i int) error {
+		return removeNamespaceCleanupFinalizers(ctx, r.Client, pending[i])
+	})
+}
+
+// needsNamespaceCleanup returns true if the object is being deleted and has any of the namespaceCleanupFinalizers.
+func needsNamespaceCleanup(obj client.Object) bool {
+	if obj.GetDeletionTimestamp() == nil {
+		return false
+	}
+	for _, f := range namespaceCleanupFinalizers {
+		if controllerutil.ContainsFinalizer(obj, f) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeNamespaceCleanupFinalizers removes the namespaceCleanupFinalizers from the object. The other finalizers are
+// left in place.
+func removeNamespaceCleanupFinalizers(ctx context.Context, cl client.Client, obj client.Object) error {
+	patched, ok := obj.DeepCopyObject().(client.Object)
+	if !ok {
+		return fmt.Errorf("failed to copy the object %s", obj.GetName())
+	}
+	for _, f := range namespaceCleanupFinalizers {
+		controllerutil.RemoveFinalizer(patched, f)
+	}
+
+	if err := cl.Patch(ctx, patched, client.MergeFrom(obj)); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to remove the finalizers of %s: %w", obj.GetName(), err)
+	}
+	return nil
+}
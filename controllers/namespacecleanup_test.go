@@ -0,0 +1,187 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/tokenstorage"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func namespaceCleanupTestClient(t *testing.T, namespaceDeleted bool, tokens int, bindings int) client.Client {
+	sch := runtime.NewScheme()
+	assert.NoError(t, corev1.AddToScheme(sch))
+	assert.NoError(t, api.AddToScheme(sch))
+
+	now := metav1.Now()
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns"}}
+	if namespaceDeleted {
+		ns.DeletionTimestamp = &now
+		ns.Finalizers = []string{"kubernetes"}
+	}
+
+	objs := []client.Object{ns}
+	for i := 0; i < tokens; i++ {
+		objs = append(objs, &api.SPIAccessToken{ObjectMeta: metav1.ObjectMeta{
+			Name:              fmt.Sprintf("token-%d", i),
+			Namespace:         "ns",
+			DeletionTimestamp: &now,
+			Finalizers:        []string{linkedBindingsFinalizerName, tokenStorageFinalizerName, "example.com/other"},
+		}})
+	}
+	for i := 0; i < bindings; i++ {
+		objs = append(objs, &api.SPIAccessTokenBinding{ObjectMeta: metav1.ObjectMeta{
+			Name:              fmt.Sprintf("binding-%d", i),
+			Namespace:         "ns",
+			DeletionTimestamp: &now,
+			Finalizers:        []string{writeBackFinalizerName},
+		}})
+	}
+
+	return fake.NewClientBuilder().WithScheme(sch).WithObjects(objs...).Build()
+}
+
+func TestNamespaceCleanup(t *testing.T) {
+	t.Run("finalizes the objects of the deleted namespace", func(t *testing.T) {
+		cl := namespaceCleanupTestClient(t, true, 3, 2)
+		deleted := int32(0)
+		r := &NamespaceCleanupReconciler{
+			Client:        cl,
+			Configuration: config.NewLiveConfiguration(config.Configuration{NamespaceCleanupConcurrency: 2}),
+			TokenStorage: tokenstorage.TestTokenStorage{DeleteImpl: func(_ context.Context, _ *api.SPIAccessToken) error {
+				atomic.AddInt32(&deleted, 1)
+				return nil
+			}},
+		}
+
+		_, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "ns"}})
+		assert.NoError(t, err)
+		assert.Equal(t, int32(3), deleted)
+
+		tokens := &api.SPIAccessTokenList{}
+		assert.NoError(t, cl.List(context.TODO(), tokens, client.InNamespace("ns")))
+		for _, token := range tokens.Items {
+			assert.Equal(t, []string{"example.com/other"}, token.Finalizers)
+		}
+		bindings := &api.SPIAccessTokenBindingList{}
+		assert.NoError(t, cl.List(context.TODO(), bindings, client.InNamespace("ns")))
+		for _, binding := range bindings.Items {
+			assert.Empty(t, binding.Finalizers)
+		}
+	})
+
+	t.Run("leaves the namespaces not being deleted alone", func(t *testing.T) {
+		cl := namespaceCleanupTestClient(t, false, 1, 1)
+		r := &NamespaceCleanupReconciler{
+			Client:        cl,
+			Configuration: config.NewLiveConfiguration(config.Configuration{}),
+			TokenStorage: tokenstorage.TestTokenStorage{DeleteImpl: func(_ context.Context, _ *api.SPIAccessToken) error {
+				assert.Fail(t, "no token data should be deleted")
+				return nil
+			}},
+		}
+
+		_, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "ns"}})
+		assert.NoError(t, err)
+
+		token := &api.SPIAccessToken{}
+		assert.NoError(t, cl.Get(context.TODO(), client.ObjectKey{Name: "token-0", Namespace: "ns"}, token))
+		assert.Len(t, token.Finalizers, 3)
+	})
+
+	t.Run("keeps the finalizers if the token data cannot be deleted", func(t *testing.T) {
+		cl := namespaceCleanupTestClient(t, true, 2, 0)
+		r := &NamespaceCleanupReconciler{
+			Client:        cl,
+			Configuration: config.NewLiveConfiguration(config.Configuration{}),
+			TokenStorage: tokenstorage.TestTokenStorage{DeleteImpl: func(_ context.Context, owner *api.SPIAccessToken) error {
+				if owner.Name == "token-1" {
+					return fmt.Errorf("storage unavailable")
+				}
+				return nil
+			}},
+		}
+
+		_, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "ns"}})
+		assert.Error(t, err)
+
+		token := &api.SPIAccessToken{}
+		assert.NoError(t, cl.Get(context.TODO(), client.ObjectKey{Name: "token-0", Namespace: "ns"}, token))
+		assert.Len(t, token.Finalizers, 3)
+	})
+}
+
+func TestNamespaceCleanup_ManyObjects(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping the namespace cleanup of many objects in the short mode")
+	}
+
+	const objects = 2000
+	// each delete from the token storage takes a while, so that the concurrent deletes overlap
+	const storageLatency = 5 * time.Millisecond
+
+	// the number of the deletes in progress and the highest number seen
+	var inFlight, peakInFlight int32
+
+	cl := namespaceCleanupTestClient(t, true, objects, objects)
+	r := &NamespaceCleanupReconciler{
+		Client:        cl,
+		Configuration: config.NewLiveConfiguration(config.Configuration{}),
+		TokenStorage: tokenstorage.TestTokenStorage{DeleteImpl: func(_ context.Context, _ *api.SPIAccessToken) error {
+			current := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+			for {
+				peak := atomic.LoadInt32(&peakInFlight)
+				if current <= peak || atomic.CompareAndSwapInt32(&peakInFlight, peak, current) {
+					break
+				}
+			}
+			time.Sleep(storageLatency)
+			return nil
+		}},
+	}
+
+	_, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "ns"}})
+
+	assert.NoError(t, err)
+	// the token data is deleted concurrently, not one by one
+	assert.Greater(t, atomic.LoadInt32(&peakInFlight), int32(1))
+
+	tokens := &api.SPIAccessTokenList{}
+	assert.NoError(t, cl.List(context.TODO(), tokens, client.InNamespace("ns")))
+	assert.Len(t, tokens.Items, objects)
+	for _, token := range tokens.Items {
+		assert.False(t, needsNamespaceCleanup(&token))
+	}
+	bindings := &api.SPIAccessTokenBindingList{}
+	assert.NoError(t, cl.List(context.TODO(), bindings, client.InNamespace("ns")))
+	for _, binding := range bindings.Items {
+		assert.False(t, needsNamespaceCleanup(&binding))
+	}
+}
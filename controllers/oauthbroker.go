@@ -0,0 +1,99 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/oauthbroker"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// brokerLinkPollInterval is how often the brokered tokens of the users that have not linked their accounts yet are
+	// checked again. Keycloak doesn't notify anyone about the linking.
+	brokerLinkPollInterval = time.Minute
+	// brokerRefreshMargin is how long before their expiry the data of the brokered tokens are exchanged again.
+	brokerRefreshMargin = 5 * time.Minute
+)
+
+// brokerIdentityProvider returns the alias of the identity provider the OAuth flows of the service provider are brokered
+// through or an empty string if they are not brokered.
+func brokerIdentityProvider(cfg config.Configuration, sp serviceprovider.ServiceProvider) string {
+	return cfg.BrokerIdentityProvider(config.ServiceProviderType(sp.GetType()), sp.GetBaseUrl())
+}
+
+// reconcileBrokeredToken obtains the data of the token from the OAuth broker if the OAuth flows of its service provider
+// are brokered. The data is exchanged on behalf of the owner of the token when the token has no data or its data is
+// about to expire, and is stored in the token storage. The tokens without the owner are left awaiting the data. Returns
+// the data of the token and the time after which the token should be reconciled again to refresh its data or to check
+// whether the owner has linked their account in the meantime (0 if not needed).
+func (r *SPIAccessTokenReconciler) reconcileBrokeredToken(ctx context.Context, at *api.SPIAccessToken, sp serviceprovider.ServiceProvider, data *api.Token) (*api.Token, time.Duration, error) {
+	cfg := r.Configuration.Get()
+	identityProvider := brokerIdentityProvider(cfg, sp)
+	if identityProvider == "" {
+		return data, 0, nil
+	}
+
+	now := time.Now()
+	if data != nil && (data.Expiry == 0 || time.Unix(int64(data.Expiry), 0).Sub(now) > brokerRefreshMargin) {
+		return data, brokeredRefreshAfter(data, now), nil
+	}
+
+	lg := log.FromContext(ctx)
+	owner := at.Annotations[api.TokenOwnerAnnotation]
+	if owner == "" {
+		lg.Info("the token of the brokered service provider has no owner to obtain the data for")
+		return data, 0, nil
+	}
+
+	exchanged, err := oauthbroker.FromConfiguration(cfg, r.ServiceProviderFactory.HttpClient).Exchange(ctx, owner, identityProvider)
+	if errors.Is(err, oauthbroker.ErrNotLinked) {
+		lg.Info("the owner of the token has not linked their account in the OAuth broker yet", "owner", owner)
+		return data, brokerLinkPollInterval, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to obtain the token data from the OAuth broker: %w", err)
+	}
+
+	if err := r.TokenStorage.Store(ctx, at, exchanged); err != nil {
+		return nil, 0, fmt.Errorf("failed to store the token data obtained from the OAuth broker: %w", err)
+	}
+	if data, err = r.TokenStorage.Get(ctx, at); err != nil {
+		return nil, 0, fmt.Errorf("failed to read the token data obtained from the OAuth broker: %w", err)
+	}
+	lg.Info("obtained the token data from the OAuth broker")
+
+	return data, brokeredRefreshAfter(data, now), nil
+}
+
+// brokeredRefreshAfter returns the time after which the data of the brokered token should be exchanged again or 0 if
+// the data doesn't expire.
+func brokeredRefreshAfter(data *api.Token, now time.Time) time.Duration {
+	if data == nil || data.Expiry == 0 {
+		return 0
+	}
+	refreshAfter := time.Unix(int64(data.Expiry), 0).Add(-brokerRefreshMargin).Sub(now)
+	if refreshAfter < brokerLinkPollInterval {
+		return brokerLinkPollInterval
+	}
+	return refreshAfter
+}
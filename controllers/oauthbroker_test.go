@@ -0,0 +1,140 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/tokenstorage"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReconcileBrokeredToken(t *testing.T) {
+	exchanges := 0
+	keycloak := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		exchanges++
+		assert.NoError(t, r.ParseForm())
+		w.Header().Set("Content-Type", "application/json")
+		if r.PostForm.Get("requested_subject") == "alois" {
+			_, _ = w.Write([]byte(`{"access_token":"brokered","token_type":"bearer","expires_in":3600}`))
+		} else {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"not_linked","account-link-url":"https://sso.acme.com/link"}`))
+		}
+	}))
+	defer keycloak.Close()
+
+	github := urlServiceProvider{spType: api.ServiceProviderTypeGitHub, baseUrl: "https://github.com"}
+	quay := urlServiceProvider{spType: api.ServiceProviderTypeQuay, baseUrl: "https://quay.io"}
+
+	reconciler := func(stored **api.Token) *SPIAccessTokenReconciler {
+		return &SPIAccessTokenReconciler{
+			Configuration: config.NewLiveConfiguration(config.Configuration{
+				ServiceProviders: []config.ServiceProviderConfiguration{
+					{ServiceProviderType: config.ServiceProviderTypeGitHub, BrokerIdentityProvider: "github"},
+					{ServiceProviderType: config.ServiceProviderTypeQuay, ClientId: "quay", ClientSecret: "secret"},
+				},
+				OAuthBrokerUrl:          keycloak.URL,
+				OAuthBrokerRealm:        "acme",
+				OAuthBrokerClientId:     "spi",
+				OAuthBrokerClientSecret: "secret",
+			}),
+			ServiceProviderFactory: serviceprovider.Factory{HttpClient: keycloak.Client()},
+			TokenStorage: tokenstorage.TestTokenStorage{
+				StoreImpl: func(_ context.Context, _ *api.SPIAccessToken, data *api.Token) error {
+					*stored = data
+					return nil
+				},
+				GetImpl: func(context.Context, *api.SPIAccessToken) (*api.Token, error) {
+					return *stored, nil
+				},
+			},
+		}
+	}
+
+	token := func(owner string) *api.SPIAccessToken {
+		at := &api.SPIAccessToken{ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "ns"}}
+		if owner != "" {
+			at.Annotations = map[string]string{api.TokenOwnerAnnotation: owner}
+		}
+		return at
+	}
+
+	t.Run("exchanges the data of the owner", func(t *testing.T) {
+		var stored *api.Token
+		data, recheckAfter, err := reconciler(&stored).reconcileBrokeredToken(context.TODO(), token("alois"), github, nil)
+		assert.NoError(t, err)
+		if assert.NotNil(t, data) {
+			assert.Equal(t, "brokered", data.AccessToken)
+		}
+		assert.Equal(t, stored, data)
+		assert.InDelta(t, time.Hour-brokerRefreshMargin, recheckAfter, float64(5*time.Second))
+	})
+
+	t.Run("waits for the owner to link the account", func(t *testing.T) {
+		var stored *api.Token
+		data, recheckAfter, err := reconciler(&stored).reconcileBrokeredToken(context.TODO(), token("bob"), github, nil)
+		assert.NoError(t, err)
+		assert.Nil(t, data)
+		assert.Nil(t, stored)
+		assert.Equal(t, brokerLinkPollInterval, recheckAfter)
+	})
+
+	t.Run("keeps the fresh data", func(t *testing.T) {
+		before := exchanges
+		fresh := &api.Token{AccessToken: "fresh", Expiry: uint64(time.Now().Add(time.Hour).Unix())}
+		stored := fresh
+		data, _, err := reconciler(&stored).reconcileBrokeredToken(context.TODO(), token("alois"), github, fresh)
+		assert.NoError(t, err)
+		assert.Equal(t, fresh, data)
+		assert.Equal(t, before, exchanges)
+	})
+
+	t.Run("refreshes the expiring data", func(t *testing.T) {
+		expiring := &api.Token{AccessToken: "expiring", Expiry: uint64(time.Now().Add(time.Minute).Unix())}
+		stored := expiring
+		data, _, err := reconciler(&stored).reconcileBrokeredToken(context.TODO(), token("alois"), github, expiring)
+		assert.NoError(t, err)
+		assert.Equal(t, "brokered", data.AccessToken)
+	})
+
+	t.Run("ignores the tokens without owner", func(t *testing.T) {
+		before := exchanges
+		var stored *api.Token
+		data, recheckAfter, err := reconciler(&stored).reconcileBrokeredToken(context.TODO(), token(""), github, nil)
+		assert.NoError(t, err)
+		assert.Nil(t, data)
+		assert.Zero(t, recheckAfter)
+		assert.Equal(t, before, exchanges)
+	})
+
+	t.Run("ignores the service providers not brokered", func(t *testing.T) {
+		before := exchanges
+		var stored *api.Token
+		data, recheckAfter, err := reconciler(&stored).reconcileBrokeredToken(context.TODO(), token("alois"), quay, nil)
+		assert.NoError(t, err)
+		assert.Nil(t, data)
+		assert.Zero(t, recheckAfter)
+		assert.Equal(t, before, exchanges)
+	})
+}
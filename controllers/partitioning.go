@@ -0,0 +1,170 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/inject"
+)
+
+// defaultPartition is the partition of the objects that don't belong to any known service provider and of the objects
+// that are already gone from the cluster.
+const defaultPartition config.ServiceProviderType = ""
+
+// providerPartitioner splits the reconciliation of the objects into one controller per service provider type, each
+// with its own work queue, rate limiter and workers, so that the objects of a service provider that is down or rate
+// limits the operator don't delay the objects of the other service providers.
+type providerPartitioner struct {
+	factory *serviceprovider.Factory
+	reader  client.Reader
+	// prototype is used to read the reconciled objects to find their partition
+	prototype client.Object
+	// url returns the URL of the object that determines its service provider
+	url func(client.Object) string
+}
+
+// partitions returns the partitions, i.e. the known service provider types followed by the defaultPartition.
+func (p *providerPartitioner) partitions() []config.ServiceProviderType {
+	ret := make([]config.ServiceProviderType, 0, len(p.factory.Initializers)+1)
+	for spType := range p.factory.Initializers {
+		ret = append(ret, spType)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i] < ret[j]
+	})
+	return append(ret, defaultPartition)
+}
+
+// controllerName returns the name of the controller of the partition. The controller of the defaultPartition keeps
+// the name the controller had before the partitioning.
+func (p *providerPartitioner) controllerName(base string, partition config.ServiceProviderType) string {
+	if partition == defaultPartition {
+		return base
+	}
+	return base + "-" + strings.ToLower(string(partition))
+}
+
+// partitionOf returns the partition the object belongs to.
+func (p *providerPartitioner) partitionOf(obj client.Object) config.ServiceProviderType {
+	spType := p.factory.TypeFromUrl(p.url(obj))
+	if _, ok := p.factory.Initializers[spType]; !ok {
+		return defaultPartition
+	}
+	return spType
+}
+
+// accepts returns true if the object of the request belongs to the partition. The object is read from the cache.
+// The objects that cannot be read are left to the defaultPartition.
+func (p *providerPartitioner) accepts(partition config.ServiceProviderType, req reconcile.Request) bool {
+	obj := p.prototype.DeepCopyObject().(client.Object)
+	if err := p.reader.Get(context.TODO(), req.NamespacedName, obj); err != nil {
+		return partition == defaultPartition
+	}
+	return p.partitionOf(obj) == partition
+}
+
+// predicate returns the predicate passing the events of the reconciled objects belonging to the partition. It is meant
+// for the primary watch of the controller, the other watches need to be wrapped using handler.
+func (p *providerPartitioner) predicate(partition config.ServiceProviderType) predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return p.partitionOf(obj) == partition
+	})
+}
+
+// handler wraps the event handler so that it only enqueues the requests of the objects belonging to the partition.
+func (p *providerPartitioner) handler(partition config.ServiceProviderType, delegate handler.EventHandler) handler.EventHandler {
+	return &partitionedHandler{
+		delegate: delegate,
+		accepts: func(req reconcile.Request) bool {
+			return p.accepts(partition, req)
+		},
+	}
+}
+
+// partitionedHandler is the event handler enqueueing only the requests accepted by the partition.
+type partitionedHandler struct {
+	delegate handler.EventHandler
+	accepts  func(reconcile.Request) bool
+}
+
+var _ handler.EventHandler = (*partitionedHandler)(nil)
+var _ inject.Injector = (*partitionedHandler)(nil)
+
+func (h *partitionedHandler) Create(e event.CreateEvent, q workqueue.RateLimitingInterface) {
+	h.delegate.Create(e, h.queue(q))
+}
+
+func (h *partitionedHandler) Update(e event.UpdateEvent, q workqueue.RateLimitingInterface) {
+	h.delegate.Update(e, h.queue(q))
+}
+
+func (h *partitionedHandler) Delete(e event.DeleteEvent, q workqueue.RateLimitingInterface) {
+	h.delegate.Delete(e, h.queue(q))
+}
+
+func (h *partitionedHandler) Generic(e event.GenericEvent, q workqueue.RateLimitingInterface) {
+	h.delegate.Generic(e, h.queue(q))
+}
+
+// InjectFunc passes the dependencies, like the scheme and the REST mapper needed by the
+// handler.EnqueueRequestForOwner, to the wrapped handler.
+func (h *partitionedHandler) InjectFunc(f inject.Func) error {
+	return f(h.delegate)
+}
+
+func (h *partitionedHandler) queue(q workqueue.RateLimitingInterface) workqueue.RateLimitingInterface {
+	return &partitionedQueue{RateLimitingInterface: q, accepts: h.accepts}
+}
+
+// partitionedQueue drops the requests not accepted by the partition instead of adding them to the wrapped queue.
+type partitionedQueue struct {
+	workqueue.RateLimitingInterface
+	accepts func(reconcile.Request) bool
+}
+
+func (q *partitionedQueue) Add(item interface{}) {
+	if q.accepted(item) {
+		q.RateLimitingInterface.Add(item)
+	}
+}
+
+func (q *partitionedQueue) AddAfter(item interface{}, duration time.Duration) {
+	if q.accepted(item) {
+		q.RateLimitingInterface.AddAfter(item, duration)
+	}
+}
+
+func (q *partitionedQueue) AddRateLimited(item interface{}) {
+	if q.accepted(item) {
+		q.RateLimitingInterface.AddRateLimited(item)
+	}
+}
+
+func (q *partitionedQueue) accepted(item interface{}) bool {
+	req, ok := item.(reconcile.Request)
+	return !ok || q.accepts(req)
+}
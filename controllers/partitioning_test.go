@@ -0,0 +1,121 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func prefixProbe(prefix string) serviceprovider.Probe {
+	return serviceprovider.ProbeFunc(func(_ *http.Client, url string) (string, error) {
+		if strings.HasPrefix(url, prefix) {
+			return prefix, nil
+		}
+		return "", nil
+	})
+}
+
+func testPartitioner(objs ...client.Object) *providerPartitioner {
+	sch := runtime.NewScheme()
+	_ = api.AddToScheme(sch)
+
+	return &providerPartitioner{
+		factory: &serviceprovider.Factory{
+			Configuration: config.NewLiveConfiguration(config.Configuration{}),
+			Initializers: map[config.ServiceProviderType]serviceprovider.Initializer{
+				config.ServiceProviderTypeQuay:   {Probe: prefixProbe("https://quay.io")},
+				config.ServiceProviderTypeGitHub: {Probe: prefixProbe("https://github.com")},
+			},
+		},
+		reader:    fake.NewClientBuilder().WithScheme(sch).WithObjects(objs...).Build(),
+		prototype: &api.SPIAccessToken{},
+		url: func(o client.Object) string {
+			return o.(*api.SPIAccessToken).Spec.ServiceProviderUrl
+		},
+	}
+}
+
+func partitionedTestToken(name string, url string) *api.SPIAccessToken {
+	return &api.SPIAccessToken{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns"},
+		Spec:       api.SPIAccessTokenSpec{ServiceProviderUrl: url},
+	}
+}
+
+func TestProviderPartitioner_Partitions(t *testing.T) {
+	p := testPartitioner()
+
+	assert.Equal(t, []config.ServiceProviderType{config.ServiceProviderTypeGitHub, config.ServiceProviderTypeQuay, defaultPartition}, p.partitions())
+	assert.Equal(t, "spiaccesstoken-github", p.controllerName("spiaccesstoken", config.ServiceProviderTypeGitHub))
+	assert.Equal(t, "spiaccesstoken", p.controllerName("spiaccesstoken", defaultPartition))
+}
+
+func TestProviderPartitioner_Predicate(t *testing.T) {
+	p := testPartitioner()
+	quay := p.predicate(config.ServiceProviderTypeQuay)
+	def := p.predicate(defaultPartition)
+
+	assert.True(t, quay.Create(event.CreateEvent{Object: partitionedTestToken("t", "https://quay.io")}))
+	assert.False(t, quay.Create(event.CreateEvent{Object: partitionedTestToken("t", "https://github.com")}))
+	assert.False(t, def.Create(event.CreateEvent{Object: partitionedTestToken("t", "https://quay.io")}))
+	assert.True(t, def.Create(event.CreateEvent{Object: partitionedTestToken("t", "https://unknown.com")}))
+}
+
+func TestProviderPartitioner_Handler(t *testing.T) {
+	p := testPartitioner(partitionedTestToken("quay", "https://quay.io"), partitionedTestToken("github", "https://github.com"))
+
+	requests := handler.EnqueueRequestsFromMapFunc(func(client.Object) []reconcile.Request {
+		return []reconcile.Request{
+			{NamespacedName: types.NamespacedName{Name: "quay", Namespace: "ns"}},
+			{NamespacedName: types.NamespacedName{Name: "github", Namespace: "ns"}},
+			{NamespacedName: types.NamespacedName{Name: "missing", Namespace: "ns"}},
+		}
+	})
+
+	enqueued := func(partition config.ServiceProviderType) []string {
+		q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+		defer q.ShutDown()
+
+		p.handler(partition, requests).Generic(event.GenericEvent{Object: partitionedTestToken("any", "")}, q)
+
+		names := []string{}
+		for q.Len() > 0 {
+			item, _ := q.Get()
+			names = append(names, item.(reconcile.Request).Name)
+			q.Done(item)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"quay"}, enqueued(config.ServiceProviderTypeQuay))
+	assert.Equal(t, []string{"github"}, enqueued(config.ServiceProviderTypeGitHub))
+	assert.Equal(t, []string{"missing"}, enqueued(defaultPartition))
+}
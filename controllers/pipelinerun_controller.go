@@ -0,0 +1,312 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+)
+
+const (
+	// PipelineRunRepoUrlAnnotation is the annotation on Tekton PipelineRuns that requests a secret with the credentials
+	// for the repository with the URL in the annotation value.
+	PipelineRunRepoUrlAnnotation = "spi.appstudio.redhat.com/repo-url"
+	// PipelineRunSecretParamAnnotation is the annotation on Tekton PipelineRuns specifying the name of the parameter
+	// to put the name of the secret with the credentials to. If not specified, DefaultPipelineRunSecretParam is used.
+	PipelineRunSecretParamAnnotation = "spi.appstudio.redhat.com/secret-param"
+	// PipelineRunSecretWorkspaceAnnotation is the annotation on Tekton PipelineRuns specifying the name of
+	// the workspace to bind the secret with the credentials to. If not specified, no workspace is bound.
+	PipelineRunSecretWorkspaceAnnotation = "spi.appstudio.redhat.com/secret-workspace"
+	// PipelineRunSecretTypeAnnotation is the annotation on Tekton PipelineRuns specifying the type of the secret with
+	// the credentials, e.g. kubernetes.io/ssh-auth. If not specified, the secret is of the kubernetes.io/basic-auth type.
+	// It is only read when the binding of the run is created.
+	PipelineRunSecretTypeAnnotation = "spi.appstudio.redhat.com/secret-type"
+	// DefaultPipelineRunSecretParam is the name of the parameter of the PipelineRun that receives the name of the secret
+	// with the credentials if the PipelineRunSecretParamAnnotation is not specified.
+	DefaultPipelineRunSecretParam = "spi-secret-name"
+
+	// pipelineRunLabel is the label on the bindings created for the PipelineRuns. Its value is the name of the run.
+	pipelineRunLabel = "spi.appstudio.redhat.com/pipelinerun"
+
+	pipelineRunPendingStatus = "PipelineRunPending"
+)
+
+var pipelineRunGVK = schema.GroupVersionKind{
+	Group:   "tekton.dev",
+	Version: "v1beta1",
+	Kind:    "PipelineRun",
+}
+
+// PipelineRunReconciler provides the credentials to the Tekton PipelineRuns annotated with the
+// PipelineRunRepoUrlAnnotation. It creates an SPIAccessTokenBinding for each such run, waits for the binding to
+// inject the secret with the credentials and then passes the name of the secret to the run as a parameter and
+// optionally also binds it to a workspace. The binding is deleted once the run finishes.
+//
+// The runs need to be created in the pending state so that they don't start before the credentials are injected,
+// because Tekton rejects the changes of the spec of the started runs. This reconciler starts the pending runs once it
+// injects the secret and leaves the runs that are not pending untouched.
+//
+// Tekton PipelineRuns are handled as unstructured objects so that the operator doesn't depend on Tekton.
+type PipelineRunReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+//+kubebuilder:rbac:groups=tekton.dev,resources=pipelineruns,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spiaccesstokenbindings,verbs=get;list;watch;create;update;patch;delete
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *PipelineRunReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(newPipelineRun(), builder.WithPredicates(predicate.NewPredicateFuncs(func(o client.Object) bool {
+			return o.GetAnnotations()[PipelineRunRepoUrlAnnotation] != ""
+		}))).
+		Owns(&api.SPIAccessTokenBinding{}).
+		Complete(monitored(mgr, "PipelineRun", newPipelineRun(), r))
+}
+
+func (r *PipelineRunReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	lg := log.FromContext(ctx)
+
+	run := newPipelineRun()
+	if err := r.Get(ctx, req.NamespacedName, run); err != nil {
+		if errors.IsNotFound(err) {
+			lg.Info("object not found")
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, NewReconcileError(err, "failed to load the PipelineRun from the cluster")
+	}
+
+	repoUrl := run.GetAnnotations()[PipelineRunRepoUrlAnnotation]
+	if repoUrl == "" || run.GetDeletionTimestamp() != nil {
+		return ctrl.Result{}, nil
+	}
+
+	binding, err := r.findBinding(ctx, run)
+	if err != nil {
+		return ctrl.Result{}, NewReconcileError(err, "failed to find the binding of the PipelineRun")
+	}
+
+	if isPipelineRunFinished(run) {
+		if binding != nil {
+			lg.Info("PipelineRun finished, deleting its binding", "binding", binding.Name)
+			if err := r.Delete(ctx, binding); err != nil && !errors.IsNotFound(err) {
+				return ctrl.Result{}, NewReconcileError(err, "failed to delete the binding of the finished PipelineRun")
+			}
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if !isPipelineRunPending(run) {
+		// either the secret has been injected already or the run was not created pending and it's too late to do it
+		return ctrl.Result{}, nil
+	}
+
+	if binding == nil {
+		secretType := corev1.SecretType(run.GetAnnotations()[PipelineRunSecretTypeAnnotation])
+		if secretType == "" {
+			secretType = corev1.SecretTypeBasicAuth
+		}
+
+		binding = &api.SPIAccessTokenBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				GenerateName: run.GetName() + "-",
+				Namespace:    run.GetNamespace(),
+				Labels: map[string]string{
+					pipelineRunLabel: run.GetName(),
+				},
+			},
+			Spec: api.SPIAccessTokenBindingSpec{
+				RepoUrl: repoUrl,
+				Permissions: api.Permissions{
+					Required: []api.Permission{
+						{
+							Type: api.PermissionTypeRead,
+							Area: api.PermissionAreaRepository,
+						},
+					},
+				},
+				Secret: api.SecretSpec{
+					Type: secretType,
+				},
+			},
+		}
+
+		if err := controllerutil.SetControllerReference(run, binding, r.Scheme); err != nil {
+			return ctrl.Result{}, NewReconcileError(err, "failed to set the owner of the binding")
+		}
+
+		if err := r.Create(ctx, binding); err != nil {
+			return ctrl.Result{}, NewReconcileError(err, "failed to create the binding for the PipelineRun")
+		}
+
+		lg.Info("created binding for the PipelineRun", "binding", binding.Name)
+
+		// we're going to be reconciled again once the binding injects the secret
+		return ctrl.Result{}, nil
+	}
+
+	secretName := binding.Status.SyncedObjectRef.Name
+	if binding.Status.Phase != api.SPIAccessTokenBindingPhaseInjected || secretName == "" {
+		lg.Info("waiting for the binding to inject the secret", "binding", binding.Name)
+		return ctrl.Result{}, nil
+	}
+
+	changed, err := injectSecretToPipelineRun(run, secretName)
+	if err != nil {
+		return ctrl.Result{}, NewReconcileError(err, "failed to inject the secret to the PipelineRun")
+	}
+
+	if changed {
+		if err := r.Update(ctx, run); err != nil {
+			return ctrl.Result{}, NewReconcileError(err, "failed to update the PipelineRun with the secret")
+		}
+		lg.Info("injected the secret to the PipelineRun", "secret", secretName)
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// findBinding finds the binding created for the provided run or returns nil if there is none.
+func (r *PipelineRunReconciler) findBinding(ctx context.Context, run *unstructured.Unstructured) (*api.SPIAccessTokenBinding, error) {
+	bindings := &api.SPIAccessTokenBindingList{}
+	if err := r.List(ctx, bindings, client.InNamespace(run.GetNamespace()), client.MatchingLabels{pipelineRunLabel: run.GetName()}); err != nil {
+		return nil, err
+	}
+
+	for i := range bindings.Items {
+		if metav1.IsControlledBy(&bindings.Items[i], run) {
+			return &bindings.Items[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+func newPipelineRun() *unstructured.Unstructured {
+	run := &unstructured.Unstructured{}
+	run.SetGroupVersionKind(pipelineRunGVK)
+	return run
+}
+
+// isPipelineRunPending returns true if the run is in the pending state and therefore has not started yet.
+func isPipelineRunPending(run *unstructured.Unstructured) bool {
+	status, _, _ := unstructured.NestedString(run.Object, "spec", "status")
+	return status == pipelineRunPendingStatus
+}
+
+// isPipelineRunFinished returns true if the run either completed or its "Succeeded" condition is no longer unknown.
+func isPipelineRunFinished(run *unstructured.Unstructured) bool {
+	if completionTime, _, _ := unstructured.NestedString(run.Object, "status", "completionTime"); completionTime != "" {
+		return true
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(run.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if cond["type"] == "Succeeded" && (cond["status"] == string(metav1.ConditionTrue) || cond["status"] == string(metav1.ConditionFalse)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// injectSecretToPipelineRun sets the parameter (and the workspace, if requested) of the run to the secret with
+// the provided name and starts the run if it is pending. Returns true if the run was modified.
+func injectSecretToPipelineRun(run *unstructured.Unstructured, secretName string) (bool, error) {
+	changed := false
+
+	paramName := run.GetAnnotations()[PipelineRunSecretParamAnnotation]
+	if paramName == "" {
+		paramName = DefaultPipelineRunSecretParam
+	}
+
+	paramChanged, err := setNamedEntry(run, []string{"spec", "params"}, paramName, map[string]interface{}{
+		"name":  paramName,
+		"value": secretName,
+	})
+	if err != nil {
+		return false, err
+	}
+	changed = changed || paramChanged
+
+	if workspaceName := run.GetAnnotations()[PipelineRunSecretWorkspaceAnnotation]; workspaceName != "" {
+		workspaceChanged, err := setNamedEntry(run, []string{"spec", "workspaces"}, workspaceName, map[string]interface{}{
+			"name": workspaceName,
+			"secret": map[string]interface{}{
+				"secretName": secretName,
+			},
+		})
+		if err != nil {
+			return false, err
+		}
+		changed = changed || workspaceChanged
+	}
+
+	if status, _, _ := unstructured.NestedString(run.Object, "spec", "status"); status == pipelineRunPendingStatus {
+		unstructured.RemoveNestedField(run.Object, "spec", "status")
+		changed = true
+	}
+
+	return changed, nil
+}
+
+// setNamedEntry replaces the entry with the provided name in the list on the provided path in the object with the
+// provided entry or appends the entry to the list if no such entry exists. Returns true if the object was modified.
+func setNamedEntry(obj *unstructured.Unstructured, path []string, name string, entry map[string]interface{}) (bool, error) {
+	list, _, err := unstructured.NestedSlice(obj.Object, path...)
+	if err != nil {
+		return false, err
+	}
+
+	found := false
+	for i, e := range list {
+		existing, ok := e.(map[string]interface{})
+		if !ok || existing["name"] != name {
+			continue
+		}
+		if equality.Semantic.DeepEqual(existing, entry) {
+			return false, nil
+		}
+		list[i] = entry
+		found = true
+		break
+	}
+
+	if !found {
+		list = append(list, entry)
+	}
+
+	return true, unstructured.SetNestedSlice(obj.Object, list, path...)
+}
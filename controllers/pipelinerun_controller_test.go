@@ -0,0 +1,194 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func pipelineRun(annotations map[string]string) *unstructured.Unstructured {
+	run := newPipelineRun()
+	run.SetName("run")
+	run.SetNamespace("default")
+	run.SetUID("run-uid")
+	run.SetAnnotations(annotations)
+	_ = unstructured.SetNestedField(run.Object, pipelineRunPendingStatus, "spec", "status")
+	return run
+}
+
+func TestPipelineRunReconciler(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, api.AddToScheme(sch))
+
+	cl := fake.NewClientBuilder().WithScheme(sch).WithObjects(pipelineRun(map[string]string{
+		PipelineRunRepoUrlAnnotation: "https://github.com/acme/repo",
+	})).Build()
+
+	r := &PipelineRunReconciler{Client: cl, Scheme: sch}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "run", Namespace: "default"}}
+
+	getBindings := func() []api.SPIAccessTokenBinding {
+		bindings := &api.SPIAccessTokenBindingList{}
+		assert.NoError(t, cl.List(context.TODO(), bindings))
+		return bindings.Items
+	}
+
+	getRun := func() *unstructured.Unstructured {
+		run := newPipelineRun()
+		assert.NoError(t, cl.Get(context.TODO(), req.NamespacedName, run))
+		return run
+	}
+
+	t.Run("creates binding", func(t *testing.T) {
+		_, err := r.Reconcile(context.TODO(), req)
+		assert.NoError(t, err)
+
+		bindings := getBindings()
+		assert.Len(t, bindings, 1)
+		assert.Equal(t, "https://github.com/acme/repo", bindings[0].Spec.RepoUrl)
+		assert.Equal(t, "run", bindings[0].Labels[pipelineRunLabel])
+		assert.Equal(t, types.UID("run-uid"), bindings[0].OwnerReferences[0].UID)
+	})
+
+	t.Run("waits for the secret", func(t *testing.T) {
+		_, err := r.Reconcile(context.TODO(), req)
+		assert.NoError(t, err)
+
+		assert.Len(t, getBindings(), 1)
+		status, _, _ := unstructured.NestedString(getRun().Object, "spec", "status")
+		assert.Equal(t, pipelineRunPendingStatus, status)
+	})
+
+	t.Run("injects the secret and starts the run", func(t *testing.T) {
+		binding := getBindings()[0]
+		binding.Status.Phase = api.SPIAccessTokenBindingPhaseInjected
+		binding.Status.SyncedObjectRef.Name = "secret"
+		assert.NoError(t, cl.Status().Update(context.TODO(), &binding))
+
+		_, err := r.Reconcile(context.TODO(), req)
+		assert.NoError(t, err)
+
+		run := getRun()
+		params, _, _ := unstructured.NestedSlice(run.Object, "spec", "params")
+		assert.Equal(t, []interface{}{map[string]interface{}{"name": DefaultPipelineRunSecretParam, "value": "secret"}}, params)
+		_, found, _ := unstructured.NestedString(run.Object, "spec", "status")
+		assert.False(t, found)
+	})
+
+	t.Run("leaves the started run untouched", func(t *testing.T) {
+		binding := getBindings()[0]
+		binding.Status.SyncedObjectRef.Name = "other-secret"
+		assert.NoError(t, cl.Status().Update(context.TODO(), &binding))
+
+		_, err := r.Reconcile(context.TODO(), req)
+		assert.NoError(t, err)
+
+		params, _, _ := unstructured.NestedSlice(getRun().Object, "spec", "params")
+		assert.Equal(t, []interface{}{map[string]interface{}{"name": DefaultPipelineRunSecretParam, "value": "secret"}}, params)
+	})
+
+	t.Run("deletes the binding when the run finishes", func(t *testing.T) {
+		run := getRun()
+		assert.NoError(t, unstructured.SetNestedField(run.Object, "2022-01-01T00:00:00Z", "status", "completionTime"))
+		assert.NoError(t, cl.Update(context.TODO(), run))
+
+		_, err := r.Reconcile(context.TODO(), req)
+		assert.NoError(t, err)
+
+		assert.Empty(t, getBindings())
+	})
+}
+
+func TestPipelineRunReconcilerSecretType(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, api.AddToScheme(sch))
+
+	started := pipelineRun(map[string]string{PipelineRunRepoUrlAnnotation: "https://github.com/acme/repo"})
+	started.SetName("started")
+	unstructured.RemoveNestedField(started.Object, "spec", "status")
+
+	cl := fake.NewClientBuilder().WithScheme(sch).WithObjects(pipelineRun(map[string]string{
+		PipelineRunRepoUrlAnnotation:    "https://github.com/acme/repo",
+		PipelineRunSecretTypeAnnotation: string(corev1.SecretTypeSSHAuth),
+	}), started).Build()
+	r := &PipelineRunReconciler{Client: cl, Scheme: sch}
+
+	_, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "run", Namespace: "default"}})
+	assert.NoError(t, err)
+	_, err = r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "started", Namespace: "default"}})
+	assert.NoError(t, err)
+
+	// no binding is created for the run that was not created pending
+	bindings := &api.SPIAccessTokenBindingList{}
+	assert.NoError(t, cl.List(context.TODO(), bindings))
+	assert.Len(t, bindings.Items, 1)
+	assert.Equal(t, corev1.SecretTypeSSHAuth, bindings.Items[0].Spec.Secret.Type)
+}
+
+func TestInjectSecretToPipelineRun(t *testing.T) {
+	run := pipelineRun(map[string]string{
+		PipelineRunRepoUrlAnnotation:         "https://github.com/acme/repo",
+		PipelineRunSecretParamAnnotation:     "git-secret",
+		PipelineRunSecretWorkspaceAnnotation: "git-auth",
+	})
+	assert.NoError(t, unstructured.SetNestedSlice(run.Object, []interface{}{
+		map[string]interface{}{"name": "other", "value": "value"},
+		map[string]interface{}{"name": "git-secret", "value": "old"},
+	}, "spec", "params"))
+
+	changed, err := injectSecretToPipelineRun(run, "secret")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+
+	params, _, _ := unstructured.NestedSlice(run.Object, "spec", "params")
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "other", "value": "value"},
+		map[string]interface{}{"name": "git-secret", "value": "secret"},
+	}, params)
+
+	workspaces, _, _ := unstructured.NestedSlice(run.Object, "spec", "workspaces")
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "git-auth", "secret": map[string]interface{}{"secretName": "secret"}},
+	}, workspaces)
+
+	changed, err = injectSecretToPipelineRun(run, "secret")
+	assert.NoError(t, err)
+	assert.False(t, changed)
+}
+
+func TestIsPipelineRunFinished(t *testing.T) {
+	run := pipelineRun(nil)
+	assert.False(t, isPipelineRunFinished(run))
+
+	assert.NoError(t, unstructured.SetNestedSlice(run.Object, []interface{}{
+		map[string]interface{}{"type": "Succeeded", "status": "Unknown"},
+	}, "status", "conditions"))
+	assert.False(t, isPipelineRunFinished(run))
+
+	assert.NoError(t, unstructured.SetNestedSlice(run.Object, []interface{}{
+		map[string]interface{}{"type": "Succeeded", "status": "False"},
+	}, "status", "conditions"))
+	assert.True(t, isPipelineRunFinished(run))
+}
@@ -0,0 +1,95 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// RateLimitStatusReporter periodically writes the rate limits of the OAuth applications observed by the service
+// providers into the config map configured using rateLimitStatusConfigMap so that they can be inspected without
+// access to the metrics. Nothing is written if the config map is not configured.
+type RateLimitStatusReporter struct {
+	Client        client.Client
+	Configuration *config.LiveConfiguration
+	RateLimits    *serviceprovider.RateLimitTracker
+	// Interval is the interval in which the config map is updated.
+	Interval time.Duration
+}
+
+// rateLimitStatus is the representation of a rate limit in the status config map.
+type rateLimitStatus struct {
+	Remaining int         `json:"remaining"`
+	Reset     metav1.Time `json:"reset"`
+}
+
+// Start updates the status config map until the provided context is done.
+func (r *RateLimitStatusReporter) Start(ctx context.Context) error {
+	lg := log.FromContext(ctx)
+
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := r.report(ctx); err != nil {
+				lg.Error(err, "failed to update the rate limit status config map")
+			}
+		}
+	}
+}
+
+func (r *RateLimitStatusReporter) report(ctx context.Context) error {
+	cmRef := r.Configuration.Get().RateLimitStatusConfigMap
+	if cmRef == "" {
+		return nil
+	}
+
+	data := map[string]string{}
+	for key, limit := range r.RateLimits.List() {
+		status, err := json.Marshal(rateLimitStatus{Remaining: limit.Remaining, Reset: metav1.NewTime(limit.Reset)})
+		if err != nil {
+			return fmt.Errorf("failed to serialize the rate limit: %w", err)
+		}
+		data[rateLimitStatusKey(key)] = string(status)
+	}
+
+	return writeStatusConfigMap(ctx, r.Client, cmRef, data)
+}
+
+// rateLimitStatusKey returns the key in the status config map under which the rate limit is stored. That is
+// "<sp type>.<client id>" followed by ".<api>.<credentials>" if the rate limit applies to some credentials or API.
+func rateLimitStatusKey(key serviceprovider.RateLimitKey) string {
+	ret := string(key.ServiceProviderType)
+	if key.ClientId != "" || key.Api != "" || key.Credentials != "" {
+		ret += "." + key.ClientId
+	}
+	if key.Api != "" || key.Credentials != "" {
+		ret += "." + key.Api + "." + key.Credentials
+	}
+	return ret
+}
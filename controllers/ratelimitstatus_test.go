@@ -0,0 +1,73 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRateLimitStatusReporter_Report(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, corev1.AddToScheme(sch))
+
+	tracker := &serviceprovider.RateLimitTracker{}
+	tracker.Observe(serviceprovider.RateLimitKey{ServiceProviderType: api.ServiceProviderTypeGitHub, ClientId: "clientId"}, &http.Response{Header: http.Header{
+		"X-Ratelimit-Remaining": []string{"42"},
+		"X-Ratelimit-Reset":     []string{"1700000000"},
+	}})
+
+	t.Run("not configured", func(t *testing.T) {
+		cl := fake.NewClientBuilder().WithScheme(sch).Build()
+		r := &RateLimitStatusReporter{Client: cl, Configuration: config.NewLiveConfiguration(config.Configuration{}), RateLimits: tracker, Interval: time.Minute}
+
+		assert.NoError(t, r.report(context.TODO()))
+
+		cms := &corev1.ConfigMapList{}
+		assert.NoError(t, cl.List(context.TODO(), cms))
+		assert.Empty(t, cms.Items)
+	})
+
+	t.Run("configured", func(t *testing.T) {
+		cl := fake.NewClientBuilder().WithScheme(sch).Build()
+		r := &RateLimitStatusReporter{Client: cl, Configuration: config.NewLiveConfiguration(config.Configuration{RateLimitStatusConfigMap: "spi-system/spi-rate-limits"}), RateLimits: tracker, Interval: time.Minute}
+
+		assert.NoError(t, r.report(context.TODO()))
+		// the second report updates the existing config map
+		assert.NoError(t, r.report(context.TODO()))
+
+		cm := &corev1.ConfigMap{}
+		assert.NoError(t, cl.Get(context.TODO(), client.ObjectKey{Name: "spi-rate-limits", Namespace: "spi-system"}, cm))
+		assert.JSONEq(t, `{"remaining": 42, "reset": "`+time.Unix(1700000000, 0).UTC().Format(time.RFC3339)+`"}`, cm.Data["GitHub.clientId"])
+	})
+}
+
+func TestRateLimitStatusKey(t *testing.T) {
+	assert.Equal(t, "GitHub", rateLimitStatusKey(serviceprovider.RateLimitKey{ServiceProviderType: api.ServiceProviderTypeGitHub}))
+	assert.Equal(t, "GitHub.clientId", rateLimitStatusKey(serviceprovider.RateLimitKey{ServiceProviderType: api.ServiceProviderTypeGitHub, ClientId: "clientId"}))
+	assert.Equal(t, "GitHub.clientId.core.abcd", rateLimitStatusKey(serviceprovider.RateLimitKey{ServiceProviderType: api.ServiceProviderTypeGitHub, ClientId: "clientId", Api: "core", Credentials: "abcd"}))
+	assert.Equal(t, "GitHub..graphql.", rateLimitStatusKey(serviceprovider.RateLimitKey{ServiceProviderType: api.ServiceProviderTypeGitHub, Api: "graphql"}))
+}
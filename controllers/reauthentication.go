@@ -0,0 +1,92 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// missingTokenScopes returns the scopes required by the permissions of the token that the scopes granted to its data
+// don't imply. Only the tokens obtained using the OAuth flow of the service providers able to check the scopes are
+// considered, because only those can be re-authenticated with more scopes.
+func missingTokenScopes(sp serviceprovider.ServiceProvider, at *api.SPIAccessToken, data *api.Token) []string {
+	checker, ok := sp.(serviceprovider.ScopeChecker)
+	if !ok || sp.GetOAuthEndpoint() == "" || data == nil || data.IsBasicAuth() || at.Status.TokenMetadata == nil {
+		return nil
+	}
+
+	return checker.MissingScopes(at, serviceprovider.GetAllScopes(sp.TranslateToScopes, &at.Spec.Permissions))
+}
+
+// setReauthenticationRequired sets the ReauthenticationRequired condition of the token if some of the scopes required
+// by its permissions are missing and removes it otherwise.
+func setReauthenticationRequired(at *api.SPIAccessToken, missing []string) {
+	if len(missing) == 0 {
+		apimeta.RemoveStatusCondition(&at.Status.Conditions, api.SPIAccessTokenConditionReauthenticationRequired)
+		return
+	}
+
+	apimeta.SetStatusCondition(&at.Status.Conditions, metav1.Condition{
+		Type:               api.SPIAccessTokenConditionReauthenticationRequired,
+		Status:             metav1.ConditionTrue,
+		Reason:             api.SPIAccessTokenReauthenticationReasonPermissionsIncreased,
+		Message:            fmt.Sprintf("the permissions of the token require the scopes not granted to the token data: %s", strings.Join(missing, ", ")),
+		ObservedGeneration: at.Generation,
+	})
+}
+
+// reauthenticationRequired returns true if the token has the ReauthenticationRequired condition set.
+func reauthenticationRequired(at *api.SPIAccessToken) bool {
+	return apimeta.IsStatusConditionTrue(at.Status.Conditions, api.SPIAccessTokenConditionReauthenticationRequired)
+}
+
+// refreshMetadataAfterReauthentication forgets the metadata of the token waiting for the re-authentication once new
+// token data are stored, so that the scopes granted to the new data are fetched from the service provider instead of
+// being served from the metadata cache. Returns true if the metadata was forgotten.
+func refreshMetadataAfterReauthentication(at *api.SPIAccessToken, data *api.Token) bool {
+	if !reauthenticationRequired(at) || data == nil || at.Status.TokenMetadata == nil || data.Version == at.Status.DataVersion {
+		return false
+	}
+
+	at.Status.TokenMetadata = nil
+	return true
+}
+
+// reauthenticationScopes returns the scopes to request in the OAuth flow re-authenticating the token. These are
+// the scopes already granted to the token merged with the scopes required by its permissions, so that the new token
+// data doesn't lose any access the users might rely on.
+func reauthenticationScopes(at *api.SPIAccessToken, required []string) []string {
+	if at.Status.TokenMetadata == nil {
+		return required
+	}
+
+	seen := make(map[string]bool, len(required)+len(at.Status.TokenMetadata.Scopes))
+	merged := make([]string, 0, len(required)+len(at.Status.TokenMetadata.Scopes))
+	for _, scopes := range [][]string{at.Status.TokenMetadata.Scopes, required} {
+		for _, s := range scopes {
+			if !seen[s] {
+				seen[s] = true
+				merged = append(merged, s)
+			}
+		}
+	}
+	return merged
+}
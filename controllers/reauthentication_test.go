@@ -0,0 +1,109 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/stretchr/testify/assert"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+)
+
+// scopeCheckingServiceProvider translates the permissions to "area:type" scopes and grants the configured scopes.
+type scopeCheckingServiceProvider struct {
+	serviceprovider.ServiceProvider
+	oauthEndpoint string
+	granted       []string
+}
+
+func (s scopeCheckingServiceProvider) GetOAuthEndpoint() string {
+	return s.oauthEndpoint
+}
+
+func (s scopeCheckingServiceProvider) TranslateToScopes(permission api.Permission) []string {
+	return []string{string(permission.Area) + ":" + string(permission.Type)}
+}
+
+func (s scopeCheckingServiceProvider) MissingScopes(_ *api.SPIAccessToken, required []string) []string {
+	return reducedScopes(required, s.granted)
+}
+
+func TestMissingTokenScopes(t *testing.T) {
+	sp := scopeCheckingServiceProvider{oauthEndpoint: "https://spi/oauth/authenticate", granted: []string{"repository:r"}}
+	at := &api.SPIAccessToken{
+		Spec: api.SPIAccessTokenSpec{Permissions: api.Permissions{Required: []api.Permission{
+			{Type: "r", Area: "repository"},
+			{Type: "w", Area: "repository"},
+		}}},
+		Status: api.SPIAccessTokenStatus{TokenMetadata: &api.TokenMetadata{Scopes: []string{"repository:r"}}},
+	}
+
+	assert.Equal(t, []string{"repository:w"}, missingTokenScopes(sp, at, &api.Token{AccessToken: "token"}))
+	assert.Nil(t, missingTokenScopes(sp, at, nil))
+	assert.Nil(t, missingTokenScopes(sp, at, &api.Token{AccessToken: "pass", TokenType: api.BasicAuthTokenType}))
+	assert.Nil(t, missingTokenScopes(sp.ServiceProvider, at, &api.Token{AccessToken: "token"}))
+
+	sp.oauthEndpoint = ""
+	assert.Nil(t, missingTokenScopes(sp, at, &api.Token{AccessToken: "token"}))
+}
+
+func TestSetReauthenticationRequired(t *testing.T) {
+	at := &api.SPIAccessToken{}
+	at.Generation = 3
+
+	setReauthenticationRequired(at, []string{"repo", "delete_repo"})
+	cond := apimeta.FindStatusCondition(at.Status.Conditions, api.SPIAccessTokenConditionReauthenticationRequired)
+	assert.NotNil(t, cond)
+	assert.True(t, reauthenticationRequired(at))
+	assert.Equal(t, api.SPIAccessTokenReauthenticationReasonPermissionsIncreased, cond.Reason)
+	assert.Contains(t, cond.Message, "repo, delete_repo")
+	assert.Equal(t, int64(3), cond.ObservedGeneration)
+
+	setReauthenticationRequired(at, nil)
+	assert.Empty(t, at.Status.Conditions)
+	assert.False(t, reauthenticationRequired(at))
+}
+
+func TestRefreshMetadataAfterReauthentication(t *testing.T) {
+	token := func() *api.SPIAccessToken {
+		at := &api.SPIAccessToken{Status: api.SPIAccessTokenStatus{DataVersion: 1, TokenMetadata: &api.TokenMetadata{Scopes: []string{"repo"}}}}
+		setReauthenticationRequired(at, []string{"delete_repo"})
+		return at
+	}
+
+	at := token()
+	assert.False(t, refreshMetadataAfterReauthentication(at, &api.Token{Version: 1}))
+	assert.NotNil(t, at.Status.TokenMetadata)
+
+	assert.False(t, refreshMetadataAfterReauthentication(at, nil))
+	assert.NotNil(t, at.Status.TokenMetadata)
+
+	assert.True(t, refreshMetadataAfterReauthentication(at, &api.Token{Version: 2}))
+	assert.Nil(t, at.Status.TokenMetadata)
+
+	at = token()
+	setReauthenticationRequired(at, nil)
+	assert.False(t, refreshMetadataAfterReauthentication(at, &api.Token{Version: 2}))
+	assert.NotNil(t, at.Status.TokenMetadata)
+}
+
+func TestReauthenticationScopes(t *testing.T) {
+	at := &api.SPIAccessToken{Status: api.SPIAccessTokenStatus{TokenMetadata: &api.TokenMetadata{Scopes: []string{"repo", "read:user"}}}}
+
+	assert.Equal(t, []string{"repo", "read:user", "delete_repo"}, reauthenticationScopes(at, []string{"repo", "delete_repo"}))
+	assert.Equal(t, []string{"repo"}, reauthenticationScopes(&api.SPIAccessToken{}, []string{"repo"}))
+}
@@ -0,0 +1,181 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/httptransport"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// HotLoopThreshold is the number of reconciliations of a single object within hotLoopWindow above which the object
+// is reported as hot-looping. 0 disables the detection.
+var HotLoopThreshold = 60
+
+// hotLoopWindow is the period in which the reconciliations of an object are counted by the hot-loop detection.
+const hotLoopWindow = 1 * time.Minute
+
+// reconcileDurationHistogram measures the duration of the reconciliations per controller. Together with
+// the workqueue_queue_duration_seconds histogram of controller-runtime, it is meant for the latency SLOs.
+var reconcileDurationHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "spi_reconcile_duration_seconds",
+	Help:    "The duration of the reconciliations.",
+	Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+}, []string{"controller"})
+
+// hotLoopCounter counts the objects detected as reconciled more than HotLoopThreshold times within hotLoopWindow.
+// The administrators can alert on this to find the objects the operator never stops reconciling.
+var hotLoopCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "spi_reconcile_hot_loops_total",
+	Help: "The number of times an object was reconciled too often within a minute.",
+}, []string{"controller"})
+
+func init() {
+	metrics.Registry.MustRegister(reconcileDurationHistogram, hotLoopCounter)
+}
+
+// reconcileMonitor is a reconciler measuring the duration of the reconciliations of the wrapped reconciler and
+// detecting the objects that are reconciled too often. Once an object exceeds the threshold, the monitor logs
+// the changes of the object between the last two reconciliations to show what keeps triggering them.
+type reconcileMonitor struct {
+	controller string
+	delegate   reconcile.Reconciler
+	reader     client.Reader
+	prototype  client.Object
+	threshold  int
+	now        func() time.Time
+
+	lock       sync.Mutex
+	windows    map[types.NamespacedName]*reconcileWindow
+	lastPruned time.Time
+}
+
+// reconcileWindow holds the reconciliations of a single object within the current hotLoopWindow.
+type reconcileWindow struct {
+	start time.Time
+	count int
+	// last is the snapshot of the object from the previous reconciliation, only kept once the object gets close to
+	// the threshold
+	last client.Object
+}
+
+var _ reconcile.Reconciler = (*reconcileMonitor)(nil)
+
+// monitored wraps the reconciler of the named controller of the objects like the prototype in the reconcileMonitor.
+func monitored(mgr ctrl.Manager, controller string, prototype client.Object, delegate reconcile.Reconciler) reconcile.Reconciler {
+	return &reconcileMonitor{
+		controller: controller,
+		delegate:   delegate,
+		reader:     mgr.GetClient(),
+		prototype:  prototype,
+		threshold:  HotLoopThreshold,
+		now:        time.Now,
+		windows:    map[types.NamespacedName]*reconcileWindow{},
+	}
+}
+
+func (m *reconcileMonitor) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	if m.threshold > 0 {
+		m.detectHotLoop(ctx, req.NamespacedName)
+	}
+
+	start := m.now()
+	defer func() {
+		reconcileDurationHistogram.WithLabelValues(m.controller).Observe(m.now().Sub(start).Seconds())
+	}()
+
+	// the requests to the service providers made during the reconciliation are tagged with the reconciled object
+	ctx = httptransport.WithInitiator(ctx, m.controller+" "+req.NamespacedName.String())
+
+	return m.delegate.Reconcile(ctx, req)
+}
+
+// detectHotLoop counts the reconciliation of the object and reports the object if it exceeds the threshold.
+func (m *reconcileMonitor) detectHotLoop(ctx context.Context, key types.NamespacedName) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	now := m.now()
+	m.prune(now)
+
+	window := m.windows[key]
+	if window == nil || now.Sub(window.start) > hotLoopWindow {
+		window = &reconcileWindow{start: now}
+		m.windows[key] = window
+	}
+	window.count++
+
+	if window.count < m.threshold {
+		return
+	}
+
+	current := m.prototype.DeepCopyObject().(client.Object)
+	if err := m.reader.Get(ctx, key, current); err != nil {
+		// the object is most probably gone and so is the loop
+		current = nil
+	}
+
+	if window.count == m.threshold+1 {
+		lg := log.FromContext(ctx)
+		hotLoopCounter.WithLabelValues(m.controller).Inc()
+		if window.last == nil || current == nil {
+			lg.Info("object reconciled too often", "reconciliations", window.count, "window", hotLoopWindow)
+		} else {
+			lg.Info("object reconciled too often", "reconciliations", window.count, "window", hotLoopWindow,
+				"changes", objectChanges(window.last, current))
+		}
+	}
+
+	window.last = current
+}
+
+// prune forgets the windows of the objects that were not reconciled within the last hotLoopWindow so that
+// the deleted objects are not kept in memory.
+func (m *reconcileMonitor) prune(now time.Time) {
+	if now.Sub(m.lastPruned) < hotLoopWindow {
+		return
+	}
+	m.lastPruned = now
+
+	for key, window := range m.windows {
+		if now.Sub(window.start) > hotLoopWindow {
+			delete(m.windows, key)
+		}
+	}
+}
+
+// objectChanges returns the human-readable difference between the two snapshots of the object ignoring the fields
+// changed by every update.
+func objectChanges(previous, current client.Object) string {
+	diff := cmp.Diff(previous, current,
+		cmpopts.IgnoreFields(metav1.ObjectMeta{}, "ResourceVersion", "ManagedFields"),
+		cmpopts.EquateEmpty())
+	if diff == "" {
+		return "no changes, the reconciliation is requeued"
+	}
+	return diff
+}
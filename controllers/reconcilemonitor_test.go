@@ -0,0 +1,103 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileMonitor(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, corev1.AddToScheme(sch))
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "looping", Namespace: "default"},
+		Data:       map[string]string{"counter": "0"},
+	}
+	cl := fake.NewClientBuilder().WithScheme(sch).WithObjects(cm).Build()
+
+	reconciles := 0
+	now := time.Now()
+	m := &reconcileMonitor{
+		controller: "test-monitor",
+		delegate: reconcile.Func(func(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
+			reconciles++
+			now = now.Add(time.Second)
+			return reconcile.Result{}, nil
+		}),
+		reader:    cl,
+		prototype: &corev1.ConfigMap{},
+		threshold: 3,
+		now:       func() time.Time { return now },
+		windows:   map[types.NamespacedName]*reconcileWindow{},
+	}
+
+	key := client.ObjectKeyFromObject(cm)
+	hotLoops := hotLoopCounter.WithLabelValues("test-monitor")
+	before := testutil.ToFloat64(hotLoops)
+
+	for i := 0; i < 5; i++ {
+		_, err := m.Reconcile(context.TODO(), reconcile.Request{NamespacedName: key})
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, 5, reconciles)
+	// reported only once per window
+	assert.Equal(t, before+1, testutil.ToFloat64(hotLoops))
+	assert.Equal(t, 1, testutil.CollectAndCount(reconcileDurationHistogram, "spi_reconcile_duration_seconds"))
+
+	// the counting starts over in the next window
+	now = now.Add(hotLoopWindow)
+	_, err := m.Reconcile(context.TODO(), reconcile.Request{NamespacedName: key})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, m.windows[key].count)
+	assert.Nil(t, m.windows[key].last)
+
+	// the windows of the objects no longer reconciled are forgotten
+	now = now.Add(2 * hotLoopWindow)
+	_, err = m.Reconcile(context.TODO(), reconcile.Request{NamespacedName: types.NamespacedName{Name: "other", Namespace: "default"}})
+	assert.NoError(t, err)
+	assert.Len(t, m.windows, 1)
+}
+
+func TestObjectChanges(t *testing.T) {
+	previous := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "cm", ResourceVersion: "1"},
+		Data:       map[string]string{"counter": "1"},
+	}
+
+	current := previous.DeepCopy()
+	current.ResourceVersion = "2"
+	assert.Equal(t, "no changes, the reconciliation is requeued", objectChanges(previous, current))
+
+	current.Data["counter"] = "2"
+	changes := objectChanges(previous, current)
+	assert.True(t, strings.Contains(changes, `"counter": "1"`))
+	assert.True(t, strings.Contains(changes, `"counter": "2"`))
+	assert.False(t, strings.Contains(changes, "ResourceVersion"))
+}
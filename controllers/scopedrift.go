@@ -0,0 +1,95 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// startScopeDriftCheck forgets the metadata of the Ready token if it was last refreshed longer than the interval ago,
+// so that the metadata, including the scopes, is fetched again from the service provider. The users can reduce
+// the scopes of their tokens directly in the service provider and we would otherwise not notice until the metadata
+// expires on its own, which never happens for some service providers. Returns true if the check was started.
+func startScopeDriftCheck(at *api.SPIAccessToken, interval time.Duration, now time.Time) bool {
+	if interval <= 0 || at.Status.Phase != api.SPIAccessTokenPhaseReady || at.Status.TokenMetadata == nil {
+		return false
+	}
+
+	if now.Before(time.Unix(at.Status.TokenMetadata.LastRefreshTime, 0).Add(interval)) {
+		return false
+	}
+
+	at.Status.TokenMetadata = nil
+	return true
+}
+
+// nextScopeDriftCheck returns the time after which the scope drift of the token should be checked, or 0 if no check
+// is needed.
+func nextScopeDriftCheck(at *api.SPIAccessToken, interval time.Duration, now time.Time) time.Duration {
+	if interval <= 0 || at.Status.Phase != api.SPIAccessTokenPhaseReady || at.Status.TokenMetadata == nil {
+		return 0
+	}
+
+	if after := time.Unix(at.Status.TokenMetadata.LastRefreshTime, 0).Add(interval).Sub(now); after > 0 {
+		return after
+	}
+	return interval
+}
+
+// reportScopeDrift compares the scopes of the token before and after the refresh of its metadata and reports
+// the reduced scopes, if any. The bindings linked to the token are reconciled because of the change of the token and
+// check that the token still has the permissions they require.
+func reportScopeDrift(ctx context.Context, at *api.SPIAccessToken, spType api.ServiceProviderType, before *api.TokenMetadata) {
+	after := at.Status.TokenMetadata
+	if before == nil || after == nil || before.LastRefreshTime == after.LastRefreshTime {
+		return
+	}
+
+	reduced := reducedScopes(before.Scopes, after.Scopes)
+	if len(reduced) == 0 {
+		return
+	}
+
+	log.FromContext(ctx).Info("the scopes of the token were reduced in the service provider", "reduced_scopes", reduced)
+	tokenScopesReducedCounter.WithLabelValues(string(spType)).Inc()
+}
+
+// reducedScopes returns the scopes in before that are not in after.
+func reducedScopes(before []string, after []string) []string {
+	present := make(map[string]bool, len(after))
+	for _, s := range after {
+		present[s] = true
+	}
+
+	var reduced []string
+	for _, s := range before {
+		if !present[s] {
+			reduced = append(reduced, s)
+		}
+	}
+	return reduced
+}
+
+// earliestRequeue returns the shorter of the two non-zero durations or 0 if both are zero.
+func earliestRequeue(a time.Duration, b time.Duration) time.Duration {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,143 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// typedServiceProvider only implements the methods used by the scope drift check.
+type typedServiceProvider struct {
+	serviceprovider.ServiceProvider
+}
+
+func (p typedServiceProvider) GetType() api.ServiceProviderType {
+	return "Test"
+}
+
+func readyTokenWithMetadata(lastRefresh time.Time, scopes ...string) *api.SPIAccessToken {
+	return &api.SPIAccessToken{
+		Status: api.SPIAccessTokenStatus{
+			Phase: api.SPIAccessTokenPhaseReady,
+			TokenMetadata: &api.TokenMetadata{
+				Scopes:          scopes,
+				LastRefreshTime: lastRefresh.Unix(),
+			},
+		},
+	}
+}
+
+func TestStartScopeDriftCheck(t *testing.T) {
+	now := time.Now()
+
+	t.Run("due", func(t *testing.T) {
+		at := readyTokenWithMetadata(now.Add(-2*time.Hour), "repo")
+		assert.True(t, startScopeDriftCheck(at, time.Hour, now))
+		assert.Nil(t, at.Status.TokenMetadata)
+	})
+
+	t.Run("not due", func(t *testing.T) {
+		at := readyTokenWithMetadata(now.Add(-30*time.Minute), "repo")
+		assert.False(t, startScopeDriftCheck(at, time.Hour, now))
+		assert.NotNil(t, at.Status.TokenMetadata)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		at := readyTokenWithMetadata(now.Add(-2*time.Hour), "repo")
+		assert.False(t, startScopeDriftCheck(at, 0, now))
+		assert.NotNil(t, at.Status.TokenMetadata)
+	})
+
+	t.Run("not ready", func(t *testing.T) {
+		at := readyTokenWithMetadata(now.Add(-2*time.Hour), "repo")
+		at.Status.Phase = api.SPIAccessTokenPhaseInvalid
+		assert.False(t, startScopeDriftCheck(at, time.Hour, now))
+	})
+}
+
+func TestNextScopeDriftCheck(t *testing.T) {
+	// the refresh time is stored in whole seconds
+	now := time.Now().Truncate(time.Second)
+
+	assert.Equal(t, 30*time.Minute, nextScopeDriftCheck(readyTokenWithMetadata(now.Add(-30*time.Minute)), time.Hour, now))
+	assert.Equal(t, time.Hour, nextScopeDriftCheck(readyTokenWithMetadata(now.Add(-2*time.Hour)), time.Hour, now))
+	assert.Zero(t, nextScopeDriftCheck(readyTokenWithMetadata(now), 0, now))
+	assert.Zero(t, nextScopeDriftCheck(&api.SPIAccessToken{Status: api.SPIAccessTokenStatus{Phase: api.SPIAccessTokenPhaseReady}}, time.Hour, now))
+}
+
+func TestReportScopeDrift(t *testing.T) {
+	counter := tokenScopesReducedCounter.WithLabelValues("Test")
+	initial := testutil.ToFloat64(counter)
+	now := time.Now()
+
+	before := readyTokenWithMetadata(now.Add(-time.Hour), "repo", "user").Status.TokenMetadata
+
+	// the metadata was not refreshed
+	reportScopeDrift(context.TODO(), &api.SPIAccessToken{Status: api.SPIAccessTokenStatus{TokenMetadata: before.DeepCopy()}}, "Test", before)
+	assert.Equal(t, initial, testutil.ToFloat64(counter))
+
+	// no scopes were removed
+	reportScopeDrift(context.TODO(), readyTokenWithMetadata(now, "repo", "user", "admin"), "Test", before)
+	assert.Equal(t, initial, testutil.ToFloat64(counter))
+
+	reportScopeDrift(context.TODO(), readyTokenWithMetadata(now, "repo"), "Test", before)
+	assert.Equal(t, initial+1, testutil.ToFloat64(counter))
+}
+
+func TestReducedScopes(t *testing.T) {
+	assert.Equal(t, []string{"b", "c"}, reducedScopes([]string{"a", "b", "c"}, []string{"a", "d"}))
+	assert.Empty(t, reducedScopes([]string{"a"}, []string{"a", "b"}))
+}
+
+func TestEarliestRequeue(t *testing.T) {
+	assert.Equal(t, time.Minute, earliestRequeue(time.Minute, time.Hour))
+	assert.Equal(t, time.Minute, earliestRequeue(time.Hour, time.Minute))
+	assert.Equal(t, time.Hour, earliestRequeue(0, time.Hour))
+	assert.Equal(t, time.Hour, earliestRequeue(time.Hour, 0))
+	assert.Zero(t, earliestRequeue(0, 0))
+}
+
+func TestSyncedTokenLostPermissions(t *testing.T) {
+	matches := true
+	r := &SPIAccessTokenBindingReconciler{
+		ServiceProviderFactory: serviceprovider.Factory{
+			Initializers: map[config.ServiceProviderType]serviceprovider.Initializer{
+				"Test": {
+					OfflineTokenFilter: serviceprovider.TokenFilterFunc(func(_ context.Context, _ serviceprovider.Matchable, _ *api.SPIAccessToken) (bool, error) {
+						return matches, nil
+					}),
+				},
+			},
+		},
+	}
+	sp := typedServiceProvider{}
+	token := readyTokenWithMetadata(time.Now(), "repo")
+	synced := &api.SPIAccessTokenBinding{Status: api.SPIAccessTokenBindingStatus{SyncedObjectRef: api.TargetObjectRef{Name: "secret"}}}
+
+	assert.False(t, r.syncedTokenLostPermissions(context.TODO(), sp, synced, token))
+
+	matches = false
+	assert.True(t, r.syncedTokenLostPermissions(context.TODO(), sp, synced, token))
+	// not synced yet, the binding goes through the usual lookup
+	assert.False(t, r.syncedTokenLostPermissions(context.TODO(), sp, &api.SPIAccessTokenBinding{}, token))
+}
@@ -0,0 +1,100 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// ScopeTranslationLoader periodically loads the scope translations from the config map configured using
+// scopeTranslationConfigMap into the scope translation table. The translations that fail to validate are not loaded
+// and the previously loaded translations stay in effect. The table is cleared if the config map is not configured
+// or doesn't exist.
+type ScopeTranslationLoader struct {
+	Client        client.Client
+	Configuration *config.LiveConfiguration
+	Table         *serviceprovider.ScopeTranslationTable
+	// Interval is the interval in which the config map is re-read.
+	Interval time.Duration
+}
+
+var _ manager.LeaderElectionRunnable = (*ScopeTranslationLoader)(nil)
+
+// Start loads the scope translations until the provided context is done.
+func (l *ScopeTranslationLoader) Start(ctx context.Context) error {
+	lg := log.FromContext(ctx)
+
+	ticker := time.NewTicker(l.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := l.load(ctx); err != nil {
+			lg.Error(err, "failed to load the scope translations, keeping the previous ones")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection returns false, because the translations are also needed by the webhooks running in all replicas.
+func (l *ScopeTranslationLoader) NeedLeaderElection() bool {
+	return false
+}
+
+func (l *ScopeTranslationLoader) load(ctx context.Context) error {
+	cmRef := l.Configuration.Get().ScopeTranslationConfigMap
+	if cmRef == "" {
+		l.Table.Set(nil)
+		return nil
+	}
+
+	parts := strings.Split(cmRef, "/")
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid config map reference '%s'", cmRef)
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := l.Client.Get(ctx, types.NamespacedName{Namespace: parts[0], Name: parts[1]}, cm); err != nil {
+		if errors.IsNotFound(err) {
+			l.Table.Set(nil)
+			return nil
+		}
+		return fmt.Errorf("failed to read the config map %s: %w", cmRef, err)
+	}
+
+	translations, err := serviceprovider.ParseScopeTranslations(cm.Data)
+	if err != nil {
+		return fmt.Errorf("invalid scope translations in the config map %s: %w", cmRef, err)
+	}
+
+	l.Table.Set(translations)
+	return nil
+}
@@ -0,0 +1,91 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestScopeTranslationLoader_Load(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, corev1.AddToScheme(sch))
+
+	read := api.Permission{Area: api.PermissionAreaRepository, Type: api.PermissionTypeRead}
+	builtin := func(api.Permission) []string { return []string{"builtin"} }
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "spi-scopes", Namespace: "spi-system"},
+		Data: map[string]string{
+			"GitHub": "- area: repository\n  scopes: [public_repo]\n",
+		},
+	}
+
+	newLoader := func(cmRef string, objs ...client.Object) *ScopeTranslationLoader {
+		return &ScopeTranslationLoader{
+			Client:        fake.NewClientBuilder().WithScheme(sch).WithObjects(objs...).Build(),
+			Configuration: config.NewLiveConfiguration(config.Configuration{ScopeTranslationConfigMap: cmRef}),
+			Table:         &serviceprovider.ScopeTranslationTable{},
+			Interval:      time.Minute,
+		}
+	}
+
+	t.Run("loads translations", func(t *testing.T) {
+		l := newLoader("spi-system/spi-scopes", cm)
+
+		assert.NoError(t, l.load(context.TODO()))
+		assert.Equal(t, []string{"public_repo"}, l.Table.Translate(api.ServiceProviderTypeGitHub, read, builtin))
+	})
+
+	t.Run("keeps previous translations on invalid config map", func(t *testing.T) {
+		l := newLoader("spi-system/spi-scopes", cm)
+		assert.NoError(t, l.load(context.TODO()))
+
+		invalid := cm.DeepCopy()
+		invalid.Data["GitHub"] = "- area: unknown\n  scopes: [repo]\n"
+		assert.NoError(t, l.Client.Update(context.TODO(), invalid))
+
+		assert.Error(t, l.load(context.TODO()))
+		assert.Equal(t, []string{"public_repo"}, l.Table.Translate(api.ServiceProviderTypeGitHub, read, builtin))
+	})
+
+	t.Run("clears translations on missing config map", func(t *testing.T) {
+		l := newLoader("spi-system/spi-scopes", cm)
+		assert.NoError(t, l.load(context.TODO()))
+
+		assert.NoError(t, l.Client.Delete(context.TODO(), cm.DeepCopy()))
+
+		assert.NoError(t, l.load(context.TODO()))
+		assert.Equal(t, []string{"builtin"}, l.Table.Translate(api.ServiceProviderTypeGitHub, read, builtin))
+	})
+
+	t.Run("not configured", func(t *testing.T) {
+		l := newLoader("", cm)
+
+		assert.NoError(t, l.load(context.TODO()))
+		assert.Equal(t, []string{"builtin"}, l.Table.Translate(api.ServiceProviderTypeGitHub, read, builtin))
+	})
+}
@@ -0,0 +1,162 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// ServiceAccountPullSecretReconciler adds the secrets of the injected bindings with the linked service accounts
+// (see api.SecretSpec.LinkedServiceAccounts) to the image pull secrets of the service accounts matching them, so that
+// also the service accounts created after the binding was injected can pull the images from the registry.
+// The secrets are never removed from the service accounts, the references to the deleted secrets are ignored by
+// Kubernetes.
+type ServiceAccountPullSecretReconciler struct {
+	client.Client
+}
+
+//+kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get;list;watch;patch
+//+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spiaccesstokenbindings,verbs=get;list;watch
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ServiceAccountPullSecretReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("serviceaccountpullsecret").
+		For(&corev1.ServiceAccount{}).
+		Watches(&source.Kind{Type: &api.SPIAccessTokenBinding{}}, handler.EnqueueRequestsFromMapFunc(r.linkedServiceAccounts)).
+		Complete(monitored(mgr, "ServiceAccountPullSecret", &corev1.ServiceAccount{}, r))
+}
+
+func (r *ServiceAccountPullSecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	lg := log.FromContext(ctx)
+
+	sa := &corev1.ServiceAccount{}
+	if err := r.Get(ctx, req.NamespacedName, sa); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, NewReconcileError(err, "failed to read the service account")
+	}
+	if sa.DeletionTimestamp != nil {
+		return ctrl.Result{}, nil
+	}
+
+	bindings := &api.SPIAccessTokenBindingList{}
+	if err := r.List(ctx, bindings, client.InNamespace(sa.Namespace)); err != nil {
+		return ctrl.Result{}, NewReconcileError(err, "failed to list the bindings in the namespace of the service account")
+	}
+
+	patch := client.MergeFrom(sa.DeepCopy())
+	added := []string{}
+	for i := range bindings.Items {
+		binding := &bindings.Items[i]
+		secretName := linkedPullSecret(binding)
+		if secretName == "" || hasPullSecret(sa, secretName) {
+			continue
+		}
+		if matches, err := selectsServiceAccount(binding, sa); err != nil {
+			lg.Info("ignoring the binding with an invalid selector of the linked service accounts", "binding", binding.Name, "error", err.Error())
+			continue
+		} else if !matches {
+			continue
+		}
+		sa.ImagePullSecrets = append(sa.ImagePullSecrets, corev1.LocalObjectReference{Name: secretName})
+		added = append(added, secretName)
+	}
+
+	if len(added) == 0 {
+		return ctrl.Result{}, nil
+	}
+
+	if err := r.Patch(ctx, sa, patch); err != nil {
+		return ctrl.Result{}, NewReconcileError(err, "failed to add the image pull secrets to the service account")
+	}
+	lg.Info("added the image pull secrets to the service account", "secrets", added)
+
+	return ctrl.Result{}, nil
+}
+
+// linkedServiceAccounts maps the binding to the requests of the service accounts its secret should be linked to.
+func (r *ServiceAccountPullSecretReconciler) linkedServiceAccounts(o client.Object) []reconcile.Request {
+	binding, ok := o.(*api.SPIAccessTokenBinding)
+	if !ok || linkedPullSecret(binding) == "" {
+		return []reconcile.Request{}
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(binding.Spec.Secret.LinkedServiceAccounts)
+	if err != nil {
+		return []reconcile.Request{}
+	}
+
+	sas := &corev1.ServiceAccountList{}
+	if err := r.List(context.TODO(), sas, client.InNamespace(binding.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		log.Log.Error(err, "failed to list the service accounts linked to the binding", "binding", client.ObjectKeyFromObject(binding))
+		return []reconcile.Request{}
+	}
+
+	ret := make([]reconcile.Request, 0, len(sas.Items))
+	for _, sa := range sas.Items {
+		ret = append(ret, reconcile.Request{NamespacedName: types.NamespacedName{Name: sa.Name, Namespace: sa.Namespace}})
+	}
+	return ret
+}
+
+// linkedPullSecret returns the name of the secret of the binding that should be linked to the service accounts or
+// an empty string if there's none, e.g. because the binding is not injected yet.
+func linkedPullSecret(binding *api.SPIAccessTokenBinding) string {
+	if binding.Spec.Secret.LinkedServiceAccounts == nil || binding.DeletionTimestamp != nil ||
+		binding.Status.Phase != api.SPIAccessTokenBindingPhaseInjected || binding.Status.SyncedObjectRef.Kind != "Secret" {
+		return ""
+	}
+
+	if secretType := binding.Spec.Secret.Type; secretType != corev1.SecretTypeDockerConfigJson && secretType != corev1.SecretTypeDockercfg {
+		return ""
+	}
+
+	return binding.Status.SyncedObjectRef.Name
+}
+
+// selectsServiceAccount checks whether the service account matches the selector of the linked service accounts of
+// the binding.
+func selectsServiceAccount(binding *api.SPIAccessTokenBinding, sa *corev1.ServiceAccount) (bool, error) {
+	selector, err := metav1.LabelSelectorAsSelector(binding.Spec.Secret.LinkedServiceAccounts)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse the selector: %w", err)
+	}
+	return selector.Matches(labels.Set(sa.Labels)), nil
+}
+
+func hasPullSecret(sa *corev1.ServiceAccount, name string) bool {
+	for _, ref := range sa.ImagePullSecrets {
+		if ref.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func pullSecretTestBinding(name string, selector *metav1.LabelSelector, phase api.SPIAccessTokenBindingPhase) *api.SPIAccessTokenBinding {
+	return &api.SPIAccessTokenBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns"},
+		Spec: api.SPIAccessTokenBindingSpec{
+			Secret: api.SecretSpec{Type: corev1.SecretTypeDockerConfigJson, LinkedServiceAccounts: selector},
+		},
+		Status: api.SPIAccessTokenBindingStatus{
+			Phase:           phase,
+			SyncedObjectRef: api.TargetObjectRef{Name: name + "-secret", Kind: "Secret", ApiVersion: "v1"},
+		},
+	}
+}
+
+func pullSecretTestServiceAccount(name string, lbls map[string]string, pullSecrets ...string) *corev1.ServiceAccount {
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns", Labels: lbls}}
+	for _, s := range pullSecrets {
+		sa.ImagePullSecrets = append(sa.ImagePullSecrets, corev1.LocalObjectReference{Name: s})
+	}
+	return sa
+}
+
+func TestServiceAccountPullSecretReconciler(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, corev1.AddToScheme(sch))
+	assert.NoError(t, api.AddToScheme(sch))
+
+	builders := &metav1.LabelSelector{MatchLabels: map[string]string{"role": "builder"}}
+	unlinked := pullSecretTestBinding("unlinked", nil, api.SPIAccessTokenBindingPhaseInjected)
+	unlinked.Spec.Secret.LinkedServiceAccounts = nil
+
+	cl := fake.NewClientBuilder().WithScheme(sch).WithObjects(
+		pullSecretTestBinding("all", &metav1.LabelSelector{}, api.SPIAccessTokenBindingPhaseInjected),
+		pullSecretTestBinding("builders", builders, api.SPIAccessTokenBindingPhaseInjected),
+		pullSecretTestBinding("waiting", &metav1.LabelSelector{}, api.SPIAccessTokenBindingPhaseAwaitingTokenData),
+		unlinked,
+		pullSecretTestServiceAccount("builder", map[string]string{"role": "builder"}, "all-secret"),
+		pullSecretTestServiceAccount("default", nil, "own"),
+	).Build()
+
+	r := &ServiceAccountPullSecretReconciler{Client: cl}
+
+	pullSecrets := func(name string) []string {
+		_, err := r.Reconcile(context.TODO(), reconcile.Request{NamespacedName: client.ObjectKey{Name: name, Namespace: "ns"}})
+		assert.NoError(t, err)
+
+		sa := &corev1.ServiceAccount{}
+		assert.NoError(t, cl.Get(context.TODO(), client.ObjectKey{Name: name, Namespace: "ns"}, sa))
+		names := []string{}
+		for _, ref := range sa.ImagePullSecrets {
+			names = append(names, ref.Name)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"all-secret", "builders-secret"}, pullSecrets("builder"))
+	assert.Equal(t, []string{"own", "all-secret"}, pullSecrets("default"))
+
+	t.Run("maps the bindings to the linked service accounts", func(t *testing.T) {
+		requests := r.linkedServiceAccounts(pullSecretTestBinding("builders", builders, api.SPIAccessTokenBindingPhaseInjected))
+		assert.Equal(t, []reconcile.Request{{NamespacedName: client.ObjectKey{Name: "builder", Namespace: "ns"}}}, requests)
+
+		assert.Len(t, r.linkedServiceAccounts(pullSecretTestBinding("all", &metav1.LabelSelector{}, api.SPIAccessTokenBindingPhaseInjected)), 2)
+		assert.Empty(t, r.linkedServiceAccounts(pullSecretTestBinding("waiting", &metav1.LabelSelector{}, api.SPIAccessTokenBindingPhaseAwaitingTokenData)))
+		assert.Empty(t, r.linkedServiceAccounts(unlinked))
+	})
+}
+
+func TestLinkedPullSecret(t *testing.T) {
+	binding := pullSecretTestBinding("b", &metav1.LabelSelector{}, api.SPIAccessTokenBindingPhaseInjected)
+	assert.Equal(t, "b-secret", linkedPullSecret(binding))
+
+	binding.Spec.Secret.Type = corev1.SecretTypeBasicAuth
+	assert.Empty(t, linkedPullSecret(binding))
+
+	binding = pullSecretTestBinding("b", &metav1.LabelSelector{}, api.SPIAccessTokenBindingPhaseInjected)
+	binding.Status.SyncedObjectRef.Kind = "SPIAccessTokenBinding"
+	assert.Empty(t, linkedPullSecret(binding))
+}
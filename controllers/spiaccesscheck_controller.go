@@ -38,7 +38,10 @@ type SPIAccessCheckReconciler struct {
 	client.Client
 	Scheme                 *runtime.Scheme
 	ServiceProviderFactory serviceprovider.Factory
-	Configuration          config.Configuration
+	Configuration          *config.LiveConfiguration
+
+	// cache shares the results of the checks of the public repositories.
+	cache accessCheckCache
 }
 
 //+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spiaccesschecks,verbs=get;list;watch;create;update;patch;delete
@@ -57,7 +60,7 @@ func (r *SPIAccessCheckReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		return ctrl.Result{}, NewReconcileError(err, "failed to load the SPIAccessCheck from the cluster")
 	}
 
-	if time.Now().After(ac.ObjectMeta.CreationTimestamp.Add(r.Configuration.AccessCheckTtl)) {
+	if time.Now().After(ac.ObjectMeta.CreationTimestamp.Add(r.Configuration.Get().AccessCheckTtl)) {
 		lg.Info("SPIAccessCheck is after ttl, deleting ...")
 		if deleteError := r.Delete(ctx, &ac); deleteError != nil {
 			return ctrl.Result{Requeue: true}, deleteError
@@ -67,24 +70,32 @@ func (r *SPIAccessCheckReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		}
 	}
 
-	if sp, spErr := r.ServiceProviderFactory.FromRepoUrl(ac.Spec.RepoUrl); spErr == nil {
+	if status, ok := r.cache.get(&ac, time.Now()); ok {
+		lg.Info("using the cached result of the access check of the public repository")
+		ac.Status = *status
+	} else if sp, spErr := r.ServiceProviderFactory.FromRepoUrlInNamespace(ctx, ac.Spec.RepoUrl, ac.Namespace); spErr == nil {
 		if status, repoCheckErr := sp.CheckRepositoryAccess(ctx, r.Client, &ac); repoCheckErr == nil {
 			ac.Status = *status
+			r.cache.put(&ac, status, r.Configuration.Get().AccessCheckCacheTtl, time.Now())
 		} else {
 			lg.Error(repoCheckErr, "failed to check repository access")
 			return ctrl.Result{}, repoCheckErr
 		}
 	} else {
 		lg.Error(spErr, "failed to determine service provider for SPIAccessCheck")
-		ac.Status.ErrorReason = api.SPIAccessCheckErrorUnknownServiceProvider
+		if reportOAuthNotConfigured(spErr) {
+			ac.Status.ErrorReason = api.SPIAccessCheckErrorOAuthNotConfigured
+		} else {
+			ac.Status.ErrorReason = api.SPIAccessCheckErrorUnknownServiceProvider
+		}
 		ac.Status.ErrorMessage = spErr.Error()
 	}
 
-	if updateErr := r.Client.Status().Update(ctx, &ac); updateErr != nil {
+	if updateErr := updateAccessCheckStatusIfChanged(ctx, r.Client, &ac); updateErr != nil {
 		lg.Error(updateErr, "Failed to update status")
 		return ctrl.Result{}, updateErr
 	} else {
-		return ctrl.Result{RequeueAfter: r.Configuration.AccessCheckTtl}, nil
+		return ctrl.Result{RequeueAfter: r.Configuration.Get().AccessCheckTtl}, nil
 	}
 }
 
@@ -92,5 +103,5 @@ func (r *SPIAccessCheckReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 func (r *SPIAccessCheckReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&api.SPIAccessCheck{}).
-		Complete(r)
+		Complete(monitored(mgr, "SPIAccessCheck", &api.SPIAccessCheck{}, r))
 }
@@ -0,0 +1,155 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+)
+
+var spiAccessibilityReportLog = log.Log.WithName("spiaccessibilityreport-controller")
+
+// SPIAccessibilityReportReconciler reconciles a SPIAccessibilityReport object. It summarizes the accounts and
+// repositories accessible using the ready tokens in the namespace of the report. Only the metadata cached in the tokens
+// is used, the service providers are never contacted.
+type SPIAccessibilityReportReconciler struct {
+	client.Client
+	Scheme                 *runtime.Scheme
+	ServiceProviderFactory serviceprovider.Factory
+}
+
+//+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spiaccessibilityreports,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spiaccessibilityreports/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spiaccesstokens,verbs=get;list;watch
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *SPIAccessibilityReportReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&api.SPIAccessibilityReport{}).
+		Watches(&source.Kind{Type: &api.SPIAccessToken{}}, handler.EnqueueRequestsFromMapFunc(func(o client.Object) []reconcile.Request {
+			reports := &api.SPIAccessibilityReportList{}
+			if err := r.Client.List(context.TODO(), reports, client.InNamespace(o.GetNamespace())); err != nil {
+				spiAccessibilityReportLog.Error(err, "failed to list SPIAccessibilityReports while determining the ones affected by SPIAccessToken",
+					"SPIAccessTokenName", o.GetName(), "SPIAccessTokenNamespace", o.GetNamespace())
+				return []reconcile.Request{}
+			}
+			ret := make([]reconcile.Request, 0, len(reports.Items))
+			for _, r := range reports.Items {
+				ret = append(ret, reconcile.Request{
+					NamespacedName: types.NamespacedName{
+						Name:      r.Name,
+						Namespace: r.Namespace,
+					},
+				})
+			}
+			return ret
+		})).
+		Complete(monitored(mgr, "SPIAccessibilityReport", &api.SPIAccessibilityReport{}, r))
+}
+
+func (r *SPIAccessibilityReportReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	lg := log.FromContext(ctx)
+
+	report := api.SPIAccessibilityReport{}
+	if err := r.Get(ctx, req.NamespacedName, &report); err != nil {
+		if errors.IsNotFound(err) {
+			lg.Info("object not found")
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, NewReconcileError(err, "failed to load the SPIAccessibilityReport from the cluster")
+	}
+
+	tokens := &api.SPIAccessTokenList{}
+	if err := r.List(ctx, tokens, client.InNamespace(report.Namespace)); err != nil {
+		return ctrl.Result{}, NewReconcileError(err, "failed to list the SPIAccessTokens")
+	}
+
+	accounts := make([]api.AccessibleAccount, 0, len(tokens.Items))
+	for i := range tokens.Items {
+		token := &tokens.Items[i]
+		if token.Status.Phase != api.SPIAccessTokenPhaseReady || token.Status.TokenMetadata == nil {
+			continue
+		}
+
+		if report.Spec.ServiceProviderUrl != "" && report.Spec.ServiceProviderUrl != token.Spec.ServiceProviderUrl {
+			continue
+		}
+
+		sp, err := r.ServiceProviderFactory.FromRepoUrlInNamespace(ctx, token.Spec.ServiceProviderUrl, token.Namespace)
+		if err != nil {
+			lg.Error(err, "failed to determine the service provider of the token, skipping it", "token", token.Name)
+			continue
+		}
+
+		resources, err := sp.GetAccessibleResources(ctx, token)
+		if err != nil {
+			lg.Error(err, "failed to read the accessible resources from the token metadata, skipping it", "token", token.Name)
+			continue
+		}
+
+		orgs, orgsTruncated := truncateAccessibleResources(resources.Organizations)
+		repos, reposTruncated := truncateAccessibleResources(resources.Repositories)
+
+		accounts = append(accounts, api.AccessibleAccount{
+			TokenName:           token.Name,
+			ServiceProviderType: sp.GetType(),
+			ServiceProviderUrl:  token.Spec.ServiceProviderUrl,
+			Username:            token.Status.TokenMetadata.Username,
+			Scopes:              token.Status.TokenMetadata.Scopes,
+			Organizations:       orgs,
+			Repositories:        repos,
+			Truncated:           orgsTruncated || reposTruncated,
+		})
+	}
+
+	// the order of the listed tokens is not guaranteed, so let's make it stable to not update the status needlessly
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].TokenName < accounts[j].TokenName
+	})
+
+	report.Status.Truncated = len(accounts) > api.MaxAccessibilityReportAccounts
+	if report.Status.Truncated {
+		accounts = accounts[:api.MaxAccessibilityReportAccounts]
+	}
+	report.Status.Accounts = accounts
+
+	if err := updateAccessibilityReportStatusIfChanged(ctx, r.Client, &report); err != nil {
+		return ctrl.Result{}, NewReconcileError(err, "failed to update the status of the SPIAccessibilityReport")
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// truncateAccessibleResources cuts the list of the accessible resources to api.MaxAccessibleResourcesPerAccount items
+// and reports whether it was cut.
+func truncateAccessibleResources(resources []string) ([]string, bool) {
+	if len(resources) <= api.MaxAccessibleResourcesPerAccount {
+		return resources, false
+	}
+	return resources[:api.MaxAccessibleResourcesPerAccount], true
+}
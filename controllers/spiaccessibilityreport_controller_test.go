@@ -0,0 +1,37 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"fmt"
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTruncateAccessibleResources(t *testing.T) {
+	resources, truncated := truncateAccessibleResources([]string{"a", "b"})
+	assert.Equal(t, []string{"a", "b"}, resources)
+	assert.False(t, truncated)
+
+	many := make([]string, api.MaxAccessibleResourcesPerAccount+1)
+	for i := range many {
+		many[i] = fmt.Sprintf("repo-%d", i)
+	}
+	resources, truncated = truncateAccessibleResources(many)
+	assert.Equal(t, many[:api.MaxAccessibleResourcesPerAccount], resources)
+	assert.True(t, truncated)
+}
@@ -18,12 +18,17 @@ package controllers
 
 import (
 	"context"
+	stderrors "errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/cloudevents"
 	sperrors "github.com/redhat-appstudio/service-provider-integration-operator/pkg/errors"
 
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/finalizer"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -33,9 +38,15 @@ import (
 	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/oauthstate"
 	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/tokenstorage"
 
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/oauthbroker"
 	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/statusupdate"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -53,14 +64,22 @@ type SPIAccessTokenReconciler struct {
 	client.Client
 	Scheme                 *runtime.Scheme
 	TokenStorage           tokenstorage.TokenStorage
-	Configuration          config.Configuration
+	Configuration          *config.LiveConfiguration
 	ServiceProviderFactory serviceprovider.Factory
 	finalizers             finalizer.Finalizers
+	// Events is where the notifications about the changes of the tokens are emitted. Nothing is emitted if nil.
+	Events cloudevents.Emitter
+	// statusUpdates coalesces the rapid successive status updates of the tokens if configured.
+	statusUpdates statusUpdateCoalescer
+	// StateTransit is the Vault transit key the OAuth states are signed with. The shared secret is used if nil.
+	StateTransit *oauthstate.VaultTransit
 }
 
 //+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spiaccesstokens,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spiaccesstokens/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spiaccesstokens/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=list;create;delete
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *SPIAccessTokenReconciler) SetupWithManager(mgr ctrl.Manager) error {
@@ -68,28 +87,66 @@ func (r *SPIAccessTokenReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	if err := r.finalizers.Register(linkedBindingsFinalizerName, &linkedBindingsFinalizer{client: r.Client}); err != nil {
 		return err
 	}
-	if err := r.finalizers.Register(tokenStorageFinalizerName, &tokenStorageFinalizer{storage: r.TokenStorage}); err != nil {
+	if err := r.finalizers.Register(tokenStorageFinalizerName, &tokenStorageFinalizer{
+		client:                 r.Client,
+		storage:                r.TokenStorage,
+		configuration:          r.Configuration,
+		serviceProviderFactory: r.ServiceProviderFactory,
+	}); err != nil {
 		return err
 	}
 
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&api.SPIAccessToken{}).
-		Watches(&source.Kind{Type: &api.SPIAccessTokenBinding{}}, handler.EnqueueRequestsFromMapFunc(func(object client.Object) []reconcile.Request {
-			return requestsForTokenInObjectNamespace(object, func() string {
-				return object.GetLabels()[opconfig.SPIAccessTokenLinkLabel]
-			})
-		})).
-		Watches(&source.Kind{Type: &api.SPIAccessTokenDataUpdate{}}, handler.EnqueueRequestsFromMapFunc(func(object client.Object) []reconcile.Request {
-			return requestsForTokenInObjectNamespace(object, func() string {
-				update, ok := object.(*api.SPIAccessTokenDataUpdate)
-				if !ok {
-					return ""
-				}
-
-				return update.Spec.TokenName
-			})
-		})).
-		Complete(r)
+	partitioner := &providerPartitioner{
+		factory:   &r.ServiceProviderFactory,
+		reader:    mgr.GetClient(),
+		prototype: &api.SPIAccessToken{},
+		url: func(o client.Object) string {
+			if token, ok := o.(*api.SPIAccessToken); ok {
+				return token.Spec.ServiceProviderUrl
+			}
+			return ""
+		},
+	}
+	reconciler := monitored(mgr, "SPIAccessToken", &api.SPIAccessToken{}, r)
+	for _, partition := range partitioner.partitions() {
+		if err := ctrl.NewControllerManagedBy(mgr).
+			Named(partitioner.controllerName("spiaccesstoken", partition)).
+			For(&api.SPIAccessToken{}, builder.WithPredicates(partitioner.predicate(partition))).
+			Watches(&source.Kind{Type: &api.SPIAccessTokenBinding{}}, partitioner.handler(partition, handler.EnqueueRequestsFromMapFunc(func(object client.Object) []reconcile.Request {
+				return requestsForTokenInObjectNamespace(object, func() string {
+					return object.GetLabels()[opconfig.SPIAccessTokenLinkLabel]
+				})
+			}))).
+			Watches(&source.Kind{Type: &api.SPIAccessTokenDataUpdate{}}, partitioner.handler(partition, handler.EnqueueRequestsFromMapFunc(func(object client.Object) []reconcile.Request {
+				return requestsForTokenInObjectNamespace(object, func() string {
+					update, ok := object.(*api.SPIAccessTokenDataUpdate)
+					if !ok {
+						return ""
+					}
+
+					// the data has been changed in the token storage by someone else, so any cached data is stale.
+					// The invalidation needs to happen before the reconciliation of the token is enqueued so that
+					// it cannot read the stale data.
+					if cache, ok := r.TokenStorage.(tokenCache); ok && update.Spec.TokenName != "" {
+						cache.Invalidate(client.ObjectKey{Name: update.Spec.TokenName, Namespace: update.Namespace})
+					}
+
+					return update.Spec.TokenName
+				})
+			}))).
+			Watches(&source.Kind{Type: &corev1.Namespace{}}, partitioner.handler(partition, handler.EnqueueRequestsFromMapFunc(requestsForObjectsInNamespace(r.Client, func() client.ObjectList {
+				return &api.SPIAccessTokenList{}
+			}))), builder.WithPredicates(hibernationChanged)).
+			Complete(reconciler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tokenCache is implemented by the token storages caching the token data, like tokenstorage.CachingTokenStorage.
+type tokenCache interface {
+	Invalidate(key types.NamespacedName)
 }
 
 func requestsForTokenInObjectNamespace(object client.Object, tokenNameExtractor func() string) []reconcile.Request {
@@ -128,6 +185,7 @@ func (r *SPIAccessTokenReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 
 	lg = lg.WithValues("phase_at_reconcile_start", at.Status.Phase)
 	log.IntoContext(ctx, lg)
+	phaseAtStart := at.Status.Phase
 
 	finalizationResult, err := r.finalizers.Finalize(ctx, &at)
 	if err != nil {
@@ -141,7 +199,7 @@ func (r *SPIAccessTokenReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		}
 	}
 	if finalizationResult.StatusUpdated {
-		if err = r.Client.Status().Update(ctx, &at); err != nil {
+		if err = statusupdate.Apply(ctx, r.Client, &at); err != nil {
 			return ctrl.Result{}, NewReconcileError(err, "failed to update the status based on finalization result")
 		}
 	}
@@ -151,10 +209,49 @@ func (r *SPIAccessTokenReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		return ctrl.Result{}, nil
 	}
 
+	if isTombstoneName(at.Name) {
+		// the token would get the data of the deleted token the tombstone was created for
+		err := fmt.Errorf("the names starting with '%s' are reserved for the data of the deleted tokens", tombstoneNamePrefix)
+		if uerr := r.flipToExceptionalPhase(ctx, &at, api.SPIAccessTokenPhaseError, api.SPIAccessTokenErrorReasonReservedName, err); uerr != nil {
+			return ctrl.Result{}, NewReconcileError(uerr, "failed update the status")
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if _, ok := at.Annotations[api.InvalidateTokenDataAnnotation]; ok {
+		if err := r.invalidateTokenData(ctx, &at); err != nil {
+			return ctrl.Result{}, NewReconcileError(err, "failed to invalidate the token data")
+		}
+	}
+
+	if _, ok := at.Annotations[api.RollbackTokenDataAnnotation]; ok {
+		rolledBack, err := r.rollbackTokenData(ctx, &at)
+		if err != nil {
+			return ctrl.Result{}, NewReconcileError(err, "failed to roll back the token data")
+		}
+		if !rolledBack {
+			// the reason is recorded in the status. We'll get reconciled again once the user fixes the annotation.
+			return ctrl.Result{}, nil
+		}
+	}
+
+	if hibernated, err := namespaceHibernated(ctx, r.Client, at.Namespace); err != nil {
+		return ctrl.Result{}, NewReconcileError(err, "failed to check whether the namespace is hibernated")
+	} else if hibernated {
+		lg.Info("the namespace is hibernated, skipping the reconciliation until it wakes up")
+		return ctrl.Result{}, nil
+	}
+
 	// persist the SP-specific state so that it is available as soon as the token flips to the ready state.
-	sp, err := r.ServiceProviderFactory.FromRepoUrl(at.Spec.ServiceProviderUrl)
+	sp, err := r.ServiceProviderFactory.FromRepoUrlInNamespace(ctx, at.Spec.ServiceProviderUrl, at.Namespace)
 	if err != nil {
-		if uerr := r.flipToExceptionalPhase(ctx, &at, api.SPIAccessTokenPhaseError, api.SPIAccessTokenErrorReasonUnknownServiceProvider, err); uerr != nil {
+		reason := api.SPIAccessTokenErrorReasonUnknownServiceProvider
+		if reportOAuthNotConfigured(err) {
+			reason = api.SPIAccessTokenErrorReasonOAuthNotConfigured
+		} else if stderrors.Is(err, serviceprovider.ErrUrlNotAllowed) {
+			reason = api.SPIAccessTokenErrorReasonServiceProviderUrlNotAllowed
+		}
+		if uerr := r.flipToExceptionalPhase(ctx, &at, api.SPIAccessTokenPhaseError, reason, err); uerr != nil {
 			return ctrl.Result{}, NewReconcileError(uerr, "failed update the status")
 		}
 		// we flipped the token to the invalid phase, which is valid phase to be in. All we can do is to wait for the
@@ -162,6 +259,55 @@ func (r *SPIAccessTokenReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		return ctrl.Result{}, nil
 	}
 
+	// the token data is read once per reconciliation. It is needed for the throttling, because the quotas are tracked
+	// per token, and for the data versions in the status.
+	tokenData, err := r.TokenStorage.Get(ctx, &at)
+	if err != nil {
+		return ctrl.Result{}, NewReconcileError(err, "failed to read the token data")
+	}
+
+	if tokenData, err = r.reconcileRestore(ctx, &at, tokenData); err != nil {
+		return ctrl.Result{}, NewReconcileError(err, "failed to reconcile the restore of the token")
+	}
+
+	tokenData, brokerRecheckAfter, err := r.reconcileBrokeredToken(ctx, &at, sp, tokenData)
+	if err != nil {
+		return ctrl.Result{}, NewReconcileError(err, "failed to obtain the token data from the OAuth broker")
+	}
+
+	if delay := serviceprovider.ThrottlingDelay(sp, tokenData, r.Configuration.Get().RateLimitThreshold); delay > 0 {
+		lg.Info("the API quota of the token is nearly exhausted, postponing the reconciliation", "delay", delay)
+		return ctrl.Result{RequeueAfter: delay}, nil
+	}
+
+	// the calls to the service provider under maintenance would fail and flip the token to Invalid or Error
+	window := r.Configuration.Get().ActiveMaintenanceWindow(config.ServiceProviderType(sp.GetType()), sp.GetBaseUrl(), time.Now())
+	setSuspended(&at, window)
+	if window != nil {
+		lg.Info("the service provider is under maintenance, suspending the reconciliation", "until", window.End)
+		if err := updateTokenStatusIfChanged(ctx, r.Client, &r.statusUpdates, r.Configuration.Get().StatusUpdateCoalescingInterval, &at); err != nil {
+			return ctrl.Result{}, NewReconcileError(err, "failed to update the status")
+		}
+		return ctrl.Result{RequeueAfter: time.Until(window.End)}, nil
+	}
+
+	if err := validateNewCredentials(ctx, sp, &at, tokenData); err != nil {
+		if sperrors.IsServiceProviderError(err) && !sperrors.IsInvalidAccessToken(err) {
+			if uerr := r.flipToExceptionalPhase(ctx, &at, api.SPIAccessTokenPhaseError, api.SPIAccessTokenErrorReasonCredentialsValidation, err); uerr != nil {
+				return ctrl.Result{}, NewReconcileError(uerr, "failed to update the status")
+			}
+			// the service provider failed to validate the credentials, let's retry...
+			lg.Error(err, "failed to validate the credentials")
+			return ctrl.Result{}, NewReconcileError(err, "failed to validate the credentials")
+		}
+		if uerr := r.flipToExceptionalPhase(ctx, &at, api.SPIAccessTokenPhaseInvalid, api.SPIAccessTokenErrorReasonCredentialsValidation, err); uerr != nil {
+			return ctrl.Result{}, NewReconcileError(uerr, "failed to update the status")
+		}
+		// the credentials are not going to become valid until new ones are stored, which triggers a new reconciliation
+		lg.Info("the stored credentials are invalid", "reason", err.Error())
+		return ctrl.Result{}, nil
+	}
+
 	validation, err := sp.Validate(ctx, &at)
 	if err != nil {
 		lg.Error(err, "failed to validate the object")
@@ -174,6 +320,14 @@ func (r *SPIAccessTokenReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		return ctrl.Result{}, nil
 	}
 
+	metadataBefore := at.Status.TokenMetadata.DeepCopy()
+	if startScopeDriftCheck(&at, r.Configuration.Get().ScopeDriftCheckInterval, time.Now()) {
+		lg.Info("refreshing the metadata to check for the scope drift")
+	}
+	if refreshMetadataAfterReauthentication(&at, tokenData) {
+		lg.Info("refreshing the metadata of the re-authenticated token")
+	}
+
 	if err := sp.PersistMetadata(ctx, r.Client, &at); err != nil {
 		if sperrors.IsInvalidAccessToken(err) {
 			if uerr := r.flipToExceptionalPhase(ctx, &at, api.SPIAccessTokenPhaseInvalid, api.SPIAccessTokenErrorReasonMetadataFailure, err); uerr != nil {
@@ -192,6 +346,9 @@ func (r *SPIAccessTokenReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		}
 	}
 
+	reportScopeDrift(ctx, &at, sp.GetType(), metadataBefore)
+	setReauthenticationRequired(&at, missingTokenScopes(sp, &at, tokenData))
+
 	if at.EnsureLabels(sp.GetType()) {
 		if err := r.Update(ctx, &at); err != nil {
 			lg.Error(err, "failed to update the object with the changes")
@@ -199,54 +356,167 @@ func (r *SPIAccessTokenReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		}
 	}
 
-	if err := r.updateTokenStatusSuccess(ctx, &at); err != nil {
+	maxValidity := r.Configuration.Get().MaxTokenValidity(config.ServiceProviderType(sp.GetType()), sp.GetBaseUrl())
+	setValidityWarning(&at, tokenData, maxValidity, time.Now())
+
+	if err := r.updateTokenStatusSuccess(ctx, &at, tokenData); err != nil {
 		return ctrl.Result{}, NewReconcileError(err, "failed to update the status")
 	}
 
+	if at.Status.Phase == api.SPIAccessTokenPhaseReady && phaseAtStart != api.SPIAccessTokenPhaseReady {
+		if phaseAtStart == api.SPIAccessTokenPhaseAwaitingTokenData {
+			emitTokenEvent(ctx, r.Events, cloudevents.TokenOAuthCompleted, &at)
+		}
+		emitTokenEvent(ctx, r.Events, cloudevents.TokenReady, &at)
+	}
+
+	recheckExpiryAfter, err := r.notifyExpiringToken(ctx, &at, tokenData, time.Now())
+	if err != nil {
+		return ctrl.Result{}, NewReconcileError(err, "failed to notify about the expiring token")
+	}
+
 	lg.WithValues("phase_at_reconcile_end", at.Status.Phase).
 		Info("reconciliation finished successfully")
 
-	return ctrl.Result{}, nil
+	requeueAfter := earliestRequeue(recheckExpiryAfter, nextScopeDriftCheck(&at, r.Configuration.Get().ScopeDriftCheckInterval, time.Now()))
+	return ctrl.Result{RequeueAfter: earliestRequeue(requeueAfter, brokerRecheckAfter)}, nil
+}
+
+// validateNewCredentials checks the token data using ServiceProvider.ValidateCredentials if they were stored since
+// the last successful reconciliation, e.g. uploaded by the user. The data that already made it to the status of
+// the token have been validated before.
+func validateNewCredentials(ctx context.Context, sp serviceprovider.ServiceProvider, at *api.SPIAccessToken, tokenData *api.Token) error {
+	if tokenData == nil || tokenData.Version == at.Status.DataVersion {
+		return nil
+	}
+
+	if err := sp.ValidateCredentials(ctx, tokenData); err != nil {
+		return fmt.Errorf("the stored credentials cannot be used with the service provider: %w", err)
+	}
+
+	return nil
+}
+
+// invalidateTokenData wipes the data of the token from the token storage, forgets its metadata and removes the
+// annotation requesting the invalidation. The annotation is removed last, so that the invalidation is retried if any
+// of the previous steps fails.
+func (r *SPIAccessTokenReconciler) invalidateTokenData(ctx context.Context, at *api.SPIAccessToken) error {
+	log.FromContext(ctx).Info("invalidating the token data on user request")
+
+	if err := r.TokenStorage.Delete(ctx, at); err != nil {
+		return err
+	}
+
+	at.Status.TokenMetadata = nil
+	r.transitionToPhase(at, api.SPIAccessTokenPhaseAwaitingTokenData, api.SPIAccessTokenTransitionReasonTokenDataInvalidated, "")
+	at.Status.ErrorReason = ""
+	at.Status.ErrorMessage = ""
+	at.Status.ServiceProviderError = nil
+	if err := statusupdate.Apply(ctx, r.Client, at); err != nil {
+		return err
+	}
+
+	delete(at.Annotations, api.InvalidateTokenDataAnnotation)
+	return r.Client.Update(ctx, at)
+}
+
+// rollbackTokenData replaces the token data with the previous version requested by the annotation, forgets the metadata
+// of the token so that they're refreshed for the rolled back data and removes the annotation. If the annotation
+// doesn't contain a version that the token can be rolled back to, the token is flipped to the error phase, the
+// annotation is left in place and false is returned.
+func (r *SPIAccessTokenReconciler) rollbackTokenData(ctx context.Context, at *api.SPIAccessToken) (bool, error) {
+	versionString := at.Annotations[api.RollbackTokenDataAnnotation]
+	log.FromContext(ctx).Info("rolling back the token data on user request", "version", versionString)
+
+	version, err := strconv.ParseUint(versionString, 10, 64)
+	if err == nil {
+		err = tokenstorage.Rollback(ctx, r.TokenStorage, at, version)
+	}
+	if err != nil {
+		var numErr *strconv.NumError
+		if stderrors.As(err, &numErr) || stderrors.Is(err, tokenstorage.ErrVersionNotFound) {
+			rerr := fmt.Errorf("cannot roll back the token data to the version '%s': %w", versionString, err)
+			return false, r.flipToExceptionalPhase(ctx, at, api.SPIAccessTokenPhaseError, api.SPIAccessTokenErrorReasonTokenDataRollback, rerr)
+		}
+		return false, err
+	}
+
+	at.Status.TokenMetadata = nil
+	if err := statusupdate.Apply(ctx, r.Client, at); err != nil {
+		return false, err
+	}
+
+	delete(at.Annotations, api.RollbackTokenDataAnnotation)
+	return true, r.Client.Update(ctx, at)
 }
 
 func (r *SPIAccessTokenReconciler) flipToExceptionalPhase(ctx context.Context, at *api.SPIAccessToken, phase api.SPIAccessTokenPhase, reason api.SPIAccessTokenErrorReason, err error) error {
-	at.Status.Phase = phase
+	invalidated := phase == api.SPIAccessTokenPhaseInvalid && at.Status.Phase != phase
+	r.transitionToPhase(at, phase, string(reason), err.Error())
 	at.Status.ErrorMessage = err.Error()
 	at.Status.ErrorReason = reason
-	if uerr := r.Client.Status().Update(ctx, at); uerr != nil {
+	at.Status.ServiceProviderError = serviceProviderErrorDetails(err)
+	if uerr := updateTokenStatusIfChanged(ctx, r.Client, &r.statusUpdates, r.Configuration.Get().StatusUpdateCoalescingInterval, at); uerr != nil {
 		log.FromContext(ctx).Error(uerr, "failed to update the status with error", "reason", reason, "token_error", err)
 		return uerr
 	}
 
+	if invalidated {
+		emitTokenEvent(ctx, r.Events, cloudevents.TokenInvalid, at)
+		r.notifyTokenOwners(ctx, at, TokenNotificationReasonInvalid, "was rejected by the service provider, please provide new credentials: "+err.Error(), "")
+	}
+
 	return nil
 }
 
-func (r *SPIAccessTokenReconciler) updateTokenStatusSuccess(ctx context.Context, at *api.SPIAccessToken) error {
-	if err := r.fillInStatus(ctx, at); err != nil {
+func (r *SPIAccessTokenReconciler) updateTokenStatusSuccess(ctx context.Context, at *api.SPIAccessToken, data *api.Token) error {
+	if err := r.fillInStatus(ctx, at, data); err != nil {
 		return err
 	}
 	at.Status.ErrorMessage = ""
 	at.Status.ErrorReason = ""
-	if err := r.Client.Status().Update(ctx, at); err != nil {
+	at.Status.ServiceProviderError = nil
+	if err := updateTokenStatusIfChanged(ctx, r.Client, &r.statusUpdates, r.Configuration.Get().StatusUpdateCoalescingInterval, at); err != nil {
 		return NewReconcileError(err, "failed to update status")
 	}
 	return nil
 }
 
-// fillInStatus examines the provided token object and updates its status to match the state of the object.
-func (r *SPIAccessTokenReconciler) fillInStatus(ctx context.Context, at *api.SPIAccessToken) error {
+// fillInStatus examines the provided token object and its data (nil if there are none) and updates its status to
+// match the state of the object.
+func (r *SPIAccessTokenReconciler) fillInStatus(ctx context.Context, at *api.SPIAccessToken, data *api.Token) error {
+	at.Status.DataVersion, at.Status.PreviousDataVersions = dataVersions(data)
+
 	if at.Status.TokenMetadata == nil || at.Status.TokenMetadata.Username == "" {
-		oauthUrl, err := r.oAuthUrlFor(at)
+		oauthUrl, err := r.oAuthUrlFor(ctx, at)
+		if err != nil {
+			return err
+		}
+
+		at.Status.OAuthUrl = oauthUrl
+		at.Status.UploadUrl = r.uploadUrlFor(at)
+		reason := api.SPIAccessTokenTransitionReasonMetadataMissing
+		if data == nil {
+			reason = api.SPIAccessTokenTransitionReasonTokenDataMissing
+		}
+		r.transitionToPhase(at, api.SPIAccessTokenPhaseAwaitingTokenData, reason, "")
+	} else if reauthenticationRequired(at) {
+		// the token data work but lack the scopes the permissions of the token now require, so the users need to go
+		// through the OAuth flow again
+		oauthUrl, err := r.oAuthUrlFor(ctx, at)
 		if err != nil {
 			return err
 		}
 
 		at.Status.OAuthUrl = oauthUrl
-		at.Status.Phase = api.SPIAccessTokenPhaseAwaitingTokenData
+		at.Status.UploadUrl = r.uploadUrlFor(at)
+		message := apimeta.FindStatusCondition(at.Status.Conditions, api.SPIAccessTokenConditionReauthenticationRequired).Message
+		r.transitionToPhase(at, api.SPIAccessTokenPhaseAwaitingTokenData, api.SPIAccessTokenTransitionReasonPermissionsIncreased, message)
 	} else {
-		changed := at.Status.Phase != api.SPIAccessTokenPhaseReady || at.Status.OAuthUrl != ""
-		at.Status.Phase = api.SPIAccessTokenPhaseReady
+		changed := at.Status.Phase != api.SPIAccessTokenPhaseReady || at.Status.OAuthUrl != "" || at.Status.UploadUrl != ""
+		r.transitionToPhase(at, api.SPIAccessTokenPhaseReady, api.SPIAccessTokenTransitionReasonMetadataPresent, "")
 		at.Status.OAuthUrl = ""
+		at.Status.UploadUrl = ""
 		if changed {
 			lg := log.FromContext(ctx)
 			lg.Info("Flipping token to ready state because of metadata presence", "metadata", at.Status.TokenMetadata)
@@ -256,31 +526,140 @@ func (r *SPIAccessTokenReconciler) fillInStatus(ctx context.Context, at *api.SPI
 	return nil
 }
 
+// transitionToPhase sets the phase of the token and, if the phase changed, records the transition at the start of
+// the phase history of the token. The history is trimmed to the configured size.
+func (r *SPIAccessTokenReconciler) transitionToPhase(at *api.SPIAccessToken, phase api.SPIAccessTokenPhase, reason string, message string) {
+	previous := at.Status.Phase
+	at.Status.Phase = phase
+	if previous == phase {
+		return
+	}
+
+	historySize := r.Configuration.Get().TokenPhaseHistorySize
+	if historySize <= 0 {
+		at.Status.History = nil
+		return
+	}
+
+	history := make([]api.SPIAccessTokenPhaseTransition, 0, historySize)
+	history = append(history, api.SPIAccessTokenPhaseTransition{
+		Phase:         phase,
+		PreviousPhase: previous,
+		Reason:        reason,
+		Message:       message,
+		Time:          metav1.Now(),
+	})
+	history = append(history, at.Status.History...)
+	if len(history) > historySize {
+		history = history[:historySize]
+	}
+	at.Status.History = history
+}
+
+// setValidityWarning sets the ValidityWarning condition of the token according to the expiry of the provided token
+// data (nil if there are none) and the maximum validity of the tokens of its service provider. The condition is removed
+// if there is no limit or no data.
+func setValidityWarning(at *api.SPIAccessToken, data *api.Token, maxValidity time.Duration, now time.Time) {
+	if maxValidity <= 0 || data == nil {
+		apimeta.RemoveStatusCondition(&at.Status.Conditions, api.SPIAccessTokenConditionValidityWarning)
+		return
+	}
+
+	condition := metav1.Condition{
+		Type:               api.SPIAccessTokenConditionValidityWarning,
+		Status:             metav1.ConditionFalse,
+		Reason:             api.SPIAccessTokenValidityReasonWithinLimit,
+		ObservedGeneration: at.Generation,
+	}
+	if data.Expiry == 0 {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = api.SPIAccessTokenValidityReasonNoExpiry
+		condition.Message = fmt.Sprintf("the token doesn't expire but the maximum token validity is %s", maxValidity)
+	} else if expiry := time.Unix(int64(data.Expiry), 0); expiry.After(now.Add(maxValidity)) {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = api.SPIAccessTokenValidityReasonExpiryTooLate
+		condition.Message = fmt.Sprintf("the token expires at %s, later than the maximum token validity of %s allows", expiry.UTC().Format(time.RFC3339), maxValidity)
+	}
+	apimeta.SetStatusCondition(&at.Status.Conditions, condition)
+}
+
+// dataVersions returns the version of the provided token data and the versions of its previous data.
+func dataVersions(data *api.Token) (uint64, []uint64) {
+	if data == nil {
+		return 0, nil
+	}
+
+	var previous []uint64
+	for _, p := range data.PreviousVersions {
+		previous = append(previous, p.Version)
+	}
+
+	return data.Version, previous
+}
+
 // oAuthUrlFor determines the OAuth flow initiation URL for given token.
-func (r *SPIAccessTokenReconciler) oAuthUrlFor(at *api.SPIAccessToken) (string, error) {
-	sp, err := r.ServiceProviderFactory.FromRepoUrl(at.Spec.ServiceProviderUrl)
+func (r *SPIAccessTokenReconciler) oAuthUrlFor(ctx context.Context, at *api.SPIAccessToken) (string, error) {
+	sp, err := r.ServiceProviderFactory.FromRepoUrlInNamespace(ctx, at.Spec.ServiceProviderUrl, at.Namespace)
 	if err != nil {
 		return "", err
 	}
 
-	codec, err := oauthstate.NewCodec(r.Configuration.SharedSecret)
+	if sp.GetOAuthEndpoint() == "" {
+		// the service provider has no OAuth flow, the token data can only be uploaded
+		return "", nil
+	}
+
+	if cfg := r.Configuration.Get(); brokerIdentityProvider(cfg, sp) != "" {
+		// the users link their accounts in Keycloak and the operator obtains the token data from it
+		return oauthbroker.FromConfiguration(cfg, r.ServiceProviderFactory.HttpClient).LinkedAccountsUrl(), nil
+	}
+
+	codec, err := r.oauthStateCodec()
 	if err != nil {
 		return "", NewReconcileError(err, "failed to instantiate OAuth state codec")
 	}
 
-	state, err := codec.Encode(&oauthstate.AnonymousOAuthState{
+	scopes := serviceprovider.GetAllScopes(sp.TranslateToScopes, &at.Spec.Permissions)
+	if reauthenticationRequired(at) {
+		scopes = reauthenticationScopes(at, scopes)
+	}
+
+	newState := oauthstate.AnonymousOAuthState{
 		TokenName:           at.Name,
 		TokenNamespace:      at.Namespace,
 		IssuedAt:            time.Now().Unix(),
-		Scopes:              serviceprovider.GetAllScopes(sp.TranslateToScopes, &at.Spec.Permissions),
+		Scopes:              scopes,
 		ServiceProviderType: config.ServiceProviderType(sp.GetType()),
 		ServiceProviderUrl:  sp.GetBaseUrl(),
-	})
+	}
+
+	urlPrefix := sp.GetOAuthEndpoint() + "?state="
+
+	// keep the current URL if it still describes the same OAuth flow. Generating a new one on each reconciliation would
+	// needlessly update the status of the token (and of all the linked bindings) just because of the different issue
+	// time.
+	if strings.HasPrefix(at.Status.OAuthUrl, urlPrefix) {
+		currentState, err := codec.ParseAnonymous(strings.TrimPrefix(at.Status.OAuthUrl, urlPrefix))
+		if err == nil {
+			currentState.IssuedAt = newState.IssuedAt
+			if equality.Semantic.DeepEqual(currentState, newState) {
+				return at.Status.OAuthUrl, nil
+			}
+		}
+	}
+
+	state, err := codec.Encode(&newState)
 	if err != nil {
 		return "", NewReconcileError(err, "failed to encode the OAuth state")
 	}
 
-	return sp.GetOAuthEndpoint() + "?state=" + state, nil
+	return urlPrefix + state, nil
+}
+
+// uploadUrlFor determines the URL of the OAuth service endpoint to which the data of the given token can be uploaded
+// manually.
+func (r *SPIAccessTokenReconciler) uploadUrlFor(at *api.SPIAccessToken) string {
+	return strings.TrimSuffix(r.Configuration.Get().BaseUrl, "/") + "/token/" + at.Namespace + "/" + at.Name
 }
 
 type linkedBindingsFinalizer struct {
@@ -288,7 +667,10 @@ type linkedBindingsFinalizer struct {
 }
 
 type tokenStorageFinalizer struct {
-	storage tokenstorage.TokenStorage
+	client                 client.Client
+	storage                tokenstorage.TokenStorage
+	configuration          *config.LiveConfiguration
+	serviceProviderFactory serviceprovider.Factory
 }
 
 var _ finalizer.Finalizer = (*linkedBindingsFinalizer)(nil)
@@ -325,5 +707,112 @@ func (f *linkedBindingsFinalizer) hasLinkedBindings(ctx context.Context, token *
 }
 
 func (f *tokenStorageFinalizer) Finalize(ctx context.Context, obj client.Object) (finalizer.Result, error) {
-	return finalizer.Result{}, f.storage.Delete(ctx, obj.(*api.SPIAccessToken))
+	token := obj.(*api.SPIAccessToken)
+	if isTombstoneName(token.Name) {
+		// the data in the storage belongs to the tombstone, not to this token
+		return finalizer.Result{}, nil
+	}
+
+	f.revokeGrantIfNeeded(ctx, token)
+
+	if f.configuration.Get().TokenDataRetention > 0 {
+		nsDeleted, err := namespaceDeleted(ctx, f.client, token.Namespace)
+		if err != nil {
+			return finalizer.Result{}, err
+		}
+		// the tombstone cannot be recorded in the deleted namespace and there would be nothing to recover the data to
+		if !nsDeleted {
+			return finalizer.Result{}, tombstoneTokenData(ctx, f.client, f.storage, token)
+		}
+	}
+
+	return finalizer.Result{}, f.storage.Delete(ctx, token)
+}
+
+// revokeGrantIfNeeded revokes the authorization of the SPI OAuth application on the service provider side if
+// the configured GrantRevocationPolicy requires it for the deleted token. The failures are only logged so that they
+// don't block the deletion of the token (and its namespace).
+func (f *tokenStorageFinalizer) revokeGrantIfNeeded(ctx context.Context, token *api.SPIAccessToken) {
+	lg := log.FromContext(ctx)
+
+	revoke, err := f.shouldRevokeGrant(ctx, token)
+	if err != nil {
+		lg.Error(err, "failed to determine whether to revoke the grant of the token")
+		return
+	}
+	if !revoke {
+		return
+	}
+
+	data, err := f.storage.Get(ctx, token)
+	if err != nil {
+		lg.Error(err, "failed to read the token data to revoke the grant")
+		return
+	}
+	if data == nil {
+		return
+	}
+
+	sp, err := f.serviceProviderFactory.FromRepoUrlInNamespace(ctx, token.Spec.ServiceProviderUrl, token.Namespace)
+	if err != nil {
+		lg.Error(err, "failed to determine the service provider to revoke the grant")
+		return
+	}
+
+	revoker, ok := sp.(serviceprovider.GrantRevoker)
+	if !ok {
+		lg.Info("the service provider doesn't support revoking the grants, leaving the grant in place", "service_provider", sp.GetType())
+		return
+	}
+
+	if err := revoker.RevokeGrant(ctx, data); err != nil {
+		lg.Error(err, "failed to revoke the grant of the token")
+		return
+	}
+
+	lg.Info("revoked the grant of the token on the service provider side")
+}
+
+// shouldRevokeGrant decides whether the grant of the deleted token needs to be revoked according to the configured
+// GrantRevocationPolicy.
+func (f *tokenStorageFinalizer) shouldRevokeGrant(ctx context.Context, token *api.SPIAccessToken) (bool, error) {
+	switch f.configuration.Get().GrantRevocationPolicy {
+	case config.GrantRevocationPolicyAlways:
+		return true, nil
+	case config.GrantRevocationPolicyOnNamespaceDeletion:
+		return namespaceDeleted(ctx, f.client, token.Namespace)
+	default:
+		return false, nil
+	}
+}
+
+// namespaceDeleted returns true if the namespace with the provided name is being deleted or is already gone.
+func namespaceDeleted(ctx context.Context, cl client.Client, name string) (bool, error) {
+	ns := &corev1.Namespace{}
+	if err := cl.Get(ctx, client.ObjectKey{Name: name}, ns); err != nil {
+		if errors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	return ns.DeletionTimestamp != nil, nil
+}
+
+// oauthStateCodec returns the codec signing the OAuth states using the Vault transit key, if configured, or using
+// the shared secret. The previous shared secrets are deliberately not used so that the URLs with the states signed
+// before the rotation of the secret (or before the switch to the transit key) are regenerated.
+func (r *SPIAccessTokenReconciler) oauthStateCodec() (oauthstate.Codec, error) {
+	if r.StateTransit != nil {
+		codec, err := oauthstate.NewVaultTransitCodec(r.StateTransit)
+		if err != nil {
+			return oauthstate.Codec{}, fmt.Errorf("failed to instantiate the Vault transit OAuth state codec: %w", err)
+		}
+		return codec, nil
+	}
+
+	codec, err := oauthstate.NewCodec(r.Configuration.Get().SharedSecret)
+	if err != nil {
+		return oauthstate.Codec{}, fmt.Errorf("failed to instantiate the OAuth state codec: %w", err)
+	}
+	return codec, nil
 }
@@ -0,0 +1,285 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/cloudevents"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/statusupdate"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDataVersions(t *testing.T) {
+	version, previous := dataVersions(nil)
+	assert.Equal(t, uint64(0), version)
+	assert.Empty(t, previous)
+
+	version, previous = dataVersions(&api.Token{
+		Version:          3,
+		PreviousVersions: []api.Token{{Version: 2}, {Version: 1}},
+	})
+	assert.Equal(t, uint64(3), version)
+	assert.Equal(t, []uint64{2, 1}, previous)
+}
+
+func TestTransitionToPhase(t *testing.T) {
+	r := &SPIAccessTokenReconciler{
+		Configuration: config.NewLiveConfiguration(config.Configuration{TokenPhaseHistorySize: 2}),
+	}
+	at := &api.SPIAccessToken{}
+
+	r.transitionToPhase(at, api.SPIAccessTokenPhaseAwaitingTokenData, api.SPIAccessTokenTransitionReasonTokenDataMissing, "")
+	assert.Equal(t, api.SPIAccessTokenPhaseAwaitingTokenData, at.Status.Phase)
+	assert.Len(t, at.Status.History, 1)
+	assert.Empty(t, at.Status.History[0].PreviousPhase)
+	assert.Equal(t, api.SPIAccessTokenTransitionReasonTokenDataMissing, at.Status.History[0].Reason)
+	assert.False(t, at.Status.History[0].Time.IsZero())
+
+	t.Run("same phase is not recorded", func(t *testing.T) {
+		r.transitionToPhase(at, api.SPIAccessTokenPhaseAwaitingTokenData, api.SPIAccessTokenTransitionReasonMetadataMissing, "")
+		assert.Len(t, at.Status.History, 1)
+	})
+
+	t.Run("most recent first and trimmed", func(t *testing.T) {
+		r.transitionToPhase(at, api.SPIAccessTokenPhaseReady, api.SPIAccessTokenTransitionReasonMetadataPresent, "")
+		r.transitionToPhase(at, api.SPIAccessTokenPhaseInvalid, string(api.SPIAccessTokenErrorReasonMetadataFailure), "bad credentials")
+
+		assert.Equal(t, api.SPIAccessTokenPhaseInvalid, at.Status.Phase)
+		assert.Len(t, at.Status.History, 2)
+		assert.Equal(t, api.SPIAccessTokenPhaseInvalid, at.Status.History[0].Phase)
+		assert.Equal(t, api.SPIAccessTokenPhaseReady, at.Status.History[0].PreviousPhase)
+		assert.Equal(t, string(api.SPIAccessTokenErrorReasonMetadataFailure), at.Status.History[0].Reason)
+		assert.Equal(t, "bad credentials", at.Status.History[0].Message)
+		assert.Equal(t, api.SPIAccessTokenPhaseReady, at.Status.History[1].Phase)
+		assert.Equal(t, api.SPIAccessTokenPhaseAwaitingTokenData, at.Status.History[1].PreviousPhase)
+	})
+}
+
+func TestSetValidityWarning(t *testing.T) {
+	now := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+	at := &api.SPIAccessToken{}
+
+	warning := func() *metav1.Condition {
+		return apimeta.FindStatusCondition(at.Status.Conditions, api.SPIAccessTokenConditionValidityWarning)
+	}
+
+	setValidityWarning(at, &api.Token{}, 24*time.Hour, now)
+	assert.Equal(t, metav1.ConditionTrue, warning().Status)
+	assert.Equal(t, api.SPIAccessTokenValidityReasonNoExpiry, warning().Reason)
+
+	setValidityWarning(at, &api.Token{Expiry: uint64(now.Add(48 * time.Hour).Unix())}, 24*time.Hour, now)
+	assert.Equal(t, metav1.ConditionTrue, warning().Status)
+	assert.Equal(t, api.SPIAccessTokenValidityReasonExpiryTooLate, warning().Reason)
+	assert.Contains(t, warning().Message, "2022-05-03T00:00:00Z")
+
+	setValidityWarning(at, &api.Token{Expiry: uint64(now.Add(time.Hour).Unix())}, 24*time.Hour, now)
+	assert.Equal(t, metav1.ConditionFalse, warning().Status)
+	assert.Equal(t, api.SPIAccessTokenValidityReasonWithinLimit, warning().Reason)
+
+	t.Run("no limit", func(t *testing.T) {
+		setValidityWarning(at, &api.Token{}, 0, now)
+		assert.Nil(t, warning())
+	})
+
+	t.Run("no data", func(t *testing.T) {
+		setValidityWarning(at, &api.Token{}, time.Hour, now)
+		setValidityWarning(at, nil, time.Hour, now)
+		assert.Nil(t, warning())
+	})
+}
+
+func TestTokenStorageFinalizer_ShouldRevokeGrant(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, corev1.AddToScheme(sch))
+
+	now := metav1.Now()
+	cl := fake.NewClientBuilder().WithScheme(sch).WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "live"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "deleted", DeletionTimestamp: &now, Finalizers: []string{"kubernetes"}}},
+	).Build()
+
+	tokenIn := func(namespace string) *api.SPIAccessToken {
+		return &api.SPIAccessToken{ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: namespace}}
+	}
+
+	finalizerWithPolicy := func(policy config.GrantRevocationPolicy) *tokenStorageFinalizer {
+		return &tokenStorageFinalizer{
+			client:        cl,
+			configuration: config.NewLiveConfiguration(config.Configuration{GrantRevocationPolicy: policy}),
+		}
+	}
+
+	test := func(policy config.GrantRevocationPolicy, namespace string, expected bool) {
+		t.Run(string(policy)+" in "+namespace, func(t *testing.T) {
+			revoke, err := finalizerWithPolicy(policy).shouldRevokeGrant(context.TODO(), tokenIn(namespace))
+			assert.NoError(t, err)
+			assert.Equal(t, expected, revoke)
+		})
+	}
+
+	test(config.GrantRevocationPolicyNever, "live", false)
+	test(config.GrantRevocationPolicyNever, "deleted", false)
+	test(config.GrantRevocationPolicyOnNamespaceDeletion, "live", false)
+	test(config.GrantRevocationPolicyOnNamespaceDeletion, "deleted", true)
+	test(config.GrantRevocationPolicyOnNamespaceDeletion, "gone", true)
+	test(config.GrantRevocationPolicyAlways, "live", true)
+}
+
+func TestTokenStorageFinalizer_Retention(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, corev1.AddToScheme(sch))
+
+	now := metav1.Now()
+	cl := fake.NewClientBuilder().WithScheme(sch).WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "live"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "deleted", DeletionTimestamp: &now, Finalizers: []string{"kubernetes"}}},
+	).Build()
+
+	finalize := func(t *testing.T, retention time.Duration, token *api.SPIAccessToken) map[string]string {
+		data := map[string]string{token.Name: "secret"}
+		f := &tokenStorageFinalizer{
+			client:        cl,
+			storage:       tombstoneTestStorage(data),
+			configuration: config.NewLiveConfiguration(config.Configuration{TokenDataRetention: retention}),
+		}
+		_, err := f.Finalize(context.TODO(), token)
+		assert.NoError(t, err)
+		return data
+	}
+
+	t.Run("deletes without retention", func(t *testing.T) {
+		data := finalize(t, 0, &api.SPIAccessToken{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "live", UID: "a"}})
+		assert.Empty(t, data)
+	})
+
+	t.Run("tombstones with retention", func(t *testing.T) {
+		data := finalize(t, time.Hour, &api.SPIAccessToken{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "live", UID: "b"}})
+		assert.Equal(t, map[string]string{"spi-tombstone-b": "secret"}, data)
+	})
+
+	t.Run("deletes in deleted namespace", func(t *testing.T) {
+		data := finalize(t, time.Hour, &api.SPIAccessToken{ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: "deleted", UID: "c"}})
+		assert.Empty(t, data)
+	})
+
+	t.Run("keeps data of tombstone", func(t *testing.T) {
+		data := finalize(t, 0, &api.SPIAccessToken{ObjectMeta: metav1.ObjectMeta{Name: "spi-tombstone-d", Namespace: "live", UID: "d"}})
+		assert.Equal(t, map[string]string{"spi-tombstone-d": "secret"}, data)
+	})
+}
+
+// recordingEmitter records the emitted events.
+type recordingEmitter struct {
+	events []cloudevents.Event
+}
+
+func (e *recordingEmitter) Emit(_ context.Context, event cloudevents.Event) {
+	e.events = append(e.events, event)
+}
+
+func TestFlipToExceptionalPhase_EmitsTokenInvalid(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, api.AddToScheme(sch))
+
+	at := &api.SPIAccessToken{
+		ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "ns"},
+		Spec:       api.SPIAccessTokenSpec{ServiceProviderUrl: "https://acme.com"},
+		Status:     api.SPIAccessTokenStatus{Phase: api.SPIAccessTokenPhaseReady},
+	}
+	emitter := &recordingEmitter{}
+	r := &SPIAccessTokenReconciler{
+		Client:        statusupdate.FakeApplyClient{Client: fake.NewClientBuilder().WithScheme(sch).WithObjects(at).Build()},
+		Configuration: config.NewLiveConfiguration(config.Configuration{}),
+		Events:        emitter,
+	}
+
+	assert.NoError(t, r.flipToExceptionalPhase(context.TODO(), at, api.SPIAccessTokenPhaseInvalid, api.SPIAccessTokenErrorReasonMetadataFailure, fmt.Errorf("bad credentials")))
+	assert.Equal(t, []cloudevents.Event{{
+		Type: cloudevents.TokenInvalid,
+		Data: cloudevents.ObjectData{
+			Kind:               "SPIAccessToken",
+			Namespace:          "ns",
+			Name:               "token",
+			Phase:              "Invalid",
+			ServiceProviderUrl: "https://acme.com",
+			Message:            "bad credentials",
+		},
+	}}, emitter.events)
+
+	t.Run("already invalid", func(t *testing.T) {
+		emitter.events = nil
+		assert.NoError(t, r.flipToExceptionalPhase(context.TODO(), at, api.SPIAccessTokenPhaseInvalid, api.SPIAccessTokenErrorReasonMetadataFailure, fmt.Errorf("bad credentials")))
+		assert.Empty(t, emitter.events)
+	})
+
+	t.Run("other phases", func(t *testing.T) {
+		assert.NoError(t, r.flipToExceptionalPhase(context.TODO(), at, api.SPIAccessTokenPhaseError, api.SPIAccessTokenErrorReasonMetadataFailure, fmt.Errorf("unavailable")))
+		assert.Empty(t, emitter.events)
+	})
+}
+
+// credentialsValidatingServiceProvider counts the validations of the credentials and fails them if configured so.
+type credentialsValidatingServiceProvider struct {
+	serviceprovider.ServiceProvider
+	validations *int
+	err         error
+}
+
+func (s credentialsValidatingServiceProvider) ValidateCredentials(_ context.Context, _ *api.Token) error {
+	*s.validations++
+	return s.err
+}
+
+func TestValidateNewCredentials(t *testing.T) {
+	at := &api.SPIAccessToken{Status: api.SPIAccessTokenStatus{DataVersion: 1}}
+
+	t.Run("new data validated", func(t *testing.T) {
+		validations := 0
+		sp := credentialsValidatingServiceProvider{validations: &validations}
+
+		assert.NoError(t, validateNewCredentials(context.TODO(), sp, at, &api.Token{AccessToken: "token", Version: 2}))
+		assert.Equal(t, 1, validations)
+	})
+
+	t.Run("invalid new data", func(t *testing.T) {
+		validations := 0
+		sp := credentialsValidatingServiceProvider{validations: &validations, err: fmt.Errorf("username is required")}
+
+		err := validateNewCredentials(context.TODO(), sp, at, &api.Token{TokenType: api.BasicAuthTokenType, AccessToken: "password", Version: 2})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "username is required")
+	})
+
+	t.Run("known data not validated again", func(t *testing.T) {
+		validations := 0
+		sp := credentialsValidatingServiceProvider{validations: &validations, err: fmt.Errorf("invalid")}
+
+		assert.NoError(t, validateNewCredentials(context.TODO(), sp, at, &api.Token{AccessToken: "token", Version: 1}))
+		assert.NoError(t, validateNewCredentials(context.TODO(), sp, at, nil))
+		assert.Equal(t, 0, validations)
+	})
+}
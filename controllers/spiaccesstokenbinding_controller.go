@@ -18,21 +18,32 @@ package controllers
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	stderrors "errors"
 	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/tokenstorage"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/cloudevents"
 	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/sync"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -41,6 +52,8 @@ import (
 	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
 	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/config"
 	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	sharedConfig "github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/writeback"
 )
 
 var spiAccessTokenBindingLog = log.Log.WithName("spiaccesstokenbinding-controller")
@@ -51,6 +64,10 @@ var (
 	}
 )
 
+// ephemeralTokenRefreshRatio is the part of the lifetime of an ephemeral token after which the token is replaced with
+// a new one.
+const ephemeralTokenRefreshRatio = 0.8
+
 // SPIAccessTokenBindingReconciler reconciles a SPIAccessTokenBinding object
 type SPIAccessTokenBindingReconciler struct {
 	client.Client
@@ -58,41 +75,98 @@ type SPIAccessTokenBindingReconciler struct {
 	TokenStorage           tokenstorage.TokenStorage
 	syncer                 sync.Syncer
 	ServiceProviderFactory serviceprovider.Factory
+	// WriteBackStore is the external secret store the bindings can write their data back to. The write-back is
+	// disabled if nil.
+	WriteBackStore writeback.Store
+	// PodDelivery tells whether the data of the bindings with the "Pod" delivery is served to the pods by the operator.
+	// Such bindings fail if it is not.
+	PodDelivery bool
+	// externalSecrets are the kinds of the External Secrets Operator objects or nil if the delivery of the secrets using
+	// ExternalSecrets is not enabled.
+	externalSecrets *externalSecretKinds
+	// Events is where the notifications about the changes of the bindings are emitted. Nothing is emitted if nil.
+	Events cloudevents.Emitter
+	// statusUpdates coalesces the rapid successive status updates of the bindings if configured.
+	statusUpdates statusUpdateCoalescer
 }
 
+// writeBackFinalizerName is the finalizer of the bindings that wrote their data back to the external secret store.
+// It is only added to such bindings.
+const writeBackFinalizerName = "spi.appstudio.redhat.com/write-back"
+
 //+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spiaccesstokenbindings,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spiaccesstokenbindings/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spiaccesstokenbindings/finalizers,verbs=update
 //+kubebuilder:rbac:groups="",resources=secrets,verbs=get;watch;create;update;list;delete
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *SPIAccessTokenBindingReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	r.syncer = sync.New(mgr.GetClient())
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&api.SPIAccessTokenBinding{}).
-		Owns(&corev1.Secret{}).
-		Watches(&source.Kind{Type: &api.SPIAccessToken{}}, handler.EnqueueRequestsFromMapFunc(func(o client.Object) []reconcile.Request {
-			bindings := &api.SPIAccessTokenBindingList{}
-			if err := r.Client.List(context.TODO(), bindings, client.InNamespace(o.GetNamespace())); err != nil {
-				spiAccessTokenBindingLog.Error(err, "failed to list SPIAccessTokenBindings while determining the ones linked to SPIAccessToken",
-					"SPIAccessTokenName", o.GetName(), "SPIAccessTokenNamespace", o.GetNamespace())
-				return []reconcile.Request{}
-			}
-			ret := make([]reconcile.Request, len(bindings.Items))
-			for _, b := range bindings.Items {
-				ret = append(ret, reconcile.Request{
-					NamespacedName: types.NamespacedName{
-						Name:      b.Name,
-						Namespace: b.Namespace,
-					},
-				})
+	if r.ServiceProviderFactory.Configuration.Get().ExternalSecretStore != "" {
+		kinds, err := findExternalSecretKinds(mgr.GetRESTMapper())
+		if err != nil {
+			return fmt.Errorf("externalSecretStore is configured but the External Secrets Operator is not available: %w", err)
+		}
+		r.externalSecrets = kinds
+	}
+
+	partitioner := &providerPartitioner{
+		factory:   &r.ServiceProviderFactory,
+		reader:    mgr.GetClient(),
+		prototype: &api.SPIAccessTokenBinding{},
+		url: func(o client.Object) string {
+			if binding, ok := o.(*api.SPIAccessTokenBinding); ok {
+				return binding.Spec.RepoUrl
 			}
-			return ret
-		})).
-		Complete(r)
+			return ""
+		},
+	}
+	reconciler := monitored(mgr, "SPIAccessTokenBinding", &api.SPIAccessTokenBinding{}, r)
+	for _, partition := range partitioner.partitions() {
+		ownedBy := func() handler.EventHandler {
+			return partitioner.handler(partition, &handler.EnqueueRequestForOwner{OwnerType: &api.SPIAccessTokenBinding{}, IsController: true})
+		}
+		bld := ctrl.NewControllerManagedBy(mgr).
+			Named(partitioner.controllerName("spiaccesstokenbinding", partition)).
+			For(&api.SPIAccessTokenBinding{}, builder.WithPredicates(partitioner.predicate(partition))).
+			// only the owner references of the secrets are needed to find their bindings. Watching just the metadata
+			// keeps the data of the secrets out of the cache, the secrets are read directly from the cluster (see
+			// main.go).
+			Watches(&source.Kind{Type: &corev1.Secret{}}, ownedBy(), builder.OnlyMetadata)
+		if r.externalSecrets != nil {
+			bld = bld.Watches(&source.Kind{Type: newUnstructured(r.externalSecrets.externalSecret)}, ownedBy())
+		}
+		if err := bld.
+			Watches(&source.Kind{Type: &api.SPIAccessToken{}}, partitioner.handler(partition, handler.EnqueueRequestsFromMapFunc(func(o client.Object) []reconcile.Request {
+				bindings := &api.SPIAccessTokenBindingList{}
+				if err := r.Client.List(context.TODO(), bindings, client.InNamespace(o.GetNamespace())); err != nil {
+					spiAccessTokenBindingLog.Error(err, "failed to list SPIAccessTokenBindings while determining the ones linked to SPIAccessToken",
+						"SPIAccessTokenName", o.GetName(), "SPIAccessTokenNamespace", o.GetNamespace())
+					return []reconcile.Request{}
+				}
+				ret := make([]reconcile.Request, 0, len(bindings.Items))
+				for _, b := range bindings.Items {
+					ret = append(ret, reconcile.Request{
+						NamespacedName: types.NamespacedName{
+							Name:      b.Name,
+							Namespace: b.Namespace,
+						},
+					})
+				}
+				return ret
+			}))).
+			Watches(&source.Kind{Type: &corev1.Namespace{}}, partitioner.handler(partition, handler.EnqueueRequestsFromMapFunc(requestsForObjectsInNamespace(r.Client, func() client.ObjectList {
+				return &api.SPIAccessTokenBindingList{}
+			}))), builder.WithPredicates(hibernationChanged)).
+			Complete(reconciler); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (r *SPIAccessTokenBindingReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *SPIAccessTokenBindingReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
 	lg := log.FromContext(ctx)
 
 	lg.Info("Reconciling")
@@ -102,6 +176,9 @@ func (r *SPIAccessTokenBindingReconciler) Reconcile(ctx context.Context, req ctr
 	if err := r.Get(ctx, req.NamespacedName, &binding); err != nil {
 		if errors.IsNotFound(err) {
 			lg.Info("object not found")
+			if err := pruneDeletedBinding(ctx, r.Client, req.NamespacedName); err != nil {
+				return ctrl.Result{}, NewReconcileError(err, "failed to remove the deleted binding from the linked tokens")
+			}
 			return ctrl.Result{}, nil
 		}
 
@@ -111,9 +188,50 @@ func (r *SPIAccessTokenBindingReconciler) Reconcile(ctx context.Context, req ctr
 
 	lg = lg.WithValues("linked_to", binding.Status.LinkedAccessTokenName,
 		"phase_at_reconcile_start", binding.Status.Phase)
+	phaseAtStart := binding.Status.Phase
+
+	if err := r.finalizeWriteBack(ctx, &binding); err != nil {
+		return ctrl.Result{}, NewReconcileError(err, "failed to finalize")
+	}
 
 	if binding.DeletionTimestamp != nil {
 		lg.Info("object is being deleted")
+		if err := syncLinkedBindings(ctx, r.Client, client.ObjectKey{Name: binding.Labels[config.SPIAccessTokenLinkLabel], Namespace: binding.Namespace}, &binding); err != nil {
+			return ctrl.Result{}, NewReconcileError(err, "failed to remove the binding from the linked token")
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if expiresIn, ok := bindingExpiresIn(ctx, &binding, time.Now()); ok {
+		if expiresIn <= 0 {
+			if err := deleteExpiredBinding(ctx, r.Client, &binding); err != nil {
+				return ctrl.Result{}, NewReconcileError(err, "failed to delete the expired binding")
+			}
+			return ctrl.Result{}, nil
+		}
+		// make sure we're back in time to delete the binding
+		defer func() {
+			result.RequeueAfter = earliestRequeue(result.RequeueAfter, expiresIn)
+		}()
+	}
+
+	if leaseExpiresIn, ok := bindingLeaseExpiresIn(&binding, time.Now()); ok && leaseExpiresIn <= 0 {
+		if err := r.expireBindingLease(ctx, &binding); err != nil {
+			return ctrl.Result{}, NewReconcileError(err, "failed to expire the lease of the binding")
+		}
+		return ctrl.Result{}, nil
+	}
+	// make sure we're back in time to delete the secret of the binding once its lease expires
+	defer func() {
+		if leaseExpiresIn, ok := bindingLeaseExpiresIn(&binding, time.Now()); ok && leaseExpiresIn > 0 {
+			result.RequeueAfter = earliestRequeue(result.RequeueAfter, leaseExpiresIn)
+		}
+	}()
+
+	if hibernated, err := namespaceHibernated(ctx, r.Client, binding.Namespace); err != nil {
+		return ctrl.Result{}, NewReconcileError(err, "failed to check whether the namespace is hibernated")
+	} else if hibernated {
+		lg.Info("the namespace is hibernated, skipping the reconciliation until it wakes up")
 		return ctrl.Result{}, nil
 	}
 
@@ -129,6 +247,11 @@ func (r *SPIAccessTokenBindingReconciler) Reconcile(ctx context.Context, req ctr
 		return ctrl.Result{}, nil
 	}
 
+	if delay := serviceprovider.ThrottlingDelay(sp, r.linkedTokenData(ctx, &binding), r.ServiceProviderFactory.Configuration.Get().RateLimitThreshold); delay > 0 {
+		lg.Info("the API quota of the linked token is nearly exhausted, postponing the reconciliation", "delay", delay)
+		return ctrl.Result{RequeueAfter: delay}, nil
+	}
+
 	validation, err := sp.Validate(ctx, &binding)
 	if err != nil {
 		lg.Error(err, "failed to validate the object")
@@ -139,9 +262,59 @@ func (r *SPIAccessTokenBindingReconciler) Reconcile(ctx context.Context, req ctr
 		return ctrl.Result{}, nil
 	}
 
+	// The secret spec is only enforced by the validation webhook. The bindings created before the validation existed
+	// (or bypassing the webhook) keep being synced as before so that they're not broken by an upgrade of the operator.
+	if errs := serviceprovider.ValidateSecretSpec(sp, &binding); len(errs) > 0 {
+		lg.Info("the requested secret would be rejected by the binding validation webhook", "problems", NewAggregatedError(errs...).Error())
+	}
+
+	if err := r.validateWriteBack(&binding); err != nil {
+		r.updateBindingStatusError(ctx, &binding, api.SPIAccessTokenBindingErrorReasonWriteBack, err)
+		return ctrl.Result{}, nil
+	}
+
+	if _, ok := sp.(serviceprovider.EphemeralTokenMinter); binding.Spec.Ephemeral && !ok {
+		r.updateBindingStatusError(ctx, &binding, api.SPIAccessTokenBindingErrorReasonEphemeralTokenUnsupported, fmt.Errorf("the %s service provider doesn't support ephemeral tokens", sp.GetType()))
+		return ctrl.Result{}, nil
+	}
+
+	if flavor := binding.Spec.CredentialFlavor; binding.Spec.Ephemeral && flavor != "" && flavor != api.CredentialFlavorAccessToken {
+		r.updateBindingStatusError(ctx, &binding, api.SPIAccessTokenBindingErrorReasonEphemeralTokenUnsupported, fmt.Errorf("ephemeral tokens can only be used with the %s credential flavor, not %s", api.CredentialFlavorAccessToken, flavor))
+		return ctrl.Result{}, nil
+	}
+
+	if binding.Spec.Secret.Delivery == api.SecretDeliveryPod {
+		if !r.PodDelivery {
+			r.updateBindingStatusError(ctx, &binding, api.SPIAccessTokenBindingErrorReasonPodDelivery, fmt.Errorf("the delivery of the binding data into the pods is not enabled in the operator"))
+			return ctrl.Result{}, nil
+		}
+		if binding.Spec.Ephemeral {
+			r.updateBindingStatusError(ctx, &binding, api.SPIAccessTokenBindingErrorReasonEphemeralTokenUnsupported, fmt.Errorf("ephemeral tokens cannot be delivered into the pods"))
+			return ctrl.Result{}, nil
+		}
+	}
+
 	var token *api.SPIAccessToken
 
-	if binding.Status.LinkedAccessTokenName == "" {
+	if binding.Spec.TokenRef != nil || binding.Spec.TokenPolicy.Type == api.TokenPolicyTypeNamed {
+		// the user told us which token to use, so there's no lookup involved
+		var err error
+		if binding.Spec.TokenRef != nil {
+			token, err = r.linkPinnedToken(ctx, sp, &binding)
+		} else {
+			token, err = r.linkNamedToken(ctx, sp, &binding)
+		}
+		if err != nil {
+			lg.Error(err, "unable to link the named token")
+			return ctrl.Result{}, NewReconcileError(err, "failed to link the named token")
+		}
+		if token == nil {
+			// the reason is already recorded in the status. We'll get reconciled again once the token appears.
+			return ctrl.Result{}, nil
+		}
+
+		lg = lg.WithValues("linked_to", binding.Status.LinkedAccessTokenName, "token_phase", token.Status.Phase)
+	} else if binding.Status.LinkedAccessTokenName == "" {
 		var err error
 		token, err = r.linkToken(ctx, sp, &binding)
 		if err != nil {
@@ -162,8 +335,11 @@ func (r *SPIAccessTokenBindingReconciler) Reconcile(ctx context.Context, req ctr
 		}
 		lg = lg.WithValues("token_phase", token.Status.Phase)
 
-		if token.Status.Phase == api.SPIAccessTokenPhaseReady && binding.Status.SyncedObjectRef.Name == "" {
-			// we've not yet synced the token... let's check that it fulfills the reqs
+		permissionsReduced := r.syncedTokenLostPermissions(ctx, sp, &binding, token)
+
+		if token.Status.Phase == api.SPIAccessTokenPhaseReady && (binding.Status.SyncedObjectRef.Name == "" || permissionsReduced) {
+			// we've not yet synced the token (or the token no longer seems to have the permissions it had when we
+			// synced it)... let's check that it fulfills the reqs
 			newToken, err := sp.LookupToken(ctx, r.Client, &binding)
 			if err != nil {
 				return ctrl.Result{}, NewReconcileError(err, "failed to lookup token before definitely assigning it to the binding")
@@ -173,7 +349,11 @@ func (r *SPIAccessTokenBindingReconciler) Reconcile(ctx context.Context, req ctr
 				// We can't do much here - the user granted the token the access we requested, but we still don't match
 				binding.Status.Phase = api.SPIAccessTokenBindingPhaseError
 				binding.Status.OAuthUrl = ""
-				r.updateBindingStatusError(ctx, &binding, api.SPIAccessTokenBindingErrorReasonLinkedToken, fmt.Errorf("linked token doesn't match the criteria"))
+				if permissionsReduced {
+					r.updateBindingStatusError(ctx, &binding, api.SPIAccessTokenBindingErrorReasonTokenPermissionsReduced, fmt.Errorf("the permissions of the linked token were reduced in the service provider and no other token matches the criteria"))
+				} else {
+					r.updateBindingStatusError(ctx, &binding, api.SPIAccessTokenBindingErrorReasonLinkedToken, fmt.Errorf("linked token doesn't match the criteria"))
+				}
 				return ctrl.Result{}, nil
 			}
 
@@ -187,8 +367,6 @@ func (r *SPIAccessTokenBindingReconciler) Reconcile(ctx context.Context, req ctr
 		} else if token.Status.Phase != api.SPIAccessTokenPhaseReady {
 			// let's try to do a lookup in case another token started matching our reqs
 			// this time, only do the lookup in SP and don't create a new token if no match found
-			//
-			// yes, this can create garbage - abandoned tokens, see https://issues.redhat.com/browse/SVPI-65
 			newToken, err := sp.LookupToken(ctx, r.Client, &binding)
 			if err != nil {
 				lg.Error(err, "failed lookup when trying to reassign linked token")
@@ -200,6 +378,9 @@ func (r *SPIAccessTokenBindingReconciler) Reconcile(ctx context.Context, req ctr
 				if err = r.persistWithMatchingLabels(ctx, &binding, newToken); err != nil {
 					return ctrl.Result{}, NewReconcileError(err, "failed to persist the newly matching token")
 				}
+				if r.ServiceProviderFactory.Configuration.Get().RelinkBindings {
+					r.deleteAbandonedToken(ctx, &binding, token)
+				}
 				token = newToken
 				lg = lg.WithValues("new_token_phase", token.Status.Phase, "new_token", newToken.Name)
 			}
@@ -207,21 +388,62 @@ func (r *SPIAccessTokenBindingReconciler) Reconcile(ctx context.Context, req ctr
 	}
 
 	binding.Status.OAuthUrl = token.Status.OAuthUrl
+	passBindingStage(&binding, api.SPIAccessTokenBindingConditionTokenMatched, "TokenLinked")
+
+	if err := syncLinkedBindings(ctx, r.Client, client.ObjectKeyFromObject(token), &binding); err != nil {
+		return ctrl.Result{}, NewReconcileError(err, "failed to record the binding in the linked token")
+	}
 
-	existingSyncedSecretName := ""
+	existingSyncedObject := api.TargetObjectRef{}
+	firstSync := false
 	switch token.Status.Phase {
 	case api.SPIAccessTokenPhaseReady:
+		if !binding.MayUseToken(token) {
+			lg.Info("the linked token is owned by another user", "owner", token.Annotations[api.TokenOwnerAnnotation])
+			r.denyTokenUse(ctx, &binding, api.SPIAccessTokenBindingErrorReasonTokenOwnership,
+				fmt.Errorf("the token is owned by %s and the binding was not created by them", token.Annotations[api.TokenOwnerAnnotation]))
+			return ctrl.Result{}, nil
+		}
+
+		decision, err := r.checkBindingPolicy(ctx, &binding, token)
+		if err != nil {
+			r.updateBindingStatusError(ctx, &binding, api.SPIAccessTokenBindingErrorReasonPolicy, err)
+			return ctrl.Result{}, NewReconcileError(err, "failed to check the binding policy")
+		}
+		if !decision.Allowed {
+			lg.Info("the binding policy denied the use of the token", "reason", decision.Reason)
+			r.denyTokenUse(ctx, &binding, api.SPIAccessTokenBindingErrorReasonPolicy, fmt.Errorf("the binding policy denied the use of the token: %s", decision.Reason))
+			return ctrl.Result{RequeueAfter: bindingPolicyRecheckInterval}, nil
+		}
+
+		// the many bindings linked to the same token share the token data through the caching token storage, so the
+		// data is only read from the backing storage once for all of them
 		ref, err := r.syncSecret(ctx, sp, &binding, token)
 		if err != nil {
 			lg.Error(err, "unable to sync the secret")
 			return ctrl.Result{}, NewReconcileError(err, "failed to sync the secret")
 		}
+		// the bindings synced before the first sync time was recorded are not considered
+		if binding.Status.FirstSyncTime == nil && binding.Status.SyncedObjectRef.Name == "" {
+			firstSync = true
+			now := metav1.Now()
+			binding.Status.FirstSyncTime = &now
+		}
 		binding.Status.SyncedObjectRef = ref
 		binding.Status.Phase = api.SPIAccessTokenBindingPhaseInjected
+		startBindingLease(&binding, time.Now())
+		passBindingStage(&binding, api.SPIAccessTokenBindingConditionTokenDataAvailable, "TokenDataRead")
+		passBindingStage(&binding, api.SPIAccessTokenBindingConditionSecretRendered, "SecretDataRendered")
+		passBindingStage(&binding, api.SPIAccessTokenBindingConditionSecretSynced, "SecretSynced")
 	default:
 		binding.Status.Phase = api.SPIAccessTokenBindingPhaseAwaitingTokenData
-		existingSyncedSecretName = binding.Status.SyncedObjectRef.Name
+		failBindingStage(&binding, api.SPIAccessTokenBindingConditionTokenDataAvailable, string(api.SPIAccessTokenBindingPhaseAwaitingTokenData),
+			fmt.Sprintf("the linked token is in the %s phase", token.Status.Phase))
+		existingSyncedObject = binding.Status.SyncedObjectRef
 		binding.Status.SyncedObjectRef = api.TargetObjectRef{}
+		if err := r.deleteWriteBack(ctx, &binding); err != nil {
+			lg.Error(err, "failed to delete the stale write-back data")
+		}
 	}
 
 	if err := r.updateBindingStatusSuccess(ctx, &binding); err != nil {
@@ -229,10 +451,17 @@ func (r *SPIAccessTokenBindingReconciler) Reconcile(ctx context.Context, req ctr
 		return ctrl.Result{}, NewReconcileError(err, "failed to update the status")
 	}
 
+	if firstSync {
+		reportBindingFirstSync(&binding, token, string(sp.GetType()))
+	}
+	if binding.Status.Phase == api.SPIAccessTokenBindingPhaseInjected && phaseAtStart != api.SPIAccessTokenBindingPhaseInjected {
+		emitBindingEvent(ctx, r.Events, cloudevents.BindingSecretSynced, &binding)
+	}
+
 	// now that we set up the binding correctly, we need to clean up the potentially dangling secret (that might contain
 	// stale data if the data of the token disappeared from the token)
 	if binding.Status.Phase == api.SPIAccessTokenBindingPhaseAwaitingTokenData {
-		if err := r.deleteSyncedSecret(ctx, existingSyncedSecretName, binding.Namespace); err != nil {
+		if err := r.deleteSyncedObject(ctx, existingSyncedObject, binding.Namespace); err != nil {
 			lg.Error(err, "failed to delete the stale synced object")
 			// note that we don't actually set any error on the binding itself, because it no longer references the
 			// secret. The secret will get cleaned up once the binding is deleted because of the owner reference.
@@ -241,16 +470,46 @@ func (r *SPIAccessTokenBindingReconciler) Reconcile(ctx context.Context, req ctr
 
 	lg.Info("reconciliation complete")
 
+	if binding.Status.Phase == api.SPIAccessTokenBindingPhaseInjected && binding.Status.SyncedObjectRef.ExpirationTime != nil {
+		// make sure we're back in time to replace the ephemeral token before it expires
+		return ctrl.Result{RequeueAfter: time.Until(ephemeralTokenRefreshTime(binding.Status.SyncedObjectRef))}, nil
+	}
+
 	return ctrl.Result{}, nil
 }
 
+// denyTokenUse records the reason why the binding may not use its linked token in the status of the binding and
+// deletes the data the binding has synced so far, because the binding is no longer allowed to use it.
+func (r *SPIAccessTokenBindingReconciler) denyTokenUse(ctx context.Context, binding *api.SPIAccessTokenBinding, reason api.SPIAccessTokenBindingErrorReason, err error) {
+	lg := log.FromContext(ctx)
+
+	if err := r.deleteWriteBack(ctx, binding); err != nil {
+		lg.Error(err, "failed to delete the data written back before the use of the token was denied")
+	}
+
+	synced := binding.Status.SyncedObjectRef
+	binding.Status.Phase = api.SPIAccessTokenBindingPhaseError
+	binding.Status.SyncedObjectRef = api.TargetObjectRef{}
+	r.updateBindingStatusError(ctx, binding, reason, err)
+
+	if err := r.deleteSyncedObject(ctx, synced, binding.Namespace); err != nil {
+		lg.Error(err, "failed to delete the object synced before the use of the token was denied")
+	}
+}
+
 // getServiceProvider obtains the service provider instance according to the repository URL from the binding's spec.
 // The status of the binding is immediately persisted with an error if the service provider cannot be determined.
 func (r *SPIAccessTokenBindingReconciler) getServiceProvider(ctx context.Context, binding *api.SPIAccessTokenBinding) (serviceprovider.ServiceProvider, *ReconcileError) {
-	serviceProvider, err := r.ServiceProviderFactory.FromRepoUrl(binding.Spec.RepoUrl)
+	serviceProvider, err := r.ServiceProviderFactory.FromRepoUrlInNamespace(ctx, binding.Spec.RepoUrl, binding.Namespace)
 	if err != nil {
+		reason := api.SPIAccessTokenBindingErrorReasonUnknownServiceProviderType
+		if reportOAuthNotConfigured(err) {
+			reason = api.SPIAccessTokenBindingErrorReasonOAuthNotConfigured
+		} else if stderrors.Is(err, serviceprovider.ErrUrlNotAllowed) {
+			reason = api.SPIAccessTokenBindingErrorReasonRepoUrlNotAllowed
+		}
 		binding.Status.Phase = api.SPIAccessTokenBindingPhaseError
-		r.updateBindingStatusError(ctx, binding, api.SPIAccessTokenBindingErrorReasonUnknownServiceProviderType, err)
+		r.updateBindingStatusError(ctx, binding, reason, err)
 		return nil, NewReconcileError(err, "failed to find the service provider")
 	}
 
@@ -280,12 +539,22 @@ func (r *SPIAccessTokenBindingReconciler) linkToken(ctx context.Context, sp serv
 			ObjectMeta: metav1.ObjectMeta{
 				GenerateName: "generated-spi-access-token-",
 				Namespace:    binding.Namespace,
+				Annotations: map[string]string{
+					api.GeneratedForBindingAnnotation: binding.Name,
+				},
 			},
 			Spec: api.SPIAccessTokenSpec{
-				Permissions:        binding.Spec.Permissions,
+				Permissions:        newTokenPermissions(binding),
 				ServiceProviderUrl: serviceProviderUrl,
 			},
 		}
+		if creator := binding.Annotations[api.BindingCreatorAnnotation]; creator != "" && r.ServiceProviderFactory.Configuration != nil &&
+			brokerIdentityProvider(r.ServiceProviderFactory.Configuration.Get(), sp) != "" {
+			// the data of the brokered tokens is obtained on behalf of their owners
+			token.Annotations[api.TokenOwnerAnnotation] = creator
+		}
+		// we already know the service provider, so let's label the token right away so that it is visible to the lookups
+		token.EnsureLabels(sp.GetType())
 
 		if err := r.Client.Create(ctx, token); err != nil {
 			r.updateBindingStatusError(ctx, binding, api.SPIAccessTokenBindingErrorReasonLinkedToken, err)
@@ -302,8 +571,232 @@ func (r *SPIAccessTokenBindingReconciler) linkToken(ctx context.Context, sp serv
 	return token, nil
 }
 
+// deleteAbandonedToken deletes the token the binding was linked to before being relinked to another token, if the
+// token was created by the operator, has no data and no other binding is linked to it. The failures are only logged,
+// because the binding itself is already relinked.
+func (r *SPIAccessTokenBindingReconciler) deleteAbandonedToken(ctx context.Context, relinked *api.SPIAccessTokenBinding, token *api.SPIAccessToken) {
+	lg := log.FromContext(ctx).WithValues("abandoned_token", token.Name)
+
+	if _, ok := token.Annotations[api.GeneratedForBindingAnnotation]; !ok || token.Status.Phase == api.SPIAccessTokenPhaseReady {
+		return
+	}
+
+	linked := &api.SPIAccessTokenBindingList{}
+	if err := r.Client.List(ctx, linked, client.InNamespace(token.Namespace), client.MatchingLabels{
+		config.SPIAccessTokenLinkLabel: token.Name,
+	}); err != nil {
+		lg.Error(err, "failed to check whether the abandoned token is still linked to other bindings")
+		return
+	}
+	for _, b := range linked.Items {
+		// the cache might not have caught up with the relinking yet
+		if b.UID != relinked.UID {
+			return
+		}
+	}
+
+	if err := r.Client.Delete(ctx, token, client.Preconditions{UID: &token.UID}); err != nil && !errors.IsNotFound(err) {
+		lg.Error(err, "failed to delete the abandoned token")
+		return
+	}
+
+	lg.Info("deleted the token abandoned after relinking the binding")
+}
+
+// linkNamedToken updates the binding with a link to the SPIAccessToken named in its token policy. If the token cannot be
+// used, the reason is recorded in the status of the binding and nil token is returned.
+func (r *SPIAccessTokenBindingReconciler) linkNamedToken(ctx context.Context, sp serviceprovider.ServiceProvider, binding *api.SPIAccessTokenBinding) (*api.SPIAccessToken, error) {
+	tokenName := binding.Spec.TokenPolicy.TokenName
+	if tokenName == "" {
+		binding.Status.Phase = api.SPIAccessTokenBindingPhaseError
+		r.updateBindingStatusError(ctx, binding, api.SPIAccessTokenBindingErrorReasonTokenPolicy, fmt.Errorf("the token policy of type %s requires the token name", api.TokenPolicyTypeNamed))
+		return nil, nil
+	}
+
+	token, err := r.getRequestedToken(ctx, sp, binding, tokenName, "the token policy", api.SPIAccessTokenBindingErrorReasonTokenPolicy)
+	if token == nil || err != nil {
+		return nil, err
+	}
+
+	covered, err := r.namedTokenCoversBinding(ctx, sp, binding, token)
+	if err != nil {
+		return nil, NewReconcileError(err, "failed to check the permissions of the token from the token policy")
+	}
+	if !covered {
+		// we're reconciled again once the token changes
+		binding.Status.Phase = api.SPIAccessTokenBindingPhaseError
+		r.updateBindingStatusError(ctx, binding, api.SPIAccessTokenBindingErrorReasonTokenPolicy,
+			fmt.Errorf("the token '%s' from the token policy doesn't have the permissions required by the binding", tokenName))
+		return nil, nil
+	}
+
+	if err := r.persistWithMatchingLabels(ctx, binding, token); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// linkPinnedToken updates the binding with a link to the SPIAccessToken referenced by its spec.tokenRef. Unlike with
+// the token policies, the permissions of the token are not checked. If the token cannot be used, the reason is recorded
+// in the status of the binding and nil token is returned.
+func (r *SPIAccessTokenBindingReconciler) linkPinnedToken(ctx context.Context, sp serviceprovider.ServiceProvider, binding *api.SPIAccessTokenBinding) (*api.SPIAccessToken, error) {
+	if policy := binding.Spec.TokenPolicy.Type; policy != "" && policy != api.TokenPolicyTypeExact {
+		binding.Status.Phase = api.SPIAccessTokenBindingPhaseError
+		r.updateBindingStatusError(ctx, binding, api.SPIAccessTokenBindingErrorReasonTokenRef, fmt.Errorf("the token reference cannot be combined with the token policy of type %s", policy))
+		return nil, nil
+	}
+
+	token, err := r.getRequestedToken(ctx, sp, binding, binding.Spec.TokenRef.Name, "the token reference", api.SPIAccessTokenBindingErrorReasonTokenRef)
+	if token == nil || err != nil {
+		return nil, err
+	}
+
+	if err := r.persistWithMatchingLabels(ctx, binding, token); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// getRequestedToken reads the SPIAccessToken the user requested the binding to be linked to and checks that it is for
+// the same service provider as the binding. The source describes where the token was requested in the error messages.
+// If the token cannot be used, the reason is recorded in the status of the binding and nil token is returned.
+func (r *SPIAccessTokenBindingReconciler) getRequestedToken(ctx context.Context, sp serviceprovider.ServiceProvider, binding *api.SPIAccessTokenBinding, tokenName string, source string, reason api.SPIAccessTokenBindingErrorReason) (*api.SPIAccessToken, error) {
+	token := &api.SPIAccessToken{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: tokenName, Namespace: binding.Namespace}, token); err != nil {
+		if errors.IsNotFound(err) {
+			binding.Status.Phase = api.SPIAccessTokenBindingPhaseError
+			r.updateBindingStatusError(ctx, binding, reason, fmt.Errorf("the token '%s' from %s doesn't exist", tokenName, source))
+			return nil, nil
+		}
+		return nil, NewReconcileError(err, "failed to get the token from "+source)
+	}
+
+	if strings.TrimSuffix(token.Spec.ServiceProviderUrl, "/") != strings.TrimSuffix(sp.GetBaseUrl(), "/") {
+		binding.Status.Phase = api.SPIAccessTokenBindingPhaseError
+		r.updateBindingStatusError(ctx, binding, reason,
+			fmt.Errorf("the token '%s' from %s is for a different service provider (%s) than the repository (%s)", tokenName, source, token.Spec.ServiceProviderUrl, sp.GetBaseUrl()))
+		return nil, nil
+	}
+
+	return token, nil
+}
+
+// namedTokenCoversBinding checks that the token named in the token policy of the binding has the permissions required by
+// the binding. The ready tokens are checked by the offline token filter of the service provider, if it has one, which
+// uses the metadata of what the token can actually access. Otherwise, the permissions requested for the token need to
+// cover the permissions of the binding.
+func (r *SPIAccessTokenBindingReconciler) namedTokenCoversBinding(ctx context.Context, sp serviceprovider.ServiceProvider, binding *api.SPIAccessTokenBinding, token *api.SPIAccessToken) (bool, error) {
+	filter := r.ServiceProviderFactory.OfflineTokenFilter(sharedConfig.ServiceProviderType(sp.GetType()))
+	if token.Status.Phase == api.SPIAccessTokenPhaseReady && token.Status.TokenMetadata != nil && filter != nil {
+		matches, err := filter.Matches(ctx, binding, token)
+		if err != nil {
+			return false, fmt.Errorf("failed to match the token to the binding: %w", err)
+		}
+		return matches, nil
+	}
+
+	return permissionsCover(&token.Spec.Permissions, &binding.Spec.Permissions), nil
+}
+
+// syncedTokenLostPermissions checks whether the Ready token the binding already synced its secret from no longer has
+// the permissions required by the binding according to its cached metadata, e.g. because the user reduced the scopes of
+// the token in the service provider. Only the service providers with the offline token filter are checked.
+func (r *SPIAccessTokenBindingReconciler) syncedTokenLostPermissions(ctx context.Context, sp serviceprovider.ServiceProvider, binding *api.SPIAccessTokenBinding, token *api.SPIAccessToken) bool {
+	if binding.Status.SyncedObjectRef.Name == "" || token.Status.Phase != api.SPIAccessTokenPhaseReady || token.Status.TokenMetadata == nil {
+		return false
+	}
+
+	filter := r.ServiceProviderFactory.OfflineTokenFilter(sharedConfig.ServiceProviderType(sp.GetType()))
+	if filter == nil {
+		return false
+	}
+
+	matches, err := filter.Matches(ctx, binding, token)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "failed to check the permissions of the linked token")
+		return false
+	}
+
+	return !matches
+}
+
+// permissionsCover checks that the provided permissions contain all the required permissions and additional scopes.
+func permissionsCover(permissions *api.Permissions, required *api.Permissions) bool {
+	readable := map[api.PermissionArea]bool{}
+	writable := map[api.PermissionArea]bool{}
+	for _, p := range permissions.Required {
+		readable[p.Area] = readable[p.Area] || p.Type.IsRead()
+		writable[p.Area] = writable[p.Area] || p.Type.IsWrite()
+	}
+
+	for _, rp := range required.Required {
+		if (rp.Type.IsRead() && !readable[rp.Area]) || (rp.Type.IsWrite() && !writable[rp.Area]) {
+			return false
+		}
+	}
+
+	for _, rs := range required.AdditionalScopes {
+		covered := false
+		for _, s := range permissions.AdditionalScopes {
+			if s == rs {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+
+	return true
+}
+
+// newTokenPermissions returns the permissions of the token created for the binding according to its token policy.
+func newTokenPermissions(binding *api.SPIAccessTokenBinding) api.Permissions {
+	if binding.Spec.TokenPolicy.Type != api.TokenPolicyTypeSuperset {
+		return binding.Spec.Permissions
+	}
+
+	ret := api.Permissions{}
+
+	for _, perms := range []api.Permissions{binding.Spec.Permissions, binding.Spec.TokenPolicy.AdditionalPermissions} {
+		for _, p := range perms.Required {
+			if !containsPermission(ret.Required, p) {
+				ret.Required = append(ret.Required, p)
+			}
+		}
+		for _, s := range perms.AdditionalScopes {
+			if !containsString(ret.AdditionalScopes, s) {
+				ret.AdditionalScopes = append(ret.AdditionalScopes, s)
+			}
+		}
+	}
+
+	return ret
+}
+
+func containsPermission(perms []api.Permission, perm api.Permission) bool {
+	for _, p := range perms {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
+
 func (r *SPIAccessTokenBindingReconciler) persistWithMatchingLabels(ctx context.Context, binding *api.SPIAccessTokenBinding, token *api.SPIAccessToken) error {
-	if binding.Labels[config.SPIAccessTokenLinkLabel] != token.Name {
+	if previous := binding.Labels[config.SPIAccessTokenLinkLabel]; previous != token.Name {
 		if binding.Labels == nil {
 			binding.Labels = map[string]string{}
 		}
@@ -313,6 +806,10 @@ func (r *SPIAccessTokenBindingReconciler) persistWithMatchingLabels(ctx context.
 			r.updateBindingStatusError(ctx, binding, api.SPIAccessTokenBindingErrorReasonLinkedToken, err)
 			return NewReconcileError(err, "failed to update the binding with the token link")
 		}
+
+		if err := syncLinkedBindings(ctx, r.Client, client.ObjectKey{Name: previous, Namespace: binding.Namespace}, binding); err != nil {
+			return NewReconcileError(err, "failed to remove the binding from the previously linked token")
+		}
 	}
 
 	if binding.Status.LinkedAccessTokenName != token.Name {
@@ -327,11 +824,22 @@ func (r *SPIAccessTokenBindingReconciler) persistWithMatchingLabels(ctx context.
 	return nil
 }
 
+// statusUpdateCoalescingInterval returns the interval within which the successive status updates of a binding are
+// coalesced.
+func (r *SPIAccessTokenBindingReconciler) statusUpdateCoalescingInterval() time.Duration {
+	if r.ServiceProviderFactory.Configuration == nil {
+		return 0
+	}
+	return r.ServiceProviderFactory.Configuration.Get().StatusUpdateCoalescingInterval
+}
+
 // updateBindingStatusError updates the status of the binding with the provided error
 func (r *SPIAccessTokenBindingReconciler) updateBindingStatusError(ctx context.Context, binding *api.SPIAccessTokenBinding, reason api.SPIAccessTokenBindingErrorReason, err error) {
 	binding.Status.ErrorMessage = err.Error()
 	binding.Status.ErrorReason = reason
-	if err := r.Client.Status().Update(ctx, binding); err != nil {
+	binding.Status.ServiceProviderError = serviceProviderErrorDetails(err)
+	failBindingStageWithError(binding, reason, err.Error())
+	if err := updateBindingStatusIfChanged(ctx, r.Client, &r.statusUpdates, r.statusUpdateCoalescingInterval(), binding); err != nil {
 		log.FromContext(ctx).Error(err, "failed to update the status with error", "reason", reason, "error", err)
 	}
 }
@@ -340,7 +848,8 @@ func (r *SPIAccessTokenBindingReconciler) updateBindingStatusError(ctx context.C
 func (r *SPIAccessTokenBindingReconciler) updateBindingStatusSuccess(ctx context.Context, binding *api.SPIAccessTokenBinding) error {
 	binding.Status.ErrorMessage = ""
 	binding.Status.ErrorReason = ""
-	if err := r.Client.Status().Update(ctx, binding); err != nil {
+	binding.Status.ServiceProviderError = nil
+	if err := updateBindingStatusIfChanged(ctx, r.Client, &r.statusUpdates, r.statusUpdateCoalescingInterval(), binding); err != nil {
 		return NewReconcileError(err, "failed to update status")
 	}
 	return nil
@@ -349,27 +858,69 @@ func (r *SPIAccessTokenBindingReconciler) updateBindingStatusSuccess(ctx context
 // syncSecret creates/updates/deletes the secret specified in the binding with the token data and returns a reference
 // to the secret.
 func (r *SPIAccessTokenBindingReconciler) syncSecret(ctx context.Context, sp serviceprovider.ServiceProvider, binding *api.SPIAccessTokenBinding, tokenObject *api.SPIAccessToken) (api.TargetObjectRef, error) {
+	token, err := r.getTokenData(ctx, binding, tokenObject)
+	if err != nil {
+		return api.TargetObjectRef{}, err
+	}
+
+	return r.syncSecretWithData(ctx, sp, binding, tokenObject, token)
+}
+
+// getTokenData reads the data of the token from the token storage. The status of the binding is updated with an error
+// if the data cannot be read.
+func (r *SPIAccessTokenBindingReconciler) getTokenData(ctx context.Context, binding *api.SPIAccessTokenBinding, tokenObject *api.SPIAccessToken) (*api.Token, error) {
 	token, err := r.TokenStorage.Get(ctx, tokenObject)
 	if err != nil {
 		r.updateBindingStatusError(ctx, binding, api.SPIAccessTokenBindingErrorReasonTokenRetrieval, err)
-		return api.TargetObjectRef{}, NewReconcileError(err, "failed to get the token data from token storage")
+		return nil, NewReconcileError(err, "failed to get the token data from token storage")
 	}
 
 	if token == nil {
 		err = fmt.Errorf("access token data not found")
 		r.updateBindingStatusError(ctx, binding, api.SPIAccessTokenBindingErrorReasonTokenRetrieval, err)
-		return api.TargetObjectRef{}, err
+		return nil, err
 	}
 
-	at, err := sp.MapToken(ctx, binding, tokenObject, token)
+	return token, nil
+}
+
+// syncSecretWithData creates/updates/deletes the secret specified in the binding with the provided token data and
+// returns a reference to the secret.
+func (r *SPIAccessTokenBindingReconciler) syncSecretWithData(ctx context.Context, sp serviceprovider.ServiceProvider, binding *api.SPIAccessTokenBinding, tokenObject *api.SPIAccessToken, token *api.Token) (api.TargetObjectRef, error) {
+	passBindingStage(binding, api.SPIAccessTokenBindingConditionTokenDataAvailable, "TokenDataRead")
+
+	var expirationTime *metav1.Time
+	if binding.Spec.Ephemeral {
+		fresh, err := r.ephemeralTokenFresh(ctx, binding)
+		if err != nil {
+			return api.TargetObjectRef{}, NewReconcileError(err, "failed to check the synced object")
+		}
+		if fresh {
+			// the injected ephemeral token is still fresh enough, there's no need to mint a new one
+			return binding.Status.SyncedObjectRef, nil
+		}
+
+		ephemeralToken, err := r.mintEphemeralToken(ctx, sp, binding, token)
+		if err != nil {
+			return api.TargetObjectRef{}, err
+		}
+		token = ephemeralToken
+		expirationTime = &metav1.Time{Time: time.Unix(int64(token.Expiry), 0)}
+	} else {
+		var err error
+		token, err = withCredential(token, binding.Spec.CredentialFlavor)
+		if err != nil {
+			r.updateBindingStatusError(ctx, binding, api.SPIAccessTokenBindingErrorReasonMissingCredential, err)
+			return api.TargetObjectRef{}, NewReconcileError(err, "failed to find the requested credential in the token data")
+		}
+	}
+
+	stringData, err := renderSecretData(ctx, sp, binding, tokenObject, token)
 	if err != nil {
 		r.updateBindingStatusError(ctx, binding, api.SPIAccessTokenBindingErrorReasonTokenAnalysis, err)
 		return api.TargetObjectRef{}, NewReconcileError(err, "failed to analyze the token to produce the mapping to the secret")
 	}
 
-	stringData := at.ToSecretType(binding.Spec.Secret.Type)
-	at.FillByMapping(&binding.Spec.Secret.Fields, stringData)
-
 	// copy the string data into the byte-array data so that sync works reliably. If we didn't sync, we could have just
 	// used the Secret.StringData, but Sync gives us other goodies.
 	// So let's bite the bullet and convert manually here.
@@ -378,11 +929,117 @@ func (r *SPIAccessTokenBindingReconciler) syncSecret(ctx context.Context, sp ser
 		data[k] = []byte(v)
 	}
 
-	secretName := binding.Status.SyncedObjectRef.Name
+	passBindingStage(binding, api.SPIAccessTokenBindingConditionSecretRendered, "SecretDataRendered")
+
+	checksum := secretDataChecksum(data)
+	previous := binding.Status.SyncedObjectRef
+
+	// the data is written back first, because the ExternalSecrets read it from there
+	if err := r.writeBack(ctx, binding, stringData); err != nil {
+		r.updateBindingStatusError(ctx, binding, api.SPIAccessTokenBindingErrorReasonWriteBack, err)
+		return api.TargetObjectRef{}, NewReconcileError(err, "failed to write back the data of the secret")
+	}
+
+	delivery := binding.Spec.Secret.Delivery
+	if delivery == "" {
+		delivery = api.SecretDeliverySecret
+	}
+
+	kind := "Secret"
+	if delivery == api.SecretDeliveryExternalSecret {
+		kind = r.externalSecrets.externalSecret.Kind
+	} else if delivery == api.SecretDeliveryPod {
+		kind = "SPIAccessTokenBinding"
+	}
+
+	secretName := previous.Name
+	if secretName != "" && previous.Kind != kind {
+		// the delivery changed, so the previously synced object is replaced by an object of the other kind
+		if err := r.deleteSyncedObject(ctx, previous, binding.Namespace); err != nil {
+			return api.TargetObjectRef{}, NewReconcileError(err, "failed to delete the object synced with the previous delivery")
+		}
+		secretName = ""
+	}
 	if secretName == "" {
 		secretName = binding.Spec.Secret.Name
 	}
 
+	var obj client.Object
+	if delivery == api.SecretDeliveryExternalSecret {
+		obj, err = r.syncExternalSecret(ctx, binding, secretName)
+	} else if delivery == api.SecretDeliveryPod {
+		// nothing is synced, the data is rendered again by the PodCredentialsServer when a pod asks for it
+		obj = &api.SPIAccessTokenBinding{
+			TypeMeta:   metav1.TypeMeta{Kind: kind, APIVersion: api.GroupVersion.String()},
+			ObjectMeta: metav1.ObjectMeta{Name: binding.Name, UID: binding.UID},
+		}
+	} else {
+		obj, err = r.syncSecretObject(ctx, binding, secretName, data)
+	}
+	if err != nil {
+		reason := api.SPIAccessTokenBindingErrorReasonTokenSync
+		if stderrors.As(err, &secretConflictError{}) {
+			reason = api.SPIAccessTokenBindingErrorReasonSecretConflict
+		}
+		r.updateBindingStatusError(ctx, binding, reason, err)
+		return api.TargetObjectRef{}, NewReconcileError(err, "failed to sync the secret with the token data")
+	}
+
+	ref := toObjectRef(obj)
+	ref.DataChecksum = checksum
+
+	// only move the sync time when the data actually changed so that the consumers can rely on it and so that we don't
+	// update the status of the binding needlessly
+	if previous.LastSyncTime != nil && previous.UID == ref.UID && previous.DataChecksum == ref.DataChecksum {
+		ref.LastSyncTime = previous.LastSyncTime
+	} else {
+		now := metav1.Now()
+		ref.LastSyncTime = &now
+	}
+
+	ref.ExpirationTime = expirationTime
+	ref.SyncedGeneration = binding.Generation
+
+	return ref, nil
+}
+
+// renderSecretData maps the provided token data to the data of the secret requested by the binding.
+func renderSecretData(ctx context.Context, sp serviceprovider.ServiceProvider, binding *api.SPIAccessTokenBinding, tokenObject *api.SPIAccessToken, token *api.Token) (map[string]string, error) {
+	at, err := sp.MapToken(ctx, binding, tokenObject, token)
+	if err != nil {
+		return nil, err
+	}
+	at.RegistryUrl = binding.Spec.RepoUrl
+	at.MavenServerId = binding.Spec.Secret.MavenServerId
+	at.HelmRepositoryName = binding.Spec.Secret.HelmRepositoryName
+	if repoUrl, err := url.Parse(binding.Spec.RepoUrl); err == nil {
+		if at.MavenServerId == "" {
+			at.MavenServerId = repoUrl.Hostname()
+		}
+		if at.HelmRepositoryName == "" {
+			at.HelmRepositoryName = repoUrl.Hostname()
+		}
+	}
+
+	stringData := at.ToSecretType(binding.Spec.Secret.Type)
+	if binding.Spec.Secret.EnvKeys {
+		for k, v := range at.ToEnv(sp.GetType(), binding.Spec.Secret.EnvPrefix) {
+			stringData[k] = v
+		}
+	}
+	at.FillByMapping(&binding.Spec.Secret.Fields, stringData)
+
+	return stringData, nil
+}
+
+// syncSecretObject creates or updates the secret with the provided data.
+func (r *SPIAccessTokenBindingReconciler) syncSecretObject(ctx context.Context, binding *api.SPIAccessTokenBinding, secretName string, data map[string][]byte) (client.Object, error) {
+	labels := make(map[string]string, len(binding.Spec.Secret.Labels)+1)
+	for k, v := range binding.Spec.Secret.Labels {
+		labels[k] = v
+	}
+	labels[sharedConfig.ManagedSecretLabel] = sharedConfig.ManagedSecretLabelValue
+
 	secret := &corev1.Secret{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "Secret",
@@ -391,7 +1048,7 @@ func (r *SPIAccessTokenBindingReconciler) syncSecret(ctx context.Context, sp ser
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        secretName,
 			Namespace:   binding.GetNamespace(),
-			Labels:      binding.Spec.Secret.Labels,
+			Labels:      labels,
 			Annotations: binding.Spec.Secret.Annotations,
 		},
 		Data: data,
@@ -400,23 +1057,267 @@ func (r *SPIAccessTokenBindingReconciler) syncSecret(ctx context.Context, sp ser
 
 	if secret.Name == "" {
 		secret.GenerateName = binding.Name + "-secret-"
+	} else if err := r.checkSecretOwnership(ctx, binding, &corev1.Secret{TypeMeta: secret.TypeMeta, ObjectMeta: metav1.ObjectMeta{Name: secret.Name, Namespace: secret.Namespace}}); err != nil {
+		return nil, err
 	}
 
 	_, obj, err := r.syncer.Sync(ctx, binding, secret, secretDiffOpts)
+	if err == nil && !metav1.IsControlledBy(obj, binding) {
+		// another binding created the secret after we checked it
+		err = secretConflictError{kind: "Secret", name: obj.GetName()}
+	}
+	return obj, err
+}
+
+// secretConflictError is returned when the object the binding should sync exists and is not controlled by the binding.
+type secretConflictError struct {
+	kind string
+	name string
+}
+
+func (e secretConflictError) Error() string {
+	return fmt.Sprintf("the %s '%s' already exists and is not controlled by the binding", e.kind, e.name)
+}
+
+// checkSecretOwnership makes sure that the binding doesn't take over the provided object (a secret or an external
+// secret) if it already exists and is controlled by someone else, e.g. another binding requesting the same secret
+// name or the user. The object is loaded from the cluster. Returns secretConflictError if the binding must not sync
+// the object.
+func (r *SPIAccessTokenBindingReconciler) checkSecretOwnership(ctx context.Context, binding *api.SPIAccessTokenBinding, obj client.Object) error {
+	kind := obj.GetObjectKind().GroupVersionKind().Kind
+	if err := r.Client.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read the object to sync: %w", err)
+	}
+
+	if !metav1.IsControlledBy(obj, binding) {
+		log.FromContext(ctx).Info("refusing to overwrite an object not controlled by the binding", "name", obj.GetName(), "owners", obj.GetOwnerReferences())
+		return secretConflictError{kind: kind, name: obj.GetName()}
+	}
+
+	return nil
+}
+
+// linkedTokenData returns the data of the token linked to the binding or nil if the binding is not linked yet or
+// the data cannot be read. It is only used to throttle the work with the service provider, the failures are handled
+// by the code actually needing the data.
+func (r *SPIAccessTokenBindingReconciler) linkedTokenData(ctx context.Context, binding *api.SPIAccessTokenBinding) *api.Token {
+	if binding.Status.LinkedAccessTokenName == "" {
+		return nil
+	}
+
+	token := &api.SPIAccessToken{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: binding.Status.LinkedAccessTokenName, Namespace: binding.Namespace}, token); err != nil {
+		return nil
+	}
+
+	data, err := r.TokenStorage.Get(ctx, token)
 	if err != nil {
-		r.updateBindingStatusError(ctx, binding, api.SPIAccessTokenBindingErrorReasonTokenSync, err)
-		return api.TargetObjectRef{}, NewReconcileError(err, "failed to sync the secret with the token data")
+		return nil
 	}
-	return toObjectRef(obj), nil
+	return data
 }
 
-func (r *SPIAccessTokenBindingReconciler) deleteSyncedSecret(ctx context.Context, secretName string, secretNamespace string) error {
-	if secretName == "" {
+// validateWriteBack checks that the write-back requested by the binding can be performed.
+func (r *SPIAccessTokenBindingReconciler) validateWriteBack(binding *api.SPIAccessTokenBinding) error {
+	path := writeBackPath(binding)
+	if path == "" {
 		return nil
 	}
 
-	secret := &corev1.Secret{}
-	if err := r.Client.Get(ctx, client.ObjectKey{Name: secretName, Namespace: secretNamespace}, secret); err != nil {
+	if r.WriteBackStore == nil {
+		return fmt.Errorf("the write-back of the binding data is not enabled in the operator")
+	}
+
+	if binding.Spec.Secret.Delivery == api.SecretDeliveryExternalSecret && r.externalSecrets == nil {
+		return fmt.Errorf("the delivery of the secrets using ExternalSecrets is not enabled in the operator")
+	}
+
+	return writeback.ValidatePath(path)
+}
+
+// writeBackPath returns the path the data of the binding should be written back to or an empty string if the binding
+// doesn't need the write-back.
+func writeBackPath(binding *api.SPIAccessTokenBinding) string {
+	if binding.Spec.WriteBack != nil {
+		return binding.Spec.WriteBack.Vault
+	}
+	if binding.Spec.Secret.Delivery == api.SecretDeliveryExternalSecret {
+		return binding.Name
+	}
+	return ""
+}
+
+// writeBack writes the data of the secret to the external secret store if requested by the binding and records
+// the location in the status of the binding. The data is written even if it didn't change so that the data changed or
+// deleted in the store by someone else is repaired. The data previously written to another location is deleted.
+func (r *SPIAccessTokenBindingReconciler) writeBack(ctx context.Context, binding *api.SPIAccessTokenBinding, data map[string]string) error {
+	if r.WriteBackStore == nil {
+		return nil
+	}
+
+	path := writeBackPath(binding)
+
+	if binding.Status.WriteBackPath != path {
+		if err := r.deleteWriteBack(ctx, binding); err != nil {
+			return err
+		}
+	}
+
+	if path == "" {
+		// nothing is written back anymore, so there's nothing to clean up on deletion
+		if controllerutil.ContainsFinalizer(binding, writeBackFinalizerName) {
+			return r.patchWriteBackFinalizer(ctx, binding, false)
+		}
+		return nil
+	}
+
+	// the finalizer is added before the write so that the data is never left in the store after the binding is deleted
+	if !controllerutil.ContainsFinalizer(binding, writeBackFinalizerName) {
+		if err := r.patchWriteBackFinalizer(ctx, binding, true); err != nil {
+			return err
+		}
+	}
+
+	if err := r.WriteBackStore.Write(ctx, binding, path, data); err != nil {
+		return fmt.Errorf("failed to write the data to '%s': %w", path, err)
+	}
+	binding.Status.WriteBackPath = path
+
+	return nil
+}
+
+// deleteWriteBack deletes the data written back to the external secret store, if any, and clears the location in
+// the status.
+func (r *SPIAccessTokenBindingReconciler) deleteWriteBack(ctx context.Context, binding *api.SPIAccessTokenBinding) error {
+	if r.WriteBackStore == nil || binding.Status.WriteBackPath == "" {
+		return nil
+	}
+
+	if err := r.WriteBackStore.Delete(ctx, binding, binding.Status.WriteBackPath); err != nil {
+		return fmt.Errorf("failed to delete the data written to '%s': %w", binding.Status.WriteBackPath, err)
+	}
+	binding.Status.WriteBackPath = ""
+
+	return nil
+}
+
+// mintEphemeralToken mints a short-lived token for the binding using the provided data of the linked token. The status
+// of the binding is updated with an error if the minting fails.
+func (r *SPIAccessTokenBindingReconciler) mintEphemeralToken(ctx context.Context, sp serviceprovider.ServiceProvider, binding *api.SPIAccessTokenBinding, token *api.Token) (*api.Token, error) {
+	minter, ok := sp.(serviceprovider.EphemeralTokenMinter)
+	if !ok {
+		err := fmt.Errorf("the %s service provider doesn't support ephemeral tokens", sp.GetType())
+		r.updateBindingStatusError(ctx, binding, api.SPIAccessTokenBindingErrorReasonEphemeralTokenUnsupported, err)
+		return nil, err
+	}
+
+	maxValidity := r.ServiceProviderFactory.Configuration.Get().MaxTokenValidity(sharedConfig.ServiceProviderType(sp.GetType()), sp.GetBaseUrl())
+	ephemeralToken, err := minter.MintEphemeralToken(ctx, binding, token, maxValidity)
+	if err == nil {
+		err = checkEphemeralTokenExpiry(sp.GetType(), ephemeralToken, maxValidity, time.Now())
+	}
+	if err != nil {
+		r.updateBindingStatusError(ctx, binding, api.SPIAccessTokenBindingErrorReasonEphemeralTokenMinting, err)
+		return nil, NewReconcileError(err, "failed to mint the ephemeral token")
+	}
+
+	return ephemeralToken, nil
+}
+
+// checkEphemeralTokenExpiry checks that the minted ephemeral token expires and that it doesn't stay valid longer than
+// the provided maximum validity (if not 0).
+func checkEphemeralTokenExpiry(spType api.ServiceProviderType, ephemeralToken *api.Token, maxValidity time.Duration, now time.Time) error {
+	if ephemeralToken.Expiry == 0 {
+		return fmt.Errorf("the ephemeral token minted by the %s service provider has no expiry", spType)
+	}
+	if expiry := time.Unix(int64(ephemeralToken.Expiry), 0); maxValidity > 0 && expiry.After(now.Add(maxValidity)) {
+		return fmt.Errorf("the ephemeral token minted by the %s service provider expires at %s, later than the maximum token validity of %s allows", spType, expiry.UTC().Format(time.RFC3339), maxValidity)
+	}
+	return nil
+}
+
+// ephemeralTokenFresh checks whether the ephemeral token injected to the object synced by the binding can stay in place.
+// That is the case if the token doesn't need to be refreshed yet, the binding didn't change since the sync (so that
+// the mapping of the token to the object stays the same) and the synced object still exists.
+func (r *SPIAccessTokenBindingReconciler) ephemeralTokenFresh(ctx context.Context, binding *api.SPIAccessTokenBinding) (bool, error) {
+	previous := binding.Status.SyncedObjectRef
+	if previous.Name == "" || previous.ExpirationTime == nil || previous.SyncedGeneration != binding.Generation ||
+		!time.Now().Before(ephemeralTokenRefreshTime(previous)) {
+		return false, nil
+	}
+
+	obj := syncedObjectFor(previous)
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: previous.Name, Namespace: binding.Namespace}, obj); err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return obj.GetUID() == previous.UID, nil
+}
+
+// ephemeralTokenRefreshTime returns the time at which the ephemeral token injected to the provided object should be
+// replaced with a new one. The lifetime of the token is measured from the last sync of the object.
+func ephemeralTokenRefreshTime(ref api.TargetObjectRef) time.Time {
+	expiration := ref.ExpirationTime.Time
+	if ref.LastSyncTime == nil || !ref.LastSyncTime.Time.Before(expiration) {
+		return expiration
+	}
+
+	lifetime := expiration.Sub(ref.LastSyncTime.Time)
+	return ref.LastSyncTime.Time.Add(time.Duration(float64(lifetime) * ephemeralTokenRefreshRatio))
+}
+
+// withCredential returns the token data with the credential of the requested flavor in place of the access token so
+// that the service providers map it into the secret the same way they'd map the access token. The expiry only applies
+// to the access token so it is cleared for the other flavors.
+func withCredential(token *api.Token, flavor api.CredentialFlavor) (*api.Token, error) {
+	if flavor == "" || flavor == api.CredentialFlavorAccessToken {
+		return token, nil
+	}
+
+	credential, ok := token.Credential(flavor)
+	if !ok {
+		return nil, fmt.Errorf("the token data doesn't contain the %s credential", flavor)
+	}
+
+	copied := *token
+	copied.AccessToken = credential
+	copied.Expiry = 0
+	return &copied, nil
+}
+
+// secretDataChecksum computes the checksum of the secret data as documented on the TargetObjectRef.DataChecksum.
+func secretDataChecksum(data map[string][]byte) string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	hash := sha256.New()
+	for _, k := range keys {
+		hash.Write([]byte(k))
+		hash.Write([]byte{0})
+		hash.Write(data[k])
+		hash.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func (r *SPIAccessTokenBindingReconciler) deleteSyncedObject(ctx context.Context, ref api.TargetObjectRef, namespace string) error {
+	if ref.Name == "" || ref.Kind == "SPIAccessTokenBinding" {
+		// the data delivered into the pods doesn't live in any object
+		return nil
+	}
+
+	secret := syncedObjectFor(ref)
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: ref.Name, Namespace: namespace}, secret); err != nil {
 		if errors.IsNotFound(err) {
 			return nil
 		}
@@ -427,13 +1328,85 @@ func (r *SPIAccessTokenBindingReconciler) deleteSyncedSecret(ctx context.Context
 	return r.Client.Delete(ctx, secret)
 }
 
+// syncedObjectFor returns an empty object of the kind of the synced object referenced by the provided ref.
+func syncedObjectFor(ref api.TargetObjectRef) client.Object {
+	if ref.Kind != "Secret" && ref.ApiVersion != "" {
+		return newUnstructured(schema.FromAPIVersionAndKind(ref.ApiVersion, ref.Kind))
+	}
+	return &corev1.Secret{}
+}
+
 // toObjectRef creates a reference to a kubernetes object within the same namespace (i.e, a struct containing the name,
-// kind and API version of the target object).
+// kind, API version and UID of the target object).
 func toObjectRef(obj client.Object) api.TargetObjectRef {
 	apiVersion, kind := obj.GetObjectKind().GroupVersionKind().ToAPIVersionAndKind()
 	return api.TargetObjectRef{
 		Name:       obj.GetName(),
 		Kind:       kind,
 		ApiVersion: apiVersion,
+		UID:        obj.GetUID(),
+	}
+}
+
+// finalizeWriteBack deletes the data the deleted binding wrote back to the external secret store and removes
+// the write-back finalizer. The finalizer is also removed when the write-back is not enabled in the operator anymore,
+// so that the bindings can be deleted. Their data is left in the store in that case.
+func (r *SPIAccessTokenBindingReconciler) finalizeWriteBack(ctx context.Context, binding *api.SPIAccessTokenBinding) error {
+	if !controllerutil.ContainsFinalizer(binding, writeBackFinalizerName) {
+		return nil
 	}
+
+	if r.WriteBackStore != nil {
+		if binding.DeletionTimestamp == nil {
+			return nil
+		}
+		if err := deleteWrittenBackData(ctx, r.WriteBackStore, binding); err != nil {
+			return err
+		}
+	} else {
+		log.FromContext(ctx).Info("the write-back is not enabled, leaving the data written back by the binding in place", "path", binding.Status.WriteBackPath)
+	}
+
+	return r.patchWriteBackFinalizer(ctx, binding, false)
+}
+
+// patchWriteBackFinalizer adds or removes the write-back finalizer of the binding. Only the finalizers and
+// the resource version of the binding are updated so that the changes to its status made during the reconciliation
+// are kept.
+func (r *SPIAccessTokenBindingReconciler) patchWriteBackFinalizer(ctx context.Context, binding *api.SPIAccessTokenBinding, add bool) error {
+	patched := binding.DeepCopy()
+	if add {
+		controllerutil.AddFinalizer(patched, writeBackFinalizerName)
+	} else {
+		controllerutil.RemoveFinalizer(patched, writeBackFinalizerName)
+	}
+
+	if err := r.Client.Patch(ctx, patched, client.MergeFrom(binding)); err != nil {
+		return fmt.Errorf("failed to update the write-back finalizer: %w", err)
+	}
+
+	binding.Finalizers = patched.Finalizers
+	binding.ResourceVersion = patched.ResourceVersion
+	return nil
+}
+
+// deleteWrittenBackData deletes the data the binding wrote back to the external secret store.
+func deleteWrittenBackData(ctx context.Context, store writeback.Store, binding *api.SPIAccessTokenBinding) error {
+	paths := []string{binding.Status.WriteBackPath}
+	if path := writeBackPath(binding); path != binding.Status.WriteBackPath {
+		// the data might have been written without the status being updated afterwards. Only the data written for
+		// the binding is ever deleted, so this is safe.
+		paths = append(paths, path)
+	}
+
+	for _, path := range paths {
+		if writeback.ValidatePath(path) != nil {
+			continue
+		}
+		if err := store.Delete(ctx, binding, path); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,636 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/config"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	sharedConfig "github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/statusupdate"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/sync"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/writeback"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/informers"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	"k8s.io/client-go/metadata/metadatainformer"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+func TestSecretDataChecksum(t *testing.T) {
+	data := map[string][]byte{
+		"username": []byte("alois"),
+		"password": []byte("secret"),
+	}
+
+	expected := sha256.Sum256([]byte("password\x00secret\x00username\x00alois\x00"))
+	assert.Equal(t, hex.EncodeToString(expected[:]), secretDataChecksum(data))
+
+	// the key/value boundaries are part of the checksum
+	assert.NotEqual(t, secretDataChecksum(map[string][]byte{"ab": []byte("c")}), secretDataChecksum(map[string][]byte{"a": []byte("bc")}))
+}
+
+func TestPermissionsCover(t *testing.T) {
+	perms := func(additionalScopes []string, ps ...api.Permission) *api.Permissions {
+		return &api.Permissions{Required: ps, AdditionalScopes: additionalScopes}
+	}
+	readRepo := api.Permission{Area: api.PermissionAreaRepository, Type: api.PermissionTypeRead}
+	writeRepo := api.Permission{Area: api.PermissionAreaRepository, Type: api.PermissionTypeWrite}
+	readWriteRepo := api.Permission{Area: api.PermissionAreaRepository, Type: api.PermissionTypeReadWrite}
+	readWebhooks := api.Permission{Area: api.PermissionAreaWebhooks, Type: api.PermissionTypeRead}
+
+	assert.True(t, permissionsCover(perms(nil), perms(nil)))
+	assert.True(t, permissionsCover(perms(nil, readWriteRepo), perms(nil, readRepo, writeRepo)))
+	assert.True(t, permissionsCover(perms(nil, readRepo, writeRepo), perms(nil, readWriteRepo)))
+	assert.True(t, permissionsCover(perms([]string{"read:org", "gist"}, readRepo), perms([]string{"gist"}, readRepo)))
+	assert.False(t, permissionsCover(perms(nil, readRepo), perms(nil, writeRepo)))
+	assert.False(t, permissionsCover(perms(nil, readRepo), perms(nil, readWebhooks)))
+	assert.False(t, permissionsCover(perms(nil, readRepo), perms([]string{"gist"}, readRepo)))
+}
+
+func TestEphemeralTokenRefreshTime(t *testing.T) {
+	synced := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	expiration := synced.Add(time.Hour)
+
+	t.Run("after most of the lifetime", func(t *testing.T) {
+		ref := api.TargetObjectRef{
+			LastSyncTime:   &metav1.Time{Time: synced},
+			ExpirationTime: &metav1.Time{Time: expiration},
+		}
+		assert.Equal(t, synced.Add(48*time.Minute), ephemeralTokenRefreshTime(ref))
+	})
+
+	t.Run("at expiration without sync time", func(t *testing.T) {
+		ref := api.TargetObjectRef{
+			ExpirationTime: &metav1.Time{Time: expiration},
+		}
+		assert.Equal(t, expiration, ephemeralTokenRefreshTime(ref))
+	})
+
+	t.Run("at expiration when synced after it", func(t *testing.T) {
+		ref := api.TargetObjectRef{
+			LastSyncTime:   &metav1.Time{Time: expiration.Add(time.Minute)},
+			ExpirationTime: &metav1.Time{Time: expiration},
+		}
+		assert.Equal(t, expiration, ephemeralTokenRefreshTime(ref))
+	})
+}
+
+func TestCheckEphemeralTokenExpiry(t *testing.T) {
+	now := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	expiring := &api.Token{AccessToken: "token", Expiry: uint64(now.Add(8 * time.Hour).Unix())}
+
+	assert.NoError(t, checkEphemeralTokenExpiry(api.ServiceProviderTypeGitHub, expiring, 0, now))
+	assert.NoError(t, checkEphemeralTokenExpiry(api.ServiceProviderTypeGitHub, expiring, 8*time.Hour, now))
+	assert.Error(t, checkEphemeralTokenExpiry(api.ServiceProviderTypeGitHub, expiring, time.Hour, now))
+	assert.Error(t, checkEphemeralTokenExpiry(api.ServiceProviderTypeGitHub, &api.Token{AccessToken: "token"}, 0, now))
+}
+
+func TestEphemeralTokenFresh(t *testing.T) {
+	sch := k8sruntime.NewScheme()
+	assert.NoError(t, corev1.AddToScheme(sch))
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "ns", UID: "7"}}
+
+	binding := func(modify func(ref *api.TargetObjectRef)) *api.SPIAccessTokenBinding {
+		b := &api.SPIAccessTokenBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "binding", Namespace: "ns", Generation: 2},
+			Status: api.SPIAccessTokenBindingStatus{
+				SyncedObjectRef: api.TargetObjectRef{
+					Name:             "secret",
+					Kind:             "Secret",
+					ApiVersion:       "v1",
+					UID:              "7",
+					LastSyncTime:     &metav1.Time{Time: time.Now()},
+					ExpirationTime:   &metav1.Time{Time: time.Now().Add(time.Hour)},
+					SyncedGeneration: 2,
+				},
+			},
+		}
+		if modify != nil {
+			modify(&b.Status.SyncedObjectRef)
+		}
+		return b
+	}
+
+	test := func(name string, expected bool, b *api.SPIAccessTokenBinding, objs ...client.Object) {
+		t.Run(name, func(t *testing.T) {
+			cl := fake.NewClientBuilder().WithScheme(sch).WithObjects(objs...).Build()
+			r := &SPIAccessTokenBindingReconciler{Client: cl}
+
+			fresh, err := r.ephemeralTokenFresh(context.TODO(), b)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, fresh)
+		})
+	}
+
+	test("fresh", true, binding(nil), secret)
+	test("not synced", false, binding(func(ref *api.TargetObjectRef) { *ref = api.TargetObjectRef{} }), secret)
+	test("needs refresh", false, binding(func(ref *api.TargetObjectRef) {
+		ref.LastSyncTime = &metav1.Time{Time: time.Now().Add(-time.Hour)}
+		ref.ExpirationTime = &metav1.Time{Time: time.Now().Add(time.Minute)}
+	}), secret)
+	test("binding changed", false, binding(func(ref *api.TargetObjectRef) { ref.SyncedGeneration = 1 }), secret)
+	test("secret deleted", false, binding(nil))
+	test("secret replaced", false, binding(func(ref *api.TargetObjectRef) { ref.UID = "6" }), secret)
+}
+
+func TestWithCredential(t *testing.T) {
+	token := &api.Token{
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		Expiry:       42,
+		Credentials: map[api.CredentialFlavor]string{
+			api.CredentialFlavorSSHKey: "key",
+		},
+	}
+
+	t.Run("access token by default", func(t *testing.T) {
+		ret, err := withCredential(token, "")
+		assert.NoError(t, err)
+		assert.Same(t, token, ret)
+	})
+
+	t.Run("refresh token", func(t *testing.T) {
+		ret, err := withCredential(token, api.CredentialFlavorRefreshToken)
+		assert.NoError(t, err)
+		assert.Equal(t, "refresh", ret.AccessToken)
+		assert.Equal(t, uint64(0), ret.Expiry)
+		assert.Equal(t, "access", token.AccessToken)
+	})
+
+	t.Run("additional credential", func(t *testing.T) {
+		ret, err := withCredential(token, api.CredentialFlavorSSHKey)
+		assert.NoError(t, err)
+		assert.Equal(t, "key", ret.AccessToken)
+	})
+
+	t.Run("missing credential", func(t *testing.T) {
+		ret, err := withCredential(token, api.CredentialFlavorPassword)
+		assert.Error(t, err)
+		assert.Nil(t, ret)
+	})
+}
+
+type mapWriteBackStore map[string]map[string]string
+
+var _ writeback.Store = (mapWriteBackStore)(nil)
+
+func (s mapWriteBackStore) Write(_ context.Context, _ *api.SPIAccessTokenBinding, path string, data map[string]string) error {
+	s[path] = data
+	return nil
+}
+
+func (s mapWriteBackStore) Delete(_ context.Context, _ *api.SPIAccessTokenBinding, path string) error {
+	delete(s, path)
+	return nil
+}
+
+func TestWriteBack(t *testing.T) {
+	sch := k8sruntime.NewScheme()
+	assert.NoError(t, api.AddToScheme(sch))
+
+	data := map[string]string{"password": "token"}
+
+	newBinding := func(spec api.SPIAccessTokenBindingSpec, status api.SPIAccessTokenBindingStatus, finalizers ...string) *api.SPIAccessTokenBinding {
+		return &api.SPIAccessTokenBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "binding", Namespace: "ns", Finalizers: finalizers},
+			Spec:       spec,
+			Status:     status,
+		}
+	}
+
+	reconciler := func(store writeback.Store, binding *api.SPIAccessTokenBinding) (*SPIAccessTokenBindingReconciler, client.Client) {
+		cl := fake.NewClientBuilder().WithScheme(sch).WithObjects(binding).Build()
+		assert.NoError(t, cl.Get(context.TODO(), client.ObjectKeyFromObject(binding), binding))
+		return &SPIAccessTokenBindingReconciler{Client: cl, WriteBackStore: store}, cl
+	}
+
+	finalizersInCluster := func(cl client.Client) []string {
+		binding := &api.SPIAccessTokenBinding{}
+		assert.NoError(t, cl.Get(context.TODO(), client.ObjectKey{Name: "binding", Namespace: "ns"}, binding))
+		return binding.Finalizers
+	}
+
+	t.Run("writes to the requested path", func(t *testing.T) {
+		store := mapWriteBackStore{}
+		binding := newBinding(api.SPIAccessTokenBindingSpec{WriteBack: &api.WriteBackTarget{Vault: "app/git"}}, api.SPIAccessTokenBindingStatus{})
+		r, cl := reconciler(store, binding)
+
+		assert.NoError(t, r.writeBack(context.TODO(), binding, data))
+		assert.Equal(t, mapWriteBackStore{"app/git": data}, store)
+		assert.Equal(t, "app/git", binding.Status.WriteBackPath)
+		assert.Equal(t, []string{writeBackFinalizerName}, finalizersInCluster(cl))
+	})
+
+	t.Run("repairs the data missing in the store", func(t *testing.T) {
+		store := mapWriteBackStore{}
+		binding := newBinding(api.SPIAccessTokenBindingSpec{WriteBack: &api.WriteBackTarget{Vault: "app/git"}}, api.SPIAccessTokenBindingStatus{WriteBackPath: "app/git"}, writeBackFinalizerName)
+		r, _ := reconciler(store, binding)
+
+		assert.NoError(t, r.writeBack(context.TODO(), binding, data))
+		assert.Equal(t, mapWriteBackStore{"app/git": data}, store)
+	})
+
+	t.Run("moves the data to the new path", func(t *testing.T) {
+		store := mapWriteBackStore{"app/old": data}
+		binding := newBinding(api.SPIAccessTokenBindingSpec{WriteBack: &api.WriteBackTarget{Vault: "app/new"}}, api.SPIAccessTokenBindingStatus{WriteBackPath: "app/old"}, writeBackFinalizerName)
+		r, _ := reconciler(store, binding)
+
+		assert.NoError(t, r.writeBack(context.TODO(), binding, data))
+		assert.Equal(t, mapWriteBackStore{"app/new": data}, store)
+		assert.Equal(t, "app/new", binding.Status.WriteBackPath)
+	})
+
+	t.Run("deletes the data when no longer requested", func(t *testing.T) {
+		store := mapWriteBackStore{"app/git": data}
+		binding := newBinding(api.SPIAccessTokenBindingSpec{}, api.SPIAccessTokenBindingStatus{WriteBackPath: "app/git"}, writeBackFinalizerName)
+		r, cl := reconciler(store, binding)
+
+		assert.NoError(t, r.writeBack(context.TODO(), binding, data))
+		assert.Empty(t, store)
+		assert.Empty(t, binding.Status.WriteBackPath)
+		assert.Empty(t, finalizersInCluster(cl))
+	})
+
+	t.Run("doesn't add the finalizer to the bindings not writing back", func(t *testing.T) {
+		binding := newBinding(api.SPIAccessTokenBindingSpec{}, api.SPIAccessTokenBindingStatus{})
+		r, cl := reconciler(mapWriteBackStore{}, binding)
+
+		assert.NoError(t, r.writeBack(context.TODO(), binding, data))
+		assert.Empty(t, finalizersInCluster(cl))
+	})
+
+	t.Run("keeps the status changes when updating the finalizer", func(t *testing.T) {
+		binding := newBinding(api.SPIAccessTokenBindingSpec{WriteBack: &api.WriteBackTarget{Vault: "app/git"}}, api.SPIAccessTokenBindingStatus{})
+		r, _ := reconciler(mapWriteBackStore{}, binding)
+		binding.Status.Phase = api.SPIAccessTokenBindingPhaseInjected
+
+		assert.NoError(t, r.writeBack(context.TODO(), binding, data))
+		assert.Equal(t, api.SPIAccessTokenBindingPhaseInjected, binding.Status.Phase)
+	})
+
+	t.Run("finalizer deletes the written data", func(t *testing.T) {
+		store := mapWriteBackStore{"app/git": data, "app/unrecorded": data}
+		binding := newBinding(api.SPIAccessTokenBindingSpec{WriteBack: &api.WriteBackTarget{Vault: "app/unrecorded"}}, api.SPIAccessTokenBindingStatus{WriteBackPath: "app/git"}, writeBackFinalizerName)
+		r, cl := reconciler(store, binding)
+		now := metav1.Now()
+		binding.DeletionTimestamp = &now
+
+		assert.NoError(t, r.finalizeWriteBack(context.TODO(), binding))
+		assert.Empty(t, store)
+		assert.Empty(t, finalizersInCluster(cl))
+	})
+
+	t.Run("finalizer keeps the data of the live bindings", func(t *testing.T) {
+		store := mapWriteBackStore{"app/git": data}
+		binding := newBinding(api.SPIAccessTokenBindingSpec{WriteBack: &api.WriteBackTarget{Vault: "app/git"}}, api.SPIAccessTokenBindingStatus{WriteBackPath: "app/git"}, writeBackFinalizerName)
+		r, cl := reconciler(store, binding)
+
+		assert.NoError(t, r.finalizeWriteBack(context.TODO(), binding))
+		assert.Len(t, store, 1)
+		assert.Equal(t, []string{writeBackFinalizerName}, finalizersInCluster(cl))
+	})
+
+	t.Run("finalizer is removed when the write-back is disabled", func(t *testing.T) {
+		binding := newBinding(api.SPIAccessTokenBindingSpec{WriteBack: &api.WriteBackTarget{Vault: "app/git"}}, api.SPIAccessTokenBindingStatus{WriteBackPath: "app/git"}, writeBackFinalizerName)
+		r, cl := reconciler(nil, binding)
+
+		assert.NoError(t, r.finalizeWriteBack(context.TODO(), binding))
+		assert.Empty(t, finalizersInCluster(cl))
+	})
+}
+
+func TestSyncSecretObject(t *testing.T) {
+	sch := k8sruntime.NewScheme()
+	assert.NoError(t, api.AddToScheme(sch))
+	assert.NoError(t, corev1.AddToScheme(sch))
+
+	binding := &api.SPIAccessTokenBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "binding", Namespace: "ns", UID: "42"},
+		Spec: api.SPIAccessTokenBindingSpec{
+			Secret: api.SecretSpec{
+				Name:   "secret",
+				Labels: map[string]string{"app": "test"},
+				Type:   corev1.SecretTypeOpaque,
+			},
+		},
+	}
+	data := map[string][]byte{"token": []byte("data")}
+
+	getSecret := func(cl client.Client) *corev1.Secret {
+		secret := &corev1.Secret{}
+		assert.NoError(t, cl.Get(context.TODO(), client.ObjectKey{Name: "secret", Namespace: "ns"}, secret))
+		return secret
+	}
+
+	t.Run("new secret is labeled", func(t *testing.T) {
+		cl := fake.NewClientBuilder().WithScheme(sch).WithObjects(binding).Build()
+		r := &SPIAccessTokenBindingReconciler{Client: cl, syncer: sync.New(cl)}
+
+		_, err := r.syncSecretObject(context.TODO(), binding, "secret", data)
+		assert.NoError(t, err)
+
+		secret := getSecret(cl)
+		assert.Equal(t, "test", secret.Labels["app"])
+		assert.Equal(t, sharedConfig.ManagedSecretLabelValue, secret.Labels[sharedConfig.ManagedSecretLabel])
+		assert.Len(t, binding.Spec.Secret.Labels, 1)
+	})
+
+	t.Run("own secret is updated", func(t *testing.T) {
+		cl := fake.NewClientBuilder().WithScheme(sch).WithObjects(binding).Build()
+		r := &SPIAccessTokenBindingReconciler{Client: cl, syncer: sync.New(cl)}
+
+		_, err := r.syncSecretObject(context.TODO(), binding, "secret", data)
+		assert.NoError(t, err)
+		_, err = r.syncSecretObject(context.TODO(), binding, "secret", map[string][]byte{"token": []byte("new")})
+		assert.NoError(t, err)
+
+		assert.Equal(t, []byte("new"), getSecret(cl).Data["token"])
+	})
+
+	t.Run("secret of another binding is not overwritten", func(t *testing.T) {
+		other := &api.SPIAccessTokenBinding{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "ns", UID: "43"}}
+		existing := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "ns"}, Data: map[string][]byte{"token": []byte("other")}}
+		assert.NoError(t, controllerutil.SetControllerReference(other, existing, sch))
+		cl := fake.NewClientBuilder().WithScheme(sch).WithObjects(binding, other, existing).Build()
+		r := &SPIAccessTokenBindingReconciler{Client: cl, syncer: sync.New(cl)}
+
+		_, err := r.syncSecretObject(context.TODO(), binding, "secret", data)
+		assert.ErrorAs(t, err, &secretConflictError{})
+		assert.Equal(t, []byte("other"), getSecret(cl).Data["token"])
+	})
+
+	t.Run("secret of the user is not overwritten", func(t *testing.T) {
+		existing := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "ns"}, Data: map[string][]byte{"token": []byte("mine")}}
+		cl := fake.NewClientBuilder().WithScheme(sch).WithObjects(binding, existing).Build()
+		r := &SPIAccessTokenBindingReconciler{Client: cl, syncer: sync.New(cl)}
+
+		_, err := r.syncSecretObject(context.TODO(), binding, "secret", data)
+		assert.ErrorAs(t, err, &secretConflictError{})
+		assert.Equal(t, []byte("mine"), getSecret(cl).Data["token"])
+		assert.Empty(t, getSecret(cl).OwnerReferences)
+	})
+}
+
+func TestSyncSecretWithData_PodDelivery(t *testing.T) {
+	sch := k8sruntime.NewScheme()
+	assert.NoError(t, api.AddToScheme(sch))
+	assert.NoError(t, corev1.AddToScheme(sch))
+
+	binding := &api.SPIAccessTokenBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "binding", Namespace: "ns", UID: "42"},
+		Spec: api.SPIAccessTokenBindingSpec{
+			Secret: api.SecretSpec{Type: corev1.SecretTypeBasicAuth, Delivery: api.SecretDeliveryPod},
+		},
+		Status: api.SPIAccessTokenBindingStatus{
+			SyncedObjectRef: api.TargetObjectRef{Name: "secret", Kind: "Secret", ApiVersion: "v1"},
+		},
+	}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "ns"}}
+	cl := fake.NewClientBuilder().WithScheme(sch).WithObjects(binding, secret).Build()
+	r := &SPIAccessTokenBindingReconciler{Client: cl, syncer: sync.New(cl)}
+
+	ref, err := r.syncSecretWithData(context.TODO(), mappingServiceProvider{}, binding, &api.SPIAccessToken{}, &api.Token{AccessToken: "token"})
+	assert.NoError(t, err)
+	assert.Equal(t, "binding", ref.Name)
+	assert.Equal(t, "SPIAccessTokenBinding", ref.Kind)
+	assert.Equal(t, api.GroupVersion.String(), ref.ApiVersion)
+	assert.NotEmpty(t, ref.DataChecksum)
+
+	// the secret synced with the previous delivery is deleted
+	assert.Error(t, cl.Get(context.TODO(), client.ObjectKeyFromObject(secret), &corev1.Secret{}))
+
+	// and the reference to the binding itself never deletes the binding
+	assert.NoError(t, r.deleteSyncedObject(context.TODO(), ref, "ns"))
+	assert.NoError(t, cl.Get(context.TODO(), client.ObjectKeyFromObject(binding), &api.SPIAccessTokenBinding{}))
+}
+
+func TestRenderSecretData_MavenSettings(t *testing.T) {
+	binding := &api.SPIAccessTokenBinding{
+		Spec: api.SPIAccessTokenBindingSpec{
+			RepoUrl: "https://nexus.acme.com/repository/maven-releases",
+			Secret:  api.SecretSpec{Type: api.SecretTypeMavenSettings},
+		},
+	}
+	token := &api.Token{Username: "deployer", AccessToken: "p<ss", TokenType: api.BasicAuthTokenType}
+
+	data, err := renderSecretData(context.TODO(), mappingServiceProvider{}, binding, &api.SPIAccessToken{}, token)
+	assert.NoError(t, err)
+	assert.Contains(t, data[api.MavenSettingsKey], "<id>nexus.acme.com</id>")
+	assert.Contains(t, data[api.MavenSettingsKey], "<username>deployer</username>")
+	assert.Contains(t, data[api.MavenSettingsKey], "<password>p&lt;ss</password>")
+
+	binding.Spec.Secret.MavenServerId = "releases"
+	data, err = renderSecretData(context.TODO(), mappingServiceProvider{}, binding, &api.SPIAccessToken{}, token)
+	assert.NoError(t, err)
+	assert.Contains(t, data[api.MavenSettingsKey], "<id>releases</id>")
+}
+
+func TestRenderSecretData_EnvKeys(t *testing.T) {
+	binding := &api.SPIAccessTokenBinding{
+		Spec: api.SPIAccessTokenBindingSpec{
+			RepoUrl: "https://github.com/acme/app",
+			Secret:  api.SecretSpec{Type: corev1.SecretTypeBasicAuth, EnvKeys: true, EnvPrefix: "APP_"},
+		},
+	}
+	token := &api.Token{Username: "alois", AccessToken: "token", TokenType: api.BasicAuthTokenType}
+
+	data, err := renderSecretData(context.TODO(), mappingServiceProvider{}, binding, &api.SPIAccessToken{}, token)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		corev1.BasicAuthUsernameKey: "alois",
+		corev1.BasicAuthPasswordKey: "token",
+		"APP_GIT_USERNAME":          "alois",
+		"APP_GIT_TOKEN":             "token",
+	}, data)
+}
+
+// urlServiceProvider only implements the methods identifying the service provider.
+type urlServiceProvider struct {
+	serviceprovider.ServiceProvider
+	spType  api.ServiceProviderType
+	baseUrl string
+}
+
+func (p urlServiceProvider) GetType() api.ServiceProviderType {
+	return p.spType
+}
+
+func (p urlServiceProvider) GetBaseUrl() string {
+	return p.baseUrl
+}
+
+func TestLinkPinnedToken(t *testing.T) {
+	sch := k8sruntime.NewScheme()
+	assert.NoError(t, api.AddToScheme(sch))
+
+	sp := urlServiceProvider{baseUrl: "https://github.com"}
+	token := &api.SPIAccessToken{
+		ObjectMeta: metav1.ObjectMeta{Name: "pinned", Namespace: "ns"},
+		Spec: api.SPIAccessTokenSpec{
+			ServiceProviderUrl: "https://github.com/",
+			// the pinned tokens are linked regardless of their permissions
+			Permissions: api.Permissions{Required: []api.Permission{{Area: api.PermissionAreaRepository, Type: api.PermissionTypeRead}}},
+		},
+		Status: api.SPIAccessTokenStatus{Phase: api.SPIAccessTokenPhaseReady},
+	}
+	gitlabToken := &api.SPIAccessToken{
+		ObjectMeta: metav1.ObjectMeta{Name: "gitlab", Namespace: "ns"},
+		Spec:       api.SPIAccessTokenSpec{ServiceProviderUrl: "https://gitlab.com"},
+	}
+
+	link := func(t *testing.T, tokenRef string, policy api.TokenPolicyType) (*api.SPIAccessToken, *api.SPIAccessTokenBinding) {
+		binding := &api.SPIAccessTokenBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "binding", Namespace: "ns"},
+			Spec: api.SPIAccessTokenBindingSpec{
+				RepoUrl:     "https://github.com/acme/app",
+				Permissions: api.Permissions{Required: []api.Permission{{Area: api.PermissionAreaRepository, Type: api.PermissionTypeWrite}}},
+				TokenPolicy: api.TokenPolicy{Type: policy},
+				TokenRef:    &api.TokenReference{Name: tokenRef},
+			},
+		}
+		cl := statusupdate.FakeApplyClient{Client: fake.NewClientBuilder().WithScheme(sch).WithObjects(binding, token.DeepCopy(), gitlabToken.DeepCopy()).Build()}
+		assert.NoError(t, cl.Get(context.TODO(), client.ObjectKeyFromObject(binding), binding))
+		r := &SPIAccessTokenBindingReconciler{Client: cl}
+
+		linked, err := r.linkPinnedToken(context.TODO(), sp, binding)
+		assert.NoError(t, err)
+
+		current := &api.SPIAccessTokenBinding{}
+		assert.NoError(t, cl.Get(context.TODO(), client.ObjectKeyFromObject(binding), current))
+		return linked, current
+	}
+
+	t.Run("links the token", func(t *testing.T) {
+		linked, binding := link(t, "pinned", "")
+		if assert.NotNil(t, linked) {
+			assert.Equal(t, "pinned", linked.Name)
+		}
+		assert.Equal(t, "pinned", binding.Status.LinkedAccessTokenName)
+		assert.Equal(t, "pinned", binding.Labels[config.SPIAccessTokenLinkLabel])
+		assert.Empty(t, binding.Status.ErrorReason)
+	})
+
+	t.Run("missing token", func(t *testing.T) {
+		linked, binding := link(t, "missing", api.TokenPolicyTypeExact)
+		assert.Nil(t, linked)
+		assert.Equal(t, api.SPIAccessTokenBindingPhaseError, binding.Status.Phase)
+		assert.Equal(t, api.SPIAccessTokenBindingErrorReasonTokenRef, binding.Status.ErrorReason)
+		assert.Contains(t, binding.Status.ErrorMessage, "doesn't exist")
+	})
+
+	t.Run("token of another service provider", func(t *testing.T) {
+		linked, binding := link(t, "gitlab", "")
+		assert.Nil(t, linked)
+		assert.Equal(t, api.SPIAccessTokenBindingErrorReasonTokenRef, binding.Status.ErrorReason)
+		assert.Contains(t, binding.Status.ErrorMessage, "different service provider")
+		assert.Empty(t, binding.Status.LinkedAccessTokenName)
+	})
+
+	t.Run("combined with token policy", func(t *testing.T) {
+		linked, binding := link(t, "pinned", api.TokenPolicyTypeSuperset)
+		assert.Nil(t, linked)
+		assert.Equal(t, api.SPIAccessTokenBindingErrorReasonTokenRef, binding.Status.ErrorReason)
+		assert.Empty(t, binding.Status.LinkedAccessTokenName)
+	})
+}
+
+// BenchmarkSecretWatchCache measures the heap retained by the informer behind the secret watch of the binding
+// controller when there are 1000 secrets with 64KiB dockerconfigs, for the informer caching the whole secrets and
+// the metadata-only informer the controller uses. These are the client-go informers the controller-runtime cache
+// consists of, fed by the fake API clients. The retained heap is reported as the "B/cache" metric. Run with
+// -benchtime=10x, each iteration fills a new informer.
+func BenchmarkSecretWatchCache(b *testing.B) {
+	const secretCount = 1000
+	dockerconfig := make([]byte, 64*1024)
+
+	secrets := make([]k8sruntime.Object, secretCount)
+	metadata := make([]k8sruntime.Object, secretCount)
+	for i := range secrets {
+		secret := &corev1.Secret{
+			TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("secret-%d", i),
+				Namespace: "ns",
+				Labels:    map[string]string{sharedConfig.ManagedSecretLabel: sharedConfig.ManagedSecretLabelValue},
+			},
+			Type: corev1.SecretTypeDockerConfigJson,
+			Data: map[string][]byte{corev1.DockerConfigJsonKey: dockerconfig},
+		}
+		secrets[i] = secret
+		metadata[i] = &metav1.PartialObjectMetadata{TypeMeta: secret.TypeMeta, ObjectMeta: secret.ObjectMeta}
+	}
+
+	heap := func() uint64 {
+		runtime.GC()
+		stats := runtime.MemStats{}
+		runtime.ReadMemStats(&stats)
+		return stats.HeapAlloc
+	}
+
+	measure := func(b *testing.B, newInformer func() toolscache.SharedIndexInformer) {
+		var retained uint64
+		for n := 0; n < b.N; n++ {
+			// the API objects are held by the fake clients, only the growth of the heap by filling the informer counts
+			informer := newInformer()
+			before := heap()
+
+			stop := make(chan struct{})
+			go informer.Run(stop)
+			if !toolscache.WaitForCacheSync(stop, informer.HasSynced) {
+				b.Fatal("the informer failed to sync")
+			}
+			assert.Len(b, informer.GetStore().List(), secretCount)
+
+			if after := heap(); after > before {
+				retained += after - before
+			}
+			close(stop)
+		}
+		b.ReportMetric(float64(retained)/float64(b.N), "B/cache")
+	}
+
+	b.Run("whole secrets", func(b *testing.B) {
+		measure(b, func() toolscache.SharedIndexInformer {
+			return informers.NewSharedInformerFactory(kubefake.NewSimpleClientset(secrets...), 0).Core().V1().Secrets().Informer()
+		})
+	})
+
+	b.Run("metadata only", func(b *testing.B) {
+		measure(b, func() toolscache.SharedIndexInformer {
+			sch := k8sruntime.NewScheme()
+			assert.NoError(b, metav1.AddMetaToScheme(sch))
+			cl := metadatafake.NewSimpleMetadataClient(sch, metadata...)
+			return metadatainformer.NewSharedInformerFactory(cl, 0).ForResource(schema.GroupVersionResource{Version: "v1", Resource: "secrets"}).Informer()
+		})
+	})
+}
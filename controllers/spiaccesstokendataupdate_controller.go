@@ -35,7 +35,7 @@ type SPIAccessTokenDataUpdateReconciler struct {
 func (r *SPIAccessTokenDataUpdateReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&api.SPIAccessTokenDataUpdate{}).
-		Complete(r)
+		Complete(monitored(mgr, "SPIAccessTokenDataUpdate", &api.SPIAccessTokenDataUpdate{}, r))
 }
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
@@ -0,0 +1,208 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/tokenstorage"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/statusupdate"
+)
+
+// errInvalidOverride is returned when the action of the override cannot be performed on its target, e.g. because
+// the target doesn't exist or the action is not applicable to its kind. Such overrides are not retried.
+var errInvalidOverride = stderrors.New("invalid override")
+
+// SPIAdminOverrideReconciler reconciles a SPIAdminOverride object. It performs the action of the override once per
+// generation of its spec and records the outcome in the events of the override and its target.
+type SPIAdminOverrideReconciler struct {
+	client.Client
+	Scheme       *runtime.Scheme
+	TokenStorage tokenstorage.TokenStorage
+	Recorder     record.EventRecorder
+}
+
+//+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spiadminoverrides,verbs=get;list;watch
+//+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spiadminoverrides/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spiaccesstokens,verbs=get;list;watch;update
+//+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spiaccesstokens/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spiaccesstokenbindings,verbs=get;list;watch;update
+//+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spiaccesstokendataupdates,verbs=create
+//+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spirepositorywebhooks,verbs=get;list;watch;update
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *SPIAdminOverrideReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&api.SPIAdminOverride{}).
+		Complete(monitored(mgr, "SPIAdminOverride", &api.SPIAdminOverride{}, r))
+}
+
+func (r *SPIAdminOverrideReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	lg := log.FromContext(ctx)
+
+	override := api.SPIAdminOverride{}
+	if err := r.Get(ctx, req.NamespacedName, &override); err != nil {
+		if errors.IsNotFound(err) {
+			lg.Info("object not found")
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, NewReconcileError(err, "failed to load the SPIAdminOverride from the cluster")
+	}
+
+	if override.DeletionTimestamp != nil || (override.Status.Phase != "" && override.Status.ObservedGeneration == override.Generation) {
+		// the action has already been performed for this spec
+		return ctrl.Result{}, nil
+	}
+
+	lg.Info("performing admin override", "action", override.Spec.Action, "kind", override.Spec.Target.Kind, "target", override.Spec.Target.Name, "reason", override.Spec.Reason)
+
+	target, err := r.performOverride(ctx, &override)
+	if err != nil {
+		r.Recorder.Eventf(&override, corev1.EventTypeWarning, "OverrideFailed", "%s on %s %s failed: %s", override.Spec.Action, override.Spec.Target.Kind, override.Spec.Target.Name, err)
+		override.Status.Phase = api.SPIAdminOverridePhaseFailed
+		override.Status.ErrorMessage = err.Error()
+		override.Status.CompletionTime = nil
+		if stderrors.Is(err, errInvalidOverride) {
+			// the override needs to be fixed, there's no point in retrying
+			override.Status.ObservedGeneration = override.Generation
+		}
+		if uerr := updateAdminOverrideStatusIfChanged(ctx, r.Client, &override); uerr != nil {
+			lg.Error(uerr, "failed to update the status with error", "error", err)
+		}
+		if stderrors.Is(err, errInvalidOverride) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, NewReconcileError(err, "failed to perform the admin override")
+	}
+
+	message := fmt.Sprintf("%s forced by SPIAdminOverride %s: %s", override.Spec.Action, override.Name, override.Spec.Reason)
+	r.Recorder.Event(target, corev1.EventTypeWarning, "AdminOverride", message)
+	r.Recorder.Eventf(&override, corev1.EventTypeNormal, "OverrideCompleted", "%s performed on %s %s", override.Spec.Action, override.Spec.Target.Kind, override.Spec.Target.Name)
+
+	now := metav1.Now()
+	override.Status.Phase = api.SPIAdminOverridePhaseCompleted
+	override.Status.ErrorMessage = ""
+	override.Status.CompletionTime = &now
+	override.Status.ObservedGeneration = override.Generation
+	if err := updateAdminOverrideStatusIfChanged(ctx, r.Client, &override); err != nil {
+		return ctrl.Result{}, NewReconcileError(err, "failed to update the status")
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// performOverride performs the action of the override on its target and returns the target. The returned error wraps
+// errInvalidOverride if the action cannot be performed on the target.
+func (r *SPIAdminOverrideReconciler) performOverride(ctx context.Context, override *api.SPIAdminOverride) (client.Object, error) {
+	var target client.Object
+	switch override.Spec.Target.Kind {
+	case "SPIAccessToken":
+		target = &api.SPIAccessToken{}
+	case "SPIAccessTokenBinding":
+		target = &api.SPIAccessTokenBinding{}
+	case "SPIRepositoryWebhook":
+		target = &api.SPIRepositoryWebhook{}
+	default:
+		return nil, fmt.Errorf("%w: unsupported target kind '%s'", errInvalidOverride, override.Spec.Target.Kind)
+	}
+
+	if err := r.Get(ctx, client.ObjectKey{Name: override.Spec.Target.Name, Namespace: override.Namespace}, target); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, fmt.Errorf("%w: %s %s not found", errInvalidOverride, override.Spec.Target.Kind, override.Spec.Target.Name)
+		}
+		return nil, fmt.Errorf("failed to load the target of the override: %w", err)
+	}
+
+	switch override.Spec.Action {
+	case api.SPIAdminOverrideActionRemoveFinalizer:
+		if override.Spec.Finalizer == "" {
+			return nil, fmt.Errorf("%w: the finalizer to remove is not specified", errInvalidOverride)
+		}
+		if !controllerutil.ContainsFinalizer(target, override.Spec.Finalizer) {
+			// nothing to do, the finalizer might have been removed by the controller in the meantime
+			return target, nil
+		}
+		controllerutil.RemoveFinalizer(target, override.Spec.Finalizer)
+		if err := r.Update(ctx, target); err != nil {
+			return nil, fmt.Errorf("failed to remove the finalizer: %w", err)
+		}
+	case api.SPIAdminOverrideActionDeleteTokenData:
+		token, ok := target.(*api.SPIAccessToken)
+		if !ok {
+			return nil, fmt.Errorf("%w: the token data can only be deleted for SPIAccessTokens", errInvalidOverride)
+		}
+		if err := r.TokenStorage.Delete(ctx, token); err != nil {
+			return nil, fmt.Errorf("failed to delete the token data: %w", err)
+		}
+		if token.DeletionTimestamp == nil && token.Status.TokenMetadata != nil {
+			// forget the metadata of the deleted data so that the token controller notices the change
+			token.Status.TokenMetadata = nil
+			if err := statusupdate.Apply(ctx, r.Client, token); err != nil {
+				return nil, fmt.Errorf("failed to forget the token metadata: %w", err)
+			}
+		}
+	case api.SPIAdminOverrideActionRefreshMetadata:
+		token, ok := target.(*api.SPIAccessToken)
+		if !ok {
+			return nil, fmt.Errorf("%w: the metadata can only be refreshed for SPIAccessTokens", errInvalidOverride)
+		}
+		if token.Status.TokenMetadata != nil {
+			// the metadata cache considers the metadata stale and refreshes them on the next reconciliation of the token
+			token.Status.TokenMetadata.LastRefreshTime = 0
+			if err := statusupdate.Apply(ctx, r.Client, token); err != nil {
+				return nil, fmt.Errorf("failed to mark the token metadata stale: %w", err)
+			}
+		}
+	case api.SPIAdminOverrideActionRecoverTokenData:
+		token, ok := target.(*api.SPIAccessToken)
+		if !ok {
+			return nil, fmt.Errorf("%w: the token data can only be recovered for SPIAccessTokens", errInvalidOverride)
+		}
+		if token.DeletionTimestamp != nil {
+			return nil, fmt.Errorf("%w: the token is being deleted", errInvalidOverride)
+		}
+		if err := recoverTokenData(ctx, r.Client, r.TokenStorage, token); err != nil {
+			if stderrors.Is(err, errNoTombstone) || stderrors.Is(err, errTombstoneOwnerMismatch) {
+				return nil, fmt.Errorf("%w: %s", errInvalidOverride, err.Error())
+			}
+			return nil, err
+		}
+		// let the token controller know about the new data the same way the OAuth service does
+		if err := r.Create(ctx, &api.SPIAccessTokenDataUpdate{
+			ObjectMeta: metav1.ObjectMeta{GenerateName: "token-update-", Namespace: token.Namespace},
+			Spec:       api.SPIAccessTokenDataUpdateSpec{TokenName: token.Name},
+		}); err != nil {
+			return nil, fmt.Errorf("failed to notify about the recovered token data: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported action '%s'", errInvalidOverride, override.Spec.Action)
+	}
+
+	return target, nil
+}
@@ -0,0 +1,164 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/tokenstorage"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/statusupdate"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestSPIAdminOverrideReconcile(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, api.AddToScheme(sch))
+	assert.NoError(t, corev1.AddToScheme(sch))
+
+	newToken := func() *api.SPIAccessToken {
+		return &api.SPIAccessToken{
+			ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "ns", Finalizers: []string{tokenStorageFinalizerName, linkedBindingsFinalizerName}},
+			Status: api.SPIAccessTokenStatus{
+				Phase:         api.SPIAccessTokenPhaseReady,
+				TokenMetadata: &api.TokenMetadata{Username: "alois", LastRefreshTime: 42},
+			},
+		}
+	}
+	newOverride := func(action api.SPIAdminOverrideAction, kind string) *api.SPIAdminOverride {
+		return &api.SPIAdminOverride{
+			ObjectMeta: metav1.ObjectMeta{Name: "override", Namespace: "ns", Generation: 1},
+			Spec: api.SPIAdminOverrideSpec{
+				Action:    action,
+				Target:    api.SPIAdminOverrideTarget{Kind: kind, Name: "token"},
+				Finalizer: tokenStorageFinalizerName,
+				Reason:    "incident",
+			},
+		}
+	}
+	binding := &api.SPIAccessTokenBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "binding", Namespace: "ns"},
+	}
+	reconcile := func(t *testing.T, override *api.SPIAdminOverride, strg tokenstorage.TokenStorage) (client.Client, *record.FakeRecorder, error) {
+		cl := statusupdate.FakeApplyClient{Client: fake.NewClientBuilder().WithScheme(sch).WithObjects(newToken(), binding, tombstoneRecord("old", "token", time.Now()), override).Build()}
+		recorder := record.NewFakeRecorder(10)
+		r := &SPIAdminOverrideReconciler{Client: cl, Scheme: sch, TokenStorage: strg, Recorder: recorder}
+		_, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(override)})
+		return cl, recorder, err
+	}
+	loadOverride := func(t *testing.T, cl client.Client) *api.SPIAdminOverride {
+		override := &api.SPIAdminOverride{}
+		assert.NoError(t, cl.Get(context.TODO(), client.ObjectKey{Name: "override", Namespace: "ns"}, override))
+		return override
+	}
+	loadToken := func(t *testing.T, cl client.Client) *api.SPIAccessToken {
+		token := &api.SPIAccessToken{}
+		assert.NoError(t, cl.Get(context.TODO(), client.ObjectKey{Name: "token", Namespace: "ns"}, token))
+		return token
+	}
+
+	t.Run("removes finalizer", func(t *testing.T) {
+		cl, recorder, err := reconcile(t, newOverride(api.SPIAdminOverrideActionRemoveFinalizer, "SPIAccessToken"), tokenstorage.TestTokenStorage{})
+		assert.NoError(t, err)
+
+		assert.Equal(t, []string{linkedBindingsFinalizerName}, loadToken(t, cl).Finalizers)
+		override := loadOverride(t, cl)
+		assert.Equal(t, api.SPIAdminOverridePhaseCompleted, override.Status.Phase)
+		assert.NotNil(t, override.Status.CompletionTime)
+		assert.Equal(t, int64(1), override.Status.ObservedGeneration)
+		assert.Len(t, recorder.Events, 2)
+		assert.Contains(t, <-recorder.Events, "RemoveFinalizer forced by SPIAdminOverride override: incident")
+	})
+
+	t.Run("deletes token data", func(t *testing.T) {
+		deleted := false
+		cl, _, err := reconcile(t, newOverride(api.SPIAdminOverrideActionDeleteTokenData, "SPIAccessToken"), tokenstorage.TestTokenStorage{
+			DeleteImpl: func(_ context.Context, token *api.SPIAccessToken) error {
+				deleted = token.Name == "token"
+				return nil
+			},
+		})
+		assert.NoError(t, err)
+
+		assert.True(t, deleted)
+		assert.Nil(t, loadToken(t, cl).Status.TokenMetadata)
+		assert.Equal(t, api.SPIAdminOverridePhaseCompleted, loadOverride(t, cl).Status.Phase)
+	})
+
+	t.Run("refreshes metadata", func(t *testing.T) {
+		cl, _, err := reconcile(t, newOverride(api.SPIAdminOverrideActionRefreshMetadata, "SPIAccessToken"), tokenstorage.TestTokenStorage{})
+		assert.NoError(t, err)
+
+		token := loadToken(t, cl)
+		assert.Equal(t, "alois", token.Status.TokenMetadata.Username)
+		assert.Equal(t, int64(0), token.Status.TokenMetadata.LastRefreshTime)
+		assert.Equal(t, api.SPIAdminOverridePhaseCompleted, loadOverride(t, cl).Status.Phase)
+	})
+
+	t.Run("recovers token data", func(t *testing.T) {
+		data := map[string]string{"spi-tombstone-old": "secret"}
+		cl, _, err := reconcile(t, newOverride(api.SPIAdminOverrideActionRecoverTokenData, "SPIAccessToken"), tombstoneTestStorage(data))
+		assert.NoError(t, err)
+
+		assert.Equal(t, map[string]string{"token": "secret"}, data)
+		updates := &api.SPIAccessTokenDataUpdateList{}
+		assert.NoError(t, cl.List(context.TODO(), updates))
+		assert.Len(t, updates.Items, 1)
+		assert.Equal(t, "token", updates.Items[0].Spec.TokenName)
+		assert.Equal(t, api.SPIAdminOverridePhaseCompleted, loadOverride(t, cl).Status.Phase)
+	})
+
+	t.Run("fails for action not applicable to kind", func(t *testing.T) {
+		override := newOverride(api.SPIAdminOverrideActionDeleteTokenData, "SPIAccessTokenBinding")
+		override.Spec.Target.Name = "binding"
+		cl, recorder, err := reconcile(t, override, tokenstorage.TestTokenStorage{})
+		assert.NoError(t, err)
+
+		override = loadOverride(t, cl)
+		assert.Equal(t, api.SPIAdminOverridePhaseFailed, override.Status.Phase)
+		assert.Contains(t, override.Status.ErrorMessage, "can only be deleted for SPIAccessTokens")
+		assert.Equal(t, int64(1), override.Status.ObservedGeneration)
+		assert.Contains(t, <-recorder.Events, "OverrideFailed")
+	})
+
+	t.Run("fails for missing target", func(t *testing.T) {
+		override := newOverride(api.SPIAdminOverrideActionRemoveFinalizer, "SPIRepositoryWebhook")
+		cl, _, err := reconcile(t, override, tokenstorage.TestTokenStorage{})
+		assert.NoError(t, err)
+
+		override = loadOverride(t, cl)
+		assert.Equal(t, api.SPIAdminOverridePhaseFailed, override.Status.Phase)
+		assert.Contains(t, override.Status.ErrorMessage, "SPIRepositoryWebhook token not found")
+	})
+
+	t.Run("does not repeat completed action", func(t *testing.T) {
+		override := newOverride(api.SPIAdminOverrideActionRemoveFinalizer, "SPIAccessToken")
+		override.Status = api.SPIAdminOverrideStatus{Phase: api.SPIAdminOverridePhaseCompleted, ObservedGeneration: 1}
+		cl, recorder, err := reconcile(t, override, tokenstorage.TestTokenStorage{})
+		assert.NoError(t, err)
+
+		assert.Len(t, loadToken(t, cl).Finalizers, 2)
+		assert.Empty(t, recorder.Events)
+	})
+}
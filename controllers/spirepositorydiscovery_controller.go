@@ -0,0 +1,187 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	kuberrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+)
+
+var spiRepositoryDiscoveryLog = log.Log.WithName("spirepositorydiscovery-controller")
+
+// SPIRepositoryDiscoveryReconciler reconciles a SPIRepositoryDiscovery object. It lists the requested page of
+// the repositories accessible using the token in the service provider and keeps the listing for the token lookup cache
+// TTL before listing the repositories again.
+type SPIRepositoryDiscoveryReconciler struct {
+	client.Client
+	Scheme                 *runtime.Scheme
+	ServiceProviderFactory serviceprovider.Factory
+	Configuration          *config.LiveConfiguration
+}
+
+//+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spirepositorydiscoveries,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spirepositorydiscoveries/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spiaccesstokens,verbs=get;list;watch
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *SPIRepositoryDiscoveryReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&api.SPIRepositoryDiscovery{}).
+		Watches(&source.Kind{Type: &api.SPIAccessToken{}}, handler.EnqueueRequestsFromMapFunc(func(o client.Object) []reconcile.Request {
+			discoveries := &api.SPIRepositoryDiscoveryList{}
+			if err := r.Client.List(context.TODO(), discoveries, client.InNamespace(o.GetNamespace())); err != nil {
+				spiRepositoryDiscoveryLog.Error(err, "failed to list SPIRepositoryDiscoveries while determining the ones affected by SPIAccessToken",
+					"SPIAccessTokenName", o.GetName(), "SPIAccessTokenNamespace", o.GetNamespace())
+				return []reconcile.Request{}
+			}
+			ret := make([]reconcile.Request, 0, len(discoveries.Items))
+			for _, d := range discoveries.Items {
+				if d.Spec.TokenName != o.GetName() {
+					continue
+				}
+				ret = append(ret, reconcile.Request{
+					NamespacedName: types.NamespacedName{
+						Name:      d.Name,
+						Namespace: d.Namespace,
+					},
+				})
+			}
+			return ret
+		})).
+		Complete(monitored(mgr, "SPIRepositoryDiscovery", &api.SPIRepositoryDiscovery{}, r))
+}
+
+func (r *SPIRepositoryDiscoveryReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	lg := log.FromContext(ctx)
+
+	discovery := api.SPIRepositoryDiscovery{}
+	if err := r.Get(ctx, req.NamespacedName, &discovery); err != nil {
+		if kuberrors.IsNotFound(err) {
+			lg.Info("object not found")
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, NewReconcileError(err, "failed to load the SPIRepositoryDiscovery from the cluster")
+	}
+
+	token := &api.SPIAccessToken{}
+	if err := r.Get(ctx, client.ObjectKey{Name: discovery.Spec.TokenName, Namespace: discovery.Namespace}, token); err != nil && !kuberrors.IsNotFound(err) {
+		return ctrl.Result{}, NewReconcileError(err, "failed to load the SPIAccessToken from the cluster")
+	}
+
+	ttl := r.Configuration.Get().TokenLookupCacheTtl
+
+	tokenReady := token.Status.Phase == api.SPIAccessTokenPhaseReady
+	if refreshIn := repositoryListingRefreshIn(&discovery, ttl); tokenReady && refreshIn > 0 {
+		// the listing of the current spec is still fresh
+		return ctrl.Result{RequeueAfter: refreshIn}, nil
+	}
+
+	result := ctrl.Result{}
+	discovery.Status.ObservedGeneration = discovery.Generation
+	discovery.Status.ErrorReason = ""
+	discovery.Status.ErrorMessage = ""
+
+	if !tokenReady {
+		// the discovery is reconciled again once the token changes, there's no need to requeue
+		discovery.Status.ErrorReason = api.SPIRepositoryDiscoveryErrorReasonTokenNotReady
+		discovery.Status.ErrorMessage = "the token doesn't exist or is not ready"
+		discovery.Status.Repositories = nil
+		discovery.Status.HasNextPage = false
+		discovery.Status.LastRefreshTime = nil
+	} else {
+		page, reason, err := r.listRepositories(ctx, &discovery, token)
+		if err != nil {
+			lg.Error(err, "failed to list the accessible repositories")
+			discovery.Status.ErrorReason = reason
+			discovery.Status.ErrorMessage = err.Error()
+		}
+		discovery.Status.Repositories = page.Repositories
+		discovery.Status.HasNextPage = page.HasNextPage
+		// the failures are cached, too, so that the service provider is not asked again until the TTL expires
+		discovery.Status.LastRefreshTime = &metav1.Time{Time: time.Now()}
+		result.RequeueAfter = ttl
+	}
+
+	if err := updateRepositoryDiscoveryStatusIfChanged(ctx, r.Client, &discovery); err != nil {
+		return ctrl.Result{}, NewReconcileError(err, "failed to update the status of the SPIRepositoryDiscovery")
+	}
+
+	return result, nil
+}
+
+// listRepositories lists the page of the repositories requested by the discovery in the service provider of the token.
+// The error reason is returned together with the error.
+func (r *SPIRepositoryDiscoveryReconciler) listRepositories(ctx context.Context, discovery *api.SPIRepositoryDiscovery, token *api.SPIAccessToken) (serviceprovider.RepositoryPage, api.SPIRepositoryDiscoveryErrorReason, error) {
+	sp, err := r.ServiceProviderFactory.FromRepoUrlInNamespace(ctx, token.Spec.ServiceProviderUrl, token.Namespace)
+	if err != nil {
+		return serviceprovider.RepositoryPage{}, api.SPIRepositoryDiscoveryErrorReasonUnknownServiceProvider, err
+	}
+
+	lister, ok := sp.(serviceprovider.RepositoryLister)
+	if !ok {
+		return serviceprovider.RepositoryPage{}, api.SPIRepositoryDiscoveryErrorReasonUnsupported, fmt.Errorf("the %s service provider doesn't support listing the accessible repositories", sp.GetType())
+	}
+
+	page := discovery.Spec.Page
+	if page < 1 {
+		page = 1
+	}
+	perPage := discovery.Spec.PerPage
+	if perPage < 1 {
+		perPage = api.DefaultRepositoryDiscoveryPerPage
+	} else if perPage > api.MaxRepositoryDiscoveryPerPage {
+		perPage = api.MaxRepositoryDiscoveryPerPage
+	}
+
+	repos, err := lister.ListAccessibleRepositories(ctx, token, page, perPage)
+	if err != nil {
+		return serviceprovider.RepositoryPage{}, api.SPIRepositoryDiscoveryErrorReasonServiceProviderError, err
+	}
+
+	// the status must not grow beyond the requested page even if the service provider returns more
+	if len(repos.Repositories) > perPage {
+		repos.Repositories = repos.Repositories[:perPage]
+		repos.HasNextPage = true
+	}
+
+	return repos, "", nil
+}
+
+// repositoryListingRefreshIn returns the time remaining until the listing of the repositories in the status of
+// the discovery needs to be refreshed. The listing needs to be refreshed immediately if it was made for a different spec
+// or if the service provider has not been asked for it.
+func repositoryListingRefreshIn(discovery *api.SPIRepositoryDiscovery, ttl time.Duration) time.Duration {
+	if discovery.Status.LastRefreshTime == nil || discovery.Status.ObservedGeneration != discovery.Generation {
+		return 0
+	}
+
+	return time.Until(discovery.Status.LastRefreshTime.Add(ttl))
+}
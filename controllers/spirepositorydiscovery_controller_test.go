@@ -0,0 +1,158 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/statusupdate"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// listingServiceProvider is a service provider listing the repositories "repo-<page>-<index>". It only implements
+// the methods used by the SPIRepositoryDiscoveryReconciler.
+type listingServiceProvider struct {
+	serviceprovider.ServiceProvider
+	calls *int
+}
+
+func (p listingServiceProvider) GetType() api.ServiceProviderType {
+	return "Acme"
+}
+
+func (p listingServiceProvider) ListAccessibleRepositories(_ context.Context, _ *api.SPIAccessToken, page int, perPage int) (serviceprovider.RepositoryPage, error) {
+	*p.calls++
+	ret := serviceprovider.RepositoryPage{HasNextPage: page < 2}
+	for i := 0; i < perPage; i++ {
+		ret.Repositories = append(ret.Repositories, fmt.Sprintf("https://acme.com/repo-%d-%d", page, i))
+	}
+	return ret, nil
+}
+
+func TestSPIRepositoryDiscoveryReconcile(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, api.AddToScheme(sch))
+	assert.NoError(t, corev1.AddToScheme(sch))
+
+	token := &api.SPIAccessToken{
+		ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "ns"},
+		Spec:       api.SPIAccessTokenSpec{ServiceProviderUrl: "https://acme.com"},
+		Status:     api.SPIAccessTokenStatus{Phase: api.SPIAccessTokenPhaseReady},
+	}
+	discovery := &api.SPIRepositoryDiscovery{
+		ObjectMeta: metav1.ObjectMeta{Name: "discovery", Namespace: "ns", Generation: 1},
+		Spec:       api.SPIRepositoryDiscoverySpec{TokenName: "token", PerPage: 2},
+	}
+
+	calls := 0
+	cfg := config.NewLiveConfiguration(config.Configuration{
+		TokenLookupCacheTtl: time.Hour,
+		ServiceProviders:    []config.ServiceProviderConfiguration{{ServiceProviderType: "Acme"}},
+	})
+	cl := statusupdate.FakeApplyClient{Client: fake.NewClientBuilder().WithScheme(sch).WithObjects(token, discovery).Build()}
+	r := &SPIRepositoryDiscoveryReconciler{
+		Client: cl,
+		Scheme: sch,
+		ServiceProviderFactory: serviceprovider.Factory{
+			Configuration:    cfg,
+			KubernetesClient: cl,
+			Initializers: map[config.ServiceProviderType]serviceprovider.Initializer{
+				"Acme": {
+					Probe: serviceprovider.ProbeFunc(func(_ *http.Client, _ string) (string, error) {
+						return "https://acme.com", nil
+					}),
+					Constructor: serviceprovider.ConstructorFunc(func(_ *serviceprovider.Factory, _ string) (serviceprovider.ServiceProvider, error) {
+						return listingServiceProvider{calls: &calls}, nil
+					}),
+				},
+			},
+		},
+		Configuration: cfg,
+	}
+
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(discovery)}
+	reconcileAndGet := func() (ctrl.Result, *api.SPIRepositoryDiscovery) {
+		res, err := r.Reconcile(context.TODO(), req)
+		assert.NoError(t, err)
+		actual := &api.SPIRepositoryDiscovery{}
+		assert.NoError(t, cl.Get(context.TODO(), req.NamespacedName, actual))
+		return res, actual
+	}
+
+	res, actual := reconcileAndGet()
+	assert.Equal(t, time.Hour, res.RequeueAfter)
+	assert.Equal(t, []string{"https://acme.com/repo-1-0", "https://acme.com/repo-1-1"}, actual.Status.Repositories)
+	assert.True(t, actual.Status.HasNextPage)
+	assert.Empty(t, actual.Status.ErrorReason)
+	assert.NotNil(t, actual.Status.LastRefreshTime)
+	assert.Equal(t, 1, calls)
+
+	t.Run("cached listing is reused", func(t *testing.T) {
+		res, _ := reconcileAndGet()
+		assert.True(t, res.RequeueAfter > 0 && res.RequeueAfter <= time.Hour)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("changed spec is listed again", func(t *testing.T) {
+		_, actual := reconcileAndGet()
+		actual.Spec.Page = 2
+		actual.Generation = 2
+		assert.NoError(t, cl.Update(context.TODO(), actual))
+
+		_, actual = reconcileAndGet()
+		assert.Equal(t, []string{"https://acme.com/repo-2-0", "https://acme.com/repo-2-1"}, actual.Status.Repositories)
+		assert.False(t, actual.Status.HasNextPage)
+		assert.Equal(t, int64(2), actual.Status.ObservedGeneration)
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("page size is capped", func(t *testing.T) {
+		_, actual := reconcileAndGet()
+		actual.Spec.PerPage = 1000
+		actual.Generation = 3
+		assert.NoError(t, cl.Update(context.TODO(), actual))
+
+		_, actual = reconcileAndGet()
+		assert.Len(t, actual.Status.Repositories, api.MaxRepositoryDiscoveryPerPage)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("token not ready clears the fresh listing", func(t *testing.T) {
+		token := &api.SPIAccessToken{}
+		assert.NoError(t, cl.Get(context.TODO(), client.ObjectKey{Name: "token", Namespace: "ns"}, token))
+		token.Status.Phase = api.SPIAccessTokenPhaseAwaitingTokenData
+		assert.NoError(t, cl.Update(context.TODO(), token))
+
+		res, actual := reconcileAndGet()
+		assert.Equal(t, time.Duration(0), res.RequeueAfter)
+		assert.Equal(t, api.SPIRepositoryDiscoveryErrorReasonTokenNotReady, actual.Status.ErrorReason)
+		assert.Empty(t, actual.Status.Repositories)
+		assert.Nil(t, actual.Status.LastRefreshTime)
+		assert.Equal(t, 3, calls)
+	})
+}
@@ -0,0 +1,308 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	stderrors "errors"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/finalizer"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+)
+
+var spiRepositoryWebhookLog = log.Log.WithName("spirepositorywebhook-controller")
+
+const repositoryWebhookFinalizerName = "spi.appstudio.redhat.com/repository-webhook"
+
+// repositoryWebhookSecretCheckInterval is how often the secrets of the ready webhooks are checked for changes. The
+// secrets are not in the cache of the operator, so their rotation cannot be watched for.
+const repositoryWebhookSecretCheckInterval = 5 * time.Minute
+
+// errWebhookTokenNotFound is returned when the token the webhook was created with no longer exists, so the webhook
+// cannot be deleted from the repository.
+var errWebhookTokenNotFound = stderrors.New("the token the webhook was created with no longer exists")
+
+// SPIRepositoryWebhookReconciler reconciles a SPIRepositoryWebhook object. It makes sure the webhook exists in
+// the repository of the binding of the SPIRepositoryWebhook and deletes it when the SPIRepositoryWebhook is deleted.
+type SPIRepositoryWebhookReconciler struct {
+	client.Client
+	// APIReader reads the secrets of the webhooks. They are created by the users and therefore not in the cache of
+	// the operator, which only contains the secrets created by SPI.
+	APIReader              client.Reader
+	Scheme                 *runtime.Scheme
+	ServiceProviderFactory serviceprovider.Factory
+	finalizers             finalizer.Finalizers
+}
+
+//+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spirepositorywebhooks,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spirepositorywebhooks/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spirepositorywebhooks/finalizers,verbs=update
+//+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spiaccesstokenbindings,verbs=get;list;watch
+//+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spiaccesstokens,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *SPIRepositoryWebhookReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.finalizers = finalizer.NewFinalizers()
+	if err := r.finalizers.Register(repositoryWebhookFinalizerName, &repositoryWebhookFinalizer{
+		client:                 r.Client,
+		serviceProviderFactory: &r.ServiceProviderFactory,
+	}); err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&api.SPIRepositoryWebhook{}).
+		Watches(&source.Kind{Type: &api.SPIAccessTokenBinding{}}, handler.EnqueueRequestsFromMapFunc(func(o client.Object) []reconcile.Request {
+			webhooks := &api.SPIRepositoryWebhookList{}
+			if err := r.Client.List(context.TODO(), webhooks, client.InNamespace(o.GetNamespace())); err != nil {
+				spiRepositoryWebhookLog.Error(err, "failed to list SPIRepositoryWebhooks while determining the ones affected by SPIAccessTokenBinding",
+					"SPIAccessTokenBindingName", o.GetName(), "SPIAccessTokenBindingNamespace", o.GetNamespace())
+				return []reconcile.Request{}
+			}
+			ret := make([]reconcile.Request, 0, len(webhooks.Items))
+			for _, w := range webhooks.Items {
+				if w.Spec.BindingName != o.GetName() {
+					continue
+				}
+				ret = append(ret, reconcile.Request{
+					NamespacedName: types.NamespacedName{
+						Name:      w.Name,
+						Namespace: w.Namespace,
+					},
+				})
+			}
+			return ret
+		})).
+		Complete(monitored(mgr, "SPIRepositoryWebhook", &api.SPIRepositoryWebhook{}, r))
+}
+
+func (r *SPIRepositoryWebhookReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	lg := log.FromContext(ctx)
+
+	webhook := api.SPIRepositoryWebhook{}
+	if err := r.Get(ctx, req.NamespacedName, &webhook); err != nil {
+		if errors.IsNotFound(err) {
+			lg.Info("object not found")
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, NewReconcileError(err, "failed to load the SPIRepositoryWebhook from the cluster")
+	}
+
+	finalizationResult, err := r.finalizers.Finalize(ctx, &webhook)
+	if err != nil {
+		if finalizationResult.StatusUpdated {
+			if uerr := updateRepositoryWebhookStatusIfChanged(ctx, r.Client, &webhook); uerr != nil {
+				lg.Error(uerr, "failed to update the status with the finalization error", "error", err)
+			}
+		}
+		// the webhook stays in the repository for as long as the finalizer is in place, so let's retry
+		return ctrl.Result{}, NewReconcileError(err, "failed to finalize")
+	}
+	if finalizationResult.Updated {
+		if err = r.Client.Update(ctx, &webhook); err != nil {
+			return ctrl.Result{}, NewReconcileError(err, "failed to update based on finalization result")
+		}
+	}
+
+	if webhook.DeletionTimestamp != nil {
+		lg.Info("repository webhook being deleted, no other changes required after completed finalization")
+		return ctrl.Result{}, nil
+	}
+
+	binding := &api.SPIAccessTokenBinding{}
+	if err := r.Get(ctx, client.ObjectKey{Name: webhook.Spec.BindingName, Namespace: webhook.Namespace}, binding); err != nil && !errors.IsNotFound(err) {
+		return ctrl.Result{}, NewReconcileError(err, "failed to load the SPIAccessTokenBinding from the cluster")
+	}
+
+	if binding.Status.Phase != api.SPIAccessTokenBindingPhaseInjected {
+		// the webhook is reconciled again once the binding changes
+		r.updateStatusError(ctx, &webhook, api.SPIRepositoryWebhookErrorReasonBindingNotReady, fmt.Errorf("the binding doesn't exist or its secret is not injected yet"))
+		return ctrl.Result{}, nil
+	}
+
+	repoUrl := binding.Spec.RepoUrl
+	tokenName := binding.Status.LinkedAccessTokenName
+
+	hook := serviceprovider.Webhook{Url: webhook.Spec.Url, Events: webhook.Spec.Events}
+	secretChecksum := ""
+	if webhook.Spec.SecretName != "" {
+		secret := &corev1.Secret{}
+		if err := r.APIReader.Get(ctx, client.ObjectKey{Name: webhook.Spec.SecretName, Namespace: webhook.Namespace}, secret); err != nil {
+			if errors.IsNotFound(err) {
+				r.updateStatusError(ctx, &webhook, api.SPIRepositoryWebhookErrorReasonSecretNotFound, err)
+			}
+			return ctrl.Result{}, NewReconcileError(err, "failed to load the secret of the webhook")
+		}
+		hook.Secret = string(secret.Data[api.RepositoryWebhookSecretKey])
+		secretChecksum = repositoryWebhookSecretChecksum(hook.Secret)
+	}
+
+	if webhook.Status.Phase == api.SPIRepositoryWebhookPhaseReady && webhook.Status.ObservedGeneration == webhook.Generation &&
+		webhook.Status.RepoUrl == repoUrl && webhook.Status.TokenName == tokenName && webhook.Status.SecretChecksum == secretChecksum {
+		// nothing changed since the webhook was created
+		return repositoryWebhookResult(&webhook), nil
+	}
+
+	token := &api.SPIAccessToken{}
+	if err := r.Get(ctx, client.ObjectKey{Name: tokenName, Namespace: webhook.Namespace}, token); err != nil {
+		return ctrl.Result{}, NewReconcileError(err, "failed to load the SPIAccessToken linked to the binding")
+	}
+
+	sp, err := r.ServiceProviderFactory.FromRepoUrlInNamespace(ctx, repoUrl, webhook.Namespace)
+	if err != nil {
+		r.updateStatusError(ctx, &webhook, api.SPIRepositoryWebhookErrorReasonUnknownServiceProvider, err)
+		return ctrl.Result{}, NewReconcileError(err, "failed to determine the service provider of the repository")
+	}
+
+	manager, ok := sp.(serviceprovider.WebhookManager)
+	if !ok {
+		r.updateStatusError(ctx, &webhook, api.SPIRepositoryWebhookErrorReasonUnsupported, fmt.Errorf("the %s service provider doesn't support managing the webhooks", sp.GetType()))
+		return ctrl.Result{}, nil
+	}
+
+	if !manager.CanManageWebhooks(token) {
+		// the webhook is reconciled again once the binding is linked to another token
+		r.updateStatusError(ctx, &webhook, api.SPIRepositoryWebhookErrorReasonInsufficientPermissions, fmt.Errorf("the scopes granted to the token linked to the binding don't allow managing the webhooks"))
+		return ctrl.Result{}, nil
+	}
+
+	if webhook.Status.WebhookId != "" && webhook.Status.RepoUrl != repoUrl {
+		// the binding points to another repository now, so let's remove the webhook from the previous one
+		if err := deleteRepositoryWebhook(ctx, r.Client, &r.ServiceProviderFactory, &webhook); err != nil {
+			if !stderrors.Is(err, errWebhookTokenNotFound) {
+				return ctrl.Result{}, NewReconcileError(err, "failed to delete the webhook from the previous repository")
+			}
+			lg.Info("the token of the webhook no longer exists, leaving the webhook in the previous repository", "repoUrl", webhook.Status.RepoUrl, "webhookId", webhook.Status.WebhookId)
+		}
+		webhook.Status.WebhookId = ""
+	}
+
+	id, err := manager.EnsureWebhook(ctx, token, repoUrl, webhook.Status.WebhookId, hook)
+	if err != nil {
+		r.updateStatusError(ctx, &webhook, api.SPIRepositoryWebhookErrorReasonServiceProviderError, err)
+		return ctrl.Result{}, NewReconcileError(err, "failed to ensure the webhook in the repository")
+	}
+
+	webhook.Status.Phase = api.SPIRepositoryWebhookPhaseReady
+	webhook.Status.ErrorReason = ""
+	webhook.Status.ErrorMessage = ""
+	webhook.Status.RepoUrl = repoUrl
+	webhook.Status.TokenName = tokenName
+	webhook.Status.WebhookId = id
+	webhook.Status.SecretChecksum = secretChecksum
+	webhook.Status.ObservedGeneration = webhook.Generation
+
+	if err := updateRepositoryWebhookStatusIfChanged(ctx, r.Client, &webhook); err != nil {
+		return ctrl.Result{}, NewReconcileError(err, "failed to update the status of the SPIRepositoryWebhook")
+	}
+
+	return repositoryWebhookResult(&webhook), nil
+}
+
+// repositoryWebhookResult requeues the ready webhooks with a secret so that the rotation of the secret is noticed.
+func repositoryWebhookResult(webhook *api.SPIRepositoryWebhook) ctrl.Result {
+	if webhook.Spec.SecretName == "" {
+		return ctrl.Result{}
+	}
+	return ctrl.Result{RequeueAfter: repositoryWebhookSecretCheckInterval}
+}
+
+// repositoryWebhookSecretChecksum returns the checksum of the webhook secret recorded in the status. The secret itself
+// is never stored in the status.
+func repositoryWebhookSecretChecksum(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func (r *SPIRepositoryWebhookReconciler) updateStatusError(ctx context.Context, webhook *api.SPIRepositoryWebhook, reason api.SPIRepositoryWebhookErrorReason, err error) {
+	webhook.Status.Phase = api.SPIRepositoryWebhookPhaseError
+	webhook.Status.ErrorReason = reason
+	webhook.Status.ErrorMessage = err.Error()
+	if uerr := updateRepositoryWebhookStatusIfChanged(ctx, r.Client, webhook); uerr != nil {
+		log.FromContext(ctx).Error(uerr, "failed to update the status with error", "reason", reason, "error", err)
+	}
+}
+
+// deleteRepositoryWebhook deletes the webhook recorded in the status of the SPIRepositoryWebhook from its repository.
+// If the token the webhook was created with no longer exists, the webhook cannot be deleted and errWebhookTokenNotFound
+// is returned.
+func deleteRepositoryWebhook(ctx context.Context, cl client.Client, factory *serviceprovider.Factory, webhook *api.SPIRepositoryWebhook) error {
+	token := &api.SPIAccessToken{}
+	if err := cl.Get(ctx, client.ObjectKey{Name: webhook.Status.TokenName, Namespace: webhook.Namespace}, token); err != nil {
+		if errors.IsNotFound(err) {
+			return errWebhookTokenNotFound
+		}
+		return fmt.Errorf("failed to load the token of the webhook: %w", err)
+	}
+
+	sp, err := factory.FromRepoUrlInNamespace(ctx, webhook.Status.RepoUrl, webhook.Namespace)
+	if err != nil {
+		return fmt.Errorf("failed to determine the service provider of the repository: %w", err)
+	}
+
+	manager, ok := sp.(serviceprovider.WebhookManager)
+	if !ok {
+		return nil
+	}
+
+	return manager.DeleteWebhook(ctx, token, webhook.Status.RepoUrl, webhook.Status.WebhookId)
+}
+
+// repositoryWebhookFinalizer deletes the webhook from the repository.
+type repositoryWebhookFinalizer struct {
+	client                 client.Client
+	serviceProviderFactory *serviceprovider.Factory
+}
+
+var _ finalizer.Finalizer = (*repositoryWebhookFinalizer)(nil)
+
+func (f *repositoryWebhookFinalizer) Finalize(ctx context.Context, obj client.Object) (finalizer.Result, error) {
+	res := finalizer.Result{}
+	webhook, ok := obj.(*api.SPIRepositoryWebhook)
+	if !ok {
+		return res, fmt.Errorf("unexpected object type")
+	}
+
+	if webhook.Status.WebhookId == "" {
+		return res, nil
+	}
+
+	err := deleteRepositoryWebhook(ctx, f.client, f.serviceProviderFactory, webhook)
+	if stderrors.Is(err, errWebhookTokenNotFound) {
+		// the deletion is blocked until the token is restored or the finalizer is removed manually
+		webhook.Status.Phase = api.SPIRepositoryWebhookPhaseError
+		webhook.Status.ErrorReason = api.SPIRepositoryWebhookErrorReasonTokenNotFound
+		webhook.Status.ErrorMessage = err.Error()
+		res.StatusUpdated = true
+	}
+	return res, err
+}
@@ -0,0 +1,219 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/statusupdate"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/finalizer"
+)
+
+// webhookServiceProvider is a service provider keeping the webhooks in a map. It only implements the methods used by
+// the SPIRepositoryWebhookReconciler.
+type webhookServiceProvider struct {
+	serviceprovider.ServiceProvider
+	hooks map[string]serviceprovider.Webhook
+}
+
+func (p webhookServiceProvider) GetType() api.ServiceProviderType {
+	return "Acme"
+}
+
+func (p webhookServiceProvider) EnsureWebhook(_ context.Context, _ *api.SPIAccessToken, repoUrl string, id string, webhook serviceprovider.Webhook) (string, error) {
+	if id == "" {
+		id = repoUrl + "#hook"
+	}
+	p.hooks[id] = webhook
+	return id, nil
+}
+
+func (p webhookServiceProvider) DeleteWebhook(_ context.Context, _ *api.SPIAccessToken, _ string, id string) error {
+	delete(p.hooks, id)
+	return nil
+}
+
+func (p webhookServiceProvider) CanManageWebhooks(token *api.SPIAccessToken) bool {
+	return token.Status.TokenMetadata != nil && len(token.Status.TokenMetadata.Scopes) == 1 && token.Status.TokenMetadata.Scopes[0] == "hooks"
+}
+
+func TestSPIRepositoryWebhookReconcile(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, api.AddToScheme(sch))
+	assert.NoError(t, corev1.AddToScheme(sch))
+
+	token := &api.SPIAccessToken{
+		ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "ns"},
+		Spec: api.SPIAccessTokenSpec{
+			ServiceProviderUrl: "https://acme.com",
+		},
+		Status: api.SPIAccessTokenStatus{
+			Phase:         api.SPIAccessTokenPhaseReady,
+			TokenMetadata: &api.TokenMetadata{Scopes: []string{"hooks"}},
+		},
+	}
+	binding := &api.SPIAccessTokenBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "binding", Namespace: "ns"},
+		Spec:       api.SPIAccessTokenBindingSpec{RepoUrl: "https://acme.com/org/repo"},
+		Status: api.SPIAccessTokenBindingStatus{
+			Phase:                 api.SPIAccessTokenBindingPhaseInjected,
+			LinkedAccessTokenName: "token",
+		},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "hook-secret", Namespace: "ns"},
+		Data:       map[string][]byte{"secret": []byte("sssh")},
+	}
+	webhook := &api.SPIRepositoryWebhook{
+		ObjectMeta: metav1.ObjectMeta{Name: "webhook", Namespace: "ns", Generation: 1},
+		Spec: api.SPIRepositoryWebhookSpec{
+			BindingName: "binding",
+			Url:         "https://ci.acme.com/hook",
+			SecretName:  "hook-secret",
+		},
+	}
+
+	sp := webhookServiceProvider{hooks: map[string]serviceprovider.Webhook{}}
+	cl := statusupdate.FakeApplyClient{Client: fake.NewClientBuilder().WithScheme(sch).WithObjects(token, binding, secret, webhook).Build()}
+	r := &SPIRepositoryWebhookReconciler{
+		Client:    cl,
+		APIReader: cl,
+		Scheme:    sch,
+		ServiceProviderFactory: serviceprovider.Factory{
+			Configuration: config.NewLiveConfiguration(config.Configuration{
+				ServiceProviders: []config.ServiceProviderConfiguration{{ServiceProviderType: "Acme"}},
+			}),
+			KubernetesClient: cl,
+			Initializers: map[config.ServiceProviderType]serviceprovider.Initializer{
+				"Acme": {
+					Probe: serviceprovider.ProbeFunc(func(_ *http.Client, _ string) (string, error) {
+						return "https://acme.com", nil
+					}),
+					Constructor: serviceprovider.ConstructorFunc(func(_ *serviceprovider.Factory, _ string) (serviceprovider.ServiceProvider, error) {
+						return sp, nil
+					}),
+				},
+			},
+		},
+	}
+	r.finalizers = finalizer.NewFinalizers()
+	assert.NoError(t, r.finalizers.Register(repositoryWebhookFinalizerName, &repositoryWebhookFinalizer{
+		client:                 cl,
+		serviceProviderFactory: &r.ServiceProviderFactory,
+	}))
+
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(webhook)}
+	reconcileAndGet := func() *api.SPIRepositoryWebhook {
+		res, err := r.Reconcile(context.TODO(), req)
+		assert.NoError(t, err)
+		assert.Equal(t, repositoryWebhookSecretCheckInterval, res.RequeueAfter)
+		actual := &api.SPIRepositoryWebhook{}
+		assert.NoError(t, cl.Get(context.TODO(), req.NamespacedName, actual))
+		return actual
+	}
+
+	actual := reconcileAndGet()
+	assert.Equal(t, api.SPIRepositoryWebhookPhaseReady, actual.Status.Phase)
+	assert.Equal(t, "https://acme.com/org/repo", actual.Status.RepoUrl)
+	assert.Equal(t, "token", actual.Status.TokenName)
+	assert.Equal(t, "https://acme.com/org/repo#hook", actual.Status.WebhookId)
+	assert.Contains(t, actual.Finalizers, repositoryWebhookFinalizerName)
+	assert.Equal(t, serviceprovider.Webhook{Url: "https://ci.acme.com/hook", Secret: "sssh"}, sp.hooks["https://acme.com/org/repo#hook"])
+
+	t.Run("moves the webhook with the binding", func(t *testing.T) {
+		b := &api.SPIAccessTokenBinding{}
+		assert.NoError(t, cl.Get(context.TODO(), client.ObjectKeyFromObject(binding), b))
+		b.Spec.RepoUrl = "https://acme.com/org/other"
+		assert.NoError(t, cl.Update(context.TODO(), b))
+
+		actual := reconcileAndGet()
+		assert.Equal(t, "https://acme.com/org/other#hook", actual.Status.WebhookId)
+		assert.Len(t, sp.hooks, 1)
+		assert.Contains(t, sp.hooks, "https://acme.com/org/other#hook")
+	})
+
+	t.Run("updates the webhook with the rotated secret", func(t *testing.T) {
+		sec := &corev1.Secret{}
+		assert.NoError(t, cl.Get(context.TODO(), client.ObjectKeyFromObject(secret), sec))
+		sec.Data["secret"] = []byte("rotated")
+		assert.NoError(t, cl.Update(context.TODO(), sec))
+
+		actual := reconcileAndGet()
+		assert.Equal(t, repositoryWebhookSecretChecksum("rotated"), actual.Status.SecretChecksum)
+		assert.Equal(t, "rotated", sp.hooks["https://acme.com/org/other#hook"].Secret)
+	})
+
+	t.Run("requires the scopes to manage the webhooks", func(t *testing.T) {
+		tkn := &api.SPIAccessToken{}
+		assert.NoError(t, cl.Get(context.TODO(), client.ObjectKeyFromObject(token), tkn))
+		tkn.Status.TokenMetadata.Scopes = []string{"read"}
+		assert.NoError(t, cl.Update(context.TODO(), tkn))
+		defer func() {
+			tkn.Status.TokenMetadata.Scopes = []string{"hooks"}
+			assert.NoError(t, cl.Update(context.TODO(), tkn))
+		}()
+
+		wh := &api.SPIRepositoryWebhook{}
+		assert.NoError(t, cl.Get(context.TODO(), req.NamespacedName, wh))
+		wh.Spec.Events = []string{"pull_request"}
+		wh.Generation = 2
+		assert.NoError(t, cl.Update(context.TODO(), wh))
+
+		_, err := r.Reconcile(context.TODO(), req)
+		assert.NoError(t, err)
+		assert.NoError(t, cl.Get(context.TODO(), req.NamespacedName, wh))
+		assert.Equal(t, api.SPIRepositoryWebhookPhaseError, wh.Status.Phase)
+		assert.Equal(t, api.SPIRepositoryWebhookErrorReasonInsufficientPermissions, wh.Status.ErrorReason)
+	})
+
+	t.Run("blocks the deletion without the token", func(t *testing.T) {
+		tkn := &api.SPIAccessToken{}
+		assert.NoError(t, cl.Get(context.TODO(), client.ObjectKeyFromObject(token), tkn))
+		assert.NoError(t, cl.Delete(context.TODO(), tkn))
+		defer func() {
+			tkn.ResourceVersion = ""
+			assert.NoError(t, cl.Create(context.TODO(), tkn))
+		}()
+
+		wh := &api.SPIRepositoryWebhook{}
+		assert.NoError(t, cl.Get(context.TODO(), req.NamespacedName, wh))
+		assert.NoError(t, cl.Delete(context.TODO(), wh))
+
+		_, err := r.Reconcile(context.TODO(), req)
+		assert.Error(t, err)
+		assert.NoError(t, cl.Get(context.TODO(), req.NamespacedName, wh))
+		assert.Contains(t, wh.Finalizers, repositoryWebhookFinalizerName)
+		assert.Equal(t, api.SPIRepositoryWebhookErrorReasonTokenNotFound, wh.Status.ErrorReason)
+		assert.Len(t, sp.hooks, 1)
+	})
+
+	t.Run("deletes the webhook", func(t *testing.T) {
+		_, err := r.Reconcile(context.TODO(), req)
+		assert.NoError(t, err)
+		assert.Empty(t, sp.hooks)
+	})
+}
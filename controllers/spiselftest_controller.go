@@ -0,0 +1,438 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/tokenstorage"
+)
+
+const (
+	// defaultSelfTestTimeout is the timeout of the self-tests that don't specify their own.
+	defaultSelfTestTimeout = 5 * time.Minute
+	// selfTestPollInterval is how often the progress of a running self-test is checked in addition to the watches of
+	// the test objects.
+	selfTestPollInterval = 5 * time.Second
+	// selfTestUsername is the username of the test credential.
+	selfTestUsername = "spi-self-test"
+)
+
+// selfTestSteps are the steps of the self-test in the order they are performed.
+var selfTestSteps = []api.SPISelfTestStep{
+	api.SPISelfTestStepCreateToken,
+	api.SPISelfTestStepUploadCredential,
+	api.SPISelfTestStepCreateBinding,
+	api.SPISelfTestStepVerifySecret,
+	api.SPISelfTestStepCleanup,
+}
+
+// SPISelfTestReconciler reconciles a SPISelfTest object. It performs the steps of the test one after another, each
+// possibly over several reconciliations while it waits for the other controllers, and records their results in
+// the status. The test objects are owned by the self-test so that they are garbage collected with it even if
+// the cleanup fails.
+type SPISelfTestReconciler struct {
+	client.Client
+	Scheme        *runtime.Scheme
+	TokenStorage  tokenstorage.TokenStorage
+	Configuration *config.LiveConfiguration
+}
+
+//+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spiselftests,verbs=get;list;watch
+//+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spiselftests/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spiaccesstokens,verbs=get;list;watch;create;delete
+//+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spiaccesstokenbindings,verbs=get;list;watch;create;delete
+//+kubebuilder:rbac:groups=appstudio.redhat.com,resources=spiaccesstokendataupdates,verbs=create
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *SPISelfTestReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&api.SPISelfTest{}).
+		Owns(&api.SPIAccessToken{}).
+		Owns(&api.SPIAccessTokenBinding{}).
+		Complete(monitored(mgr, "SPISelfTest", &api.SPISelfTest{}, r))
+}
+
+func (r *SPISelfTestReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	lg := log.FromContext(ctx)
+
+	test := api.SPISelfTest{}
+	if err := r.Get(ctx, req.NamespacedName, &test); err != nil {
+		if errors.IsNotFound(err) {
+			lg.Info("object not found")
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, NewReconcileError(err, "failed to load the SPISelfTest from the cluster")
+	}
+
+	if test.DeletionTimestamp != nil || test.Status.Phase == api.SPISelfTestPhaseSucceeded || test.Status.Phase == api.SPISelfTestPhaseFailed {
+		// the test is run only once
+		return ctrl.Result{}, nil
+	}
+
+	if test.Status.StartTime == nil {
+		lg.Info("starting the self-test")
+		now := metav1.Now()
+		test.Status.Phase = api.SPISelfTestPhaseRunning
+		test.Status.StartTime = &now
+	}
+
+	for {
+		step, failed := nextSelfTestStep(&test)
+		if step == "" {
+			finishSelfTest(&test)
+			lg.Info("self-test finished", "phase", test.Status.Phase)
+			break
+		}
+
+		if failed && step != api.SPISelfTestStepCleanup {
+			recordSelfTestStep(&test, step, api.SPISelfTestStepOutcomeSkipped, "a previous step failed")
+			continue
+		}
+
+		outcome, message, err := r.performStep(ctx, &test, step)
+		if err != nil {
+			return ctrl.Result{}, NewReconcileError(err, fmt.Sprintf("failed to perform the %s step of the self-test", step))
+		}
+
+		if outcome == "" {
+			wait := time.Until(selfTestStepDeadline(&test, step))
+			if wait > 0 {
+				if err := updateSelfTestStatusIfChanged(ctx, r.Client, &test); err != nil {
+					return ctrl.Result{}, NewReconcileError(err, "failed to update the status")
+				}
+				if wait > selfTestPollInterval {
+					wait = selfTestPollInterval
+				}
+				return ctrl.Result{RequeueAfter: wait}, nil
+			}
+			outcome = api.SPISelfTestStepOutcomeFailed
+			message = "timed out " + message
+		}
+
+		recordSelfTestStep(&test, step, outcome, message)
+	}
+
+	if err := updateSelfTestStatusIfChanged(ctx, r.Client, &test); err != nil {
+		return ctrl.Result{}, NewReconcileError(err, "failed to update the status")
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// performStep performs the step of the test. The returned outcome is empty if the step is still in progress. In that
+// case the message describes what the step waits for.
+func (r *SPISelfTestReconciler) performStep(ctx context.Context, test *api.SPISelfTest, step api.SPISelfTestStep) (api.SPISelfTestStepOutcome, string, error) {
+	switch step {
+	case api.SPISelfTestStepCreateToken:
+		return r.createToken(ctx, test)
+	case api.SPISelfTestStepUploadCredential:
+		return r.uploadCredential(ctx, test)
+	case api.SPISelfTestStepCreateBinding:
+		return r.createBinding(ctx, test)
+	case api.SPISelfTestStepVerifySecret:
+		return r.verifySecret(ctx, test)
+	case api.SPISelfTestStepCleanup:
+		return r.cleanup(ctx, test)
+	}
+
+	return api.SPISelfTestStepOutcomeFailed, fmt.Sprintf("unknown step '%s'", step), nil
+}
+
+func (r *SPISelfTestReconciler) createToken(ctx context.Context, test *api.SPISelfTest) (api.SPISelfTestStepOutcome, string, error) {
+	token := &api.SPIAccessToken{}
+	if err := r.Get(ctx, selfTestTokenKey(test), token); err != nil {
+		if !errors.IsNotFound(err) {
+			return "", "", fmt.Errorf("failed to get the test token: %w", err)
+		}
+
+		spUrl := r.serviceProviderUrl(test)
+		if spUrl == "" {
+			return api.SPISelfTestStepOutcomeFailed, "the service provider URL is neither specified nor configured using selfTestServiceProviderUrl", nil
+		}
+		if !r.isEchoServiceProvider(spUrl) {
+			// the other service providers would validate the generated credential against their real API
+			return api.SPISelfTestStepOutcomeFailed, fmt.Sprintf("%s is not the baseUrl of any service provider of type %s in the configuration", spUrl, config.ServiceProviderTypeEcho), nil
+		}
+
+		token = &api.SPIAccessToken{
+			ObjectMeta: metav1.ObjectMeta{Name: selfTestTokenKey(test).Name, Namespace: test.Namespace},
+			Spec:       api.SPIAccessTokenSpec{ServiceProviderUrl: spUrl},
+		}
+		if err := controllerutil.SetControllerReference(test, token, r.Scheme); err != nil {
+			return "", "", fmt.Errorf("failed to set the owner of the test token: %w", err)
+		}
+		if err := r.Create(ctx, token); err != nil {
+			return "", "", fmt.Errorf("failed to create the test token: %w", err)
+		}
+	}
+
+	switch token.Status.Phase {
+	case api.SPIAccessTokenPhaseAwaitingTokenData, api.SPIAccessTokenPhaseReady:
+		return api.SPISelfTestStepOutcomePassed, "", nil
+	case api.SPIAccessTokenPhaseError:
+		return api.SPISelfTestStepOutcomeFailed, token.Status.ErrorMessage, nil
+	}
+
+	return "", "waiting for the token to await the token data", nil
+}
+
+func (r *SPISelfTestReconciler) uploadCredential(ctx context.Context, test *api.SPISelfTest) (api.SPISelfTestStepOutcome, string, error) {
+	token := &api.SPIAccessToken{}
+	if err := r.Get(ctx, selfTestTokenKey(test), token); err != nil {
+		if errors.IsNotFound(err) {
+			return api.SPISelfTestStepOutcomeFailed, "the test token disappeared", nil
+		}
+		return "", "", fmt.Errorf("failed to get the test token: %w", err)
+	}
+
+	switch token.Status.Phase {
+	case api.SPIAccessTokenPhaseReady:
+		return api.SPISelfTestStepOutcomePassed, "", nil
+	case api.SPIAccessTokenPhaseError, api.SPIAccessTokenPhaseInvalid:
+		return api.SPISelfTestStepOutcomeFailed, token.Status.ErrorMessage, nil
+	}
+
+	data, err := r.TokenStorage.Get(ctx, token)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read the test credential from the token storage: %w", err)
+	}
+
+	if data == nil {
+		secret := make([]byte, 16)
+		if _, err := io.ReadFull(rand.Reader, secret); err != nil {
+			return "", "", fmt.Errorf("failed to generate the test credential: %w", err)
+		}
+
+		if err := r.TokenStorage.Store(ctx, token, &api.Token{Username: selfTestUsername, AccessToken: hex.EncodeToString(secret)}); err != nil {
+			return api.SPISelfTestStepOutcomeFailed, fmt.Sprintf("failed to store the test credential: %s", err), nil
+		}
+
+		// let the token controller know about the new data the same way the OAuth service does
+		if err := r.Create(ctx, &api.SPIAccessTokenDataUpdate{
+			ObjectMeta: metav1.ObjectMeta{GenerateName: "token-update-", Namespace: token.Namespace},
+			Spec:       api.SPIAccessTokenDataUpdateSpec{TokenName: token.Name},
+		}); err != nil {
+			return "", "", fmt.Errorf("failed to notify about the test credential: %w", err)
+		}
+	}
+
+	return "", "waiting for the token to become ready", nil
+}
+
+func (r *SPISelfTestReconciler) createBinding(ctx context.Context, test *api.SPISelfTest) (api.SPISelfTestStepOutcome, string, error) {
+	binding := &api.SPIAccessTokenBinding{}
+	if err := r.Get(ctx, selfTestBindingKey(test), binding); err != nil {
+		if !errors.IsNotFound(err) {
+			return "", "", fmt.Errorf("failed to get the test binding: %w", err)
+		}
+
+		repoUrl := test.Spec.RepoUrl
+		if repoUrl == "" {
+			repoUrl = r.serviceProviderUrl(test)
+		}
+
+		binding = &api.SPIAccessTokenBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: selfTestBindingKey(test).Name, Namespace: test.Namespace},
+			Spec: api.SPIAccessTokenBindingSpec{
+				RepoUrl:  repoUrl,
+				TokenRef: &api.TokenReference{Name: selfTestTokenKey(test).Name},
+				Secret: api.SecretSpec{
+					Name: test.Name + "-secret",
+					Type: corev1.SecretTypeBasicAuth,
+				},
+			},
+		}
+		if err := controllerutil.SetControllerReference(test, binding, r.Scheme); err != nil {
+			return "", "", fmt.Errorf("failed to set the owner of the test binding: %w", err)
+		}
+		if err := r.Create(ctx, binding); err != nil {
+			return "", "", fmt.Errorf("failed to create the test binding: %w", err)
+		}
+	}
+
+	switch binding.Status.Phase {
+	case api.SPIAccessTokenBindingPhaseInjected:
+		return api.SPISelfTestStepOutcomePassed, "", nil
+	case api.SPIAccessTokenBindingPhaseError:
+		return api.SPISelfTestStepOutcomeFailed, binding.Status.ErrorMessage, nil
+	}
+
+	return "", "waiting for the secret of the binding to be injected", nil
+}
+
+func (r *SPISelfTestReconciler) verifySecret(ctx context.Context, test *api.SPISelfTest) (api.SPISelfTestStepOutcome, string, error) {
+	binding := &api.SPIAccessTokenBinding{}
+	if err := r.Get(ctx, selfTestBindingKey(test), binding); err != nil {
+		if errors.IsNotFound(err) {
+			return api.SPISelfTestStepOutcomeFailed, "the test binding disappeared", nil
+		}
+		return "", "", fmt.Errorf("failed to get the test binding: %w", err)
+	}
+
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, client.ObjectKey{Name: binding.Status.SyncedObjectRef.Name, Namespace: test.Namespace}, secret); err != nil {
+		if errors.IsNotFound(err) {
+			return api.SPISelfTestStepOutcomeFailed, "the secret of the test binding doesn't exist", nil
+		}
+		return "", "", fmt.Errorf("failed to get the secret of the test binding: %w", err)
+	}
+
+	token := &api.SPIAccessToken{}
+	if err := r.Get(ctx, selfTestTokenKey(test), token); err != nil {
+		if errors.IsNotFound(err) {
+			return api.SPISelfTestStepOutcomeFailed, "the test token disappeared", nil
+		}
+		return "", "", fmt.Errorf("failed to get the test token: %w", err)
+	}
+
+	data, err := r.TokenStorage.Get(ctx, token)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read the test credential from the token storage: %w", err)
+	}
+	if data == nil {
+		return api.SPISelfTestStepOutcomeFailed, "the test credential is no longer in the token storage", nil
+	}
+
+	if string(secret.Data[corev1.BasicAuthPasswordKey]) != data.AccessToken {
+		return api.SPISelfTestStepOutcomeFailed, "the secret of the test binding doesn't contain the test credential", nil
+	}
+
+	return api.SPISelfTestStepOutcomePassed, "", nil
+}
+
+func (r *SPISelfTestReconciler) cleanup(ctx context.Context, test *api.SPISelfTest) (api.SPISelfTestStepOutcome, string, error) {
+	gone := true
+	for _, obj := range []client.Object{
+		&api.SPIAccessTokenBinding{ObjectMeta: metav1.ObjectMeta{Name: selfTestBindingKey(test).Name, Namespace: test.Namespace}},
+		&api.SPIAccessToken{ObjectMeta: metav1.ObjectMeta{Name: selfTestTokenKey(test).Name, Namespace: test.Namespace}},
+	} {
+		if err := r.Delete(ctx, obj); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return "", "", fmt.Errorf("failed to delete the test object %s: %w", obj.GetName(), err)
+		}
+		gone = false
+	}
+
+	if gone {
+		return api.SPISelfTestStepOutcomePassed, "", nil
+	}
+
+	return "", "waiting for the test binding and token to be deleted", nil
+}
+
+// serviceProviderUrl returns the URL of the echo service provider used by the test.
+func (r *SPISelfTestReconciler) serviceProviderUrl(test *api.SPISelfTest) string {
+	if test.Spec.ServiceProviderUrl != "" {
+		return test.Spec.ServiceProviderUrl
+	}
+	return r.Configuration.Get().SelfTestServiceProviderUrl
+}
+
+// isEchoServiceProvider checks that the URL is the base URL of a configured echo service provider.
+func (r *SPISelfTestReconciler) isEchoServiceProvider(spUrl string) bool {
+	for _, spc := range r.Configuration.Get().ServiceProviders {
+		if spc.ServiceProviderType == config.ServiceProviderTypeEcho && strings.TrimSuffix(spc.ServiceProviderBaseUrl, "/") == strings.TrimSuffix(spUrl, "/") {
+			return true
+		}
+	}
+	return false
+}
+
+func selfTestTokenKey(test *api.SPISelfTest) client.ObjectKey {
+	return client.ObjectKey{Name: test.Name + "-token", Namespace: test.Namespace}
+}
+
+func selfTestBindingKey(test *api.SPISelfTest) client.ObjectKey {
+	return client.ObjectKey{Name: test.Name + "-binding", Namespace: test.Namespace}
+}
+
+// nextSelfTestStep returns the first step of the test without a result, or an empty string if all the steps are
+// finished, and whether any of the finished steps failed.
+func nextSelfTestStep(test *api.SPISelfTest) (api.SPISelfTestStep, bool) {
+	failed := false
+	for _, res := range test.Status.Steps {
+		if res.Outcome == api.SPISelfTestStepOutcomeFailed {
+			failed = true
+		}
+	}
+
+	if len(test.Status.Steps) >= len(selfTestSteps) {
+		return "", failed
+	}
+
+	return selfTestSteps[len(test.Status.Steps)], failed
+}
+
+// selfTestStepDeadline returns the time until which the step is waited for. The cleanup gets the whole timeout
+// counted from the end of the previous step, the other steps share the timeout counted from the start of the test.
+func selfTestStepDeadline(test *api.SPISelfTest, step api.SPISelfTestStep) time.Time {
+	timeout := defaultSelfTestTimeout
+	if test.Spec.Timeout != nil {
+		timeout = test.Spec.Timeout.Duration
+	}
+
+	start := test.Status.StartTime.Time
+	if step == api.SPISelfTestStepCleanup && len(test.Status.Steps) > 0 {
+		start = test.Status.Steps[len(test.Status.Steps)-1].CompletionTime.Time
+	}
+
+	return start.Add(timeout)
+}
+
+func recordSelfTestStep(test *api.SPISelfTest, step api.SPISelfTestStep, outcome api.SPISelfTestStepOutcome, message string) {
+	test.Status.Steps = append(test.Status.Steps, api.SPISelfTestStepResult{
+		Step:           step,
+		Outcome:        outcome,
+		Message:        message,
+		CompletionTime: metav1.Now(),
+	})
+}
+
+// finishSelfTest sets the final phase of the test based on the results of its steps.
+func finishSelfTest(test *api.SPISelfTest) {
+	now := metav1.Now()
+	test.Status.CompletionTime = &now
+	test.Status.Phase = api.SPISelfTestPhaseSucceeded
+	test.Status.ErrorMessage = ""
+
+	for _, res := range test.Status.Steps {
+		if res.Outcome == api.SPISelfTestStepOutcomeFailed {
+			test.Status.Phase = api.SPISelfTestPhaseFailed
+			test.Status.ErrorMessage = fmt.Sprintf("the %s step failed: %s", res.Step, res.Message)
+			return
+		}
+	}
+}
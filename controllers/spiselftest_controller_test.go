@@ -0,0 +1,186 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/statusupdate"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestSPISelfTestReconcile(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, api.AddToScheme(sch))
+	assert.NoError(t, corev1.AddToScheme(sch))
+
+	newReconciler := func(test *api.SPISelfTest, cfg config.Configuration, data map[string]string) *SPISelfTestReconciler {
+		cfg.ServiceProviders = append(cfg.ServiceProviders, config.ServiceProviderConfiguration{
+			ServiceProviderType:    config.ServiceProviderTypeEcho,
+			ServiceProviderBaseUrl: "https://echo.spi-system.svc/",
+		})
+		return &SPISelfTestReconciler{
+			Client:        statusupdate.FakeApplyClient{Client: fake.NewClientBuilder().WithScheme(sch).WithObjects(test).Build()},
+			Scheme:        sch,
+			TokenStorage:  tombstoneTestStorage(data),
+			Configuration: config.NewLiveConfiguration(cfg),
+		}
+	}
+	reconcile := func(t *testing.T, r *SPISelfTestReconciler) (ctrl.Result, *api.SPISelfTest) {
+		res, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKey{Name: "test", Namespace: "ns"}})
+		assert.NoError(t, err)
+
+		test := &api.SPISelfTest{}
+		assert.NoError(t, r.Get(context.TODO(), client.ObjectKey{Name: "test", Namespace: "ns"}, test))
+		return res, test
+	}
+	outcomes := func(test *api.SPISelfTest) map[api.SPISelfTestStep]api.SPISelfTestStepOutcome {
+		ret := map[api.SPISelfTestStep]api.SPISelfTestStepOutcome{}
+		for _, s := range test.Status.Steps {
+			ret[s.Step] = s.Outcome
+		}
+		return ret
+	}
+
+	t.Run("passes", func(t *testing.T) {
+		data := map[string]string{}
+		r := newReconciler(&api.SPISelfTest{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "ns"}}, config.Configuration{SelfTestServiceProviderUrl: "https://echo.spi-system.svc"}, data)
+
+		res, test := reconcile(t, r)
+		assert.Equal(t, api.SPISelfTestPhaseRunning, test.Status.Phase)
+		assert.NotZero(t, res.RequeueAfter)
+		token := &api.SPIAccessToken{}
+		assert.NoError(t, r.Get(context.TODO(), client.ObjectKey{Name: "test-token", Namespace: "ns"}, token))
+		assert.Equal(t, "https://echo.spi-system.svc", token.Spec.ServiceProviderUrl)
+		assert.Equal(t, "test", token.OwnerReferences[0].Name)
+
+		// the token controller waits for the data
+		token.Status.Phase = api.SPIAccessTokenPhaseAwaitingTokenData
+		assert.NoError(t, r.Status().Update(context.TODO(), token))
+
+		_, test = reconcile(t, r)
+		assert.Equal(t, api.SPISelfTestStepOutcomePassed, outcomes(test)[api.SPISelfTestStepCreateToken])
+		assert.NotEmpty(t, data["test-token"])
+		updates := &api.SPIAccessTokenDataUpdateList{}
+		assert.NoError(t, r.List(context.TODO(), updates))
+		assert.Len(t, updates.Items, 1)
+
+		// the token controller reads the uploaded data
+		token.Status.Phase = api.SPIAccessTokenPhaseReady
+		assert.NoError(t, r.Status().Update(context.TODO(), token))
+
+		_, test = reconcile(t, r)
+		assert.Equal(t, api.SPISelfTestStepOutcomePassed, outcomes(test)[api.SPISelfTestStepUploadCredential])
+		binding := &api.SPIAccessTokenBinding{}
+		assert.NoError(t, r.Get(context.TODO(), client.ObjectKey{Name: "test-binding", Namespace: "ns"}, binding))
+		assert.Equal(t, "https://echo.spi-system.svc", binding.Spec.RepoUrl)
+		assert.Equal(t, "test-token", binding.Spec.TokenRef.Name)
+
+		// the binding controller injects the secret
+		assert.NoError(t, r.Create(context.TODO(), &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-secret", Namespace: "ns"},
+			Data:       map[string][]byte{corev1.BasicAuthPasswordKey: []byte(data["test-token"])},
+		}))
+		binding.Status.Phase = api.SPIAccessTokenBindingPhaseInjected
+		binding.Status.SyncedObjectRef = api.TargetObjectRef{Name: "test-secret", Kind: "Secret", ApiVersion: "v1"}
+		assert.NoError(t, r.Status().Update(context.TODO(), binding))
+
+		_, test = reconcile(t, r)
+		assert.Equal(t, api.SPISelfTestStepOutcomePassed, outcomes(test)[api.SPISelfTestStepCreateBinding])
+		assert.Equal(t, api.SPISelfTestStepOutcomePassed, outcomes(test)[api.SPISelfTestStepVerifySecret])
+		assert.True(t, errors.IsNotFound(r.Get(context.TODO(), client.ObjectKey{Name: "test-binding", Namespace: "ns"}, binding)))
+		assert.True(t, errors.IsNotFound(r.Get(context.TODO(), client.ObjectKey{Name: "test-token", Namespace: "ns"}, token)))
+
+		res, test = reconcile(t, r)
+		assert.Zero(t, res.RequeueAfter)
+		assert.Equal(t, api.SPISelfTestPhaseSucceeded, test.Status.Phase)
+		assert.Len(t, test.Status.Steps, 5)
+		assert.NotNil(t, test.Status.CompletionTime)
+	})
+
+	t.Run("fails without service provider", func(t *testing.T) {
+		r := newReconciler(&api.SPISelfTest{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "ns"}}, config.Configuration{}, map[string]string{})
+
+		_, test := reconcile(t, r)
+		assert.Equal(t, api.SPISelfTestPhaseFailed, test.Status.Phase)
+		assert.Contains(t, test.Status.ErrorMessage, "the CreateToken step failed: the service provider URL is neither specified")
+		assert.Equal(t, map[api.SPISelfTestStep]api.SPISelfTestStepOutcome{
+			api.SPISelfTestStepCreateToken:      api.SPISelfTestStepOutcomeFailed,
+			api.SPISelfTestStepUploadCredential: api.SPISelfTestStepOutcomeSkipped,
+			api.SPISelfTestStepCreateBinding:    api.SPISelfTestStepOutcomeSkipped,
+			api.SPISelfTestStepVerifySecret:     api.SPISelfTestStepOutcomeSkipped,
+			api.SPISelfTestStepCleanup:          api.SPISelfTestStepOutcomePassed,
+		}, outcomes(test))
+	})
+
+	t.Run("fails with other than echo service provider", func(t *testing.T) {
+		r := newReconciler(&api.SPISelfTest{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "ns"},
+			Spec:       api.SPISelfTestSpec{ServiceProviderUrl: "https://github.com"},
+		}, config.Configuration{}, map[string]string{})
+
+		_, test := reconcile(t, r)
+		assert.Equal(t, api.SPISelfTestPhaseFailed, test.Status.Phase)
+		assert.Contains(t, test.Status.ErrorMessage, "the CreateToken step failed: https://github.com is not the baseUrl of any service provider of type Echo")
+		tokens := &api.SPIAccessTokenList{}
+		assert.NoError(t, r.List(context.TODO(), tokens))
+		assert.Empty(t, tokens.Items)
+	})
+
+	t.Run("times out", func(t *testing.T) {
+		started := metav1.NewTime(time.Now().Add(-time.Hour))
+		r := newReconciler(&api.SPISelfTest{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "ns"},
+			Spec:       api.SPISelfTestSpec{ServiceProviderUrl: "https://echo.spi-system.svc", Timeout: &metav1.Duration{Duration: time.Minute}},
+			Status:     api.SPISelfTestStatus{Phase: api.SPISelfTestPhaseRunning, StartTime: &started},
+		}, config.Configuration{}, map[string]string{})
+
+		// the token is created but the token controller never gets to it, so the step times out straight away
+		res, test := reconcile(t, r)
+		assert.Equal(t, api.SPISelfTestStepOutcomeFailed, outcomes(test)[api.SPISelfTestStepCreateToken])
+		assert.Equal(t, "timed out waiting for the token to await the token data", test.Status.Steps[0].Message)
+		// the cleanup has its own timeout
+		assert.Equal(t, api.SPISelfTestPhaseRunning, test.Status.Phase)
+		assert.NotZero(t, res.RequeueAfter)
+
+		_, test = reconcile(t, r)
+		assert.Equal(t, api.SPISelfTestPhaseFailed, test.Status.Phase)
+		assert.Equal(t, api.SPISelfTestStepOutcomePassed, outcomes(test)[api.SPISelfTestStepCleanup])
+	})
+
+	t.Run("runs only once", func(t *testing.T) {
+		r := newReconciler(&api.SPISelfTest{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "ns"},
+			Status:     api.SPISelfTestStatus{Phase: api.SPISelfTestPhaseSucceeded},
+		}, config.Configuration{SelfTestServiceProviderUrl: "https://echo.spi-system.svc"}, map[string]string{})
+
+		_, test := reconcile(t, r)
+		assert.Empty(t, test.Status.Steps)
+		tokens := &api.SPIAccessTokenList{}
+		assert.NoError(t, r.List(context.TODO(), tokens))
+		assert.Empty(t, tokens.Items)
+	})
+}
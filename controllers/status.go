@@ -0,0 +1,201 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	sperrors "github.com/redhat-appstudio/service-provider-integration-operator/pkg/errors"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/statusupdate"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// postponedStatusUpdateTimeout is the timeout of writing a status postponed by the statusUpdateCoalescer.
+const postponedStatusUpdateTimeout = 10 * time.Second
+
+// updateStatusIfChanged applies the status of the provided object to the cluster unless the client (which is usually
+// backed by the informer cache) sees the same version of the object with the same status. Writing the unchanged
+// status on every reconciliation is needless load on the cluster that becomes significant with many objects.
+// The `empty` is an empty object of the same type as `obj` used for reading the object from the client and
+// the `statusOf` returns the status of the provided object.
+func updateStatusIfChanged(ctx context.Context, cl client.Client, obj client.Object, empty client.Object, statusOf func(client.Object) interface{}) error {
+	return coalesceStatusUpdateIfChanged(ctx, cl, nil, 0, obj, empty, statusOf)
+}
+
+// coalesceStatusUpdateIfChanged is like updateStatusIfChanged but writes the changed status using the provided
+// coalescer, which postpones the writes that come sooner than the provided interval after the previous write of
+// the status of the same object. The coalescer can be nil, in which case the status is always written immediately.
+func coalesceStatusUpdateIfChanged(ctx context.Context, cl client.Client, coalescer *statusUpdateCoalescer, interval time.Duration, obj client.Object, empty client.Object, statusOf func(client.Object) interface{}) error {
+	if err := cl.Get(ctx, client.ObjectKeyFromObject(obj), empty); err == nil &&
+		empty.GetResourceVersion() == obj.GetResourceVersion() &&
+		equality.Semantic.DeepEqual(statusOf(empty), statusOf(obj)) {
+		// a postponed write of a different status would overwrite this unchanged one
+		coalescer.discard(obj)
+		return nil
+	}
+
+	if coalescer == nil || interval <= 0 {
+		return statusupdate.Apply(ctx, cl, obj)
+	}
+
+	return coalescer.write(ctx, cl, obj, interval)
+}
+
+// statusUpdateCoalescer reduces the number of the status writes of rapidly changing objects. The first status write of
+// an object is done immediately, while the subsequent writes made within the coalescing interval after it are
+// postponed until the interval passes and only the latest of them is written. The postponed statuses are applied
+// with the resource version they were computed from, so that they cannot revert the changes of the object made in
+// the meantime (e.g. the token metadata persisted by the metadata cache). Such a postponed status is dropped instead,
+// because the change of the object triggers another reconciliation that computes the status again. The zero value is
+// ready to use.
+type statusUpdateCoalescer struct {
+	lock sync.Mutex
+	// writtenRecently contains the objects the status of which was written less than the coalescing interval ago.
+	writtenRecently map[client.ObjectKey]bool
+	// postponed contains the latest postponed statuses of the objects.
+	postponed map[client.ObjectKey]client.Object
+}
+
+// write writes the status of the provided object immediately or postpones the write if the status of the object was
+// written less than the provided interval ago.
+func (c *statusUpdateCoalescer) write(ctx context.Context, cl client.Client, obj client.Object, interval time.Duration) error {
+	key := client.ObjectKeyFromObject(obj)
+
+	c.lock.Lock()
+	if c.writtenRecently == nil {
+		c.writtenRecently = map[client.ObjectKey]bool{}
+		c.postponed = map[client.ObjectKey]client.Object{}
+	}
+	if c.writtenRecently[key] {
+		c.postponed[key] = obj.DeepCopyObject().(client.Object)
+		c.lock.Unlock()
+		return nil
+	}
+	c.writtenRecently[key] = true
+	c.lock.Unlock()
+
+	time.AfterFunc(interval, func() { c.flush(cl, key, interval) })
+
+	return statusupdate.Apply(ctx, cl, obj)
+}
+
+// flush writes the postponed status of the object with the provided key, if any, and keeps postponing the writes
+// of its status for another interval after that.
+func (c *statusUpdateCoalescer) flush(cl client.Client, key client.ObjectKey, interval time.Duration) {
+	c.lock.Lock()
+	obj, ok := c.postponed[key]
+	delete(c.postponed, key)
+	if !ok {
+		delete(c.writtenRecently, key)
+	}
+	c.lock.Unlock()
+
+	if !ok {
+		return
+	}
+
+	time.AfterFunc(interval, func() { c.flush(cl, key, interval) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), postponedStatusUpdateTimeout)
+	defer cancel()
+	if err := statusupdate.Apply(ctx, cl, obj); err != nil {
+		if errors.IsConflict(err) {
+			log.Log.Info("object changed since its postponed status was computed, dropping the status", "object", key)
+		} else if !errors.IsNotFound(err) {
+			log.Log.Error(err, "failed to write the postponed status", "object", key)
+		}
+	}
+}
+
+// discard forgets the postponed status of the provided object, if any. It is safe to call on a nil coalescer.
+func (c *statusUpdateCoalescer) discard(obj client.Object) {
+	if c == nil {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.postponed, client.ObjectKeyFromObject(obj))
+}
+
+func updateTokenStatusIfChanged(ctx context.Context, cl client.Client, coalescer *statusUpdateCoalescer, interval time.Duration, token *api.SPIAccessToken) error {
+	return coalesceStatusUpdateIfChanged(ctx, cl, coalescer, interval, token, &api.SPIAccessToken{}, func(o client.Object) interface{} {
+		return o.(*api.SPIAccessToken).Status
+	})
+}
+
+func updateBindingStatusIfChanged(ctx context.Context, cl client.Client, coalescer *statusUpdateCoalescer, interval time.Duration, binding *api.SPIAccessTokenBinding) error {
+	return coalesceStatusUpdateIfChanged(ctx, cl, coalescer, interval, binding, &api.SPIAccessTokenBinding{}, func(o client.Object) interface{} {
+		return o.(*api.SPIAccessTokenBinding).Status
+	})
+}
+
+func updateAccessCheckStatusIfChanged(ctx context.Context, cl client.Client, accessCheck *api.SPIAccessCheck) error {
+	return updateStatusIfChanged(ctx, cl, accessCheck, &api.SPIAccessCheck{}, func(o client.Object) interface{} {
+		return o.(*api.SPIAccessCheck).Status
+	})
+}
+
+func updateAccessibilityReportStatusIfChanged(ctx context.Context, cl client.Client, report *api.SPIAccessibilityReport) error {
+	return updateStatusIfChanged(ctx, cl, report, &api.SPIAccessibilityReport{}, func(o client.Object) interface{} {
+		return o.(*api.SPIAccessibilityReport).Status
+	})
+}
+
+// serviceProviderErrorDetails returns the details of the service provider error in the chain of the provided error to
+// put into the status of the objects or nil if the error was not caused by a failed call to the service provider.
+func serviceProviderErrorDetails(err error) *api.ServiceProviderErrorDetails {
+	spe, ok := sperrors.AsServiceProviderError(err)
+	if !ok {
+		return nil
+	}
+
+	message, documentationUrl := spe.Details()
+	return &api.ServiceProviderErrorDetails{
+		StatusCode:       spe.StatusCode,
+		Message:          message,
+		DocumentationUrl: documentationUrl,
+	}
+}
+
+func updateRepositoryDiscoveryStatusIfChanged(ctx context.Context, cl client.Client, discovery *api.SPIRepositoryDiscovery) error {
+	return updateStatusIfChanged(ctx, cl, discovery, &api.SPIRepositoryDiscovery{}, func(o client.Object) interface{} {
+		return o.(*api.SPIRepositoryDiscovery).Status
+	})
+}
+
+func updateRepositoryWebhookStatusIfChanged(ctx context.Context, cl client.Client, webhook *api.SPIRepositoryWebhook) error {
+	return updateStatusIfChanged(ctx, cl, webhook, &api.SPIRepositoryWebhook{}, func(o client.Object) interface{} {
+		return o.(*api.SPIRepositoryWebhook).Status
+	})
+}
+
+func updateAdminOverrideStatusIfChanged(ctx context.Context, cl client.Client, override *api.SPIAdminOverride) error {
+	return updateStatusIfChanged(ctx, cl, override, &api.SPIAdminOverride{}, func(o client.Object) interface{} {
+		return o.(*api.SPIAdminOverride).Status
+	})
+}
+
+func updateSelfTestStatusIfChanged(ctx context.Context, cl client.Client, test *api.SPISelfTest) error {
+	return updateStatusIfChanged(ctx, cl, test, &api.SPISelfTest{}, func(o client.Object) interface{} {
+		return o.(*api.SPISelfTest).Status
+	})
+}
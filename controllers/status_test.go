@@ -0,0 +1,168 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	sperrors "github.com/redhat-appstudio/service-provider-integration-operator/pkg/errors"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/statusupdate"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestUpdateStatusIfChanged(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, api.AddToScheme(sch))
+
+	cl := statusupdate.FakeApplyClient{Client: fake.NewClientBuilder().WithScheme(sch).WithObjects(&api.SPIAccessToken{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "token",
+			Namespace: "default",
+		},
+		Status: api.SPIAccessTokenStatus{
+			Phase: api.SPIAccessTokenPhaseAwaitingTokenData,
+		},
+	}).Build()}
+
+	token := &api.SPIAccessToken{}
+	assert.NoError(t, cl.Get(context.TODO(), client.ObjectKey{Name: "token", Namespace: "default"}, token))
+	version := token.ResourceVersion
+
+	t.Run("unchanged status is not written", func(t *testing.T) {
+		assert.NoError(t, updateTokenStatusIfChanged(context.TODO(), cl, nil, 0, token))
+		assert.Equal(t, version, token.ResourceVersion)
+	})
+
+	t.Run("changed status is written", func(t *testing.T) {
+		token.Status.Phase = api.SPIAccessTokenPhaseReady
+		assert.NoError(t, updateTokenStatusIfChanged(context.TODO(), cl, nil, 0, token))
+		assert.NotEqual(t, version, token.ResourceVersion)
+
+		stored := &api.SPIAccessToken{}
+		assert.NoError(t, cl.Get(context.TODO(), client.ObjectKeyFromObject(token), stored))
+		assert.Equal(t, api.SPIAccessTokenPhaseReady, stored.Status.Phase)
+	})
+}
+
+func TestStatusUpdateCoalescer(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, api.AddToScheme(sch))
+
+	cl := statusupdate.FakeApplyClient{Client: fake.NewClientBuilder().WithScheme(sch).WithObjects(&api.SPIAccessToken{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "token",
+			Namespace: "default",
+		},
+		Status: api.SPIAccessTokenStatus{
+			Phase: api.SPIAccessTokenPhaseAwaitingTokenData,
+		},
+	}).Build()}
+
+	storedPhase := func() api.SPIAccessTokenPhase {
+		stored := &api.SPIAccessToken{}
+		assert.NoError(t, cl.Get(context.TODO(), client.ObjectKey{Name: "token", Namespace: "default"}, stored))
+		return stored.Status.Phase
+	}
+
+	token := &api.SPIAccessToken{}
+	assert.NoError(t, cl.Get(context.TODO(), client.ObjectKey{Name: "token", Namespace: "default"}, token))
+
+	coalescer := &statusUpdateCoalescer{}
+	interval := 200 * time.Millisecond
+
+	token.Status.Phase = api.SPIAccessTokenPhaseReady
+	assert.NoError(t, updateTokenStatusIfChanged(context.TODO(), cl, coalescer, interval, token))
+	assert.Equal(t, api.SPIAccessTokenPhaseReady, storedPhase(), "the first update should be written immediately")
+
+	token.Status.Phase = api.SPIAccessTokenPhaseError
+	assert.NoError(t, updateTokenStatusIfChanged(context.TODO(), cl, coalescer, interval, token))
+	token.Status.Phase = api.SPIAccessTokenPhaseInvalid
+	assert.NoError(t, updateTokenStatusIfChanged(context.TODO(), cl, coalescer, interval, token))
+	assert.Equal(t, api.SPIAccessTokenPhaseReady, storedPhase(), "the subsequent updates should be postponed")
+
+	assert.Eventually(t, func() bool {
+		return storedPhase() == api.SPIAccessTokenPhaseInvalid
+	}, 5*interval, interval/10, "the latest postponed update should be written after the interval")
+
+	assert.Eventually(t, func() bool {
+		coalescer.lock.Lock()
+		defer coalescer.lock.Unlock()
+		return len(coalescer.writtenRecently) == 0 && len(coalescer.postponed) == 0
+	}, 5*interval, interval/10, "the coalescer should forget the object once no updates come")
+}
+
+func TestStatusUpdateCoalescer_DoesNotRevertConcurrentChanges(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, api.AddToScheme(sch))
+
+	cl := statusupdate.FakeApplyClient{Client: fake.NewClientBuilder().WithScheme(sch).WithObjects(&api.SPIAccessToken{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "token",
+			Namespace: "default",
+		},
+	}).Build()}
+	key := client.ObjectKey{Name: "token", Namespace: "default"}
+
+	token := &api.SPIAccessToken{}
+	assert.NoError(t, cl.Get(context.TODO(), key, token))
+
+	coalescer := &statusUpdateCoalescer{}
+	interval := 200 * time.Millisecond
+
+	token.Status.Phase = api.SPIAccessTokenPhaseAwaitingTokenData
+	assert.NoError(t, updateTokenStatusIfChanged(context.TODO(), cl, coalescer, interval, token))
+	token.Status.Phase = api.SPIAccessTokenPhaseError
+	assert.NoError(t, updateTokenStatusIfChanged(context.TODO(), cl, coalescer, interval, token))
+
+	// someone else writes the status before the postponed status is written
+	other := &api.SPIAccessToken{}
+	assert.NoError(t, cl.Get(context.TODO(), key, other))
+	other.Status.TokenMetadata = &api.TokenMetadata{Username: "alois"}
+	assert.NoError(t, statusupdate.Apply(context.TODO(), cl, other))
+
+	assert.Eventually(t, func() bool {
+		coalescer.lock.Lock()
+		defer coalescer.lock.Unlock()
+		return len(coalescer.postponed) == 0
+	}, 5*interval, interval/10)
+
+	stored := &api.SPIAccessToken{}
+	assert.NoError(t, cl.Get(context.TODO(), key, stored))
+	assert.Equal(t, api.SPIAccessTokenPhaseAwaitingTokenData, stored.Status.Phase)
+	assert.Equal(t, "alois", stored.Status.TokenMetadata.Username)
+}
+
+func TestServiceProviderErrorDetails(t *testing.T) {
+	assert.Nil(t, serviceProviderErrorDetails(fmt.Errorf("not a service provider error")))
+
+	err := NewReconcileError(&sperrors.ServiceProviderError{
+		StatusCode: 404,
+		Response:   `{"message": "Not Found", "documentation_url": "https://docs.github.com/rest"}`,
+	}, "failed to look up the token")
+
+	assert.Equal(t, &api.ServiceProviderErrorDetails{
+		StatusCode:       404,
+		Message:          "Not Found",
+		DocumentationUrl: "https://docs.github.com/rest",
+	}, serviceProviderErrorDetails(err))
+}
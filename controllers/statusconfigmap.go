@@ -0,0 +1,52 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;create;update
+
+// writeStatusConfigMap creates or updates the config map referenced as "namespace/name" with the provided data. It is
+// used to report the state of the operator that doesn't belong to any of the custom resources.
+func writeStatusConfigMap(ctx context.Context, cl client.Client, ref string, data map[string]string) error {
+	parts := strings.Split(ref, "/")
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid config map reference '%s'", ref)
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: parts[0],
+			Name:      parts[1],
+		},
+	}
+	if _, err := controllerutil.CreateOrUpdate(ctx, cl, cm, func() error {
+		cm.Data = data
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to write the config map %s: %w", ref, err)
+	}
+
+	return nil
+}
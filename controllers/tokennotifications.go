@@ -0,0 +1,161 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	TokenNotificationReasonInvalid  = "Invalid"
+	TokenNotificationReasonExpiring = "Expiring"
+)
+
+// TokenNotification is posted to the notification webhooks when a token becomes invalid or its data is about to
+// expire. The Text makes it usable with the Slack incoming webhooks (and the compatible services), the other fields
+// are for the other consumers.
+type TokenNotification struct {
+	Text               string `json:"text"`
+	Reason             string `json:"reason"`
+	Contact            string `json:"contact"`
+	Namespace          string `json:"namespace"`
+	Token              string `json:"token"`
+	ServiceProviderUrl string `json:"serviceProviderUrl"`
+	// ExpiresAt is the expiry of the token data in the RFC 3339 format for the Expiring notifications.
+	ExpiresAt string `json:"expiresAt,omitempty"`
+}
+
+// notifyTokenOwners posts the notification about the token to the configured notification webhooks if the namespace
+// of the token declares its contact. Returns true if the notification was delivered to at least one webhook. The
+// failures are only logged, because the notifications are best effort.
+func (r *SPIAccessTokenReconciler) notifyTokenOwners(ctx context.Context, at *api.SPIAccessToken, reason string, detail string, expiresAt string) bool {
+	lg := log.FromContext(ctx)
+
+	urls := r.Configuration.Get().NotificationWebhookUrls
+	if len(urls) == 0 {
+		return false
+	}
+
+	namespace := &corev1.Namespace{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: at.Namespace}, namespace); err != nil {
+		lg.Error(err, "failed to read the namespace of the token to find its notification contact")
+		return false
+	}
+	contact := namespace.Annotations[api.NotificationContactAnnotation]
+	if contact == "" {
+		return false
+	}
+
+	notification := &TokenNotification{
+		Text:               fmt.Sprintf("%s: the token %s/%s for %s %s", contact, at.Namespace, at.Name, at.Spec.ServiceProviderUrl, detail),
+		Reason:             reason,
+		Contact:            contact,
+		Namespace:          at.Namespace,
+		Token:              at.Name,
+		ServiceProviderUrl: at.Spec.ServiceProviderUrl,
+		ExpiresAt:          expiresAt,
+	}
+
+	delivered := false
+	for _, url := range urls {
+		if err := postTokenNotification(ctx, r.ServiceProviderFactory.HttpClient, url, notification); err != nil {
+			// the webhook URLs usually contain secrets, so they are not logged
+			lg.Error(err, "failed to deliver the token notification", "reason", reason)
+		} else {
+			delivered = true
+		}
+	}
+
+	return delivered
+}
+
+// notifyExpiringToken notifies the owners of the Ready token if its data expires within the configured notification
+// period and records the notification in the ExpiryNotifiedAnnotation so that it is only sent once. Returns the time
+// after which the token should be checked again, or 0 if it is not necessary.
+func (r *SPIAccessTokenReconciler) notifyExpiringToken(ctx context.Context, at *api.SPIAccessToken, data *api.Token, now time.Time) (time.Duration, error) {
+	cfg := r.Configuration.Get()
+	if len(cfg.NotificationWebhookUrls) == 0 || cfg.TokenExpiryNotificationPeriod <= 0 || at.Status.Phase != api.SPIAccessTokenPhaseReady ||
+		data == nil || data.Expiry == 0 {
+		return 0, nil
+	}
+
+	expiry := time.Unix(int64(data.Expiry), 0)
+	if notifyAt := expiry.Add(-cfg.TokenExpiryNotificationPeriod); now.Before(notifyAt) {
+		return notifyAt.Sub(now), nil
+	}
+
+	expiryValue := strconv.FormatUint(data.Expiry, 10)
+	if at.Annotations[api.ExpiryNotifiedAnnotation] == expiryValue {
+		return 0, nil
+	}
+
+	expiresAt := expiry.UTC().Format(time.RFC3339)
+	if !r.notifyTokenOwners(ctx, at, TokenNotificationReasonExpiring, "expires at "+expiresAt+", please refresh it", expiresAt) {
+		return 0, nil
+	}
+
+	if at.Annotations == nil {
+		at.Annotations = map[string]string{}
+	}
+	at.Annotations[api.ExpiryNotifiedAnnotation] = expiryValue
+	if err := r.Client.Update(ctx, at); err != nil {
+		return 0, fmt.Errorf("failed to record the expiry notification: %w", err)
+	}
+
+	return 0, nil
+}
+
+// postTokenNotification posts the notification to the webhook at the provided URL.
+func postTokenNotification(ctx context.Context, cl *http.Client, url string, notification *TokenNotification) error {
+	lg := log.FromContext(ctx)
+
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("failed to serialize the token notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create the token notification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := cl.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call the notification webhook: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			lg.Error(err, "failed to close the response body of the notification webhook")
+		}
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("the notification webhook responded with unexpected status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
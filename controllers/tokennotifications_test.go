@@ -0,0 +1,185 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/statusupdate"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestNotifyExpiringToken(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, api.AddToScheme(sch))
+	assert.NoError(t, corev1.AddToScheme(sch))
+
+	var notifications []TokenNotification
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		notification := TokenNotification{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&notification))
+		notifications = append(notifications, notification)
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	expiry := uint64(now.Add(24 * time.Hour).Unix())
+	data := &api.Token{AccessToken: "token", Expiry: expiry}
+
+	setup := func(contact string, webhookUrls ...string) (*SPIAccessTokenReconciler, *api.SPIAccessToken) {
+		notifications = nil
+		namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns"}}
+		if contact != "" {
+			namespace.Annotations = map[string]string{api.NotificationContactAnnotation: contact}
+		}
+		token := &api.SPIAccessToken{
+			ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "ns"},
+			Spec:       api.SPIAccessTokenSpec{ServiceProviderUrl: "https://github.com"},
+			Status:     api.SPIAccessTokenStatus{Phase: api.SPIAccessTokenPhaseReady},
+		}
+		cl := fake.NewClientBuilder().WithScheme(sch).WithObjects(namespace, token).Build()
+		assert.NoError(t, cl.Get(context.TODO(), client.ObjectKeyFromObject(token), token))
+
+		cfg := config.Configuration{NotificationWebhookUrls: webhookUrls, TokenExpiryNotificationPeriod: 7 * 24 * time.Hour}
+		return &SPIAccessTokenReconciler{
+			Client:                 cl,
+			Configuration:          config.NewLiveConfiguration(cfg),
+			ServiceProviderFactory: serviceprovider.Factory{HttpClient: server.Client()},
+		}, token
+	}
+
+	t.Run("notifies once", func(t *testing.T) {
+		r, token := setup("@team-a", server.URL)
+
+		recheck, err := r.notifyExpiringToken(context.TODO(), token, data, now)
+		assert.NoError(t, err)
+		assert.Zero(t, recheck)
+		assert.Len(t, notifications, 1)
+		assert.Equal(t, TokenNotificationReasonExpiring, notifications[0].Reason)
+		assert.Equal(t, "@team-a", notifications[0].Contact)
+		assert.Equal(t, "token", notifications[0].Token)
+		assert.Equal(t, time.Unix(int64(expiry), 0).UTC().Format(time.RFC3339), notifications[0].ExpiresAt)
+		assert.Contains(t, notifications[0].Text, "@team-a")
+
+		stored := &api.SPIAccessToken{}
+		assert.NoError(t, r.Client.Get(context.TODO(), client.ObjectKeyFromObject(token), stored))
+		assert.Equal(t, strconv.FormatUint(expiry, 10), stored.Annotations[api.ExpiryNotifiedAnnotation])
+
+		_, err = r.notifyExpiringToken(context.TODO(), stored, data, now)
+		assert.NoError(t, err)
+		assert.Len(t, notifications, 1)
+
+		// the refreshed data is notified about again
+		_, err = r.notifyExpiringToken(context.TODO(), stored, &api.Token{Expiry: expiry + 60}, now)
+		assert.NoError(t, err)
+		assert.Len(t, notifications, 2)
+	})
+
+	t.Run("rechecks before the notification period", func(t *testing.T) {
+		r, token := setup("@team-a", server.URL)
+
+		recheck, err := r.notifyExpiringToken(context.TODO(), token, &api.Token{Expiry: uint64(now.Add(10 * 24 * time.Hour).Unix())}, now)
+		assert.NoError(t, err)
+		assert.InDelta(t, (3 * 24 * time.Hour).Seconds(), recheck.Seconds(), 1)
+		assert.Empty(t, notifications)
+	})
+
+	t.Run("namespace without contact", func(t *testing.T) {
+		r, token := setup("", server.URL)
+
+		_, err := r.notifyExpiringToken(context.TODO(), token, data, now)
+		assert.NoError(t, err)
+		assert.Empty(t, notifications)
+		assert.Empty(t, token.Annotations[api.ExpiryNotifiedAnnotation])
+	})
+
+	t.Run("no webhooks", func(t *testing.T) {
+		r, token := setup("@team-a")
+
+		recheck, err := r.notifyExpiringToken(context.TODO(), token, data, now)
+		assert.NoError(t, err)
+		assert.Zero(t, recheck)
+		assert.Empty(t, notifications)
+	})
+
+	t.Run("data without expiry", func(t *testing.T) {
+		r, token := setup("@team-a", server.URL)
+
+		recheck, err := r.notifyExpiringToken(context.TODO(), token, &api.Token{AccessToken: "token"}, now)
+		assert.NoError(t, err)
+		assert.Zero(t, recheck)
+		assert.Empty(t, notifications)
+	})
+
+	t.Run("failed delivery is not recorded", func(t *testing.T) {
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer failing.Close()
+		r, token := setup("@team-a", failing.URL)
+
+		_, err := r.notifyExpiringToken(context.TODO(), token, data, now)
+		assert.NoError(t, err)
+		assert.Empty(t, token.Annotations[api.ExpiryNotifiedAnnotation])
+	})
+}
+
+func TestNotifyTokenOwners_Invalid(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, api.AddToScheme(sch))
+	assert.NoError(t, corev1.AddToScheme(sch))
+
+	var notifications []TokenNotification
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		notification := TokenNotification{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&notification))
+		notifications = append(notifications, notification)
+	}))
+	defer server.Close()
+
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns", Annotations: map[string]string{api.NotificationContactAnnotation: "@team-a"}}}
+	token := &api.SPIAccessToken{
+		ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "ns"},
+		Status:     api.SPIAccessTokenStatus{Phase: api.SPIAccessTokenPhaseReady},
+	}
+	r := &SPIAccessTokenReconciler{
+		Client:                 statusupdate.FakeApplyClient{Client: fake.NewClientBuilder().WithScheme(sch).WithObjects(namespace, token).Build()},
+		Configuration:          config.NewLiveConfiguration(config.Configuration{NotificationWebhookUrls: []string{server.URL}}),
+		ServiceProviderFactory: serviceprovider.Factory{HttpClient: server.Client()},
+	}
+
+	assert.NoError(t, r.flipToExceptionalPhase(context.TODO(), token, api.SPIAccessTokenPhaseInvalid, api.SPIAccessTokenErrorReasonMetadataFailure, assert.AnError))
+	assert.Len(t, notifications, 1)
+	assert.Equal(t, TokenNotificationReasonInvalid, notifications[0].Reason)
+	assert.Contains(t, notifications[0].Text, assert.AnError.Error())
+
+	// only the transition is notified about
+	assert.NoError(t, r.flipToExceptionalPhase(context.TODO(), token, api.SPIAccessTokenPhaseInvalid, api.SPIAccessTokenErrorReasonMetadataFailure, assert.AnError))
+	assert.Len(t, notifications, 1)
+}
@@ -0,0 +1,83 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/statusupdate"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// restoredTokenMessage is the message of the phase transition of the tokens restored from a backup without their data.
+const restoredTokenMessage = "the token was restored from a backup, but its data was not restored to the token storage. Authenticate again."
+
+// isRestored returns true if the token was restored from a backup, i.e. it has a different UID than the one recorded in
+// the api.ObservedUIDAnnotation. The tokens without the annotation were not reconciled by this version of the operator
+// yet and are not considered restored.
+func isRestored(at *api.SPIAccessToken) bool {
+	observed, ok := at.Annotations[api.ObservedUIDAnnotation]
+	return ok && observed != string(at.UID)
+}
+
+// reconcileRestore records the UID of the token in the api.ObservedUIDAnnotation. If the token was restored from
+// a backup, its linkage to the token storage is checked first. The restored tokens without the data would otherwise
+// stay Ready because of the metadata restored with their status, so their metadata and the OAuth URL are dropped and
+// they are flipped to the AwaitingTokenData phase with the new OAuth URL filled in later in the reconciliation.
+// The data of the restored tokens that have it is stored again so that it is owned by the token with the new UID (the
+// secrets token storage would otherwise garbage collect it). The returned data is the data of the token after
+// the restore pass. The status is written before the annotation so that the pass is repeated if it fails midway.
+func (r *SPIAccessTokenReconciler) reconcileRestore(ctx context.Context, at *api.SPIAccessToken, data *api.Token) (*api.Token, error) {
+	if at.Annotations[api.ObservedUIDAnnotation] == string(at.UID) {
+		return data, nil
+	}
+
+	if isRestored(at) {
+		lg := log.FromContext(ctx)
+		if data == nil {
+			lg.Info("the token was restored from a backup without its data, it needs to be authenticated again")
+			at.Status.TokenMetadata = nil
+			at.Status.OAuthUrl = ""
+			r.transitionToPhase(at, api.SPIAccessTokenPhaseAwaitingTokenData, api.SPIAccessTokenTransitionReasonRestoredWithoutData, restoredTokenMessage)
+			at.Status.ErrorReason = ""
+			at.Status.ErrorMessage = ""
+			at.Status.ServiceProviderError = nil
+			if err := statusupdate.Apply(ctx, r.Client, at); err != nil {
+				return nil, fmt.Errorf("failed to update the status of the restored token: %w", err)
+			}
+		} else {
+			lg.Info("the token was restored from a backup, re-linking its data in the token storage")
+			if err := r.TokenStorage.Store(ctx, at, data); err != nil {
+				return nil, fmt.Errorf("failed to re-link the data of the restored token: %w", err)
+			}
+			var err error
+			if data, err = r.TokenStorage.Get(ctx, at); err != nil {
+				return nil, fmt.Errorf("failed to read the re-linked data of the restored token: %w", err)
+			}
+		}
+	}
+
+	if at.Annotations == nil {
+		at.Annotations = map[string]string{}
+	}
+	at.Annotations[api.ObservedUIDAnnotation] = string(at.UID)
+	if err := r.Client.Update(ctx, at); err != nil {
+		return nil, fmt.Errorf("failed to record the UID of the token: %w", err)
+	}
+
+	return data, nil
+}
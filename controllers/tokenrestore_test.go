@@ -0,0 +1,126 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/tokenstorage"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/statusupdate"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReconcileRestore(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, api.AddToScheme(sch))
+
+	token := func(observedUid string) *api.SPIAccessToken {
+		at := &api.SPIAccessToken{
+			ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "ns", UID: "new-uid"},
+			Status: api.SPIAccessTokenStatus{
+				Phase:         api.SPIAccessTokenPhaseReady,
+				TokenMetadata: &api.TokenMetadata{Username: "alois"},
+			},
+		}
+		if observedUid != "" {
+			at.Annotations = map[string]string{api.ObservedUIDAnnotation: observedUid}
+		}
+		return at
+	}
+
+	reconciler := func(at *api.SPIAccessToken, stored *[]types.UID) *SPIAccessTokenReconciler {
+		return &SPIAccessTokenReconciler{
+			Client:        statusupdate.FakeApplyClient{Client: fake.NewClientBuilder().WithScheme(sch).WithObjects(at).Build()},
+			Configuration: config.NewLiveConfiguration(config.Configuration{TokenPhaseHistorySize: 5}),
+			TokenStorage: tokenstorage.TestTokenStorage{
+				StoreImpl: func(_ context.Context, owner *api.SPIAccessToken, _ *api.Token) error {
+					*stored = append(*stored, owner.UID)
+					return nil
+				},
+				GetImpl: func(context.Context, *api.SPIAccessToken) (*api.Token, error) {
+					return &api.Token{AccessToken: "token", Version: 2}, nil
+				},
+			},
+		}
+	}
+
+	persisted := func(t *testing.T, r *SPIAccessTokenReconciler) *api.SPIAccessToken {
+		at := &api.SPIAccessToken{}
+		assert.NoError(t, r.Client.Get(context.TODO(), client.ObjectKey{Name: "token", Namespace: "ns"}, at))
+		return at
+	}
+
+	t.Run("records the UID", func(t *testing.T) {
+		at := token("")
+		var stored []types.UID
+		r := reconciler(at, &stored)
+
+		data, err := r.reconcileRestore(context.TODO(), at, &api.Token{AccessToken: "token", Version: 1})
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(1), data.Version)
+		assert.Empty(t, stored)
+		assert.Equal(t, "new-uid", persisted(t, r).Annotations[api.ObservedUIDAnnotation])
+		assert.Equal(t, api.SPIAccessTokenPhaseReady, at.Status.Phase)
+	})
+
+	t.Run("restored with data", func(t *testing.T) {
+		at := token("old-uid")
+		var stored []types.UID
+		r := reconciler(at, &stored)
+
+		data, err := r.reconcileRestore(context.TODO(), at, &api.Token{AccessToken: "token", Version: 1})
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(2), data.Version)
+		assert.Equal(t, []types.UID{"new-uid"}, stored)
+		assert.Equal(t, "new-uid", persisted(t, r).Annotations[api.ObservedUIDAnnotation])
+		assert.NotNil(t, at.Status.TokenMetadata)
+	})
+
+	t.Run("restored without data", func(t *testing.T) {
+		at := token("old-uid")
+		var stored []types.UID
+		r := reconciler(at, &stored)
+
+		data, err := r.reconcileRestore(context.TODO(), at, nil)
+		assert.NoError(t, err)
+		assert.Nil(t, data)
+		assert.Empty(t, stored)
+
+		at = persisted(t, r)
+		assert.Equal(t, "new-uid", at.Annotations[api.ObservedUIDAnnotation])
+		assert.Nil(t, at.Status.TokenMetadata)
+		assert.Equal(t, api.SPIAccessTokenPhaseAwaitingTokenData, at.Status.Phase)
+		assert.Equal(t, api.SPIAccessTokenTransitionReasonRestoredWithoutData, at.Status.History[0].Reason)
+	})
+
+	t.Run("not restored", func(t *testing.T) {
+		at := token("new-uid")
+		var stored []types.UID
+		r := reconciler(at, &stored)
+
+		_, err := r.reconcileRestore(context.TODO(), at, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, api.SPIAccessTokenPhaseReady, at.Status.Phase)
+		assert.NotNil(t, at.Status.TokenMetadata)
+	})
+}
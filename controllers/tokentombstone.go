@@ -0,0 +1,212 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/tokenstorage"
+)
+
+// tombstoneNamePrefix is the prefix of the names under which the data of the deleted tokens is kept in the token
+// storage during the retention period. The rest of the name is the UID of the deleted token. The same name is used for
+// the config map recording the tombstone. The tokens with such names are refused by the operator so that they cannot
+// read the data of the deleted tokens.
+const tombstoneNamePrefix = "spi-tombstone-"
+
+// tombstoneLabel marks the config maps recording the tombstones.
+const tombstoneLabel = "spi.appstudio.redhat.com/token-tombstone"
+
+const (
+	tombstoneTokenNameKey = "tokenName"
+	tombstoneOwnerKey     = "owner"
+	tombstoneDeletedAtKey = "deletedAt"
+)
+
+// errNoTombstone is returned when there is no recoverable data of a deleted token with the name of the token being
+// recovered.
+var errNoTombstone = stderrors.New("no recoverable data of a deleted token with the same name found")
+
+// errTombstoneOwnerMismatch is returned when the token being recovered doesn't have the same owner as the deleted
+// token had.
+var errTombstoneOwnerMismatch = stderrors.New("the recovered token must have the same owner as the deleted token")
+
+// isTombstoneName returns true if the provided token name is reserved for the tombstones.
+func isTombstoneName(name string) bool {
+	return strings.HasPrefix(name, tombstoneNamePrefix)
+}
+
+// tombstoneOwner returns the owner under which the data of the tombstone recorded in the provided config map is kept in
+// the token storage. It doesn't have a UID, because it doesn't exist in the cluster.
+func tombstoneOwner(record *corev1.ConfigMap) *api.SPIAccessToken {
+	return &api.SPIAccessToken{ObjectMeta: metav1.ObjectMeta{Name: record.Name, Namespace: record.Namespace}}
+}
+
+// tombstoneTokenData moves the data of the deleted token under its tombstone in the token storage and records
+// the tombstone in a config map in the namespace of the token. The record is created first so that the data is never
+// kept without it and therefore always purged.
+func tombstoneTokenData(ctx context.Context, cl client.Client, storage tokenstorage.TokenStorage, token *api.SPIAccessToken) error {
+	data, err := storage.Get(ctx, token)
+	if err != nil {
+		return fmt.Errorf("failed to read the token data: %w", err)
+	}
+	if data == nil {
+		return nil
+	}
+
+	record := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      tombstoneNamePrefix + string(token.UID),
+			Namespace: token.Namespace,
+			Labels:    map[string]string{tombstoneLabel: "true"},
+		},
+		Data: map[string]string{
+			tombstoneTokenNameKey: token.Name,
+			tombstoneOwnerKey:     token.Annotations[api.TokenOwnerAnnotation],
+			tombstoneDeletedAtKey: time.Now().UTC().Format(time.RFC3339),
+		},
+	}
+	if err := cl.Create(ctx, record); err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to record the tombstone: %w", err)
+	}
+
+	if err := storage.Store(ctx, tombstoneOwner(record), data); err != nil {
+		return fmt.Errorf("failed to store the tombstoned data: %w", err)
+	}
+
+	log.FromContext(ctx).Info("token data tombstoned", "tombstone", record.Name)
+
+	return storage.Delete(ctx, token)
+}
+
+// recoverTokenData moves the data of the most recently deleted token with the same name as the provided token from its
+// tombstone back to the provided token. The tombstone must have been created for the same owner as the owner of
+// the token, otherwise errTombstoneOwnerMismatch is returned. Returns errNoTombstone if there is no such tombstone or its
+// data has been purged already.
+func recoverTokenData(ctx context.Context, cl client.Client, storage tokenstorage.TokenStorage, token *api.SPIAccessToken) error {
+	records := &corev1.ConfigMapList{}
+	if err := cl.List(ctx, records, client.InNamespace(token.Namespace), client.MatchingLabels{tombstoneLabel: "true"}); err != nil {
+		return fmt.Errorf("failed to list the tombstones: %w", err)
+	}
+
+	var record *corev1.ConfigMap
+	for i := range records.Items {
+		r := &records.Items[i]
+		if r.Data[tombstoneTokenNameKey] != token.Name {
+			continue
+		}
+		// the RFC 3339 timestamps in UTC sort lexicographically
+		if record == nil || r.Data[tombstoneDeletedAtKey] > record.Data[tombstoneDeletedAtKey] {
+			record = r
+		}
+	}
+	if record == nil {
+		return errNoTombstone
+	}
+
+	if owner := record.Data[tombstoneOwnerKey]; owner != token.Annotations[api.TokenOwnerAnnotation] {
+		return fmt.Errorf("%w: the deleted token was owned by '%s'", errTombstoneOwnerMismatch, owner)
+	}
+
+	data, err := storage.Get(ctx, tombstoneOwner(record))
+	if err != nil {
+		return fmt.Errorf("failed to read the tombstoned data: %w", err)
+	}
+	if data == nil {
+		return errNoTombstone
+	}
+
+	if err := storage.Store(ctx, token, data); err != nil {
+		return fmt.Errorf("failed to store the recovered data: %w", err)
+	}
+
+	return deleteTombstone(ctx, cl, storage, record)
+}
+
+// deleteTombstone deletes the tombstoned data and its record.
+func deleteTombstone(ctx context.Context, cl client.Client, storage tokenstorage.TokenStorage, record *corev1.ConfigMap) error {
+	if err := storage.Delete(ctx, tombstoneOwner(record)); err != nil {
+		return fmt.Errorf("failed to delete the tombstoned data: %w", err)
+	}
+	if err := cl.Delete(ctx, record); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete the tombstone record: %w", err)
+	}
+	return nil
+}
+
+// TombstonePurger periodically deletes the data of the deleted tokens once it has been kept for longer than
+// the tokenDataRetention from the configuration.
+type TombstonePurger struct {
+	Client        client.Client
+	TokenStorage  tokenstorage.TokenStorage
+	Configuration *config.LiveConfiguration
+	// Interval is the interval in which the expired tombstones are looked for.
+	Interval time.Duration
+}
+
+// Start purges the expired tombstones until the provided context is done.
+func (p *TombstonePurger) Start(ctx context.Context) error {
+	lg := log.FromContext(ctx)
+
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := p.purge(ctx, time.Now()); err != nil {
+				lg.Error(err, "failed to purge the expired token data tombstones")
+			}
+		}
+	}
+}
+
+func (p *TombstonePurger) purge(ctx context.Context, now time.Time) error {
+	records := &corev1.ConfigMapList{}
+	if err := p.Client.List(ctx, records, client.MatchingLabels{tombstoneLabel: "true"}); err != nil {
+		return fmt.Errorf("failed to list the tombstones: %w", err)
+	}
+
+	retention := p.Configuration.Get().TokenDataRetention
+	errs := make([]error, 0)
+	for i := range records.Items {
+		record := &records.Items[i]
+		deletedAt, err := time.Parse(time.RFC3339, record.Data[tombstoneDeletedAtKey])
+		if err == nil && now.Before(deletedAt.Add(retention)) {
+			continue
+		}
+		// the records with an invalid deletion time are purged right away
+		if err := deleteTombstone(ctx, p.Client, p.TokenStorage, record); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
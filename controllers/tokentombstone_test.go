@@ -0,0 +1,161 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/tokenstorage"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// tombstoneTestStorage is a token storage keeping the access tokens in a map by the names of their owners.
+func tombstoneTestStorage(data map[string]string) tokenstorage.TestTokenStorage {
+	return tokenstorage.TestTokenStorage{
+		StoreImpl: func(_ context.Context, owner *api.SPIAccessToken, token *api.Token) error {
+			data[owner.Name] = token.AccessToken
+			return nil
+		},
+		GetImpl: func(_ context.Context, owner *api.SPIAccessToken) (*api.Token, error) {
+			if at, ok := data[owner.Name]; ok {
+				return &api.Token{AccessToken: at}, nil
+			}
+			return nil, nil
+		},
+		DeleteImpl: func(_ context.Context, owner *api.SPIAccessToken) error {
+			delete(data, owner.Name)
+			return nil
+		},
+	}
+}
+
+func TestTokenTombstone(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, corev1.AddToScheme(sch))
+	assert.NoError(t, api.AddToScheme(sch))
+
+	deleted := &api.SPIAccessToken{
+		ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "ns", UID: "uid", Annotations: map[string]string{api.TokenOwnerAnnotation: "alois"}},
+	}
+	recreated := &api.SPIAccessToken{
+		ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "ns", UID: "uid2", Annotations: map[string]string{api.TokenOwnerAnnotation: "alois"}},
+	}
+
+	t.Run("tombstones and recovers", func(t *testing.T) {
+		cl := fake.NewClientBuilder().WithScheme(sch).Build()
+		data := map[string]string{"token": "secret"}
+		strg := tombstoneTestStorage(data)
+
+		assert.NoError(t, tombstoneTokenData(context.TODO(), cl, strg, deleted))
+		assert.Equal(t, map[string]string{"spi-tombstone-uid": "secret"}, data)
+
+		record := &corev1.ConfigMap{}
+		assert.NoError(t, cl.Get(context.TODO(), client.ObjectKey{Name: "spi-tombstone-uid", Namespace: "ns"}, record))
+		assert.Equal(t, "true", record.Labels[tombstoneLabel])
+		assert.Equal(t, "token", record.Data[tombstoneTokenNameKey])
+		assert.Equal(t, "alois", record.Data[tombstoneOwnerKey])
+
+		assert.NoError(t, recoverTokenData(context.TODO(), cl, strg, recreated))
+		assert.Equal(t, map[string]string{"token": "secret"}, data)
+		records := &corev1.ConfigMapList{}
+		assert.NoError(t, cl.List(context.TODO(), records))
+		assert.Empty(t, records.Items)
+	})
+
+	t.Run("no data no tombstone", func(t *testing.T) {
+		cl := fake.NewClientBuilder().WithScheme(sch).Build()
+		data := map[string]string{}
+
+		assert.NoError(t, tombstoneTokenData(context.TODO(), cl, tombstoneTestStorage(data), deleted))
+		records := &corev1.ConfigMapList{}
+		assert.NoError(t, cl.List(context.TODO(), records))
+		assert.Empty(t, records.Items)
+
+		assert.ErrorIs(t, recoverTokenData(context.TODO(), cl, tombstoneTestStorage(data), recreated), errNoTombstone)
+	})
+
+	t.Run("recovers only for same owner", func(t *testing.T) {
+		cl := fake.NewClientBuilder().WithScheme(sch).Build()
+		data := map[string]string{"token": "secret"}
+		strg := tombstoneTestStorage(data)
+		assert.NoError(t, tombstoneTokenData(context.TODO(), cl, strg, deleted))
+
+		other := recreated.DeepCopy()
+		other.Annotations = nil
+		assert.ErrorIs(t, recoverTokenData(context.TODO(), cl, strg, other), errTombstoneOwnerMismatch)
+		assert.Equal(t, map[string]string{"spi-tombstone-uid": "secret"}, data)
+	})
+
+	t.Run("recovers most recent", func(t *testing.T) {
+		cl := fake.NewClientBuilder().WithScheme(sch).WithObjects(
+			tombstoneRecord("old", "token", time.Now().Add(-time.Hour)),
+			tombstoneRecord("new", "token", time.Now().Add(-time.Minute)),
+		).Build()
+		data := map[string]string{"spi-tombstone-old": "old", "spi-tombstone-new": "new"}
+
+		recreated := recreated.DeepCopy()
+		recreated.Annotations = nil
+		assert.NoError(t, recoverTokenData(context.TODO(), cl, tombstoneTestStorage(data), recreated))
+		assert.Equal(t, map[string]string{"spi-tombstone-old": "old", "token": "new"}, data)
+	})
+}
+
+func TestTombstonePurger(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, corev1.AddToScheme(sch))
+
+	now := time.Now()
+	cl := fake.NewClientBuilder().WithScheme(sch).WithObjects(
+		tombstoneRecord("expired", "a", now.Add(-2*time.Hour)),
+		tombstoneRecord("retained", "b", now.Add(-30*time.Minute)),
+	).Build()
+	data := map[string]string{"spi-tombstone-expired": "a", "spi-tombstone-retained": "b"}
+
+	p := &TombstonePurger{
+		Client:        cl,
+		TokenStorage:  tombstoneTestStorage(data),
+		Configuration: config.NewLiveConfiguration(config.Configuration{TokenDataRetention: time.Hour}),
+	}
+	assert.NoError(t, p.purge(context.TODO(), now))
+
+	assert.Equal(t, map[string]string{"spi-tombstone-retained": "b"}, data)
+	records := &corev1.ConfigMapList{}
+	assert.NoError(t, cl.List(context.TODO(), records))
+	assert.Len(t, records.Items, 1)
+	assert.Equal(t, "spi-tombstone-retained", records.Items[0].Name)
+}
+
+func tombstoneRecord(uid string, tokenName string, deletedAt time.Time) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      tombstoneNamePrefix + uid,
+			Namespace: "ns",
+			Labels:    map[string]string{tombstoneLabel: "true"},
+		},
+		Data: map[string]string{
+			tombstoneTokenNameKey: tokenName,
+			tombstoneDeletedAtKey: deletedAt.UTC().Format(time.RFC3339),
+		},
+	}
+}
@@ -24,11 +24,13 @@ import (
 	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
 
 	"k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
 	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/config"
+	spitesting "github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-testing"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -65,7 +67,7 @@ var _ = Describe("Create binding", func() {
 			},
 		}
 		Expect(ITest.Client.Create(ITest.Context, createdToken)).To(Succeed())
-		ITest.TestServiceProvider.LookupTokenImpl = LookupConcreteToken(&createdToken)
+		ITest.TestServiceProvider.LookupTokenImpl = spitesting.LookupConcreteToken(&createdToken)
 		ITest.TestServiceProvider.GetOauthEndpointImpl = func() string {
 			return "test-provider://acme"
 		}
@@ -113,6 +115,8 @@ var _ = Describe("Create binding", func() {
 			g.Expect(binding.Status.Phase).To(Equal(api.SPIAccessTokenBindingPhaseAwaitingTokenData))
 			g.Expect(binding.Status.ErrorReason).To(BeEmpty())
 			g.Expect(binding.Status.ErrorMessage).To(BeEmpty())
+			g.Expect(apimeta.IsStatusConditionTrue(binding.Status.Conditions, api.SPIAccessTokenBindingConditionTokenMatched)).To(BeTrue())
+			g.Expect(apimeta.IsStatusConditionFalse(binding.Status.Conditions, api.SPIAccessTokenBindingConditionTokenDataAvailable)).To(BeTrue())
 		}).WithTimeout(10 * time.Second).Should(Succeed())
 	})
 })
@@ -143,7 +147,7 @@ var _ = Describe("Update binding", func() {
 			},
 		}
 		Expect(ITest.Client.Create(ITest.Context, createdToken)).To(Succeed())
-		ITest.TestServiceProvider.LookupTokenImpl = LookupConcreteToken(&createdToken)
+		ITest.TestServiceProvider.LookupTokenImpl = spitesting.LookupConcreteToken(&createdToken)
 
 		Expect(ITest.Client.Create(ITest.Context, createdBinding)).To(Succeed())
 	})
@@ -263,7 +267,7 @@ var _ = Describe("Delete binding", func() {
 		By("creating binding")
 		Expect(ITest.Client.Create(ITest.Context, createdBinding)).To(Succeed())
 
-		ITest.TestServiceProvider.LookupTokenImpl = LookupConcreteToken(&createdToken)
+		ITest.TestServiceProvider.LookupTokenImpl = spitesting.LookupConcreteToken(&createdToken)
 
 		By("waiting for the token to get linked")
 		createdToken = getLinkedToken(Default, createdBinding)
@@ -274,7 +278,7 @@ var _ = Describe("Delete binding", func() {
 		Expect(err).NotTo(HaveOccurred())
 
 		// now that the token is stored, we can simulate parsing its metadata from the SP
-		ITest.TestServiceProvider.PersistMetadataImpl = PersistConcreteMetadata(&api.TokenMetadata{
+		ITest.TestServiceProvider.PersistMetadataImpl = spitesting.PersistConcreteMetadata(&api.TokenMetadata{
 			Username:             "alois",
 			UserId:               "42",
 			Scopes:               []string{},
@@ -333,7 +337,7 @@ var _ = Describe("Syncing", func() {
 			},
 		}
 		Expect(ITest.Client.Create(ITest.Context, createdToken)).To(Succeed())
-		ITest.TestServiceProvider.LookupTokenImpl = LookupConcreteToken(&createdToken)
+		ITest.TestServiceProvider.LookupTokenImpl = spitesting.LookupConcreteToken(&createdToken)
 
 		createdBinding = &api.SPIAccessTokenBinding{
 			ObjectMeta: metav1.ObjectMeta{
@@ -381,6 +385,74 @@ var _ = Describe("Syncing", func() {
 				g.Expect(string(secret.Data["password"])).To(Equal("access"))
 			})
 		})
+
+		It("references the exact version of the secret", func() {
+			err := ITest.TokenStorage.Store(ITest.Context, createdToken, &api.Token{
+				AccessToken: "access",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Eventually(func(g Gomega) {
+				g.Expect(ITest.Client.Get(ITest.Context, client.ObjectKeyFromObject(createdBinding), createdBinding)).To(Succeed())
+				g.Expect(createdBinding.Status.SyncedObjectRef.Name).To(Equal("binding-secret"))
+
+				secret := &corev1.Secret{}
+				g.Expect(ITest.Client.Get(ITest.Context, client.ObjectKey{Name: createdBinding.Status.SyncedObjectRef.Name, Namespace: createdBinding.Namespace}, secret)).To(Succeed())
+				g.Expect(createdBinding.Status.SyncedObjectRef.UID).To(Equal(secret.UID))
+				g.Expect(createdBinding.Status.SyncedObjectRef.DataChecksum).NotTo(BeEmpty())
+				g.Expect(createdBinding.Status.SyncedObjectRef.LastSyncTime).NotTo(BeNil())
+			}).Should(Succeed())
+		})
+	})
+
+	When("token becomes ready for multiple bindings", func() {
+		var otherBinding *api.SPIAccessTokenBinding
+
+		BeforeEach(func() {
+			otherBinding = &api.SPIAccessTokenBinding{
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "test-binding-other",
+					Namespace:    "default",
+				},
+				Spec: api.SPIAccessTokenBindingSpec{
+					RepoUrl: "test-provider://acme/acme",
+					Secret: api.SecretSpec{
+						Name: "other-binding-secret",
+						Type: corev1.SecretTypeBasicAuth,
+					},
+				},
+			}
+			Expect(ITest.Client.Create(ITest.Context, otherBinding)).To(Succeed())
+			testTokenNameInStatus(otherBinding, Equal(createdToken.Name))
+		})
+
+		AfterEach(func() {
+			Expect(ITest.Client.Delete(ITest.Context, otherBinding)).To(Succeed())
+		})
+
+		It("syncs the secrets of all linked bindings", func() {
+			ITest.TestServiceProvider.PersistMetadataImpl = spitesting.PersistConcreteMetadata(&api.TokenMetadata{
+				Username: "alois",
+				UserId:   "42",
+			})
+			err := ITest.TokenStorage.Store(ITest.Context, createdToken, &api.Token{
+				AccessToken: "access",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, b := range []*api.SPIAccessTokenBinding{createdBinding, otherBinding} {
+				binding := b
+				Eventually(func(g Gomega) {
+					g.Expect(ITest.Client.Get(ITest.Context, client.ObjectKeyFromObject(binding), binding)).To(Succeed())
+					g.Expect(binding.Status.Phase).To(Equal(api.SPIAccessTokenBindingPhaseInjected))
+					g.Expect(binding.Status.FirstSyncTime).NotTo(BeNil())
+
+					secret := &corev1.Secret{}
+					g.Expect(ITest.Client.Get(ITest.Context, client.ObjectKey{Name: binding.Status.SyncedObjectRef.Name, Namespace: binding.Namespace}, secret)).To(Succeed())
+					g.Expect(string(secret.Data["password"])).To(Equal("access"))
+				}).Should(Succeed())
+			}
+		})
 	})
 
 	When("token is not ready", func() {
@@ -422,7 +494,7 @@ var _ = Describe("Status updates", func() {
 		}
 
 		Expect(ITest.Client.Create(ITest.Context, token)).To(Succeed())
-		ITest.TestServiceProvider.LookupTokenImpl = LookupConcreteToken(&token)
+		ITest.TestServiceProvider.LookupTokenImpl = spitesting.LookupConcreteToken(&token)
 		Expect(ITest.Client.Create(ITest.Context, binding)).To(Succeed())
 
 		Eventually(func(g Gomega) {
@@ -440,7 +512,7 @@ var _ = Describe("Status updates", func() {
 	When("linked token is ready and secret not injected", func() {
 		BeforeEach(func() {
 			ITest.TestServiceProvider.LookupTokenImpl = nil
-			ITest.TestServiceProvider.PersistMetadataImpl = PersistConcreteMetadata(&api.TokenMetadata{
+			ITest.TestServiceProvider.PersistMetadataImpl = spitesting.PersistConcreteMetadata(&api.TokenMetadata{
 				Username:             "alois",
 				UserId:               "42",
 				Scopes:               []string{},
@@ -519,7 +591,7 @@ var _ = Describe("Status updates", func() {
 			// we're trying to use the token defined by the outer layer first.
 			// This token is not ready, so we should be in a situation that should
 			// still enable swapping the token for a better fitting one.
-			ITest.TestServiceProvider.LookupTokenImpl = LookupConcreteToken(&token)
+			ITest.TestServiceProvider.LookupTokenImpl = spitesting.LookupConcreteToken(&token)
 			Expect(ITest.Client.Create(ITest.Context, testBinding)).To(Succeed())
 		})
 
@@ -537,7 +609,7 @@ var _ = Describe("Status updates", func() {
 			}).Should(Succeed())
 
 			// now start returning the better token from the lookup
-			ITest.TestServiceProvider.LookupTokenImpl = LookupConcreteToken(&betterToken)
+			ITest.TestServiceProvider.LookupTokenImpl = spitesting.LookupConcreteToken(&betterToken)
 
 			// now simulate that betterToken got changed and has become a better match
 			// since we've set up the service provider above already, we only need to
@@ -567,7 +639,7 @@ var _ = Describe("Status updates", func() {
 			})
 			Expect(err).NotTo(HaveOccurred())
 
-			ITest.TestServiceProvider.PersistMetadataImpl = PersistConcreteMetadata(&api.TokenMetadata{
+			ITest.TestServiceProvider.PersistMetadataImpl = spitesting.PersistConcreteMetadata(&api.TokenMetadata{
 				Username:             "alois",
 				UserId:               "42",
 				Scopes:               []string{},
@@ -584,6 +656,7 @@ var _ = Describe("Status updates", func() {
 			Eventually(func(g Gomega) {
 				g.Expect(ITest.Client.Get(ITest.Context, client.ObjectKeyFromObject(binding), currentBinding)).To(Succeed())
 				g.Expect(currentBinding.Status.Phase).To(Equal(api.SPIAccessTokenBindingPhaseInjected))
+				g.Expect(apimeta.IsStatusConditionTrue(currentBinding.Status.Conditions, api.SPIAccessTokenBindingConditionSecretSynced)).To(BeTrue())
 			}).Should(Succeed())
 
 			secret = &corev1.Secret{}
@@ -599,7 +672,7 @@ var _ = Describe("Status updates", func() {
 		})
 
 		It("deletes the secret and flips back to awaiting phase", func() {
-			ITest.TestServiceProvider.PersistMetadataImpl = PersistConcreteMetadata(nil)
+			ITest.TestServiceProvider.PersistMetadataImpl = spitesting.PersistConcreteMetadata(nil)
 			Expect(ITest.TokenStorage.Delete(ITest.Context, token)).To(Succeed())
 
 			Eventually(func(g Gomega) {
@@ -642,3 +715,268 @@ var _ = Describe("Status updates", func() {
 		})
 	})
 })
+
+var _ = Describe("Token policy", func() {
+	var binding *api.SPIAccessTokenBinding
+
+	BeforeEach(func() {
+		ITest.TestServiceProvider.Reset()
+	})
+
+	AfterEach(func() {
+		Expect(ITest.Client.Delete(ITest.Context, binding)).To(Succeed())
+	})
+
+	When("policy is named", func() {
+		var namedToken *api.SPIAccessToken
+
+		BeforeEach(func() {
+			namedToken = &api.SPIAccessToken{
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "named-token-",
+					Namespace:    "default",
+				},
+				Spec: api.SPIAccessTokenSpec{
+					ServiceProviderUrl: "test-provider://",
+				},
+			}
+			Expect(ITest.Client.Create(ITest.Context, namedToken)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(ITest.Client.Delete(ITest.Context, namedToken)).To(Succeed())
+		})
+
+		It("links the named token", func() {
+			binding = &api.SPIAccessTokenBinding{
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "named-policy-binding-",
+					Namespace:    "default",
+				},
+				Spec: api.SPIAccessTokenBindingSpec{
+					RepoUrl: "test-provider://acme/acme",
+					TokenPolicy: api.TokenPolicy{
+						Type:      api.TokenPolicyTypeNamed,
+						TokenName: namedToken.Name,
+					},
+				},
+			}
+			Expect(ITest.Client.Create(ITest.Context, binding)).To(Succeed())
+
+			testTokenNameInStatus(binding, Equal(namedToken.Name))
+		})
+
+		It("fails for a token without the required permissions", func() {
+			binding = &api.SPIAccessTokenBinding{
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "named-policy-binding-",
+					Namespace:    "default",
+				},
+				Spec: api.SPIAccessTokenBindingSpec{
+					RepoUrl: "test-provider://acme/acme",
+					Permissions: api.Permissions{
+						Required: []api.Permission{
+							{Type: api.PermissionTypeWrite, Area: api.PermissionAreaRepository},
+						},
+					},
+					TokenPolicy: api.TokenPolicy{
+						Type:      api.TokenPolicyTypeNamed,
+						TokenName: namedToken.Name,
+					},
+				},
+			}
+			Expect(ITest.Client.Create(ITest.Context, binding)).To(Succeed())
+
+			Eventually(func(g Gomega) {
+				currentBinding := &api.SPIAccessTokenBinding{}
+				g.Expect(ITest.Client.Get(ITest.Context, client.ObjectKeyFromObject(binding), currentBinding)).To(Succeed())
+				g.Expect(currentBinding.Status.Phase).To(Equal(api.SPIAccessTokenBindingPhaseError))
+				g.Expect(currentBinding.Status.ErrorReason).To(Equal(api.SPIAccessTokenBindingErrorReasonTokenPolicy))
+				g.Expect(currentBinding.Status.LinkedAccessTokenName).To(BeEmpty())
+			}).Should(Succeed())
+		})
+
+		It("fails for a non-existent token", func() {
+			binding = &api.SPIAccessTokenBinding{
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "named-policy-binding-",
+					Namespace:    "default",
+				},
+				Spec: api.SPIAccessTokenBindingSpec{
+					RepoUrl: "test-provider://acme/acme",
+					TokenPolicy: api.TokenPolicy{
+						Type:      api.TokenPolicyTypeNamed,
+						TokenName: "non-existent-token",
+					},
+				},
+			}
+			Expect(ITest.Client.Create(ITest.Context, binding)).To(Succeed())
+
+			Eventually(func(g Gomega) {
+				currentBinding := &api.SPIAccessTokenBinding{}
+				g.Expect(ITest.Client.Get(ITest.Context, client.ObjectKeyFromObject(binding), currentBinding)).To(Succeed())
+				g.Expect(currentBinding.Status.Phase).To(Equal(api.SPIAccessTokenBindingPhaseError))
+				g.Expect(currentBinding.Status.ErrorReason).To(Equal(api.SPIAccessTokenBindingErrorReasonTokenPolicy))
+				g.Expect(currentBinding.Status.LinkedAccessTokenName).To(BeEmpty())
+			}).Should(Succeed())
+		})
+	})
+
+	When("policy is superset", func() {
+		It("creates the token with the additional permissions", func() {
+			binding = &api.SPIAccessTokenBinding{
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "superset-policy-binding-",
+					Namespace:    "default",
+				},
+				Spec: api.SPIAccessTokenBindingSpec{
+					RepoUrl: "test-provider://acme/acme",
+					Permissions: api.Permissions{
+						Required: []api.Permission{
+							{Type: api.PermissionTypeRead, Area: api.PermissionAreaRepository},
+						},
+					},
+					TokenPolicy: api.TokenPolicy{
+						Type: api.TokenPolicyTypeSuperset,
+						AdditionalPermissions: api.Permissions{
+							Required: []api.Permission{
+								{Type: api.PermissionTypeRead, Area: api.PermissionAreaRepository},
+								{Type: api.PermissionTypeWrite, Area: api.PermissionAreaRepository},
+							},
+							AdditionalScopes: []string{"read:org"},
+						},
+					},
+				},
+			}
+			Expect(ITest.Client.Create(ITest.Context, binding)).To(Succeed())
+
+			testTokenNameInStatus(binding, Not(BeEmpty()))
+
+			currentBinding := &api.SPIAccessTokenBinding{}
+			Expect(ITest.Client.Get(ITest.Context, client.ObjectKeyFromObject(binding), currentBinding)).To(Succeed())
+			token := &api.SPIAccessToken{}
+			Expect(ITest.Client.Get(ITest.Context, client.ObjectKey{Name: currentBinding.Status.LinkedAccessTokenName, Namespace: "default"}, token)).To(Succeed())
+
+			Expect(token.Spec.Permissions.Required).To(ConsistOf(
+				api.Permission{Type: api.PermissionTypeRead, Area: api.PermissionAreaRepository},
+				api.Permission{Type: api.PermissionTypeWrite, Area: api.PermissionAreaRepository},
+			))
+			Expect(token.Spec.Permissions.AdditionalScopes).To(ConsistOf("read:org"))
+
+			Expect(ITest.Client.Delete(ITest.Context, token)).To(Succeed())
+		})
+	})
+})
+
+var _ = Describe("Ephemeral binding", func() {
+	var createdBinding *api.SPIAccessTokenBinding
+
+	BeforeEach(func() {
+		ITest.TestServiceProvider.Reset()
+
+		createdBinding = &api.SPIAccessTokenBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				GenerateName: "ephemeral-test-binding",
+				Namespace:    "default",
+			},
+			Spec: api.SPIAccessTokenBindingSpec{
+				RepoUrl:   "test-provider://acme/acme",
+				Ephemeral: true,
+			},
+		}
+		Expect(ITest.Client.Create(ITest.Context, createdBinding)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(ITest.Client.Delete(ITest.Context, createdBinding)).To(Succeed())
+	})
+
+	It("fails if the service provider cannot mint ephemeral tokens", func() {
+		Eventually(func(g Gomega) {
+			binding := &api.SPIAccessTokenBinding{}
+			g.Expect(ITest.Client.Get(ITest.Context, client.ObjectKeyFromObject(createdBinding), binding)).To(Succeed())
+			g.Expect(binding.Status.ErrorReason).To(Equal(api.SPIAccessTokenBindingErrorReasonEphemeralTokenUnsupported))
+			g.Expect(binding.Status.SyncedObjectRef.Name).To(BeEmpty())
+		}).Should(Succeed())
+	})
+})
+
+var _ = Describe("Relinking", func() {
+	var binding *api.SPIAccessTokenBinding
+	var readyToken *api.SPIAccessToken
+
+	BeforeEach(func() {
+		ITest.TestServiceProvider.Reset()
+
+		binding = &api.SPIAccessTokenBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				GenerateName: "relinking-binding-",
+				Namespace:    "default",
+			},
+			Spec: api.SPIAccessTokenBindingSpec{
+				RepoUrl: "test-provider://acme/acme",
+			},
+		}
+		Expect(ITest.Client.Create(ITest.Context, binding)).To(Succeed())
+
+		testTokenNameInStatus(binding, Not(BeEmpty()))
+	})
+
+	AfterEach(func() {
+		ITest.TestServiceProvider.Reset()
+		Expect(ITest.Client.Delete(ITest.Context, binding)).To(Succeed())
+		if readyToken != nil {
+			Expect(ITest.TokenStorage.Delete(ITest.Context, readyToken)).To(Succeed())
+			Expect(ITest.Client.Delete(ITest.Context, readyToken)).To(Succeed())
+		}
+	})
+
+	It("relinks the binding to a ready token and deletes the generated one", func() {
+		currentBinding := &api.SPIAccessTokenBinding{}
+		Expect(ITest.Client.Get(ITest.Context, client.ObjectKeyFromObject(binding), currentBinding)).To(Succeed())
+		generatedToken := &api.SPIAccessToken{}
+		Expect(ITest.Client.Get(ITest.Context, client.ObjectKey{Name: currentBinding.Status.LinkedAccessTokenName, Namespace: "default"}, generatedToken)).To(Succeed())
+		Expect(generatedToken.Annotations[api.GeneratedForBindingAnnotation]).To(Equal(binding.Name))
+
+		readyToken = &api.SPIAccessToken{
+			ObjectMeta: metav1.ObjectMeta{
+				GenerateName: "relinking-ready-token-",
+				Namespace:    "default",
+			},
+			Spec: api.SPIAccessTokenSpec{
+				ServiceProviderUrl: "test-provider://",
+			},
+		}
+		Expect(ITest.Client.Create(ITest.Context, readyToken)).To(Succeed())
+
+		ITest.TestServiceProvider.PersistMetadataImpl = spitesting.PersistConcreteMetadata(&api.TokenMetadata{
+			Username: "alois",
+			UserId:   "42",
+			Scopes:   []string{},
+		})
+		Expect(ITest.TokenStorage.Store(ITest.Context, readyToken, &api.Token{AccessToken: "access_token"})).To(Succeed())
+
+		Eventually(func(g Gomega) {
+			currentToken := &api.SPIAccessToken{}
+			g.Expect(ITest.Client.Get(ITest.Context, client.ObjectKeyFromObject(readyToken), currentToken)).To(Succeed())
+			g.Expect(currentToken.Status.Phase).To(Equal(api.SPIAccessTokenPhaseReady))
+		}).Should(Succeed())
+
+		ITest.TestServiceProvider.LookupTokenImpl = spitesting.LookupConcreteToken(&readyToken)
+
+		// touch the ready token to force the reconciliation of the bindings in the namespace
+		Eventually(func(g Gomega) {
+			currentToken := &api.SPIAccessToken{}
+			g.Expect(ITest.Client.Get(ITest.Context, client.ObjectKeyFromObject(readyToken), currentToken)).To(Succeed())
+			currentToken.Annotations = map[string]string{"relinking": "true"}
+			g.Expect(ITest.Client.Update(ITest.Context, currentToken)).To(Succeed())
+		}).Should(Succeed())
+
+		testTokenNameInStatus(binding, Equal(readyToken.Name))
+
+		Eventually(func(g Gomega) {
+			err := ITest.Client.Get(ITest.Context, client.ObjectKeyFromObject(generatedToken), &api.SPIAccessToken{})
+			g.Expect(errors.IsNotFound(err)).To(BeTrue())
+		}).Should(Succeed())
+	})
+})
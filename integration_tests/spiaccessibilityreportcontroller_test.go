@@ -0,0 +1,121 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integrationtests
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	spitesting "github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-testing"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("SPIAccessibilityReport", func() {
+	var token *api.SPIAccessToken
+	var report *api.SPIAccessibilityReport
+
+	BeforeEach(func() {
+		ITest.TestServiceProvider.Reset()
+		ITest.TestServiceProvider.GetAccessibleResourcesImpl = func(_ context.Context, _ *api.SPIAccessToken) (serviceprovider.AccessibleResources, error) {
+			return serviceprovider.AccessibleResources{
+				Organizations: []string{"acme"},
+				Repositories:  []string{"test-provider://acme/repo"},
+			}, nil
+		}
+		ITest.TestServiceProvider.PersistMetadataImpl = spitesting.PersistConcreteMetadata(&api.TokenMetadata{
+			Username:             "alois",
+			UserId:               "42",
+			Scopes:               []string{"read"},
+			ServiceProviderState: []byte("state"),
+		})
+
+		report = &api.SPIAccessibilityReport{
+			ObjectMeta: metav1.ObjectMeta{
+				GenerateName: "accessibility-report-test",
+				Namespace:    "default",
+			},
+		}
+		Expect(ITest.Client.Create(ITest.Context, report)).To(Succeed())
+
+		token = &api.SPIAccessToken{
+			ObjectMeta: metav1.ObjectMeta{
+				GenerateName: "accessibility-report-test-token",
+				Namespace:    "default",
+			},
+			Spec: api.SPIAccessTokenSpec{
+				ServiceProviderUrl: "test-provider://",
+			},
+		}
+		Expect(ITest.Client.Create(ITest.Context, token)).To(Succeed())
+		Expect(ITest.TokenStorage.Store(ITest.Context, token, &api.Token{
+			AccessToken: "access",
+		})).To(Succeed())
+	})
+
+	AfterEach(func() {
+		currentToken := &api.SPIAccessToken{}
+		Expect(ITest.Client.Get(ITest.Context, client.ObjectKeyFromObject(token), currentToken)).To(Succeed())
+		Expect(ITest.Client.Delete(ITest.Context, currentToken)).To(Succeed())
+
+		currentReport := &api.SPIAccessibilityReport{}
+		Expect(ITest.Client.Get(ITest.Context, client.ObjectKeyFromObject(report), currentReport)).To(Succeed())
+		Expect(ITest.Client.Delete(ITest.Context, currentReport)).To(Succeed())
+	})
+
+	It("lists the accessible resources of the ready tokens", func() {
+		Eventually(func(g Gomega) {
+			currentReport := &api.SPIAccessibilityReport{}
+			g.Expect(ITest.Client.Get(ITest.Context, client.ObjectKeyFromObject(report), currentReport)).To(Succeed())
+			g.Expect(currentReport.Status.Accounts).To(ContainElement(api.AccessibleAccount{
+				TokenName:           token.Name,
+				ServiceProviderType: "TestServiceProvider",
+				ServiceProviderUrl:  "test-provider://",
+				Username:            "alois",
+				Scopes:              []string{"read"},
+				Organizations:       []string{"acme"},
+				Repositories:        []string{"test-provider://acme/repo"},
+			}))
+		}).Should(Succeed())
+	})
+
+	It("removes the token when it is no longer ready", func() {
+		Eventually(func(g Gomega) {
+			currentReport := &api.SPIAccessibilityReport{}
+			g.Expect(ITest.Client.Get(ITest.Context, client.ObjectKeyFromObject(report), currentReport)).To(Succeed())
+			g.Expect(accountTokenNames(currentReport)).To(ContainElement(token.Name))
+		}).Should(Succeed())
+
+		ITest.TestServiceProvider.PersistMetadataImpl = spitesting.PersistConcreteMetadata(nil)
+		Expect(ITest.TokenStorage.Delete(ITest.Context, token)).To(Succeed())
+
+		Eventually(func(g Gomega) {
+			currentReport := &api.SPIAccessibilityReport{}
+			g.Expect(ITest.Client.Get(ITest.Context, client.ObjectKeyFromObject(report), currentReport)).To(Succeed())
+			g.Expect(accountTokenNames(currentReport)).NotTo(ContainElement(token.Name))
+		}).Should(Succeed())
+	})
+})
+
+func accountTokenNames(report *api.SPIAccessibilityReport) []string {
+	names := make([]string, 0, len(report.Status.Accounts))
+	for _, a := range report.Status.Accounts {
+		names = append(names, a.TokenName)
+	}
+	return names
+}
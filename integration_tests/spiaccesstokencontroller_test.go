@@ -29,6 +29,7 @@ import (
 	. "github.com/onsi/gomega"
 	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
 	opconfig "github.com/redhat-appstudio/service-provider-integration-operator/pkg/config"
+	spitesting "github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-testing"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -98,7 +99,7 @@ var _ = Describe("Token data disappears", func() {
 			AccessToken: "access",
 		})).To(Succeed())
 
-		ITest.TestServiceProvider.PersistMetadataImpl = PersistConcreteMetadata(&api.TokenMetadata{
+		ITest.TestServiceProvider.PersistMetadataImpl = spitesting.PersistConcreteMetadata(&api.TokenMetadata{
 			Username:             "alois",
 			UserId:               "42",
 			Scopes:               []string{},
@@ -119,7 +120,7 @@ var _ = Describe("Token data disappears", func() {
 	})
 
 	It("flips token back to awaiting phase when data disappears", func() {
-		ITest.TestServiceProvider.PersistMetadataImpl = PersistConcreteMetadata(nil)
+		ITest.TestServiceProvider.PersistMetadataImpl = spitesting.PersistConcreteMetadata(nil)
 		Expect(ITest.TokenStorage.Delete(ITest.Context, token)).To(Succeed())
 
 		Eventually(func(g Gomega) {
@@ -131,6 +132,168 @@ var _ = Describe("Token data disappears", func() {
 	})
 })
 
+var _ = Describe("Token data invalidation", func() {
+	var token *api.SPIAccessToken
+
+	BeforeEach(func() {
+		ITest.TestServiceProvider.Reset()
+
+		token = &api.SPIAccessToken{
+			ObjectMeta: metav1.ObjectMeta{
+				GenerateName: "invalidation-test-token",
+				Namespace:    "default",
+			},
+			Spec: api.SPIAccessTokenSpec{
+				ServiceProviderUrl: "test-provider://",
+			},
+		}
+
+		Expect(ITest.Client.Create(ITest.Context, token)).To(Succeed())
+
+		Expect(ITest.TokenStorage.Store(ITest.Context, token, &api.Token{
+			AccessToken: "access",
+		})).To(Succeed())
+
+		ITest.TestServiceProvider.PersistMetadataImpl = spitesting.PersistConcreteMetadata(&api.TokenMetadata{
+			Username:             "alois",
+			UserId:               "42",
+			Scopes:               []string{},
+			ServiceProviderState: []byte("state"),
+		})
+
+		Eventually(func(g Gomega) {
+			currentToken := &api.SPIAccessToken{}
+			g.Expect(ITest.Client.Get(ITest.Context, client.ObjectKeyFromObject(token), currentToken)).To(Succeed())
+			g.Expect(currentToken.Status.Phase).To(Equal(api.SPIAccessTokenPhaseReady))
+		}).Should(Succeed())
+	})
+
+	AfterEach(func() {
+		currentToken := &api.SPIAccessToken{}
+		Expect(ITest.Client.Get(ITest.Context, client.ObjectKeyFromObject(token), currentToken)).To(Succeed())
+		Expect(ITest.Client.Delete(ITest.Context, currentToken)).To(Succeed())
+	})
+
+	It("wipes the data and flips the token back to awaiting phase", func() {
+		ITest.TestServiceProvider.PersistMetadataImpl = nil
+
+		Eventually(func(g Gomega) {
+			currentToken := &api.SPIAccessToken{}
+			g.Expect(ITest.Client.Get(ITest.Context, client.ObjectKeyFromObject(token), currentToken)).To(Succeed())
+			if currentToken.Annotations == nil {
+				currentToken.Annotations = map[string]string{}
+			}
+			currentToken.Annotations[api.InvalidateTokenDataAnnotation] = "true"
+			g.Expect(ITest.Client.Update(ITest.Context, currentToken)).To(Succeed())
+		}).Should(Succeed())
+
+		Eventually(func(g Gomega) {
+			currentToken := &api.SPIAccessToken{}
+			g.Expect(ITest.Client.Get(ITest.Context, client.ObjectKeyFromObject(token), currentToken)).To(Succeed())
+			g.Expect(currentToken.Status.Phase).To(Equal(api.SPIAccessTokenPhaseAwaitingTokenData))
+			g.Expect(currentToken.Status.TokenMetadata).To(BeNil())
+			g.Expect(currentToken.Annotations).NotTo(HaveKey(api.InvalidateTokenDataAnnotation))
+		}).Should(Succeed())
+
+		data, err := ITest.TokenStorage.Get(ITest.Context, token)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(BeNil())
+	})
+})
+
+var _ = Describe("Token data rollback", func() {
+	var token *api.SPIAccessToken
+
+	BeforeEach(func() {
+		ITest.TestServiceProvider.Reset()
+
+		token = &api.SPIAccessToken{
+			ObjectMeta: metav1.ObjectMeta{
+				GenerateName: "rollback-test-token",
+				Namespace:    "default",
+			},
+			Spec: api.SPIAccessTokenSpec{
+				ServiceProviderUrl: "test-provider://",
+			},
+		}
+
+		Expect(ITest.Client.Create(ITest.Context, token)).To(Succeed())
+
+		Expect(ITest.TokenStorage.Store(ITest.Context, token, &api.Token{
+			AccessToken: "good",
+		})).To(Succeed())
+		Expect(ITest.TokenStorage.Store(ITest.Context, token, &api.Token{
+			AccessToken: "wrong",
+		})).To(Succeed())
+
+		ITest.TestServiceProvider.PersistMetadataImpl = spitesting.PersistConcreteMetadata(&api.TokenMetadata{
+			Username:             "alois",
+			UserId:               "42",
+			Scopes:               []string{},
+			ServiceProviderState: []byte("state"),
+		})
+
+		Eventually(func(g Gomega) {
+			currentToken := &api.SPIAccessToken{}
+			g.Expect(ITest.Client.Get(ITest.Context, client.ObjectKeyFromObject(token), currentToken)).To(Succeed())
+			g.Expect(currentToken.Status.Phase).To(Equal(api.SPIAccessTokenPhaseReady))
+			g.Expect(currentToken.Status.DataVersion).To(Equal(uint64(2)))
+			g.Expect(currentToken.Status.PreviousDataVersions).To(Equal([]uint64{1}))
+		}).Should(Succeed())
+	})
+
+	AfterEach(func() {
+		currentToken := &api.SPIAccessToken{}
+		Expect(ITest.Client.Get(ITest.Context, client.ObjectKeyFromObject(token), currentToken)).To(Succeed())
+		Expect(ITest.Client.Delete(ITest.Context, currentToken)).To(Succeed())
+	})
+
+	setRollbackAnnotation := func(version string) {
+		Eventually(func(g Gomega) {
+			currentToken := &api.SPIAccessToken{}
+			g.Expect(ITest.Client.Get(ITest.Context, client.ObjectKeyFromObject(token), currentToken)).To(Succeed())
+			if currentToken.Annotations == nil {
+				currentToken.Annotations = map[string]string{}
+			}
+			currentToken.Annotations[api.RollbackTokenDataAnnotation] = version
+			g.Expect(ITest.Client.Update(ITest.Context, currentToken)).To(Succeed())
+		}).Should(Succeed())
+	}
+
+	It("restores the previous data as a new version", func() {
+		setRollbackAnnotation("1")
+
+		Eventually(func(g Gomega) {
+			currentToken := &api.SPIAccessToken{}
+			g.Expect(ITest.Client.Get(ITest.Context, client.ObjectKeyFromObject(token), currentToken)).To(Succeed())
+			g.Expect(currentToken.Status.Phase).To(Equal(api.SPIAccessTokenPhaseReady))
+			g.Expect(currentToken.Status.DataVersion).To(Equal(uint64(3)))
+			g.Expect(currentToken.Status.PreviousDataVersions).To(Equal([]uint64{2, 1}))
+			g.Expect(currentToken.Annotations).NotTo(HaveKey(api.RollbackTokenDataAnnotation))
+		}).Should(Succeed())
+
+		data, err := ITest.TokenStorage.Get(ITest.Context, token)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data.AccessToken).To(Equal("good"))
+	})
+
+	It("fails on unknown version", func() {
+		setRollbackAnnotation("42")
+
+		Eventually(func(g Gomega) {
+			currentToken := &api.SPIAccessToken{}
+			g.Expect(ITest.Client.Get(ITest.Context, client.ObjectKeyFromObject(token), currentToken)).To(Succeed())
+			g.Expect(currentToken.Status.Phase).To(Equal(api.SPIAccessTokenPhaseError))
+			g.Expect(currentToken.Status.ErrorReason).To(Equal(api.SPIAccessTokenErrorReasonTokenDataRollback))
+			g.Expect(currentToken.Annotations).To(HaveKey(api.RollbackTokenDataAnnotation))
+		}).Should(Succeed())
+
+		data, err := ITest.TokenStorage.Get(ITest.Context, token)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data.AccessToken).To(Equal("wrong"))
+	})
+})
+
 var _ = Describe("Delete token", func() {
 	var createdToken *api.SPIAccessToken
 	tokenDeleteInProgress := false
@@ -172,7 +335,7 @@ var _ = Describe("Delete token", func() {
 
 		BeforeEach(func() {
 			ITest.TestServiceProvider.Reset()
-			ITest.TestServiceProvider.LookupTokenImpl = LookupConcreteToken(&createdToken)
+			ITest.TestServiceProvider.LookupTokenImpl = spitesting.LookupConcreteToken(&createdToken)
 
 			createdBinding = &api.SPIAccessTokenBinding{
 				ObjectMeta: metav1.ObjectMeta{
@@ -270,9 +433,17 @@ var _ = Describe("Phase", func() {
 			}).Should(Succeed())
 		})
 
+		It("exposes the upload URL", func() {
+			Eventually(func(g Gomega) {
+				token := &api.SPIAccessToken{}
+				g.Expect(ITest.Client.Get(ITest.Context, client.ObjectKeyFromObject(createdToken), token)).To(Succeed())
+				g.Expect(token.Status.UploadUrl).To(Equal("https://spi.test/token/default/" + createdToken.Name))
+			}).Should(Succeed())
+		})
+
 		When("metadata is persisted", func() {
 			BeforeEach(func() {
-				ITest.TestServiceProvider.PersistMetadataImpl = PersistConcreteMetadata(&api.TokenMetadata{
+				ITest.TestServiceProvider.PersistMetadataImpl = spitesting.PersistConcreteMetadata(&api.TokenMetadata{
 					Username:             "user",
 					UserId:               "42",
 					Scopes:               []string{},
@@ -287,6 +458,8 @@ var _ = Describe("Phase", func() {
 					g.Expect(token.Status.Phase).To(Equal(api.SPIAccessTokenPhaseReady))
 					g.Expect(token.Status.ErrorReason).To(BeEmpty())
 					g.Expect(token.Status.ErrorMessage).To(BeEmpty())
+					g.Expect(token.Status.OAuthUrl).To(BeEmpty())
+					g.Expect(token.Status.UploadUrl).To(BeEmpty())
 				}).Should(Succeed())
 			})
 		})
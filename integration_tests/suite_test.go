@@ -16,57 +16,29 @@ package integrationtests
 
 import (
 	"context"
-	"net/http"
-	"path/filepath"
-	"strings"
 	"testing"
-	"time"
 
 	"github.com/hashicorp/vault/vault"
 
 	config2 "github.com/onsi/ginkgo/config"
 
 	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/tokenstorage"
-
-	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
-	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
-
-	corev1 "k8s.io/api/core/v1"
+	spitesting "github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-testing"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
-	admissionv1beta1 "k8s.io/api/admission/v1beta1"
-	rbac "k8s.io/api/rbac/v1"
-
-	//+kubebuilder:scaffold:imports
-	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
-	"github.com/redhat-appstudio/service-provider-integration-operator/controllers"
-	authzv1 "k8s.io/api/authorization/v1"
-	"k8s.io/apimachinery/pkg/runtime"
-	ctrl "sigs.k8s.io/controller-runtime"
-	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/envtest"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 )
 
 type IntegrationTest struct {
-	Client                   client.Client
-	NoPrivsClient            client.Client
-	TestEnvironment          *envtest.Environment
-	Context                  context.Context
-	TokenStorage             tokenstorage.TokenStorage
-	Cancel                   context.CancelFunc
-	TestServiceProviderProbe serviceprovider.Probe
-	TestServiceProvider      TestServiceProvider
-	VaultTestCluster         *vault.TestCluster
+	*spitesting.Environment
+	VaultTestCluster *vault.TestCluster
 }
 
 var ITest IntegrationTest
 
-var _ serviceprovider.ServiceProvider = (*TestServiceProvider)(nil)
-
 func TestSuite(t *testing.T) {
 	RegisterFailHandler(Fail)
 
@@ -85,172 +57,24 @@ var _ = BeforeSuite(func() {
 
 	ITest = IntegrationTest{}
 
-	ctx, cancel := context.WithCancel(context.TODO())
-	ITest.Context = ctx
-	ITest.Cancel = cancel
-
-	By("bootstrapping test environment")
-	testEnv := &envtest.Environment{
-		CRDDirectoryPaths:     []string{filepath.Join("..", "config", "crd", "bases")},
-		ErrorIfCRDPathMissing: true,
-	}
-	ITest.TestEnvironment = testEnv
-
-	cfg, err := testEnv.Start()
-	Expect(err).NotTo(HaveOccurred())
-	Expect(cfg).NotTo(BeNil())
-
-	noPrivsUser, err := testEnv.AddUser(envtest.User{
-		Name:   "test-user",
-		Groups: []string{},
-	}, nil)
-	Expect(err).NotTo(HaveOccurred())
-
-	scheme := runtime.NewScheme()
-
-	err = corev1.AddToScheme(scheme)
-	Expect(err).NotTo(HaveOccurred())
-
-	err = api.AddToScheme(scheme)
-	Expect(err).NotTo(HaveOccurred())
-
-	err = admissionv1beta1.AddToScheme(scheme)
-	Expect(err).NotTo(HaveOccurred())
-
-	err = authzv1.AddToScheme(scheme)
-	Expect(err).NotTo(HaveOccurred())
-
-	err = rbac.AddToScheme(scheme)
-	Expect(err).NotTo(HaveOccurred())
-
-	//+kubebuilder:scaffold:scheme
-
-	cl, err := client.New(cfg, client.Options{Scheme: scheme})
-	Expect(err).NotTo(HaveOccurred())
-	Expect(cl).NotTo(BeNil())
-	ITest.Client = cl
-
-	noPrivsClient, err := client.New(noPrivsUser.Config(), client.Options{
-		Scheme: scheme,
-	})
-	Expect(err).NotTo(HaveOccurred())
-	Expect(noPrivsClient).NotTo(BeNil())
-	ITest.NoPrivsClient = noPrivsClient
-
-	ITest.TestServiceProvider = TestServiceProvider{}
-	ITest.TestServiceProviderProbe = serviceprovider.ProbeFunc(func(_ *http.Client, baseUrl string) (string, error) {
-		if strings.HasPrefix(baseUrl, "test-provider://") {
-			return "test-provider://", nil
-		}
-
-		return "", nil
-	})
-
-	operatorCfg := config.Configuration{
-		ServiceProviders: []config.ServiceProviderConfiguration{
-			{
-				ClientId:            "testClient",
-				ClientSecret:        "testSecret",
-				ServiceProviderType: "TestServiceProvider",
-			},
-		},
-		SharedSecret:   []byte("secret"),
-		AccessCheckTtl: 10 * time.Second,
-	}
-
-	// start webhook server using Manager
-	webhookInstallOptions := &testEnv.WebhookInstallOptions
-	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
-		Scheme:             scheme,
-		Host:               webhookInstallOptions.LocalServingHost,
-		Port:               webhookInstallOptions.LocalServingPort,
-		CertDir:            webhookInstallOptions.LocalServingCertDir,
-		LeaderElection:     false,
-		MetricsBindAddress: "0",
-	})
-	Expect(err).NotTo(HaveOccurred())
-
 	var strg tokenstorage.TokenStorage
 	ITest.VaultTestCluster, strg = tokenstorage.CreateTestVaultTokenStorage(GinkgoT())
-	Expect(err).NotTo(HaveOccurred())
-
-	ITest.TokenStorage = &tokenstorage.NotifyingTokenStorage{
-		Client:       cl,
-		TokenStorage: strg,
-	}
-
-	factory := serviceprovider.Factory{
-		Configuration:    operatorCfg,
-		KubernetesClient: mgr.GetClient(),
-		HttpClient:       http.DefaultClient,
-		Initializers: map[config.ServiceProviderType]serviceprovider.Initializer{
-			"TestServiceProvider": {
-				Probe: serviceprovider.ProbeFunc(func(cl *http.Client, baseUrl string) (string, error) {
-					return ITest.TestServiceProviderProbe.Examine(cl, baseUrl)
-				}),
-				Constructor: serviceprovider.ConstructorFunc(func(f *serviceprovider.Factory, _ string) (serviceprovider.ServiceProvider, error) {
-					return ITest.TestServiceProvider, nil
-				}),
-			},
-		},
-		TokenStorage: strg,
-	}
 
-	// the controllers themselves do not need the notifying token storage because they operate in the cluster
-	// the notifying token storage is only needed if changes are only made to the storage and the cluster needs to be
-	// notified about it. This only happens in OAuth service or in tests. So the test code is using notifying token
-	// storage so that the controllers can react to the changes made to the token storage by the testsuite but the
-	// controllers themselves use the "raw" token storage because they only write to the storage based on the conditions
-	// in the cluster.
-	err = (&controllers.SPIAccessTokenReconciler{
-		Client:                 mgr.GetClient(),
-		Scheme:                 mgr.GetScheme(),
-		TokenStorage:           strg,
-		Configuration:          operatorCfg,
-		ServiceProviderFactory: factory,
-	}).SetupWithManager(mgr)
-	Expect(err).NotTo(HaveOccurred())
-
-	err = (&controllers.SPIAccessTokenBindingReconciler{
-		Client:                 mgr.GetClient(),
-		Scheme:                 mgr.GetScheme(),
-		TokenStorage:           strg,
-		ServiceProviderFactory: factory,
-	}).SetupWithManager(mgr)
-	Expect(err).NotTo(HaveOccurred())
-
-	err = (&controllers.SPIAccessTokenDataUpdateReconciler{
-		Client: mgr.GetClient(),
-	}).SetupWithManager(mgr)
-	Expect(err).NotTo(HaveOccurred())
-
-	err = (&controllers.SPIAccessCheckReconciler{
-		Client:                 mgr.GetClient(),
-		Scheme:                 mgr.GetScheme(),
-		ServiceProviderFactory: factory,
-		Configuration:          operatorCfg,
-	}).SetupWithManager(mgr)
+	By("bootstrapping test environment")
+	env, err := spitesting.NewEnvironment().
+		WithTokenStorage(strg).
+		Start(context.TODO())
 	Expect(err).NotTo(HaveOccurred())
-
-	//+kubebuilder:scaffold:webhook
-
-	go func() {
-		err = mgr.Start(ctx)
-		if err != nil {
-			Expect(err).NotTo(HaveOccurred())
-		}
-	}()
+	ITest.Environment = env
 }, 3600)
 
 var _ = AfterSuite(func() {
-	if ITest.Cancel != nil {
-		ITest.Cancel()
-	}
-
 	By("tearing down the test environment")
-	ITest.VaultTestCluster.Cleanup()
-	if ITest.TestEnvironment != nil {
-		err := ITest.TestEnvironment.Stop()
+	if ITest.Environment != nil {
+		err := ITest.Stop()
 		Expect(err).NotTo(HaveOccurred())
 	}
+	if ITest.VaultTestCluster != nil {
+		ITest.VaultTestCluster.Cleanup()
+	}
 })
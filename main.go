@@ -17,18 +17,24 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/go-logr/zapr"
 	"go.uber.org/zap"
 
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/cloudevents"
 	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceproviders"
 
 	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/tokenstorage"
 
 	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/webhook"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/writeback"
 
 	corev1 "k8s.io/api/core/v1"
 
@@ -38,12 +44,19 @@ import (
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 	crzap "sigs.k8s.io/controller-runtime/pkg/log/zap"
+	crwebhook "sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	appstudiov1beta1 "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
 	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/config"
@@ -51,10 +64,16 @@ import (
 	//+kubebuilder:scaffold:imports
 
 	sharedConfig "github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/httptransport"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/oauthstate"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/stateoffload"
 )
 
 var (
 	scheme = runtime.NewScheme()
+	// version is the version of the operator reported in the User-Agent of the requests to the service providers. It
+	// is set during the build using -ldflags "-X main.version=...".
+	version = "dev"
 )
 
 func init() {
@@ -70,6 +89,28 @@ func main() {
 	var probeAddr string
 	var configFile string
 	var devmode bool
+	var configReloadInterval time.Duration
+	var serviceProviderTimeout time.Duration
+	var enableScopeValidationWebhook bool
+	var enableBindingValidationWebhook bool
+	var enableTokenOwnershipWebhook bool
+	var enableTokenDeletionWebhook bool
+	var enableTokenValidationEndpoint bool
+	var enableCredentialsLookup bool
+	var enableOAuthStateInspection bool
+	var enablePipelineRunIntegration bool
+	var enableRepositoryWebhooks bool
+	var enablePodCredentials bool
+	var enablePullSecretInjection bool
+	var enableBindingReadinessGates bool
+	var podCredentialsImage string
+	var podCredentialsUrl string
+	var podCredentialsCAFile string
+	var migrateTokenStorage bool
+	var exportTokens string
+	var importTokens string
+	var backupKeyFile string
+	var cloudEventsSink string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
@@ -77,6 +118,71 @@ func main() {
 			"Enabling this will ensure there is only one active controller manager.")
 	flag.StringVar(&configFile, "config-file", "/etc/spi/config.yaml", "The location of the configuration file.")
 	flag.BoolVar(&devmode, "dev-mode", false, "Enable debug logging and insecure communication with vault")
+	flag.DurationVar(&configReloadInterval, "config-reload-interval", 30*time.Second,
+		"The interval in which the configuration file is checked for changes. Set to 0 to disable the live reload.")
+	flag.DurationVar(&serviceProviderTimeout, "service-provider-timeout", 30*time.Second,
+		"The timeout of the requests to the service providers. Set to 0 to disable the timeout.")
+	flag.IntVar(&controllers.HotLoopThreshold, "hot-loop-threshold", controllers.HotLoopThreshold,
+		"The number of reconciliations of a single object within a minute above which the object is reported as "+
+			"reconciled too often. Set to 0 to disable the detection.")
+	flag.BoolVar(&enableScopeValidationWebhook, "enable-scope-validation-webhook", false,
+		"Serve the admission webhook validating the permissions of the tokens and bindings. Requires the webhook "+
+			"server certificates to be configured.")
+	flag.BoolVar(&enableBindingValidationWebhook, "enable-binding-validation-webhook", false,
+		"Serve the admission webhook rejecting the bindings requesting secrets that their service provider cannot "+
+			"provide. Requires the webhook server certificates to be configured.")
+	flag.BoolVar(&enableTokenOwnershipWebhook, "enable-token-ownership-webhook", false,
+		"Serve the admission webhook recording the creators of the bindings and protecting the owners of the tokens. "+
+			"Requires the webhook server certificates to be configured.")
+	flag.BoolVar(&enableTokenDeletionWebhook, "enable-token-deletion-webhook", false,
+		"Serve the admission webhook warning the users deleting the tokens that still have linked bindings (or denying "+
+			"the deletion, depending on the configuration). Requires the webhook server certificates to be configured.")
+	flag.BoolVar(&enableTokenValidationEndpoint, "enable-token-validation-endpoint", false,
+		"Serve the endpoint checking the credentials with the service provider before they are uploaded. Requires the "+
+			"webhook server certificates to be configured.")
+	flag.BoolVar(&enableCredentialsLookup, "enable-credentials-lookup", false,
+		"Serve the API letting the trusted services configured in credentialsLookupUsers obtain the credentials for "+
+			"a repository on behalf of a namespace. Requires the webhook server certificates to be configured.")
+	flag.BoolVar(&enableOAuthStateInspection, "enable-oauth-state-inspection", false,
+		"Serve the debugging endpoint letting the users configured in debugUsers decode and validate the OAuth "+
+			"states. Requires the webhook server certificates to be configured.")
+	flag.BoolVar(&enablePipelineRunIntegration, "enable-pipelinerun-integration", false,
+		"Provide the credentials to the Tekton PipelineRuns annotated with the repository URL. Requires Tekton to be "+
+			"installed in the cluster.")
+	flag.BoolVar(&enableRepositoryWebhooks, "enable-repository-webhooks", false,
+		"Manage the webhooks in the repositories of the bindings as requested by the SPIRepositoryWebhooks.")
+	flag.BoolVar(&enablePodCredentials, "enable-pod-credentials", false,
+		"Serve the data of the bindings with the Pod delivery to the pods and the admission webhook injecting the init "+
+			"container fetching it. Requires the webhook server certificates to be configured.")
+	flag.BoolVar(&enablePullSecretInjection, "enable-pull-secret-injection", false,
+		"Serve the admission webhook adding the pull secrets produced from the Ready tokens for the registries of "+
+			"the images to the pods in the namespaces labeled with spi.appstudio.redhat.com/inject-pull-secrets=true. "+
+			"Requires the webhook server certificates to be configured.")
+	flag.BoolVar(&enableBindingReadinessGates, "enable-binding-readiness-gates", false,
+		"Serve the admission webhook adding the readiness gate to the pods annotated with "+
+			"spi.appstudio.redhat.com/wait-for-bindings and maintain the readiness condition of the pods according to "+
+			"the bindings. Requires the webhook server certificates to be configured.")
+	flag.StringVar(&podCredentialsImage, "pod-credentials-image", "",
+		"The image of the init container fetching the data of the bindings into the pods. Usually the image of the operator.")
+	flag.StringVar(&podCredentialsUrl, "pod-credentials-url", "",
+		"The URL of the pod credentials endpoint of the webhook server as reachable from the pods.")
+	flag.StringVar(&podCredentialsCAFile, "pod-credentials-ca-file", "",
+		"The file with the CA certificate the pods verify the pod credentials endpoint with. The system CAs are used if not set.")
+	flag.StringVar(&cloudEventsSink, "cloud-events-sink", os.Getenv("K_SINK"),
+		"The URL the CloudEvents about the tokens becoming Ready or Invalid, the completed OAuth flows and the synced "+
+			"secrets of the bindings are sent to. Defaults to the K_SINK environment variable set by the Knative "+
+			"SinkBinding. No events are sent if empty.")
+	flag.BoolVar(&migrateTokenStorage, "migrate-token-storage", false,
+		"Copy the data of all the tokens from the token storage configured as the migration source to the configured "+
+			"token storage and exit.")
+	flag.StringVar(&exportTokens, "export-tokens", "",
+		"Write the encrypted backup of all the SPIAccessTokens and their data in the token storage to the file and exit. "+
+			"Requires --backup-key-file.")
+	flag.StringVar(&importTokens, "import-tokens", "",
+		"Restore the SPIAccessTokens and their data from the encrypted backup in the file and exit. The tokens that "+
+			"already have data are left intact. Requires --backup-key-file.")
+	flag.StringVar(&backupKeyFile, "backup-key-file", "",
+		"The file with the key the backups of the tokens are encrypted with.")
 
 	flag.Parse()
 
@@ -96,6 +202,17 @@ func main() {
 		os.Exit(1)
 	}
 
+	if enablePodCredentials && (podCredentialsImage == "" || podCredentialsUrl == "") {
+		setupLog.Error(fmt.Errorf("--pod-credentials-image and --pod-credentials-url are required with --enable-pod-credentials"), "invalid flags")
+		os.Exit(1)
+	}
+
+	cfg, err := sharedConfig.LoadFrom(configFile)
+	if err != nil {
+		setupLog.Error(err, "Failed to load the configuration")
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
@@ -104,23 +221,179 @@ func main() {
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "f5c55e16.appstudio.redhat.org",
 		Logger:                 ctrl.Log,
+		// the operator only writes its status config maps, there's no need to cache all of them. The secrets are read
+		// directly too, so that their data is never cached. Only the metadata of the secrets created by SPI is cached
+		// for the watches (see below).
+		ClientDisableCacheFor: []client.Object{&corev1.ConfigMap{}, &corev1.Secret{}},
+		// the large service provider states are moved out of the status of the tokens so that they don't exceed the size
+		// limit of the objects
+		NewClient: func(c cache.Cache, restConfig *rest.Config, options client.Options, uncachedObjects ...client.Object) (client.Client, error) {
+			cl, err := cluster.DefaultNewClient(c, restConfig, options, uncachedObjects...)
+			if err != nil {
+				return nil, err
+			}
+			return &stateoffload.Client{Client: cl, SizeLimit: cfg.ServiceProviderStateSizeLimit}, nil
+		},
+		// the operator only watches the secrets it creates, there's no need to cache the metadata of all the secrets in
+		// the cluster. The service provider configuration overrides created by the users are read from their own
+		// cache. The secrets created by SPI before it started labeling them are labeled by the ManagedSecretLabeler
+		// (see below).
+		NewCache: cache.BuilderWithOptions(cache.Options{
+			SelectorsByObject: cache.SelectorsByObject{
+				&corev1.Secret{}: {
+					Label: labels.SelectorFromSet(labels.Set{sharedConfig.ManagedSecretLabel: sharedConfig.ManagedSecretLabelValue}),
+				},
+				// only the pods with the readiness gate of the bindings are watched
+				&corev1.Pod{}: {
+					Label: labels.SelectorFromSet(labels.Set{appstudiov1beta1.BindingReadinessGateLabel: "true"}),
+				},
+			},
+		}),
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
-	cfg, err := sharedConfig.LoadFrom(configFile)
+	if cfg.FIPSMode {
+		if err := cfg.ValidateFIPS(); err != nil {
+			setupLog.Error(err, "the configuration cannot be used in the FIPS mode")
+			os.Exit(1)
+		}
+		setupLog.Info("FIPS mode enabled", "fipsBuild", sharedConfig.FIPSBuild)
+	}
+	// the configuration files accepted before the validation existed must keep working, so the invalid configuration is
+	// only reported
+	validationErr := cfg.Validate()
+	if validationErr != nil {
+		setupLog.Error(validationErr, "the configuration is invalid, starting with it anyway")
+	}
+
+	primaryStorage, err := newTokenStorage(cfg.TokenStorage, cfg, mgr.GetClient(), devmode)
 	if err != nil {
-		setupLog.Error(err, "Failed to load the configuration")
+		setupLog.Error(err, "failed to initialize the token storage")
 		os.Exit(1)
 	}
 
-	strg, err := tokenstorage.NewVaultStorage("spi-controller-manager", cfg.VaultHost, cfg.ServiceAccountTokenFilePath, devmode)
+	if migrateTokenStorage {
+		os.Exit(runTokenStorageMigration(cfg, mgr, primaryStorage, devmode))
+	}
+
+	if exportTokens != "" || importTokens != "" {
+		os.Exit(runTokenBackup(cfg, mgr, primaryStorage, devmode, exportTokens, importTokens, backupKeyFile))
+	}
+
+	backingStorage := primaryStorage
+	if cfg.TokenStorageMigrationSource != "" {
+		secondaryStorage, err := newTokenStorage(cfg.TokenStorageMigrationSource, cfg, mgr.GetClient(), devmode)
+		if err != nil {
+			setupLog.Error(err, "failed to initialize the token storage to migrate from")
+			os.Exit(1)
+		}
+		backingStorage = tokenstorage.MigratingTokenStorage{Primary: primaryStorage, Secondary: secondaryStorage}
+		setupLog.Info("token storage migration mode enabled", "from", cfg.TokenStorageMigrationSource, "to", cfg.TokenStorage)
+	}
+
+	// the concurrent reads that miss the cache are coalesced so that they don't hit the backing storage in bursts
+	strg := tokenstorage.NewCachingTokenStorage(&tokenstorage.CoalescingTokenStorage{TokenStorage: backingStorage}, cfg.TokenStorageCacheSize, cfg.TokenStorageCacheTtl)
+
+	overridesCache, err := serviceprovider.NewConfigurationOverridesCache(mgr.GetConfig(), cache.Options{Scheme: mgr.GetScheme(), Mapper: mgr.GetRESTMapper()})
 	if err != nil {
-		setupLog.Error(err, "failed to initialize the token storage")
+		setupLog.Error(err, "failed to create the cache of the service provider configuration overrides")
 		os.Exit(1)
 	}
+	if err = mgr.Add(overridesCache); err != nil {
+		setupLog.Error(err, "failed to add the cache of the service provider configuration overrides to the manager")
+		os.Exit(1)
+	}
+
+	liveCfg := sharedConfig.NewLiveConfiguration(cfg)
+
+	configStatus := &controllers.ConfigurationStatusReporter{Client: mgr.GetClient(), Configuration: liveCfg}
+	reportConfiguration := func(err error) {
+		config.ReportConfigurationReload(err)
+		configStatus.Report(err)
+	}
+	reportConfiguration(validationErr)
+	if err = mgr.Add(configStatus); err != nil {
+		setupLog.Error(err, "failed to set up the configuration status reporting")
+		os.Exit(1)
+	}
+
+	if configReloadInterval > 0 {
+		if err = mgr.Add(&sharedConfig.FileWatcher{
+			Path:     configFile,
+			Interval: configReloadInterval,
+			Target:   liveCfg,
+			OnReload: reportConfiguration,
+		}); err != nil {
+			setupLog.Error(err, "failed to set up the configuration file watch")
+			os.Exit(1)
+		}
+	}
+
+	var writeBackStore writeback.Store
+	if cfg.BindingWriteBackVaultMount != "" {
+		vaultClient, err := tokenstorage.NewVaultClient("spi-controller-manager", cfg.VaultHost, cfg.ServiceAccountTokenFilePath, devmode)
+		if err != nil {
+			setupLog.Error(err, "failed to initialize the Vault client for the binding write-back")
+			os.Exit(1)
+		}
+		writeBackStore = writeback.NewVaultStore(vaultClient, cfg.BindingWriteBackVaultMount)
+		setupLog.Info("binding write-back to Vault enabled", "mount", cfg.BindingWriteBackVaultMount)
+	}
+
+	var stateTransit *oauthstate.VaultTransit
+	if cfg.OAuthStateVaultTransitKey != "" {
+		vaultClient, err := tokenstorage.NewVaultClient("spi-controller-manager", cfg.VaultHost, cfg.ServiceAccountTokenFilePath, devmode)
+		if err != nil {
+			setupLog.Error(err, "failed to initialize the Vault client for the OAuth state signing")
+			os.Exit(1)
+		}
+		stateTransit = &oauthstate.VaultTransit{
+			Client: vaultClient,
+			Mount:  cfg.OAuthStateVaultTransitMount,
+			Key:    cfg.OAuthStateVaultTransitKey,
+		}
+		setupLog.Info("OAuth states signed using the Vault transit key", "mount", cfg.OAuthStateVaultTransitMount, "key", cfg.OAuthStateVaultTransitKey)
+	}
+
+	if err = serviceprovider.RegisterTokenIndexes(context.Background(), mgr.GetFieldIndexer()); err != nil {
+		setupLog.Error(err, "failed to register the token indexes")
+		os.Exit(1)
+	}
+
+	// all the requests to the service providers share the same client so that they are bounded by the same timeout
+	// and guarded against the user-controlled URLs sending the operator into the internal network
+	userAgent := cfg.ProviderUserAgent
+	if userAgent == "" {
+		userAgent = httptransport.UserAgent(version, cfg.ClusterId)
+	}
+	httpClient := &http.Client{
+		Timeout: serviceProviderTimeout,
+		Transport: httptransport.TaggingRoundTripper{
+			RoundTripper: httptransport.GuardingRoundTripper{
+				RoundTripper:    http.DefaultTransport,
+				MaxResponseSize: int64(cfg.ProviderResponseSizeLimit),
+			},
+			UserAgent: userAgent,
+			TagHeader: cfg.ProviderRequestTagHeader,
+		},
+	}
+
+	// the scope translations loaded from the config map are shared by all the service providers
+	scopeTranslations := &serviceprovider.ScopeTranslationTable{}
+
+	var events cloudevents.Emitter
+	if cloudEventsSink != "" {
+		sink := cloudevents.NewHttpSink(cloudEventsSink, "service-provider-integration-operator")
+		if err = mgr.Add(sink); err != nil {
+			setupLog.Error(err, "failed to set up the cloud events sink")
+			os.Exit(1)
+		}
+		events = sink
+		setupLog.Info("sending the cloud events", "sink", cloudEventsSink)
+	}
 
 	if config.RunControllers() {
 		if err = (&controllers.SPIAccessTokenReconciler{
@@ -128,13 +401,17 @@ func main() {
 			Scheme:       mgr.GetScheme(),
 			TokenStorage: strg,
 			ServiceProviderFactory: serviceprovider.Factory{
-				Configuration:    cfg,
-				KubernetesClient: mgr.GetClient(),
-				HttpClient:       http.DefaultClient,
-				Initializers:     serviceproviders.KnownInitializers(),
-				TokenStorage:     strg,
+				Configuration:          liveCfg,
+				KubernetesClient:       mgr.GetClient(),
+				ConfigurationOverrides: overridesCache,
+				HttpClient:             httpClient,
+				Initializers:           serviceproviders.KnownInitializers(),
+				TokenStorage:           strg,
+				ScopeTranslations:      scopeTranslations,
 			},
-			Configuration: cfg,
+			Configuration: liveCfg,
+			Events:        events,
+			StateTransit:  stateTransit,
 		}).SetupWithManager(mgr); err != nil {
 			setupLog.Error(err, "unable to create controller", "controller", "SPIAccessToken")
 			os.Exit(1)
@@ -144,16 +421,67 @@ func main() {
 			Scheme:       mgr.GetScheme(),
 			TokenStorage: strg,
 			ServiceProviderFactory: serviceprovider.Factory{
-				Configuration:    cfg,
-				KubernetesClient: mgr.GetClient(),
-				HttpClient:       http.DefaultClient,
-				Initializers:     serviceproviders.KnownInitializers(),
-				TokenStorage:     strg,
+				Configuration:          liveCfg,
+				KubernetesClient:       mgr.GetClient(),
+				ConfigurationOverrides: overridesCache,
+				HttpClient:             httpClient,
+				Initializers:           serviceproviders.KnownInitializers(),
+				TokenStorage:           strg,
+				ScopeTranslations:      scopeTranslations,
 			},
+			WriteBackStore: writeBackStore,
+			PodDelivery:    enablePodCredentials,
+			Events:         events,
 		}).SetupWithManager(mgr); err != nil {
 			setupLog.Error(err, "unable to create controller", "controller", "SPIAccessTokenBinding")
 			os.Exit(1)
 		}
+		if err = (&controllers.NamespaceCleanupReconciler{
+			Client:       mgr.GetClient(),
+			TokenStorage: strg,
+			ServiceProviderFactory: serviceprovider.Factory{
+				Configuration:          liveCfg,
+				KubernetesClient:       mgr.GetClient(),
+				ConfigurationOverrides: overridesCache,
+				HttpClient:             httpClient,
+				Initializers:           serviceproviders.KnownInitializers(),
+				TokenStorage:           strg,
+				ScopeTranslations:      scopeTranslations,
+			},
+			Configuration:  liveCfg,
+			WriteBackStore: writeBackStore,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "NamespaceCleanup")
+			os.Exit(1)
+		}
+		if err = (&controllers.SPIAccessibilityReportReconciler{
+			Client: mgr.GetClient(),
+			Scheme: mgr.GetScheme(),
+			ServiceProviderFactory: serviceprovider.Factory{
+				Configuration:          liveCfg,
+				KubernetesClient:       mgr.GetClient(),
+				ConfigurationOverrides: overridesCache,
+				HttpClient:             httpClient,
+				Initializers:           serviceproviders.KnownInitializers(),
+				TokenStorage:           strg,
+				ScopeTranslations:      scopeTranslations,
+			},
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "SPIAccessibilityReport")
+			os.Exit(1)
+		}
+		if err = (&controllers.SPIAccessTokenDataUpdateReconciler{
+			Client: mgr.GetClient(),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "SPIAccessTokenDataUpdate")
+			os.Exit(1)
+		}
+		if err = (&controllers.ServiceAccountPullSecretReconciler{
+			Client: mgr.GetClient(),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "ServiceAccountPullSecret")
+			os.Exit(1)
+		}
 	} else {
 		setupLog.Info("CRD controllers inactive")
 	}
@@ -162,19 +490,252 @@ func main() {
 		Client: mgr.GetClient(),
 		Scheme: mgr.GetScheme(),
 		ServiceProviderFactory: serviceprovider.Factory{
-			Configuration:    cfg,
-			KubernetesClient: mgr.GetClient(),
-			HttpClient:       http.DefaultClient,
-			Initializers:     serviceproviders.KnownInitializers(),
-			TokenStorage:     strg,
+			Configuration:          liveCfg,
+			KubernetesClient:       mgr.GetClient(),
+			ConfigurationOverrides: overridesCache,
+			HttpClient:             httpClient,
+			Initializers:           serviceproviders.KnownInitializers(),
+			TokenStorage:           strg,
+			ScopeTranslations:      scopeTranslations,
 		},
-		Configuration: cfg,
+		Configuration: liveCfg,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "SPIAccessCheck")
 		os.Exit(1)
 	}
+	if err = (&controllers.SPIRepositoryDiscoveryReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+		ServiceProviderFactory: serviceprovider.Factory{
+			Configuration:          liveCfg,
+			KubernetesClient:       mgr.GetClient(),
+			ConfigurationOverrides: overridesCache,
+			HttpClient:             httpClient,
+			Initializers:           serviceproviders.KnownInitializers(),
+			TokenStorage:           strg,
+			ScopeTranslations:      scopeTranslations,
+		},
+		Configuration: liveCfg,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "SPIRepositoryDiscovery")
+		os.Exit(1)
+	}
+	if err = (&controllers.SPIAdminOverrideReconciler{
+		Client:       mgr.GetClient(),
+		Scheme:       mgr.GetScheme(),
+		TokenStorage: strg,
+		Recorder:     mgr.GetEventRecorderFor("spi-admin-override"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "SPIAdminOverride")
+		os.Exit(1)
+	}
+	if err = (&controllers.SPISelfTestReconciler{
+		Client:        mgr.GetClient(),
+		Scheme:        mgr.GetScheme(),
+		TokenStorage:  strg,
+		Configuration: liveCfg,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "SPISelfTest")
+		os.Exit(1)
+	}
+	if enableRepositoryWebhooks {
+		if err = (&controllers.SPIRepositoryWebhookReconciler{
+			Client:    mgr.GetClient(),
+			APIReader: mgr.GetAPIReader(),
+			Scheme:    mgr.GetScheme(),
+			ServiceProviderFactory: serviceprovider.Factory{
+				Configuration:          liveCfg,
+				KubernetesClient:       mgr.GetClient(),
+				ConfigurationOverrides: overridesCache,
+				HttpClient:             httpClient,
+				Initializers:           serviceproviders.KnownInitializers(),
+				TokenStorage:           strg,
+				ScopeTranslations:      scopeTranslations,
+			},
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "SPIRepositoryWebhook")
+			os.Exit(1)
+		}
+	}
+	if enablePipelineRunIntegration {
+		if err = (&controllers.PipelineRunReconciler{
+			Client: mgr.GetClient(),
+			Scheme: mgr.GetScheme(),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "PipelineRun")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
+	if enableScopeValidationWebhook {
+		mgr.GetWebhookServer().Register(webhook.ScopeValidatorPath, &crwebhook.Admission{Handler: &webhook.ScopeValidator{
+			ServiceProviderFactory: serviceprovider.Factory{
+				Configuration:          liveCfg,
+				KubernetesClient:       mgr.GetClient(),
+				ConfigurationOverrides: overridesCache,
+				HttpClient:             httpClient,
+				Initializers:           serviceproviders.KnownInitializers(),
+				TokenStorage:           strg,
+				ScopeTranslations:      scopeTranslations,
+			},
+		}})
+	}
+
+	if enableBindingValidationWebhook {
+		mgr.GetWebhookServer().Register(webhook.BindingValidatorPath, &crwebhook.Admission{Handler: &webhook.BindingValidator{
+			ServiceProviderFactory: serviceprovider.Factory{
+				Configuration:          liveCfg,
+				KubernetesClient:       mgr.GetClient(),
+				ConfigurationOverrides: overridesCache,
+				HttpClient:             httpClient,
+				Initializers:           serviceproviders.KnownInitializers(),
+				TokenStorage:           strg,
+				ScopeTranslations:      scopeTranslations,
+			},
+		}})
+	}
+
+	if enableTokenOwnershipWebhook {
+		mgr.GetWebhookServer().Register(webhook.TokenOwnershipPath, &crwebhook.Admission{Handler: &webhook.TokenOwnershipWebhook{
+			Client:        mgr.GetClient(),
+			Configuration: liveCfg,
+		}})
+	}
+
+	if enableTokenDeletionWebhook {
+		mgr.GetWebhookServer().Register(webhook.TokenDeletionValidatorPath, &crwebhook.Admission{Handler: &webhook.TokenDeletionValidator{
+			Client:        mgr.GetClient(),
+			Configuration: liveCfg,
+		}})
+	}
+
+	if enableTokenValidationEndpoint {
+		mgr.GetWebhookServer().Register(webhook.TokenValidationPath, &webhook.TokenValidator{
+			Client: mgr.GetClient(),
+			ServiceProviderFactory: serviceprovider.Factory{
+				Configuration:          liveCfg,
+				KubernetesClient:       mgr.GetClient(),
+				ConfigurationOverrides: overridesCache,
+				HttpClient:             httpClient,
+				Initializers:           serviceproviders.KnownInitializers(),
+				TokenStorage:           strg,
+				ScopeTranslations:      scopeTranslations,
+			},
+		})
+	}
+
+	if enableCredentialsLookup {
+		mgr.GetWebhookServer().Register(webhook.CredentialsLookupPath, &webhook.CredentialsLookupServer{
+			Client:        mgr.GetClient(),
+			Configuration: liveCfg,
+		})
+	}
+
+	if enableOAuthStateInspection {
+		mgr.GetWebhookServer().Register(webhook.OAuthStateInspectionPath, &webhook.OAuthStateInspector{
+			Client:        mgr.GetClient(),
+			Configuration: liveCfg,
+			Transit:       stateTransit,
+		})
+	}
+
+	if enablePodCredentials {
+		var caCert []byte
+		if podCredentialsCAFile != "" {
+			if caCert, err = os.ReadFile(podCredentialsCAFile); err != nil {
+				setupLog.Error(err, "failed to read the CA certificate of the pod credentials endpoint")
+				os.Exit(1)
+			}
+		}
+		mgr.GetWebhookServer().Register(webhook.PodCredentialsPath, &webhook.PodCredentialsServer{
+			Client: mgr.GetClient(),
+			Reader: mgr.GetAPIReader(),
+			Renderer: &controllers.BindingDataRenderer{
+				Client:       mgr.GetClient(),
+				TokenStorage: strg,
+				ServiceProviderFactory: serviceprovider.Factory{
+					Configuration:          liveCfg,
+					KubernetesClient:       mgr.GetClient(),
+					ConfigurationOverrides: overridesCache,
+					HttpClient:             httpClient,
+					Initializers:           serviceproviders.KnownInitializers(),
+					TokenStorage:           strg,
+					ScopeTranslations:      scopeTranslations,
+				},
+			},
+		})
+		mgr.GetWebhookServer().Register(webhook.PodCredentialsInjectorPath, &crwebhook.Admission{Handler: &webhook.PodCredentialsInjector{
+			Image:  podCredentialsImage,
+			Url:    podCredentialsUrl,
+			CACert: string(caCert),
+		}})
+	}
+
+	if enablePullSecretInjection {
+		mgr.GetWebhookServer().Register(webhook.PullSecretInjectorPath, &crwebhook.Admission{Handler: &webhook.PullSecretInjector{
+			Client: mgr.GetClient(),
+		}})
+	}
+
+	if enableBindingReadinessGates {
+		mgr.GetWebhookServer().Register(webhook.BindingReadinessGateInjectorPath, &crwebhook.Admission{Handler: &webhook.BindingReadinessGateInjector{}})
+		if err = (&controllers.BindingReadinessGateReconciler{
+			Client: mgr.GetClient(),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "BindingReadinessGate")
+			os.Exit(1)
+		}
+	}
+
+	if err = mgr.Add(&controllers.ManagedSecretLabeler{
+		Client:    mgr.GetClient(),
+		APIReader: mgr.GetAPIReader(),
+	}); err != nil {
+		setupLog.Error(err, "failed to set up the labeling of the secrets created by SPI")
+		os.Exit(1)
+	}
+
+	if err = mgr.Add(&controllers.ScopeTranslationLoader{
+		Client:        mgr.GetClient(),
+		Configuration: liveCfg,
+		Table:         scopeTranslations,
+		Interval:      time.Minute,
+	}); err != nil {
+		setupLog.Error(err, "failed to set up the loading of the scope translations")
+		os.Exit(1)
+	}
+
+	if err = mgr.Add(&controllers.RateLimitStatusReporter{
+		Client:        mgr.GetClient(),
+		Configuration: liveCfg,
+		RateLimits:    serviceprovider.RateLimits,
+		Interval:      time.Minute,
+	}); err != nil {
+		setupLog.Error(err, "failed to set up the rate limit status reporting")
+		os.Exit(1)
+	}
+
+	if err = mgr.Add(&controllers.EgressReporter{
+		Client:        mgr.GetClient(),
+		Configuration: liveCfg,
+		Initializers:  serviceproviders.KnownInitializers(),
+		Interval:      time.Minute,
+	}); err != nil {
+		setupLog.Error(err, "failed to set up the egress reporting")
+		os.Exit(1)
+	}
+
+	if err = mgr.Add(&controllers.TombstonePurger{
+		Client:        mgr.GetClient(),
+		TokenStorage:  strg,
+		Configuration: liveCfg,
+		Interval:      5 * time.Minute,
+	}); err != nil {
+		setupLog.Error(err, "failed to set up the purging of the data of the deleted tokens")
+		os.Exit(1)
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -190,3 +751,134 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// newTokenStorage creates the token storage of the provided type.
+func newTokenStorage(storageType sharedConfig.TokenStorageType, cfg sharedConfig.Configuration, cl client.Client, devmode bool) (tokenstorage.TokenStorage, error) {
+	switch storageType {
+	case sharedConfig.TokenStorageTypeVault:
+		return tokenstorage.NewVaultStorage("spi-controller-manager", cfg.VaultHost, cfg.ServiceAccountTokenFilePath, devmode, cfg.TokenDataHistorySize, tokenstorage.VaultLayout{
+			Mount:        cfg.VaultTokenMount,
+			KVVersion:    cfg.VaultKVVersion,
+			PathTemplate: cfg.VaultTokenPathTemplate,
+		})
+	case sharedConfig.TokenStorageTypeSecrets:
+		return tokenstorage.NewSecretsStorage(cl, cfg.TokenDataHistorySize)
+	default:
+		return nil, fmt.Errorf("unknown token storage type '%s'", storageType)
+	}
+}
+
+// runTokenStorageMigration copies the token data from the configured migration source to the configured token
+// storage. It uses a non-caching client, because the manager is not started in this mode. Returns the exit code of
+// the process.
+func runTokenStorageMigration(cfg sharedConfig.Configuration, mgr ctrl.Manager, to tokenstorage.TokenStorage, devmode bool) int {
+	lg := ctrl.Log.WithName("migration")
+
+	if cfg.TokenStorageMigrationSource == "" {
+		lg.Error(nil, "tokenStorageMigrationSource is not configured, nothing to migrate from")
+		return 1
+	}
+
+	cl, err := client.New(mgr.GetConfig(), client.Options{Scheme: mgr.GetScheme(), Mapper: mgr.GetRESTMapper()})
+	if err != nil {
+		lg.Error(err, "failed to create the kubernetes client")
+		return 1
+	}
+
+	// the storage needs to be re-created with the non-caching client, if it uses it
+	if cfg.TokenStorage == sharedConfig.TokenStorageTypeSecrets {
+		if to, err = newTokenStorage(cfg.TokenStorage, cfg, cl, devmode); err != nil {
+			lg.Error(err, "failed to initialize the token storage")
+			return 1
+		}
+	}
+
+	from, err := newTokenStorage(cfg.TokenStorageMigrationSource, cfg, cl, devmode)
+	if err != nil {
+		lg.Error(err, "failed to initialize the token storage to migrate from")
+		return 1
+	}
+
+	ctx := log.IntoContext(context.Background(), lg)
+	migrated, err := tokenstorage.Migrate(ctx, cl, from, to)
+	lg.Info("token storage migration finished", "migrated", migrated, "from", cfg.TokenStorageMigrationSource, "to", cfg.TokenStorage)
+	if err != nil {
+		lg.Error(err, "failed to migrate some of the tokens")
+		return 1
+	}
+
+	return 0
+}
+
+// runTokenBackup exports the tokens to the exportFile or imports them from the importFile, whichever is set. Like
+// the token storage migration, it uses a non-caching client, because the manager is not started in this mode. The data
+// imported into the storage is announced using the SPIAccessTokenDataUpdates so that the running operator picks it up.
+// Returns the exit code of the process.
+func runTokenBackup(cfg sharedConfig.Configuration, mgr ctrl.Manager, strg tokenstorage.TokenStorage, devmode bool, exportFile string, importFile string, keyFile string) int {
+	lg := ctrl.Log.WithName("backup")
+
+	if exportFile != "" && importFile != "" {
+		lg.Error(nil, "only one of --export-tokens and --import-tokens can be used at a time")
+		return 1
+	}
+
+	if keyFile == "" {
+		lg.Error(nil, "--backup-key-file is required to export or import the tokens")
+		return 1
+	}
+
+	key, err := os.ReadFile(keyFile)
+	if err != nil {
+		lg.Error(err, "failed to read the backup key")
+		return 1
+	}
+
+	cl, err := client.New(mgr.GetConfig(), client.Options{Scheme: mgr.GetScheme(), Mapper: mgr.GetRESTMapper()})
+	if err != nil {
+		lg.Error(err, "failed to create the kubernetes client")
+		return 1
+	}
+
+	// the storage needs to be re-created with the non-caching client, if it uses it
+	if cfg.TokenStorage == sharedConfig.TokenStorageTypeSecrets {
+		if strg, err = newTokenStorage(cfg.TokenStorage, cfg, cl, devmode); err != nil {
+			lg.Error(err, "failed to initialize the token storage")
+			return 1
+		}
+	}
+
+	ctx := log.IntoContext(context.Background(), lg)
+
+	if exportFile != "" {
+		f, err := os.OpenFile(exportFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			lg.Error(err, "failed to create the backup file")
+			return 1
+		}
+		defer f.Close()
+
+		exported, err := tokenstorage.Export(ctx, cl, strg, key, f)
+		if err != nil {
+			lg.Error(err, "failed to export the tokens")
+			return 1
+		}
+		lg.Info("tokens exported", "exported", exported, "file", exportFile)
+		return 0
+	}
+
+	f, err := os.Open(importFile)
+	if err != nil {
+		lg.Error(err, "failed to open the backup file")
+		return 1
+	}
+	defer f.Close()
+
+	restored, err := tokenstorage.Import(ctx, cl, tokenstorage.NotifyingTokenStorage{Client: cl, TokenStorage: strg}, key, f)
+	lg.Info("tokens imported", "restored", restored, "file", importFile)
+	if err != nil {
+		lg.Error(err, "failed to import some of the tokens")
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,247 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package client contains the helpers for the services consuming SPI. It wraps the controller-runtime client so that
+// the consumers don't need to write the watch loops waiting for the SPI objects to reach the desired state themselves.
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	kuberrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/rest"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	// ErrBindingHasNoSecret is returned by GetBindingSecret if the binding hasn't synced its secret yet.
+	ErrBindingHasNoSecret = errors.New("the binding hasn't synced its secret yet")
+
+	errUnexpectedObjectType = errors.New("unexpected object type in the watch event")
+)
+
+// Client is the controller-runtime client with the helpers for the SPI objects.
+type Client struct {
+	ctrlclient.WithWatch
+}
+
+// NewScheme returns a scheme with the SPI types and the core Kubernetes types registered.
+func NewScheme() (*runtime.Scheme, error) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		return nil, fmt.Errorf("failed to add the core types to the scheme: %w", err)
+	}
+	if err := api.AddToScheme(scheme); err != nil {
+		return nil, fmt.Errorf("failed to add the SPI types to the scheme: %w", err)
+	}
+	return scheme, nil
+}
+
+// New creates a new client connected to the cluster using the provided configuration.
+func New(cfg *rest.Config) (*Client, error) {
+	scheme, err := NewScheme()
+	if err != nil {
+		return nil, err
+	}
+
+	cl, err := ctrlclient.NewWithWatch(cfg, ctrlclient.Options{Scheme: scheme})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the client: %w", err)
+	}
+
+	return &Client{WithWatch: cl}, nil
+}
+
+// WaitForToken waits until the token with the provided key satisfies the condition. The token doesn't need to exist
+// when this is called. Returns the token in the state that satisfied the condition, or the error returned from
+// the condition, or the error of the context if it is done sooner.
+func (c *Client) WaitForToken(ctx context.Context, key ctrlclient.ObjectKey, condition func(*api.SPIAccessToken) (bool, error)) (*api.SPIAccessToken, error) {
+	token := &api.SPIAccessToken{}
+	err := c.waitFor(ctx, key, token, &api.SPIAccessTokenList{}, func(obj ctrlclient.Object) (bool, error) {
+		t, ok := obj.(*api.SPIAccessToken)
+		if !ok {
+			return false, errUnexpectedObjectType
+		}
+		token = t
+		return condition(t)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// WaitForTokenReady waits until the token with the provided key is in the Ready phase.
+func (c *Client) WaitForTokenReady(ctx context.Context, key ctrlclient.ObjectKey) (*api.SPIAccessToken, error) {
+	return c.WaitForToken(ctx, key, func(token *api.SPIAccessToken) (bool, error) {
+		return token.Status.Phase == api.SPIAccessTokenPhaseReady, nil
+	})
+}
+
+// WaitForBinding waits until the binding with the provided key satisfies the condition. The binding doesn't need to
+// exist when this is called. Returns the binding in the state that satisfied the condition, or the error returned
+// from the condition, or the error of the context if it is done sooner.
+func (c *Client) WaitForBinding(ctx context.Context, key ctrlclient.ObjectKey, condition func(*api.SPIAccessTokenBinding) (bool, error)) (*api.SPIAccessTokenBinding, error) {
+	binding := &api.SPIAccessTokenBinding{}
+	err := c.waitFor(ctx, key, binding, &api.SPIAccessTokenBindingList{}, func(obj ctrlclient.Object) (bool, error) {
+		b, ok := obj.(*api.SPIAccessTokenBinding)
+		if !ok {
+			return false, errUnexpectedObjectType
+		}
+		binding = b
+		return condition(b)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return binding, nil
+}
+
+// WaitForBindingInjected waits until the binding with the provided key has injected its secret. Note that the bindings
+// in the Error phase are still waited for, because they may recover once e.g. the user provides the token data.
+func (c *Client) WaitForBindingInjected(ctx context.Context, key ctrlclient.ObjectKey) (*api.SPIAccessTokenBinding, error) {
+	return c.WaitForBinding(ctx, key, func(binding *api.SPIAccessTokenBinding) (bool, error) {
+		return binding.Status.Phase == api.SPIAccessTokenBindingPhaseInjected && binding.Status.SyncedObjectRef.Name != "", nil
+	})
+}
+
+// EnsureBinding creates the binding if it doesn't exist or updates its spec, labels and annotations to match
+// the provided binding if it does. Returns the binding as stored in the cluster.
+func (c *Client) EnsureBinding(ctx context.Context, binding *api.SPIAccessTokenBinding) (*api.SPIAccessTokenBinding, error) {
+	existing := &api.SPIAccessTokenBinding{}
+	if err := c.Get(ctx, ctrlclient.ObjectKeyFromObject(binding), existing); err != nil {
+		if !kuberrors.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to get the binding: %w", err)
+		}
+
+		created := binding.DeepCopy()
+		if err := c.Create(ctx, created); err != nil {
+			return nil, fmt.Errorf("failed to create the binding: %w", err)
+		}
+		return created, nil
+	}
+
+	changed := false
+	if !equality.Semantic.DeepEqual(existing.Spec, binding.Spec) {
+		existing.Spec = binding.Spec
+		changed = true
+	}
+	changed = mergeInto(&existing.Labels, binding.Labels) || changed
+	changed = mergeInto(&existing.Annotations, binding.Annotations) || changed
+
+	if changed {
+		if err := c.Update(ctx, existing); err != nil {
+			return nil, fmt.Errorf("failed to update the binding: %w", err)
+		}
+	}
+
+	return existing, nil
+}
+
+// GetBindingSecret returns the secret synced by the binding. Returns ErrBindingHasNoSecret if the binding hasn't synced
+// any secret yet.
+func (c *Client) GetBindingSecret(ctx context.Context, binding *api.SPIAccessTokenBinding) (*corev1.Secret, error) {
+	ref := binding.Status.SyncedObjectRef
+	if ref.Name == "" || ref.Kind != "Secret" {
+		return nil, ErrBindingHasNoSecret
+	}
+
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, ctrlclient.ObjectKey{Name: ref.Name, Namespace: binding.Namespace}, secret); err != nil {
+		return nil, fmt.Errorf("failed to get the secret of the binding: %w", err)
+	}
+	return secret, nil
+}
+
+// waitFor watches the object with the provided key until the condition is satisfied. The watch is established before
+// the object is read for the first time so that no change can be missed in between.
+func (c *Client) waitFor(ctx context.Context, key ctrlclient.ObjectKey, obj ctrlclient.Object, list ctrlclient.ObjectList, condition func(ctrlclient.Object) (bool, error)) error {
+	for {
+		w, err := c.Watch(ctx, list, ctrlclient.InNamespace(key.Namespace), ctrlclient.MatchingFields{"metadata.name": key.Name})
+		if err != nil {
+			return fmt.Errorf("failed to watch the object %s: %w", key, err)
+		}
+
+		done, err := c.checkCurrent(ctx, key, obj, condition)
+		if err != nil || done {
+			w.Stop()
+			return err
+		}
+
+		done, err = consumeEvents(ctx, w, key, condition)
+		w.Stop()
+		if err != nil || done {
+			return err
+		}
+		// the watch was closed by the server, let's start a new one
+	}
+}
+
+func (c *Client) checkCurrent(ctx context.Context, key ctrlclient.ObjectKey, obj ctrlclient.Object, condition func(ctrlclient.Object) (bool, error)) (bool, error) {
+	if err := c.Get(ctx, key, obj); err != nil {
+		if kuberrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get the object %s: %w", key, err)
+	}
+	return condition(obj)
+}
+
+// consumeEvents evaluates the condition on the objects received from the watch. Returns false without an error if
+// the watch was closed before the condition was satisfied.
+func consumeEvents(ctx context.Context, w watch.Interface, key ctrlclient.ObjectKey, condition func(ctrlclient.Object) (bool, error)) (bool, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return false, fmt.Errorf("gave up waiting for the object %s: %w", key, ctx.Err())
+		case e, ok := <-w.ResultChan():
+			if !ok {
+				return false, nil
+			}
+			if e.Type != watch.Added && e.Type != watch.Modified {
+				continue
+			}
+			obj, ok := e.Object.(ctrlclient.Object)
+			if !ok || obj.GetName() != key.Name || obj.GetNamespace() != key.Namespace {
+				continue
+			}
+			if done, err := condition(obj); err != nil || done {
+				return done, err
+			}
+		}
+	}
+}
+
+// mergeInto adds the values to the target map and returns true if the target changed.
+func mergeInto(target *map[string]string, values map[string]string) bool {
+	changed := false
+	for k, v := range values {
+		if cur, ok := (*target)[k]; ok && cur == v {
+			continue
+		}
+		if *target == nil {
+			*target = map[string]string{}
+		}
+		(*target)[k] = v
+		changed = true
+	}
+	return changed
+}
@@ -0,0 +1,146 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newTestClient(t *testing.T, objs ...ctrlclient.Object) *Client {
+	scheme, err := NewScheme()
+	assert.NoError(t, err)
+	return &Client{WithWatch: fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()}
+}
+
+func TestWaitForTokenReady(t *testing.T) {
+	key := ctrlclient.ObjectKey{Name: "token", Namespace: "ns"}
+
+	t.Run("already ready", func(t *testing.T) {
+		cl := newTestClient(t, &api.SPIAccessToken{
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			Status:     api.SPIAccessTokenStatus{Phase: api.SPIAccessTokenPhaseReady},
+		})
+
+		token, err := cl.WaitForTokenReady(context.TODO(), key)
+		assert.NoError(t, err)
+		assert.Equal(t, api.SPIAccessTokenPhaseReady, token.Status.Phase)
+	})
+
+	t.Run("becomes ready", func(t *testing.T) {
+		cl := newTestClient(t)
+		ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Second)
+		defer cancel()
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			token := &api.SPIAccessToken{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+			assert.NoError(t, cl.Create(ctx, token))
+			token.Status.Phase = api.SPIAccessTokenPhaseReady
+			assert.NoError(t, cl.Update(ctx, token))
+		}()
+
+		token, err := cl.WaitForTokenReady(ctx, key)
+		assert.NoError(t, err)
+		assert.Equal(t, api.SPIAccessTokenPhaseReady, token.Status.Phase)
+	})
+
+	t.Run("times out", func(t *testing.T) {
+		cl := newTestClient(t, &api.SPIAccessToken{
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			Status:     api.SPIAccessTokenStatus{Phase: api.SPIAccessTokenPhaseAwaitingTokenData},
+		})
+		ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+		defer cancel()
+
+		token, err := cl.WaitForTokenReady(ctx, key)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Nil(t, token)
+	})
+}
+
+func TestWaitForBindingInjected(t *testing.T) {
+	key := ctrlclient.ObjectKey{Name: "binding", Namespace: "ns"}
+	cl := newTestClient(t, &api.SPIAccessTokenBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+		Status:     api.SPIAccessTokenBindingStatus{Phase: api.SPIAccessTokenBindingPhaseAwaitingTokenData},
+	})
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Second)
+	defer cancel()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		binding := &api.SPIAccessTokenBinding{}
+		assert.NoError(t, cl.Get(ctx, key, binding))
+		binding.Status.Phase = api.SPIAccessTokenBindingPhaseInjected
+		binding.Status.SyncedObjectRef = api.TargetObjectRef{Name: "secret", Kind: "Secret", ApiVersion: "v1"}
+		assert.NoError(t, cl.Update(ctx, binding))
+	}()
+
+	binding, err := cl.WaitForBindingInjected(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", binding.Status.SyncedObjectRef.Name)
+}
+
+func TestEnsureBinding(t *testing.T) {
+	cl := newTestClient(t)
+	binding := &api.SPIAccessTokenBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "binding", Namespace: "ns", Labels: map[string]string{"app": "a"}},
+		Spec: api.SPIAccessTokenBindingSpec{
+			RepoUrl: "https://github.com/acme/repo",
+			Secret:  api.SecretSpec{Type: corev1.SecretTypeBasicAuth},
+		},
+	}
+
+	created, err := cl.EnsureBinding(context.TODO(), binding)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://github.com/acme/repo", created.Spec.RepoUrl)
+
+	binding.Spec.RepoUrl = "https://github.com/acme/other"
+	binding.Labels = map[string]string{"team": "t"}
+	updated, err := cl.EnsureBinding(context.TODO(), binding)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://github.com/acme/other", updated.Spec.RepoUrl)
+	assert.Equal(t, map[string]string{"app": "a", "team": "t"}, updated.Labels)
+
+	stored := &api.SPIAccessTokenBinding{}
+	assert.NoError(t, cl.Get(context.TODO(), ctrlclient.ObjectKeyFromObject(binding), stored))
+	assert.Equal(t, "https://github.com/acme/other", stored.Spec.RepoUrl)
+
+	unchanged, err := cl.EnsureBinding(context.TODO(), binding)
+	assert.NoError(t, err)
+	assert.Equal(t, stored.ResourceVersion, unchanged.ResourceVersion)
+}
+
+func TestGetBindingSecret(t *testing.T) {
+	cl := newTestClient(t, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "ns"}})
+	binding := &api.SPIAccessTokenBinding{ObjectMeta: metav1.ObjectMeta{Name: "binding", Namespace: "ns"}}
+
+	_, err := cl.GetBindingSecret(context.TODO(), binding)
+	assert.ErrorIs(t, err, ErrBindingHasNoSecret)
+
+	binding.Status.SyncedObjectRef = api.TargetObjectRef{Name: "secret", Kind: "Secret", ApiVersion: "v1"}
+	secret, err := cl.GetBindingSecret(context.TODO(), binding)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", secret.Name)
+}
@@ -0,0 +1,192 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudevents
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// The types of the events emitted by the operator.
+const (
+	// TokenReady is emitted when the token becomes Ready.
+	TokenReady = "com.redhat.appstudio.spi.token.ready"
+	// TokenInvalid is emitted when the service provider rejects the data of the token.
+	TokenInvalid = "com.redhat.appstudio.spi.token.invalid"
+	// TokenOAuthCompleted is emitted when the token waiting for its data gets it. The operator cannot tell the data
+	// obtained by the OAuth flow from the uploaded data, so the event is emitted for both.
+	TokenOAuthCompleted = "com.redhat.appstudio.spi.token.oauth.completed"
+	// BindingSecretSynced is emitted when the binding gets Injected, i.e. its secret is synced.
+	BindingSecretSynced = "com.redhat.appstudio.spi.binding.secret.synced"
+)
+
+// queueSize is the number of the events waiting to be sent above which the new events are dropped.
+const queueSize = 1000
+
+// sendAttempts is the number of the attempts to deliver an event to the sink.
+const sendAttempts = 3
+
+// Event is a notification about a change of an SPI object.
+type Event struct {
+	// Type is one of the event types above.
+	Type string
+	// Data describes the object the event is about.
+	Data ObjectData
+}
+
+// ObjectData is the data of the events. It is serialized as JSON.
+type ObjectData struct {
+	Kind      string    `json:"kind"`
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	UID       types.UID `json:"uid"`
+	Phase     string    `json:"phase,omitempty"`
+	// ServiceProviderUrl is the URL of the service provider of the token.
+	ServiceProviderUrl string `json:"serviceProviderUrl,omitempty"`
+	// SecretName is the name of the secret synced by the binding.
+	SecretName string `json:"secretName,omitempty"`
+	// Message describes the reason of the event, e.g. why the token is invalid.
+	Message string `json:"message,omitempty"`
+}
+
+// Emitter emits the events. The emitting must not block, so that the reconciliations are not slowed down by
+// the consumers of the events.
+type Emitter interface {
+	Emit(ctx context.Context, event Event)
+}
+
+// HttpSink is the Emitter sending the events as CloudEvents in the binary content mode to the HTTP sink at the Url.
+// The events are sent in the background, once the sink is started by the manager. The events that cannot be delivered
+// are only logged.
+type HttpSink struct {
+	// Url is the URL the events are POSTed to.
+	Url string
+	// Source is the source of the CloudEvents, identifying the operator instance.
+	Source string
+	// Client is the HTTP client used to send the events.
+	Client *http.Client
+	// RetryDelay is the delay before the first retry of a failed delivery, doubled for each subsequent retry.
+	RetryDelay time.Duration
+
+	queue chan Event
+}
+
+var _ Emitter = (*HttpSink)(nil)
+
+// NewHttpSink returns a new HttpSink sending the events to the provided URL.
+func NewHttpSink(url string, source string) *HttpSink {
+	return &HttpSink{
+		Url:        url,
+		Source:     source,
+		Client:     &http.Client{Timeout: 10 * time.Second},
+		RetryDelay: time.Second,
+		queue:      make(chan Event, queueSize),
+	}
+}
+
+// Emit queues the event for sending. The event is dropped if the queue is full.
+func (s *HttpSink) Emit(ctx context.Context, event Event) {
+	select {
+	case s.queue <- event:
+	default:
+		log.FromContext(ctx).Info("dropping the cloud event because too many events are waiting to be sent", "type", event.Type, "object", event.Data.Namespace+"/"+event.Data.Name)
+	}
+}
+
+// Start sends the queued events until the context is done. It implements the manager.Runnable.
+func (s *HttpSink) Start(ctx context.Context) error {
+	lg := log.FromContext(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-s.queue:
+			if err := s.deliver(ctx, event); err != nil {
+				lg.Error(err, "failed to deliver the cloud event", "type", event.Type, "object", event.Data.Namespace+"/"+event.Data.Name)
+			}
+		}
+	}
+}
+
+// NeedLeaderElection implements the manager.LeaderElectionRunnable. The events are only emitted by the controllers
+// running in the leader, but the sink has nothing to do otherwise, so it can run in all the replicas.
+func (s *HttpSink) NeedLeaderElection() bool {
+	return false
+}
+
+// deliver sends the event, retrying the failed attempts with an exponential backoff.
+func (s *HttpSink) deliver(ctx context.Context, event Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return fmt.Errorf("failed to serialize the event data: %w", err)
+	}
+
+	// the retries of the same event must have the same id so that the consumers can recognize the duplicates
+	id := string(uuid.NewUUID())
+	eventTime := time.Now().UTC().Format(time.RFC3339Nano)
+
+	delay := s.RetryDelay
+	for attempt := 1; ; attempt++ {
+		err = s.send(ctx, id, eventTime, event, data)
+		if err == nil || attempt == sendAttempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func (s *HttpSink) send(ctx context.Context, id string, eventTime string, event Event, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.Url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create the request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("ce-specversion", "1.0")
+	req.Header.Set("ce-id", id)
+	req.Header.Set("ce-source", s.Source)
+	req.Header.Set("ce-type", event.Type)
+	req.Header.Set("ce-subject", event.Data.Namespace+"/"+event.Data.Name)
+	req.Header.Set("ce-time", eventTime)
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send the event: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.FromContext(ctx).Error(err, "failed to close the body of the cloud event response")
+		}
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("the sink responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudevents
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHttpSink(t *testing.T) {
+	lock := sync.Mutex{}
+	var requests []*http.Request
+	var bodies []ObjectData
+	failures := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		data, _ := io.ReadAll(r.Body)
+		body := ObjectData{}
+		assert.NoError(t, json.Unmarshal(data, &body))
+		requests = append(requests, r)
+		bodies = append(bodies, body)
+
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	sink := NewHttpSink(server.URL, "spi")
+	sink.RetryDelay = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	go func() {
+		assert.NoError(t, sink.Start(ctx))
+	}()
+
+	sink.Emit(ctx, Event{Type: TokenReady, Data: ObjectData{Kind: "SPIAccessToken", Namespace: "ns", Name: "token", Phase: "Ready"}})
+
+	assert.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(requests) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	// the retry is the same event
+	assert.Equal(t, requests[0].Header.Get("ce-id"), requests[1].Header.Get("ce-id"))
+	assert.Equal(t, bodies[0], bodies[1])
+
+	req := requests[1]
+	assert.Equal(t, http.MethodPost, req.Method)
+	assert.Equal(t, "1.0", req.Header.Get("ce-specversion"))
+	assert.NotEmpty(t, req.Header.Get("ce-id"))
+	assert.NotEmpty(t, req.Header.Get("ce-time"))
+	assert.Equal(t, "spi", req.Header.Get("ce-source"))
+	assert.Equal(t, TokenReady, req.Header.Get("ce-type"))
+	assert.Equal(t, "ns/token", req.Header.Get("ce-subject"))
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	assert.Equal(t, ObjectData{Kind: "SPIAccessToken", Namespace: "ns", Name: "token", Phase: "Ready"}, bodies[1])
+}
+
+func TestHttpSink_Emit_DoesNotBlock(t *testing.T) {
+	sink := NewHttpSink("http://localhost", "spi")
+
+	// the sink is not started, so nothing consumes the queue
+	for i := 0; i < queueSize+10; i++ {
+		sink.Emit(context.TODO(), Event{Type: TokenReady})
+	}
+
+	assert.Len(t, sink.queue, queueSize)
+}
+
+func TestHttpSink_GivesUp(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	sink := NewHttpSink(server.URL, "spi")
+	sink.RetryDelay = time.Millisecond
+
+	assert.Error(t, sink.deliver(context.TODO(), Event{Type: TokenInvalid}))
+	assert.Equal(t, sendAttempts, attempts)
+}
@@ -0,0 +1,44 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// configurationValid reports whether the last change of the configuration file was successfully applied. The operator
+// keeps running with the previous configuration if it was not, so this is the way to find out about the problem
+// (apart from the logs).
+var configurationValid = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "spi_configuration_valid",
+	Help: "Whether the last change of the configuration file was successfully applied (1) or not (0).",
+})
+
+func init() {
+	configurationValid.Set(1)
+	metrics.Registry.MustRegister(configurationValid)
+}
+
+// ReportConfigurationReload records the result of the validation of the configuration at startup or of the reload of
+// the configuration file in the metrics. It is meant to be used as the OnReload function of the configuration file
+// watcher.
+func ReportConfigurationReload(err error) {
+	if err != nil {
+		configurationValid.Set(0)
+	} else {
+		configurationValid.Set(1)
+	}
+}
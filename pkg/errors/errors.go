@@ -15,10 +15,12 @@
 package errors
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 )
 
 type ServiceProviderError struct {
@@ -39,6 +41,44 @@ func (e ServiceProviderError) Error() string {
 	return fmt.Sprintf("%s (http status %d): %s", identification, e.StatusCode, e.Response)
 }
 
+// Details extracts the error message and the link to the documentation of the error from the response of the service
+// provider. It understands the JSON error responses of GitHub ("message" and "documentation_url") and Quay
+// ("error_message" or "detail"). If the response is not in any of these formats, the whole response is returned as
+// the message.
+func (e ServiceProviderError) Details() (message string, documentationUrl string) {
+	response := struct {
+		Message          string `json:"message"`
+		DocumentationUrl string `json:"documentation_url"`
+		ErrorMessage     string `json:"error_message"`
+		Detail           string `json:"detail"`
+	}{}
+
+	if err := json.Unmarshal([]byte(e.Response), &response); err != nil {
+		return strings.TrimSpace(e.Response), ""
+	}
+
+	switch {
+	case response.Message != "":
+		message = response.Message
+	case response.ErrorMessage != "":
+		message = response.ErrorMessage
+	default:
+		message = response.Detail
+	}
+
+	return message, response.DocumentationUrl
+}
+
+// AsServiceProviderError returns the ServiceProviderError in the chain of the provided error, if any.
+func AsServiceProviderError(err error) (*ServiceProviderError, bool) {
+	spe := &ServiceProviderError{}
+	if !errors.As(err, &spe) {
+		return nil, false
+	}
+
+	return spe, true
+}
+
 func IsServiceProviderError(err error) bool {
 	spe := &ServiceProviderError{}
 	return errors.As(err, &spe)
@@ -83,3 +123,20 @@ func FromHttpResponse(response *http.Response) error {
 
 	return nil
 }
+
+// OAuthNotConfiguredError is returned when a URL belongs to a supported service provider for which there is no OAuth
+// application configured in SPI. Only the administrator can fix this by adding the OAuth application to the SPI
+// configuration.
+type OAuthNotConfiguredError struct {
+	ServiceProviderType string
+	ServiceProviderUrl  string
+}
+
+func (e OAuthNotConfiguredError) Error() string {
+	return fmt.Sprintf("there is no OAuth application configured for the %s service provider at %s. The administrator needs to add it to the SPI configuration", e.ServiceProviderType, e.ServiceProviderUrl)
+}
+
+func IsOAuthNotConfigured(err error) bool {
+	onc := &OAuthNotConfiguredError{}
+	return errors.As(err, &onc)
+}
@@ -72,6 +72,13 @@ func TestChecks(t *testing.T) {
 	assert.False(t, IsInternalServerError(invalidAccessToken))
 	assert.False(t, IsInternalServerError(nestedInvalidAccessToken))
 	assert.False(t, IsInternalServerError(fmt.Errorf("huh")))
+
+	oauthNotConfigured := &OAuthNotConfiguredError{ServiceProviderType: "GitHub", ServiceProviderUrl: "https://github.com"}
+	assert.True(t, IsOAuthNotConfigured(oauthNotConfigured))
+	assert.True(t, IsOAuthNotConfigured(&nestingError{oauthNotConfigured}))
+	assert.False(t, IsOAuthNotConfigured(invalidAccessToken))
+	assert.False(t, IsOAuthNotConfigured(fmt.Errorf("huh")))
+	assert.False(t, IsServiceProviderError(oauthNotConfigured))
 }
 
 func TestConversion(t *testing.T) {
@@ -107,3 +114,36 @@ func TestFromHttpResponse(t *testing.T) {
 	err := FromHttpResponse(&resp)
 	assert.Equal(t, "invalid access token (http status 401): an error", err.Error())
 }
+
+func TestServiceProviderError_Details(t *testing.T) {
+	test := func(response string, expectedMessage string, expectedDocUrl string) {
+		msg, docUrl := ServiceProviderError{StatusCode: 403, Response: response}.Details()
+		assert.Equal(t, expectedMessage, msg)
+		assert.Equal(t, expectedDocUrl, docUrl)
+	}
+
+	t.Run("github", func(t *testing.T) {
+		test(`{"message": "API rate limit exceeded", "documentation_url": "https://docs.github.com/rate-limiting"}`,
+			"API rate limit exceeded", "https://docs.github.com/rate-limiting")
+	})
+
+	t.Run("quay", func(t *testing.T) {
+		test(`{"error_message": "Unauthorized", "detail": "Unauthorized", "error_type": "insufficient_scope"}`, "Unauthorized", "")
+		test(`{"detail": "Not Found", "status": 404}`, "Not Found", "")
+	})
+
+	t.Run("plain text", func(t *testing.T) {
+		test("Forbidden\n", "Forbidden", "")
+	})
+}
+
+func TestAsServiceProviderError(t *testing.T) {
+	spe := &ServiceProviderError{StatusCode: 404}
+
+	extracted, ok := AsServiceProviderError(&nestingError{spe})
+	assert.True(t, ok)
+	assert.Equal(t, 404, extracted.StatusCode)
+
+	_, ok = AsServiceProviderError(fmt.Errorf("huh"))
+	assert.False(t, ok)
+}
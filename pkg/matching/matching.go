@@ -0,0 +1,175 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package matching exposes the logic the operator uses to match the SPIAccessTokens to the SPIAccessTokenBindings
+// so that it can be used without a cluster and without contacting the service providers.
+package matching
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceproviders"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+)
+
+// Result is the result of matching a token against a binding.
+type Result struct {
+	// Matches is true if the token satisfies the requirements of the binding.
+	Matches bool
+	// Reason explains why the token doesn't match. It is empty if the token matches.
+	Reason string
+}
+
+// Match decides whether the provided token would be matched to the provided binding by the operator. The repository
+// URL of the binding needs to belong to the service provider of the token and the permissions of the token need to
+// cover the permissions required by the binding.
+//
+// The service provider of the repository is determined the same way the operator does it, using the provided service
+// provider configurations in their order. That is the only way to recognize the repositories of the service providers
+// without any well-known base URL, like Kubernetes. The URLs not belonging to any configured service provider are
+// examined by the probes of all the known service providers, so the configurations can be omitted for the service
+// providers with the well-known base URLs.
+//
+// Only the metadata cached in the status of the token is used, so the token needs to be in the Ready phase with its
+// metadata filled in. Note that the operator refreshes the metadata from the service provider, so the result of
+// the matching in the cluster might differ if the cached metadata is stale.
+func Match(ctx context.Context, serviceProviders []config.ServiceProviderConfiguration, binding *api.SPIAccessTokenBinding, token *api.SPIAccessToken) (Result, error) {
+	return MatchWith(ctx, serviceproviders.KnownInitializers(), serviceProviders, binding, token)
+}
+
+// MatchWith is like Match but uses the provided service provider initializers instead of the known ones.
+func MatchWith(ctx context.Context, initializers map[config.ServiceProviderType]serviceprovider.Initializer, serviceProviders []config.ServiceProviderConfiguration, binding *api.SPIAccessTokenBinding, token *api.SPIAccessToken) (Result, error) {
+	spType, baseUrl, initializer := findServiceProvider(initializers, serviceProviders, binding.Spec.RepoUrl)
+	if initializer == nil {
+		return Result{}, fmt.Errorf("could not determine service provider for url: %s", binding.Spec.RepoUrl)
+	}
+
+	if strings.TrimSuffix(token.Spec.ServiceProviderUrl, "/") != strings.TrimSuffix(baseUrl, "/") {
+		return mismatch("the token is for a different service provider (%s) than the repository (%s)", token.Spec.ServiceProviderUrl, baseUrl), nil
+	}
+
+	if token.Status.Phase != api.SPIAccessTokenPhaseReady {
+		return mismatch("the token is not ready, it is in the %s phase", token.Status.Phase), nil
+	}
+
+	if token.Status.TokenMetadata == nil {
+		return mismatch("the token has no metadata"), nil
+	}
+
+	if initializer.OfflineTokenFilter == nil {
+		return Result{}, fmt.Errorf("the %s service provider doesn't support offline matching", spType)
+	}
+
+	ok, err := initializer.OfflineTokenFilter.Matches(ctx, binding, token)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if !ok {
+		return mismatch("the token doesn't have the permissions required by the binding for the repository %s", binding.Spec.RepoUrl), nil
+	}
+
+	return Result{Matches: true}, nil
+}
+
+// findServiceProvider finds the service provider of the repository. The configured service providers are examined first in
+// the order of their configurations and then the probes of all the service providers in the order of their types, so
+// that the result is deterministic even if more than one of them recognizes the URL.
+func findServiceProvider(initializers map[config.ServiceProviderType]serviceprovider.Initializer, serviceProviders []config.ServiceProviderConfiguration, repoUrl string) (config.ServiceProviderType, string, *serviceprovider.Initializer) {
+	for _, spc := range serviceProviders {
+		initializer, ok := initializers[spc.ServiceProviderType]
+		if !ok {
+			continue
+		}
+
+		if baseUrl := examine(initializer.ProbeFor(spc.ServiceProviderBaseUrl), repoUrl); baseUrl != "" {
+			return spc.ServiceProviderType, baseUrl, &initializer
+		}
+	}
+
+	spTypes := make([]config.ServiceProviderType, 0, len(initializers))
+	for spType := range initializers {
+		spTypes = append(spTypes, spType)
+	}
+	sort.Slice(spTypes, func(i, j int) bool {
+		return spTypes[i] < spTypes[j]
+	})
+
+	for _, spType := range spTypes {
+		initializer := initializers[spType]
+		if baseUrl := examine(initializer.Probe, repoUrl); baseUrl != "" {
+			return spType, baseUrl, &initializer
+		}
+	}
+
+	return "", "", nil
+}
+
+// examine returns the base URL of the service provider if the probe recognizes the repository URL or an empty string
+// otherwise.
+func examine(probe serviceprovider.Probe, repoUrl string) string {
+	if probe == nil {
+		return ""
+	}
+
+	// the probes are given no http client so that they cannot contact the service provider
+	baseUrl, err := probe.Examine(nil, repoUrl)
+	if err != nil {
+		return ""
+	}
+	return baseUrl
+}
+
+func mismatch(format string, args ...interface{}) Result {
+	return Result{Reason: fmt.Sprintf(format, args...)}
+}
+
+// MigrateState migrates the ServiceProviderState in the metadata of the token to the current version of the state of
+// its service provider. The service provider is determined from the service provider URL of the token the same way Match
+// determines it from the repository URL. The returned bool is true if the state changed and the token needs to be
+// persisted.
+func MigrateState(serviceProviders []config.ServiceProviderConfiguration, token *api.SPIAccessToken) (bool, error) {
+	return MigrateStateWith(serviceproviders.KnownInitializers(), serviceProviders, token)
+}
+
+// MigrateStateWith is like MigrateState but uses the provided service provider initializers instead of the known ones.
+func MigrateStateWith(initializers map[config.ServiceProviderType]serviceprovider.Initializer, serviceProviders []config.ServiceProviderConfiguration, token *api.SPIAccessToken) (bool, error) {
+	if token.Status.TokenMetadata == nil || len(token.Status.TokenMetadata.ServiceProviderState) == 0 {
+		return false, nil
+	}
+
+	spType, _, initializer := findServiceProvider(initializers, serviceProviders, token.Spec.ServiceProviderUrl)
+	if initializer == nil {
+		return false, fmt.Errorf("could not determine service provider for url: %s", token.Spec.ServiceProviderUrl)
+	}
+
+	if initializer.StateSchema == nil {
+		return false, nil
+	}
+
+	migrated, changed, err := initializer.StateSchema.Migrate(token.Status.TokenMetadata.ServiceProviderState)
+	if err != nil {
+		return false, fmt.Errorf("failed to migrate the state of the %s service provider: %w", spType, err)
+	}
+
+	if changed {
+		token.Status.TokenMetadata.ServiceProviderState = migrated
+	}
+	return changed, nil
+}
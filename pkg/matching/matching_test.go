@@ -0,0 +1,192 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package matching
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func githubBinding(repoUrl string, permType api.PermissionType) *api.SPIAccessTokenBinding {
+	return &api.SPIAccessTokenBinding{
+		Spec: api.SPIAccessTokenBindingSpec{
+			RepoUrl: repoUrl,
+			Permissions: api.Permissions{
+				Required: []api.Permission{{Type: permType, Area: api.PermissionAreaRepository}},
+			},
+		},
+	}
+}
+
+func githubToken(state string) *api.SPIAccessToken {
+	return &api.SPIAccessToken{
+		Spec: api.SPIAccessTokenSpec{
+			ServiceProviderUrl: "https://github.com",
+		},
+		Status: api.SPIAccessTokenStatus{
+			Phase: api.SPIAccessTokenPhaseReady,
+			TokenMetadata: &api.TokenMetadata{
+				Username:             "alois",
+				Scopes:               []string{"repo"},
+				ServiceProviderState: []byte(state),
+			},
+		},
+	}
+}
+
+func TestMatch(t *testing.T) {
+	state := `{"AccessibleRepos": {"https://github.com/acme/app": {"viewerPermission": "READ"}}}`
+
+	t.Run("matches", func(t *testing.T) {
+		res, err := Match(context.TODO(), nil, githubBinding("https://github.com/acme/app", api.PermissionTypeRead), githubToken(state))
+		assert.NoError(t, err)
+		assert.True(t, res.Matches)
+		assert.Empty(t, res.Reason)
+	})
+
+	t.Run("insufficient permissions", func(t *testing.T) {
+		token := githubToken(state)
+		token.Status.TokenMetadata.Scopes = []string{"read:user"}
+
+		res, err := Match(context.TODO(), nil, githubBinding("https://github.com/acme/app", api.PermissionTypeRead), token)
+		assert.NoError(t, err)
+		assert.False(t, res.Matches)
+		assert.Contains(t, res.Reason, "permissions")
+	})
+
+	t.Run("inaccessible repository", func(t *testing.T) {
+		res, err := Match(context.TODO(), nil, githubBinding("https://github.com/acme/other", api.PermissionTypeRead), githubToken(state))
+		assert.NoError(t, err)
+		assert.False(t, res.Matches)
+	})
+
+	t.Run("different service provider", func(t *testing.T) {
+		token := githubToken(state)
+		token.Spec.ServiceProviderUrl = "https://quay.io"
+
+		res, err := Match(context.TODO(), nil, githubBinding("https://github.com/acme/app", api.PermissionTypeRead), token)
+		assert.NoError(t, err)
+		assert.False(t, res.Matches)
+		assert.Contains(t, res.Reason, "different service provider")
+	})
+
+	t.Run("token not ready", func(t *testing.T) {
+		token := githubToken(state)
+		token.Status.Phase = api.SPIAccessTokenPhaseAwaitingTokenData
+
+		res, err := Match(context.TODO(), nil, githubBinding("https://github.com/acme/app", api.PermissionTypeRead), token)
+		assert.NoError(t, err)
+		assert.False(t, res.Matches)
+		assert.Contains(t, res.Reason, "not ready")
+	})
+
+	t.Run("unknown service provider", func(t *testing.T) {
+		_, err := Match(context.TODO(), nil, githubBinding("https://acme.com/acme/app", api.PermissionTypeRead), githubToken(state))
+		assert.Error(t, err)
+	})
+
+	t.Run("quay", func(t *testing.T) {
+		binding := githubBinding("quay.io/acme/app", api.PermissionTypeRead)
+		token := githubToken(`{"Repositories": {"acme/app": {"PossessedScopes": ["repo:read"]}}, "Organizations": {}}`)
+		token.Spec.ServiceProviderUrl = "https://quay.io"
+
+		res, err := Match(context.TODO(), nil, binding, token)
+		assert.NoError(t, err)
+		assert.True(t, res.Matches)
+
+		binding = githubBinding("quay.io/acme/other", api.PermissionTypeRead)
+		res, err = Match(context.TODO(), nil, binding, token)
+		assert.NoError(t, err)
+		assert.False(t, res.Matches)
+	})
+
+	t.Run("kubernetes by the configured base url", func(t *testing.T) {
+		binding := githubBinding("https://api.cluster.acme.com/api/v1/namespaces/default", api.PermissionTypeRead)
+		token := githubToken("")
+		token.Spec.ServiceProviderUrl = "https://api.cluster.acme.com"
+		serviceProviders := []config.ServiceProviderConfiguration{{
+			ServiceProviderType:    config.ServiceProviderTypeKubernetes,
+			ServiceProviderBaseUrl: "https://api.cluster.acme.com/",
+		}}
+
+		res, err := Match(context.TODO(), serviceProviders, binding, token)
+		assert.NoError(t, err)
+		assert.True(t, res.Matches)
+
+		_, err = Match(context.TODO(), nil, binding, token)
+		assert.Error(t, err)
+	})
+}
+
+func TestFindServiceProviderIsDeterministic(t *testing.T) {
+	probe := func(baseUrl string) serviceprovider.Probe {
+		return serviceprovider.ProbeFunc(func(_ *http.Client, _ string) (string, error) {
+			return baseUrl, nil
+		})
+	}
+	initializers := map[config.ServiceProviderType]serviceprovider.Initializer{
+		"C": {Probe: probe("https://c.com")},
+		"A": {Probe: probe("https://a.com")},
+		"B": {Probe: probe("https://b.com")},
+	}
+
+	for i := 0; i < 20; i++ {
+		spType, baseUrl, _ := findServiceProvider(initializers, nil, "https://acme.com/repo")
+		assert.Equal(t, config.ServiceProviderType("A"), spType)
+		assert.Equal(t, "https://a.com", baseUrl)
+	}
+
+	// the configured service providers take precedence in the order of their configurations
+	spType, _, _ := findServiceProvider(initializers, []config.ServiceProviderConfiguration{{ServiceProviderType: "B"}, {ServiceProviderType: "A"}}, "https://acme.com/repo")
+	assert.Equal(t, config.ServiceProviderType("B"), spType)
+}
+
+func TestMigrateState(t *testing.T) {
+	t.Run("wraps the legacy state", func(t *testing.T) {
+		token := githubToken(`{"AccessibleRepos":{}}`)
+
+		changed, err := MigrateState(nil, token)
+		assert.NoError(t, err)
+		assert.True(t, changed)
+		assert.JSONEq(t, `{"version":1,"state":{"AccessibleRepos":{}}}`, string(token.Status.TokenMetadata.ServiceProviderState))
+
+		changed, err = MigrateState(nil, token)
+		assert.NoError(t, err)
+		assert.False(t, changed)
+	})
+
+	t.Run("no state", func(t *testing.T) {
+		token := githubToken("")
+		token.Status.TokenMetadata = nil
+
+		changed, err := MigrateState(nil, token)
+		assert.NoError(t, err)
+		assert.False(t, changed)
+	})
+
+	t.Run("unknown service provider", func(t *testing.T) {
+		token := githubToken(`{}`)
+		token.Spec.ServiceProviderUrl = "https://unknown.example"
+
+		_, err := MigrateState(nil, token)
+		assert.Error(t, err)
+	})
+}
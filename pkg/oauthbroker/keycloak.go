@@ -0,0 +1,142 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauthbroker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+)
+
+// tokenExchangeGrantType is the grant type of the OAuth 2.0 token exchange (RFC 8693).
+const tokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+// ErrNotLinked is returned by Keycloak.Exchange when the user has not linked their account in the service provider to
+// their Keycloak account yet.
+var ErrNotLinked = errors.New("the user has not linked the account in the service provider in Keycloak")
+
+// Keycloak obtains the tokens of the service providers from the identity providers of a Keycloak (or RHSSO) realm. It
+// uses the token exchange on behalf of the users, so the Keycloak client needs to be permitted to impersonate the users
+// and to exchange the tokens of the identity providers. The identity providers need to store the tokens.
+type Keycloak struct {
+	HttpClient *http.Client
+	// Url is the base URL of Keycloak, without the trailing slash.
+	Url          string
+	Realm        string
+	ClientId     string
+	ClientSecret string
+}
+
+// FromConfiguration returns the Keycloak configured as the OAuth broker in the configuration or nil if the OAuth flows
+// are not brokered.
+func FromConfiguration(cfg config.Configuration, cl *http.Client) *Keycloak {
+	if cfg.OAuthBrokerUrl == "" {
+		return nil
+	}
+
+	return &Keycloak{
+		HttpClient:   cl,
+		Url:          cfg.OAuthBrokerUrl,
+		Realm:        cfg.OAuthBrokerRealm,
+		ClientId:     cfg.OAuthBrokerClientId,
+		ClientSecret: cfg.OAuthBrokerClientSecret,
+	}
+}
+
+// exchangeResponse is the response of the token endpoint of Keycloak to the token exchange. The error and
+// the account link URL are only present in the failed responses.
+type exchangeResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+	AccountLinkUrl   string `json:"account-link-url"`
+}
+
+// LinkedAccountsUrl returns the URL of the page of the Keycloak account console on which the users link their accounts
+// in the service providers.
+func (k *Keycloak) LinkedAccountsUrl() string {
+	return k.realmUrl() + "/account/#/security/linked-accounts"
+}
+
+// Exchange obtains the token the identity provider with the provided alias stored for the Keycloak user with
+// the provided username. Returns ErrNotLinked if the user has not linked their account in the identity provider yet.
+func (k *Keycloak) Exchange(ctx context.Context, username string, identityProvider string) (*api.Token, error) {
+	form := url.Values{
+		"grant_type":        {tokenExchangeGrantType},
+		"client_id":         {k.ClientId},
+		"client_secret":     {k.ClientSecret},
+		"requested_subject": {username},
+		"requested_issuer":  {identityProvider},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, k.realmUrl()+"/protocol/openid-connect/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the token exchange request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := k.HttpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange the token in Keycloak: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the token exchange response: %w", err)
+	}
+
+	exchanged := exchangeResponse{}
+	if err := json.Unmarshal(body, &exchanged); err != nil {
+		return nil, fmt.Errorf("failed to parse the token exchange response with status %d: %w", resp.StatusCode, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		if exchanged.AccountLinkUrl != "" || exchanged.Error == "not_linked" {
+			return nil, ErrNotLinked
+		}
+		return nil, fmt.Errorf("the token exchange failed with status %d: %s: %s", resp.StatusCode, exchanged.Error, exchanged.ErrorDescription)
+	}
+
+	if exchanged.AccessToken == "" {
+		return nil, fmt.Errorf("the token exchange response contains no access token")
+	}
+
+	token := &api.Token{
+		AccessToken: exchanged.AccessToken,
+		TokenType:   exchanged.TokenType,
+	}
+	if exchanged.ExpiresIn > 0 {
+		token.Expiry = uint64(time.Now().Add(time.Duration(exchanged.ExpiresIn) * time.Second).Unix())
+	}
+
+	return token, nil
+}
+
+func (k *Keycloak) realmUrl() string {
+	return k.Url + "/realms/" + url.PathEscape(k.Realm)
+}
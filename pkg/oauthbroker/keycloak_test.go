@@ -0,0 +1,94 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauthbroker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromConfiguration(t *testing.T) {
+	assert.Nil(t, FromConfiguration(config.Configuration{}, http.DefaultClient))
+
+	k := FromConfiguration(config.Configuration{
+		OAuthBrokerUrl:          "https://sso.example.com/auth",
+		OAuthBrokerRealm:        "acme",
+		OAuthBrokerClientId:     "spi",
+		OAuthBrokerClientSecret: "secret",
+	}, http.DefaultClient)
+	if assert.NotNil(t, k) {
+		assert.Equal(t, "spi", k.ClientId)
+		assert.Equal(t, "https://sso.example.com/auth/realms/acme/account/#/security/linked-accounts", k.LinkedAccountsUrl())
+	}
+}
+
+func TestExchange(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/realms/acme/protocol/openid-connect/token" || r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, tokenExchangeGrantType, r.PostForm.Get("grant_type"))
+		assert.Equal(t, "spi", r.PostForm.Get("client_id"))
+		assert.Equal(t, "secret", r.PostForm.Get("client_secret"))
+		assert.Equal(t, "github", r.PostForm.Get("requested_issuer"))
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.PostForm.Get("requested_subject") {
+		case "alois":
+			_, _ = w.Write([]byte(`{"access_token":"gho_token","token_type":"bearer","expires_in":3600}`))
+		case "bob":
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"not_linked","error_description":"User is not linked","account-link-url":"https://sso.example.com/link"}`))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"error":"access_denied","error_description":"Client not allowed to exchange"}`))
+		}
+	}))
+	defer server.Close()
+
+	k := &Keycloak{HttpClient: server.Client(), Url: server.URL, Realm: "acme", ClientId: "spi", ClientSecret: "secret"}
+
+	t.Run("linked", func(t *testing.T) {
+		token, err := k.Exchange(context.TODO(), "alois", "github")
+		assert.NoError(t, err)
+		if assert.NotNil(t, token) {
+			assert.Equal(t, "gho_token", token.AccessToken)
+			assert.Equal(t, "bearer", token.TokenType)
+			assert.InDelta(t, time.Now().Add(time.Hour).Unix(), int64(token.Expiry), 5)
+		}
+	})
+
+	t.Run("not linked", func(t *testing.T) {
+		token, err := k.Exchange(context.TODO(), "bob", "github")
+		assert.ErrorIs(t, err, ErrNotLinked)
+		assert.Nil(t, token)
+	})
+
+	t.Run("denied", func(t *testing.T) {
+		token, err := k.Exchange(context.TODO(), "carol", "github")
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, ErrNotLinked)
+		assert.Contains(t, err.Error(), "access_denied")
+		assert.Nil(t, token)
+	})
+}
@@ -17,10 +17,16 @@ limitations under the License.
 package serviceprovider
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/url"
 	"strconv"
 	"strings"
 
 	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"gopkg.in/yaml.v3"
 	corev1 "k8s.io/api/core/v1"
 )
 
@@ -35,6 +41,19 @@ type AccessTokenMapper struct {
 	UserId                  string   `json:"userId"`
 	ExpiredAfter            *uint64  `json:"expiredAfter"`
 	Scopes                  []string `json:"scopes"`
+	// CosignPassword and CosignPublicKey are put in the secrets of the sigstore.dev/cosign type together with
+	// the cosign key in the Token.
+	CosignPassword  string `json:"-"`
+	CosignPublicKey string `json:"-"`
+	// RegistryUrl is the URL of the npm registry, the Python package index or the Helm chart repository configured
+	// in the secrets of the npmjs.com/npmrc, pypa.io/pip and helm.sh/repository types.
+	RegistryUrl string `json:"-"`
+	// MavenServerId is the id of the server in the secrets of the maven.apache.org/settings type.
+	MavenServerId string `json:"-"`
+	// HelmRepositoryName is the name of the chart repository in the secrets of the helm.sh/repository type.
+	HelmRepositoryName string `json:"-"`
+	// BasicAuth is true if the Token is a password to be used together with the ServiceProviderUserName.
+	BasicAuth bool `json:"-"`
 }
 
 // ToSecretType converts the data in the mapper to a map with fields corresponding to the provided secret type.
@@ -52,6 +71,57 @@ func (at AccessTokenMapper) ToSecretType(secretType corev1.SecretType) map[strin
 		ret[corev1.DockerConfigJsonKey] = at.Token
 	case corev1.SecretTypeSSHAuth:
 		ret[corev1.SSHAuthPrivateKey] = at.Token
+	case api.SecretTypeCosign:
+		ret[api.CosignPrivateKeyKey] = at.Token
+		// cosign reads the password even if the key is not encrypted, so it is always present
+		ret[api.CosignPasswordKey] = at.CosignPassword
+		if at.CosignPublicKey != "" {
+			ret[api.CosignPublicKeyKey] = at.CosignPublicKey
+		}
+	case api.SecretTypeSigstoreOIDCToken:
+		ret[api.SigstoreOIDCTokenKey] = at.Token
+	case api.SecretTypeNpmrc:
+		ret[api.NpmrcKey] = at.npmrc()
+	case api.SecretTypeMavenSettings:
+		ret[api.MavenSettingsKey] = at.mavenSettings()
+	case api.SecretTypePip:
+		indexUrl := at.pipIndexUrl()
+		ret[api.PipIndexUrlKey] = indexUrl
+		ret[api.PipConfKey] = fmt.Sprintf("[global]\nindex-url = %s\n", indexUrl)
+	case api.SecretTypeHelmRepository:
+		if strings.HasPrefix(at.RegistryUrl, "oci://") {
+			ret[api.HelmRegistryConfigKey] = at.helmRegistryConfig()
+		} else {
+			ret[api.HelmRepositoriesKey] = at.helmRepositories()
+		}
+	}
+
+	return ret
+}
+
+// envKeyGroups are the prefixes of the names of the keys produced by ToEnv for the service providers that are not
+// git service providers.
+var envKeyGroups = map[api.ServiceProviderType]string{
+	api.ServiceProviderTypeQuay:       "REGISTRY_",
+	api.ServiceProviderTypeNexus:      "REGISTRY_",
+	api.ServiceProviderTypeKubernetes: "KUBE_",
+}
+
+// ToEnv converts the data in the mapper to a map with the keys named like environment variables of the provided
+// service provider type, each prefixed with the provided prefix. The image registries also get the docker "auth"
+// value in the REGISTRY_AUTH key, so that it doesn't need to be encoded in the scripts.
+func (at AccessTokenMapper) ToEnv(spType api.ServiceProviderType, prefix string) map[string]string {
+	group, ok := envKeyGroups[spType]
+	if !ok {
+		group = "GIT_"
+	}
+
+	ret := map[string]string{
+		prefix + group + "USERNAME": at.ServiceProviderUserName,
+		prefix + group + "TOKEN":    at.Token,
+	}
+	if group == "REGISTRY_" {
+		ret[prefix+group+"AUTH"] = base64.StdEncoding.EncodeToString([]byte(at.ServiceProviderUserName + ":" + at.Token))
 	}
 
 	return ret
@@ -92,3 +162,117 @@ func (at AccessTokenMapper) FillByMapping(mapping *api.TokenFieldMapping, existi
 		existingMap[mapping.UserId] = at.UserId
 	}
 }
+
+// npmrc renders the npm configuration using the registry at the RegistryUrl. npm looks up the credentials by
+// the registry URL without the scheme, which must end with a slash. The passwords are sent using the basic
+// authentication, the other tokens as bearer tokens.
+func (at AccessTokenMapper) npmrc() string {
+	registryUrl := at.RegistryUrl
+	if !strings.HasSuffix(registryUrl, "/") {
+		registryUrl += "/"
+	}
+
+	authPrefix := registryUrl
+	if u, err := url.Parse(registryUrl); err == nil && u.Host != "" {
+		authPrefix = "//" + u.Host + u.Path
+	}
+
+	var auth string
+	if at.BasicAuth {
+		auth = fmt.Sprintf("%s:_auth=%s", authPrefix, base64.StdEncoding.EncodeToString([]byte(at.ServiceProviderUserName+":"+at.Token)))
+	} else {
+		auth = fmt.Sprintf("%s:_authToken=%s", authPrefix, at.Token)
+	}
+
+	return fmt.Sprintf("registry=%s\n%s\n", registryUrl, auth)
+}
+
+type mavenSettings struct {
+	XMLName xml.Name      `xml:"settings"`
+	Xmlns   string        `xml:"xmlns,attr"`
+	Servers []mavenServer `xml:"servers>server"`
+}
+
+type mavenServer struct {
+	Id       string `xml:"id"`
+	Username string `xml:"username"`
+	Password string `xml:"password"`
+}
+
+// mavenSettings renders the Maven settings with the credentials of the server with the MavenServerId. The settings
+// can either be used directly or the server can be copied into the existing settings of the build.
+func (at AccessTokenMapper) mavenSettings() string {
+	settings := mavenSettings{
+		Xmlns:   "http://maven.apache.org/SETTINGS/1.0.0",
+		Servers: []mavenServer{{Id: at.MavenServerId, Username: at.ServiceProviderUserName, Password: at.Token}},
+	}
+
+	// the marshalling cannot fail for the plain strings
+	data, _ := xml.MarshalIndent(settings, "", "  ")
+	return xml.Header + string(data) + "\n"
+}
+
+// pipIndexUrl returns the RegistryUrl with the credentials. pip only supports the basic authentication, so the tokens
+// without any username use the __token__ username, as expected by PyPI and the other indexes supporting the API
+// tokens.
+func (at AccessTokenMapper) pipIndexUrl() string {
+	indexUrl, err := url.Parse(at.RegistryUrl)
+	if err != nil || indexUrl.Host == "" {
+		return at.RegistryUrl
+	}
+
+	username := at.ServiceProviderUserName
+	if username == "" {
+		username = "__token__"
+	}
+	indexUrl.User = url.UserPassword(username, at.Token)
+
+	return indexUrl.String()
+}
+
+type helmRepositories struct {
+	ApiVersion   string           `yaml:"apiVersion"`
+	Repositories []helmRepository `yaml:"repositories"`
+}
+
+type helmRepository struct {
+	Name     string `yaml:"name"`
+	Url      string `yaml:"url"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// helmRepositories renders the Helm repository configuration (as in the repositories.yaml managed by "helm repo add")
+// with the single repository at the RegistryUrl named HelmRepositoryName. Use it with "helm --repository-config".
+func (at AccessTokenMapper) helmRepositories() string {
+	repos := helmRepositories{
+		ApiVersion: "v1",
+		Repositories: []helmRepository{{
+			Name:     at.HelmRepositoryName,
+			Url:      at.RegistryUrl,
+			Username: at.ServiceProviderUserName,
+			Password: at.Token,
+		}},
+	}
+
+	// the marshalling cannot fail for the plain strings
+	data, _ := yaml.Marshal(repos)
+	return string(data)
+}
+
+// helmRegistryConfig renders the Helm registry configuration (as in the config.json managed by "helm registry login")
+// with the credentials of the host of the OCI RegistryUrl. Use it with "helm --registry-config". The format is
+// the same as the docker configuration.
+func (at AccessTokenMapper) helmRegistryConfig() string {
+	host := strings.TrimPrefix(at.RegistryUrl, "oci://")
+	if i := strings.Index(host, "/"); i >= 0 {
+		host = host[:i]
+	}
+
+	auth := base64.StdEncoding.EncodeToString([]byte(at.ServiceProviderUserName + ":" + at.Token))
+	config := map[string]map[string]map[string]string{"auths": {host: {"auth": auth}}}
+
+	// the marshalling cannot fail for the plain strings
+	data, _ := json.Marshal(config)
+	return string(data)
+}
@@ -19,9 +19,45 @@ import (
 	"time"
 
 	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/statusupdate"
+	"golang.org/x/sync/singleflight"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// metadataRefreshes makes sure that there is at most 1 refresh of the metadata of a single token in progress at any
+// time. The metadata caches are created together with the service providers for each reconciliation, so this needs
+// to be shared by all of them.
+var metadataRefreshes singleflight.Group
+
+// metadataRefreshTimeout limits the duration of a single refresh of the metadata. The refreshes are not cancelled
+// together with the context of the caller that started them, because other callers may be waiting for their results.
+const metadataRefreshTimeout = 1 * time.Minute
+
+// detachedContext carries the values of the parent context, but not its deadline and cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+var _ context.Context = detachedContext{}
+
+func (c detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (c detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (c detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
 // MetadataExpirationPolicy is responsible for the decision whether the metadata of a token should be refreshed or whether
 // they are still considered valid.
 type MetadataExpirationPolicy interface {
@@ -76,13 +112,25 @@ func NewMetadataCache(client client.Client, expirationPolicy MetadataExpirationP
 	}
 }
 
-// Persist assigns the last refresh time of the token metadata and updates the token
+// Persist assigns the last refresh time of the token metadata and updates the token. If the token has been updated
+// in the meantime, the metadata are applied to the latest version of the token.
 func (c *MetadataCache) Persist(ctx context.Context, token *api.SPIAccessToken) error {
 	if token.Status.TokenMetadata != nil {
 		token.Status.TokenMetadata.LastRefreshTime = time.Now().Unix()
 	}
 
-	return c.client.Status().Update(ctx, token)
+	metadata := token.Status.TokenMetadata
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		err := statusupdate.Apply(ctx, c.client, token)
+		if errors.IsConflict(err) {
+			if gerr := c.client.Get(ctx, client.ObjectKeyFromObject(token), token); gerr != nil {
+				return gerr
+			}
+			token.Status.TokenMetadata = metadata
+		}
+		return err
+	})
 }
 
 // refresh checks if the token's metadata is still valid. If it is stale, the metadata is cleared
@@ -105,22 +153,58 @@ func (c *MetadataCache) Ensure(ctx context.Context, token *api.SPIAccessToken, s
 	c.refresh(token)
 
 	if token.Status.TokenMetadata == nil {
-		data, err := ser.Fetch(ctx, token)
-		if err != nil {
-			return err
+		// the token controller and the lookups of many bindings can try to refresh the metadata of the same token
+		// concurrently. Only one of them does the actual work, the rest just use its results.
+		key := client.ObjectKeyFromObject(token).String() + "/" + string(token.UID)
+		// the refresh works on its own copy of the token, because the caller that started it may stop waiting for it.
+		refreshed := token.DeepCopy()
+		started := false
+		results := metadataRefreshes.DoChan(key, func() (interface{}, error) {
+			started = true
+			refreshCtx, cancel := context.WithTimeout(detachedContext{parent: ctx}, metadataRefreshTimeout)
+			defer cancel()
+			return c.fetchAndPersist(refreshCtx, refreshed, ser, wasPresent)
+		})
+
+		var res singleflight.Result
+		select {
+		case res = <-results:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if res.Err != nil {
+			return res.Err
 		}
 
-		// we persist in 3 cases:
-		// 1) there was metadata but is not there anymore (wasPresent == true, metadata == nil)
-		// 2) the metadata was (potentially) changed (wasPresent == true, metadata = ?)
-		// 3) the metadata is newly available (wasPresent == false, metadata != nil)
-		token.Status.TokenMetadata = data
-		if wasPresent || token.Status.TokenMetadata != nil {
-			if err := c.Persist(ctx, token); err != nil {
-				return err
-			}
+		if started {
+			refreshed.DeepCopyInto(token)
+		} else {
+			// the token object of the caller that did the work is already updated, so this is only needed for the others
+			token.Status.TokenMetadata = res.Val.(*api.TokenMetadata).DeepCopy()
 		}
 	}
 
 	return nil
 }
+
+// fetchAndPersist fetches the metadata of the token from the service provider and persists them in the status of
+// the token if needed. Returns the metadata set on the token.
+func (c *MetadataCache) fetchAndPersist(ctx context.Context, token *api.SPIAccessToken, ser MetadataProvider, wasPresent bool) (*api.TokenMetadata, error) {
+	data, err := ser.Fetch(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	// we persist in 3 cases:
+	// 1) there was metadata but is not there anymore (wasPresent == true, metadata == nil)
+	// 2) the metadata was (potentially) changed (wasPresent == true, metadata = ?)
+	// 3) the metadata is newly available (wasPresent == false, metadata != nil)
+	token.Status.TokenMetadata = data
+	if wasPresent || token.Status.TokenMetadata != nil {
+		if err := c.Persist(ctx, token); err != nil {
+			return nil, err
+		}
+	}
+
+	return token.Status.TokenMetadata, nil
+}
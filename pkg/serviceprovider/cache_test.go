@@ -16,10 +16,13 @@ package serviceprovider
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/statusupdate"
 	"github.com/stretchr/testify/assert"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -95,13 +98,13 @@ func TestMetadataCache_Persist(t *testing.T) {
 	sch := runtime.NewScheme()
 	utilruntime.Must(corev1.AddToScheme(sch))
 	utilruntime.Must(api.AddToScheme(sch))
-	cl := fake.NewClientBuilder().WithScheme(sch).WithObjects(&api.SPIAccessToken{
+	cl := statusupdate.FakeApplyClient{Client: fake.NewClientBuilder().WithScheme(sch).WithObjects(&api.SPIAccessToken{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      "test-token",
 			Namespace: "default",
 		},
 		Status: api.SPIAccessTokenStatus{},
-	}).Build()
+	}).Build()}
 
 	t.Run("works with nil metadata", func(t *testing.T) {
 		token := &api.SPIAccessToken{}
@@ -127,13 +130,32 @@ func TestMetadataCache_Persist(t *testing.T) {
 		assert.NotNil(t, token.Status.TokenMetadata)
 		assert.True(t, token.Status.TokenMetadata.LastRefreshTime > lastRefresh)
 	})
+	t.Run("retries on conflict", func(t *testing.T) {
+		stale := &api.SPIAccessToken{}
+		assert.NoError(t, cl.Get(context.TODO(), client.ObjectKey{Name: "test-token", Namespace: "default"}, stale))
+
+		// update the token behind the back of the stale copy
+		current := stale.DeepCopy()
+		current.Status.ErrorMessage = "concurrent update"
+		assert.NoError(t, cl.Status().Update(context.TODO(), current))
+
+		stale.Status.TokenMetadata = &api.TokenMetadata{UserId: "42"}
+
+		mc := NewMetadataCache(cl, &TtlMetadataExpirationPolicy{Ttl: 1 * time.Hour})
+		assert.NoError(t, mc.Persist(context.TODO(), stale))
+
+		token := &api.SPIAccessToken{}
+		assert.NoError(t, cl.Get(context.TODO(), client.ObjectKey{Name: "test-token", Namespace: "default"}, token))
+		assert.Equal(t, "42", token.Status.TokenMetadata.UserId)
+		assert.Equal(t, "concurrent update", token.Status.ErrorMessage)
+	})
 }
 
 func TestMetadataCache_Ensure(t *testing.T) {
 	sch := runtime.NewScheme()
 	utilruntime.Must(corev1.AddToScheme(sch))
 	utilruntime.Must(api.AddToScheme(sch))
-	cl := fake.NewClientBuilder().WithScheme(sch).Build()
+	cl := statusupdate.FakeApplyClient{Client: fake.NewClientBuilder().WithScheme(sch).Build()}
 
 	t.Run("no re-fetch when valid", func(t *testing.T) {
 		lastRefresh := time.Now()
@@ -221,4 +243,92 @@ func TestMetadataCache_Ensure(t *testing.T) {
 		assert.NoError(t, cl.Get(context.TODO(), client.ObjectKeyFromObject(token), token))
 		assert.Nil(t, token.Status.TokenMetadata)
 	})
+	t.Run("single fetch for concurrent refreshes", func(t *testing.T) {
+		token := &api.SPIAccessToken{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-token-concurrent",
+				Namespace: "default",
+			},
+		}
+		assert.NoError(t, cl.Create(context.TODO(), token))
+
+		var fetches int32
+		release := make(chan struct{})
+		provider := MetadataProviderFunc(func(ctx context.Context, token *api.SPIAccessToken) (*api.TokenMetadata, error) {
+			atomic.AddInt32(&fetches, 1)
+			<-release
+			return &api.TokenMetadata{UserId: "42"}, nil
+		})
+
+		mc := NewMetadataCache(cl, &TtlMetadataExpirationPolicy{Ttl: 1 * time.Hour})
+
+		wg := sync.WaitGroup{}
+		tokens := make([]*api.SPIAccessToken, 5)
+		for i := range tokens {
+			tokens[i] = token.DeepCopy()
+			wg.Add(1)
+			go func(tkn *api.SPIAccessToken) {
+				defer wg.Done()
+				assert.NoError(t, mc.Ensure(context.TODO(), tkn, provider))
+			}(tokens[i])
+		}
+
+		// give the goroutines the chance to pile up on the refresh in progress
+		time.Sleep(100 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+		for _, tkn := range tokens {
+			assert.NotNil(t, tkn.Status.TokenMetadata)
+			assert.Equal(t, "42", tkn.Status.TokenMetadata.UserId)
+		}
+	})
+}
+
+func TestMetadataCache_EnsureCancelledCaller(t *testing.T) {
+	sch := runtime.NewScheme()
+	utilruntime.Must(corev1.AddToScheme(sch))
+	utilruntime.Must(api.AddToScheme(sch))
+	token := &api.SPIAccessToken{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-token",
+			Namespace: "default",
+			UID:       "cancelled-caller",
+		},
+	}
+	cl := statusupdate.FakeApplyClient{Client: fake.NewClientBuilder().WithScheme(sch).WithObjects(token).Build()}
+	cache := NewMetadataCache(cl, &TtlMetadataExpirationPolicy{Ttl: 1 * time.Hour})
+
+	fetchStarted := make(chan struct{})
+	startedOnce := sync.Once{}
+	release := make(chan struct{})
+	provider := MetadataProviderFunc(func(ctx context.Context, token *api.SPIAccessToken) (*api.TokenMetadata, error) {
+		startedOnce.Do(func() { close(fetchStarted) })
+		<-release
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return &api.TokenMetadata{UserId: "42"}, nil
+	})
+
+	firstCtx, cancelFirst := context.WithCancel(context.TODO())
+	firstDone := make(chan error)
+	go func() {
+		firstDone <- cache.Ensure(firstCtx, token.DeepCopy(), provider)
+	}()
+	<-fetchStarted
+
+	secondToken := token.DeepCopy()
+	secondDone := make(chan error)
+	go func() {
+		secondDone <- cache.Ensure(context.TODO(), secondToken, provider)
+	}()
+
+	cancelFirst()
+	assert.ErrorIs(t, <-firstDone, context.Canceled)
+
+	close(release)
+	assert.NoError(t, <-secondDone)
+	assert.Equal(t, "42", secondToken.Status.TokenMetadata.UserId)
 }
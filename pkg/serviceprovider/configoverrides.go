@@ -0,0 +1,61 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serviceprovider
+
+import (
+	"fmt"
+
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// ConfigurationOverridesCache is the cache of the secrets with the service provider configuration overrides. It is
+// meant to be used as the Factory.ConfigurationOverrides so that the overrides are not read from the cluster each time
+// a service provider is looked up. The cache needs to be added to the manager to be started.
+type ConfigurationOverridesCache struct {
+	cache.Cache
+}
+
+var _ manager.LeaderElectionRunnable = (*ConfigurationOverridesCache)(nil)
+
+// NewConfigurationOverridesCache creates a cache containing only the secrets labeled as the service provider
+// configuration overrides. The scheme and the REST mapper in the options are used as is, the selectors are replaced.
+func NewConfigurationOverridesCache(cfg *rest.Config, opts cache.Options) (*ConfigurationOverridesCache, error) {
+	overrideLabel, err := labels.NewRequirement(config.ServiceProviderConfigurationLabel, selection.Exists, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the selector of the configuration overrides: %w", err)
+	}
+
+	opts.SelectorsByObject = cache.SelectorsByObject{
+		&corev1.Secret{}: {Label: labels.NewSelector().Add(*overrideLabel)},
+	}
+
+	c, err := cache.New(cfg, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the cache of the configuration overrides: %w", err)
+	}
+
+	return &ConfigurationOverridesCache{Cache: c}, nil
+}
+
+// NeedLeaderElection returns false, because the overrides are also needed by the webhooks running in all replicas.
+func (c *ConfigurationOverridesCache) NeedLeaderElection() bool {
+	return false
+}
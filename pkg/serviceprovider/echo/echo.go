@@ -0,0 +1,160 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package echo implements the service provider that accepts any credentials and never contacts anything. It exists
+// so that the operator can be tested end to end (see SPISelfTest) without any real service provider.
+package echo
+
+import (
+	"context"
+	"fmt"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/tokenstorage"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ serviceprovider.ServiceProvider = (*Echo)(nil)
+
+// Echo is the service provider accepting any non-empty credentials. The base URL only identifies the service provider
+// and is never contacted, so any URL not used by other service providers works, e.g. https://echo.spi.invalid. The user
+// of the credentials is their username (or "echo" for the access tokens) and the tokens match all the repositories
+// under the base URL with any permissions.
+type Echo struct {
+	lookup  serviceprovider.GenericLookup
+	baseUrl string
+}
+
+var Initializer = serviceprovider.Initializer{
+	Constructor:           serviceprovider.ConstructorFunc(newEcho),
+	OfflineTokenFilter:    &tokenFilter{},
+	ConfiguredBaseUrlOnly: true,
+	NoNetworkAccess:       true,
+}
+
+func newEcho(factory *serviceprovider.Factory, baseUrl string) (serviceprovider.ServiceProvider, error) {
+	cfg := factory.Configuration.Get()
+	cache := serviceprovider.NewMetadataCache(factory.KubernetesClient, &serviceprovider.TtlMetadataExpirationPolicy{Ttl: cfg.TokenLookupCacheTtl})
+
+	return &Echo{
+		lookup: serviceprovider.GenericLookup{
+			ServiceProviderType: api.ServiceProviderTypeEcho,
+			TokenFilter:         &tokenFilter{},
+			MetadataProvider:    &metadataProvider{tokenStorage: factory.TokenStorage},
+			MetadataCache:       &cache,
+			RepoHostParser:      serviceprovider.RepoHostParserFunc(serviceprovider.RepoHostFromUrl),
+			Concurrency:         cfg.TokenLookupConcurrency,
+		},
+		baseUrl: baseUrl,
+	}, nil
+}
+
+var _ serviceprovider.ConstructorFunc = newEcho
+
+func (e *Echo) LookupToken(ctx context.Context, cl client.Client, binding *api.SPIAccessTokenBinding) (*api.SPIAccessToken, error) {
+	return e.lookup.LookupFirst(ctx, cl, binding)
+}
+
+func (e *Echo) PersistMetadata(ctx context.Context, _ client.Client, token *api.SPIAccessToken) error {
+	return e.lookup.PersistMetadata(ctx, token)
+}
+
+func (e *Echo) GetBaseUrl() string {
+	return e.baseUrl
+}
+
+// TranslateToScopes returns no scopes, because the echo service provider has none.
+func (e *Echo) TranslateToScopes(_ api.Permission) []string {
+	return []string{}
+}
+
+func (e *Echo) GetType() api.ServiceProviderType {
+	return api.ServiceProviderTypeEcho
+}
+
+func (e *Echo) CheckRepositoryAccess(_ context.Context, _ client.Client, _ *api.SPIAccessCheck) (*api.SPIAccessCheckStatus, error) {
+	return &api.SPIAccessCheckStatus{
+		Accessibility: api.SPIAccessCheckAccessibilityUnknown,
+		ErrorReason:   api.SPIAccessCheckErrorNotImplemented,
+		ErrorMessage:  "Access check is not implemented for the echo service provider.",
+	}, nil
+}
+
+// GetOAuthEndpoint returns an empty string, because there is no OAuth flow for the echo service provider.
+func (e *Echo) GetOAuthEndpoint() string {
+	return ""
+}
+
+func (e *Echo) MapToken(_ context.Context, _ *api.SPIAccessTokenBinding, token *api.SPIAccessToken, tokenData *api.Token) (serviceprovider.AccessTokenMapper, error) {
+	return serviceprovider.DefaultMapToken(token, tokenData)
+}
+
+// Validate accepts any permissions and scopes.
+func (e *Echo) Validate(_ context.Context, _ serviceprovider.Validated) (serviceprovider.ValidationResult, error) {
+	return serviceprovider.ValidationResult{}, nil
+}
+
+// ValidateCredentials accepts any credentials with the required fields filled in.
+func (e *Echo) ValidateCredentials(_ context.Context, tokenData *api.Token) error {
+	return serviceprovider.DefaultValidateCredentials(tokenData)
+}
+
+// GetAccessibleResources returns no resources, because the echo service provider has no repositories.
+func (e *Echo) GetAccessibleResources(_ context.Context, _ *api.SPIAccessToken) (serviceprovider.AccessibleResources, error) {
+	return serviceprovider.AccessibleResources{}, nil
+}
+
+// tokenFilter matches all the tokens with known users. The tokens are already limited to the instance by the lookup.
+type tokenFilter struct{}
+
+var _ serviceprovider.TokenFilter = (*tokenFilter)(nil)
+
+func (t *tokenFilter) Matches(_ context.Context, _ serviceprovider.Matchable, token *api.SPIAccessToken) (bool, error) {
+	return token.Status.TokenMetadata != nil && token.Status.TokenMetadata.Username != "", nil
+}
+
+// metadataProvider derives the metadata of the tokens from their data without contacting anything.
+type metadataProvider struct {
+	tokenStorage tokenstorage.TokenStorage
+}
+
+var _ serviceprovider.MetadataProvider = (*metadataProvider)(nil)
+
+func (p *metadataProvider) Fetch(ctx context.Context, token *api.SPIAccessToken) (*api.TokenMetadata, error) {
+	data, err := p.tokenStorage.Get(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the token data: %w", err)
+	}
+
+	if data == nil {
+		return nil, nil
+	}
+
+	username := data.Username
+	if username == "" {
+		username = "echo"
+	}
+
+	metadata := token.Status.TokenMetadata
+	if metadata == nil {
+		metadata = &api.TokenMetadata{}
+		token.Status.TokenMetadata = metadata
+	}
+
+	metadata.Username = username
+	metadata.UserId = username
+
+	return metadata, nil
+}
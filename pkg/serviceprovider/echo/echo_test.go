@@ -0,0 +1,60 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echo
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/tokenstorage"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidateCredentials(t *testing.T) {
+	e := &Echo{baseUrl: "https://echo.spi.invalid"}
+
+	assert.NoError(t, e.ValidateCredentials(context.TODO(), &api.Token{AccessToken: "anything"}))
+	assert.NoError(t, e.ValidateCredentials(context.TODO(), &api.Token{TokenType: api.BasicAuthTokenType, Username: "user", AccessToken: "anything"}))
+	assert.Error(t, e.ValidateCredentials(context.TODO(), &api.Token{}))
+}
+
+func TestMetadataProvider_Fetch(t *testing.T) {
+	fetch := func(data *api.Token) *api.SPIAccessToken {
+		token := &api.SPIAccessToken{ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "default"}}
+		mp := &metadataProvider{
+			tokenStorage: tokenstorage.TestTokenStorage{
+				GetImpl: func(ctx context.Context, owner *api.SPIAccessToken) (*api.Token, error) {
+					return data, nil
+				},
+			},
+		}
+
+		_, err := mp.Fetch(context.TODO(), token)
+		assert.NoError(t, err)
+		return token
+	}
+
+	token := fetch(&api.Token{Username: "spi-self-test", AccessToken: "secret"})
+	assert.Equal(t, "spi-self-test", token.Status.TokenMetadata.Username)
+
+	matches, err := (&tokenFilter{}).Matches(context.TODO(), nil, token)
+	assert.NoError(t, err)
+	assert.True(t, matches)
+
+	assert.Equal(t, "echo", fetch(&api.Token{AccessToken: "secret"}).Status.TokenMetadata.Username)
+	assert.Nil(t, fetch(nil).Status.TokenMetadata)
+}
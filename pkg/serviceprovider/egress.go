@@ -0,0 +1,92 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serviceprovider
+
+import (
+	"net"
+	"net/url"
+	"sort"
+
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+)
+
+// EgressEndpoints returns the sorted "host:port" network endpoints the service providers configured in
+// the configuration need to reach. The service providers with a custom base URL need to reach the host of the base
+// URL, the others the default endpoints of their initializer. The Keycloak brokering the OAuth flows, the binding
+// policy webhook and the notification webhooks, if any, are included, too.
+func EgressEndpoints(cfg config.Configuration, initializers map[config.ServiceProviderType]Initializer) []string {
+	endpoints := map[string]struct{}{}
+	for _, spc := range cfg.ServiceProviders {
+		if initializers[spc.ServiceProviderType].NoNetworkAccess {
+			continue
+		}
+
+		if spc.ServiceProviderBaseUrl != "" {
+			if endpoint := UrlEndpoint(spc.ServiceProviderBaseUrl); endpoint != "" {
+				endpoints[endpoint] = struct{}{}
+				continue
+			}
+		}
+
+		for _, endpoint := range initializers[spc.ServiceProviderType].EgressEndpoints {
+			endpoints[endpoint] = struct{}{}
+		}
+	}
+
+	if cfg.OAuthBrokerUrl != "" {
+		if endpoint := UrlEndpoint(cfg.OAuthBrokerUrl); endpoint != "" {
+			endpoints[endpoint] = struct{}{}
+		}
+	}
+
+	if cfg.BindingPolicyWebhookUrl != "" {
+		if endpoint := UrlEndpoint(cfg.BindingPolicyWebhookUrl); endpoint != "" {
+			endpoints[endpoint] = struct{}{}
+		}
+	}
+
+	for _, webhookUrl := range cfg.NotificationWebhookUrls {
+		if endpoint := UrlEndpoint(webhookUrl); endpoint != "" {
+			endpoints[endpoint] = struct{}{}
+		}
+	}
+
+	ret := make([]string, 0, len(endpoints))
+	for endpoint := range endpoints {
+		ret = append(ret, endpoint)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// UrlEndpoint returns the "host:port" network endpoint of the URL with the port defaulted according to the scheme.
+// Returns an empty string if the URL cannot be parsed or has no host.
+func UrlEndpoint(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+
+	port := u.Port()
+	if port == "" {
+		if u.Scheme == "http" {
+			port = "80"
+		} else {
+			port = "443"
+		}
+	}
+
+	return net.JoinHostPort(u.Hostname(), port)
+}
@@ -0,0 +1,75 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serviceprovider
+
+import (
+	"testing"
+
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEgressEndpoints(t *testing.T) {
+	initializers := map[config.ServiceProviderType]Initializer{
+		config.ServiceProviderTypeGitHub: {EgressEndpoints: []string{"github.com:443", "api.github.com:443"}},
+		config.ServiceProviderTypeQuay:   {EgressEndpoints: []string{"quay.io:443"}},
+		config.ServiceProviderTypeEcho:   {NoNetworkAccess: true},
+	}
+
+	endpoints := EgressEndpoints(config.Configuration{
+		ServiceProviders: []config.ServiceProviderConfiguration{
+			{ServiceProviderType: config.ServiceProviderTypeGitHub},
+			{ServiceProviderType: config.ServiceProviderTypeQuay, ServiceProviderBaseUrl: "https://quay.acme.com:8443"},
+			{ServiceProviderType: config.ServiceProviderTypeGitHub},
+			{ServiceProviderType: config.ServiceProviderTypeEcho, ServiceProviderBaseUrl: "https://echo.spi.invalid"},
+		},
+	}, initializers)
+
+	assert.Equal(t, []string{"api.github.com:443", "github.com:443", "quay.acme.com:8443"}, endpoints)
+
+	endpoints = EgressEndpoints(config.Configuration{
+		ServiceProviders: []config.ServiceProviderConfiguration{
+			{ServiceProviderType: config.ServiceProviderTypeQuay, BrokerIdentityProvider: "quay"},
+		},
+		OAuthBrokerUrl: "https://sso.acme.com/auth",
+	}, initializers)
+
+	assert.Equal(t, []string{"quay.io:443", "sso.acme.com:443"}, endpoints)
+
+	endpoints = EgressEndpoints(config.Configuration{
+		ServiceProviders: []config.ServiceProviderConfiguration{
+			{ServiceProviderType: config.ServiceProviderTypeQuay},
+		},
+		BindingPolicyWebhookUrl: "http://policy.acme.svc:8080/check",
+	}, initializers)
+
+	assert.Equal(t, []string{"policy.acme.svc:8080", "quay.io:443"}, endpoints)
+
+	endpoints = EgressEndpoints(config.Configuration{
+		ServiceProviders: []config.ServiceProviderConfiguration{
+			{ServiceProviderType: config.ServiceProviderTypeQuay},
+		},
+		NotificationWebhookUrls: []string{"https://hooks.acme.com/spi", "http://notify.acme.svc/tokens", "https://hooks.acme.com/other"},
+	}, initializers)
+
+	assert.Equal(t, []string{"hooks.acme.com:443", "notify.acme.svc:80", "quay.io:443"}, endpoints)
+}
+
+func TestUrlEndpoint(t *testing.T) {
+	assert.Equal(t, "spi-vault:8200", UrlEndpoint("http://spi-vault:8200"))
+	assert.Equal(t, "github.com:443", UrlEndpoint("https://github.com/acme"))
+	assert.Equal(t, "acme.com:80", UrlEndpoint("http://acme.com"))
+	assert.Empty(t, UrlEndpoint("not a url"))
+}
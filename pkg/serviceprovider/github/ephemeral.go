@@ -0,0 +1,144 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	sperrors "github.com/redhat-appstudio/service-provider-integration-operator/pkg/errors"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ serviceprovider.EphemeralTokenMinter = (*Github)(nil)
+
+// scopedTokenRequest is the body of the GitHub request to create a scoped user access token.
+type scopedTokenRequest struct {
+	AccessToken  string            `json:"access_token"`
+	Target       string            `json:"target"`
+	Repositories []string          `json:"repositories"`
+	Permissions  map[string]string `json:"permissions,omitempty"`
+}
+
+// scopedTokenResponse is the part of the GitHub response to the request to create a scoped user access token that we
+// are interested in.
+type scopedTokenResponse struct {
+	Token     string     `json:"token"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// MintEphemeralToken exchanges the user access token of the linked token for a short-lived token that can only access
+// the repository of the binding with the permissions required by the binding. This is only possible for the expiring
+// user access tokens obtained using the OAuth flow of a GitHub App. For the other tokens GitHub either refuses
+// the request or returns a token without expiry, which is reported as an error. GitHub doesn't let the caller choose
+// the expiry of the scoped tokens, so the maxValidity is not used.
+func (g *Github) MintEphemeralToken(ctx context.Context, binding *api.SPIAccessTokenBinding, tokenData *api.Token, _ time.Duration) (*api.Token, error) {
+	spConfig := oauthConfiguration(g.Configuration)
+	if spConfig == nil {
+		return nil, fmt.Errorf("no GitHub App is configured")
+	}
+
+	owner, repo, err := g.parseGithubRepoUrl(binding.Spec.RepoUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(scopedTokenRequest{
+		AccessToken:  tokenData.AccessToken,
+		Target:       owner,
+		Repositories: []string{repo},
+		Permissions:  appPermissions(binding.Spec.Permissions.Required),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize the scoped token request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", apiUrl(spConfig)+"/applications/"+url.PathEscape(spConfig.ClientId)+"/token/scoped", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the scoped token request: %w", err)
+	}
+	req.SetBasicAuth(spConfig.ClientId, spConfig.ClientSecret)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request the scoped token: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.FromContext(ctx).Error(err, "failed to close the response body")
+		}
+	}()
+
+	if err := sperrors.FromHttpResponse(resp); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code of the scoped token response: %d", resp.StatusCode)
+	}
+
+	scoped := scopedTokenResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&scoped); err != nil {
+		return nil, fmt.Errorf("failed to parse the scoped token response: %w", err)
+	}
+
+	ephemeral := &api.Token{
+		Username:    tokenData.Username,
+		AccessToken: scoped.Token,
+		TokenType:   tokenData.TokenType,
+	}
+	if scoped.ExpiresAt != nil {
+		ephemeral.Expiry = uint64(scoped.ExpiresAt.Unix())
+	}
+
+	return ephemeral, nil
+}
+
+// appPermissions translates the required permissions to the repository permissions of a GitHub App. The permissions
+// without a counterpart among the repository permissions (e.g. the user permissions) are not requested.
+func appPermissions(permissions []api.Permission) map[string]string {
+	result := map[string]string{}
+	for _, p := range permissions {
+		var name string
+		switch p.Area {
+		case api.PermissionAreaRepository:
+			name = "contents"
+		case api.PermissionAreaRepositoryMetadata:
+			name = "metadata"
+		case api.PermissionAreaWebhooks:
+			name = "repository_hooks"
+		default:
+			continue
+		}
+
+		if p.Type.IsWrite() && p.Area != api.PermissionAreaRepositoryMetadata {
+			result[name] = "write"
+		} else if result[name] == "" {
+			result[name] = "read"
+		}
+	}
+
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
@@ -0,0 +1,115 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMintEphemeralToken(t *testing.T) {
+	cfg := config.Configuration{
+		ServiceProviders: []config.ServiceProviderConfiguration{
+			{
+				ServiceProviderType: config.ServiceProviderTypeGitHub,
+				ClientId:            "clientId",
+				ClientSecret:        "clientSecret",
+			},
+		},
+	}
+
+	binding := &api.SPIAccessTokenBinding{
+		Spec: api.SPIAccessTokenBindingSpec{
+			RepoUrl: "https://github.com/acme/repo",
+			Permissions: api.Permissions{
+				Required: []api.Permission{
+					{Type: api.PermissionTypeRead, Area: api.PermissionAreaRepository},
+					{Type: api.PermissionTypeReadWrite, Area: api.PermissionAreaWebhooks},
+					{Type: api.PermissionTypeRead, Area: api.PermissionAreaUser},
+				},
+			},
+		},
+	}
+
+	mint := func(statusCode int, responseBody string) (*http.Request, string, *api.Token, error) {
+		var request *http.Request
+		var requestBody string
+		gh := Github{Configuration: cfg, httpClient: httpClientMock{
+			doFunc: func(req *http.Request) (*http.Response, error) {
+				request = req
+				body, _ := io.ReadAll(req.Body)
+				requestBody = string(body)
+				return &http.Response{StatusCode: statusCode, Body: io.NopCloser(strings.NewReader(responseBody))}, nil
+			},
+		}}
+
+		token, err := gh.MintEphemeralToken(context.TODO(), binding, &api.Token{AccessToken: "access", TokenType: "bearer", Username: "alois"}, 0)
+		return request, requestBody, token, err
+	}
+
+	t.Run("mints scoped token", func(t *testing.T) {
+		request, requestBody, token, err := mint(http.StatusOK, `{"token": "scoped", "expires_at": "2022-01-02T03:04:05Z"}`)
+		assert.NoError(t, err)
+
+		assert.Equal(t, "POST", request.Method)
+		assert.Equal(t, "https://api.github.com/applications/clientId/token/scoped", request.URL.String())
+		user, pass, ok := request.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "clientId", user)
+		assert.Equal(t, "clientSecret", pass)
+		assert.JSONEq(t, `{
+			"access_token": "access",
+			"target": "acme",
+			"repositories": ["repo"],
+			"permissions": {"contents": "read", "repository_hooks": "write"}
+		}`, requestBody)
+
+		assert.Equal(t, &api.Token{AccessToken: "scoped", TokenType: "bearer", Username: "alois", Expiry: 1641092645}, token)
+	})
+
+	t.Run("token without expiry", func(t *testing.T) {
+		_, _, token, err := mint(http.StatusOK, `{"token": "scoped"}`)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(0), token.Expiry)
+	})
+
+	t.Run("refused", func(t *testing.T) {
+		_, _, _, err := mint(http.StatusUnprocessableEntity, `{"message": "not a GitHub App token"}`)
+		assert.Error(t, err)
+	})
+
+	t.Run("not configured", func(t *testing.T) {
+		gh := Github{}
+		_, err := gh.MintEphemeralToken(context.TODO(), binding, &api.Token{AccessToken: "access"}, 0)
+		assert.Error(t, err)
+	})
+}
+
+func TestAppPermissions(t *testing.T) {
+	assert.Nil(t, appPermissions(nil))
+	assert.Nil(t, appPermissions([]api.Permission{{Type: api.PermissionTypeRead, Area: api.PermissionAreaUser}}))
+	assert.Equal(t, map[string]string{"contents": "write", "metadata": "read"}, appPermissions([]api.Permission{
+		{Type: api.PermissionTypeWrite, Area: api.PermissionAreaRepository},
+		{Type: api.PermissionTypeRead, Area: api.PermissionAreaRepository},
+		{Type: api.PermissionTypeReadWrite, Area: api.PermissionAreaRepositoryMetadata},
+	}))
+}
@@ -0,0 +1,202 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	sperrors "github.com/redhat-appstudio/service-provider-integration-operator/pkg/errors"
+)
+
+// fineGrainedTokenPrefix is the prefix of the GitHub fine-grained personal access tokens. Unlike the classic tokens,
+// they have no OAuth scopes and are instead granted permissions in the individual repositories.
+const fineGrainedTokenPrefix = "github_pat_"
+
+const githubRepositoryApiBaseUrl = "https://api.github.com/repos/"
+
+type FineGrainedPermission string
+type FineGrainedAccess string
+
+const (
+	FineGrainedPermissionMetadata FineGrainedPermission = "metadata"
+	FineGrainedPermissionContents FineGrainedPermission = "contents"
+	FineGrainedPermissionWebhooks FineGrainedPermission = "webhooks"
+	FineGrainedAccessRead         FineGrainedAccess     = "read"
+	FineGrainedAccessWrite        FineGrainedAccess     = "write"
+)
+
+// fineGrainedProbe is a request to the repository API whose outcome tells whether the token has the access to
+// a permission in the repository.
+type fineGrainedProbe struct {
+	permission FineGrainedPermission
+	access     FineGrainedAccess
+	method     string
+	path       string
+}
+
+// fineGrainedProbes are ordered such that the read access to a permission is probed before the write access to it.
+// The write probes send deliberately incomplete bodies so that GitHub refuses them with 422 if the token has
+// the permission (and with 403 if it doesn't) and nothing is ever changed in the repository.
+var fineGrainedProbes = []fineGrainedProbe{
+	{permission: FineGrainedPermissionContents, access: FineGrainedAccessRead, method: http.MethodGet, path: "/commits?per_page=1"},
+	{permission: FineGrainedPermissionContents, access: FineGrainedAccessWrite, method: http.MethodPost, path: "/git/refs"},
+	{permission: FineGrainedPermissionWebhooks, access: FineGrainedAccessRead, method: http.MethodGet, path: "/hooks?per_page=1"},
+	{permission: FineGrainedPermissionWebhooks, access: FineGrainedAccessWrite, method: http.MethodPost, path: "/hooks"},
+}
+
+func isFineGrainedToken(accessToken string) bool {
+	return strings.HasPrefix(accessToken, fineGrainedTokenPrefix)
+}
+
+// Implies returns true if having this access level also grants the other one.
+func (a FineGrainedAccess) Implies(other FineGrainedAccess) bool {
+	return a == other || (a == FineGrainedAccessWrite && other == FineGrainedAccessRead)
+}
+
+// fetchRepositoryPermissions probes the permissions that the fine-grained token has in each of the provided
+// repositories.
+func (s metadataProvider) fetchRepositoryPermissions(ctx context.Context, accessToken string, repos map[RepositoryUrl]RepositoryRecord) (map[string]api.RepositoryPermissions, error) {
+	ret := make(map[string]api.RepositoryPermissions, len(repos))
+	for repoUrl := range repos {
+		perms, err := s.probeRepository(ctx, accessToken, repoUrl)
+		if err != nil {
+			return nil, err
+		}
+		ret[string(repoUrl)] = perms
+	}
+
+	return ret, nil
+}
+
+func (s metadataProvider) probeRepository(ctx context.Context, accessToken string, repoUrl RepositoryUrl) (api.RepositoryPermissions, error) {
+	repoPath := strings.TrimPrefix(string(repoUrl), "https://github.com/")
+	if repoPath == string(repoUrl) || strings.Count(repoPath, "/") != 1 {
+		return nil, fmt.Errorf("unable to determine the API endpoint of the repository '%s'", repoUrl)
+	}
+	apiUrl := githubRepositoryApiBaseUrl + repoPath
+
+	// every fine-grained token can read the metadata of all the repositories it has access to
+	perms := api.RepositoryPermissions{string(FineGrainedPermissionMetadata): string(FineGrainedAccessRead)}
+
+	for _, probe := range fineGrainedProbes {
+		if probe.access == FineGrainedAccessWrite && perms[string(probe.permission)] != string(FineGrainedAccessRead) {
+			continue
+		}
+
+		granted, err := s.probe(ctx, accessToken, probe.method, apiUrl+probe.path)
+		if err != nil {
+			return nil, err
+		}
+		if granted {
+			perms[string(probe.permission)] = string(probe.access)
+		}
+	}
+
+	return perms, nil
+}
+
+// probe makes the request and returns true if GitHub didn't refuse it because of the missing permissions.
+func (s metadataProvider) probe(ctx context.Context, accessToken string, method string, url string) (bool, error) {
+	var body io.Reader
+	if method != http.MethodGet {
+		body = strings.NewReader("{}")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return false, fmt.Errorf("failed to create the request to %s: %w", url, err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	var status int
+	res, err := s.httpClient.Do(req)
+	if res != nil {
+		_ = res.Body.Close()
+	}
+	if err != nil {
+		spe, ok := sperrors.AsServiceProviderError(err)
+		if !ok {
+			return false, fmt.Errorf("failed to probe %s %s: %w", method, url, err)
+		}
+		status = spe.StatusCode
+	} else {
+		status = res.StatusCode
+	}
+
+	switch {
+	case status < 400, status == http.StatusConflict, status == http.StatusUnprocessableEntity:
+		// 409 is returned for the commits of an empty repository and 422 for the incomplete bodies of the write probes
+		return true, nil
+	case status == http.StatusForbidden, status == http.StatusNotFound:
+		return false, nil
+	default:
+		return false, &sperrors.ServiceProviderError{StatusCode: status, Response: fmt.Sprintf("unexpected response to %s %s", method, url)}
+	}
+}
+
+// translateToFineGrained returns the repository permission and the access to it that the fine-grained tokens need to
+// have in order to satisfy the provided permission. The returned permission is empty if no repository permission is
+// needed. The returned bool is false if the fine-grained tokens cannot satisfy the permission at all.
+func translateToFineGrained(permission api.Permission) (FineGrainedPermission, FineGrainedAccess, bool) {
+	access := FineGrainedAccessRead
+	if permission.Type.IsWrite() {
+		access = FineGrainedAccessWrite
+	}
+
+	switch permission.Area {
+	case api.PermissionAreaRepository:
+		return FineGrainedPermissionContents, access, true
+	case api.PermissionAreaRepositoryMetadata:
+		return FineGrainedPermissionMetadata, access, true
+	case api.PermissionAreaWebhooks:
+		return FineGrainedPermissionWebhooks, access, true
+	case api.PermissionAreaUser:
+		// the public profile of the user can be read with any token but it cannot be changed using the fine-grained
+		// tokens
+		return "", "", access == FineGrainedAccessRead
+	}
+
+	return "", "", true
+}
+
+// fineGrainedPermsMatch checks that the repository permissions of a fine-grained token satisfy the provided
+// permissions.
+func fineGrainedPermsMatch(perms *api.Permissions, repoPerms api.RepositoryPermissions) bool {
+	if repoPerms == nil {
+		return false
+	}
+
+	// the classic scopes are never granted to the fine-grained tokens
+	if len(perms.AdditionalScopes) > 0 {
+		return false
+	}
+
+	for _, p := range perms.Required {
+		permission, access, ok := translateToFineGrained(p)
+		if !ok {
+			return false
+		}
+		if permission != "" && !FineGrainedAccess(repoPerms[string(permission)]).Implies(access) {
+			return false
+		}
+	}
+
+	return true
+}
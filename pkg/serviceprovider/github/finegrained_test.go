@@ -0,0 +1,141 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// probedGithub returns a client that answers the probes with the statuses configured for the "METHOD url" keys and
+// with 403 for all the other requests.
+func probedGithub(statuses map[string]int) *http.Client {
+	return &http.Client{
+		Transport: util.FakeRoundTrip(func(r *http.Request) (*http.Response, error) {
+			status, ok := statuses[r.Method+" "+r.URL.String()]
+			if !ok {
+				status = http.StatusForbidden
+			}
+			return &http.Response{
+				StatusCode: status,
+				Body:       ioutil.NopCloser(bytes.NewBuffer([]byte(`{}`))),
+				Request:    r,
+			}, nil
+		}),
+	}
+}
+
+func TestIsFineGrainedToken(t *testing.T) {
+	assert.True(t, isFineGrainedToken("github_pat_11ABCDEFG"))
+	assert.False(t, isFineGrainedToken("ghp_abcdefg"))
+	assert.False(t, isFineGrainedToken(""))
+}
+
+func TestFineGrainedAccess_Implies(t *testing.T) {
+	assert.True(t, FineGrainedAccessRead.Implies(FineGrainedAccessRead))
+	assert.True(t, FineGrainedAccessWrite.Implies(FineGrainedAccessRead))
+	assert.True(t, FineGrainedAccessWrite.Implies(FineGrainedAccessWrite))
+	assert.False(t, FineGrainedAccessRead.Implies(FineGrainedAccessWrite))
+	assert.False(t, FineGrainedAccess("").Implies(FineGrainedAccessRead))
+}
+
+func TestProbeRepository(t *testing.T) {
+	t.Run("read and write", func(t *testing.T) {
+		mp := metadataProvider{httpClient: probedGithub(map[string]int{
+			"GET https://api.github.com/repos/acme/app/commits?per_page=1": http.StatusConflict,
+			"POST https://api.github.com/repos/acme/app/git/refs":          http.StatusUnprocessableEntity,
+			"GET https://api.github.com/repos/acme/app/hooks?per_page=1":   http.StatusOK,
+		})}
+
+		perms, err := mp.probeRepository(context.TODO(), "github_pat_token", "https://github.com/acme/app")
+		assert.NoError(t, err)
+		assert.Equal(t, api.RepositoryPermissions{
+			"metadata": "read",
+			"contents": "write",
+			"webhooks": "read",
+		}, perms)
+	})
+
+	t.Run("write not probed without read", func(t *testing.T) {
+		probed := []string{}
+		mp := metadataProvider{httpClient: &http.Client{
+			Transport: util.FakeRoundTrip(func(r *http.Request) (*http.Response, error) {
+				probed = append(probed, r.Method+" "+r.URL.Path)
+				assert.Equal(t, "Bearer github_pat_token", r.Header.Get("Authorization"))
+				return &http.Response{StatusCode: http.StatusNotFound, Body: ioutil.NopCloser(bytes.NewBuffer(nil))}, nil
+			}),
+		}}
+
+		perms, err := mp.probeRepository(context.TODO(), "github_pat_token", "https://github.com/acme/app")
+		assert.NoError(t, err)
+		assert.Equal(t, api.RepositoryPermissions{"metadata": "read"}, perms)
+		assert.Equal(t, []string{"GET /repos/acme/app/commits", "GET /repos/acme/app/hooks"}, probed)
+	})
+
+	t.Run("errors from the authenticating client", func(t *testing.T) {
+		mp := metadataProvider{httpClient: serviceprovider.AuthenticatingHttpClient(probedGithub(map[string]int{
+			"GET https://api.github.com/repos/acme/app/commits?per_page=1": http.StatusOK,
+			"POST https://api.github.com/repos/acme/app/git/refs":          http.StatusUnprocessableEntity,
+		}))}
+
+		perms, err := mp.probeRepository(context.TODO(), "github_pat_token", "https://github.com/acme/app")
+		assert.NoError(t, err)
+		assert.Equal(t, api.RepositoryPermissions{"metadata": "read", "contents": "write"}, perms)
+	})
+
+	t.Run("unexpected response", func(t *testing.T) {
+		mp := metadataProvider{httpClient: probedGithub(map[string]int{
+			"GET https://api.github.com/repos/acme/app/commits?per_page=1": http.StatusUnauthorized,
+		})}
+
+		_, err := mp.probeRepository(context.TODO(), "github_pat_token", "https://github.com/acme/app")
+		assert.Error(t, err)
+	})
+
+	t.Run("not a repository url", func(t *testing.T) {
+		mp := metadataProvider{httpClient: probedGithub(nil)}
+
+		_, err := mp.probeRepository(context.TODO(), "github_pat_token", "https://github.com/acme")
+		assert.Error(t, err)
+	})
+}
+
+func TestFineGrainedPermsMatch(t *testing.T) {
+	repoPerms := api.RepositoryPermissions{"metadata": "read", "contents": "write", "webhooks": "read"}
+
+	test := func(expected bool, repoPerms api.RepositoryPermissions, perms api.Permissions) {
+		assert.Equal(t, expected, fineGrainedPermsMatch(&perms, repoPerms))
+	}
+
+	test(true, repoPerms, api.Permissions{})
+	test(true, repoPerms, api.Permissions{Required: []api.Permission{
+		{Area: api.PermissionAreaRepository, Type: api.PermissionTypeReadWrite},
+		{Area: api.PermissionAreaRepositoryMetadata, Type: api.PermissionTypeRead},
+		{Area: api.PermissionAreaWebhooks, Type: api.PermissionTypeRead},
+		{Area: api.PermissionAreaUser, Type: api.PermissionTypeRead},
+	}})
+	test(false, repoPerms, api.Permissions{Required: []api.Permission{{Area: api.PermissionAreaWebhooks, Type: api.PermissionTypeWrite}}})
+	test(false, repoPerms, api.Permissions{Required: []api.Permission{{Area: api.PermissionAreaUser, Type: api.PermissionTypeWrite}}})
+	test(false, repoPerms, api.Permissions{AdditionalScopes: []string{"repo"}})
+	test(false, nil, api.Permissions{})
+}
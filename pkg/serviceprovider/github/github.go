@@ -15,9 +15,15 @@
 package github
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
 
 	"k8s.io/utils/pointer"
@@ -30,6 +36,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	"github.com/machinebox/graphql"
+	sperrors "github.com/redhat-appstudio/service-provider-integration-operator/pkg/errors"
 	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
 	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
 
@@ -38,39 +45,63 @@ import (
 )
 
 var _ serviceprovider.ServiceProvider = (*Github)(nil)
+var _ serviceprovider.GrantRevoker = (*Github)(nil)
+var _ serviceprovider.RateLimitReporter = (*Github)(nil)
+var _ serviceprovider.RepositoryLister = (*Github)(nil)
+var _ serviceprovider.WebhookManager = (*Github)(nil)
+var _ serviceprovider.CredentialsInspector = (*Github)(nil)
+var _ serviceprovider.ScopeChecker = (*Github)(nil)
 
 type Github struct {
-	Configuration config.Configuration
-	lookup        serviceprovider.GenericLookup
-	httpClient    rest.HTTPClient
-	tokenStorage  tokenstorage.TokenStorage
+	Configuration    config.Configuration
+	lookup           serviceprovider.GenericLookup
+	metadataProvider *metadataProvider
+	httpClient       rest.HTTPClient
+	tokenStorage     tokenstorage.TokenStorage
+	rateLimitKey     serviceprovider.RateLimitKey
+	// scopeTranslations are the scope translations configured by the administrators.
+	scopeTranslations *serviceprovider.ScopeTranslationTable
 }
 
 var Initializer = serviceprovider.Initializer{
-	Probe:       githubProbe{},
-	Constructor: serviceprovider.ConstructorFunc(newGithub),
+	Probe:              githubProbe{},
+	Constructor:        serviceprovider.ConstructorFunc(newGithub),
+	OfflineTokenFilter: &tokenFilter{},
+	EgressEndpoints:    []string{"github.com:443", "api.github.com:443"},
+	StateSchema:        &stateSchema,
 }
 
 func newGithub(factory *serviceprovider.Factory, _ string) (serviceprovider.ServiceProvider, error) {
-	cache := serviceprovider.NewMetadataCache(factory.KubernetesClient, &serviceprovider.TtlMetadataExpirationPolicy{Ttl: factory.Configuration.TokenLookupCacheTtl})
+	cache := serviceprovider.NewMetadataCache(factory.KubernetesClient, &serviceprovider.TtlMetadataExpirationPolicy{Ttl: factory.Configuration.Get().TokenLookupCacheTtl})
 
-	httpClient := serviceprovider.AuthenticatingHttpClient(factory.HttpClient)
+	rateLimitKey := serviceprovider.RateLimitKey{ServiceProviderType: api.ServiceProviderTypeGitHub}
+	if spConfig := oauthConfiguration(factory.Configuration.Get()); spConfig != nil {
+		rateLimitKey.ClientId = spConfig.ClientId
+	}
+	trackingClient := serviceprovider.RateLimitTrackingHttpClient(factory.HttpClient, serviceprovider.RateLimits, rateLimitKey)
+	httpClient := serviceprovider.AuthenticatingHttpClient(trackingClient)
+
+	mp := &metadataProvider{
+		graphqlClient: graphql.NewClient("https://api.github.com/graphql", graphql.WithHTTPClient(httpClient)),
+		httpClient:    httpClient,
+		tokenStorage:  factory.TokenStorage,
+	}
 
 	return &Github{
-		Configuration: factory.Configuration,
+		Configuration: factory.Configuration.Get(),
 		tokenStorage:  factory.TokenStorage,
 		lookup: serviceprovider.GenericLookup{
 			ServiceProviderType: api.ServiceProviderTypeGitHub,
-			TokenFilter:         &tokenFilter{},
-			MetadataProvider: &metadataProvider{
-				graphqlClient: graphql.NewClient("https://api.github.com/graphql", graphql.WithHTTPClient(httpClient)),
-				httpClient:    httpClient,
-				tokenStorage:  factory.TokenStorage,
-			},
-			MetadataCache:  &cache,
-			RepoHostParser: serviceprovider.RepoHostParserFunc(serviceprovider.RepoHostFromUrl),
+			TokenFilter:         &tokenFilter{scopeTranslations: factory.ScopeTranslations},
+			MetadataProvider:    mp,
+			MetadataCache:       &cache,
+			RepoHostParser:      serviceprovider.RepoHostParserFunc(serviceprovider.RepoHostFromUrl),
+			Concurrency:         factory.Configuration.Get().TokenLookupConcurrency,
 		},
-		httpClient: factory.HttpClient,
+		metadataProvider:  mp,
+		httpClient:        trackingClient,
+		rateLimitKey:      rateLimitKey,
+		scopeTranslations: factory.ScopeTranslations,
 	}, nil
 }
 
@@ -89,10 +120,16 @@ func (g *Github) GetType() api.ServiceProviderType {
 }
 
 func (g *Github) TranslateToScopes(permission api.Permission) []string {
-	return translateToScopes(permission)
+	return translateToScopes(g.scopeTranslations, permission)
+}
+
+// translateToScopes translates the permission using the scope translations configured by the administrators, falling
+// back to the builtin translation.
+func translateToScopes(table *serviceprovider.ScopeTranslationTable, permission api.Permission) []string {
+	return table.Translate(api.ServiceProviderTypeGitHub, permission, builtinScopes)
 }
 
-func translateToScopes(permission api.Permission) []string {
+func builtinScopes(permission api.Permission) []string {
 	switch permission.Area {
 	case api.PermissionAreaRepository, api.PermissionAreaRepositoryMetadata:
 		return []string{"repo"}
@@ -114,16 +151,7 @@ func translateToScopes(permission api.Permission) []string {
 }
 
 func (g *Github) LookupToken(ctx context.Context, cl client.Client, binding *api.SPIAccessTokenBinding) (*api.SPIAccessToken, error) {
-	tokens, err := g.lookup.Lookup(ctx, cl, binding)
-	if err != nil {
-		return nil, err
-	}
-
-	if len(tokens) == 0 {
-		return nil, nil
-	}
-
-	return &tokens[0], nil
+	return g.lookup.LookupFirst(ctx, cl, binding)
 }
 
 func (g *Github) PersistMetadata(ctx context.Context, _ client.Client, token *api.SPIAccessToken) error {
@@ -150,26 +178,26 @@ func (g *Github) CheckRepositoryAccess(ctx context.Context, cl client.Client, ac
 		return status, nil
 	}
 
-	publicRepo, err := g.publicRepo(ctx, accessCheck)
+	visibility, err := g.visibility(ctx, owner, repoUrl)
 	if err != nil {
 		return nil, err
 	}
-	status.Accessible = publicRepo
-	if publicRepo {
+	if visibility == serviceprovider.RepositoryVisibilityPublic {
+		status.Accessible = true
 		status.Accessibility = api.SPIAccessCheckAccessibilityPublic
 	}
 
 	lg := log.FromContext(ctx)
 
-	tokens, lookupErr := g.lookup.Lookup(ctx, cl, accessCheck)
+	token, lookupErr := g.lookup.LookupFirst(ctx, cl, accessCheck)
 	if lookupErr != nil {
 		lg.Error(lookupErr, "failed to lookup token for accesscheck", "accessCheck", accessCheck)
 		return status, lookupErr
 	}
 
-	if len(tokens) > 0 {
-		token := &tokens[0]
-		ghClient, err := g.createAuthenticatedGhClient(ctx, token)
+	var ghClient *github.Client
+	if token != nil {
+		ghClient, err = g.createAuthenticatedGhClient(ctx, token)
 		if err != nil {
 			status.ErrorReason = api.SPIAccessCheckErrorUnknownError
 			status.ErrorMessage = err.Error()
@@ -189,18 +217,46 @@ func (g *Github) CheckRepositoryAccess(ctx context.Context, cl client.Client, ac
 		}
 	} else {
 		lg.Info("we have no tokens for repository", "repo", repoUrl)
+		ghClient = g.anonymousGhClient()
+		serviceprovider.ApplyVisibility(status, visibility)
+	}
+
+	if accessCheck.Spec.Ref != "" && status.Accessible {
+		refStatus, err := resolveRef(ctx, ghClient, owner, repo, accessCheck.Spec.Ref)
+		if errors.Is(err, errRefNotFound) {
+			status.Accessible = false
+			status.ErrorReason = api.SPIAccessCheckErrorRefNotFound
+			status.ErrorMessage = fmt.Sprintf("the ref '%s' was not found in the repository", accessCheck.Spec.Ref)
+			return status, nil
+		} else if err != nil {
+			return status, err
+		}
+		status.Ref = refStatus
 	}
 
 	return status, nil
 }
 
+// validationMessages is the catalog of the remediations of the validation failures of the GitHub permissions.
+var validationMessages = serviceprovider.ValidationMessageCatalog{
+	serviceprovider.ValidationProblemUnknownScope: {
+		Hint:             "use the scopes of the GitHub OAuth apps in the additional scopes",
+		DocumentationUrl: "https://docs.github.com/en/apps/oauth-apps/building-oauth-apps/scopes-for-oauth-apps",
+	},
+	serviceprovider.ValidationProblemInvalidScopeSyntax: {
+		Hint:             "put each scope into a separate item of the additional scopes",
+		DocumentationUrl: "https://docs.github.com/en/apps/oauth-apps/building-oauth-apps/scopes-for-oauth-apps",
+	},
+}
+
 func (g *Github) Validate(ctx context.Context, validated serviceprovider.Validated) (serviceprovider.ValidationResult, error) {
 	// only the additional scopes can be invalid. We support the translation for all types
 	// of the Permission in github.
 	ret := serviceprovider.ValidationResult{}
+	knownScopes := g.scopeTranslations.KnownScopes(api.ServiceProviderTypeGitHub, validScopes)
 	for _, s := range validated.Permissions().AdditionalScopes {
-		if !IsValidScope(s) {
-			ret.ScopeValidation = append(ret.ScopeValidation, fmt.Errorf("unknown scope: '%s'", s))
+		if err := validationMessages.ValidateScope(s, knownScopes); err != nil {
+			ret.ScopeValidation = append(ret.ScopeValidation, err)
 		}
 	}
 
@@ -219,25 +275,29 @@ func (g *Github) createAuthenticatedGhClient(ctx context.Context, spiToken *api.
 	return github.NewClient(oauth2.NewClient(ctx, ts)), nil
 }
 
-func (g *Github) publicRepo(ctx context.Context, accessCheck *api.SPIAccessCheck) (bool, error) {
-	lg := log.FromContext(ctx)
-	req, reqErr := http.NewRequestWithContext(ctx, "GET", accessCheck.Spec.RepoUrl, nil)
-	if reqErr != nil {
-		lg.Error(reqErr, "failed to prepare request")
-		return false, reqErr
-	}
-
-	if resp, err := g.httpClient.Do(req); err != nil {
-		lg.Error(err, "failed to request the repo", "repo", accessCheck.Spec.RepoUrl)
-		return false, err
-	} else if resp.StatusCode == http.StatusOK {
-		return true, nil
-	} else if resp.StatusCode == http.StatusNotFound {
-		return false, nil
-	} else {
-		lg.Info("unexpected return code for repo", "repo", accessCheck.Spec.RepoUrl, "code", resp.StatusCode)
-		return false, nil
+// anonymousGhClient returns a GitHub client that doesn't authenticate the requests. It can only access the public
+// repositories.
+func (g *Github) anonymousGhClient() *github.Client {
+	httpClient, _ := g.httpClient.(*http.Client)
+	return github.NewClient(httpClient)
+}
+
+// visibility probes the repository without any credentials. GitHub responds with 404 to the anonymous requests for
+// the private repositories, so the missing repositories can only be told apart if their owner doesn't exist either.
+func (g *Github) visibility(ctx context.Context, owner string, repoUrl string) (serviceprovider.RepositoryVisibility, error) {
+	visibility, err := serviceprovider.ProbeVisibility(ctx, g.httpClient, "GET", repoUrl)
+	if err != nil || visibility != serviceprovider.RepositoryVisibilityNotFound {
+		return visibility, err
 	}
+
+	ownerVisibility, err := serviceprovider.ProbeVisibility(ctx, g.httpClient, "GET", g.GetBaseUrl()+"/"+owner)
+	if err != nil {
+		return serviceprovider.RepositoryVisibilityUnknown, err
+	}
+	if ownerVisibility == serviceprovider.RepositoryVisibilityNotFound {
+		return serviceprovider.RepositoryVisibilityNotFound, nil
+	}
+	return serviceprovider.RepositoryVisibilityPrivateOrNotFound, nil
 }
 
 func (g *Github) parseGithubRepoUrl(repoUrl string) (owner, repo string, err error) {
@@ -252,10 +312,269 @@ func (g *Github) parseGithubRepoUrl(repoUrl string) (owner, repo string, err err
 	return "", "", fmt.Errorf("unable to parse path '%s'", repoUrl)
 }
 
+func (g *Github) ValidateCredentials(_ context.Context, tokenData *api.Token) error {
+	if tokenData.IsBasicAuth() {
+		return fmt.Errorf("GitHub doesn't support username and password authentication, use a personal access token instead")
+	}
+
+	return serviceprovider.DefaultValidateCredentials(tokenData)
+}
+
+// InspectCredentials returns the user and the scopes of the provided token. The accessible repositories are only
+// fetched for the fine-grained tokens, which have no scopes, to probe the permissions they have in each of them.
+func (g *Github) InspectCredentials(ctx context.Context, tokenData *api.Token) (*api.TokenMetadata, error) {
+	username, userId, scopes, err := g.metadataProvider.fetchUserAndScopes(tokenData.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := &api.TokenMetadata{
+		Username: username,
+		UserId:   userId,
+		Scopes:   scopes,
+	}
+
+	if isFineGrainedToken(tokenData.AccessToken) {
+		state := &TokenState{
+			AccessibleRepos: map[RepositoryUrl]RepositoryRecord{},
+		}
+		if err := (&AllAccessibleRepos{}).FetchAll(ctx, g.metadataProvider.graphqlClient, tokenData.AccessToken, state); err != nil {
+			return nil, err
+		}
+
+		if metadata.RepositoryPermissions, err = g.metadataProvider.fetchRepositoryPermissions(ctx, tokenData.AccessToken, state.AccessibleRepos); err != nil {
+			return nil, err
+		}
+	}
+
+	return metadata, nil
+}
+
+func (g *Github) GetAccessibleResources(_ context.Context, token *api.SPIAccessToken) (serviceprovider.AccessibleResources, error) {
+	ret := serviceprovider.AccessibleResources{}
+	if token.Status.TokenMetadata == nil || len(token.Status.TokenMetadata.ServiceProviderState) == 0 {
+		return ret, nil
+	}
+
+	githubState := TokenState{}
+	if err := stateSchema.Unmarshal(token.Status.TokenMetadata.ServiceProviderState, &githubState); err != nil {
+		return ret, fmt.Errorf("failed to unmarshal the GitHub token state: %w", err)
+	}
+
+	orgs := map[string]bool{}
+	for repoUrl := range githubState.AccessibleRepos {
+		ret.Repositories = append(ret.Repositories, string(repoUrl))
+
+		owner := strings.SplitN(strings.TrimPrefix(string(repoUrl), g.GetBaseUrl()+"/"), "/", 2)[0]
+		if owner != "" && !orgs[owner] {
+			orgs[owner] = true
+			ret.Organizations = append(ret.Organizations, owner)
+		}
+	}
+
+	sort.Strings(ret.Repositories)
+	sort.Strings(ret.Organizations)
+
+	return ret, nil
+}
+
+func (g *Github) ListAccessibleRepositories(ctx context.Context, token *api.SPIAccessToken, page int, perPage int) (serviceprovider.RepositoryPage, error) {
+	ghClient, err := g.createAuthenticatedGhClient(ctx, token)
+	if err != nil {
+		return serviceprovider.RepositoryPage{}, err
+	}
+
+	repos, resp, err := ghClient.Repositories.List(ctx, "", &github.RepositoryListOptions{
+		Sort:        "full_name",
+		ListOptions: github.ListOptions{Page: page, PerPage: perPage},
+	})
+	if err != nil {
+		if resp != nil && resp.StatusCode >= 400 {
+			// the body of the response has already been consumed by the GitHub client, the error contains the message
+			return serviceprovider.RepositoryPage{}, &sperrors.ServiceProviderError{StatusCode: resp.StatusCode, Response: err.Error()}
+		}
+		return serviceprovider.RepositoryPage{}, fmt.Errorf("failed to list the accessible repositories: %w", err)
+	}
+
+	ret := serviceprovider.RepositoryPage{
+		Repositories: make([]string, 0, len(repos)),
+		HasNextPage:  resp.NextPage != 0,
+	}
+	for _, r := range repos {
+		ret.Repositories = append(ret.Repositories, r.GetHTMLURL())
+	}
+
+	return ret, nil
+}
+
+func (g *Github) EnsureWebhook(ctx context.Context, token *api.SPIAccessToken, repoUrl string, id string, webhook serviceprovider.Webhook) (string, error) {
+	owner, repo, err := g.parseGithubRepoUrl(repoUrl)
+	if err != nil {
+		return "", err
+	}
+
+	ghClient, err := g.createAuthenticatedGhClient(ctx, token)
+	if err != nil {
+		return "", err
+	}
+
+	events := webhook.Events
+	if len(events) == 0 {
+		events = []string{"push"}
+	}
+
+	hookConfig := map[string]interface{}{
+		"url":          webhook.Url,
+		"content_type": "json",
+	}
+	if webhook.Secret != "" {
+		hookConfig["secret"] = webhook.Secret
+	}
+
+	hook := &github.Hook{
+		Config: hookConfig,
+		Events: events,
+		Active: pointer.Bool(true),
+	}
+
+	if id != "" {
+		hookId, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid GitHub webhook ID '%s': %w", id, err)
+		}
+
+		_, resp, err := ghClient.Repositories.EditHook(ctx, owner, repo, hookId, hook)
+		if err == nil {
+			return id, nil
+		}
+		if resp == nil || resp.StatusCode != http.StatusNotFound {
+			return "", webhookError(resp, err)
+		}
+		// the webhook was deleted in the meantime, let's create it again
+	}
+
+	created, resp, err := ghClient.Repositories.CreateHook(ctx, owner, repo, hook)
+	if err != nil {
+		return "", webhookError(resp, err)
+	}
+
+	return strconv.FormatInt(created.GetID(), 10), nil
+}
+
+func (g *Github) DeleteWebhook(ctx context.Context, token *api.SPIAccessToken, repoUrl string, id string) error {
+	owner, repo, err := g.parseGithubRepoUrl(repoUrl)
+	if err != nil {
+		return err
+	}
+
+	hookId, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid GitHub webhook ID '%s': %w", id, err)
+	}
+
+	ghClient, err := g.createAuthenticatedGhClient(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	resp, err := ghClient.Repositories.DeleteHook(ctx, owner, repo, hookId)
+	if err != nil && (resp == nil || resp.StatusCode != http.StatusNotFound) {
+		return webhookError(resp, err)
+	}
+
+	return nil
+}
+
+func (g *Github) CanManageWebhooks(token *api.SPIAccessToken) bool {
+	if token.Status.TokenMetadata == nil {
+		return false
+	}
+
+	for _, s := range token.Status.TokenMetadata.Scopes {
+		// the repo scope grants the full control of the repositories including their webhooks
+		if Scope(s) == ScopeRepo || Scope(s).Implies(ScopeWriteRepoHook) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Github) MissingScopes(token *api.SPIAccessToken, required []string) []string {
+	metadata := token.Status.TokenMetadata
+	// the fine-grained tokens don't have any scopes, their permissions are checked per repository
+	if metadata == nil || len(metadata.RepositoryPermissions) > 0 || len(metadata.Scopes) == 0 {
+		return nil
+	}
+
+	var missing []string
+	for _, req := range required {
+		granted := false
+		for _, s := range metadata.Scopes {
+			if Scope(s).Implies(Scope(req)) {
+				granted = true
+				break
+			}
+		}
+		if !granted {
+			missing = append(missing, req)
+		}
+	}
+	return missing
+}
+
+// webhookError converts the errors of the GitHub client to the ServiceProviderErrors if they come from the GitHub API.
+func webhookError(resp *github.Response, err error) error {
+	if resp != nil && resp.StatusCode >= 400 {
+		// the body of the response has already been consumed by the GitHub client, the error contains the message
+		return &sperrors.ServiceProviderError{StatusCode: resp.StatusCode, Response: err.Error()}
+	}
+	return fmt.Errorf("failed to manage the webhook: %w", err)
+}
+
 func (g *Github) MapToken(_ context.Context, _ *api.SPIAccessTokenBinding, token *api.SPIAccessToken, tokenData *api.Token) (serviceprovider.AccessTokenMapper, error) {
 	return serviceprovider.DefaultMapToken(token, tokenData)
 }
 
+// RevokeGrant revokes the access token obtained by the SPI OAuth application. Only the provided token is invalidated,
+// the other tokens the user has given to the application stay valid. The OAuth application is the one configured for
+// the namespace of the token if the Github was obtained using serviceprovider.Factory.FromRepoUrlInNamespace.
+func (g *Github) RevokeGrant(ctx context.Context, tokenData *api.Token) error {
+	spConfig := oauthConfiguration(g.Configuration)
+	if spConfig == nil {
+		return fmt.Errorf("no GitHub OAuth application is configured")
+	}
+
+	body, err := json.Marshal(map[string]string{"access_token": tokenData.AccessToken})
+	if err != nil {
+		return fmt.Errorf("failed to serialize the grant revocation request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "DELETE", apiUrl(spConfig)+"/applications/"+url.PathEscape(spConfig.ClientId)+"/token", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create the grant revocation request: %w", err)
+	}
+	req.SetBasicAuth(spConfig.ClientId, spConfig.ClientSecret)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to revoke the grant: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.FromContext(ctx).Error(err, "failed to close the response body")
+		}
+	}()
+
+	// GitHub responds with 404 if the token is unknown to the application, e.g. because it's already been revoked or
+	// because the token is a personal access token not obtained through the OAuth flow
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+
+	return sperrors.FromHttpResponse(resp)
+}
+
 type githubProbe struct{}
 
 var _ serviceprovider.Probe = (*githubProbe)(nil)
@@ -267,3 +586,31 @@ func (g githubProbe) Examine(_ *http.Client, url string) (string, error) {
 		return "", nil
 	}
 }
+
+// CurrentRateLimit returns the most restrictive rate limit of the REST and GraphQL APIs last reported by GitHub for
+// the token.
+func (g *Github) CurrentRateLimit(tokenData *api.Token) (serviceprovider.RateLimit, bool) {
+	key := g.rateLimitKey
+	key.Credentials = serviceprovider.RateLimitCredentials(tokenData.AccessToken)
+	return serviceprovider.RateLimits.GetMostRestrictive(key)
+}
+
+// apiUrl returns the URL of the REST API of the GitHub the OAuth application is configured for. That is either
+// the public GitHub or a GitHub Enterprise Server on the configured base URL.
+func apiUrl(spConfig *config.ServiceProviderConfiguration) string {
+	baseUrl := strings.TrimSuffix(spConfig.ServiceProviderBaseUrl, "/")
+	if baseUrl == "" || baseUrl == "https://github.com" {
+		return "https://api.github.com"
+	}
+	return baseUrl + "/api/v3"
+}
+
+// oauthConfiguration returns the configuration of the GitHub OAuth application or nil if none is configured.
+func oauthConfiguration(cfg config.Configuration) *config.ServiceProviderConfiguration {
+	for i := range cfg.ServiceProviders {
+		if cfg.ServiceProviders[i].ServiceProviderType == config.ServiceProviderTypeGitHub {
+			return &cfg.ServiceProviders[i]
+		}
+	}
+	return nil
+}
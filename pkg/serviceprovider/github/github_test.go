@@ -16,12 +16,18 @@ package github
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/util"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -67,28 +73,30 @@ func (t tokenStorageMock) Delete(ctx context.Context, owner *api.SPIAccessToken)
 	return nil
 }
 
-func TestCheckPublicRepo(t *testing.T) {
-	test := func(statusCode int, expected bool) {
-		t.Run(fmt.Sprintf("code %d => %t", statusCode, expected), func(t *testing.T) {
+func TestVisibility(t *testing.T) {
+	test := func(repoCode int, ownerCode int, expected serviceprovider.RepositoryVisibility) {
+		t.Run(fmt.Sprintf("codes %d, %d => %s", repoCode, ownerCode, expected), func(t *testing.T) {
 			gh := Github{httpClient: httpClientMock{
 				doFunc: func(req *http.Request) (*http.Response, error) {
-					return &http.Response{StatusCode: statusCode}, nil
+					if req.URL.Path == "/owner" {
+						return &http.Response{StatusCode: ownerCode}, nil
+					}
+					return &http.Response{StatusCode: repoCode}, nil
 				},
 			}}
-			spiAccessCheck := &api.SPIAccessCheck{Spec: api.SPIAccessCheckSpec{RepoUrl: "test"}}
 
-			publicRepo, err := gh.publicRepo(context.TODO(), spiAccessCheck)
+			visibility, err := gh.visibility(context.TODO(), "owner", "https://github.com/owner/repo")
 
 			assert.NoError(t, err)
-			assert.Equal(t, expected, publicRepo)
+			assert.Equal(t, expected, visibility)
 		})
 	}
 
-	test(200, true)
-	test(404, false)
-	test(403, false)
-	test(500, false)
-	test(666, false)
+	test(200, 200, serviceprovider.RepositoryVisibilityPublic)
+	test(404, 200, serviceprovider.RepositoryVisibilityPrivateOrNotFound)
+	test(404, 404, serviceprovider.RepositoryVisibilityNotFound)
+	test(403, 200, serviceprovider.RepositoryVisibilityPrivate)
+	test(500, 200, serviceprovider.RepositoryVisibilityUnknown)
 
 	t.Run("fail", func(t *testing.T) {
 		gh := Github{httpClient: httpClientMock{
@@ -96,12 +104,10 @@ func TestCheckPublicRepo(t *testing.T) {
 				return nil, fmt.Errorf("error")
 			},
 		}}
-		spiAccessCheck := &api.SPIAccessCheck{Spec: api.SPIAccessCheckSpec{RepoUrl: "test"}}
 
-		publicRepo, err := gh.publicRepo(context.TODO(), spiAccessCheck)
+		_, err := gh.visibility(context.TODO(), "owner", "https://github.com/owner/repo")
 
 		assert.Error(t, err)
-		assert.Equal(t, false, publicRepo)
 	})
 }
 
@@ -184,6 +190,31 @@ func TestCheckAccessPrivate(t *testing.T) {
 	assert.Equal(t, api.SPIRepoTypeGit, status.Type)
 	assert.Equal(t, api.ServiceProviderTypeGitHub, status.ServiceProvider)
 	assert.Equal(t, api.SPIAccessCheckAccessibilityUnknown, status.Accessibility)
+	assert.Equal(t, api.SPIAccessCheckErrorRepoNotFound, status.ErrorReason)
+}
+
+func TestCheckAccessPrivateOrMissing(t *testing.T) {
+	cl := mockK8sClient()
+	gh := mockGithub(cl, http.StatusNotFound, nil)
+	gh.httpClient = httpClientMock{
+		doFunc: func(req *http.Request) (*http.Response, error) {
+			if strings.Count(req.URL.Path, "/") == 1 {
+				// the owner exists
+				return &http.Response{StatusCode: http.StatusOK}, nil
+			}
+			return &http.Response{StatusCode: http.StatusNotFound}, nil
+		},
+	}
+	ac := api.SPIAccessCheck{
+		Spec: api.SPIAccessCheckSpec{RepoUrl: testValidRepoUrl},
+	}
+
+	status, err := gh.CheckRepositoryAccess(context.TODO(), cl, &ac)
+
+	assert.NoError(t, err)
+	assert.False(t, status.Accessible)
+	assert.Equal(t, api.SPIAccessCheckAccessibilityUnknown, status.Accessibility)
+	assert.Equal(t, api.SPIAccessCheckErrorAuthenticationRequired, status.ErrorReason)
 }
 
 func TestCheckAccessBadUrl(t *testing.T) {
@@ -253,7 +284,20 @@ func TestValidate(t *testing.T) {
 
 	assert.Equal(t, 1, len(res.ScopeValidation))
 	assert.NotNil(t, res.ScopeValidation[0])
-	assert.Equal(t, "unknown scope: 'blah'", res.ScopeValidation[0].Error())
+	assert.Equal(t, "unknown scope: 'blah'", errors.Unwrap(res.ScopeValidation[0]).Error())
+	assert.Contains(t, res.ScopeValidation[0].Error(), "see https://docs.github.com/en/apps/oauth-apps/building-oauth-apps/scopes-for-oauth-apps")
+}
+
+func TestValidateCredentials(t *testing.T) {
+	g := &Github{}
+
+	assert.NoError(t, g.ValidateCredentials(context.TODO(), &api.Token{AccessToken: "token"}))
+	assert.Error(t, g.ValidateCredentials(context.TODO(), &api.Token{}))
+	assert.Error(t, g.ValidateCredentials(context.TODO(), &api.Token{
+		Username:    "user",
+		AccessToken: "password",
+		TokenType:   api.BasicAuthTokenType,
+	}))
 }
 
 func mockGithub(cl client.Client, returnCode int, httpErr error) *Github {
@@ -286,3 +330,318 @@ func mockK8sClient(objects ...client.Object) client.WithWatch {
 	utilruntime.Must(api.AddToScheme(sch))
 	return fake.NewClientBuilder().WithScheme(sch).WithObjects(objects...).Build()
 }
+
+func TestGetAccessibleResources(t *testing.T) {
+	g := &Github{}
+
+	t.Run("no metadata", func(t *testing.T) {
+		res, err := g.GetAccessibleResources(context.TODO(), &api.SPIAccessToken{})
+		assert.NoError(t, err)
+		assert.Empty(t, res.Organizations)
+		assert.Empty(t, res.Repositories)
+	})
+
+	t.Run("lists repositories and their owners", func(t *testing.T) {
+		token := &api.SPIAccessToken{
+			Status: api.SPIAccessTokenStatus{
+				TokenMetadata: &api.TokenMetadata{
+					ServiceProviderState: []byte(`{"AccessibleRepos": {
+						"https://github.com/org/b": {"viewerPermission": "READ"},
+						"https://github.com/org/a": {"viewerPermission": "ADMIN"},
+						"https://github.com/user/c": {"viewerPermission": "WRITE"}
+					}}`),
+				},
+			},
+		}
+
+		res, err := g.GetAccessibleResources(context.TODO(), token)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"org", "user"}, res.Organizations)
+		assert.Equal(t, []string{"https://github.com/org/a", "https://github.com/org/b", "https://github.com/user/c"}, res.Repositories)
+	})
+
+	t.Run("invalid state", func(t *testing.T) {
+		_, err := g.GetAccessibleResources(context.TODO(), &api.SPIAccessToken{
+			Status: api.SPIAccessTokenStatus{
+				TokenMetadata: &api.TokenMetadata{ServiceProviderState: []byte("not json")},
+			},
+		})
+		assert.Error(t, err)
+	})
+}
+
+func TestValidateSuggestsScopes(t *testing.T) {
+	g := &Github{}
+
+	res, err := g.Validate(context.TODO(), &api.SPIAccessToken{
+		Spec: api.SPIAccessTokenSpec{
+			Permissions: api.Permissions{
+				AdditionalScopes: []string{"repo:stauts"},
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, len(res.ScopeValidation))
+	assert.Equal(t, "unknown scope: 'repo:stauts', did you mean 'repo:status'?", errors.Unwrap(res.ScopeValidation[0]).Error())
+}
+
+func TestScopeTranslations(t *testing.T) {
+	table := &serviceprovider.ScopeTranslationTable{}
+	table.Set(map[api.ServiceProviderType][]serviceprovider.ScopeTranslation{
+		api.ServiceProviderTypeGitHub: {
+			{Area: api.PermissionAreaRepository, Type: api.PermissionTypeRead, Scopes: []string{"repo:new"}},
+		},
+	})
+	g := &Github{scopeTranslations: table}
+
+	assert.Equal(t, []string{"repo:new"}, g.TranslateToScopes(api.Permission{Area: api.PermissionAreaRepository, Type: api.PermissionTypeRead}))
+	assert.Equal(t, []string{"repo"}, g.TranslateToScopes(api.Permission{Area: api.PermissionAreaRepository, Type: api.PermissionTypeWrite}))
+
+	res, err := g.Validate(context.TODO(), &api.SPIAccessToken{
+		Spec: api.SPIAccessTokenSpec{
+			Permissions: api.Permissions{
+				AdditionalScopes: []string{"repo:new"},
+			},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, res.ScopeValidation)
+}
+
+func TestRevokeGrant(t *testing.T) {
+	cfg := config.Configuration{
+		ServiceProviders: []config.ServiceProviderConfiguration{
+			{
+				ServiceProviderType: config.ServiceProviderTypeGitHub,
+				ClientId:            "clientId",
+				ClientSecret:        "clientSecret",
+			},
+		},
+	}
+
+	test := func(statusCode int, expectError bool) {
+		t.Run(fmt.Sprintf("code %d", statusCode), func(t *testing.T) {
+			var request *http.Request
+			var requestBody string
+			gh := Github{Configuration: cfg, httpClient: httpClientMock{
+				doFunc: func(req *http.Request) (*http.Response, error) {
+					request = req
+					body, _ := io.ReadAll(req.Body)
+					requestBody = string(body)
+					return &http.Response{StatusCode: statusCode, Body: io.NopCloser(strings.NewReader(""))}, nil
+				},
+			}}
+
+			err := gh.RevokeGrant(context.TODO(), &api.Token{AccessToken: "access"})
+			if expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, "DELETE", request.Method)
+			assert.Equal(t, "https://api.github.com/applications/clientId/token", request.URL.String())
+			user, pass, ok := request.BasicAuth()
+			assert.True(t, ok)
+			assert.Equal(t, "clientId", user)
+			assert.Equal(t, "clientSecret", pass)
+			assert.JSONEq(t, `{"access_token": "access"}`, requestBody)
+		})
+	}
+
+	test(http.StatusNoContent, false)
+	test(http.StatusNotFound, false)
+	test(http.StatusUnprocessableEntity, true)
+
+	t.Run("not configured", func(t *testing.T) {
+		gh := Github{}
+		assert.Error(t, gh.RevokeGrant(context.TODO(), &api.Token{AccessToken: "access"}))
+	})
+
+	t.Run("enterprise server", func(t *testing.T) {
+		var request *http.Request
+		gh := Github{
+			Configuration: config.Configuration{
+				ServiceProviders: []config.ServiceProviderConfiguration{
+					{
+						ServiceProviderType:    config.ServiceProviderTypeGitHub,
+						ServiceProviderBaseUrl: "https://ghe.acme.com/",
+						ClientId:               "enterpriseClientId",
+						ClientSecret:           "enterpriseClientSecret",
+					},
+				},
+			},
+			httpClient: httpClientMock{
+				doFunc: func(req *http.Request) (*http.Response, error) {
+					request = req
+					return &http.Response{StatusCode: http.StatusNoContent, Body: io.NopCloser(strings.NewReader(""))}, nil
+				},
+			},
+		}
+
+		assert.NoError(t, gh.RevokeGrant(context.TODO(), &api.Token{AccessToken: "access"}))
+		assert.Equal(t, "https://ghe.acme.com/api/v3/applications/enterpriseClientId/token", request.URL.String())
+		user, pass, _ := request.BasicAuth()
+		assert.Equal(t, "enterpriseClientId", user)
+		assert.Equal(t, "enterpriseClientSecret", pass)
+	})
+
+	t.Run("namespace override", func(t *testing.T) {
+		var request *http.Request
+		gh := Github{
+			Configuration: cfg.WithServiceProviderOverrides([]config.ServiceProviderConfiguration{
+				{
+					ServiceProviderType: config.ServiceProviderTypeGitHub,
+					ClientId:            "nsClientId",
+					ClientSecret:        "nsClientSecret",
+				},
+			}),
+			httpClient: httpClientMock{
+				doFunc: func(req *http.Request) (*http.Response, error) {
+					request = req
+					return &http.Response{StatusCode: http.StatusNoContent, Body: io.NopCloser(strings.NewReader(""))}, nil
+				},
+			},
+		}
+
+		assert.NoError(t, gh.RevokeGrant(context.TODO(), &api.Token{AccessToken: "access"}))
+		assert.Equal(t, "https://api.github.com/applications/nsClientId/token", request.URL.String())
+		user, pass, _ := request.BasicAuth()
+		assert.Equal(t, "nsClientId", user)
+		assert.Equal(t, "nsClientSecret", pass)
+	})
+}
+
+func TestListAccessibleRepositories(t *testing.T) {
+	g := &Github{
+		httpClient: &http.Client{
+			Transport: util.FakeRoundTrip(func(r *http.Request) (*http.Response, error) {
+				assert.Equal(t, "/user/repos", r.URL.Path)
+				assert.Equal(t, "2", r.URL.Query().Get("page"))
+				assert.Equal(t, "2", r.URL.Query().Get("per_page"))
+				assert.Equal(t, "Bearer blabol", r.Header.Get("Authorization"))
+
+				header := http.Header{}
+				header.Set("Link", `<https://api.github.com/user/repos?page=3&per_page=2>; rel="next"`)
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Header:     header,
+					Body:       io.NopCloser(strings.NewReader(`[{"html_url": "https://github.com/a/b"}, {"html_url": "https://github.com/a/c"}]`)),
+				}, nil
+			}),
+		},
+		tokenStorage: tokenStorageMock{getFunc: func(ctx context.Context, owner *api.SPIAccessToken) *api.Token {
+			return &api.Token{AccessToken: "blabol"}
+		}},
+	}
+
+	page, err := g.ListAccessibleRepositories(context.TODO(), &api.SPIAccessToken{}, 2, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://github.com/a/b", "https://github.com/a/c"}, page.Repositories)
+	assert.True(t, page.HasNextPage)
+}
+
+func TestEnsureWebhook(t *testing.T) {
+	requests := []string{}
+	g := &Github{
+		httpClient: &http.Client{
+			Transport: util.FakeRoundTrip(func(r *http.Request) (*http.Response, error) {
+				requests = append(requests, r.Method+" "+r.URL.Path)
+
+				if r.Method == http.MethodPatch {
+					return &http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(strings.NewReader(`{"message": "Not Found"}`))}, nil
+				}
+
+				body, err := io.ReadAll(r.Body)
+				assert.NoError(t, err)
+				assert.Contains(t, string(body), `"secret":"sssh"`)
+				assert.Contains(t, string(body), `"events":["push"]`)
+
+				return &http.Response{StatusCode: http.StatusCreated, Body: io.NopCloser(strings.NewReader(`{"id": 42}`))}, nil
+			}),
+		},
+		tokenStorage: tokenStorageMock{getFunc: func(ctx context.Context, owner *api.SPIAccessToken) *api.Token {
+			return &api.Token{AccessToken: "blabol"}
+		}},
+	}
+
+	// the webhook with the ID no longer exists and is therefore created again
+	id, err := g.EnsureWebhook(context.TODO(), &api.SPIAccessToken{}, testValidRepoUrl, "1", serviceprovider.Webhook{Url: "https://ci.acme.com", Secret: "sssh"})
+	assert.NoError(t, err)
+	assert.Equal(t, "42", id)
+	assert.Equal(t, []string{
+		"PATCH /repos/redhat-appstudio/service-provider-integration-operator/hooks/1",
+		"POST /repos/redhat-appstudio/service-provider-integration-operator/hooks",
+	}, requests)
+}
+
+func TestDeleteWebhook(t *testing.T) {
+	g := &Github{
+		httpClient: &http.Client{
+			Transport: util.FakeRoundTrip(func(r *http.Request) (*http.Response, error) {
+				assert.Equal(t, http.MethodDelete, r.Method)
+				assert.Equal(t, "/repos/redhat-appstudio/service-provider-integration-operator/hooks/42", r.URL.Path)
+				return &http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(strings.NewReader(`{"message": "Not Found"}`))}, nil
+			}),
+		},
+		tokenStorage: tokenStorageMock{getFunc: func(ctx context.Context, owner *api.SPIAccessToken) *api.Token {
+			return &api.Token{AccessToken: "blabol"}
+		}},
+	}
+
+	// deleting an already deleted webhook is not an error
+	assert.NoError(t, g.DeleteWebhook(context.TODO(), &api.SPIAccessToken{}, testValidRepoUrl, "42"))
+}
+
+func TestCanManageWebhooks(t *testing.T) {
+	g := &Github{}
+	tokenWith := func(scopes ...string) *api.SPIAccessToken {
+		return &api.SPIAccessToken{Status: api.SPIAccessTokenStatus{TokenMetadata: &api.TokenMetadata{Scopes: scopes}}}
+	}
+
+	assert.True(t, g.CanManageWebhooks(tokenWith("repo")))
+	assert.True(t, g.CanManageWebhooks(tokenWith("read:user", "admin:repo_hook")))
+	assert.True(t, g.CanManageWebhooks(tokenWith("write:repo_hook")))
+	assert.False(t, g.CanManageWebhooks(tokenWith("read:repo_hook")))
+	assert.False(t, g.CanManageWebhooks(tokenWith("public_repo")))
+	assert.False(t, g.CanManageWebhooks(&api.SPIAccessToken{}))
+}
+
+func TestMissingScopes(t *testing.T) {
+	g := &Github{}
+	tokenWith := func(scopes ...string) *api.SPIAccessToken {
+		return &api.SPIAccessToken{Status: api.SPIAccessTokenStatus{TokenMetadata: &api.TokenMetadata{Scopes: scopes}}}
+	}
+
+	assert.Empty(t, g.MissingScopes(tokenWith("repo", "read:user"), []string{"repo:status", "public_repo", "user:email"}))
+	assert.Equal(t, []string{"delete_repo", "write:repo_hook"}, g.MissingScopes(tokenWith("repo", "read:repo_hook"), []string{"repo", "delete_repo", "write:repo_hook"}))
+	assert.Nil(t, g.MissingScopes(tokenWith(), []string{"repo"}))
+	assert.Nil(t, g.MissingScopes(&api.SPIAccessToken{}, []string{"repo"}))
+
+	fineGrained := tokenWith()
+	fineGrained.Status.TokenMetadata.RepositoryPermissions = map[string]api.RepositoryPermissions{"https://github.com/o/r": {"contents": "read"}}
+	assert.Nil(t, g.MissingScopes(fineGrained, []string{"repo"}))
+}
+
+func TestCurrentRateLimit(t *testing.T) {
+	key := serviceprovider.RateLimitKey{ServiceProviderType: api.ServiceProviderTypeGitHub, ClientId: "rateLimitClientId"}
+	g := &Github{rateLimitKey: key}
+
+	exhaustedKey := key
+	exhaustedKey.Credentials = serviceprovider.RateLimitCredentials("exhausted")
+	exhaustedKey.Api = "core"
+	serviceprovider.RateLimits.Observe(exhaustedKey, &http.Response{Header: http.Header{
+		"X-Ratelimit-Remaining": []string{"0"},
+		"X-Ratelimit-Reset":     []string{strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)},
+	}})
+
+	limit, ok := g.CurrentRateLimit(&api.Token{AccessToken: "exhausted"})
+	assert.True(t, ok)
+	assert.Equal(t, 0, limit.Remaining)
+	assert.Greater(t, serviceprovider.ThrottlingDelay(g, &api.Token{AccessToken: "exhausted"}, 100), time.Duration(0))
+
+	_, ok = g.CurrentRateLimit(&api.Token{AccessToken: "other"})
+	assert.False(t, ok)
+	assert.Equal(t, time.Duration(0), serviceprovider.ThrottlingDelay(g, &api.Token{AccessToken: "other"}, 100))
+}
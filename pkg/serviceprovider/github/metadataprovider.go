@@ -68,7 +68,7 @@ func (s metadataProvider) Fetch(ctx context.Context, token *api.SPIAccessToken)
 		return nil, err
 	}
 
-	js, err := json.Marshal(state)
+	js, err := stateSchema.Marshal(state)
 	if err != nil {
 		return nil, err
 	}
@@ -80,6 +80,12 @@ func (s metadataProvider) Fetch(ctx context.Context, token *api.SPIAccessToken)
 	metadata.Scopes = scopes
 	metadata.ServiceProviderState = js
 
+	if isFineGrainedToken(data.AccessToken) {
+		if metadata.RepositoryPermissions, err = s.fetchRepositoryPermissions(ctx, data.AccessToken, state.AccessibleRepos); err != nil {
+			return nil, err
+		}
+	}
+
 	return metadata, nil
 }
 
@@ -105,12 +111,11 @@ func (s metadataProvider) fetchUserAndScopes(accessToken string) (userName strin
 	}
 
 	// https://docs.github.com/en/developers/apps/building-oauth-apps/scopes-for-oauth-apps
-	scopesString := res.Header.Get("x-oauth-scopes")
-
-	untrimmedScopes := strings.Split(scopesString, ",")
-
-	for _, s := range untrimmedScopes {
-		scopes = append(scopes, strings.TrimSpace(s))
+	// the header is empty for the fine-grained tokens that have no scopes
+	if scopesString := res.Header.Get("x-oauth-scopes"); scopesString != "" {
+		for _, s := range strings.Split(scopesString, ",") {
+			scopes = append(scopes, strings.TrimSpace(s))
+		}
 	}
 
 	content := map[string]interface{}{}
@@ -17,7 +17,6 @@ package github
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"io/ioutil"
 	"net/http"
 	"testing"
@@ -79,13 +78,62 @@ func TestMetadataProvider_Fetch(t *testing.T) {
 	assert.NotEmpty(t, data.ServiceProviderState)
 
 	tokenState := &TokenState{}
-	assert.NoError(t, json.Unmarshal(data.ServiceProviderState, tokenState))
+	assert.NoError(t, stateSchema.Unmarshal(data.ServiceProviderState, tokenState))
 	assert.Equal(t, 4, len(tokenState.AccessibleRepos))
 	val, ok := tokenState.AccessibleRepos["https://github.com/eclipse/manifest"]
 	assert.True(t, ok)
 	assert.Equal(t, RepositoryRecord{ViewerPermission: "READ"}, val)
 }
 
+func TestMetadataProvider_Fetch_fineGrained(t *testing.T) {
+	httpCl := &http.Client{
+		Transport: util.FakeRoundTrip(func(r *http.Request) (*http.Response, error) {
+			if r.URL == githubUserApiEndpoint {
+				return &http.Response{
+					StatusCode: 200,
+					Body:       ioutil.NopCloser(bytes.NewBuffer([]byte(`{"id": 42, "login": "test_user"}`))),
+				}, nil
+			} else if r.URL.Host == "api.github.com" {
+				status := http.StatusForbidden
+				if r.Method == http.MethodGet && r.URL.Path == "/repos/eclipse/manifest/commits" {
+					status = http.StatusOK
+				}
+				return &http.Response{
+					StatusCode: status,
+					Body:       ioutil.NopCloser(bytes.NewBuffer([]byte(`{}`))),
+				}, nil
+			} else {
+				return &http.Response{
+					StatusCode: 200,
+					Body:       ioutil.NopCloser(bytes.NewBuffer([]byte(repositoriesOwnerAffiliationsFakeResponse))),
+				}, nil
+			}
+		}),
+	}
+
+	ts := tokenstorage.TestTokenStorage{
+		GetImpl: func(ctx context.Context, token *api.SPIAccessToken) (*api.Token, error) {
+			return &api.Token{AccessToken: "github_pat_access"}, nil
+		},
+	}
+
+	mp := metadataProvider{
+		graphqlClient: graphql.NewClient("", graphql.WithHTTPClient(httpCl)),
+		httpClient:    httpCl,
+		tokenStorage:  &ts,
+	}
+
+	data, err := mp.Fetch(context.TODO(), &api.SPIAccessToken{})
+	assert.NoError(t, err)
+
+	assert.NotNil(t, data)
+	assert.Equal(t, "test_user", data.Username)
+	assert.Empty(t, data.Scopes)
+	assert.Len(t, data.RepositoryPermissions, 4)
+	assert.Equal(t, api.RepositoryPermissions{"metadata": "read", "contents": "read"}, data.RepositoryPermissions["https://github.com/eclipse/manifest"])
+	assert.Equal(t, api.RepositoryPermissions{"metadata": "read"}, data.RepositoryPermissions["https://github.com/eclipse/jdtc"])
+}
+
 func TestMetadataProvider_Fetch_fail(t *testing.T) {
 	httpCl := &http.Client{
 		Transport: util.FakeRoundTrip(func(r *http.Request) (*http.Response, error) {
@@ -0,0 +1,60 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-github/v43/github"
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+)
+
+// errRefNotFound is returned by resolveRef when the repository has no such ref.
+var errRefNotFound = fmt.Errorf("ref not found")
+
+// resolveRef finds the SHA of the commit the provided ref (a branch, a tag or a commit) points to in the repository and
+// determines the type of the ref. For the branches, it also finds out whether they're protected. errRefNotFound is
+// returned if the repository has no such ref.
+func resolveRef(ctx context.Context, ghClient *github.Client, owner, repo, ref string) (*api.SPIAccessCheckRefStatus, error) {
+	sha, resp, err := ghClient.Repositories.GetCommitSHA1(ctx, owner, repo, ref, "")
+	if err != nil {
+		if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusUnprocessableEntity) {
+			return nil, errRefNotFound
+		}
+		return nil, fmt.Errorf("failed to resolve the ref '%s': %w", ref, err)
+	}
+
+	status := &api.SPIAccessCheckRefStatus{Name: ref, Type: api.SPIAccessCheckRefTypeCommit, Sha: sha}
+
+	branch, resp, err := ghClient.Repositories.GetBranch(ctx, owner, repo, ref, false)
+	if err == nil {
+		status.Type = api.SPIAccessCheckRefTypeBranch
+		status.Protected = branch.GetProtected()
+		return status, nil
+	} else if resp == nil || resp.StatusCode != http.StatusNotFound {
+		return nil, fmt.Errorf("failed to read the branch '%s': %w", ref, err)
+	}
+
+	_, resp, err = ghClient.Git.GetRef(ctx, owner, repo, "tags/"+ref)
+	if err == nil {
+		status.Type = api.SPIAccessCheckRefTypeTag
+	} else if resp == nil || resp.StatusCode != http.StatusNotFound {
+		return nil, fmt.Errorf("failed to read the tag '%s': %w", ref, err)
+	}
+
+	return status, nil
+}
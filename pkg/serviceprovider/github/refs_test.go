@@ -0,0 +1,116 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v43/github"
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRefsClient returns an HTTP client responding to the GitHub API requests for the provided paths with the provided
+// bodies and with 404 for the other paths.
+func fakeRefsClient(responses map[string]string) *http.Client {
+	return &http.Client{
+		Transport: util.FakeRoundTrip(func(r *http.Request) (*http.Response, error) {
+			body, ok := responses[r.URL.Path]
+			if !ok {
+				return &http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(strings.NewReader(`{"message": "Not Found"}`)), Request: r}, nil
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body)), Request: r}, nil
+		}),
+	}
+}
+
+func TestResolveRef(t *testing.T) {
+	const sha = "0123456789abcdef0123456789abcdef01234567"
+
+	t.Run("branch", func(t *testing.T) {
+		ghClient := github.NewClient(fakeRefsClient(map[string]string{
+			"/repos/org/repo/commits/main":  sha,
+			"/repos/org/repo/branches/main": `{"name": "main", "protected": true}`,
+		}))
+
+		status, err := resolveRef(context.TODO(), ghClient, "org", "repo", "main")
+		assert.NoError(t, err)
+		assert.Equal(t, &api.SPIAccessCheckRefStatus{Name: "main", Type: api.SPIAccessCheckRefTypeBranch, Sha: sha, Protected: true}, status)
+	})
+
+	t.Run("tag", func(t *testing.T) {
+		ghClient := github.NewClient(fakeRefsClient(map[string]string{
+			"/repos/org/repo/commits/v1.0":      sha,
+			"/repos/org/repo/git/ref/tags/v1.0": `{"ref": "refs/tags/v1.0"}`,
+		}))
+
+		status, err := resolveRef(context.TODO(), ghClient, "org", "repo", "v1.0")
+		assert.NoError(t, err)
+		assert.Equal(t, &api.SPIAccessCheckRefStatus{Name: "v1.0", Type: api.SPIAccessCheckRefTypeTag, Sha: sha}, status)
+	})
+
+	t.Run("commit", func(t *testing.T) {
+		ghClient := github.NewClient(fakeRefsClient(map[string]string{
+			"/repos/org/repo/commits/0123456": sha,
+		}))
+
+		status, err := resolveRef(context.TODO(), ghClient, "org", "repo", "0123456")
+		assert.NoError(t, err)
+		assert.Equal(t, &api.SPIAccessCheckRefStatus{Name: "0123456", Type: api.SPIAccessCheckRefTypeCommit, Sha: sha}, status)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		ghClient := github.NewClient(fakeRefsClient(map[string]string{}))
+
+		_, err := resolveRef(context.TODO(), ghClient, "org", "repo", "nope")
+		assert.ErrorIs(t, err, errRefNotFound)
+	})
+}
+
+func TestCheckAccessRef(t *testing.T) {
+	cl := mockK8sClient()
+	gh := &Github{
+		httpClient: fakeRefsClient(map[string]string{
+			"/redhat-appstudio/service-provider-integration-operator":                     "",
+			"/repos/redhat-appstudio/service-provider-integration-operator/commits/main":  "0123456789abcdef0123456789abcdef01234567",
+			"/repos/redhat-appstudio/service-provider-integration-operator/branches/main": `{"name": "main"}`,
+		}),
+		lookup: mockGithub(cl, http.StatusOK, nil).lookup,
+	}
+
+	t.Run("resolved", func(t *testing.T) {
+		status, err := gh.CheckRepositoryAccess(context.TODO(), cl, &api.SPIAccessCheck{
+			Spec: api.SPIAccessCheckSpec{RepoUrl: testValidRepoUrl, Ref: "main"},
+		})
+		assert.NoError(t, err)
+		assert.True(t, status.Accessible)
+		assert.Equal(t, &api.SPIAccessCheckRefStatus{Name: "main", Type: api.SPIAccessCheckRefTypeBranch, Sha: "0123456789abcdef0123456789abcdef01234567"}, status.Ref)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		status, err := gh.CheckRepositoryAccess(context.TODO(), cl, &api.SPIAccessCheck{
+			Spec: api.SPIAccessCheckSpec{RepoUrl: testValidRepoUrl, Ref: "missing"},
+		})
+		assert.NoError(t, err)
+		assert.False(t, status.Accessible)
+		assert.Equal(t, api.SPIAccessCheckErrorRefNotFound, status.ErrorReason)
+		assert.Nil(t, status.Ref)
+	})
+}
@@ -16,6 +16,8 @@ package github
 
 import (
 	"strings"
+
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
 )
 
 type RepositoryUrl string
@@ -72,6 +74,10 @@ type TokenState struct {
 	AccessibleRepos map[RepositoryUrl]RepositoryRecord
 }
 
+// stateSchema is the schema of the serialized TokenState. Bump the version and add a migration from the previous
+// version whenever the form of the TokenState changes.
+var stateSchema = serviceprovider.StateSchema{Version: 1}
+
 func (s Scope) Implies(other Scope) bool {
 	if s == other {
 		return true
@@ -122,45 +128,50 @@ func (s Scope) Implies(other Scope) bool {
 	return false
 }
 
+// validScopes is the list of all the scopes known to GitHub
+var validScopes = []string{
+	string(ScopeRepo),
+	string(ScopeRepoStatus),
+	string(ScopeRepoDeployment),
+	string(ScopePublicRepo),
+	string(ScopeRepoInvite),
+	string(ScopeSecurityEvent),
+	string(ScopeAdminRepoHook),
+	string(ScopeWriteRepoHook),
+	string(ScopeReadRepoHook),
+	string(ScopeAdminOrg),
+	string(ScopeWriteOrg),
+	string(ScopeReadOrg),
+	string(ScopeAdminPublicKey),
+	string(ScopeWritePublicKey),
+	string(ScopeReadPublicKey),
+	string(ScopeAdminOrgHook),
+	string(ScopeGist),
+	string(ScopeNotifications),
+	string(ScopeUser),
+	string(ScopeReadUser),
+	string(ScopeUserEmail),
+	string(ScopeUserFollow),
+	string(ScopeDeleteRepo),
+	string(ScopeWriteDiscussion),
+	string(ScopeReadDiscussion),
+	string(ScopeWritePackages),
+	string(ScopeReadPackages),
+	string(ScopeDeletePackages),
+	string(ScopeAdminGpgKey),
+	string(ScopeWriteGpgKey),
+	string(ScopeReadGpgKey),
+	string(ScopeCodespace),
+	string(ScopeWorkflow),
+}
+
 func IsValidScope(scope string) bool {
-	switch Scope(scope) {
-	case ScopeRepo,
-		ScopeRepoStatus,
-		ScopeRepoDeployment,
-		ScopePublicRepo,
-		ScopeRepoInvite,
-		ScopeSecurityEvent,
-		ScopeAdminRepoHook,
-		ScopeWriteRepoHook,
-		ScopeReadRepoHook,
-		ScopeAdminOrg,
-		ScopeWriteOrg,
-		ScopeReadOrg,
-		ScopeAdminPublicKey,
-		ScopeWritePublicKey,
-		ScopeReadPublicKey,
-		ScopeAdminOrgHook,
-		ScopeGist,
-		ScopeNotifications,
-		ScopeUser,
-		ScopeReadUser,
-		ScopeUserEmail,
-		ScopeUserFollow,
-		ScopeDeleteRepo,
-		ScopeWriteDiscussion,
-		ScopeReadDiscussion,
-		ScopeWritePackages,
-		ScopeReadPackages,
-		ScopeDeletePackages,
-		ScopeAdminGpgKey,
-		ScopeWriteGpgKey,
-		ScopeReadGpgKey,
-		ScopeCodespace,
-		ScopeWorkflow:
-		return true
-	default:
-		return false
+	for _, s := range validScopes {
+		if s == scope {
+			return true
+		}
 	}
+	return false
 }
 
 func (vp ViewerPermission) Enables(scope Scope) bool {
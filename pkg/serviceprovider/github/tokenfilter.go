@@ -16,28 +16,38 @@ package github
 
 import (
 	"context"
-	"encoding/json"
 
 	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
 	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
 )
 
-type tokenFilter struct{}
+type tokenFilter struct {
+	// scopeTranslations are used to translate the required permissions to the scopes.
+	scopeTranslations *serviceprovider.ScopeTranslationTable
+}
+
+var _ serviceprovider.ScopeTranslatingTokenFilter = (*tokenFilter)(nil)
 
-var _ serviceprovider.TokenFilter = (*tokenFilter)(nil)
+func (t *tokenFilter) WithScopeTranslations(table *serviceprovider.ScopeTranslationTable) serviceprovider.TokenFilter {
+	return &tokenFilter{scopeTranslations: table}
+}
 
 func (t *tokenFilter) Matches(_ context.Context, matchable serviceprovider.Matchable, token *api.SPIAccessToken) (bool, error) {
 	if token.Status.TokenMetadata == nil {
 		return false, nil
 	}
 
+	if token.Status.TokenMetadata.RepositoryPermissions != nil {
+		return fineGrainedPermsMatch(matchable.Permissions(), token.Status.TokenMetadata.RepositoryPermissions[matchable.RepoUrl()]), nil
+	}
+
 	githubState := TokenState{}
-	if err := json.Unmarshal(token.Status.TokenMetadata.ServiceProviderState, &githubState); err != nil {
+	if err := stateSchema.Unmarshal(token.Status.TokenMetadata.ServiceProviderState, &githubState); err != nil {
 		return false, err
 	}
 
 	for repoUrl, rec := range githubState.AccessibleRepos {
-		if string(repoUrl) == matchable.RepoUrl() && permsMatch(matchable.Permissions(), rec, token.Status.TokenMetadata.Scopes) {
+		if string(repoUrl) == matchable.RepoUrl() && t.permsMatch(matchable.Permissions(), rec, token.Status.TokenMetadata.Scopes) {
 			return true, nil
 		}
 	}
@@ -45,8 +55,10 @@ func (t *tokenFilter) Matches(_ context.Context, matchable serviceprovider.Match
 	return false, nil
 }
 
-func permsMatch(perms *api.Permissions, rec RepositoryRecord, tokenScopes []string) bool {
-	requiredScopes := serviceprovider.GetAllScopes(translateToScopes, perms)
+func (t *tokenFilter) permsMatch(perms *api.Permissions, rec RepositoryRecord, tokenScopes []string) bool {
+	requiredScopes := serviceprovider.GetAllScopes(func(permission api.Permission) []string {
+		return translateToScopes(t.scopeTranslations, permission)
+	}, perms)
 
 	hasScope := func(scope Scope) bool {
 		for _, s := range tokenScopes {
@@ -20,6 +20,7 @@ import (
 	"testing"
 
 	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -70,6 +71,35 @@ func TestTokenFilter_Matches(t *testing.T) {
 			true)
 	})
 
+	t.Run("fine-grained token by repo permissions", func(t *testing.T) {
+		token := &api.SPIAccessToken{
+			Status: api.SPIAccessTokenStatus{
+				TokenMetadata: &api.TokenMetadata{
+					Username: "you",
+					UserId:   "42",
+					RepositoryPermissions: map[string]api.RepositoryPermissions{
+						"my-repo": {"metadata": "read", "contents": "read"},
+					},
+				},
+			},
+		}
+
+		binding := func(repoUrl string, permissionType api.PermissionType) *api.SPIAccessTokenBinding {
+			return &api.SPIAccessTokenBinding{
+				Spec: api.SPIAccessTokenBindingSpec{
+					RepoUrl: repoUrl,
+					Permissions: api.Permissions{
+						Required: []api.Permission{{Area: api.PermissionAreaRepository, Type: permissionType}},
+					},
+				},
+			}
+		}
+
+		test(t, binding("my-repo", api.PermissionTypeRead), token, true)
+		test(t, binding("my-repo", api.PermissionTypeWrite), token, false)
+		test(t, binding("other-repo", api.PermissionTypeRead), token, false)
+	})
+
 	t.Run("by repo and scopes", func(t *testing.T) {
 		ts, err := json.Marshal(&TokenState{
 			AccessibleRepos: map[RepositoryUrl]RepositoryRecord{
@@ -120,3 +150,45 @@ func TestTokenFilter_Matches(t *testing.T) {
 		test(t, binding, nonMatchingToken, false)
 	})
 }
+
+func TestTokenFilter_WithScopeTranslations(t *testing.T) {
+	ts, err := json.Marshal(&TokenState{
+		AccessibleRepos: map[RepositoryUrl]RepositoryRecord{
+			"my-repo": {ViewerPermission: ViewerPermissionAdmin},
+		},
+	})
+	assert.NoError(t, err)
+
+	binding := &api.SPIAccessTokenBinding{
+		Spec: api.SPIAccessTokenBindingSpec{
+			RepoUrl: "my-repo",
+			Permissions: api.Permissions{
+				Required: []api.Permission{{Area: api.PermissionAreaRepository, Type: api.PermissionTypeRead}},
+			},
+		},
+	}
+	token := &api.SPIAccessToken{
+		Status: api.SPIAccessTokenStatus{
+			TokenMetadata: &api.TokenMetadata{
+				Scopes:               []string{"public_repo"},
+				ServiceProviderState: ts,
+			},
+		},
+	}
+
+	// the builtin translation requires the "repo" scope
+	res, err := (&tokenFilter{}).Matches(context.TODO(), binding, token)
+	assert.NoError(t, err)
+	assert.False(t, res)
+
+	table := &serviceprovider.ScopeTranslationTable{}
+	table.Set(map[api.ServiceProviderType][]serviceprovider.ScopeTranslation{
+		api.ServiceProviderTypeGitHub: {
+			{Area: api.PermissionAreaRepository, Type: api.PermissionTypeRead, Scopes: []string{"public_repo"}},
+		},
+	})
+
+	res, err = (&tokenFilter{}).WithScopeTranslations(table).Matches(context.TODO(), binding, token)
+	assert.NoError(t, err)
+	assert.True(t, res)
+}
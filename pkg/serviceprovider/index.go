@@ -0,0 +1,68 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serviceprovider
+
+import (
+	"context"
+	"net/url"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// TokenServiceProviderHostIndex is the name of the field index of the SPIAccessTokens by the host of their service
+// provider URL. Unlike the api.ServiceProviderHostLabel that is only set once the token is reconciled, the index is
+// available for all the tokens as soon as they are created.
+const TokenServiceProviderHostIndex = "spec.serviceProviderUrl.host"
+
+// RegisterTokenIndexes registers the field indexes of SPIAccessTokens with the provided indexer. This needs to be done
+// before the manager (and its cache) is started. The index makes it possible to only list the tokens of a certain
+// service provider host using the client.MatchingFields list option. Note that the cache only supports listing by
+// a single field index at a time.
+func RegisterTokenIndexes(ctx context.Context, indexer client.FieldIndexer) error {
+	return indexer.IndexField(ctx, &api.SPIAccessToken{}, TokenServiceProviderHostIndex, tokenServiceProviderHost)
+}
+
+// isTokenOfServiceProvider checks that the token belongs to the service provider of the provided type and host. It
+// is used to filter the listed tokens in memory, because not all the clients support the field index.
+func isTokenOfServiceProvider(token *api.SPIAccessToken, spType api.ServiceProviderType, host string) bool {
+	hosts := tokenServiceProviderHost(token)
+	types := tokenServiceProviderType(token)
+	return len(hosts) == 1 && hosts[0] == host && len(types) == 1 && types[0] == string(spType)
+}
+
+func tokenServiceProviderHost(obj client.Object) []string {
+	token, ok := obj.(*api.SPIAccessToken)
+	if !ok || token.Spec.ServiceProviderUrl == "" {
+		return nil
+	}
+
+	// this is consistent with how the host label is computed in the api.SPIAccessToken.EnsureLabels method.
+	spUrl, err := url.Parse(token.Spec.ServiceProviderUrl)
+	if err != nil || spUrl.Host == "" {
+		return nil
+	}
+
+	return []string{spUrl.Host}
+}
+
+func tokenServiceProviderType(obj client.Object) []string {
+	spType := obj.GetLabels()[api.ServiceProviderTypeLabel]
+	if spType == "" {
+		return nil
+	}
+
+	return []string{spType}
+}
@@ -0,0 +1,51 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serviceprovider
+
+import (
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTokenServiceProviderHost(t *testing.T) {
+	test := func(spUrl string) []string {
+		return tokenServiceProviderHost(&api.SPIAccessToken{
+			Spec: api.SPIAccessTokenSpec{
+				ServiceProviderUrl: spUrl,
+			},
+		})
+	}
+
+	assert.Equal(t, []string{"github.com"}, test("https://github.com"))
+	assert.Equal(t, []string{"quay.io"}, test("https://quay.io/"))
+	assert.Equal(t, []string{"sp.acme:8443"}, test("https://sp.acme:8443/path"))
+	assert.Nil(t, test(""))
+	assert.Nil(t, test("not a url"))
+	assert.Nil(t, test(":::"))
+}
+
+func TestTokenServiceProviderType(t *testing.T) {
+	assert.Equal(t, []string{"GitHub"}, tokenServiceProviderType(&api.SPIAccessToken{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{
+				api.ServiceProviderTypeLabel: "GitHub",
+			},
+		},
+	}))
+	assert.Nil(t, tokenServiceProviderType(&api.SPIAccessToken{}))
+}
@@ -14,7 +14,10 @@
 
 package serviceprovider
 
-import "net/http"
+import (
+	"net/http"
+	"strings"
+)
 
 // Probe is a simple function that can determine whether a URL can be handled by a certain service
 // provider.
@@ -42,6 +45,22 @@ type ConstructorFunc func(factory *Factory, baseUrl string) (ServiceProvider, er
 type Initializer struct {
 	Probe       Probe
 	Constructor Constructor
+	// OfflineTokenFilter is the TokenFilter that only uses the metadata cached in the tokens and doesn't need access to
+	// the cluster or the service provider. It is used to match the tokens offline. Can be nil if the service provider
+	// doesn't support it.
+	OfflineTokenFilter TokenFilter
+	// EgressEndpoints are the "host:port" network endpoints the service provider needs to reach when no custom base
+	// URL is configured for it.
+	EgressEndpoints []string
+	// ConfiguredBaseUrlOnly is true for the service providers without any well-known base URL. Such service providers
+	// have no Probe and the URLs are matched against the base URLs in their configuration instead.
+	ConfiguredBaseUrlOnly bool
+	// NoNetworkAccess is true for the service providers that never contact their base URL, so that it is not reported
+	// as an egress endpoint.
+	NoNetworkAccess bool
+	// StateSchema describes the versions of the ServiceProviderState that the service provider stores in the token
+	// metadata. It is nil for the service providers that store no state.
+	StateSchema *StateSchema
 }
 
 // implementation guards
@@ -52,6 +71,30 @@ func (p ProbeFunc) Examine(cl *http.Client, url string) (string, error) {
 	return p(cl, url)
 }
 
+// ProbeFor returns the probe recognizing the URLs of the service provider configured with the provided base URL. That is
+// the configured base URL itself for the service providers without any well-known base URL and the Probe otherwise.
+func (i Initializer) ProbeFor(baseUrl string) Probe {
+	if i.ConfiguredBaseUrlOnly {
+		return configuredBaseUrlProbe(baseUrl)
+	}
+	return i.Probe
+}
+
+// configuredBaseUrlProbe returns a probe recognizing the URLs starting with the provided base URL. The OCI URLs
+// (e.g. of the Helm charts) are recognized as if they had the scheme of the base URL.
+func configuredBaseUrlProbe(baseUrl string) Probe {
+	baseUrl = strings.TrimSuffix(baseUrl, "/")
+	return ProbeFunc(func(_ *http.Client, url string) (string, error) {
+		if i := strings.Index(baseUrl, "://"); i > 0 && strings.HasPrefix(url, "oci://") {
+			url = baseUrl[:i] + strings.TrimPrefix(url, "oci")
+		}
+		if baseUrl != "" && (url == baseUrl || strings.HasPrefix(url, baseUrl+"/")) {
+			return baseUrl, nil
+		}
+		return "", nil
+	})
+}
+
 func (c ConstructorFunc) Construct(factory *Factory, baseUrl string) (ServiceProvider, error) {
 	return c(factory, baseUrl)
 }
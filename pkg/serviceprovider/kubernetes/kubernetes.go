@@ -0,0 +1,228 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubernetes
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"strings"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/httptransport"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// caDataKey is the key in the extra configuration of the service provider with the PEM-encoded certificates of the CAs
+// trusted for the API server of the cluster. The system CAs are used if not specified.
+const caDataKey = "caData"
+
+var _ serviceprovider.ServiceProvider = (*Kubernetes)(nil)
+var _ serviceprovider.CredentialsInspector = (*Kubernetes)(nil)
+
+// Kubernetes is the service provider for another Kubernetes cluster. The tokens are the bearer tokens (typically of
+// service accounts) for the API server of the cluster. There is no OAuth flow, so the token data can only be uploaded.
+// The uploaded tokens are validated using the TokenReview API of the cluster, called with the token configured as
+// the clientSecret of the service provider.
+type Kubernetes struct {
+	lookup   serviceprovider.GenericLookup
+	reviewer *tokenReviewer
+	baseUrl  string
+}
+
+var Initializer = serviceprovider.Initializer{
+	Constructor:           serviceprovider.ConstructorFunc(newKubernetes),
+	OfflineTokenFilter:    &offlineTokenFilter{},
+	ConfiguredBaseUrlOnly: true,
+}
+
+func newKubernetes(factory *serviceprovider.Factory, baseUrl string) (serviceprovider.ServiceProvider, error) {
+	cfg := factory.Configuration.Get()
+	spConfig := clusterConfiguration(cfg, baseUrl)
+	if spConfig == nil {
+		return nil, fmt.Errorf("no Kubernetes service provider is configured for %s", baseUrl)
+	}
+
+	httpClient, err := clusterHttpClient(factory.HttpClient, spConfig.Extra[caDataKey])
+	if err != nil {
+		return nil, err
+	}
+
+	reviewer := &tokenReviewer{
+		httpClient:    httpClient,
+		baseUrl:       baseUrl,
+		reviewerToken: spConfig.ClientSecret,
+	}
+
+	cache := serviceprovider.NewMetadataCache(factory.KubernetesClient, &serviceprovider.TtlMetadataExpirationPolicy{Ttl: cfg.TokenLookupCacheTtl})
+
+	return &Kubernetes{
+		lookup: serviceprovider.GenericLookup{
+			ServiceProviderType: api.ServiceProviderTypeKubernetes,
+			TokenFilter: &tokenFilter{
+				tokenStorage: factory.TokenStorage,
+				reviewer:     reviewer,
+			},
+			MetadataProvider: &metadataProvider{
+				tokenStorage: factory.TokenStorage,
+				reviewer:     reviewer,
+			},
+			MetadataCache:  &cache,
+			RepoHostParser: serviceprovider.RepoHostParserFunc(serviceprovider.RepoHostFromUrl),
+			Concurrency:    factory.Configuration.Get().TokenLookupConcurrency,
+		},
+		reviewer: reviewer,
+		baseUrl:  baseUrl,
+	}, nil
+}
+
+var _ serviceprovider.ConstructorFunc = newKubernetes
+
+// clusterConfiguration finds the configuration of the Kubernetes service provider with the provided base URL.
+func clusterConfiguration(cfg config.Configuration, baseUrl string) *config.ServiceProviderConfiguration {
+	for i := range cfg.ServiceProviders {
+		spc := &cfg.ServiceProviders[i]
+		if spc.ServiceProviderType == config.ServiceProviderTypeKubernetes && strings.TrimSuffix(spc.ServiceProviderBaseUrl, "/") == baseUrl {
+			return spc
+		}
+	}
+	return nil
+}
+
+// clusterHttpClient returns the HTTP client trusting the provided CA certificates or the provided client if there are
+// none.
+func clusterHttpClient(cl *http.Client, caData string) (*http.Client, error) {
+	if caData == "" {
+		return cl, nil
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(caData)) {
+		return nil, fmt.Errorf("no valid PEM-encoded certificates found in the %s of the Kubernetes service provider", caDataKey)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+
+	return &http.Client{
+		// keep the guarding, the User-Agent and the tagging of the requests to the service providers
+		Transport:     httptransport.WithTransport(cl.Transport, transport),
+		CheckRedirect: cl.CheckRedirect,
+		Jar:           cl.Jar,
+		Timeout:       cl.Timeout,
+	}, nil
+}
+
+func (k *Kubernetes) LookupToken(ctx context.Context, cl client.Client, binding *api.SPIAccessTokenBinding) (*api.SPIAccessToken, error) {
+	return k.lookup.LookupFirst(ctx, cl, binding)
+}
+
+func (k *Kubernetes) PersistMetadata(ctx context.Context, _ client.Client, token *api.SPIAccessToken) error {
+	return k.lookup.PersistMetadata(ctx, token)
+}
+
+func (k *Kubernetes) GetBaseUrl() string {
+	return k.baseUrl
+}
+
+// TranslateToScopes returns no scopes, because the access to the cluster is given by its RBAC and not by the token.
+func (k *Kubernetes) TranslateToScopes(_ api.Permission) []string {
+	return []string{}
+}
+
+func (k *Kubernetes) GetType() api.ServiceProviderType {
+	return api.ServiceProviderTypeKubernetes
+}
+
+func (k *Kubernetes) CheckRepositoryAccess(ctx context.Context, _ client.Client, _ *api.SPIAccessCheck) (*api.SPIAccessCheckStatus, error) {
+	log.FromContext(ctx).Info("trying SPIAccessCheck on a Kubernetes cluster. This is not supported.")
+	return &api.SPIAccessCheckStatus{
+		Accessibility: api.SPIAccessCheckAccessibilityUnknown,
+		ErrorReason:   api.SPIAccessCheckErrorNotImplemented,
+		ErrorMessage:  "Access check for Kubernetes clusters is not implemented.",
+	}, nil
+}
+
+// GetOAuthEndpoint returns an empty string, because there is no OAuth flow for Kubernetes clusters.
+func (k *Kubernetes) GetOAuthEndpoint() string {
+	return ""
+}
+
+func (k *Kubernetes) MapToken(_ context.Context, _ *api.SPIAccessTokenBinding, token *api.SPIAccessToken, tokenData *api.Token) (serviceprovider.AccessTokenMapper, error) {
+	return serviceprovider.DefaultMapToken(token, tokenData)
+}
+
+// validationMessages is the catalog of the remediations of the validation failures of the Kubernetes permissions.
+var validationMessages = serviceprovider.ValidationMessageCatalog{
+	serviceprovider.ValidationProblemUnsupportedScope: {
+		Hint:             "the access to Kubernetes clusters is only given by their RBAC, remove the additional scopes and bind the roles to the user or service account instead",
+		DocumentationUrl: "https://kubernetes.io/docs/reference/access-authn-authz/rbac/",
+	},
+}
+
+func (k *Kubernetes) Validate(_ context.Context, validated serviceprovider.Validated) (serviceprovider.ValidationResult, error) {
+	ret := serviceprovider.ValidationResult{}
+
+	for _, s := range validated.Permissions().AdditionalScopes {
+		ret.ScopeValidation = append(ret.ScopeValidation, validationMessages.Explain(serviceprovider.ValidationProblemUnsupportedScope, fmt.Errorf("scope '%s' is not supported", s)))
+	}
+
+	return ret, nil
+}
+
+// ValidateCredentials checks that the token data contains a bearer token (or a kubeconfig using one) that is
+// authenticated by the cluster.
+func (k *Kubernetes) ValidateCredentials(ctx context.Context, tokenData *api.Token) error {
+	if tokenData.IsBasicAuth() {
+		return fmt.Errorf("the Kubernetes service provider only supports bearer tokens, not the credentials of type '%s'", api.BasicAuthTokenType)
+	}
+
+	if err := serviceprovider.DefaultValidateCredentials(tokenData); err != nil {
+		return err
+	}
+
+	token, err := bearerToken(tokenData, k.baseUrl)
+	if err != nil {
+		return err
+	}
+
+	_, err = k.reviewer.Review(ctx, token)
+	return err
+}
+
+// InspectCredentials returns the user the cluster authenticates with the provided token data.
+func (k *Kubernetes) InspectCredentials(ctx context.Context, tokenData *api.Token) (*api.TokenMetadata, error) {
+	token, err := bearerToken(tokenData, k.baseUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := k.reviewer.Review(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.TokenMetadata{Username: user.Username, UserId: user.UID}, nil
+}
+
+// GetAccessibleResources returns no resources, because the clusters have no organizations or repositories.
+func (k *Kubernetes) GetAccessibleResources(_ context.Context, _ *api.SPIAccessToken) (serviceprovider.AccessibleResources, error) {
+	return serviceprovider.AccessibleResources{}, nil
+}
@@ -0,0 +1,337 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	sperrors "github.com/redhat-appstudio/service-provider-integration-operator/pkg/errors"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/httptransport"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/tokenstorage"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/util"
+	"github.com/stretchr/testify/assert"
+	authv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testBaseUrl = "https://api.cluster.test:6443"
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: cluster
+  cluster:
+    server: https://api.cluster.test:6443
+users:
+- name: user
+  user:
+    token: kubeconfig-token
+contexts:
+- name: ctx
+  context:
+    cluster: cluster
+    user: user
+current-context: ctx
+`
+
+// reviewingClient returns an HTTP client creating the TokenReviews in a fake cluster that only authenticates the token
+// "valid".
+func reviewingClient(t *testing.T) *http.Client {
+	return &http.Client{
+		Transport: util.FakeRoundTrip(func(r *http.Request) (*http.Response, error) {
+			assert.Equal(t, testBaseUrl+tokenReviewPath, r.URL.String())
+			if r.Header.Get("Authorization") != "Bearer reviewer" {
+				return &http.Response{StatusCode: http.StatusForbidden, Body: io.NopCloser(bytes.NewBufferString("forbidden"))}, nil
+			}
+
+			review := authv1.TokenReview{}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&review))
+
+			if review.Spec.Token == "valid" {
+				review.Status.Authenticated = true
+				review.Status.User = authv1.UserInfo{Username: "system:serviceaccount:default:robot", UID: "42"}
+			} else {
+				review.Status.Error = "invalid bearer token"
+			}
+
+			body, err := json.Marshal(review)
+			assert.NoError(t, err)
+
+			return &http.Response{StatusCode: http.StatusCreated, Body: io.NopCloser(bytes.NewBuffer(body))}, nil
+		}),
+	}
+}
+
+func TestClusterHttpClient(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("User-Agent")))
+	}))
+	defer srv.Close()
+	caData := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+
+	get := func(cl *http.Client) (string, error) {
+		res, err := cl.Get(srv.URL)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+		data, err := io.ReadAll(res.Body)
+		return string(data), err
+	}
+
+	t.Run("trusts the CA", func(t *testing.T) {
+		cl, err := clusterHttpClient(&http.Client{Transport: httptransport.TaggingRoundTripper{
+			RoundTripper: httptransport.GuardingRoundTripper{RoundTripper: http.DefaultTransport},
+			UserAgent:    "spi",
+		}}, caData)
+		assert.NoError(t, err)
+
+		data, err := get(cl)
+		assert.NoError(t, err)
+		assert.Equal(t, "spi", data)
+	})
+
+	t.Run("keeps the guard", func(t *testing.T) {
+		cl, err := clusterHttpClient(&http.Client{Transport: httptransport.TaggingRoundTripper{
+			RoundTripper: httptransport.GuardingRoundTripper{RoundTripper: http.DefaultTransport, MaxResponseSize: 2},
+			UserAgent:    "spi",
+		}}, caData)
+		assert.NoError(t, err)
+
+		_, err = get(cl)
+		assert.ErrorIs(t, err, httptransport.ErrResponseTooLarge)
+	})
+
+	t.Run("invalid CA", func(t *testing.T) {
+		_, err := clusterHttpClient(&http.Client{}, "not a certificate")
+		assert.Error(t, err)
+	})
+}
+
+func TestTokenReviewer_Review(t *testing.T) {
+	reviewer := &tokenReviewer{httpClient: reviewingClient(t), baseUrl: testBaseUrl, reviewerToken: "reviewer"}
+
+	t.Run("authenticated", func(t *testing.T) {
+		user, err := reviewer.Review(context.TODO(), "valid")
+		assert.NoError(t, err)
+		assert.Equal(t, "system:serviceaccount:default:robot", user.Username)
+		assert.Equal(t, "42", user.UID)
+	})
+
+	t.Run("not authenticated", func(t *testing.T) {
+		_, err := reviewer.Review(context.TODO(), "invalid")
+		assert.Error(t, err)
+		assert.True(t, sperrors.IsInvalidAccessToken(err))
+	})
+
+	t.Run("reviewer not allowed", func(t *testing.T) {
+		reviewer := &tokenReviewer{httpClient: reviewingClient(t), baseUrl: testBaseUrl, reviewerToken: "other"}
+		_, err := reviewer.Review(context.TODO(), "valid")
+		assert.Error(t, err)
+		assert.False(t, sperrors.IsInvalidAccessToken(err))
+	})
+}
+
+func TestBearerToken(t *testing.T) {
+	t.Run("plain token", func(t *testing.T) {
+		token, err := bearerToken(&api.Token{AccessToken: " token\n"}, testBaseUrl)
+		assert.NoError(t, err)
+		assert.Equal(t, "token", token)
+	})
+
+	t.Run("kubeconfig", func(t *testing.T) {
+		token, err := bearerToken(&api.Token{AccessToken: testKubeconfig}, testBaseUrl)
+		assert.NoError(t, err)
+		assert.Equal(t, "kubeconfig-token", token)
+	})
+
+	t.Run("kubeconfig for other cluster", func(t *testing.T) {
+		_, err := bearerToken(&api.Token{AccessToken: testKubeconfig}, "https://other.cluster.test")
+		assert.Error(t, err)
+	})
+
+	t.Run("garbage", func(t *testing.T) {
+		_, err := bearerToken(&api.Token{AccessToken: "not\na kubeconfig: ["}, testBaseUrl)
+		assert.Error(t, err)
+	})
+}
+
+func TestValidateCredentials(t *testing.T) {
+	k := &Kubernetes{
+		reviewer: &tokenReviewer{httpClient: reviewingClient(t), baseUrl: testBaseUrl, reviewerToken: "reviewer"},
+		baseUrl:  testBaseUrl,
+	}
+
+	assert.NoError(t, k.ValidateCredentials(context.TODO(), &api.Token{AccessToken: "valid"}))
+	assert.Error(t, k.ValidateCredentials(context.TODO(), &api.Token{AccessToken: "invalid"}))
+	assert.Error(t, k.ValidateCredentials(context.TODO(), &api.Token{TokenType: api.BasicAuthTokenType, Username: "user", AccessToken: "valid"}))
+}
+
+func TestInspectCredentials(t *testing.T) {
+	k := &Kubernetes{
+		reviewer: &tokenReviewer{httpClient: reviewingClient(t), baseUrl: testBaseUrl, reviewerToken: "reviewer"},
+		baseUrl:  testBaseUrl,
+	}
+
+	metadata, err := k.InspectCredentials(context.TODO(), &api.Token{AccessToken: "valid"})
+	assert.NoError(t, err)
+	assert.Equal(t, "system:serviceaccount:default:robot", metadata.Username)
+	assert.Equal(t, "42", metadata.UserId)
+
+	_, err = k.InspectCredentials(context.TODO(), &api.Token{AccessToken: "invalid"})
+	assert.True(t, sperrors.IsInvalidAccessToken(err))
+}
+
+func TestMetadataProvider_Fetch(t *testing.T) {
+	token := &api.SPIAccessToken{ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "default"}}
+
+	mp := &metadataProvider{
+		tokenStorage: tokenstorage.TestTokenStorage{
+			GetImpl: func(ctx context.Context, owner *api.SPIAccessToken) (*api.Token, error) {
+				return &api.Token{AccessToken: "valid"}, nil
+			},
+		},
+		reviewer: &tokenReviewer{httpClient: reviewingClient(t), baseUrl: testBaseUrl, reviewerToken: "reviewer"},
+	}
+
+	metadata, err := mp.Fetch(context.TODO(), token)
+	assert.NoError(t, err)
+	assert.Equal(t, "system:serviceaccount:default:robot", metadata.Username)
+	assert.Equal(t, "42", metadata.UserId)
+
+	matches, err := (&offlineTokenFilter{}).Matches(context.TODO(), nil, token)
+	assert.NoError(t, err)
+	assert.True(t, matches)
+}
+
+func TestMetadataProvider_FetchNoData(t *testing.T) {
+	mp := &metadataProvider{
+		tokenStorage: tokenstorage.TestTokenStorage{
+			GetImpl: func(ctx context.Context, owner *api.SPIAccessToken) (*api.Token, error) {
+				return nil, nil
+			},
+		},
+	}
+
+	metadata, err := mp.Fetch(context.TODO(), &api.SPIAccessToken{})
+	assert.NoError(t, err)
+	assert.Nil(t, metadata)
+}
+
+func TestResourceAttributes(t *testing.T) {
+	test := func(repoUrl string) *authzv1.ResourceAttributes {
+		attrs, err := resourceAttributes(testBaseUrl, repoUrl)
+		assert.NoError(t, err)
+		return attrs
+	}
+
+	assert.Equal(t, &authzv1.ResourceAttributes{Group: "*", Resource: "*"}, test(testBaseUrl))
+	assert.Equal(t, &authzv1.ResourceAttributes{Group: "*", Resource: "*", Version: "v1", Namespace: "default"}, test(testBaseUrl+"/api/v1/namespaces/default"))
+	assert.Equal(t, &authzv1.ResourceAttributes{Resource: "namespaces", Version: "v1"}, test(testBaseUrl+"/api/v1/namespaces"))
+	assert.Equal(t, &authzv1.ResourceAttributes{Resource: "configmaps", Version: "v1", Namespace: "default", Name: "cfg"}, test(testBaseUrl+"/api/v1/namespaces/default/configmaps/cfg"))
+	assert.Equal(t, &authzv1.ResourceAttributes{Group: "apps", Resource: "deployments", Version: "v1", Namespace: "default"}, test(testBaseUrl+"/apis/apps/v1/namespaces/default/deployments"))
+
+	_, err := resourceAttributes(testBaseUrl, "https://other.cluster.test/api/v1")
+	assert.Error(t, err)
+	_, err = resourceAttributes(testBaseUrl, testBaseUrl+"/healthz")
+	assert.Error(t, err)
+}
+
+func TestRequiredVerbs(t *testing.T) {
+	perms := func(types ...api.PermissionType) *api.Permissions {
+		ret := &api.Permissions{}
+		for _, t := range types {
+			ret.Required = append(ret.Required, api.Permission{Type: t, Area: api.PermissionAreaRepository})
+		}
+		return ret
+	}
+
+	assert.Equal(t, []string{"get", "list"}, requiredVerbs(perms()))
+	assert.Equal(t, []string{"get", "list"}, requiredVerbs(perms(api.PermissionTypeRead)))
+	assert.Equal(t, []string{"create", "update", "delete"}, requiredVerbs(perms(api.PermissionTypeWrite)))
+	assert.Equal(t, []string{"get", "list", "create", "update", "delete"}, requiredVerbs(perms(api.PermissionTypeReadWrite)))
+}
+
+func TestTokenFilter(t *testing.T) {
+	cl := &http.Client{
+		Transport: util.FakeRoundTrip(func(r *http.Request) (*http.Response, error) {
+			var body []byte
+			var err error
+			switch r.URL.Path {
+			case tokenReviewPath:
+				review := authv1.TokenReview{}
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&review))
+				review.Status.Authenticated = review.Spec.Token == "valid"
+				review.Status.User = authv1.UserInfo{Username: "robot", Groups: []string{"robots"}}
+				body, err = json.Marshal(review)
+			case subjectAccessReviewPath:
+				review := authzv1.SubjectAccessReview{}
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&review))
+				assert.Equal(t, []string{"robots"}, review.Spec.Groups)
+				// the robot can only read in the default namespace
+				attrs := review.Spec.ResourceAttributes
+				review.Status.Allowed = review.Spec.User == "robot" && attrs.Namespace == "default" && (attrs.Verb == "get" || attrs.Verb == "list")
+				body, err = json.Marshal(review)
+			default:
+				t.Errorf("unexpected request to %s", r.URL)
+			}
+			assert.NoError(t, err)
+			return &http.Response{StatusCode: http.StatusCreated, Body: io.NopCloser(bytes.NewBuffer(body))}, nil
+		}),
+	}
+
+	filter := &tokenFilter{
+		tokenStorage: tokenstorage.TestTokenStorage{
+			GetImpl: func(ctx context.Context, owner *api.SPIAccessToken) (*api.Token, error) {
+				return &api.Token{AccessToken: owner.Name}, nil
+			},
+		},
+		reviewer: &tokenReviewer{httpClient: cl, baseUrl: testBaseUrl, reviewerToken: "reviewer"},
+	}
+
+	token := func(name string) *api.SPIAccessToken {
+		return &api.SPIAccessToken{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status:     api.SPIAccessTokenStatus{TokenMetadata: &api.TokenMetadata{Username: "robot"}},
+		}
+	}
+	binding := func(path string, permType api.PermissionType) *api.SPIAccessTokenBinding {
+		return &api.SPIAccessTokenBinding{Spec: api.SPIAccessTokenBindingSpec{
+			RepoUrl:     testBaseUrl + path,
+			Permissions: api.Permissions{Required: []api.Permission{{Type: permType, Area: api.PermissionAreaRepository}}},
+		}}
+	}
+
+	test := func(b *api.SPIAccessTokenBinding, tkn *api.SPIAccessToken) bool {
+		matches, err := filter.Matches(context.TODO(), b, tkn)
+		assert.NoError(t, err)
+		return matches
+	}
+
+	assert.True(t, test(binding("/api/v1/namespaces/default", api.PermissionTypeRead), token("valid")))
+	assert.False(t, test(binding("/api/v1/namespaces/default", api.PermissionTypeReadWrite), token("valid")))
+	assert.False(t, test(binding("/api/v1/namespaces/other", api.PermissionTypeRead), token("valid")))
+	assert.False(t, test(binding("/api/v1/namespaces/default", api.PermissionTypeRead), token("invalid")))
+	assert.False(t, test(binding("/healthz", api.PermissionTypeRead), token("valid")))
+}
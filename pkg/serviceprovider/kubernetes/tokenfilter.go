@@ -0,0 +1,178 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	sperrors "github.com/redhat-appstudio/service-provider-integration-operator/pkg/errors"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/tokenstorage"
+	authzv1 "k8s.io/api/authorization/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// offlineTokenFilter matches all the reviewed tokens of the cluster. The permissions cannot be checked offline, because
+// they are given by the RBAC of the cluster. The tokens are already limited to the cluster by the lookup.
+type offlineTokenFilter struct{}
+
+var _ serviceprovider.TokenFilter = (*offlineTokenFilter)(nil)
+
+func (t *offlineTokenFilter) Matches(_ context.Context, _ serviceprovider.Matchable, token *api.SPIAccessToken) (bool, error) {
+	return token.Status.TokenMetadata != nil && token.Status.TokenMetadata.Username != "", nil
+}
+
+// tokenFilter matches the tokens that the RBAC of the cluster allows to access the resources in the repository URL of
+// the binding with the permissions required by the binding. The permissions are checked using
+// the SubjectAccessReviews of the user the token is authenticated as.
+type tokenFilter struct {
+	tokenStorage tokenstorage.TokenStorage
+	reviewer     *tokenReviewer
+}
+
+var _ serviceprovider.TokenFilter = (*tokenFilter)(nil)
+
+func (t *tokenFilter) Matches(ctx context.Context, matchable serviceprovider.Matchable, token *api.SPIAccessToken) (bool, error) {
+	lg := log.FromContext(ctx, "tokenName", token.Name, "tokenNamespace", token.Namespace)
+
+	if matches, _ := (&offlineTokenFilter{}).Matches(ctx, matchable, token); !matches {
+		return false, nil
+	}
+
+	attributes, err := resourceAttributes(t.reviewer.baseUrl, matchable.RepoUrl())
+	if err != nil {
+		lg.Info("the repository URL doesn't point to the Kubernetes API", "repoUrl", matchable.RepoUrl(), "error", err.Error())
+		return false, nil
+	}
+
+	data, err := t.tokenStorage.Get(ctx, token)
+	if err != nil {
+		return false, fmt.Errorf("failed to get the token data: %w", err)
+	}
+	if data == nil {
+		return false, nil
+	}
+
+	bearer, err := bearerToken(data, t.reviewer.baseUrl)
+	if err != nil {
+		return false, nil
+	}
+
+	user, err := t.reviewer.Review(ctx, bearer)
+	if err != nil {
+		if sperrors.IsInvalidAccessToken(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	for _, verb := range requiredVerbs(matchable.Permissions()) {
+		attributes.Verb = verb
+		allowed, err := t.reviewer.Authorize(ctx, user, attributes)
+		if err != nil {
+			return false, err
+		}
+		if !allowed {
+			lg.Info("the token is not allowed to access the repository", "repoUrl", matchable.RepoUrl(), "verb", verb)
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// requiredVerbs returns the verbs the token needs to be allowed to use to have the provided permissions. At least
+// the get verb is always required.
+func requiredVerbs(permissions *api.Permissions) []string {
+	read, write := false, false
+	for _, p := range permissions.Required {
+		read = read || p.Type.IsRead()
+		write = write || p.Type.IsWrite()
+	}
+
+	verbs := []string{}
+	if read || !write {
+		verbs = append(verbs, "get", "list")
+	}
+	if write {
+		verbs = append(verbs, "create", "update", "delete")
+	}
+	return verbs
+}
+
+// resourceAttributes parses the repository URL, which is the URL of the resources in the Kubernetes API of the cluster
+// with the provided base URL, into the attributes of the resources. The URL can point to the whole cluster
+// (the base URL itself), an API group, a namespace, a type of the resources or a single resource, e.g.
+// <baseUrl>/apis/apps/v1/namespaces/default/deployments/app. The unspecified attributes match all the resources.
+func resourceAttributes(baseUrl string, repoUrl string) (*authzv1.ResourceAttributes, error) {
+	base, err := url.Parse(baseUrl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the base URL: %w", err)
+	}
+	repo, err := url.Parse(repoUrl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the repository URL: %w", err)
+	}
+	if repo.Host != base.Host {
+		return nil, fmt.Errorf("the repository URL doesn't belong to the cluster %s", baseUrl)
+	}
+
+	attributes := &authzv1.ResourceAttributes{Group: "*", Resource: "*"}
+
+	path := strings.Trim(strings.TrimPrefix(repo.Path, strings.TrimSuffix(base.Path, "/")), "/")
+	if path == "" {
+		return attributes, nil
+	}
+
+	segments := strings.Split(path, "/")
+	switch {
+	case segments[0] == "api" && len(segments) >= 2:
+		attributes.Group = ""
+		attributes.Version = segments[1]
+		segments = segments[2:]
+	case segments[0] == "apis" && len(segments) >= 3:
+		attributes.Group = segments[1]
+		attributes.Version = segments[2]
+		segments = segments[3:]
+	default:
+		return nil, fmt.Errorf("the path %s is not a path of the Kubernetes API", repo.Path)
+	}
+
+	if len(segments) >= 2 && segments[0] == "namespaces" {
+		if len(segments) == 2 && attributes.Group == "" {
+			// the URL of the namespace itself, like /api/v1/namespaces/default, stands for all the resources in it
+			attributes.Group = "*"
+		}
+		attributes.Namespace = segments[1]
+		segments = segments[2:]
+	}
+
+	switch len(segments) {
+	case 0:
+	case 1:
+		attributes.Resource = segments[0]
+	case 2:
+		attributes.Resource = segments[0]
+		attributes.Name = segments[1]
+	default:
+		return nil, fmt.Errorf("the path %s is not a path of the Kubernetes API resources", repo.Path)
+	}
+
+	return attributes, nil
+}
@@ -0,0 +1,169 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	sperrors "github.com/redhat-appstudio/service-provider-integration-operator/pkg/errors"
+	authv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	tokenReviewPath         = "/apis/authentication.k8s.io/v1/tokenreviews"
+	subjectAccessReviewPath = "/apis/authorization.k8s.io/v1/subjectaccessreviews"
+)
+
+// tokenReviewer validates the tokens using the TokenReview API of the cluster and checks their permissions using
+// the SubjectAccessReview API.
+type tokenReviewer struct {
+	httpClient *http.Client
+	baseUrl    string
+	// reviewerToken is the token allowed to create the TokenReviews and SubjectAccessReviews in the cluster, e.g. of
+	// a service account bound to the system:auth-delegator cluster role.
+	reviewerToken string
+}
+
+// Review returns the user the cluster authenticates with the provided token. The returned error is
+// a ServiceProviderError recognized by errors.IsInvalidAccessToken if the token is not authenticated.
+func (r *tokenReviewer) Review(ctx context.Context, token string) (*authv1.UserInfo, error) {
+	review := authv1.TokenReview{
+		TypeMeta: metav1.TypeMeta{Kind: "TokenReview", APIVersion: authv1.SchemeGroupVersion.String()},
+		Spec:     authv1.TokenReviewSpec{Token: token},
+	}
+
+	if err := r.create(ctx, tokenReviewPath, &review); err != nil {
+		return nil, err
+	}
+
+	if !review.Status.Authenticated {
+		return nil, &sperrors.ServiceProviderError{
+			StatusCode: http.StatusUnauthorized,
+			Response:   "the token is not authenticated by the cluster: " + review.Status.Error,
+		}
+	}
+
+	return &review.Status.User, nil
+}
+
+// Authorize checks that the RBAC of the cluster allows the provided user to access the resources with the provided
+// attributes.
+func (r *tokenReviewer) Authorize(ctx context.Context, user *authv1.UserInfo, attributes *authzv1.ResourceAttributes) (bool, error) {
+	extra := make(map[string]authzv1.ExtraValue, len(user.Extra))
+	for k, v := range user.Extra {
+		extra[k] = authzv1.ExtraValue(v)
+	}
+
+	review := authzv1.SubjectAccessReview{
+		TypeMeta: metav1.TypeMeta{Kind: "SubjectAccessReview", APIVersion: authzv1.SchemeGroupVersion.String()},
+		Spec: authzv1.SubjectAccessReviewSpec{
+			ResourceAttributes: attributes,
+			User:               user.Username,
+			UID:                user.UID,
+			Groups:             user.Groups,
+			Extra:              extra,
+		},
+	}
+
+	if err := r.create(ctx, subjectAccessReviewPath, &review); err != nil {
+		return false, err
+	}
+
+	return review.Status.Allowed, nil
+}
+
+// create creates the provided review object in the cluster and updates it with the response.
+func (r *tokenReviewer) create(ctx context.Context, path string, review interface{}) error {
+	lg := log.FromContext(ctx)
+
+	body, err := json.Marshal(review)
+	if err != nil {
+		return fmt.Errorf("failed to serialize the review: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.baseUrl+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create the review request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+r.reviewerToken)
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to create the review in %s: %w", r.baseUrl, err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			lg.Error(err, "failed to close the body of the review response")
+		}
+	}()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read the review response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		// this is a failure of the reviewer token configured in the operator, not of the reviewed token
+		return fmt.Errorf("failed to create the review in %s (http status %d): %s", r.baseUrl, resp.StatusCode, string(respBody))
+	}
+
+	if err := json.Unmarshal(respBody, review); err != nil {
+		return fmt.Errorf("failed to parse the review response: %w", err)
+	}
+
+	return nil
+}
+
+// bearerToken returns the bearer token in the token data. The access token is either the bearer token itself or
+// a kubeconfig whose current context points to the provided API server and uses a bearer token.
+func bearerToken(tokenData *api.Token, baseUrl string) (string, error) {
+	if !strings.Contains(strings.TrimSpace(tokenData.AccessToken), "\n") {
+		// the bearer tokens are always on a single line
+		return strings.TrimSpace(tokenData.AccessToken), nil
+	}
+
+	kubeconfig, err := clientcmd.Load([]byte(tokenData.AccessToken))
+	if err != nil {
+		return "", fmt.Errorf("the access token is neither a bearer token nor a kubeconfig: %w", err)
+	}
+
+	context, ok := kubeconfig.Contexts[kubeconfig.CurrentContext]
+	if !ok {
+		return "", fmt.Errorf("the current context of the kubeconfig is not defined")
+	}
+
+	if cluster, ok := kubeconfig.Clusters[context.Cluster]; !ok || strings.TrimSuffix(cluster.Server, "/") != baseUrl {
+		return "", fmt.Errorf("the current context of the kubeconfig doesn't point to %s", baseUrl)
+	}
+
+	user, ok := kubeconfig.AuthInfos[context.AuthInfo]
+	if !ok || user.Token == "" {
+		return "", fmt.Errorf("the current context of the kubeconfig doesn't use a bearer token")
+	}
+
+	return user.Token, nil
+}
@@ -17,12 +17,14 @@ package serviceprovider
 import (
 	"context"
 	"net/url"
+	"sort"
 	"sync"
 
 	"k8s.io/apimachinery/pkg/util/errors"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -42,6 +44,15 @@ type GenericLookup struct {
 	MetadataCache *MetadataCache
 	// RepoHostParser is a function that extracts the host from the repoUrl
 	RepoHostParser RepoHostParser
+	// Concurrency is the maximum number of the candidate tokens checked concurrently. If not positive,
+	// config.DefaultTokenLookupConcurrency is used.
+	Concurrency int
+}
+
+// tokenUser is implemented by the matchables that may only use some of the tokens, like the bindings that may only
+// use the tokens of their creator.
+type tokenUser interface {
+	MayUseToken(token *api.SPIAccessToken) bool
 }
 
 type RepoHostParser interface {
@@ -63,7 +74,26 @@ func RepoHostFromUrl(repoUrl string) (string, error) {
 	return parsed.Host, nil
 }
 
+// Lookup returns all the tokens matching the provided matchable, the tokens with higher priority first
+// (see api.TokenPriorityAnnotation).
 func (l GenericLookup) Lookup(ctx context.Context, cl client.Client, matchable Matchable) ([]api.SPIAccessToken, error) {
+	return l.lookup(ctx, cl, matchable, false)
+}
+
+// LookupFirst returns the first token found to match the provided matchable or nil if there is no such token.
+// The tokens with lower priority (see api.TokenPriorityAnnotation) are only checked if no token with higher priority
+// matches.// The checks of the rest of the candidate tokens are cancelled once a matching token is found, and their failures are
+// therefore not reported.
+func (l GenericLookup) LookupFirst(ctx context.Context, cl client.Client, matchable Matchable) (*api.SPIAccessToken, error) {
+	tokens, err := l.lookup(ctx, cl, matchable, true)
+	if err != nil || len(tokens) == 0 {
+		return nil, err
+	}
+
+	return &tokens[0], nil
+}
+
+func (l GenericLookup) lookup(ctx context.Context, cl client.Client, matchable Matchable, firstOnly bool) ([]api.SPIAccessToken, error) {
 	lg := log.FromContext(ctx)
 
 	var result = make([]api.SPIAccessToken, 0)
@@ -75,54 +105,69 @@ func (l GenericLookup) Lookup(ctx context.Context, cl client.Client, matchable M
 		return result, err
 	}
 
-	if err := cl.List(ctx, potentialMatches, client.InNamespace(matchable.ObjNamespace()), client.MatchingLabels{
-		api.ServiceProviderTypeLabel: string(l.ServiceProviderType),
-		api.ServiceProviderHostLabel: repoHost,
+	// the cached client has the index from RegisterTokenIndexes registered so that we only get the tokens of our host
+	// instead of all the tokens in the namespace. The clients without the index fail to list by it, so we fall back to
+	// listing by the labels for them. Unlike the index, the labels are only set on the tokens that have already been
+	// reconciled.
+	if err := cl.List(ctx, potentialMatches, client.InNamespace(matchable.ObjNamespace()), client.MatchingFields{
+		TokenServiceProviderHostIndex: repoHost,
 	}); err != nil {
-		return result, err
+		lg.V(1).Info("failed to list the tokens using the index, listing them by the labels", "error", err.Error())
+		if err := cl.List(ctx, potentialMatches, client.InNamespace(matchable.ObjNamespace()), client.MatchingLabels{
+			api.ServiceProviderTypeLabel: string(l.ServiceProviderType),
+			api.ServiceProviderHostLabel: repoHost,
+		}); err != nil {
+			return result, err
+		}
 	}
 
 	lg.Info("lookup", "potential_matches", len(potentialMatches.Items))
 
-	errs := make([]error, 0)
-
-	mutex := sync.Mutex{}
-	wg := sync.WaitGroup{}
-	for _, t := range potentialMatches.Items {
+	candidates := make([]api.SPIAccessToken, 0, len(potentialMatches.Items))
+	for i := range potentialMatches.Items {
+		t := potentialMatches.Items[i]
+		// some clients ignore the field selectors, so the tokens need to be filtered again
+		if !isTokenOfServiceProvider(&t, l.ServiceProviderType, repoHost) {
+			continue
+		}
 		if t.Status.Phase != api.SPIAccessTokenPhaseReady {
 			lg.Info("skipping lookup, token not ready", "token", t.Name)
 			continue
 		}
+		if user, ok := matchable.(tokenUser); ok && !user.MayUseToken(&t) {
+			lg.Info("skipping lookup, token owned by another user", "token", t.Name)
+			continue
+		}
+		candidates = append(candidates, t)
+	}
 
-		wg.Add(1)
-		go func(tkn api.SPIAccessToken) {
-			lg.Info("matching", "token", tkn.Name)
-			defer wg.Done()
-			if err := l.MetadataCache.Ensure(ctx, &tkn, l.MetadataProvider); err != nil {
-				mutex.Lock()
-				defer mutex.Unlock()
-				lg.Error(err, "failed to refresh the metadata of candidate token", "token", tkn.Namespace+"/"+tkn.Name)
-				errs = append(errs, err)
-				return
-			}
+	// the candidates with higher priority are checked first so that LookupFirst prefers them. The candidates with
+	// the same priority are checked concurrently, so any of them can be found first.
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Priority() > candidates[j].Priority()
+	})
 
-			ok, err := l.TokenFilter.Matches(ctx, matchable, &tkn)
-			if err != nil {
-				mutex.Lock()
-				defer mutex.Unlock()
-				lg.Error(err, "failed to match candidate token", "token", tkn.Namespace+"/"+tkn.Name)
-				errs = append(errs, err)
-				return
-			}
-			if ok {
-				mutex.Lock()
-				defer mutex.Unlock()
-				result = append(result, tkn)
+	errs := make([]error, 0)
+	for len(candidates) > 0 {
+		group := candidates
+		for i := range candidates {
+			if candidates[i].Priority() != candidates[0].Priority() {
+				group = candidates[:i]
+				break
 			}
-		}(t)
-	}
+		}
+		candidates = candidates[len(group):]
 
-	wg.Wait()
+		matches, groupErrs := l.match(ctx, matchable, group, firstOnly)
+		result = append(result, matches...)
+		errs = append(errs, groupErrs...)
+
+		if firstOnly && len(result) > 0 {
+			// the errors are most probably caused by the cancellation of the rest of the checks
+			lg.Info("lookup finished", "matching_token", result[0].Name)
+			return result[:1], nil
+		}
+	}
 
 	if len(errs) > 0 {
 		return nil, errors.NewAggregate(errs)
@@ -133,6 +178,80 @@ func (l GenericLookup) Lookup(ctx context.Context, cl client.Client, matchable M
 	return result, nil
 }
 
+// match checks the candidate tokens against the matchable concurrently and returns the matching tokens together with
+// the errors of the failed checks. If firstOnly is true, the rest of the checks are cancelled once a matching token is
+// found.
+func (l GenericLookup) match(ctx context.Context, matchable Matchable, candidates []api.SPIAccessToken, firstOnly bool) ([]api.SPIAccessToken, []error) {
+	lg := log.FromContext(ctx)
+
+	workers := l.Concurrency
+	if workers <= 0 {
+		workers = config.DefaultTokenLookupConcurrency
+	}
+	if workers > len(candidates) {
+		workers = len(candidates)
+	}
+
+	matchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	queue := make(chan api.SPIAccessToken)
+	go func() {
+		defer close(queue)
+		for _, t := range candidates {
+			select {
+			case queue <- t:
+			case <-matchCtx.Done():
+				return
+			}
+		}
+	}()
+
+	result := make([]api.SPIAccessToken, 0)
+	errs := make([]error, 0)
+
+	mutex := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for tkn := range queue {
+				tkn := tkn
+				lg.Info("matching", "token", tkn.Name)
+				if err := l.MetadataCache.Ensure(matchCtx, &tkn, l.MetadataProvider); err != nil {
+					mutex.Lock()
+					lg.Error(err, "failed to refresh the metadata of candidate token", "token", tkn.Namespace+"/"+tkn.Name)
+					errs = append(errs, err)
+					mutex.Unlock()
+					continue
+				}
+
+				ok, err := l.TokenFilter.Matches(matchCtx, matchable, &tkn)
+				if err != nil {
+					mutex.Lock()
+					lg.Error(err, "failed to match candidate token", "token", tkn.Namespace+"/"+tkn.Name)
+					errs = append(errs, err)
+					mutex.Unlock()
+					continue
+				}
+				if ok {
+					mutex.Lock()
+					result = append(result, tkn)
+					mutex.Unlock()
+					if firstOnly {
+						cancel()
+					}
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return result, errs
+}
+
 func (l GenericLookup) PersistMetadata(ctx context.Context, token *api.SPIAccessToken) error {
 	return l.MetadataCache.Ensure(ctx, token, l.MetadataProvider)
 }
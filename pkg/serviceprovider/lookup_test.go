@@ -16,10 +16,13 @@ package serviceprovider
 
 import (
 	"context"
+	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/statusupdate"
 	"github.com/stretchr/testify/assert"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -39,6 +42,9 @@ func TestGenericLookup_Lookup(t *testing.T) {
 				api.ServiceProviderHostLabel: "fake.sp",
 			},
 		},
+		Spec: api.SPIAccessTokenSpec{
+			ServiceProviderUrl: "https://fake.sp",
+		},
 		Status: api.SPIAccessTokenStatus{
 			Phase: api.SPIAccessTokenPhaseReady,
 		},
@@ -52,6 +58,9 @@ func TestGenericLookup_Lookup(t *testing.T) {
 				api.ServiceProviderHostLabel: "fake.sp",
 			},
 		},
+		Spec: api.SPIAccessTokenSpec{
+			ServiceProviderUrl: "https://fake.sp",
+		},
 		Status: api.SPIAccessTokenStatus{
 			Phase: api.SPIAccessTokenPhaseReady,
 		},
@@ -69,7 +78,7 @@ func TestGenericLookup_Lookup(t *testing.T) {
 	sch := runtime.NewScheme()
 	utilruntime.Must(corev1.AddToScheme(sch))
 	utilruntime.Must(api.AddToScheme(sch))
-	cl := fake.NewClientBuilder().WithScheme(sch).WithObjects(matchingToken, nonMatchingToken1, nonMatchingToken2).Build()
+	cl := statusupdate.FakeApplyClient{Client: fake.NewClientBuilder().WithScheme(sch).WithObjects(matchingToken, nonMatchingToken1, nonMatchingToken2).Build()}
 
 	cache := NewMetadataCache(cl, &TtlMetadataExpirationPolicy{Ttl: 1 * time.Hour})
 	gl := GenericLookup{
@@ -97,6 +106,285 @@ func TestGenericLookup_Lookup(t *testing.T) {
 	assert.Equal(t, "matching", tkns[0].Name)
 }
 
+func TestGenericLookup_TokenOwnership(t *testing.T) {
+	ownedToken := &api.SPIAccessToken{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "owned",
+			Namespace:   "default",
+			Annotations: map[string]string{api.TokenOwnerAnnotation: "alois"},
+			Labels: map[string]string{
+				api.ServiceProviderTypeLabel: "test",
+				api.ServiceProviderHostLabel: "fake.sp",
+			},
+		},
+		Spec: api.SPIAccessTokenSpec{
+			ServiceProviderUrl: "https://fake.sp",
+		},
+		Status: api.SPIAccessTokenStatus{
+			Phase: api.SPIAccessTokenPhaseReady,
+		},
+	}
+
+	sch := runtime.NewScheme()
+	utilruntime.Must(api.AddToScheme(sch))
+	cl := statusupdate.FakeApplyClient{Client: fake.NewClientBuilder().WithScheme(sch).WithObjects(ownedToken).Build()}
+
+	cache := NewMetadataCache(cl, &TtlMetadataExpirationPolicy{Ttl: 1 * time.Hour})
+	gl := GenericLookup{
+		ServiceProviderType: "test",
+		TokenFilter: TokenFilterFunc(func(ctx context.Context, binding Matchable, token *api.SPIAccessToken) (bool, error) {
+			return true, nil
+		}),
+		MetadataProvider: MetadataProviderFunc(func(ctx context.Context, token *api.SPIAccessToken) (*api.TokenMetadata, error) {
+			return &api.TokenMetadata{UserId: "42"}, nil
+		}),
+		MetadataCache:  &cache,
+		RepoHostParser: RepoHostParserFunc(RepoHostFromUrl),
+	}
+
+	lookup := func(annotations map[string]string) []api.SPIAccessToken {
+		tkns, err := gl.Lookup(context.TODO(), cl, &api.SPIAccessTokenBinding{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Annotations: annotations},
+			Spec:       api.SPIAccessTokenBindingSpec{RepoUrl: "https://fake.sp"},
+		})
+		assert.NoError(t, err)
+		return tkns
+	}
+
+	assert.Len(t, lookup(map[string]string{api.BindingCreatorAnnotation: "alois"}), 1)
+	assert.Len(t, lookup(map[string]string{api.BindingCreatorAnnotation: "other", api.BindingCreatedByAdminAnnotation: "true"}), 1)
+	assert.Empty(t, lookup(map[string]string{api.BindingCreatorAnnotation: "other"}))
+	assert.Empty(t, lookup(nil))
+}
+
+// indexlessClient fails to list by the field selectors like the cache without the registered indexes does.
+type indexlessClient struct {
+	client.Client
+	// labelSelectors records the label selectors of the successful lists
+	labelSelectors *[]string
+}
+
+func (c indexlessClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	listOpts := client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+	if listOpts.FieldSelector != nil {
+		return fmt.Errorf("index with name field:%s does not exist", TokenServiceProviderHostIndex)
+	}
+	selector := ""
+	if listOpts.LabelSelector != nil {
+		selector = listOpts.LabelSelector.String()
+	}
+	*c.labelSelectors = append(*c.labelSelectors, selector)
+	return c.Client.List(ctx, list, opts...)
+}
+
+func TestGenericLookup_WithoutIndex(t *testing.T) {
+	token := func(name string, spType string, spHost string) *api.SPIAccessToken {
+		return &api.SPIAccessToken{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels: map[string]string{
+					api.ServiceProviderTypeLabel: spType,
+					api.ServiceProviderHostLabel: spHost,
+				},
+			},
+			Spec:   api.SPIAccessTokenSpec{ServiceProviderUrl: "https://" + spHost},
+			Status: api.SPIAccessTokenStatus{Phase: api.SPIAccessTokenPhaseReady},
+		}
+	}
+
+	sch := runtime.NewScheme()
+	utilruntime.Must(api.AddToScheme(sch))
+	var labelSelectors []string
+	cl := indexlessClient{labelSelectors: &labelSelectors, Client: statusupdate.FakeApplyClient{Client: fake.NewClientBuilder().WithScheme(sch).WithObjects(
+		token("matching", "test", "fake.sp"),
+		token("other-host", "test", "other.sp"),
+		token("other-type", "other", "fake.sp"),
+	).Build()}}
+
+	cache := NewMetadataCache(cl, &TtlMetadataExpirationPolicy{Ttl: 1 * time.Hour})
+	gl := GenericLookup{
+		ServiceProviderType: "test",
+		TokenFilter: TokenFilterFunc(func(ctx context.Context, binding Matchable, token *api.SPIAccessToken) (bool, error) {
+			return true, nil
+		}),
+		MetadataProvider: MetadataProviderFunc(func(ctx context.Context, token *api.SPIAccessToken) (*api.TokenMetadata, error) {
+			return &api.TokenMetadata{}, nil
+		}),
+		MetadataCache:  &cache,
+		RepoHostParser: RepoHostParserFunc(RepoHostFromUrl),
+	}
+
+	tkns, err := gl.Lookup(context.TODO(), cl, &api.SPIAccessTokenBinding{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default"},
+		Spec:       api.SPIAccessTokenBindingSpec{RepoUrl: "https://fake.sp/acme/app"},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, tkns, 1)
+	assert.Equal(t, "matching", tkns[0].Name)
+	// the tokens are still filtered by the API server
+	assert.Equal(t, []string{api.ServiceProviderHostLabel + "=fake.sp," + api.ServiceProviderTypeLabel + "=test"}, labelSelectors)
+}
+
+func TestGenericLookup_Priority(t *testing.T) {
+	token := func(name string, priority string) *api.SPIAccessToken {
+		tkn := &api.SPIAccessToken{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels: map[string]string{
+					api.ServiceProviderTypeLabel: "test",
+					api.ServiceProviderHostLabel: "fake.sp",
+				},
+			},
+			Spec:   api.SPIAccessTokenSpec{ServiceProviderUrl: "https://fake.sp"},
+			Status: api.SPIAccessTokenStatus{Phase: api.SPIAccessTokenPhaseReady},
+		}
+		if priority != "" {
+			tkn.Annotations = map[string]string{api.TokenPriorityAnnotation: priority}
+		}
+		return tkn
+	}
+
+	sch := runtime.NewScheme()
+	utilruntime.Must(api.AddToScheme(sch))
+	cl := statusupdate.FakeApplyClient{Client: fake.NewClientBuilder().WithScheme(sch).WithObjects(
+		token("personal", ""),
+		token("bot", "10"),
+		token("deprecated", "-1"),
+		token("broken", "10"),
+	).Build()}
+
+	var checked []string
+	cache := NewMetadataCache(cl, &TtlMetadataExpirationPolicy{Ttl: 1 * time.Hour})
+	gl := GenericLookup{
+		ServiceProviderType: "test",
+		TokenFilter: TokenFilterFunc(func(ctx context.Context, binding Matchable, token *api.SPIAccessToken) (bool, error) {
+			checked = append(checked, token.Name)
+			return token.Name != "broken", nil
+		}),
+		MetadataProvider: MetadataProviderFunc(func(ctx context.Context, token *api.SPIAccessToken) (*api.TokenMetadata, error) {
+			return &api.TokenMetadata{}, nil
+		}),
+		MetadataCache:  &cache,
+		RepoHostParser: RepoHostParserFunc(RepoHostFromUrl),
+		// the checks are sequential so that the checked tokens can be recorded without synchronization
+		Concurrency: 1,
+	}
+	binding := &api.SPIAccessTokenBinding{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default"},
+		Spec:       api.SPIAccessTokenBindingSpec{RepoUrl: "https://fake.sp/acme/app"},
+	}
+
+	tkn, err := gl.LookupFirst(context.TODO(), cl, binding)
+	assert.NoError(t, err)
+	if assert.NotNil(t, tkn) {
+		assert.Equal(t, "bot", tkn.Name)
+	}
+	// the tokens with lower priority are not checked once a token with higher priority matches
+	assert.NotContains(t, checked, "personal")
+	assert.NotContains(t, checked, "deprecated")
+
+	tkns, err := gl.Lookup(context.TODO(), cl, binding)
+	assert.NoError(t, err)
+	names := make([]string, 0, len(tkns))
+	for _, tkn := range tkns {
+		names = append(names, tkn.Name)
+	}
+	assert.Equal(t, []string{"bot", "personal", "deprecated"}, names)
+}
+
+func TestGenericLookup_Concurrency(t *testing.T) {
+	sch := runtime.NewScheme()
+	utilruntime.Must(corev1.AddToScheme(sch))
+	utilruntime.Must(api.AddToScheme(sch))
+
+	objs := make([]client.Object, 0, 10)
+	for i := 0; i < 10; i++ {
+		objs = append(objs, &api.SPIAccessToken{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("token-%d", i),
+				Namespace: "default",
+				Labels: map[string]string{
+					api.ServiceProviderTypeLabel: "test",
+					api.ServiceProviderHostLabel: "fake.sp",
+				},
+			},
+			Spec: api.SPIAccessTokenSpec{
+				ServiceProviderUrl: "https://fake.sp",
+			},
+			Status: api.SPIAccessTokenStatus{
+				Phase: api.SPIAccessTokenPhaseReady,
+			},
+		})
+	}
+	binding := &api.SPIAccessTokenBinding{Spec: api.SPIAccessTokenBindingSpec{RepoUrl: "https://fake.sp"}}
+
+	// newLookup creates a lookup that records the maximum number of the concurrent metadata fetches and the number of
+	// the checked tokens. Each lookup gets its own client so that the tokens have no metadata cached.
+	newLookup := func(concurrency int, matching string) (GenericLookup, client.Client, *int32, *int32) {
+		var current, max, checked int32
+		cl := statusupdate.FakeApplyClient{Client: fake.NewClientBuilder().WithScheme(sch).WithObjects(objs...).Build()}
+		cache := NewMetadataCache(cl, &TtlMetadataExpirationPolicy{Ttl: 1 * time.Hour})
+		return GenericLookup{
+			ServiceProviderType: "test",
+			TokenFilter: TokenFilterFunc(func(ctx context.Context, binding Matchable, token *api.SPIAccessToken) (bool, error) {
+				atomic.AddInt32(&checked, 1)
+				return token.Name == matching, nil
+			}),
+			MetadataProvider: MetadataProviderFunc(func(ctx context.Context, token *api.SPIAccessToken) (*api.TokenMetadata, error) {
+				c := atomic.AddInt32(&current, 1)
+				defer atomic.AddInt32(&current, -1)
+				for {
+					m := atomic.LoadInt32(&max)
+					if c <= m || atomic.CompareAndSwapInt32(&max, m, c) {
+						break
+					}
+				}
+				if token.Name != matching {
+					select {
+					case <-ctx.Done():
+						return nil, ctx.Err()
+					case <-time.After(10 * time.Millisecond):
+					}
+				}
+				return &api.TokenMetadata{UserId: "42"}, nil
+			}),
+			MetadataCache:  &cache,
+			RepoHostParser: RepoHostParserFunc(RepoHostFromUrl),
+			Concurrency:    concurrency,
+		}, cl, &max, &checked
+	}
+
+	t.Run("bounded", func(t *testing.T) {
+		gl, cl, max, checked := newLookup(3, "token-5")
+		tkns, err := gl.Lookup(context.TODO(), cl, binding)
+		assert.NoError(t, err)
+		assert.Len(t, tkns, 1)
+		assert.Equal(t, "token-5", tkns[0].Name)
+		assert.LessOrEqual(t, *max, int32(3))
+		assert.Equal(t, int32(10), *checked)
+	})
+
+	t.Run("first match cancels the rest", func(t *testing.T) {
+		gl, cl, _, checked := newLookup(2, "token-0")
+		tkn, err := gl.LookupFirst(context.TODO(), cl, binding)
+		assert.NoError(t, err)
+		assert.NotNil(t, tkn)
+		assert.Equal(t, "token-0", tkn.Name)
+		assert.Less(t, *checked, int32(10))
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		gl, cl, _, checked := newLookup(4, "none")
+		tkn, err := gl.LookupFirst(context.TODO(), cl, binding)
+		assert.NoError(t, err)
+		assert.Nil(t, tkn)
+		assert.Equal(t, int32(10), *checked)
+	})
+}
+
 func TestGenericLookup_PersistMetadata(t *testing.T) {
 	token := &api.SPIAccessToken{
 		ObjectMeta: metav1.ObjectMeta{
@@ -109,7 +397,7 @@ func TestGenericLookup_PersistMetadata(t *testing.T) {
 	sch := runtime.NewScheme()
 	utilruntime.Must(corev1.AddToScheme(sch))
 	utilruntime.Must(api.AddToScheme(sch))
-	cl := fake.NewClientBuilder().WithScheme(sch).WithObjects(token).Build()
+	cl := statusupdate.FakeApplyClient{Client: fake.NewClientBuilder().WithScheme(sch).WithObjects(token).Build()}
 
 	cache := NewMetadataCache(cl, &TtlMetadataExpirationPolicy{Ttl: 1 * time.Hour})
 
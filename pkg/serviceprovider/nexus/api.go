@@ -0,0 +1,213 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nexus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	sperrors "github.com/redhat-appstudio/service-provider-integration-operator/pkg/errors"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// currentUserPath is the endpoint of the Nexus UI returning the user authenticated by the request. Unlike
+	// the public API, it resolves the user tokens to their users.
+	currentUserPath = "/service/rest/internal/ui/user"
+	usersPath       = "/service/rest/v1/security/users"
+	rolesPath       = "/service/rest/v1/security/roles/"
+	privilegesPath  = "/service/rest/v1/security/privileges"
+
+	privilegeTypeRepositoryView = "repository-view"
+	privilegeTypeWildcard       = "wildcard"
+	// allPattern is the pattern of the wildcard privilege giving all the permissions (nx-all).
+	allPattern = "nexus:*"
+)
+
+// nexusClient talks to the REST API of a Nexus instance. The users are authenticated using the token data, while
+// their roles and privileges are read using the credentials of the service provider configuration.
+type nexusClient struct {
+	httpClient *http.Client
+	baseUrl    string
+	// adminUsername and adminPassword are the credentials of the user allowed to read the users, roles and privileges,
+	// i.e. having the nx-users-read, nx-roles-read and nx-privileges-read privileges.
+	adminUsername string
+	adminPassword string
+}
+
+type user struct {
+	UserId string   `json:"userId"`
+	Roles  []string `json:"roles"`
+}
+
+type role struct {
+	Id         string   `json:"id"`
+	Privileges []string `json:"privileges"`
+	Roles      []string `json:"roles"`
+}
+
+type privilege struct {
+	Type       string   `json:"type"`
+	Name       string   `json:"name"`
+	Pattern    string   `json:"pattern"`
+	Repository string   `json:"repository"`
+	Actions    []string `json:"actions"`
+}
+
+// CurrentUser returns the ID of the user authenticated by the provided token data. The returned error is
+// a ServiceProviderError recognized by errors.IsInvalidAccessToken if the token data is not authenticated.
+func (c *nexusClient) CurrentUser(ctx context.Context, tokenData *api.Token) (string, error) {
+	u := user{}
+	if err := c.get(ctx, currentUserPath, tokenData.Username, tokenData.AccessToken, &u); err != nil {
+		return "", err
+	}
+
+	if u.UserId == "" {
+		return "", &sperrors.ServiceProviderError{StatusCode: http.StatusUnauthorized, Response: "the credentials are not authenticated by Nexus"}
+	}
+
+	return u.UserId, nil
+}
+
+// Privileges returns the privileges given to the user with the provided ID by all its roles, including the nested
+// ones.
+func (c *nexusClient) Privileges(ctx context.Context, userId string) ([]privilege, error) {
+	users := []user{}
+	if err := c.getAdmin(ctx, usersPath+"?userId="+url.QueryEscape(userId), &users); err != nil {
+		return nil, err
+	}
+
+	var roles []string
+	for _, u := range users {
+		// the users endpoint matches the user IDs by prefix
+		if u.UserId == userId {
+			roles = u.Roles
+		}
+	}
+
+	names := map[string]bool{}
+	seen := map[string]bool{}
+	for len(roles) > 0 {
+		id := roles[0]
+		roles = roles[1:]
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		r := role{}
+		if err := c.getAdmin(ctx, rolesPath+url.PathEscape(id), &r); err != nil {
+			return nil, err
+		}
+		for _, p := range r.Privileges {
+			names[p] = true
+		}
+		roles = append(roles, r.Roles...)
+	}
+
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	all := []privilege{}
+	if err := c.getAdmin(ctx, privilegesPath, &all); err != nil {
+		return nil, err
+	}
+
+	ret := []privilege{}
+	for _, p := range all {
+		if names[p.Name] {
+			ret = append(ret, p)
+		}
+	}
+
+	return ret, nil
+}
+
+func (c *nexusClient) getAdmin(ctx context.Context, path string, result interface{}) error {
+	if err := c.get(ctx, path, c.adminUsername, c.adminPassword, result); err != nil {
+		if sperrors.IsInvalidAccessToken(err) {
+			// this is a failure of the credentials configured in the operator, not of the token
+			return fmt.Errorf("the configured credentials are not allowed to read %s: %s", path, err.Error())
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *nexusClient) get(ctx context.Context, path string, username string, password string, result interface{}) error {
+	lg := log.FromContext(ctx)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseUrl+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create the request: %w", err)
+	}
+	req.SetBasicAuth(username, password)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call %s: %w", c.baseUrl, err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			lg.Error(err, "failed to close the body of the Nexus response")
+		}
+	}()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read the response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return &sperrors.ServiceProviderError{StatusCode: resp.StatusCode, Response: string(body)}
+	}
+
+	if err := json.Unmarshal(body, result); err != nil {
+		return fmt.Errorf("failed to parse the response of %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// allows checks whether the privileges allow the action in the repository. The repository "*" stands for all
+// the repositories.
+func allows(privileges []privilege, repository string, action string) bool {
+	for _, p := range privileges {
+		switch p.Type {
+		case privilegeTypeWildcard:
+			if p.Pattern == allPattern {
+				return true
+			}
+		case privilegeTypeRepositoryView:
+			if p.Repository != "*" && p.Repository != repository {
+				continue
+			}
+			for _, a := range p.Actions {
+				if a == "*" || strings.EqualFold(a, "all") || strings.EqualFold(a, action) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nexus
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ serviceprovider.ServiceProvider = (*Nexus)(nil)
+var _ serviceprovider.CredentialsInspector = (*Nexus)(nil)
+
+// Nexus is the service provider for the Sonatype Nexus Repository Manager instances. There is no OAuth flow, so
+// the token data can only be uploaded as the username and password of a Nexus user or, preferably, as the name code and
+// pass code of a user token. The access to the repositories is given by the roles of the users, which are read using
+// the credentials configured as the clientId and clientSecret of the service provider.
+type Nexus struct {
+	lookup  serviceprovider.GenericLookup
+	client  *nexusClient
+	baseUrl string
+}
+
+var Initializer = serviceprovider.Initializer{
+	Constructor:           serviceprovider.ConstructorFunc(newNexus),
+	OfflineTokenFilter:    &offlineTokenFilter{},
+	ConfiguredBaseUrlOnly: true,
+}
+
+func newNexus(factory *serviceprovider.Factory, baseUrl string) (serviceprovider.ServiceProvider, error) {
+	cfg := factory.Configuration.Get()
+	spConfig := instanceConfiguration(cfg, baseUrl)
+	if spConfig == nil {
+		return nil, fmt.Errorf("no Nexus service provider is configured for %s", baseUrl)
+	}
+
+	nexusClient := &nexusClient{
+		httpClient:    factory.HttpClient,
+		baseUrl:       baseUrl,
+		adminUsername: spConfig.ClientId,
+		adminPassword: spConfig.ClientSecret,
+	}
+
+	cache := serviceprovider.NewMetadataCache(factory.KubernetesClient, &serviceprovider.TtlMetadataExpirationPolicy{Ttl: cfg.TokenLookupCacheTtl})
+
+	return &Nexus{
+		lookup: serviceprovider.GenericLookup{
+			ServiceProviderType: api.ServiceProviderTypeNexus,
+			TokenFilter: &tokenFilter{
+				tokenStorage: factory.TokenStorage,
+				client:       nexusClient,
+			},
+			MetadataProvider: &metadataProvider{
+				tokenStorage: factory.TokenStorage,
+				client:       nexusClient,
+			},
+			MetadataCache:  &cache,
+			RepoHostParser: serviceprovider.RepoHostParserFunc(serviceprovider.RepoHostFromUrl),
+			Concurrency:    cfg.TokenLookupConcurrency,
+		},
+		client:  nexusClient,
+		baseUrl: baseUrl,
+	}, nil
+}
+
+var _ serviceprovider.ConstructorFunc = newNexus
+
+// instanceConfiguration finds the configuration of the Nexus service provider with the provided base URL.
+func instanceConfiguration(cfg config.Configuration, baseUrl string) *config.ServiceProviderConfiguration {
+	for i := range cfg.ServiceProviders {
+		spc := &cfg.ServiceProviders[i]
+		if spc.ServiceProviderType == config.ServiceProviderTypeNexus && strings.TrimSuffix(spc.ServiceProviderBaseUrl, "/") == baseUrl {
+			return spc
+		}
+	}
+	return nil
+}
+
+func (n *Nexus) LookupToken(ctx context.Context, cl client.Client, binding *api.SPIAccessTokenBinding) (*api.SPIAccessToken, error) {
+	return n.lookup.LookupFirst(ctx, cl, binding)
+}
+
+func (n *Nexus) PersistMetadata(ctx context.Context, _ client.Client, token *api.SPIAccessToken) error {
+	return n.lookup.PersistMetadata(ctx, token)
+}
+
+func (n *Nexus) GetBaseUrl() string {
+	return n.baseUrl
+}
+
+// TranslateToScopes returns no scopes, because the access to the repositories is given by the roles of the users and
+// not by the tokens.
+func (n *Nexus) TranslateToScopes(_ api.Permission) []string {
+	return []string{}
+}
+
+func (n *Nexus) GetType() api.ServiceProviderType {
+	return api.ServiceProviderTypeNexus
+}
+
+func (n *Nexus) CheckRepositoryAccess(ctx context.Context, _ client.Client, _ *api.SPIAccessCheck) (*api.SPIAccessCheckStatus, error) {
+	log.FromContext(ctx).Info("trying SPIAccessCheck on a Nexus repository. This is not supported.")
+	return &api.SPIAccessCheckStatus{
+		Accessibility: api.SPIAccessCheckAccessibilityUnknown,
+		ErrorReason:   api.SPIAccessCheckErrorNotImplemented,
+		ErrorMessage:  "Access check for Nexus repositories is not implemented.",
+	}, nil
+}
+
+// GetOAuthEndpoint returns an empty string, because there is no OAuth flow for Nexus.
+func (n *Nexus) GetOAuthEndpoint() string {
+	return ""
+}
+
+func (n *Nexus) MapToken(_ context.Context, _ *api.SPIAccessTokenBinding, token *api.SPIAccessToken, tokenData *api.Token) (serviceprovider.AccessTokenMapper, error) {
+	return serviceprovider.DefaultMapToken(token, tokenData)
+}
+
+// validationMessages is the catalog of the remediations of the validation failures of the Nexus permissions.
+var validationMessages = serviceprovider.ValidationMessageCatalog{
+	serviceprovider.ValidationProblemUnsupportedScope: {
+		Hint:             "the access to Nexus repositories is only given by the roles of the users, remove the additional scopes and assign the roles to the user in Nexus instead",
+		DocumentationUrl: "https://help.sonatype.com/repomanager3/nexus-repository-administration/access-control/roles",
+	},
+}
+
+func (n *Nexus) Validate(_ context.Context, validated serviceprovider.Validated) (serviceprovider.ValidationResult, error) {
+	ret := serviceprovider.ValidationResult{}
+
+	for _, s := range validated.Permissions().AdditionalScopes {
+		ret.ScopeValidation = append(ret.ScopeValidation, validationMessages.Explain(serviceprovider.ValidationProblemUnsupportedScope, fmt.Errorf("scope '%s' is not supported", s)))
+	}
+
+	return ret, nil
+}
+
+// ValidateCredentials checks that the token data contains the username and password (or a user token) authenticated by
+// Nexus.
+func (n *Nexus) ValidateCredentials(ctx context.Context, tokenData *api.Token) error {
+	if !tokenData.IsBasicAuth() {
+		return fmt.Errorf("the Nexus service provider only supports the credentials of type '%s'", api.BasicAuthTokenType)
+	}
+
+	if err := serviceprovider.DefaultValidateCredentials(tokenData); err != nil {
+		return err
+	}
+
+	_, err := n.client.CurrentUser(ctx, tokenData)
+	return err
+}
+
+// InspectCredentials returns the user Nexus authenticates with the provided token data.
+func (n *Nexus) InspectCredentials(ctx context.Context, tokenData *api.Token) (*api.TokenMetadata, error) {
+	userId, err := n.client.CurrentUser(ctx, tokenData)
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.TokenMetadata{Username: userId, UserId: userId}, nil
+}
+
+// GetAccessibleResources returns no resources, because the repositories accessible to the users are not cached.
+func (n *Nexus) GetAccessibleResources(_ context.Context, _ *api.SPIAccessToken) (serviceprovider.AccessibleResources, error) {
+	return serviceprovider.AccessibleResources{}, nil
+}
@@ -0,0 +1,230 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nexus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	sperrors "github.com/redhat-appstudio/service-provider-integration-operator/pkg/errors"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/tokenstorage"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/util"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testBaseUrl = "https://nexus.acme.test"
+
+// nexusTestClient returns an HTTP client talking to a fake Nexus instance. The user token "valid" belongs to
+// the "deployer" that can read the "maven-releases" repository through the "readers" role and write to it through
+// the nested "deployers" role. The "admin" can do anything. Only "spi" with the password "secret" can read the users,
+// roles and privileges.
+func nexusTestClient(t *testing.T) *http.Client {
+	return &http.Client{
+		Transport: util.FakeRoundTrip(func(r *http.Request) (*http.Response, error) {
+			username, password, _ := r.BasicAuth()
+			respond := func(status int, body interface{}) (*http.Response, error) {
+				data, err := json.Marshal(body)
+				assert.NoError(t, err)
+				return &http.Response{StatusCode: status, Body: io.NopCloser(bytes.NewBuffer(data))}, nil
+			}
+
+			if r.URL.Path == currentUserPath {
+				switch {
+				case username == "name-code" && password == "valid":
+					return respond(http.StatusOK, user{UserId: "deployer"})
+				case username == "name-code" && password == "admin":
+					return respond(http.StatusOK, user{UserId: "admin"})
+				default:
+					return respond(http.StatusUnauthorized, "unauthorized")
+				}
+			}
+
+			if username != "spi" || password != "secret" {
+				return respond(http.StatusForbidden, "forbidden")
+			}
+
+			switch r.URL.Path {
+			case usersPath:
+				return respond(http.StatusOK, []user{
+					{UserId: r.URL.Query().Get("userId"), Roles: map[string][]string{"deployer": {"readers", "deployers"}, "admin": {"nx-admin"}}[r.URL.Query().Get("userId")]},
+					{UserId: r.URL.Query().Get("userId") + "-2", Roles: []string{"nx-admin"}},
+				})
+			case rolesPath + "readers":
+				return respond(http.StatusOK, role{Id: "readers", Privileges: []string{"nx-repository-view-maven2-maven-releases-read"}})
+			case rolesPath + "deployers":
+				return respond(http.StatusOK, role{Id: "deployers", Privileges: []string{"deploy-releases"}, Roles: []string{"readers"}})
+			case rolesPath + "nx-admin":
+				return respond(http.StatusOK, role{Id: "nx-admin", Privileges: []string{"nx-all"}})
+			case privilegesPath:
+				return respond(http.StatusOK, []privilege{
+					{Type: privilegeTypeRepositoryView, Name: "nx-repository-view-maven2-maven-releases-read", Repository: "maven-releases", Actions: []string{"READ"}},
+					{Type: privilegeTypeRepositoryView, Name: "deploy-releases", Repository: "maven-releases", Actions: []string{"ADD", "EDIT"}},
+					{Type: privilegeTypeRepositoryView, Name: "nx-repository-view-*-*-*", Repository: "*", Actions: []string{"*"}},
+					{Type: privilegeTypeWildcard, Name: "nx-all", Pattern: allPattern},
+				})
+			}
+
+			t.Errorf("unexpected request to %s", r.URL)
+			return respond(http.StatusNotFound, "not found")
+		}),
+	}
+}
+
+func testNexusClient(t *testing.T) *nexusClient {
+	return &nexusClient{httpClient: nexusTestClient(t), baseUrl: testBaseUrl, adminUsername: "spi", adminPassword: "secret"}
+}
+
+func userToken(passCode string) *api.Token {
+	return &api.Token{TokenType: api.BasicAuthTokenType, Username: "name-code", AccessToken: passCode}
+}
+
+func TestNexusClient_Privileges(t *testing.T) {
+	privileges, err := testNexusClient(t).Privileges(context.TODO(), "deployer")
+	assert.NoError(t, err)
+	assert.True(t, allows(privileges, "maven-releases", "read"))
+	assert.True(t, allows(privileges, "maven-releases", "add"))
+	assert.False(t, allows(privileges, "maven-releases", "delete"))
+	assert.False(t, allows(privileges, "npm", "read"))
+	assert.False(t, allows(privileges, "*", "read"))
+
+	privileges, err = testNexusClient(t).Privileges(context.TODO(), "admin")
+	assert.NoError(t, err)
+	assert.True(t, allows(privileges, "*", "delete"))
+
+	privileges, err = testNexusClient(t).Privileges(context.TODO(), "nobody")
+	assert.NoError(t, err)
+	assert.Empty(t, privileges)
+
+	t.Run("misconfigured credentials", func(t *testing.T) {
+		c := testNexusClient(t)
+		c.adminPassword = "wrong"
+		_, err := c.Privileges(context.TODO(), "deployer")
+		assert.Error(t, err)
+		assert.False(t, sperrors.IsInvalidAccessToken(err))
+	})
+}
+
+func TestAllows(t *testing.T) {
+	assert.True(t, allows([]privilege{{Type: privilegeTypeRepositoryView, Repository: "*", Actions: []string{"*"}}}, "npm", "edit"))
+	assert.True(t, allows([]privilege{{Type: privilegeTypeRepositoryView, Repository: "npm", Actions: []string{"ALL"}}}, "npm", "edit"))
+	assert.False(t, allows([]privilege{{Type: privilegeTypeRepositoryView, Repository: "npm", Actions: []string{"BROWSE"}}}, "npm", "read"))
+	assert.False(t, allows([]privilege{{Type: privilegeTypeWildcard, Pattern: "nexus:repository-view:*"}}, "npm", "read"))
+	assert.False(t, allows([]privilege{{Type: "application", Name: "nx-all"}}, "npm", "read"))
+}
+
+func TestValidateCredentials(t *testing.T) {
+	n := &Nexus{client: testNexusClient(t), baseUrl: testBaseUrl}
+
+	assert.NoError(t, n.ValidateCredentials(context.TODO(), userToken("valid")))
+	assert.True(t, sperrors.IsInvalidAccessToken(n.ValidateCredentials(context.TODO(), userToken("invalid"))))
+	assert.Error(t, n.ValidateCredentials(context.TODO(), &api.Token{AccessToken: "valid"}))
+}
+
+func TestInspectCredentials(t *testing.T) {
+	n := &Nexus{client: testNexusClient(t), baseUrl: testBaseUrl}
+
+	metadata, err := n.InspectCredentials(context.TODO(), userToken("valid"))
+	assert.NoError(t, err)
+	assert.Equal(t, "deployer", metadata.Username)
+	assert.Equal(t, "deployer", metadata.UserId)
+
+	_, err = n.InspectCredentials(context.TODO(), userToken("invalid"))
+	assert.True(t, sperrors.IsInvalidAccessToken(err))
+}
+
+func TestMetadataProvider_Fetch(t *testing.T) {
+	token := &api.SPIAccessToken{ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "default"}}
+
+	mp := &metadataProvider{
+		tokenStorage: tokenstorage.TestTokenStorage{
+			GetImpl: func(ctx context.Context, owner *api.SPIAccessToken) (*api.Token, error) {
+				return userToken("valid"), nil
+			},
+		},
+		client: testNexusClient(t),
+	}
+
+	metadata, err := mp.Fetch(context.TODO(), token)
+	assert.NoError(t, err)
+	assert.Equal(t, "deployer", metadata.Username)
+
+	matches, err := (&offlineTokenFilter{}).Matches(context.TODO(), nil, token)
+	assert.NoError(t, err)
+	assert.True(t, matches)
+}
+
+func TestRepositoryName(t *testing.T) {
+	test := func(repoUrl string) string {
+		name, err := repositoryName(testBaseUrl, repoUrl)
+		assert.NoError(t, err)
+		return name
+	}
+
+	assert.Equal(t, "*", test(testBaseUrl))
+	assert.Equal(t, "*", test(testBaseUrl+"/"))
+	assert.Equal(t, "maven-releases", test(testBaseUrl+"/repository/maven-releases"))
+	assert.Equal(t, "maven-releases", test(testBaseUrl+"/repository/maven-releases/org/acme/app/1.0/app-1.0.jar"))
+
+	_, err := repositoryName(testBaseUrl, "https://other.acme.test/repository/maven-releases")
+	assert.Error(t, err)
+	_, err = repositoryName(testBaseUrl, testBaseUrl+"/service/rest/v1/status")
+	assert.Error(t, err)
+	_, err = repositoryName(testBaseUrl, testBaseUrl+"/repository/")
+	assert.Error(t, err)
+}
+
+func TestTokenFilter(t *testing.T) {
+	filter := &tokenFilter{
+		tokenStorage: tokenstorage.TestTokenStorage{
+			GetImpl: func(ctx context.Context, owner *api.SPIAccessToken) (*api.Token, error) {
+				return userToken(owner.Name), nil
+			},
+		},
+		client: testNexusClient(t),
+	}
+
+	token := func(name string) *api.SPIAccessToken {
+		return &api.SPIAccessToken{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status:     api.SPIAccessTokenStatus{TokenMetadata: &api.TokenMetadata{Username: "deployer"}},
+		}
+	}
+	binding := func(path string, permType api.PermissionType) *api.SPIAccessTokenBinding {
+		return &api.SPIAccessTokenBinding{Spec: api.SPIAccessTokenBindingSpec{
+			RepoUrl:     testBaseUrl + path,
+			Permissions: api.Permissions{Required: []api.Permission{{Type: permType, Area: api.PermissionAreaRepository}}},
+		}}
+	}
+
+	test := func(b *api.SPIAccessTokenBinding, tkn *api.SPIAccessToken) bool {
+		matches, err := filter.Matches(context.TODO(), b, tkn)
+		assert.NoError(t, err)
+		return matches
+	}
+
+	assert.True(t, test(binding("/repository/maven-releases", api.PermissionTypeRead), token("valid")))
+	assert.True(t, test(binding("/repository/maven-releases", api.PermissionTypeReadWrite), token("valid")))
+	assert.False(t, test(binding("/repository/npm", api.PermissionTypeRead), token("valid")))
+	assert.False(t, test(binding("", api.PermissionTypeRead), token("valid")))
+	assert.True(t, test(binding("", api.PermissionTypeReadWrite), token("admin")))
+	assert.False(t, test(binding("/repository/maven-releases", api.PermissionTypeRead), token("invalid")))
+	assert.False(t, test(binding("/service/rest/v1/status", api.PermissionTypeRead), token("valid")))
+}
@@ -0,0 +1,133 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nexus
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	sperrors "github.com/redhat-appstudio/service-provider-integration-operator/pkg/errors"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/tokenstorage"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// offlineTokenFilter matches all the tokens with known users. The permissions cannot be checked offline, because
+// they are given by the roles of the users in Nexus. The tokens are already limited to the instance by the lookup.
+type offlineTokenFilter struct{}
+
+var _ serviceprovider.TokenFilter = (*offlineTokenFilter)(nil)
+
+func (t *offlineTokenFilter) Matches(_ context.Context, _ serviceprovider.Matchable, token *api.SPIAccessToken) (bool, error) {
+	return token.Status.TokenMetadata != nil && token.Status.TokenMetadata.Username != "", nil
+}
+
+// tokenFilter matches the tokens whose users are given the repository actions required by the permissions of
+// the binding in the repository of the binding by their roles.
+type tokenFilter struct {
+	tokenStorage tokenstorage.TokenStorage
+	client       *nexusClient
+}
+
+var _ serviceprovider.TokenFilter = (*tokenFilter)(nil)
+
+func (t *tokenFilter) Matches(ctx context.Context, matchable serviceprovider.Matchable, token *api.SPIAccessToken) (bool, error) {
+	lg := log.FromContext(ctx, "tokenName", token.Name, "tokenNamespace", token.Namespace)
+
+	if matches, _ := (&offlineTokenFilter{}).Matches(ctx, matchable, token); !matches {
+		return false, nil
+	}
+
+	repository, err := repositoryName(t.client.baseUrl, matchable.RepoUrl())
+	if err != nil {
+		lg.Info("the repository URL doesn't point to a Nexus repository", "repoUrl", matchable.RepoUrl(), "error", err.Error())
+		return false, nil
+	}
+
+	data, err := t.tokenStorage.Get(ctx, token)
+	if err != nil {
+		return false, fmt.Errorf("failed to get the token data: %w", err)
+	}
+	if data == nil {
+		return false, nil
+	}
+
+	userId, err := t.client.CurrentUser(ctx, data)
+	if err != nil {
+		if sperrors.IsInvalidAccessToken(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	privileges, err := t.client.Privileges(ctx, userId)
+	if err != nil {
+		return false, err
+	}
+
+	for _, action := range requiredActions(matchable.Permissions()) {
+		if !allows(privileges, repository, action) {
+			lg.Info("the roles of the user don't allow the access to the repository", "repoUrl", matchable.RepoUrl(), "action", action)
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// requiredActions returns the Nexus repository actions the user needs to be allowed to have the provided permissions.
+// Reading is always required. Writing means deploying the components, which needs both adding the new files and
+// editing the existing ones (e.g. the Maven metadata).
+func requiredActions(permissions *api.Permissions) []string {
+	actions := []string{"read"}
+	for _, p := range permissions.Required {
+		if p.Type.IsWrite() {
+			return append(actions, "add", "edit")
+		}
+	}
+	return actions
+}
+
+// repositoryName parses the repository URL, which is the URL of a repository of the Nexus instance with the provided
+// base URL, e.g. <baseUrl>/repository/maven-releases/org/acme, into the name of the repository. The base URL itself
+// stands for all the repositories and is parsed into "*".
+func repositoryName(baseUrl string, repoUrl string) (string, error) {
+	base, err := url.Parse(baseUrl)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse the base URL: %w", err)
+	}
+	repo, err := url.Parse(repoUrl)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse the repository URL: %w", err)
+	}
+	if repo.Host != base.Host {
+		return "", fmt.Errorf("the repository URL doesn't belong to the Nexus instance %s", baseUrl)
+	}
+
+	path := strings.Trim(strings.TrimPrefix(repo.Path, strings.TrimSuffix(base.Path, "/")), "/")
+	if path == "" {
+		return "*", nil
+	}
+
+	segments := strings.Split(path, "/")
+	if segments[0] != "repository" || len(segments) < 2 || segments[1] == "" {
+		return "", fmt.Errorf("the path %s is not a path of a Nexus repository", repo.Path)
+	}
+
+	return segments[1], nil
+}
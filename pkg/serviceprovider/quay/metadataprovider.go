@@ -16,7 +16,6 @@ package quay
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"time"
@@ -28,6 +27,7 @@ import (
 	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
 	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
 	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/tokenstorage"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/statusupdate"
 )
 
 type metadataProvider struct {
@@ -60,7 +60,7 @@ func (p metadataProvider) Fetch(ctx context.Context, token *api.SPIAccessToken)
 		Organizations: map[string]EntityRecord{},
 	}
 
-	js, err := json.Marshal(state)
+	js, err := stateSchema.Marshal(state)
 	if err != nil {
 		lg.Error(err, "failed to serialize the token metadata, this should not happen")
 		return nil, err
@@ -105,7 +105,7 @@ func (p metadataProvider) FetchRepo(ctx context.Context, repoUrl string, token *
 	}
 
 	quayState := TokenState{}
-	if err = json.Unmarshal(token.Status.TokenMetadata.ServiceProviderState, &quayState); err != nil {
+	if err = stateSchema.Unmarshal(token.Status.TokenMetadata.ServiceProviderState, &quayState); err != nil {
 		lg.Error(err, "failed to unmarshal quay token state")
 		return
 	}
@@ -238,7 +238,7 @@ func (p metadataProvider) getEntityRecord(ctx context.Context, tokenData *api.To
 func (p metadataProvider) persistTokenState(ctx context.Context, token *api.SPIAccessToken, tokenState *TokenState) error {
 	lg := log.FromContext(ctx)
 
-	data, err := json.Marshal(tokenState)
+	data, err := stateSchema.Marshal(tokenState)
 	if err != nil {
 		lg.Error(err, "failed to serialize the metadata")
 		return err
@@ -246,5 +246,5 @@ func (p metadataProvider) persistTokenState(ctx context.Context, token *api.SPIA
 
 	token.Status.TokenMetadata.ServiceProviderState = data
 
-	return p.kubernetesClient.Status().Update(ctx, token)
+	return statusupdate.Apply(ctx, p.kubernetesClient, token)
 }
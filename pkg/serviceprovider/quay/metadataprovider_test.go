@@ -31,6 +31,7 @@ import (
 
 	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
 	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/tokenstorage"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/statusupdate"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -77,7 +78,7 @@ func TestMetadataProvider_Fetch(t *testing.T) {
 			assert.NotNil(t, data.ServiceProviderState)
 
 			state := &TokenState{}
-			assert.NoError(t, json.Unmarshal(data.ServiceProviderState, state))
+			assert.NoError(t, stateSchema.Unmarshal(data.ServiceProviderState, state))
 
 			assert.NotNil(t, state.Organizations)
 			assert.Empty(t, state.Organizations)
@@ -149,7 +150,7 @@ func TestMetadataProvider_FetchRepo(t *testing.T) {
 			},
 		}
 
-		k8sClient := fake.NewClientBuilder().Build()
+		k8sClient := statusupdate.FakeApplyClient{Client: fake.NewClientBuilder().Build()}
 
 		mp := metadataProvider{
 			tokenStorage: tokenstorage.TestTokenStorage{
@@ -176,7 +177,7 @@ func TestMetadataProvider_FetchRepo(t *testing.T) {
 			Status: api.SPIAccessTokenStatus{},
 		}
 
-		k8sClient := fake.NewClientBuilder().Build()
+		k8sClient := statusupdate.FakeApplyClient{Client: fake.NewClientBuilder().Build()}
 
 		mp := metadataProvider{
 			tokenStorage:     tokenstorage.TestTokenStorage{},
@@ -201,7 +202,7 @@ func TestMetadataProvider_FetchRepo(t *testing.T) {
 			},
 		}
 
-		k8sClient := fake.NewClientBuilder().Build()
+		k8sClient := statusupdate.FakeApplyClient{Client: fake.NewClientBuilder().Build()}
 
 		mp := metadataProvider{
 			tokenStorage: tokenstorage.TestTokenStorage{
@@ -289,7 +290,7 @@ func TestMetadataProvider_FetchRepo(t *testing.T) {
 			},
 		}
 
-		k8sClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(token).Build()
+		k8sClient := statusupdate.FakeApplyClient{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(token).Build()}
 
 		mp := metadataProvider{
 			tokenStorage: tokenstorage.TestTokenStorage{
@@ -19,6 +19,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 	"strings"
 
 	"k8s.io/client-go/rest"
@@ -30,10 +31,12 @@ import (
 	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
 
 	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 var _ serviceprovider.ServiceProvider = (*Quay)(nil)
+var _ serviceprovider.SecretTypeRestrictor = (*Quay)(nil)
 
 type Quay struct {
 	Configuration    config.Configuration
@@ -41,11 +44,16 @@ type Quay struct {
 	metadataProvider *metadataProvider
 	httpClient       rest.HTTPClient
 	BaseUrl          string
+	// scopeTranslations are the scope translations configured by the administrators.
+	scopeTranslations *serviceprovider.ScopeTranslationTable
 }
 
 var Initializer = serviceprovider.Initializer{
-	Probe:       quayProbe{},
-	Constructor: serviceprovider.ConstructorFunc(newQuay),
+	Probe:              quayProbe{},
+	Constructor:        serviceprovider.ConstructorFunc(newQuay),
+	OfflineTokenFilter: &offlineTokenFilter{},
+	EgressEndpoints:    []string{"quay.io:443"},
+	StateSchema:        &stateSchema,
 }
 
 func newQuay(factory *serviceprovider.Factory, _ string) (serviceprovider.ServiceProvider, error) {
@@ -57,10 +65,10 @@ func newQuay(factory *serviceprovider.Factory, _ string) (serviceprovider.Servic
 		tokenStorage:     factory.TokenStorage,
 		httpClient:       factory.HttpClient,
 		kubernetesClient: factory.KubernetesClient,
-		ttl:              factory.Configuration.TokenLookupCacheTtl,
+		ttl:              factory.Configuration.Get().TokenLookupCacheTtl,
 	}
 	return &Quay{
-		Configuration: factory.Configuration,
+		Configuration: factory.Configuration.Get(),
 		lookup: serviceprovider.GenericLookup{
 			ServiceProviderType: api.ServiceProviderTypeQuay,
 			TokenFilter: &tokenFilter{
@@ -76,9 +84,11 @@ func newQuay(factory *serviceprovider.Factory, _ string) (serviceprovider.Servic
 
 				return serviceprovider.RepoHostFromUrl(repoUrl)
 			}),
+			Concurrency: factory.Configuration.Get().TokenLookupConcurrency,
 		},
-		httpClient:       factory.HttpClient,
-		metadataProvider: mp,
+		httpClient:        factory.HttpClient,
+		metadataProvider:  mp,
+		scopeTranslations: factory.ScopeTranslations,
 	}, nil
 }
 
@@ -101,8 +111,10 @@ func (g *Quay) TranslateToScopes(permission api.Permission) []string {
 	// We represent the ability to pull/push images using fake scopes that don't exist in the Quay model and are used
 	// only to represent the permissions of the robot accounts. Since this is an OAuth URL, we need to replace those
 	// scopes with their "real" equivalents in the OAuth APIs - i.e. pull == repo:read and push == repo:write
+	// The scope translations configured by the administrators are only applied here and not in the token matching,
+	// because the matching relies on the scopes of the robot accounts as modelled by us.
 
-	fullScopes := translateToQuayScopes(permission)
+	fullScopes := g.scopeTranslations.Translate(api.ServiceProviderTypeQuay, permission, translateToQuayScopes)
 
 	replace := func(str *string) {
 		if *str == string(ScopePull) {
@@ -157,7 +169,9 @@ func translateToQuayScopes(permission api.Permission) []string {
 		case api.PermissionTypeReadWrite:
 			return []string{string(ScopeRepoRead), string(ScopeRepoWrite)}
 		}
-	case api.PermissionAreaRepository:
+	case api.PermissionAreaRepository, api.PermissionAreaSigning:
+		// the cosign signatures are stored in the repository next to the signed images, so signing requires pushing
+		// to the repository and verifying the signatures requires pulling from it
 		switch permission.Type {
 		case api.PermissionTypeRead:
 			return []string{string(ScopePull)}
@@ -181,29 +195,48 @@ func translateToQuayScopes(permission api.Permission) []string {
 }
 
 func (g *Quay) LookupToken(ctx context.Context, cl client.Client, binding *api.SPIAccessTokenBinding) (*api.SPIAccessToken, error) {
-	tokens, err := g.lookup.Lookup(ctx, cl, binding)
-	if err != nil {
-		return nil, err
-	}
-
-	if len(tokens) == 0 {
-		return nil, nil
-	}
-
-	return &tokens[0], nil
+	return g.lookup.LookupFirst(ctx, cl, binding)
 }
 
 func (g *Quay) PersistMetadata(ctx context.Context, _ client.Client, token *api.SPIAccessToken) error {
 	return g.lookup.PersistMetadata(ctx, token)
 }
 
+// CheckRepositoryAccess checks the access to the repository. The public repositories are recognized using an anonymous
+// request to the Quay API, which, unlike GitHub, tells the private repositories from the missing ones. The private
+// repositories are accessible if there is a token for them in the namespace of the check.
 func (q *Quay) CheckRepositoryAccess(ctx context.Context, cl client.Client, accessCheck *api.SPIAccessCheck) (*api.SPIAccessCheckStatus, error) {
-	log.FromContext(ctx).Info("trying SPIAccessCheck on quay.io. This is not supported yet.")
-	return &api.SPIAccessCheckStatus{
-		Accessibility: api.SPIAccessCheckAccessibilityUnknown,
-		ErrorReason:   api.SPIAccessCheckErrorNotImplemented,
-		ErrorMessage:  "Access check for quay.io is not implemented.",
-	}, nil
+	status := &api.SPIAccessCheckStatus{
+		ServiceProvider: api.ServiceProviderTypeQuay,
+		Accessibility:   api.SPIAccessCheckAccessibilityUnknown,
+	}
+
+	owner, repository, _ := splitToOrganizationAndRepositoryAndVersion(accessCheck.Spec.RepoUrl)
+	if owner == "" || repository == "" {
+		status.ErrorReason = api.SPIAccessCheckErrorBadURL
+		status.ErrorMessage = fmt.Sprintf("unable to parse the repository of '%s'", accessCheck.Spec.RepoUrl)
+		return status, nil
+	}
+
+	visibility, err := serviceprovider.ProbeVisibility(ctx, q.httpClient, "GET", "https://quay.io/api/v1/repository/"+owner+"/"+repository)
+	if err != nil {
+		return nil, err
+	}
+
+	if visibility == serviceprovider.RepositoryVisibilityPrivate {
+		token, err := q.lookup.LookupFirst(ctx, cl, accessCheck)
+		if err != nil {
+			return status, fmt.Errorf("failed to look up the token for the access check: %w", err)
+		}
+		if token != nil {
+			status.Accessible = true
+			status.Accessibility = api.SPIAccessCheckAccessibilityPrivate
+			return status, nil
+		}
+	}
+
+	serviceprovider.ApplyVisibility(status, visibility)
+	return status, nil
 }
 
 func (g *Quay) MapToken(ctx context.Context, binding *api.SPIAccessTokenBinding, token *api.SPIAccessToken, tokenData *api.Token) (serviceprovider.AccessTokenMapper, error) {
@@ -236,26 +269,88 @@ func (g *Quay) MapToken(ctx context.Context, binding *api.SPIAccessTokenBinding,
 	return mapper, nil
 }
 
+func (q *Quay) ValidateCredentials(_ context.Context, tokenData *api.Token) error {
+	// both the OAuth tokens and the robot account credentials are supported
+	return serviceprovider.DefaultValidateCredentials(tokenData)
+}
+
+func (q *Quay) GetAccessibleResources(_ context.Context, token *api.SPIAccessToken) (serviceprovider.AccessibleResources, error) {
+	ret := serviceprovider.AccessibleResources{}
+	if token.Status.TokenMetadata == nil || len(token.Status.TokenMetadata.ServiceProviderState) == 0 {
+		return ret, nil
+	}
+
+	quayState := TokenState{}
+	if err := stateSchema.Unmarshal(token.Status.TokenMetadata.ServiceProviderState, &quayState); err != nil {
+		return ret, fmt.Errorf("failed to unmarshal the Quay token state: %w", err)
+	}
+
+	// the state also caches the entities that the token has no access to, so we need to filter those out
+	for org, rec := range quayState.Organizations {
+		if len(rec.PossessedScopes) > 0 {
+			ret.Organizations = append(ret.Organizations, org)
+		}
+	}
+	for repo, rec := range quayState.Repositories {
+		if len(rec.PossessedScopes) > 0 {
+			ret.Repositories = append(ret.Repositories, q.GetBaseUrl()+"/"+repo)
+		}
+	}
+
+	sort.Strings(ret.Organizations)
+	sort.Strings(ret.Repositories)
+
+	return ret, nil
+}
+
+// SupportedSecretTypes returns the secret types the Quay credentials can be used in. Quay only supports the username
+// and password authentication, so e.g. the SSH keys cannot be provided. The cosign keys uploaded with the credentials
+// can be provided for signing the images in the repositories. The Helm charts stored in the repositories are pulled
+// using the Helm registry configuration.
+func (q *Quay) SupportedSecretTypes() []corev1.SecretType {
+	return []corev1.SecretType{"", corev1.SecretTypeOpaque, corev1.SecretTypeBasicAuth, corev1.SecretTypeDockercfg, corev1.SecretTypeDockerConfigJson, api.SecretTypeCosign, api.SecretTypeHelmRepository}
+}
+
+// validationMessages is the catalog of the remediations of the validation failures of the Quay permissions.
+var validationMessages = serviceprovider.ValidationMessageCatalog{
+	serviceprovider.ValidationProblemUnsupportedPermissionArea: {
+		Hint:             "the Quay tokens only give access to the repositories, remove the permissions with the 'user' area",
+		DocumentationUrl: "https://docs.quay.io/api/",
+	},
+	serviceprovider.ValidationProblemUnsupportedScope: {
+		Hint:             "the user scopes cannot be requested from Quay, use the 'repo:' scopes",
+		DocumentationUrl: "https://docs.quay.io/api/",
+	},
+	serviceprovider.ValidationProblemUnknownScope: {
+		Hint:             "use the scopes of the Quay OAuth applications in the additional scopes",
+		DocumentationUrl: "https://docs.quay.io/api/",
+	},
+	serviceprovider.ValidationProblemInvalidScopeSyntax: {
+		Hint:             "put each scope into a separate item of the additional scopes",
+		DocumentationUrl: "https://docs.quay.io/api/",
+	},
+}
+
 func (q *Quay) Validate(ctx context.Context, validated serviceprovider.Validated) (serviceprovider.ValidationResult, error) {
 	ret := serviceprovider.ValidationResult{}
 
 	userPermissionAreaRequested := false
 	for _, p := range validated.Permissions().Required {
 		if p.Area == api.PermissionAreaUser && !userPermissionAreaRequested {
-			ret.ScopeValidation = append(ret.ScopeValidation, errors.New("user-related permissions are not supported for Quay"))
+			ret.ScopeValidation = append(ret.ScopeValidation, validationMessages.Explain(serviceprovider.ValidationProblemUnsupportedPermissionArea, errors.New("user-related permissions are not supported for Quay")))
 			userPermissionAreaRequested = true
 		}
 	}
 
+	knownScopes := q.scopeTranslations.KnownScopes(api.ServiceProviderTypeQuay, supportedScopes)
 	for _, s := range validated.Permissions().AdditionalScopes {
 		switch Scope(s) {
 		case ScopeUserRead, ScopeUserAdmin:
-			ret.ScopeValidation = append(ret.ScopeValidation, fmt.Errorf("scope '%s' is not supported", s))
-		case ScopeRepoRead, ScopeRepoWrite, ScopeRepoCreate, ScopeRepoAdmin, ScopeOrgAdmin, ScopePull, ScopePush:
-			{
-			}
+			ret.ScopeValidation = append(ret.ScopeValidation, validationMessages.Explain(serviceprovider.ValidationProblemUnsupportedScope, fmt.Errorf("scope '%s' is not supported", s)))
 		default:
-			ret.ScopeValidation = append(ret.ScopeValidation, fmt.Errorf("unknown scope: '%s'", s))
+			if err := validationMessages.ValidateScope(s, knownScopes); err != nil {
+				ret.ScopeValidation = append(ret.ScopeValidation, err)
+			}
 		}
 	}
 
@@ -267,7 +362,7 @@ type quayProbe struct{}
 var _ serviceprovider.Probe = (*quayProbe)(nil)
 
 func (q quayProbe) Examine(_ *http.Client, url string) (string, error) {
-	if strings.HasPrefix(url, "https://quay.io") || strings.HasPrefix(url, "quay.io") {
+	if strings.HasPrefix(url, "https://quay.io") || strings.HasPrefix(url, "quay.io") || strings.HasPrefix(url, "oci://quay.io") {
 		return "https://quay.io", nil
 	} else {
 		return "", nil
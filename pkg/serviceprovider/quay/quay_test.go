@@ -17,6 +17,8 @@ package quay
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"testing"
 	"time"
@@ -52,22 +54,50 @@ func TestQuayProbe_Examine(t *testing.T) {
 
 	test(t, "quay.io/name/repo", true)
 	test(t, "https://quay.io/name/repo", true)
+	test(t, "oci://quay.io/name/chart", true)
 	test(t, "https://github.com/name/repo", false)
 	test(t, "github.com/name/repo", false)
 }
 
-func TestCheckAccessNotImplementedYetError(t *testing.T) {
-	cl := mockK8sClient()
-	quay := mockQuay(cl, http.StatusNotFound, nil)
-	ac := api.SPIAccessCheck{
-		Spec: api.SPIAccessCheckSpec{RepoUrl: testValidRepoUrl},
+func TestCheckRepositoryAccess(t *testing.T) {
+	test := func(code int, expectedAccessible bool, expectedAccessibility api.SPIAccessCheckAccessibility, expectedReason api.SPIAccessCheckErrorReason) {
+		t.Run(fmt.Sprintf("code %d", code), func(t *testing.T) {
+			cl := mockK8sClient()
+			quay := mockQuay(cl, code, nil)
+			var requested string
+			quay.httpClient = httpClientMock{
+				doFunc: func(req *http.Request) (*http.Response, error) {
+					requested = req.URL.String()
+					return &http.Response{StatusCode: code}, nil
+				},
+			}
+			ac := api.SPIAccessCheck{
+				Spec: api.SPIAccessCheckSpec{RepoUrl: testValidRepoUrl},
+			}
+
+			status, err := quay.CheckRepositoryAccess(context.TODO(), cl, &ac)
+
+			assert.NoError(t, err)
+			assert.Equal(t, "https://quay.io/api/v1/repository/redhat-appstudio/service-provider-integration-operator", requested)
+			assert.Equal(t, expectedAccessible, status.Accessible)
+			assert.Equal(t, expectedAccessibility, status.Accessibility)
+			assert.Equal(t, expectedReason, status.ErrorReason)
+		})
 	}
 
-	status, err := quay.CheckRepositoryAccess(context.TODO(), cl, &ac)
+	test(http.StatusOK, true, api.SPIAccessCheckAccessibilityPublic, "")
+	test(http.StatusUnauthorized, false, api.SPIAccessCheckAccessibilityPrivate, api.SPIAccessCheckErrorAuthenticationRequired)
+	test(http.StatusNotFound, false, api.SPIAccessCheckAccessibilityUnknown, api.SPIAccessCheckErrorRepoNotFound)
 
-	assert.NoError(t, err)
-	assert.NotNil(t, status)
-	assert.Equal(t, api.SPIAccessCheckErrorNotImplemented, status.ErrorReason)
+	t.Run("bad url", func(t *testing.T) {
+		cl := mockK8sClient()
+		status, err := mockQuay(cl, http.StatusOK, nil).CheckRepositoryAccess(context.TODO(), cl, &api.SPIAccessCheck{
+			Spec: api.SPIAccessCheckSpec{RepoUrl: "https://github.com/acme/repo"},
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, api.SPIAccessCheckErrorBadURL, status.ErrorReason)
+	})
 }
 
 func TestMapToken(t *testing.T) {
@@ -79,9 +109,9 @@ func TestMapToken(t *testing.T) {
 	}
 
 	fac := &serviceprovider.Factory{
-		Configuration: config.Configuration{
+		Configuration: config.NewLiveConfiguration(config.Configuration{
 			TokenLookupCacheTtl: 100 * time.Hour,
-		},
+		}),
 		KubernetesClient: k8sClient,
 		HttpClient:       httpClient,
 		Initializers: map[config.ServiceProviderType]serviceprovider.Initializer{
@@ -174,11 +204,11 @@ func TestValidate(t *testing.T) {
 
 	assert.Equal(t, 3, len(res.ScopeValidation))
 	assert.NotNil(t, res.ScopeValidation[0])
-	assert.Equal(t, "user-related permissions are not supported for Quay", res.ScopeValidation[0].Error())
+	assert.Equal(t, "user-related permissions are not supported for Quay (the Quay tokens only give access to the repositories, remove the permissions with the 'user' area, see https://docs.quay.io/api/)", res.ScopeValidation[0].Error())
 	assert.NotNil(t, res.ScopeValidation[1])
-	assert.Equal(t, "unknown scope: 'blah'", res.ScopeValidation[1].Error())
+	assert.Equal(t, "unknown scope: 'blah'", errors.Unwrap(res.ScopeValidation[1]).Error())
 	assert.NotNil(t, res.ScopeValidation[2])
-	assert.Equal(t, "scope 'user:read' is not supported", res.ScopeValidation[2].Error())
+	assert.Equal(t, "scope 'user:read' is not supported", errors.Unwrap(res.ScopeValidation[2]).Error())
 }
 
 func TestQuay_TranslateToScopes(t *testing.T) {
@@ -212,6 +242,7 @@ func TestQuay_TranslateToScopes(t *testing.T) {
 	assert.Equal(t, []string{"repo:read"}, q.TranslateToScopes(repoR))
 	assert.Equal(t, []string{"repo:write"}, q.TranslateToScopes(repoW))
 	assert.Equal(t, []string{"repo:read", "repo:write"}, q.TranslateToScopes(repoRW))
+	assert.Equal(t, []string{"repo:write"}, q.TranslateToScopes(api.Permission{Area: api.PermissionAreaSigning, Type: api.PermissionTypeWrite}))
 	assert.Equal(t, []string{"repo:read"}, q.TranslateToScopes(repoMR))
 	assert.Equal(t, []string{"repo:write"}, q.TranslateToScopes(repoMW))
 	assert.Equal(t, []string{"repo:read", "repo:write"}, q.TranslateToScopes(repoMRW))
@@ -249,6 +280,7 @@ func mockQuay(cl client.Client, returnCode int, httpErr error) *Quay {
 					return true, nil
 				},
 			},
+			RepoHostParser: serviceprovider.RepoHostParserFunc(serviceprovider.RepoHostFromUrl),
 		},
 	}
 }
@@ -259,3 +291,29 @@ func mockK8sClient(objects ...client.Object) client.WithWatch {
 	utilruntime.Must(api.AddToScheme(sch))
 	return fake.NewClientBuilder().WithScheme(sch).WithObjects(objects...).Build()
 }
+
+func TestGetAccessibleResources(t *testing.T) {
+	q := &Quay{}
+
+	state, err := json.Marshal(TokenState{
+		Repositories: map[string]EntityRecord{
+			"org/b":       {PossessedScopes: []Scope{ScopePull}},
+			"org/a":       {PossessedScopes: []Scope{ScopeRepoRead, ScopePull}},
+			"org/private": {PossessedScopes: []Scope{}},
+		},
+		Organizations: map[string]EntityRecord{
+			"org":   {PossessedScopes: []Scope{ScopeOrgAdmin}},
+			"other": {},
+		},
+	})
+	assert.NoError(t, err)
+
+	res, err := q.GetAccessibleResources(context.TODO(), &api.SPIAccessToken{
+		Status: api.SPIAccessTokenStatus{
+			TokenMetadata: &api.TokenMetadata{ServiceProviderState: state},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"org"}, res.Organizations)
+	assert.Equal(t, []string{"https://quay.io/org/a", "https://quay.io/org/b"}, res.Repositories)
+}
@@ -25,6 +25,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
 )
 
 // EntityRecord stores the scopes possessed by some token for given "entity" (either repository or organization).
@@ -42,6 +43,10 @@ type TokenState struct {
 	Organizations map[string]EntityRecord
 }
 
+// stateSchema is the schema of the serialized TokenState. Bump the version and add a migration from the previous
+// version whenever the form of the TokenState changes.
+var stateSchema = serviceprovider.StateSchema{Version: 1}
+
 // Scope represents a Quay OAuth scope
 type Scope string
 
@@ -58,6 +63,17 @@ const (
 	ScopePull Scope = "pull"
 )
 
+// supportedScopes is the list of the scopes that can be requested in the permissions of the tokens and bindings
+var supportedScopes = []string{
+	string(ScopeRepoRead),
+	string(ScopeRepoWrite),
+	string(ScopeRepoAdmin),
+	string(ScopeRepoCreate),
+	string(ScopeOrgAdmin),
+	string(ScopePull),
+	string(ScopePush),
+}
+
 // Implies returns true if the scope implies the other scope. A scope implies itself.
 func (s Scope) Implies(other Scope) bool {
 	if s == other {
@@ -16,6 +16,7 @@ package quay
 
 import (
 	"context"
+	"fmt"
 
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
@@ -43,7 +44,40 @@ func (t *tokenFilter) Matches(ctx context.Context, matchable serviceprovider.Mat
 		return false, err
 	}
 
-	requiredScopes := serviceprovider.GetAllScopes(translateToQuayScopes, matchable.Permissions())
+	return scopesMatch(matchable.Permissions(), rec), nil
+}
+
+// offlineTokenFilter matches the tokens using only the repository metadata already cached in the tokens. Unlike
+// tokenFilter, it never contacts Quay, so the tokens that haven't been matched against the repository before don't
+// match.
+type offlineTokenFilter struct{}
+
+var _ serviceprovider.TokenFilter = (*offlineTokenFilter)(nil)
+
+func (t *offlineTokenFilter) Matches(_ context.Context, matchable serviceprovider.Matchable, token *api.SPIAccessToken) (bool, error) {
+	if token.Status.TokenMetadata == nil {
+		return false, nil
+	}
+
+	quayState := TokenState{}
+	if err := stateSchema.Unmarshal(token.Status.TokenMetadata.ServiceProviderState, &quayState); err != nil {
+		return false, err
+	}
+
+	orgOrUser, repo, _ := splitToOrganizationAndRepositoryAndVersion(matchable.RepoUrl())
+	if orgOrUser == "" || repo == "" {
+		return false, fmt.Errorf("repository URL invalid: %s", matchable.RepoUrl())
+	}
+
+	return scopesMatch(matchable.Permissions(), RepositoryMetadata{
+		Repository:   quayState.Repositories[orgOrUser+"/"+repo],
+		Organization: quayState.Organizations[orgOrUser],
+	}), nil
+}
+
+// scopesMatch checks that the repository metadata contains all the scopes required by the permissions.
+func scopesMatch(perms *api.Permissions, rec RepositoryMetadata) bool {
+	requiredScopes := serviceprovider.GetAllScopes(translateToQuayScopes, perms)
 
 	for _, s := range requiredScopes {
 		requiredScope := Scope(s)
@@ -58,9 +92,9 @@ func (t *tokenFilter) Matches(ctx context.Context, matchable serviceprovider.Mat
 		}
 
 		if !requiredScope.IsIncluded(testedRecord.PossessedScopes) {
-			return false, nil
+			return false
 		}
 	}
 
-	return true, nil
+	return true
 }
@@ -0,0 +1,253 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serviceprovider
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/httptransport"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// RateLimits is the tracker of the rate limits shared by all the service providers.
+var RateLimits = &RateLimitTracker{}
+
+var rateLimitRemainingGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "spi_service_provider_rate_limit_remaining",
+	Help: "The number of the API requests remaining in the current rate limit window of the credentials used with the OAuth application as last reported by the service provider.",
+}, []string{"sp_type", "client_id", "api", "credentials"})
+
+var rateLimitResetGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "spi_service_provider_rate_limit_reset_timestamp_seconds",
+	Help: "The unix time when the current rate limit window of the credentials used with the OAuth application resets as last reported by the service provider.",
+}, []string{"sp_type", "client_id", "api", "credentials"})
+
+// rateLimitPruneInterval is how often the rate limits whose windows have already reset are forgotten so that
+// the rate limits of the deleted tokens don't accumulate.
+const rateLimitPruneInterval = 10 * time.Minute
+
+func init() {
+	metrics.Registry.MustRegister(rateLimitRemainingGauge, rateLimitResetGauge)
+}
+
+// RateLimit is the state of the quota of the API requests of an OAuth application.
+type RateLimit struct {
+	// Remaining is the number of the requests remaining in the current rate limit window.
+	Remaining int
+	// Reset is the time when the current rate limit window resets.
+	Reset time.Time
+}
+
+// Delay returns how long the requests should be postponed so that the quota is not exhausted. This is the time
+// remaining until the reset of the rate limit if fewer than threshold requests remain, 0 otherwise.
+func (l RateLimit) Delay(threshold int, now time.Time) time.Duration {
+	if l.Remaining >= threshold || !l.Reset.After(now) {
+		return 0
+	}
+
+	return l.Reset.Sub(now)
+}
+
+// RateLimitKey identifies the quota the rate limit applies to. The service providers usually limit the requests made
+// with each user's credentials separately and have separate quotas for their different APIs.
+type RateLimitKey struct {
+	ServiceProviderType api.ServiceProviderType
+	ClientId            string
+	// Credentials identifies the credentials the requests were made with (see RateLimitCredentials). Empty for
+	// the unauthenticated requests.
+	Credentials string
+	// Api is the API the rate limit applies to as reported by the service provider (e.g. "core" or "graphql" in case of
+	// GitHub). Empty if the service provider doesn't report it.
+	Api string
+}
+
+// RateLimitCredentials returns the identification of the credentials in the RateLimitKey. The credentials are hashed
+// so that they are not kept in memory nor exposed in the metrics.
+func RateLimitCredentials(accessToken string) string {
+	if accessToken == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(accessToken))
+	return hex.EncodeToString(sum[:8])
+}
+
+// RateLimitTracker keeps the rate limits last reported by the service providers for the OAuth applications and
+// exposes them as metrics.
+type RateLimitTracker struct {
+	lock       sync.RWMutex
+	limits     map[RateLimitKey]RateLimit
+	lastPruned time.Time
+}
+
+// Observe records the rate limit reported in the headers of the response, if any. Both the GitHub style
+// (X-RateLimit-Remaining, X-RateLimit-Reset) and the GitLab style (RateLimit-Remaining, RateLimit-Reset) headers are
+// understood, the reset being a unix timestamp in both cases.
+func (t *RateLimitTracker) Observe(key RateLimitKey, res *http.Response) {
+	remaining, ok := intHeader(res.Header, "X-RateLimit-Remaining", "RateLimit-Remaining")
+	if !ok {
+		return
+	}
+	reset, ok := intHeader(res.Header, "X-RateLimit-Reset", "RateLimit-Reset")
+	if !ok {
+		return
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.limits == nil {
+		t.limits = map[RateLimitKey]RateLimit{}
+	}
+	t.prune(time.Now())
+	t.limits[key] = RateLimit{Remaining: remaining, Reset: time.Unix(int64(reset), 0)}
+
+	rateLimitRemainingGauge.WithLabelValues(metricLabels(key)...).Set(float64(remaining))
+	rateLimitResetGauge.WithLabelValues(metricLabels(key)...).Set(float64(reset))
+}
+
+// prune forgets the rate limits whose windows have reset, at most once per rateLimitPruneInterval. The caller must hold
+// the write lock.
+func (t *RateLimitTracker) prune(now time.Time) {
+	if now.Sub(t.lastPruned) < rateLimitPruneInterval {
+		return
+	}
+	t.lastPruned = now
+
+	for key, limit := range t.limits {
+		if limit.Reset.Before(now) {
+			delete(t.limits, key)
+			rateLimitRemainingGauge.DeleteLabelValues(metricLabels(key)...)
+			rateLimitResetGauge.DeleteLabelValues(metricLabels(key)...)
+		}
+	}
+}
+
+func metricLabels(key RateLimitKey) []string {
+	return []string{string(key.ServiceProviderType), key.ClientId, key.Api, key.Credentials}
+}
+
+// Get returns the last observed rate limit with the provided key. The boolean is false if no rate limit has been
+// observed yet.
+func (t *RateLimitTracker) Get(key RateLimitKey) (RateLimit, bool) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	limit, ok := t.limits[key]
+	return limit, ok
+}
+
+// GetMostRestrictive returns the last observed rate limit with the fewest remaining requests out of the rate limits of
+// the different APIs of the service provider for the credentials in the key. The Api of the key is ignored.
+// The boolean is false if no such rate limit has been observed yet.
+func (t *RateLimitTracker) GetMostRestrictive(key RateLimitKey) (RateLimit, bool) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	var ret RateLimit
+	found := false
+	for k, limit := range t.limits {
+		if k.ServiceProviderType != key.ServiceProviderType || k.ClientId != key.ClientId || k.Credentials != key.Credentials {
+			continue
+		}
+		if !found || limit.Remaining < ret.Remaining {
+			ret = limit
+			found = true
+		}
+	}
+	return ret, found
+}
+
+// List returns the copy of the last observed rate limits of all the OAuth applications.
+func (t *RateLimitTracker) List() map[RateLimitKey]RateLimit {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	ret := make(map[RateLimitKey]RateLimit, len(t.limits))
+	for k, v := range t.limits {
+		ret[k] = v
+	}
+	return ret
+}
+
+// RateLimitTrackingHttpClient returns a copy of the provided client that records the rate limits reported in
+// the responses in the tracker under the provided key completed with the credentials from the Authorization header of
+// the request and the API from the X-RateLimit-Resource header of the response. The Authorization header therefore
+// needs to be set before the request reaches the returned client (e.g. by the AuthenticatingHttpClient wrapping it).
+func RateLimitTrackingHttpClient(cl *http.Client, tracker *RateLimitTracker, key RateLimitKey) *http.Client {
+	transport := cl.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	return &http.Client{
+		Transport: httptransport.ExaminingRoundTripper{
+			RoundTripper: transport,
+			Examiner: httptransport.RoundTripExaminerFunc(func(request *http.Request, response *http.Response) error {
+				requestKey := key
+				requestKey.Credentials = RateLimitCredentials(credentialsFromAuthorization(request.Header.Get("Authorization")))
+				requestKey.Api = response.Header.Get("X-RateLimit-Resource")
+				tracker.Observe(requestKey, response)
+				return nil
+			}),
+		},
+		CheckRedirect: cl.CheckRedirect,
+		Jar:           cl.Jar,
+		Timeout:       cl.Timeout,
+	}
+}
+
+// credentialsFromAuthorization returns the credentials from the value of the Authorization header, i.e. the value
+// without the authentication scheme.
+func credentialsFromAuthorization(authorization string) string {
+	if idx := strings.IndexByte(authorization, ' '); idx >= 0 {
+		return strings.TrimSpace(authorization[idx+1:])
+	}
+	return authorization
+}
+
+// ThrottlingDelay returns how long the work with the service provider using the provided token data should be postponed
+// because the quota of the token is nearly exhausted. It is 0 if the threshold is not positive, if there is no token
+// data, if the service provider doesn't report the rate limits or if at least threshold requests remain.
+func ThrottlingDelay(sp ServiceProvider, tokenData *api.Token, threshold int) time.Duration {
+	reporter, ok := sp.(RateLimitReporter)
+	if threshold <= 0 || tokenData == nil || !ok {
+		return 0
+	}
+
+	limit, ok := reporter.CurrentRateLimit(tokenData)
+	if !ok {
+		return 0
+	}
+
+	return limit.Delay(threshold, time.Now())
+}
+
+func intHeader(header http.Header, names ...string) (int, bool) {
+	for _, name := range names {
+		if val := header.Get(name); val != "" {
+			i, err := strconv.Atoi(val)
+			return i, err == nil
+		}
+	}
+	return 0, false
+}
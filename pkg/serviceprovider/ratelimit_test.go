@@ -0,0 +1,196 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serviceprovider
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/httptransport"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitTracker_Observe(t *testing.T) {
+	key := RateLimitKey{ServiceProviderType: api.ServiceProviderTypeGitHub, ClientId: "clientId"}
+
+	t.Run("github headers", func(t *testing.T) {
+		tracker := &RateLimitTracker{}
+		tracker.Observe(key, &http.Response{Header: http.Header{
+			"X-Ratelimit-Remaining": []string{"42"},
+			"X-Ratelimit-Reset":     []string{"1700000000"},
+		}})
+
+		limit, ok := tracker.Get(key)
+		assert.True(t, ok)
+		assert.Equal(t, 42, limit.Remaining)
+		assert.Equal(t, time.Unix(1700000000, 0), limit.Reset)
+	})
+
+	t.Run("gitlab headers", func(t *testing.T) {
+		tracker := &RateLimitTracker{}
+		tracker.Observe(key, &http.Response{Header: http.Header{
+			"Ratelimit-Remaining": []string{"5"},
+			"Ratelimit-Reset":     []string{"1700000000"},
+		}})
+
+		limit, ok := tracker.Get(key)
+		assert.True(t, ok)
+		assert.Equal(t, 5, limit.Remaining)
+	})
+
+	t.Run("no or invalid headers", func(t *testing.T) {
+		tracker := &RateLimitTracker{}
+		tracker.Observe(key, &http.Response{Header: http.Header{}})
+		tracker.Observe(key, &http.Response{Header: http.Header{
+			"X-Ratelimit-Remaining": []string{"many"},
+			"X-Ratelimit-Reset":     []string{"1700000000"},
+		}})
+
+		_, ok := tracker.Get(key)
+		assert.False(t, ok)
+		assert.Empty(t, tracker.List())
+	})
+}
+
+func TestRateLimit_Delay(t *testing.T) {
+	now := time.Now()
+
+	assert.Equal(t, time.Duration(0), RateLimit{Remaining: 100, Reset: now.Add(time.Minute)}.Delay(100, now))
+	assert.Equal(t, time.Minute, RateLimit{Remaining: 99, Reset: now.Add(time.Minute)}.Delay(100, now))
+	assert.Equal(t, time.Duration(0), RateLimit{Remaining: 0, Reset: now.Add(-time.Minute)}.Delay(100, now))
+}
+
+func TestRateLimitTrackingHttpClient(t *testing.T) {
+	key := RateLimitKey{ServiceProviderType: api.ServiceProviderTypeGitHub, ClientId: "clientId"}
+	tracker := &RateLimitTracker{}
+	reset := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+
+	cl := AuthenticatingHttpClient(RateLimitTrackingHttpClient(&http.Client{
+		Transport: util.FakeRoundTrip(func(r *http.Request) (*http.Response, error) {
+			// the token "exhausted" has no requests left in the REST API, the token "fresh" has plenty
+			remaining := "4999"
+			if r.Header.Get("Authorization") == "Bearer exhausted" && r.URL.Path != "/graphql" {
+				remaining = "0"
+			}
+			resource := "core"
+			if r.URL.Path == "/graphql" {
+				resource = "graphql"
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header: http.Header{
+					"X-Ratelimit-Remaining": []string{remaining},
+					"X-Ratelimit-Reset":     []string{reset},
+					"X-Ratelimit-Resource":  []string{resource},
+				},
+				Body: io.NopCloser(strings.NewReader("")),
+			}, nil
+		}),
+	}, tracker, key))
+
+	get := func(token string, url string) {
+		req, err := http.NewRequestWithContext(httptransport.WithBearerToken(context.TODO(), token), "GET", url, nil)
+		assert.NoError(t, err)
+		res, err := cl.Do(req)
+		assert.NoError(t, err)
+		assert.NoError(t, res.Body.Close())
+	}
+
+	get("exhausted", "https://api.github.com/user")
+	get("exhausted", "https://api.github.com/graphql")
+	get("fresh", "https://api.github.com/user")
+
+	t.Run("tracks the APIs separately", func(t *testing.T) {
+		limit, ok := tracker.Get(RateLimitKey{ServiceProviderType: api.ServiceProviderTypeGitHub, ClientId: "clientId", Credentials: RateLimitCredentials("exhausted"), Api: "core"})
+		assert.True(t, ok)
+		assert.Equal(t, 0, limit.Remaining)
+
+		limit, ok = tracker.Get(RateLimitKey{ServiceProviderType: api.ServiceProviderTypeGitHub, ClientId: "clientId", Credentials: RateLimitCredentials("exhausted"), Api: "graphql"})
+		assert.True(t, ok)
+		assert.Equal(t, 4999, limit.Remaining)
+	})
+
+	t.Run("tracks the credentials separately", func(t *testing.T) {
+		limit, ok := tracker.GetMostRestrictive(RateLimitKey{ServiceProviderType: api.ServiceProviderTypeGitHub, ClientId: "clientId", Credentials: RateLimitCredentials("exhausted")})
+		assert.True(t, ok)
+		assert.Equal(t, 0, limit.Remaining)
+
+		limit, ok = tracker.GetMostRestrictive(RateLimitKey{ServiceProviderType: api.ServiceProviderTypeGitHub, ClientId: "clientId", Credentials: RateLimitCredentials("fresh")})
+		assert.True(t, ok)
+		assert.Equal(t, 4999, limit.Remaining)
+
+		_, ok = tracker.GetMostRestrictive(RateLimitKey{ServiceProviderType: api.ServiceProviderTypeGitHub, ClientId: "clientId", Credentials: RateLimitCredentials("unknown")})
+		assert.False(t, ok)
+	})
+
+	t.Run("doesn't keep the credentials", func(t *testing.T) {
+		for k := range tracker.List() {
+			assert.NotContains(t, k.Credentials, "exhausted")
+			assert.NotContains(t, k.Credentials, "fresh")
+		}
+	})
+}
+
+func TestRateLimitTracker_Prune(t *testing.T) {
+	tracker := &RateLimitTracker{}
+	expired := RateLimitKey{ServiceProviderType: api.ServiceProviderTypeGitHub, Credentials: "expired"}
+	current := RateLimitKey{ServiceProviderType: api.ServiceProviderTypeGitHub, Credentials: "current"}
+
+	tracker.Observe(expired, &http.Response{Header: http.Header{
+		"X-Ratelimit-Remaining": []string{"0"},
+		"X-Ratelimit-Reset":     []string{strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)},
+	}})
+	tracker.lastPruned = time.Time{}
+	tracker.Observe(current, &http.Response{Header: http.Header{
+		"X-Ratelimit-Remaining": []string{"10"},
+		"X-Ratelimit-Reset":     []string{strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)},
+	}})
+
+	_, ok := tracker.Get(expired)
+	assert.False(t, ok)
+	_, ok = tracker.Get(current)
+	assert.True(t, ok)
+}
+
+type rateLimitReportingServiceProvider struct {
+	ServiceProvider
+	limit RateLimit
+}
+
+func (r rateLimitReportingServiceProvider) CurrentRateLimit(tokenData *api.Token) (RateLimit, bool) {
+	if tokenData.AccessToken != "exhausted" {
+		return RateLimit{}, false
+	}
+	return r.limit, true
+}
+
+func TestThrottlingDelay(t *testing.T) {
+	sp := rateLimitReportingServiceProvider{limit: RateLimit{Remaining: 10, Reset: time.Now().Add(time.Hour)}}
+	exhausted := &api.Token{AccessToken: "exhausted"}
+
+	assert.Greater(t, ThrottlingDelay(sp, exhausted, 100), 59*time.Minute)
+	assert.Equal(t, time.Duration(0), ThrottlingDelay(sp, exhausted, 10))
+	assert.Equal(t, time.Duration(0), ThrottlingDelay(sp, exhausted, 0))
+	assert.Equal(t, time.Duration(0), ThrottlingDelay(sp, &api.Token{AccessToken: "fresh"}, 100))
+	assert.Equal(t, time.Duration(0), ThrottlingDelay(sp, nil, 100))
+	assert.Equal(t, time.Duration(0), ThrottlingDelay(sp.ServiceProvider, exhausted, 100))
+}
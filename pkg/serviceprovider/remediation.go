@@ -0,0 +1,101 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serviceprovider
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ValidationProblem identifies the kind of the failure of the validation of the permissions. It is used to look up
+// the remediation of the failure in the ValidationMessageCatalog of the service provider.
+type ValidationProblem string
+
+const (
+	// ValidationProblemUnsupportedPermissionArea is reported for the permissions with an area the service provider
+	// cannot give access to.
+	ValidationProblemUnsupportedPermissionArea ValidationProblem = "UnsupportedPermissionArea"
+	// ValidationProblemUnsupportedScope is reported for the additional scopes the service provider knows but SPI
+	// doesn't support.
+	ValidationProblemUnsupportedScope ValidationProblem = "UnsupportedScope"
+	// ValidationProblemUnknownScope is reported for the additional scopes not known to the service provider, see
+	// UnknownScopeError.
+	ValidationProblemUnknownScope ValidationProblem = "UnknownScope"
+	// ValidationProblemInvalidScopeSyntax is reported for the additional scopes that cannot be valid in any service
+	// provider, see InvalidScopeSyntaxError.
+	ValidationProblemInvalidScopeSyntax ValidationProblem = "InvalidScopeSyntax"
+)
+
+// Remediation tells the users how to fix a validation failure.
+type Remediation struct {
+	// Hint is the provider-specific advice on fixing the failure.
+	Hint string
+	// DocumentationUrl points to the documentation of the service provider explaining the matter.
+	DocumentationUrl string
+}
+
+// ValidationMessageCatalog contains the remediations of the validation failures of a service provider.
+type ValidationMessageCatalog map[ValidationProblem]Remediation
+
+// RemediableError is a validation failure accompanied by its remediation. Its message ends up in the status of
+// the validated objects and in the responses of the admission webhooks, so that the users can fix the objects without
+// looking into the logs or the source code.
+type RemediableError struct {
+	Problem     ValidationProblem
+	Err         error
+	Remediation Remediation
+}
+
+func (e *RemediableError) Error() string {
+	switch {
+	case e.Remediation.Hint != "" && e.Remediation.DocumentationUrl != "":
+		return fmt.Sprintf("%s (%s, see %s)", e.Err.Error(), e.Remediation.Hint, e.Remediation.DocumentationUrl)
+	case e.Remediation.Hint != "":
+		return fmt.Sprintf("%s (%s)", e.Err.Error(), e.Remediation.Hint)
+	case e.Remediation.DocumentationUrl != "":
+		return fmt.Sprintf("%s (see %s)", e.Err.Error(), e.Remediation.DocumentationUrl)
+	default:
+		return e.Err.Error()
+	}
+}
+
+func (e *RemediableError) Unwrap() error {
+	return e.Err
+}
+
+// Explain attaches the remediation of the problem from the catalog to the error. The error is returned unchanged if
+// the catalog doesn't know the problem.
+func (c ValidationMessageCatalog) Explain(problem ValidationProblem, err error) error {
+	remediation, ok := c[problem]
+	if !ok || err == nil {
+		return err
+	}
+	return &RemediableError{Problem: problem, Err: err, Remediation: remediation}
+}
+
+// ValidateScope is like the ValidateScope function but attaches the remediation from the catalog to the returned
+// error.
+func (c ValidationMessageCatalog) ValidateScope(scope string, knownScopes []string) error {
+	err := ValidateScope(scope, knownScopes)
+	if err == nil {
+		return nil
+	}
+
+	var syntaxErr *InvalidScopeSyntaxError
+	if errors.As(err, &syntaxErr) {
+		return c.Explain(ValidationProblemInvalidScopeSyntax, err)
+	}
+	return c.Explain(ValidationProblemUnknownScope, err)
+}
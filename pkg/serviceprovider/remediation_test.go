@@ -0,0 +1,59 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serviceprovider
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidationMessageCatalog_Explain(t *testing.T) {
+	catalog := ValidationMessageCatalog{
+		ValidationProblemUnsupportedScope:          {Hint: "remove it", DocumentationUrl: "https://docs"},
+		ValidationProblemUnsupportedPermissionArea: {Hint: "remove the permission"},
+		ValidationProblemUnknownScope:              {DocumentationUrl: "https://docs/scopes"},
+	}
+	cause := errors.New("scope 'x' is not supported")
+
+	err := catalog.Explain(ValidationProblemUnsupportedScope, cause)
+	assert.Equal(t, "scope 'x' is not supported (remove it, see https://docs)", err.Error())
+	assert.ErrorIs(t, err, cause)
+
+	var remediable *RemediableError
+	assert.True(t, errors.As(err, &remediable))
+	assert.Equal(t, ValidationProblemUnsupportedScope, remediable.Problem)
+
+	assert.Equal(t, "scope 'x' is not supported (remove the permission)", catalog.Explain(ValidationProblemUnsupportedPermissionArea, cause).Error())
+	assert.Equal(t, "scope 'x' is not supported (see https://docs/scopes)", catalog.Explain(ValidationProblemUnknownScope, cause).Error())
+	assert.Same(t, cause, catalog.Explain(ValidationProblemInvalidScopeSyntax, cause))
+	assert.Nil(t, catalog.Explain(ValidationProblemUnsupportedScope, nil))
+}
+
+func TestValidationMessageCatalog_ValidateScope(t *testing.T) {
+	catalog := ValidationMessageCatalog{
+		ValidationProblemUnknownScope:       {Hint: "use a known scope"},
+		ValidationProblemInvalidScopeSyntax: {Hint: "use one scope per item"},
+	}
+	known := []string{"repo", "user"}
+
+	assert.NoError(t, catalog.ValidateScope("repo", known))
+	assert.Equal(t, "unknown scope: 'rep', did you mean 'repo'? (use a known scope)", catalog.ValidateScope("rep", known).Error())
+	assert.Equal(t, "invalid scope syntax: 'repo user' (use one scope per item)", catalog.ValidateScope("repo user", known).Error())
+
+	var unknown *UnknownScopeError
+	assert.True(t, errors.As(catalog.ValidateScope("rep", known), &unknown))
+}
@@ -0,0 +1,128 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serviceprovider
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// maxSuggestionDistance is the maximum edit distance of a known scope from an unknown scope for the known scope to be
+// suggested as a replacement.
+const maxSuggestionDistance = 2
+
+// InvalidScopeSyntaxError is reported for scopes that cannot be valid in any service provider, e.g. because they would
+// break the scope list in the OAuth URL.
+type InvalidScopeSyntaxError struct {
+	Scope string
+}
+
+func (e *InvalidScopeSyntaxError) Error() string {
+	return fmt.Sprintf("invalid scope syntax: '%s'", e.Scope)
+}
+
+// UnknownScopeError is reported for scopes that are not known to the service provider. It contains the suggestions
+// of the known scopes the user might have meant instead.
+type UnknownScopeError struct {
+	Scope       string
+	Suggestions []string
+}
+
+func (e *UnknownScopeError) Error() string {
+	msg := fmt.Sprintf("unknown scope: '%s'", e.Scope)
+	if len(e.Suggestions) > 0 {
+		msg += fmt.Sprintf(", did you mean '%s'?", strings.Join(e.Suggestions, "' or '"))
+	}
+	return msg
+}
+
+// ValidateScope checks that the provided scope has a valid syntax and is one of the known scopes. The returned error is
+// either InvalidScopeSyntaxError or UnknownScopeError.
+func ValidateScope(scope string, knownScopes []string) error {
+	if !validScopeSyntax(scope) {
+		return &InvalidScopeSyntaxError{Scope: scope}
+	}
+
+	for _, s := range knownScopes {
+		if s == scope {
+			return nil
+		}
+	}
+
+	return &UnknownScopeError{Scope: scope, Suggestions: SuggestScopes(scope, knownScopes)}
+}
+
+// validScopeSyntax checks that the scope is not empty and doesn't contain the characters used to separate the scopes.
+func validScopeSyntax(scope string) bool {
+	return scope != "" && strings.IndexFunc(scope, func(r rune) bool { return unicode.IsSpace(r) || r == ',' }) < 0
+}
+
+// SuggestScopes returns the known scopes that are similar to the provided scope, the most similar first.
+func SuggestScopes(scope string, knownScopes []string) []string {
+	distances := map[string]int{}
+	suggestions := []string{}
+	for _, s := range knownScopes {
+		d := editDistance(strings.ToLower(scope), strings.ToLower(s))
+		if d <= maxSuggestionDistance {
+			distances[s] = d
+			suggestions = append(suggestions, s)
+		}
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		if distances[suggestions[i]] != distances[suggestions[j]] {
+			return distances[suggestions[i]] < distances[suggestions[j]]
+		}
+		return suggestions[i] < suggestions[j]
+	})
+
+	return suggestions
+}
+
+// editDistance computes the Levenshtein distance between the two strings.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(rb)]
+}
+
+func min(vals ...int) int {
+	ret := vals[0]
+	for _, v := range vals[1:] {
+		if v < ret {
+			ret = v
+		}
+	}
+	return ret
+}
@@ -0,0 +1,64 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serviceprovider
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateScope(t *testing.T) {
+	known := []string{"repo", "repo:status", "read:org", "write:org"}
+
+	t.Run("known", func(t *testing.T) {
+		assert.NoError(t, ValidateScope("repo:status", known))
+	})
+
+	t.Run("invalid syntax", func(t *testing.T) {
+		for _, s := range []string{"", "repo status", "repo,user", "repo\t"} {
+			err := ValidateScope(s, known)
+			assert.IsType(t, &InvalidScopeSyntaxError{}, err, "scope '%s'", s)
+		}
+	})
+
+	t.Run("unknown with suggestions", func(t *testing.T) {
+		err := ValidateScope("raed:org", known)
+		assert.Equal(t, &UnknownScopeError{Scope: "raed:org", Suggestions: []string{"read:org"}}, err)
+		assert.Equal(t, "unknown scope: 'raed:org', did you mean 'read:org'?", err.Error())
+	})
+
+	t.Run("unknown with multiple suggestions", func(t *testing.T) {
+		err := ValidateScope("read:or", []string{"read:orgs", "read:org"})
+		assert.Equal(t, "unknown scope: 'read:or', did you mean 'read:org' or 'read:orgs'?", err.Error())
+	})
+
+	t.Run("suggestions ignore case", func(t *testing.T) {
+		err := ValidateScope("REPO", known)
+		assert.Equal(t, []string{"repo"}, err.(*UnknownScopeError).Suggestions)
+	})
+
+	t.Run("unknown without suggestions", func(t *testing.T) {
+		err := ValidateScope("blah", known)
+		assert.Equal(t, "unknown scope: 'blah'", err.Error())
+	})
+}
+
+func TestEditDistance(t *testing.T) {
+	assert.Equal(t, 0, editDistance("repo", "repo"))
+	assert.Equal(t, 1, editDistance("repo", "rep"))
+	assert.Equal(t, 2, editDistance("raed", "read"))
+	assert.Equal(t, 4, editDistance("", "repo"))
+}
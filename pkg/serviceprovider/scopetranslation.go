@@ -0,0 +1,181 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serviceprovider
+
+import (
+	"fmt"
+	"sync"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/util/errors"
+)
+
+// ScopeTranslation overrides the scopes a permission is translated to by a service provider.
+type ScopeTranslation struct {
+	// Area is the permission area the translation applies to.
+	Area api.PermissionArea `yaml:"area"`
+	// Type is the permission type the translation applies to. If empty, the translation applies to all the permission
+	// types in the area that don't have a translation of their own.
+	Type api.PermissionType `yaml:"type,omitempty"`
+	// Scopes are the scopes the permission translates to.
+	Scopes []string `yaml:"scopes"`
+}
+
+// ScopeTranslationTable holds the scope translations of the service providers. The translations in the table take
+// precedence over the translations built into the service providers, so that the administrators can make use of
+// the scopes introduced by the service providers without waiting for a new release of the operator. The table is
+// passed to the service providers in the Factory. A nil table has no translations.
+type ScopeTranslationTable struct {
+	lock         sync.RWMutex
+	translations map[api.ServiceProviderType][]ScopeTranslation
+}
+
+// Set replaces all the translations in the table.
+func (t *ScopeTranslationTable) Set(translations map[api.ServiceProviderType][]ScopeTranslation) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.translations = translations
+}
+
+// Translate translates the permission into the scopes of the service provider of given type. The translation for
+// the exact permission type is preferred over the translation for the whole permission area. If there is no
+// translation for the permission in the table, the provided builtin translation is used.
+func (t *ScopeTranslationTable) Translate(spType api.ServiceProviderType, permission api.Permission, builtin func(api.Permission) []string) []string {
+	if t == nil {
+		return builtin(permission)
+	}
+
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	var areaMatch *ScopeTranslation
+	for i := range t.translations[spType] {
+		tr := &t.translations[spType][i]
+		if tr.Area != permission.Area {
+			continue
+		}
+		if tr.Type == permission.Type {
+			return append([]string{}, tr.Scopes...)
+		}
+		if tr.Type == "" && areaMatch == nil {
+			areaMatch = tr
+		}
+	}
+
+	if areaMatch != nil {
+		return append([]string{}, areaMatch.Scopes...)
+	}
+
+	return builtin(permission)
+}
+
+// KnownScopes returns the provided builtin scopes of the service provider of given type extended with the scopes
+// used in the translations in the table, so that the scopes introduced by the administrators can also be requested
+// in the additional scopes.
+func (t *ScopeTranslationTable) KnownScopes(spType api.ServiceProviderType, builtin []string) []string {
+	ret := append([]string{}, builtin...)
+	if t == nil {
+		return ret
+	}
+
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	seen := map[string]bool{}
+	for _, s := range builtin {
+		seen[s] = true
+	}
+
+	for _, tr := range t.translations[spType] {
+		for _, s := range tr.Scopes {
+			if !seen[s] {
+				seen[s] = true
+				ret = append(ret, s)
+			}
+		}
+	}
+
+	return ret
+}
+
+// ParseScopeTranslations parses the scope translations from the data of a config map. The keys of the data are
+// the service provider types (GitHub or Quay) and the values are the YAML lists of the translations of the service providers.
+// The syntax of the scopes is validated but the scopes don't need to be known to the operator.
+func ParseScopeTranslations(data map[string]string) (map[api.ServiceProviderType][]ScopeTranslation, error) {
+	ret := map[api.ServiceProviderType][]ScopeTranslation{}
+	errs := make([]error, 0)
+
+	for key, value := range data {
+		spType := api.ServiceProviderType(key)
+		switch spType {
+		case api.ServiceProviderTypeGitHub, api.ServiceProviderTypeQuay:
+		default:
+			// the other service providers don't use the scopes at all
+			errs = append(errs, fmt.Errorf("scope translations are not supported for the service provider type '%s'", key))
+			continue
+		}
+
+		translations := []ScopeTranslation{}
+		if err := yaml.Unmarshal([]byte(value), &translations); err != nil {
+			errs = append(errs, fmt.Errorf("%s: failed to parse the scope translations: %w", key, err))
+			continue
+		}
+
+		for i, tr := range translations {
+			for _, err := range tr.validate() {
+				errs = append(errs, fmt.Errorf("%s[%d]: %w", key, i, err))
+			}
+		}
+
+		ret[spType] = translations
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.NewAggregate(errs)
+	}
+
+	return ret, nil
+}
+
+// validate checks that the translation refers to a known permission and translates it to valid scopes.
+func (tr ScopeTranslation) validate() []error {
+	errs := make([]error, 0)
+
+	switch tr.Area {
+	case api.PermissionAreaRepository, api.PermissionAreaRepositoryMetadata, api.PermissionAreaWebhooks, api.PermissionAreaUser, api.PermissionAreaSigning:
+	default:
+		errs = append(errs, fmt.Errorf("unknown permission area '%s'", tr.Area))
+	}
+
+	switch tr.Type {
+	case "", api.PermissionTypeRead, api.PermissionTypeWrite, api.PermissionTypeReadWrite:
+	default:
+		errs = append(errs, fmt.Errorf("unknown permission type '%s'", tr.Type))
+	}
+
+	if len(tr.Scopes) == 0 {
+		errs = append(errs, fmt.Errorf("at least one scope is required"))
+	}
+
+	for _, s := range tr.Scopes {
+		if !validScopeSyntax(s) {
+			errs = append(errs, &InvalidScopeSyntaxError{Scope: s})
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,111 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serviceprovider
+
+import (
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseScopeTranslations(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		translations, err := ParseScopeTranslations(map[string]string{
+			"GitHub": `
+- area: repository
+  type: r
+  scopes: [public_repo]
+- area: webhooks
+  scopes: [admin:repo_hook]
+`,
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, map[api.ServiceProviderType][]ScopeTranslation{
+			api.ServiceProviderTypeGitHub: {
+				{Area: api.PermissionAreaRepository, Type: api.PermissionTypeRead, Scopes: []string{"public_repo"}},
+				{Area: api.PermissionAreaWebhooks, Scopes: []string{"admin:repo_hook"}},
+			},
+		}, translations)
+	})
+
+	t.Run("unsupported service provider", func(t *testing.T) {
+		_, err := ParseScopeTranslations(map[string]string{"Nexus": "[]"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "'Nexus'")
+	})
+
+	t.Run("invalid yaml", func(t *testing.T) {
+		_, err := ParseScopeTranslations(map[string]string{"Quay": "area: repository"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "Quay: failed to parse")
+	})
+
+	t.Run("invalid translations", func(t *testing.T) {
+		_, err := ParseScopeTranslations(map[string]string{
+			"GitHub": `
+- area: repos
+  type: x
+  scopes: ["repo, user"]
+- area: user
+`,
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "GitHub[0]: unknown permission area 'repos'")
+		assert.Contains(t, err.Error(), "GitHub[0]: unknown permission type 'x'")
+		assert.Contains(t, err.Error(), "GitHub[0]: invalid scope syntax: 'repo, user'")
+		assert.Contains(t, err.Error(), "GitHub[1]: at least one scope is required")
+	})
+}
+
+func TestScopeTranslationTable_Translate(t *testing.T) {
+	builtin := func(api.Permission) []string { return []string{"builtin"} }
+	table := &ScopeTranslationTable{}
+
+	read := api.Permission{Area: api.PermissionAreaRepository, Type: api.PermissionTypeRead}
+	write := api.Permission{Area: api.PermissionAreaRepository, Type: api.PermissionTypeWrite}
+	user := api.Permission{Area: api.PermissionAreaUser, Type: api.PermissionTypeRead}
+
+	assert.Equal(t, []string{"builtin"}, table.Translate(api.ServiceProviderTypeGitHub, read, builtin))
+
+	table.Set(map[api.ServiceProviderType][]ScopeTranslation{
+		api.ServiceProviderTypeGitHub: {
+			{Area: api.PermissionAreaRepository, Scopes: []string{"repo"}},
+			{Area: api.PermissionAreaRepository, Type: api.PermissionTypeRead, Scopes: []string{"public_repo"}},
+		},
+	})
+
+	assert.Equal(t, []string{"public_repo"}, table.Translate(api.ServiceProviderTypeGitHub, read, builtin))
+	assert.Equal(t, []string{"repo"}, table.Translate(api.ServiceProviderTypeGitHub, write, builtin))
+	assert.Equal(t, []string{"builtin"}, table.Translate(api.ServiceProviderTypeGitHub, user, builtin))
+	assert.Equal(t, []string{"builtin"}, table.Translate(api.ServiceProviderTypeQuay, read, builtin))
+
+	table.Set(nil)
+	assert.Equal(t, []string{"builtin"}, table.Translate(api.ServiceProviderTypeGitHub, read, builtin))
+}
+
+func TestScopeTranslationTable_KnownScopes(t *testing.T) {
+	table := &ScopeTranslationTable{}
+	table.Set(map[api.ServiceProviderType][]ScopeTranslation{
+		api.ServiceProviderTypeGitHub: {
+			{Area: api.PermissionAreaRepository, Scopes: []string{"repo", "new:scope"}},
+		},
+	})
+
+	assert.Equal(t, []string{"repo", "user", "new:scope"}, table.KnownScopes(api.ServiceProviderTypeGitHub, []string{"repo", "user"}))
+	assert.Equal(t, []string{"repo:read"}, table.KnownScopes(api.ServiceProviderTypeQuay, []string{"repo:read"}))
+}
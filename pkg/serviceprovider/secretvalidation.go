@@ -0,0 +1,139 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serviceprovider
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// requiredCredentialFlavors are the credential flavors that the secrets of some types can only be filled in with.
+var requiredCredentialFlavors = map[corev1.SecretType]api.CredentialFlavor{
+	corev1.SecretTypeSSHAuth:        api.CredentialFlavorSSHKey,
+	api.SecretTypeCosign:            api.CredentialFlavorCosignKey,
+	api.SecretTypeSigstoreOIDCToken: api.CredentialFlavorOIDCToken,
+}
+
+// ValidateSecretSpec checks that the secret requested by the binding can be created with the credentials of
+// the provided service provider. It checks that the service provider supports the secret type, that the secret type
+// can be filled in with the requested credential flavor and that the fields mapping produces valid and non-conflicting
+// keys in the secret data. The returned errors describe all the problems found.
+func ValidateSecretSpec(sp ServiceProvider, binding *api.SPIAccessTokenBinding) []error {
+	var errs []error
+
+	secretType := binding.Spec.Secret.Type
+
+	if restrictor, ok := sp.(SecretTypeRestrictor); ok && !containsSecretType(restrictor.SupportedSecretTypes(), secretType) {
+		errs = append(errs, fmt.Errorf("the %s service provider doesn't support secrets of type '%s'", sp.GetType(), secretType))
+	}
+
+	if requiredFlavor, ok := requiredCredentialFlavors[secretType]; ok && binding.Spec.CredentialFlavor != requiredFlavor {
+		errs = append(errs, fmt.Errorf("secrets of type '%s' require the %s credential flavor", secretType, requiredFlavor))
+	}
+
+	if binding.Spec.Secret.MavenServerId != "" && secretType != api.SecretTypeMavenSettings {
+		errs = append(errs, fmt.Errorf("the Maven server id can only be specified for secrets of type '%s'", api.SecretTypeMavenSettings))
+	}
+
+	if binding.Spec.Secret.HelmRepositoryName != "" && secretType != api.SecretTypeHelmRepository {
+		errs = append(errs, fmt.Errorf("the Helm repository name can only be specified for secrets of type '%s'", api.SecretTypeHelmRepository))
+	}
+
+	if binding.Spec.Secret.EnvPrefix != "" && !binding.Spec.Secret.EnvKeys {
+		errs = append(errs, errors.New("the env prefix can only be specified together with the env keys"))
+	}
+
+	if binding.Spec.Secret.LinkedServiceAccounts != nil {
+		if secretType != corev1.SecretTypeDockerConfigJson && secretType != corev1.SecretTypeDockercfg {
+			errs = append(errs, fmt.Errorf("only the secrets of type '%s' or '%s' can be linked to the service accounts", corev1.SecretTypeDockerConfigJson, corev1.SecretTypeDockercfg))
+		}
+		if binding.Spec.Secret.Delivery == api.SecretDeliveryPod {
+			errs = append(errs, errors.New("the secrets delivered into the pods cannot be linked to the service accounts"))
+		}
+		if _, err := metav1.LabelSelectorAsSelector(binding.Spec.Secret.LinkedServiceAccounts); err != nil {
+			errs = append(errs, fmt.Errorf("invalid selector of the linked service accounts: %w", err))
+		}
+	}
+
+	// the keys filled in automatically according to the secret type mapped to the names of the fields they contain
+	typeKeys := AccessTokenMapper{Token: "token", ServiceProviderUserName: "serviceProviderUserName"}.ToSecretType(secretType)
+	if binding.Spec.Secret.EnvKeys {
+		envKeys := AccessTokenMapper{Token: "token", ServiceProviderUserName: "serviceProviderUserName"}.ToEnv(sp.GetType(), binding.Spec.Secret.EnvPrefix)
+		for k, v := range envKeys {
+			if _, ok := typeKeys[k]; ok {
+				errs = append(errs, fmt.Errorf("the env key '%s' conflicts with the key required by the secret type '%s'", k, secretType))
+			}
+			if msgs := validation.IsEnvVarName(k); len(msgs) > 0 {
+				errs = append(errs, fmt.Errorf("the env key '%s' is not a valid environment variable name: %s", k, strings.Join(msgs, ", ")))
+			}
+			typeKeys[k] = v
+		}
+	}
+
+	fields := binding.Spec.Secret.Fields
+	if len(typeKeys) == 0 && secretType != "" && secretType != corev1.SecretTypeOpaque && fields == (api.TokenFieldMapping{}) {
+		errs = append(errs, fmt.Errorf("secrets of type '%s' have no automatic mapping of the token fields, the fields mapping must be specified", secretType))
+	}
+
+	mappedFields := map[string]string{}
+	for _, f := range []struct {
+		name string
+		key  string
+	}{
+		{"token", fields.Token},
+		{"name", fields.Name},
+		{"serviceProviderUrl", fields.ServiceProviderUrl},
+		{"serviceProviderUserName", fields.ServiceProviderUserName},
+		{"serviceProviderUserId", fields.ServiceProviderUserId},
+		{"userId", fields.UserId},
+		{"expiredAfter", fields.ExpiredAfter},
+		{"scopes", fields.Scopes},
+	} {
+		if f.key == "" {
+			continue
+		}
+
+		if msgs := validation.IsConfigMapKey(f.key); len(msgs) > 0 {
+			errs = append(errs, fmt.Errorf("the key '%s' of the %s field is not a valid secret key: %s", f.key, f.name, strings.Join(msgs, ", ")))
+		}
+
+		if other, ok := mappedFields[f.key]; ok {
+			errs = append(errs, fmt.Errorf("the %s and %s fields are both mapped to the key '%s'", other, f.name, f.key))
+		}
+		mappedFields[f.key] = f.name
+
+		// a field can be repeated in the key the secret type puts it in, but nothing else should overwrite it
+		if typeField, ok := typeKeys[f.key]; ok && typeField != f.name {
+			errs = append(errs, fmt.Errorf("the %s field cannot be mapped to the key '%s' required by the secret type '%s'", f.name, f.key, secretType))
+		}
+	}
+
+	return errs
+}
+
+func containsSecretType(types []corev1.SecretType, secretType corev1.SecretType) bool {
+	for _, t := range types {
+		if t == secretType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serviceprovider
+
+import (
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type secretTypeRestrictingServiceProvider struct {
+	ServiceProvider
+}
+
+func (s secretTypeRestrictingServiceProvider) GetType() api.ServiceProviderType {
+	return api.ServiceProviderTypeQuay
+}
+
+func (s secretTypeRestrictingServiceProvider) SupportedSecretTypes() []corev1.SecretType {
+	return []corev1.SecretType{"", corev1.SecretTypeBasicAuth}
+}
+
+func TestValidateSecretSpec(t *testing.T) {
+	binding := func(secret api.SecretSpec, flavor api.CredentialFlavor) *api.SPIAccessTokenBinding {
+		return &api.SPIAccessTokenBinding{
+			Spec: api.SPIAccessTokenBindingSpec{
+				Secret:           secret,
+				CredentialFlavor: flavor,
+			},
+		}
+	}
+
+	restricted := secretTypeRestrictingServiceProvider{}
+	unrestricted := &rateLimitReportingServiceProvider{}
+
+	t.Run("supported secret type", func(t *testing.T) {
+		assert.Empty(t, ValidateSecretSpec(restricted, binding(api.SecretSpec{Type: corev1.SecretTypeBasicAuth}, "")))
+		assert.Empty(t, ValidateSecretSpec(restricted, binding(api.SecretSpec{}, "")))
+	})
+
+	t.Run("unsupported secret type", func(t *testing.T) {
+		errs := ValidateSecretSpec(restricted, binding(api.SecretSpec{Type: corev1.SecretTypeDockerConfigJson}, ""))
+		assert.Len(t, errs, 1)
+		assert.Equal(t, "the Quay service provider doesn't support secrets of type 'kubernetes.io/dockerconfigjson'", errs[0].Error())
+	})
+
+	t.Run("ssh-auth requires ssh key", func(t *testing.T) {
+		assert.Len(t, ValidateSecretSpec(unrestricted, binding(api.SecretSpec{Type: corev1.SecretTypeSSHAuth}, "")), 1)
+		assert.Empty(t, ValidateSecretSpec(unrestricted, binding(api.SecretSpec{Type: corev1.SecretTypeSSHAuth}, api.CredentialFlavorSSHKey)))
+	})
+
+	t.Run("sigstore secrets require signing credentials", func(t *testing.T) {
+		assert.Len(t, ValidateSecretSpec(unrestricted, binding(api.SecretSpec{Type: api.SecretTypeCosign}, api.CredentialFlavorAccessToken)), 1)
+		assert.Empty(t, ValidateSecretSpec(unrestricted, binding(api.SecretSpec{Type: api.SecretTypeCosign}, api.CredentialFlavorCosignKey)))
+		assert.Len(t, ValidateSecretSpec(unrestricted, binding(api.SecretSpec{Type: api.SecretTypeSigstoreOIDCToken}, "")), 1)
+		assert.Empty(t, ValidateSecretSpec(unrestricted, binding(api.SecretSpec{Type: api.SecretTypeSigstoreOIDCToken}, api.CredentialFlavorOIDCToken)))
+	})
+
+	t.Run("custom secret type requires mapping", func(t *testing.T) {
+		assert.Len(t, ValidateSecretSpec(unrestricted, binding(api.SecretSpec{Type: "acme.com/token"}, "")), 1)
+		assert.Empty(t, ValidateSecretSpec(unrestricted, binding(api.SecretSpec{Type: "acme.com/token", Fields: api.TokenFieldMapping{Token: "token"}}, "")))
+		assert.Empty(t, ValidateSecretSpec(unrestricted, binding(api.SecretSpec{Type: corev1.SecretTypeOpaque}, "")))
+		assert.Empty(t, ValidateSecretSpec(unrestricted, binding(api.SecretSpec{Type: api.SecretTypeNpmrc}, "")))
+		assert.Empty(t, ValidateSecretSpec(unrestricted, binding(api.SecretSpec{Type: api.SecretTypePip}, "")))
+		assert.Empty(t, ValidateSecretSpec(unrestricted, binding(api.SecretSpec{Type: api.SecretTypeMavenSettings, MavenServerId: "releases"}, "")))
+		assert.Empty(t, ValidateSecretSpec(unrestricted, binding(api.SecretSpec{Type: api.SecretTypeHelmRepository, HelmRepositoryName: "acme"}, "")))
+	})
+
+	t.Run("maven server id requires maven settings", func(t *testing.T) {
+		assert.Len(t, ValidateSecretSpec(unrestricted, binding(api.SecretSpec{Type: corev1.SecretTypeBasicAuth, MavenServerId: "releases"}, "")), 1)
+	})
+
+	t.Run("helm repository name requires helm repository", func(t *testing.T) {
+		assert.Len(t, ValidateSecretSpec(unrestricted, binding(api.SecretSpec{Type: api.SecretTypeMavenSettings, HelmRepositoryName: "acme"}, "")), 1)
+	})
+
+	t.Run("env keys", func(t *testing.T) {
+		assert.Empty(t, ValidateSecretSpec(restricted, binding(api.SecretSpec{EnvKeys: true, EnvPrefix: "QUAY_"}, "")))
+		assert.Empty(t, ValidateSecretSpec(restricted, binding(api.SecretSpec{EnvKeys: true, Fields: api.TokenFieldMapping{Token: "REGISTRY_TOKEN"}}, "")))
+
+		errs := ValidateSecretSpec(restricted, binding(api.SecretSpec{EnvPrefix: "QUAY_"}, ""))
+		assert.Len(t, errs, 1)
+		assert.Equal(t, "the env prefix can only be specified together with the env keys", errs[0].Error())
+
+		errs = ValidateSecretSpec(restricted, binding(api.SecretSpec{EnvKeys: true, Fields: api.TokenFieldMapping{Token: "REGISTRY_AUTH"}}, ""))
+		assert.Len(t, errs, 1)
+		assert.Equal(t, "the token field cannot be mapped to the key 'REGISTRY_AUTH' required by the secret type ''", errs[0].Error())
+
+		assert.NotEmpty(t, ValidateSecretSpec(restricted, binding(api.SecretSpec{EnvKeys: true, EnvPrefix: "1-"}, "")))
+	})
+
+	t.Run("linked service accounts", func(t *testing.T) {
+		all := &metav1.LabelSelector{}
+		assert.Empty(t, ValidateSecretSpec(unrestricted, binding(api.SecretSpec{Type: corev1.SecretTypeDockerConfigJson, LinkedServiceAccounts: all}, "")))
+		assert.Empty(t, ValidateSecretSpec(unrestricted, binding(api.SecretSpec{Type: corev1.SecretTypeDockercfg, LinkedServiceAccounts: all}, "")))
+
+		errs := ValidateSecretSpec(unrestricted, binding(api.SecretSpec{Type: corev1.SecretTypeBasicAuth, LinkedServiceAccounts: all}, ""))
+		assert.Len(t, errs, 1)
+		assert.Equal(t, "only the secrets of type 'kubernetes.io/dockerconfigjson' or 'kubernetes.io/dockercfg' can be linked to the service accounts", errs[0].Error())
+
+		assert.Len(t, ValidateSecretSpec(unrestricted, binding(api.SecretSpec{Type: corev1.SecretTypeDockerConfigJson, Delivery: api.SecretDeliveryPod, LinkedServiceAccounts: all}, "")), 1)
+		assert.Len(t, ValidateSecretSpec(unrestricted, binding(api.SecretSpec{Type: corev1.SecretTypeDockerConfigJson, LinkedServiceAccounts: &metav1.LabelSelector{
+			MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "app", Operator: "Sometimes"}},
+		}}, "")), 1)
+	})
+
+	t.Run("invalid mapping", func(t *testing.T) {
+		errs := ValidateSecretSpec(unrestricted, binding(api.SecretSpec{
+			Type: corev1.SecretTypeBasicAuth,
+			Fields: api.TokenFieldMapping{
+				Token:  "password",
+				Name:   "username",
+				UserId: "user id",
+				Scopes: "scopes",
+				// this collides with the scopes
+				ExpiredAfter: "scopes",
+			},
+		}, ""))
+		assert.Len(t, errs, 3)
+		assert.Equal(t, "the name field cannot be mapped to the key 'username' required by the secret type 'kubernetes.io/basic-auth'", errs[0].Error())
+		assert.Contains(t, errs[1].Error(), "the key 'user id' of the userId field is not a valid secret key")
+		assert.Equal(t, "the expiredAfter and scopes fields are both mapped to the key 'scopes'", errs[2].Error())
+	})
+}
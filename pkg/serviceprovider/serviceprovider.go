@@ -16,8 +16,13 @@ package serviceprovider
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
 
 	sperrors "github.com/redhat-appstudio/service-provider-integration-operator/pkg/errors"
 	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/httptransport"
@@ -25,7 +30,9 @@ import (
 	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
 	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
 	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/tokenstorage"
+	corev1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 // ServiceProvider abstracts the interaction with some service provider
@@ -64,6 +71,118 @@ type ServiceProvider interface {
 
 	// Validate checks that the provided object (token or binding) is valid in this service provider
 	Validate(ctx context.Context, validated Validated) (ValidationResult, error)
+
+	// ValidateCredentials checks that the token data (e.g. uploaded by the user) can be used with this service provider.
+	// This should be called before the token data is stored. The implementations can use
+	// the DefaultValidateCredentials function if they support both the OAuth tokens and the username and password
+	// credentials.
+	ValidateCredentials(ctx context.Context, tokenData *api.Token) error
+
+	// GetAccessibleResources returns the organizations and repositories that the provided token is known to be able
+	// to access. This must only use the metadata already cached in the token and must not contact the service
+	// provider.
+	GetAccessibleResources(ctx context.Context, token *api.SPIAccessToken) (AccessibleResources, error)
+}
+
+// EphemeralTokenMinter is implemented by the service providers that are able to mint short-lived tokens (e.g. GitHub
+// App installation tokens) for the bindings requesting them using SPIAccessTokenBindingSpec.Ephemeral.
+type EphemeralTokenMinter interface {
+	// MintEphemeralToken creates a short-lived token satisfying the requirements of the provided binding using
+	// the provided data of the linked long-lived token. The Expiry of the returned token must be set. If maxValidity
+	// is not 0 and the service provider lets the caller choose the expiry, the token must not be valid for longer.
+	MintEphemeralToken(ctx context.Context, binding *api.SPIAccessTokenBinding, tokenData *api.Token, maxValidity time.Duration) (*api.Token, error)
+}
+
+// GrantRevoker is implemented by the service providers that are able to revoke the OAuth authorization of the SPI
+// OAuth application given by the user during the OAuth flow. It is used to clean up the authorizations on the service
+// provider side when the tokens are deleted according to the configured GrantRevocationPolicy.
+type GrantRevoker interface {
+	// RevokeGrant revokes the authorization given to the SPI OAuth application that the provided token data was
+	// obtained from. Revoking an already revoked authorization is not an error.
+	RevokeGrant(ctx context.Context, tokenData *api.Token) error
+}
+
+// SecretTypeRestrictor is implemented by the service providers whose credentials can only be injected into some types
+// of the secrets. The service providers not implementing it support all the secret types.
+type SecretTypeRestrictor interface {
+	// SupportedSecretTypes returns the types of the secrets the credentials of the service provider can be injected
+	// into. The empty type stands for the default secret type of the cluster.
+	SupportedSecretTypes() []corev1.SecretType
+}
+
+// RateLimitReporter is implemented by the service providers that track the quota of the API requests made using
+// the tokens (see RateLimitTracker). The reconcilers use it to postpone the work with the service provider using
+// a token when its quota is nearly exhausted.
+type RateLimitReporter interface {
+	// CurrentRateLimit returns the last observed rate limit of the provided token data with the fewest remaining
+	// requests out of the rate limits of the APIs of the service provider. The boolean is false if no rate limit has
+	// been observed yet.
+	CurrentRateLimit(tokenData *api.Token) (RateLimit, bool)
+}
+
+// RepositoryLister is implemented by the service providers able to list all the repositories accessible using a token,
+// e.g. so that the UIs can offer them in a repository picker. Unlike GetAccessibleResources, this contacts the service
+// provider.
+type RepositoryLister interface {
+	// ListAccessibleRepositories returns the URLs of the repositories accessible using the provided token on the provided
+	// page (starting at 1) of the listing with at most perPage repositories.
+	ListAccessibleRepositories(ctx context.Context, token *api.SPIAccessToken, page int, perPage int) (RepositoryPage, error)
+}
+
+// RepositoryPage represents the results of the RepositoryLister.ListAccessibleRepositories method.
+type RepositoryPage struct {
+	// Repositories is the list of the URLs of the repositories on the page
+	Repositories []string
+	// HasNextPage is true if there are more repositories on the next page
+	HasNextPage bool
+}
+
+// WebhookManager is implemented by the service providers able to manage the webhooks in the repositories.
+type WebhookManager interface {
+	// EnsureWebhook makes sure the provided webhook exists in the repository and returns its ID. The webhook with
+	// the provided ID is updated if the ID is not empty and the webhook still exists, otherwise a new webhook is created.
+	EnsureWebhook(ctx context.Context, token *api.SPIAccessToken, repoUrl string, id string, webhook Webhook) (string, error)
+	// DeleteWebhook deletes the webhook with the provided ID from the repository. Deleting a webhook that no longer
+	// exists is not an error.
+	DeleteWebhook(ctx context.Context, token *api.SPIAccessToken, repoUrl string, id string) error
+	// CanManageWebhooks checks that the scopes granted to the token, as recorded in its metadata, allow managing
+	// the webhooks in the repositories.
+	CanManageWebhooks(token *api.SPIAccessToken) bool
+}
+
+// CredentialsInspector is implemented by the service providers able to describe the credentials that are not stored
+// in the token storage yet, e.g. to give the users feedback on the credentials before they are uploaded.
+type CredentialsInspector interface {
+	// InspectCredentials returns the metadata (the username, the user ID and the scopes) of the provided token data.
+	// The token data is expected to have been checked using ServiceProvider.ValidateCredentials. The returned error is recognized by errors.IsInvalidAccessToken if the service provider rejects the credentials.
+	InspectCredentials(ctx context.Context, tokenData *api.Token) (*api.TokenMetadata, error)
+}
+
+// ScopeChecker is implemented by the service providers able to tell whether the scopes granted to a token cover the
+// scopes required by its permissions, so that the token can be re-authenticated when its permissions grow.
+type ScopeChecker interface {
+	// MissingScopes returns the required scopes not implied by the scopes recorded in the token metadata. It returns
+	// nil if the granted scopes are not known, e.g. because the metadata has not been fetched yet.
+	MissingScopes(token *api.SPIAccessToken, required []string) []string
+}
+
+// Webhook is the configuration of a webhook managed using the WebhookManager.
+type Webhook struct {
+	// Url is the URL the events are delivered to
+	Url string
+	// Events is the list of the events triggering the webhook. The service provider chooses the default events if
+	// empty.
+	Events []string
+	// Secret is the secret used to sign the deliveries. The deliveries are not signed if empty.
+	Secret string
+}
+
+// AccessibleResources represents the results of the ServiceProvider.GetAccessibleResources method.
+type AccessibleResources struct {
+	// Organizations is the list of the names of the accessible organizations
+	Organizations []string
+	// Repositories is the list of the URLs of the accessible repositories
+	Repositories []string
 }
 
 // ValidationResult represents the results of the ServiceProvider.Validate method.
@@ -72,26 +191,43 @@ type ValidationResult struct {
 	ScopeValidation []error
 }
 
+// ErrUrlNotAllowed is returned by the Factory when the host of the URL is excluded by the
+// serviceProviderHostAllowList or serviceProviderHostDenyList of the configuration.
+var ErrUrlNotAllowed = errors.New("the host of the service provider URL is not allowed")
+
 // Factory is able to construct service providers from repository URLs.
 type Factory struct {
-	Configuration    config.Configuration
+	Configuration    *config.LiveConfiguration
 	KubernetesClient client.Client
-	HttpClient       *http.Client
-	Initializers     map[config.ServiceProviderType]Initializer
-	TokenStorage     tokenstorage.TokenStorage
+	// ConfigurationOverrides is used to read the secrets with the service provider configuration overrides (see
+	// ConfigurationOverridesCache). The KubernetesClient is used if it is nil.
+	ConfigurationOverrides client.Reader
+	HttpClient             *http.Client
+	Initializers           map[config.ServiceProviderType]Initializer
+	TokenStorage           tokenstorage.TokenStorage
+	// ScopeTranslations are the scope translations configured by the administrators. Only the builtin translations
+	// of the service providers are used if nil.
+	ScopeTranslations *ScopeTranslationTable
 }
 
 // FromRepoUrl returns the service provider instance able to talk to the repository on the provided URL.
 func (f *Factory) FromRepoUrl(repoUrl string) (ServiceProvider, error) {
 	// this method is ready for multiple instances of some service provider configured with different base urls.
 	// currently, we don't have any like that though :)
-	for _, spc := range f.Configuration.ServiceProviders {
+	cfg := f.Configuration.Get()
+
+	// check the URL before the probes get the chance to contact it
+	if err := checkUrlAllowed(&cfg, repoUrl); err != nil {
+		return nil, err
+	}
+
+	for _, spc := range cfg.ServiceProviders {
 		initializer, ok := f.Initializers[spc.ServiceProviderType]
 		if !ok {
 			continue
 		}
 
-		probe := initializer.Probe
+		probe := initializer.ProbeFor(spc.ServiceProviderBaseUrl)
 		ctor := initializer.Constructor
 		if probe == nil || ctor == nil {
 			continue
@@ -103,6 +239,11 @@ func (f *Factory) FromRepoUrl(repoUrl string) (ServiceProvider, error) {
 		}
 
 		if baseUrl != "" {
+			// the base URL might differ from the repository URL, e.g. when overridden in the namespace
+			if err := checkUrlAllowed(&cfg, baseUrl); err != nil {
+				return nil, err
+			}
+
 			sp, err := ctor.Construct(f, baseUrl)
 			if err != nil {
 				continue
@@ -112,9 +253,155 @@ func (f *Factory) FromRepoUrl(repoUrl string) (ServiceProvider, error) {
 		}
 	}
 
+	// the URL might still belong to a service provider we support but that has no OAuth application configured. Let's
+	// report that specifically, because only the administrator can fix it.
+	for spType, initializer := range f.Initializers {
+		if initializer.Probe == nil || isConfigured(cfg, spType) {
+			continue
+		}
+
+		baseUrl, err := initializer.Probe.Examine(f.HttpClient, repoUrl)
+		if err == nil && baseUrl != "" {
+			return nil, &sperrors.OAuthNotConfiguredError{
+				ServiceProviderType: string(spType),
+				ServiceProviderUrl:  baseUrl,
+			}
+		}
+	}
+
 	return nil, fmt.Errorf("could not determine service provider for url: %s", repoUrl)
 }
 
+// checkUrlAllowed returns ErrUrlNotAllowed if the configuration doesn't allow the host of the URL. The URLs without
+// the scheme, like "quay.io/org/repo", are assumed to be https URLs.
+func checkUrlAllowed(cfg *config.Configuration, rawUrl string) error {
+	if len(cfg.ServiceProviderHostAllowList) == 0 && len(cfg.ServiceProviderHostDenyList) == 0 {
+		return nil
+	}
+
+	if !strings.Contains(rawUrl, "://") {
+		rawUrl = "https://" + rawUrl
+	}
+
+	u, err := url.Parse(rawUrl)
+	if err != nil || u.Hostname() == "" {
+		return fmt.Errorf("%w: cannot determine the host of %s", ErrUrlNotAllowed, rawUrl)
+	}
+
+	if !cfg.ServiceProviderHostAllowed(u.Hostname()) {
+		return fmt.Errorf("%w: %s", ErrUrlNotAllowed, u.Hostname())
+	}
+
+	return nil
+}
+
+// TypeFromUrl returns the type of the service provider the URL belongs to or an empty string if it doesn't belong to
+// any known service provider. Unlike FromRepoUrl, the service provider is never contacted, so this is cheap enough to
+// be called for every event of the watched objects. The configured service providers are examined first and then
+// the probes of all the known service providers in the order of their types.
+func (f *Factory) TypeFromUrl(url string) config.ServiceProviderType {
+	for _, spc := range f.Configuration.Get().ServiceProviders {
+		initializer, ok := f.Initializers[spc.ServiceProviderType]
+		if !ok {
+			continue
+		}
+
+		if recognizes(initializer.ProbeFor(spc.ServiceProviderBaseUrl), url) {
+			return spc.ServiceProviderType
+		}
+	}
+
+	spTypes := make([]config.ServiceProviderType, 0, len(f.Initializers))
+	for spType := range f.Initializers {
+		spTypes = append(spTypes, spType)
+	}
+	sort.Slice(spTypes, func(i, j int) bool {
+		return spTypes[i] < spTypes[j]
+	})
+
+	for _, spType := range spTypes {
+		if recognizes(f.Initializers[spType].Probe, url) {
+			return spType
+		}
+	}
+
+	return ""
+}
+
+// OfflineTokenFilter returns the offline token filter of the service provider of given type (see
+// Initializer.OfflineTokenFilter) using the scope translations of this factory or nil if the service provider doesn't
+// have one.
+func (f *Factory) OfflineTokenFilter(spType config.ServiceProviderType) TokenFilter {
+	filter := f.Initializers[spType].OfflineTokenFilter
+	if translating, ok := filter.(ScopeTranslatingTokenFilter); ok {
+		return translating.WithScopeTranslations(f.ScopeTranslations)
+	}
+	return filter
+}
+
+// recognizes returns true if the probe recognizes the URL without contacting the service provider.
+func recognizes(probe Probe, url string) bool {
+	if probe == nil {
+		return false
+	}
+
+	baseUrl, err := probe.Examine(nil, url)
+	return err == nil && baseUrl != ""
+}
+
+// FromRepoUrlInNamespace is like FromRepoUrl but it also takes into account the service provider configuration
+// overrides defined in the provided namespace (see config.ServiceProviderConfigurationLabel). The invalid overrides
+// are ignored.
+func (f *Factory) FromRepoUrlInNamespace(ctx context.Context, repoUrl string, namespace string) (ServiceProvider, error) {
+	nsFactory, err := f.inNamespace(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	return nsFactory.FromRepoUrl(repoUrl)
+}
+
+// inNamespace returns a copy of this factory with the configuration overridden by the service provider
+// configurations defined in the provided namespace or this factory itself if there are no overrides.
+func (f *Factory) inNamespace(ctx context.Context, namespace string) (*Factory, error) {
+	var reader client.Reader = f.KubernetesClient
+	if f.ConfigurationOverrides != nil {
+		reader = f.ConfigurationOverrides
+	}
+
+	secrets := &corev1.SecretList{}
+	if err := reader.List(ctx, secrets, client.InNamespace(namespace), client.HasLabels{config.ServiceProviderConfigurationLabel}); err != nil {
+		return nil, fmt.Errorf("failed to list the service provider configuration overrides: %w", err)
+	}
+
+	if len(secrets.Items) == 0 {
+		return f, nil
+	}
+
+	overrides := make([]config.ServiceProviderConfiguration, 0, len(secrets.Items))
+	for i := range secrets.Items {
+		spc, err := config.ServiceProviderConfigurationFromSecret(&secrets.Items[i])
+		if err != nil {
+			log.FromContext(ctx).Error(err, "ignoring invalid service provider configuration override")
+			continue
+		}
+		overrides = append(overrides, spc)
+	}
+
+	nsFactory := *f
+	nsFactory.Configuration = config.NewLiveConfiguration(f.Configuration.Get().WithServiceProviderOverrides(overrides))
+	return &nsFactory, nil
+}
+
+func isConfigured(cfg config.Configuration, spType config.ServiceProviderType) bool {
+	for _, spc := range cfg.ServiceProviders {
+		if spc.ServiceProviderType == spType {
+			return true
+		}
+	}
+	return false
+}
+
 func AuthenticatingHttpClient(cl *http.Client) *http.Client {
 	transport := cl.Transport
 	if transport == nil {
@@ -147,6 +434,25 @@ type Matchable interface {
 var _ Matchable = (*api.SPIAccessCheck)(nil)
 var _ Matchable = (*api.SPIAccessTokenBinding)(nil)
 
+// DefaultValidateCredentials checks that the token data contains all the data required for the type of the token.
+func DefaultValidateCredentials(tokenData *api.Token) error {
+	if tokenData.IsBasicAuth() {
+		if tokenData.Username == "" {
+			return fmt.Errorf("username is required for the credentials of type '%s'", api.BasicAuthTokenType)
+		}
+		if tokenData.AccessToken == "" {
+			return fmt.Errorf("password is required for the credentials of type '%s'", api.BasicAuthTokenType)
+		}
+		return nil
+	}
+
+	if tokenData.AccessToken == "" {
+		return fmt.Errorf("access token is required")
+	}
+
+	return nil
+}
+
 func DefaultMapToken(tokenObject *api.SPIAccessToken, tokenData *api.Token) (AccessTokenMapper, error) {
 	var userId, userName string
 	var scopes []string
@@ -157,6 +463,12 @@ func DefaultMapToken(tokenObject *api.SPIAccessToken, tokenData *api.Token) (Acc
 		scopes = tokenObject.Status.TokenMetadata.Scopes
 	}
 
+	// the username of the credentials is what needs to be used together with the password, regardless of what
+	// the service provider reports about the user.
+	if tokenData.IsBasicAuth() && tokenData.Username != "" {
+		userName = tokenData.Username
+	}
+
 	return AccessTokenMapper{
 		Name:                    tokenObject.Name,
 		Token:                   tokenData.AccessToken,
@@ -166,5 +478,8 @@ func DefaultMapToken(tokenObject *api.SPIAccessToken, tokenData *api.Token) (Acc
 		UserId:                  "",
 		ExpiredAfter:            &tokenData.Expiry,
 		Scopes:                  scopes,
+		CosignPassword:          tokenData.Credentials[api.CredentialFlavorCosignPassword],
+		CosignPublicKey:         tokenData.Credentials[api.CredentialFlavorCosignPublicKey],
+		BasicAuth:               tokenData.IsBasicAuth(),
 	}, nil
 }
@@ -15,11 +15,20 @@
 package serviceprovider
 
 import (
+	"context"
+	"net/http"
+	"strings"
 	"testing"
 
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	sperrors "github.com/redhat-appstudio/service-provider-integration-operator/pkg/errors"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -63,6 +72,7 @@ func TestDefaultMapToken(t *testing.T) {
 		assert.Empty(t, m.ServiceProviderUserName)
 		assert.Empty(t, m.ServiceProviderUserId)
 		assert.Empty(t, m.UserId)
+		assert.False(t, m.BasicAuth)
 		assert.NotNil(t, m.ExpiredAfter)
 		assert.Equal(t, uint64(0), *m.ExpiredAfter)
 	})
@@ -99,4 +109,307 @@ func TestDefaultMapToken(t *testing.T) {
 		assert.NotNil(t, m.ExpiredAfter)
 		assert.Equal(t, uint64(15), *m.ExpiredAfter)
 	})
+	t.Run("basic auth", func(t *testing.T) {
+		m, err := DefaultMapToken(&api.SPIAccessToken{
+			Status: api.SPIAccessTokenStatus{
+				TokenMetadata: &api.TokenMetadata{
+					Username: "username",
+				},
+			},
+		}, &api.Token{
+			Username:    "robot",
+			AccessToken: "password",
+			TokenType:   api.BasicAuthTokenType,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "password", m.Token)
+		assert.Equal(t, "robot", m.ServiceProviderUserName)
+		assert.True(t, m.BasicAuth)
+	})
+	t.Run("cosign key", func(t *testing.T) {
+		m, err := DefaultMapToken(&api.SPIAccessToken{}, &api.Token{
+			AccessToken: "key",
+			Credentials: map[api.CredentialFlavor]string{
+				api.CredentialFlavorCosignPassword:  "pass",
+				api.CredentialFlavorCosignPublicKey: "pub",
+			},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "pass", m.CosignPassword)
+		assert.Equal(t, "pub", m.CosignPublicKey)
+	})
+}
+
+func TestDefaultValidateCredentials(t *testing.T) {
+	assert.NoError(t, DefaultValidateCredentials(&api.Token{AccessToken: "token"}))
+	assert.Error(t, DefaultValidateCredentials(&api.Token{}))
+	assert.NoError(t, DefaultValidateCredentials(&api.Token{Username: "user", AccessToken: "password", TokenType: api.BasicAuthTokenType}))
+	assert.Error(t, DefaultValidateCredentials(&api.Token{AccessToken: "password", TokenType: api.BasicAuthTokenType}))
+	assert.Error(t, DefaultValidateCredentials(&api.Token{Username: "user", TokenType: api.BasicAuthTokenType}))
+}
+
+func TestFactory_FromRepoUrl(t *testing.T) {
+	initializers := map[config.ServiceProviderType]Initializer{
+		"Acme": {
+			Probe: ProbeFunc(func(_ *http.Client, url string) (string, error) {
+				if strings.HasPrefix(url, "https://acme.com") {
+					return "https://acme.com", nil
+				}
+				return "", nil
+			}),
+			Constructor: ConstructorFunc(func(_ *Factory, _ string) (ServiceProvider, error) {
+				return nil, nil
+			}),
+		},
+	}
+
+	t.Run("oauth not configured", func(t *testing.T) {
+		f := Factory{
+			Configuration: config.NewLiveConfiguration(config.Configuration{}),
+			Initializers:  initializers,
+		}
+
+		_, err := f.FromRepoUrl("https://acme.com/org/repo")
+		assert.Error(t, err)
+		assert.True(t, sperrors.IsOAuthNotConfigured(err))
+	})
+
+	t.Run("unknown service provider", func(t *testing.T) {
+		f := Factory{
+			Configuration: config.NewLiveConfiguration(config.Configuration{}),
+			Initializers:  initializers,
+		}
+
+		_, err := f.FromRepoUrl("https://unknown.com/org/repo")
+		assert.Error(t, err)
+		assert.False(t, sperrors.IsOAuthNotConfigured(err))
+	})
+
+	t.Run("configured", func(t *testing.T) {
+		f := Factory{
+			Configuration: config.NewLiveConfiguration(config.Configuration{
+				ServiceProviders: []config.ServiceProviderConfiguration{
+					{ServiceProviderType: "Acme"},
+				},
+			}),
+			Initializers: initializers,
+		}
+
+		_, err := f.FromRepoUrl("https://acme.com/org/repo")
+		assert.NoError(t, err)
+	})
+
+	t.Run("configured base url only", func(t *testing.T) {
+		var constructedWith string
+		f := Factory{
+			Configuration: config.NewLiveConfiguration(config.Configuration{
+				ServiceProviders: []config.ServiceProviderConfiguration{
+					{ServiceProviderType: "Cluster", ServiceProviderBaseUrl: "https://api.cluster:6443/"},
+				},
+			}),
+			Initializers: map[config.ServiceProviderType]Initializer{
+				"Cluster": {
+					ConfiguredBaseUrlOnly: true,
+					Constructor: ConstructorFunc(func(_ *Factory, baseUrl string) (ServiceProvider, error) {
+						constructedWith = baseUrl
+						return nil, nil
+					}),
+				},
+			},
+		}
+
+		_, err := f.FromRepoUrl("https://api.cluster:6443/namespaces/default")
+		assert.NoError(t, err)
+		assert.Equal(t, "https://api.cluster:6443", constructedWith)
+
+		_, err = f.FromRepoUrl("https://api.cluster:64430")
+		assert.Error(t, err)
+		assert.False(t, sperrors.IsOAuthNotConfigured(err))
+
+		constructedWith = ""
+		_, err = f.FromRepoUrl("oci://api.cluster:6443/charts/chart")
+		assert.NoError(t, err)
+		assert.Equal(t, "https://api.cluster:6443", constructedWith)
+	})
+
+	t.Run("denied host", func(t *testing.T) {
+		f := Factory{
+			Configuration: config.NewLiveConfiguration(config.Configuration{
+				ServiceProviders: []config.ServiceProviderConfiguration{
+					{ServiceProviderType: "Acme"},
+				},
+				ServiceProviderHostDenyList: []string{"acme.com"},
+			}),
+			Initializers: initializers,
+		}
+
+		_, err := f.FromRepoUrl("https://acme.com/org/repo")
+		assert.ErrorIs(t, err, ErrUrlNotAllowed)
+	})
+
+	t.Run("host not in allow list", func(t *testing.T) {
+		f := Factory{
+			Configuration: config.NewLiveConfiguration(config.Configuration{
+				ServiceProviders: []config.ServiceProviderConfiguration{
+					{ServiceProviderType: "Acme"},
+				},
+				ServiceProviderHostAllowList: []string{"github.com"},
+			}),
+			Initializers: initializers,
+		}
+
+		_, err := f.FromRepoUrl("https://acme.com/org/repo")
+		assert.ErrorIs(t, err, ErrUrlNotAllowed)
+
+		_, err = f.FromRepoUrl("acme.com/org/repo")
+		assert.ErrorIs(t, err, ErrUrlNotAllowed)
+	})
+
+	t.Run("base url not allowed", func(t *testing.T) {
+		f := Factory{
+			Configuration: config.NewLiveConfiguration(config.Configuration{
+				ServiceProviders: []config.ServiceProviderConfiguration{
+					{ServiceProviderType: "Acme"},
+				},
+				ServiceProviderHostAllowList: []string{"*.acme.com"},
+			}),
+			Initializers: map[config.ServiceProviderType]Initializer{
+				"Acme": {
+					Probe: ProbeFunc(func(_ *http.Client, _ string) (string, error) {
+						return "https://internal.svc", nil
+					}),
+					Constructor: initializers["Acme"].Constructor,
+				},
+			},
+		}
+
+		_, err := f.FromRepoUrl("https://git.acme.com/org/repo")
+		assert.ErrorIs(t, err, ErrUrlNotAllowed)
+	})
+}
+
+func TestFactory_TypeFromUrl(t *testing.T) {
+	f := Factory{
+		Configuration: config.NewLiveConfiguration(config.Configuration{
+			ServiceProviders: []config.ServiceProviderConfiguration{
+				{ServiceProviderType: "Cluster", ServiceProviderBaseUrl: "https://api.cluster:6443"},
+			},
+		}),
+		Initializers: map[config.ServiceProviderType]Initializer{
+			"Acme": {
+				Probe: ProbeFunc(func(_ *http.Client, url string) (string, error) {
+					if strings.HasPrefix(url, "https://acme.com") {
+						return "https://acme.com", nil
+					}
+					return "", nil
+				}),
+			},
+			"Cluster": {
+				ConfiguredBaseUrlOnly: true,
+			},
+		},
+	}
+
+	assert.Equal(t, config.ServiceProviderType("Acme"), f.TypeFromUrl("https://acme.com/org/repo"))
+	assert.Equal(t, config.ServiceProviderType("Cluster"), f.TypeFromUrl("https://api.cluster:6443/namespaces/default"))
+	assert.Equal(t, config.ServiceProviderType(""), f.TypeFromUrl("https://unknown.com/org/repo"))
+}
+
+// translatingTokenFilter matches the tokens if it has the scope translations.
+type translatingTokenFilter struct {
+	table *ScopeTranslationTable
+}
+
+func (f *translatingTokenFilter) Matches(context.Context, Matchable, *api.SPIAccessToken) (bool, error) {
+	return f.table != nil, nil
+}
+
+func (f *translatingTokenFilter) WithScopeTranslations(table *ScopeTranslationTable) TokenFilter {
+	return &translatingTokenFilter{table: table}
+}
+
+func TestFactory_OfflineTokenFilter(t *testing.T) {
+	plain := TokenFilterFunc(func(context.Context, Matchable, *api.SPIAccessToken) (bool, error) {
+		return true, nil
+	})
+	factory := &Factory{
+		Initializers: map[config.ServiceProviderType]Initializer{
+			config.ServiceProviderTypeGitHub: {OfflineTokenFilter: &translatingTokenFilter{}},
+			config.ServiceProviderTypeQuay:   {OfflineTokenFilter: plain},
+			config.ServiceProviderTypeNexus:  {},
+		},
+		ScopeTranslations: &ScopeTranslationTable{},
+	}
+
+	matches, err := factory.OfflineTokenFilter(config.ServiceProviderTypeGitHub).Matches(context.TODO(), nil, nil)
+	assert.NoError(t, err)
+	assert.True(t, matches)
+
+	assert.NotNil(t, factory.OfflineTokenFilter(config.ServiceProviderTypeQuay))
+	assert.Nil(t, factory.OfflineTokenFilter(config.ServiceProviderTypeNexus))
+	assert.Nil(t, factory.OfflineTokenFilter(config.ServiceProviderTypeKubernetes))
+}
+
+func TestFactory_FromRepoUrlInNamespace(t *testing.T) {
+	var constructedWith config.Configuration
+	initializers := map[config.ServiceProviderType]Initializer{
+		config.ServiceProviderTypeGitHub: {
+			Probe: ProbeFunc(func(_ *http.Client, url string) (string, error) {
+				if strings.HasPrefix(url, "https://github.com") {
+					return "https://github.com", nil
+				}
+				return "", nil
+			}),
+			Constructor: ConstructorFunc(func(f *Factory, _ string) (ServiceProvider, error) {
+				constructedWith = f.Configuration.Get()
+				return nil, nil
+			}),
+		},
+	}
+
+	override := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "github-config",
+			Namespace: "team",
+			Labels:    map[string]string{config.ServiceProviderConfigurationLabel: "true"},
+		},
+		Data: map[string][]byte{
+			"type":         []byte("GitHub"),
+			"clientId":     []byte("team-id"),
+			"clientSecret": []byte("team-secret"),
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	utilruntime.Must(corev1.AddToScheme(scheme))
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(override).Build()
+
+	f := Factory{
+		Configuration:    config.NewLiveConfiguration(config.Configuration{}),
+		KubernetesClient: cl,
+		Initializers:     initializers,
+	}
+
+	t.Run("uses namespace override", func(t *testing.T) {
+		_, err := f.FromRepoUrlInNamespace(context.TODO(), "https://github.com/org/repo", "team")
+		assert.NoError(t, err)
+		assert.Len(t, constructedWith.ServiceProviders, 1)
+		assert.Equal(t, "team-id", constructedWith.ServiceProviders[0].ClientId)
+	})
+
+	t.Run("reads overrides using the provided reader", func(t *testing.T) {
+		cf := f
+		cf.KubernetesClient = fake.NewClientBuilder().WithScheme(scheme).Build()
+		cf.ConfigurationOverrides = cl
+
+		_, err := cf.FromRepoUrlInNamespace(context.TODO(), "https://github.com/org/repo", "team")
+		assert.NoError(t, err)
+		assert.Equal(t, "team-id", constructedWith.ServiceProviders[0].ClientId)
+	})
+
+	t.Run("no override in other namespaces", func(t *testing.T) {
+		_, err := f.FromRepoUrlInNamespace(context.TODO(), "https://github.com/org/repo", "default")
+		assert.Error(t, err)
+		assert.True(t, sperrors.IsOAuthNotConfigured(err))
+	})
 }
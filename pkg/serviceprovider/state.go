@@ -0,0 +1,133 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serviceprovider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrStateVersionNotSupported is returned when the service provider state cannot be migrated to the current version,
+// e.g. because it was stored by a newer version of the operator.
+var ErrStateVersionNotSupported = errors.New("unsupported version of the service provider state")
+
+// StateMigration migrates the serialized service provider state from one version to the next one.
+type StateMigration func(state []byte) ([]byte, error)
+
+// StateSchema describes the versions of the service provider state stored in the ServiceProviderState of the token
+// metadata. The state is stored in a versioned envelope and migrated to the current version when it is read, so that
+// the tokens don't break when the service provider changes the form of its state.
+type StateSchema struct {
+	// Version is the current version of the state. The state stored without the envelope, i.e. before the versioning
+	// was introduced, has the version 1.
+	Version int
+	// Migrations maps the versions to the functions migrating the state from that version to the next one.
+	Migrations map[int]StateMigration
+}
+
+type stateEnvelope struct {
+	Version int             `json:"version"`
+	State   json.RawMessage `json:"state"`
+}
+
+// Marshal serializes the state in the current version, wrapped in the versioned envelope.
+func (s StateSchema) Marshal(state interface{}) ([]byte, error) {
+	js, err := json.Marshal(state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize the service provider state: %w", err)
+	}
+
+	return json.Marshal(stateEnvelope{Version: s.Version, State: js})
+}
+
+// Unmarshal deserializes the data into the state, migrating it to the current version first if needed.
+func (s StateSchema) Unmarshal(data []byte, state interface{}) error {
+	current, _, err := s.migrate(data)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(current, state); err != nil {
+		return fmt.Errorf("failed to deserialize the service provider state: %w", err)
+	}
+	return nil
+}
+
+// Migrate returns the data migrated to the current version and wrapped in the versioned envelope. The returned bool
+// is false if the data already is in the current version and doesn't need to be persisted again.
+func (s StateSchema) Migrate(data []byte) ([]byte, bool, error) {
+	current, version, err := s.migrate(data)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if version == s.Version && isEnveloped(data) {
+		return data, false, nil
+	}
+
+	migrated, err := json.Marshal(stateEnvelope{Version: s.Version, State: current})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to serialize the service provider state: %w", err)
+	}
+	return migrated, true, nil
+}
+
+// migrate returns the state in the current version together with the version in which it was stored.
+func (s StateSchema) migrate(data []byte) (json.RawMessage, int, error) {
+	state, version := unwrapState(data)
+	if version > s.Version {
+		return nil, version, fmt.Errorf("%w: the state has the version %d but only versions up to %d are supported", ErrStateVersionNotSupported, version, s.Version)
+	}
+
+	for v := version; v < s.Version; v++ {
+		migration, ok := s.Migrations[v]
+		if !ok {
+			return nil, version, fmt.Errorf("%w: no migration from the version %d", ErrStateVersionNotSupported, v)
+		}
+
+		migrated, err := migration(state)
+		if err != nil {
+			return nil, version, fmt.Errorf("failed to migrate the service provider state from the version %d: %w", v, err)
+		}
+		state = migrated
+	}
+
+	return state, version, nil
+}
+
+// unwrapState returns the state from the versioned envelope and its version. The data that is not in the envelope is
+// returned as is with the version 1.
+func unwrapState(data []byte) (json.RawMessage, int) {
+	if !isEnveloped(data) {
+		return data, 1
+	}
+
+	envelope := stateEnvelope{}
+	_ = json.Unmarshal(data, &envelope)
+	return envelope.State, envelope.Version
+}
+
+func isEnveloped(data []byte) bool {
+	envelope := struct {
+		Version *int            `json:"version"`
+		State   json.RawMessage `json:"state"`
+	}{}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return false
+	}
+
+	return envelope.Version != nil && envelope.State != nil
+}
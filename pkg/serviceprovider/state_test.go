@@ -0,0 +1,90 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serviceprovider
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testState struct {
+	Names []string `json:"names"`
+}
+
+// testSchema is at version 2, which stores the list of names instead of the single name of the version 1.
+var testSchema = StateSchema{
+	Version: 2,
+	Migrations: map[int]StateMigration{
+		1: func(state []byte) ([]byte, error) {
+			v1 := struct {
+				Name string `json:"name"`
+			}{}
+			if err := json.Unmarshal(state, &v1); err != nil {
+				return nil, err
+			}
+			return json.Marshal(testState{Names: []string{v1.Name}})
+		},
+	},
+}
+
+func TestStateSchema_MarshalUnmarshal(t *testing.T) {
+	data, err := testSchema.Marshal(testState{Names: []string{"a", "b"}})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"version":2,"state":{"names":["a","b"]}}`, string(data))
+
+	state := testState{}
+	assert.NoError(t, testSchema.Unmarshal(data, &state))
+	assert.Equal(t, []string{"a", "b"}, state.Names)
+}
+
+func TestStateSchema_Unmarshal(t *testing.T) {
+	t.Run("migrates the legacy state", func(t *testing.T) {
+		state := testState{}
+		assert.NoError(t, testSchema.Unmarshal([]byte(`{"name":"a"}`), &state))
+		assert.Equal(t, []string{"a"}, state.Names)
+	})
+
+	t.Run("migrates the enveloped state", func(t *testing.T) {
+		state := testState{}
+		assert.NoError(t, testSchema.Unmarshal([]byte(`{"version":1,"state":{"name":"a"}}`), &state))
+		assert.Equal(t, []string{"a"}, state.Names)
+	})
+
+	t.Run("fails on newer versions", func(t *testing.T) {
+		err := testSchema.Unmarshal([]byte(`{"version":3,"state":{}}`), &testState{})
+		assert.True(t, errors.Is(err, ErrStateVersionNotSupported))
+	})
+
+	t.Run("fails on missing migrations", func(t *testing.T) {
+		schema := StateSchema{Version: 3, Migrations: testSchema.Migrations}
+		err := schema.Unmarshal([]byte(`{"name":"a"}`), &testState{})
+		assert.True(t, errors.Is(err, ErrStateVersionNotSupported))
+	})
+}
+
+func TestStateSchema_Migrate(t *testing.T) {
+	migrated, changed, err := testSchema.Migrate([]byte(`{"name":"a"}`))
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.JSONEq(t, `{"version":2,"state":{"names":["a"]}}`, string(migrated))
+
+	again, changed, err := testSchema.Migrate(migrated)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, migrated, again)
+}
@@ -25,6 +25,14 @@ type TokenFilter interface {
 	Matches(ctx context.Context, matchable Matchable, token *api.SPIAccessToken) (bool, error)
 }
 
+// ScopeTranslatingTokenFilter is implemented by the token filters that translate the permissions to the scopes and
+// therefore need the scope translations configured by the administrators.
+type ScopeTranslatingTokenFilter interface {
+	TokenFilter
+	// WithScopeTranslations returns the token filter using the provided scope translations.
+	WithScopeTranslations(table *ScopeTranslationTable) TokenFilter
+}
+
 // TokenFilterFunc converts a function into the implementation of the TokenFilter interface
 type TokenFilterFunc func(ctx context.Context, matchable Matchable, token *api.SPIAccessToken) (bool, error)
 
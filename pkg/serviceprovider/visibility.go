@@ -0,0 +1,93 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serviceprovider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// RepositoryVisibility is the visibility of a repository as seen by an anonymous user.
+type RepositoryVisibility string
+
+const (
+	// RepositoryVisibilityPublic means the repository can be accessed without any credentials.
+	RepositoryVisibilityPublic RepositoryVisibility = "public"
+	// RepositoryVisibilityPrivate means the repository exists but requires credentials.
+	RepositoryVisibilityPrivate RepositoryVisibility = "private"
+	// RepositoryVisibilityNotFound means the repository doesn't exist.
+	RepositoryVisibilityNotFound RepositoryVisibility = "notFound"
+	// RepositoryVisibilityPrivateOrNotFound means the service provider doesn't tell the private repositories from
+	// the missing ones to the anonymous users, like GitHub.
+	RepositoryVisibilityPrivateOrNotFound RepositoryVisibility = "privateOrNotFound"
+	// RepositoryVisibilityUnknown means the service provider responded in an unexpected way.
+	RepositoryVisibilityUnknown RepositoryVisibility = "unknown"
+)
+
+// ProbeVisibility requests the URL without any credentials and classifies the repository based on the status code of
+// the response: 200 is public, 401 and 403 are private and 404 is not found. The service providers hiding the private
+// repositories behind 404 need to refine the not found result themselves.
+func ProbeVisibility(ctx context.Context, cl rest.HTTPClient, method string, url string) (RepositoryVisibility, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return RepositoryVisibilityUnknown, fmt.Errorf("failed to prepare the request: %w", err)
+	}
+
+	resp, err := cl.Do(req)
+	if err != nil {
+		return RepositoryVisibilityUnknown, fmt.Errorf("failed to request %s: %w", url, err)
+	}
+	if resp.Body != nil {
+		_ = resp.Body.Close()
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return RepositoryVisibilityPublic, nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return RepositoryVisibilityPrivate, nil
+	case http.StatusNotFound:
+		return RepositoryVisibilityNotFound, nil
+	default:
+		log.FromContext(ctx).Info("unexpected status code of the anonymous request for the repository", "url", url, "code", resp.StatusCode)
+		return RepositoryVisibilityUnknown, nil
+	}
+}
+
+// ApplyVisibility fills in the access check status of the repository with the provided visibility for which no token
+// was found. The private repositories get the api.SPIAccessCheckErrorAuthenticationRequired error reason, so that
+// the users can tell them from the missing repositories, which get api.SPIAccessCheckErrorRepoNotFound.
+func ApplyVisibility(status *api.SPIAccessCheckStatus, visibility RepositoryVisibility) {
+	switch visibility {
+	case RepositoryVisibilityPublic:
+		status.Accessible = true
+		status.Accessibility = api.SPIAccessCheckAccessibilityPublic
+	case RepositoryVisibilityPrivate:
+		status.Accessibility = api.SPIAccessCheckAccessibilityPrivate
+		status.ErrorReason = api.SPIAccessCheckErrorAuthenticationRequired
+		status.ErrorMessage = "the repository is private, authenticate to access it"
+	case RepositoryVisibilityPrivateOrNotFound:
+		status.ErrorReason = api.SPIAccessCheckErrorAuthenticationRequired
+		status.ErrorMessage = "the repository does not exist or is private, authenticate to access it if it exists"
+	case RepositoryVisibilityNotFound:
+		status.ErrorReason = api.SPIAccessCheckErrorRepoNotFound
+		status.ErrorMessage = "the repository does not exist"
+	}
+}
@@ -16,7 +16,10 @@ package serviceproviders
 
 import (
 	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider/echo"
 	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider/github"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider/kubernetes"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider/nexus"
 	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider/quay"
 	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
 )
@@ -28,7 +31,10 @@ import (
 // the implementation packages.
 func KnownInitializers() map[config.ServiceProviderType]serviceprovider.Initializer {
 	return map[config.ServiceProviderType]serviceprovider.Initializer{
-		config.ServiceProviderTypeGitHub: github.Initializer,
-		config.ServiceProviderTypeQuay:   quay.Initializer,
+		config.ServiceProviderTypeGitHub:     github.Initializer,
+		config.ServiceProviderTypeQuay:       quay.Initializer,
+		config.ServiceProviderTypeKubernetes: kubernetes.Initializer,
+		config.ServiceProviderTypeNexus:      nexus.Initializer,
+		config.ServiceProviderTypeEcho:       echo.Initializer,
 	}
 }
@@ -14,20 +14,111 @@
 package config
 
 import (
+	"fmt"
 	"io"
 	"io/ioutil"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
+	"golang.org/x/net/http/httpguts"
 	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/util/errors"
 )
 
 type ServiceProviderType string
 
+// TokenStorageType is the type of the storage backend the token data is persisted in.
+type TokenStorageType string
+
+const (
+	// TokenStorageTypeVault stores the token data in Vault.
+	TokenStorageTypeVault TokenStorageType = "vault"
+	// TokenStorageTypeSecrets stores the token data in Kubernetes secrets in the namespaces of the tokens.
+	TokenStorageTypeSecrets TokenStorageType = "secrets"
+)
+
+// GrantRevocationPolicy specifies when the operator revokes the authorizations given to the SPI OAuth applications
+// on the service provider side.
+type GrantRevocationPolicy string
+
 const (
-	ServiceProviderTypeGitHub ServiceProviderType = "GitHub"
-	ServiceProviderTypeQuay   ServiceProviderType = "Quay"
-	DefaultVaultHost          string              = "http://spi-vault:8200"
+	// GrantRevocationPolicyNever never revokes the authorizations.
+	GrantRevocationPolicyNever GrantRevocationPolicy = "never"
+	// GrantRevocationPolicyOnNamespaceDeletion revokes the authorizations of the tokens that are deleted together with
+	// their namespace.
+	GrantRevocationPolicyOnNamespaceDeletion GrantRevocationPolicy = "onNamespaceDeletion"
+	// GrantRevocationPolicyAlways revokes the authorizations of all the deleted tokens.
+	GrantRevocationPolicyAlways GrantRevocationPolicy = "always"
+)
+
+// InUseTokenDeletionPolicy specifies how the token deletion webhook treats the deletion of the tokens that still have
+// linked bindings.
+type InUseTokenDeletionPolicy string
+
+const (
+	// InUseTokenDeletionPolicyWarn allows the deletion and warns about the linked bindings.
+	InUseTokenDeletionPolicyWarn InUseTokenDeletionPolicy = "warn"
+	// InUseTokenDeletionPolicyDeny rejects the deletion until the linked bindings are deleted.
+	InUseTokenDeletionPolicyDeny InUseTokenDeletionPolicy = "deny"
+	// DefaultInUseTokenDeletionPolicy is used if the policy is not configured.
+	DefaultInUseTokenDeletionPolicy = InUseTokenDeletionPolicyWarn
+)
+
+const (
+	// ManagedSecretLabel marks the secrets created by SPI, i.e. the secrets of the bindings and the secrets of
+	// the secrets token storage. The operator only caches the secrets with this label.
+	ManagedSecretLabel = "spi.appstudio.redhat.com/managed"
+	// ManagedSecretLabelValue is the value of the ManagedSecretLabel.
+	ManagedSecretLabelValue = "true"
+)
+
+const (
+	ServiceProviderTypeGitHub     ServiceProviderType = "GitHub"
+	ServiceProviderTypeQuay       ServiceProviderType = "Quay"
+	ServiceProviderTypeKubernetes ServiceProviderType = "Kubernetes"
+	ServiceProviderTypeNexus      ServiceProviderType = "Nexus"
+	ServiceProviderTypeEcho       ServiceProviderType = "Echo"
+	DefaultVaultHost              string              = "http://spi-vault:8200"
+	DefaultTokenStorageCacheSize                      = 1000
+	DefaultTokenStorage                               = TokenStorageTypeVault
+	DefaultTokenDataHistorySize                       = 3
+	DefaultTokenPhaseHistorySize                      = 10
+	DefaultTokenLookupConcurrency                     = 10
+	DefaultGrantRevocationPolicy                      = GrantRevocationPolicyNever
+	DefaultRateLimitThreshold                         = 100
+	// MinFIPSSharedSecretLength is the minimum length of the shared secret in the FIPS mode. HMAC keys need to have
+	// at least 112 bits of security strength according to NIST SP 800-131A.
+	MinFIPSSharedSecretLength = 14
+	// DefaultProviderResponseSizeLimit is the default maximum size of the responses of the service providers (10 MiB).
+	DefaultProviderResponseSizeLimit = 10 << 20
+	// DefaultNamespaceCleanupConcurrency is the default number of the SPI objects of a deleted namespace finalized
+	// concurrently.
+	DefaultNamespaceCleanupConcurrency = 20
+	// DefaultVaultTokenMount is the default mount path of the Vault KV secrets engine the token data is stored in.
+	DefaultVaultTokenMount = "spi"
+	// DefaultVaultKVVersion is the default version of the Vault KV secrets engine the token data is stored in.
+	DefaultVaultKVVersion = 2
+	// DefaultVaultTokenPathTemplate is the default path of the token data within the Vault KV secrets engine.
+	DefaultVaultTokenPathTemplate = VaultPathNamespacePlaceholder + "/" + VaultPathNamePlaceholder
+	// VaultPathNamespacePlaceholder is replaced by the namespace of the token in the VaultTokenPathTemplate.
+	VaultPathNamespacePlaceholder = "{namespace}"
+	// VaultPathNamePlaceholder is replaced by the name of the token in the VaultTokenPathTemplate.
+	VaultPathNamePlaceholder = "{name}"
+	// DefaultOAuthStateVaultTransitMount is the default mount path of the Vault transit secrets engine with the key
+	// signing the OAuth states.
+	DefaultOAuthStateVaultTransitMount = "transit"
+	// DefaultServiceProviderStateSizeLimit is the default maximum size of the service provider state kept in the status
+	// of the tokens (64 KiB).
+	DefaultServiceProviderStateSizeLimit = 64 << 10
+)
+
+const (
+	// DefaultExternalSecretVaultRolePrefix is the default prefix of the Vault roles of the SecretStores.
+	DefaultExternalSecretVaultRolePrefix = "spi-bindings-"
+	// DefaultExternalSecretServiceAccount is the default service account the SecretStores authenticate to Vault as.
+	DefaultExternalSecretServiceAccount = "default"
 )
 
 // PersistedConfiguration is the on-disk format of the configuration that references other files for shared secret
@@ -44,6 +135,26 @@ type PersistedConfiguration struct {
 	// SharedSecret is secret value used for signing the JWT keys.
 	SharedSecret string `yaml:"sharedSecret"`
 
+	// PreviousSharedSecrets are the shared secrets used before the SharedSecret was rotated. The OAuth states signed
+	// with them are still accepted so that the OAuth flows started before the rotation can finish. They can be removed
+	// once no such flows are expected anymore.
+	PreviousSharedSecrets []string `yaml:"previousSharedSecrets,omitempty"`
+
+	// OAuthStateVaultTransitKey is the name of the key in the Vault transit secrets engine used to sign the OAuth
+	// states instead of the SharedSecret, so that the signing key never leaves Vault. The states signed with
+	// the SharedSecret and the PreviousSharedSecrets are still accepted. The OAuth service needs to be configured with
+	// the same key.
+	OAuthStateVaultTransitKey string `yaml:"oauthStateVaultTransitKey,omitempty"`
+
+	// OAuthStateVaultTransitMount is the mount path of the Vault transit secrets engine with the
+	// OAuthStateVaultTransitKey. The default is "transit".
+	OAuthStateVaultTransitMount string `yaml:"oauthStateVaultTransitMount,omitempty"`
+
+	// OAuthStateClockSkewTolerance is how far in the future the OAuth states can be issued and still be accepted, so
+	// that the OAuth flows don't break when the clocks of the operator and of the OAuth service drift apart. This
+	// string expresses the duration as string accepted by the time.ParseDuration function. The default is 30s.
+	OAuthStateClockSkewTolerance string `yaml:"oauthStateClockSkewTolerance,omitempty"`
+
 	// BaseUrl is the URL on which the OAuth service is deployed.
 	BaseUrl string `yaml:"baseUrl"`
 
@@ -56,10 +167,232 @@ type PersistedConfiguration struct {
 	// kubernetes deployments.
 	VaultHost string `yaml:"vaultHost"`
 
+	// VaultTokenMount is the mount path of the Vault KV secrets engine the token data is stored in. The default is
+	// "spi".
+	VaultTokenMount string `yaml:"vaultTokenMount,omitempty"`
+
+	// VaultKVVersion is the version of the Vault KV secrets engine mounted at VaultTokenMount, 1 or 2. The default is 2.
+	VaultKVVersion int `yaml:"vaultKvVersion,omitempty"`
+
+	// VaultTokenPathTemplate is the path of the data of a token within VaultTokenMount. "{namespace}" and "{name}" are
+	// replaced with the namespace and the name of the token, so that e.g. "teams/{namespace}/spi/{name}" puts the data
+	// under a per-namespace prefix. Both placeholders are required. The default is "{namespace}/{name}".
+	VaultTokenPathTemplate string `yaml:"vaultTokenPathTemplate,omitempty"`
+
 	// AccessCheckTtl is the time after that SPIAccessCheck CR will be deleted by operator. This string expresses the
 	// duration as string accepted by the time.ParseDuration function (e.g. "5m", "1h30m", "5s", etc.). The default
 	// is 30m (30 minutes).
 	AccessCheckTtl string `yaml:"accessCheckTtl"`
+
+	// AccessCheckCacheTtl is the time for which the results of the SPIAccessChecks of the public repositories are
+	// shared with the other SPIAccessChecks of the same repository and ref in the whole cluster. This string expresses
+	// the duration as string accepted by the time.ParseDuration function (e.g. "5m", "1h30m", "5s", etc.). The default
+	// is 5m (5 minutes). "0s" disables the caching.
+	AccessCheckCacheTtl string `yaml:"accessCheckCacheTtl"`
+
+	// TokenStorageCacheTtl is the time for which the token data read from the token storage are kept in memory by the
+	// operator. This string expresses the duration as string accepted by the time.ParseDuration function (e.g. "5m",
+	// "1h30m", "5s", etc.). The default is 1m (1 minute). Setting it to "0s" disables the caching.
+	TokenStorageCacheTtl string `yaml:"tokenStorageCacheTtl"`
+
+	// StatusUpdateCoalescingInterval is the interval within which the successive status updates of a SPIAccessToken or
+	// a SPIAccessTokenBinding are coalesced into a single write of the latest status. This string expresses
+	// the duration as string accepted by the time.ParseDuration function (e.g. "5m", "1h30m", "5s", etc.). The default
+	// is 0s, which disables the coalescing. Clusters with tens of thousands of tokens should set it to a few seconds to
+	// reduce the load on the cluster.
+	StatusUpdateCoalescingInterval string `yaml:"statusUpdateCoalescingInterval,omitempty"`
+
+	// TokenStorageCacheSize is the maximum number of tokens the operator keeps in memory. The least recently used
+	// tokens are evicted from the cache first. The default is 1000.
+	TokenStorageCacheSize int `yaml:"tokenStorageCacheSize"`
+
+	// TokenStorage is the type of the storage backend of the token data. One of "vault" or "secrets". The default is
+	// "vault".
+	TokenStorage TokenStorageType `yaml:"tokenStorage"`
+
+	// TokenStorageMigrationSource is the type of the storage backend the token data is being migrated from. If set,
+	// the token data not found in the TokenStorage is looked up in this storage and written forward to
+	// the TokenStorage. Leave empty when not migrating.
+	TokenStorageMigrationSource TokenStorageType `yaml:"tokenStorageMigrationSource,omitempty"`
+
+	// TokenDataHistorySize is the number of the previous versions of the token data kept in the token storage so that
+	// the tokens can be rolled back to them. The default is 3. Setting it to -1 disables keeping the previous versions.
+	TokenDataHistorySize int `yaml:"tokenDataHistorySize,omitempty"`
+
+	// TokenPhaseHistorySize is the number of the most recent phase transitions of the SPIAccessTokens recorded in
+	// their status. The default is 10.
+	TokenPhaseHistorySize int `yaml:"tokenPhaseHistorySize,omitempty"`
+
+	// ServiceProviderStateSizeLimit is the maximum size in bytes of the service provider state kept in the status of
+	// the SPIAccessTokens. The larger states are moved to secrets so that the tokens don't exceed the size limit of
+	// the objects in the cluster. The default is 65536. Setting it to -1 keeps all the states in the status.
+	ServiceProviderStateSizeLimit int `yaml:"serviceProviderStateSizeLimit,omitempty"`
+
+	// TokenLookupConcurrency is the maximum number of the candidate tokens checked concurrently when looking up
+	// the token of a binding. The default is 10.
+	TokenLookupConcurrency int `yaml:"tokenLookupConcurrency,omitempty"`
+
+	// NamespaceCleanupConcurrency is the maximum number of the SPI objects of a namespace being deleted that are
+	// finalized concurrently. The default is 20.
+	NamespaceCleanupConcurrency int `yaml:"namespaceCleanupConcurrency,omitempty"`
+
+	// GrantRevocationPolicy specifies when the authorizations given to the SPI OAuth applications are revoked on
+	// the service provider side once the tokens are deleted. One of "never", "onNamespaceDeletion" or "always".
+	// The default is "never". Only the access tokens of the deleted tokens are revoked.
+	GrantRevocationPolicy GrantRevocationPolicy `yaml:"grantRevocationPolicy,omitempty"`
+
+	// TokenDataRetention is the time for which the data of the deleted tokens is kept in the token storage so that
+	// it can be recovered, e.g. after an accidental deletion of the token. This string expresses the duration as string
+	// accepted by the time.ParseDuration function (e.g. "5m", "1h30m", "5s", etc.). The default is 0s, which deletes
+	// the data together with the tokens.
+	TokenDataRetention string `yaml:"tokenDataRetention,omitempty"`
+
+	// RelinkBindings specifies whether the tokens created by the operator for the bindings are deleted once
+	// the bindings waiting for their data are relinked to other matching tokens and no binding is linked to them
+	// anymore. The relinking itself always happens. The default is true.
+	RelinkBindings *bool `yaml:"relinkBindings,omitempty"`
+
+	// RateLimitThreshold is the number of the remaining API requests of an OAuth application below which
+	// the reconciliation of the objects using the application is postponed until the rate limit resets. The default is
+	// 100. Setting it to -1 disables the throttling.
+	RateLimitThreshold int `yaml:"rateLimitThreshold,omitempty"`
+
+	// RateLimitStatusConfigMap is the "namespace/name" of the config map the operator periodically writes
+	// the observed rate limits of the OAuth applications to. Leave empty to only expose the rate limits as metrics.
+	RateLimitStatusConfigMap string `yaml:"rateLimitStatusConfigMap,omitempty"`
+
+	// EgressReportConfigMap is the "namespace/name" of the config map the operator periodically writes the network
+	// endpoints it needs to reach to, so that the egress of the operator can be restricted in hardened clusters. Leave
+	// empty to not write the report.
+	EgressReportConfigMap string `yaml:"egressReportConfigMap,omitempty"`
+
+	// ConfigurationStatusConfigMap is the "namespace/name" of the config map the operator writes the result of
+	// the validation of the configuration to. Leave empty to only expose the result as a metric.
+	ConfigurationStatusConfigMap string `yaml:"configurationStatusConfigMap,omitempty"`
+
+	// ScopeTranslationConfigMap is the "namespace/name" of the config map with the translations of the permissions
+	// to the scopes of the service providers that override the builtin ones. The keys of the config map are
+	// the service provider types and the values are the YAML lists of the translations. Leave empty to only use
+	// the builtin translations.
+	ScopeTranslationConfigMap string `yaml:"scopeTranslationConfigMap,omitempty"`
+
+	// FIPSMode restricts the cryptography used by the operator to the FIPS-approved algorithms and rejects
+	// the configuration that cannot be used with them. It is always enabled in the binaries built with
+	// GOEXPERIMENT=boringcrypto.
+	FIPSMode bool `yaml:"fipsMode,omitempty"`
+
+	// BindingWriteBackVaultMount is the mount path of the KV version 2 secrets engine in the Vault at VaultHost that
+	// the bindings can write their data back to. The data of each binding is written under the namespace of
+	// the binding. Leave empty to disable the write-back.
+	BindingWriteBackVaultMount string `yaml:"bindingWriteBackVaultMount,omitempty"`
+
+	// ExternalSecretStore is the name of the namespaced SecretStore of the External Secrets Operator the operator
+	// creates in the namespaces of the bindings to read from the BindingWriteBackVaultMount. The bindings can only
+	// deliver their secrets using ExternalSecrets if it is set.
+	ExternalSecretStore string `yaml:"externalSecretStore,omitempty"`
+
+	// ExternalSecretVaultRolePrefix is the prefix of the Vault Kubernetes auth roles the SecretStores authenticate
+	// with. The role of the SecretStore in a namespace is the prefix followed by the name of the namespace and is
+	// expected to only allow reading the data written back by the bindings in that namespace. Defaults to
+	// "spi-bindings-".
+	ExternalSecretVaultRolePrefix string `yaml:"externalSecretVaultRolePrefix,omitempty"`
+
+	// ExternalSecretServiceAccount is the name of the service account in the namespaces of the bindings
+	// the SecretStores authenticate to Vault as. Defaults to "default".
+	ExternalSecretServiceAccount string `yaml:"externalSecretServiceAccount,omitempty"`
+
+	// BindingPolicyWebhookUrl is the URL of the webhook consulted before a binding is allowed to use the data of its
+	// linked token. The webhook receives the binding, the token and the namespace of the binding and decides whether
+	// the binding may use the token. Leave empty to allow all the bindings to use their matching tokens.
+	BindingPolicyWebhookUrl string `yaml:"bindingPolicyWebhookUrl,omitempty"`
+
+	// SelfTestServiceProviderUrl is the URL of the echo service provider the SPISelfTests upload their test
+	// credentials for unless they specify their own. It must be the baseUrl of a service provider of type Echo.
+	SelfTestServiceProviderUrl string `yaml:"selfTestServiceProviderUrl,omitempty"`
+
+	// TokenOwnershipAdminUsers are the names of the users allowed to change the owners of the tokens and to create
+	// the bindings using the tokens of any owner. The service account of the OAuth service recording the owners must be
+	// one of them.
+	TokenOwnershipAdminUsers []string `yaml:"tokenOwnershipAdminUsers,omitempty"`
+
+	// TokenOwnershipAdminGroups are the groups the members of which are the token ownership admins.
+	TokenOwnershipAdminGroups []string `yaml:"tokenOwnershipAdminGroups,omitempty"`
+
+	// NotificationWebhookUrls are the URLs of the webhooks (e.g. the Slack incoming webhooks) that are notified when
+	// a token becomes invalid or its data is about to expire. Only the tokens in the namespaces declaring their
+	// contact in the spi.appstudio.redhat.com/notification-contact annotation are notified about.
+	NotificationWebhookUrls []string `yaml:"notificationWebhookUrls,omitempty"`
+
+	// TokenExpiryNotificationPeriod is how long before the expiry of the token data the owners of the token are
+	// notified about it. This string expresses the duration as string accepted by the time.ParseDuration function.
+	// The default is 168h (7 days), 0s disables the expiry notifications.
+	TokenExpiryNotificationPeriod string `yaml:"tokenExpiryNotificationPeriod,omitempty"`
+
+	// InUseTokenDeletionPolicy specifies whether the token deletion webhook only warns about the deletion of the tokens
+	// with linked bindings ("warn", the default) or rejects it ("deny").
+	InUseTokenDeletionPolicy InUseTokenDeletionPolicy `yaml:"inUseTokenDeletionPolicy,omitempty"`
+
+	// ScopeDriftCheckInterval is how often the metadata of the Ready tokens, including their scopes, is refreshed from
+	// the service providers so that the scopes reduced by the users directly in the service providers are noticed.
+	// This string expresses the duration as string accepted by the time.ParseDuration function. The default is 24h,
+	// 0s disables the periodic checks (the metadata is then only refreshed when the token is reconciled after
+	// tokenLookupCacheTtl).
+	ScopeDriftCheckInterval string `yaml:"scopeDriftCheckInterval,omitempty"`
+
+	// ClusterId identifies the cluster in the default providerUserAgent, so that the service providers can attribute
+	// the requests to the particular installation of the operator.
+	ClusterId string `yaml:"clusterId,omitempty"`
+
+	// ProviderUserAgent is the User-Agent of the requests to the service providers. The default is
+	// "service-provider-integration-operator/<version>" followed by " (cluster <clusterId>)" if clusterId is set.
+	ProviderUserAgent string `yaml:"providerUserAgent,omitempty"`
+
+	// ProviderRequestTagHeader is the name of the header the requests to the service providers are tagged with. It
+	// contains the kind, namespace and name of the object the request is made for, e.g. "SPIAccessToken ns/name".
+	// The requests are not tagged if empty. Only set this if the service providers accept the header.
+	ProviderRequestTagHeader string `yaml:"providerRequestTagHeader,omitempty"`
+
+	// ProviderResponseSizeLimit is the maximum size of the body of the responses of the service providers in bytes.
+	// The reading of larger responses fails. The default is 10 MiB.
+	ProviderResponseSizeLimit int `yaml:"providerResponseSizeLimit,omitempty"`
+
+	// OAuthBrokerUrl is the base URL of the Keycloak (or RHSSO) server brokering the OAuth flows of the service
+	// providers with brokerIdentityProvider set, e.g. "https://sso.example.com" (including the "/auth" path for
+	// the older versions of Keycloak). Leave empty to use the OAuth applications of the service providers directly.
+	OAuthBrokerUrl string `yaml:"oauthBrokerUrl,omitempty"`
+
+	// OAuthBrokerRealm is the Keycloak realm with the identity providers of the service providers.
+	OAuthBrokerRealm string `yaml:"oauthBrokerRealm,omitempty"`
+
+	// OAuthBrokerClientId is the client ID of the confidential Keycloak client the operator uses to exchange the tokens
+	// of the users for the tokens of the service providers. The client must be permitted to impersonate the users and
+	// to exchange the tokens of the identity providers.
+	OAuthBrokerClientId string `yaml:"oauthBrokerClientId,omitempty"`
+
+	// OAuthBrokerClientSecret is the client secret of the OAuthBrokerClientId client.
+	OAuthBrokerClientSecret string `yaml:"oauthBrokerClientSecret,omitempty"`
+
+	// CredentialsLookupUsers are the names of the users, usually the service accounts of the trusted services (e.g.
+	// "system:serviceaccount:build-service:build-service-controller"), allowed to use the credentials lookup API to
+	// obtain the credentials in any namespace.
+	CredentialsLookupUsers []string `yaml:"credentialsLookupUsers,omitempty"`
+
+	// CredentialsLookupTtl is how long the secrets created by the credentials lookup API exist before they are deleted.
+	// This string expresses the duration as string accepted by the time.ParseDuration function. The default is 15m.
+	CredentialsLookupTtl string `yaml:"credentialsLookupTtl,omitempty"`
+
+	// DebugUsers are the names of the users allowed to use the debugging endpoints of the operator, like the OAuth
+	// state inspection.
+	DebugUsers []string `yaml:"debugUsers,omitempty"`
+
+	// ServiceProviderHostAllowList are the hosts of the service providers the tokens and bindings can point to, e.g.
+	// "github.com" or "*.acme.com" for all the subdomains of acme.com. All the hosts are allowed if empty.
+	ServiceProviderHostAllowList []string `yaml:"serviceProviderHostAllowList,omitempty"`
+
+	// ServiceProviderHostDenyList are the hosts of the service providers the tokens and bindings cannot point to, in
+	// the same format as ServiceProviderHostAllowList. It takes precedence over the allow list, so that e.g.
+	// the internal hosts can be excluded from an allowed domain.
+	ServiceProviderHostDenyList []string `yaml:"serviceProviderHostDenyList,omitempty"`
 }
 
 // Configuration contains the specification of the known service providers as well as other configuration data shared
@@ -79,12 +412,37 @@ type Configuration struct {
 	// SharedSecret is the secret value used for signing the JWT keys used as OAuth state.
 	SharedSecret []byte
 
+	// PreviousSharedSecrets are the shared secrets the OAuth states could have been signed with before the rotation of
+	// the SharedSecret.
+	PreviousSharedSecrets [][]byte
+
+	// OAuthStateVaultTransitKey is the name of the key in the Vault transit secrets engine used to sign the OAuth
+	// states instead of the SharedSecret. Empty if the states are signed with the SharedSecret.
+	OAuthStateVaultTransitKey string
+
+	// OAuthStateVaultTransitMount is the mount path of the Vault transit secrets engine with the
+	// OAuthStateVaultTransitKey.
+	OAuthStateVaultTransitMount string
+
+	// OAuthStateClockSkewTolerance is how far in the future the OAuth states can be issued and still be accepted.
+	OAuthStateClockSkewTolerance time.Duration
+
 	// TokenLookupCacheTtl is the time for which the lookup cache results are considered valid
 	TokenLookupCacheTtl time.Duration
 
 	// VaultHost url to vault storage.
 	VaultHost string
 
+	// VaultTokenMount is the mount path of the Vault KV secrets engine the token data is stored in.
+	VaultTokenMount string
+
+	// VaultKVVersion is the version of the Vault KV secrets engine mounted at VaultTokenMount.
+	VaultKVVersion int
+
+	// VaultTokenPathTemplate is the path of the data of a token within VaultTokenMount with the placeholders of
+	// the namespace and the name of the token.
+	VaultTokenPathTemplate string
+
 	// ServiceAccountTokenFilePath file with service account token. It is used for Vault kubernetes auth.
 	// No need to set when running in pod, but can be useful when running outside, like local dev.
 	// It is set with `SA_TOKEN_PATH` environment variable.
@@ -92,6 +450,167 @@ type Configuration struct {
 
 	// AccessCheckTtl is time after that SPIAccessCheck CR will be deleted.
 	AccessCheckTtl time.Duration
+
+	// AccessCheckCacheTtl is the time for which the results of the SPIAccessChecks of the public repositories are
+	// reused by the other SPIAccessChecks.
+	AccessCheckCacheTtl time.Duration
+
+	// TokenStorageCacheTtl is the time for which the token data are cached in memory after being read from the token
+	// storage.
+	TokenStorageCacheTtl time.Duration
+
+	// StatusUpdateCoalescingInterval is the interval within which the successive status updates of a token or a binding
+	// are coalesced. 0 means no coalescing.
+	StatusUpdateCoalescingInterval time.Duration
+
+	// TokenStorageCacheSize is the maximum number of tokens cached in memory.
+	TokenStorageCacheSize int
+
+	// TokenStorage is the type of the storage backend of the token data.
+	TokenStorage TokenStorageType
+
+	// TokenStorageMigrationSource is the type of the storage backend the token data is being migrated from. Empty if
+	// no migration is in progress.
+	TokenStorageMigrationSource TokenStorageType
+
+	// TokenDataHistorySize is the number of the previous versions of the token data kept in the token storage. 0 means
+	// no previous versions are kept.
+	TokenDataHistorySize int
+
+	// TokenPhaseHistorySize is the number of the most recent phase transitions of the SPIAccessTokens recorded in
+	// their status.
+	TokenPhaseHistorySize int
+
+	// ServiceProviderStateSizeLimit is the maximum size in bytes of the service provider state kept in the status of
+	// the SPIAccessTokens. 0 means the states are never moved out of the status.
+	ServiceProviderStateSizeLimit int
+
+	// TokenLookupConcurrency is the maximum number of the candidate tokens checked concurrently when looking up
+	// the token of a binding.
+	TokenLookupConcurrency int
+
+	// NamespaceCleanupConcurrency is the maximum number of the SPI objects of a namespace being deleted that are
+	// finalized concurrently.
+	NamespaceCleanupConcurrency int
+
+	// GrantRevocationPolicy specifies when the authorizations given to the SPI OAuth applications are revoked.
+	GrantRevocationPolicy GrantRevocationPolicy
+
+	// TokenDataRetention is the time for which the data of the deleted tokens is kept recoverable. 0 means the data is
+	// deleted together with the tokens.
+	TokenDataRetention time.Duration
+
+	// RelinkBindings specifies whether the generated tokens abandoned by the relinked bindings are deleted.
+	RelinkBindings bool
+
+	// RateLimitThreshold is the number of the remaining API requests of an OAuth application below which
+	// the reconciliation is postponed until the rate limit resets. 0 means no throttling.
+	RateLimitThreshold int
+
+	// RateLimitStatusConfigMap is the "namespace/name" of the config map with the observed rate limits or empty if
+	// the config map should not be written.
+	RateLimitStatusConfigMap string
+
+	// EgressReportConfigMap is the "namespace/name" of the config map with the network endpoints the operator needs
+	// or empty if the config map should not be written.
+	EgressReportConfigMap string
+
+	// ConfigurationStatusConfigMap is the "namespace/name" of the config map with the result of the validation of
+	// the configuration or empty if the config map should not be written.
+	ConfigurationStatusConfigMap string
+
+	// ScopeTranslationConfigMap is the "namespace/name" of the config map with the scope translations overriding
+	// the builtin ones or empty if only the builtin translations should be used.
+	ScopeTranslationConfigMap string
+
+	// FIPSMode specifies whether the operator is restricted to the FIPS-approved cryptography.
+	FIPSMode bool
+
+	// BindingWriteBackVaultMount is the mount path of the Vault KV secrets engine the bindings write their data back
+	// to or empty if the write-back is disabled.
+	BindingWriteBackVaultMount string
+
+	// ExternalSecretStore is the name of the SecretStore the ExternalSecrets created for the bindings use or
+	// empty if the bindings cannot deliver their secrets using ExternalSecrets.
+	ExternalSecretStore string
+
+	// ExternalSecretVaultRolePrefix is the prefix of the per-namespace Vault roles the SecretStores authenticate with.
+	ExternalSecretVaultRolePrefix string
+
+	// ExternalSecretServiceAccount is the service account the SecretStores authenticate to Vault as.
+	ExternalSecretServiceAccount string
+
+	// BindingPolicyWebhookUrl is the URL of the webhook deciding whether the bindings may use their tokens or empty if
+	// there is no such policy.
+	BindingPolicyWebhookUrl string
+
+	// SelfTestServiceProviderUrl is the URL of the echo service provider used by the SPISelfTests that don't specify
+	// their own or empty if there is none.
+	SelfTestServiceProviderUrl string
+
+	// TokenOwnershipAdminUsers are the users allowed to change the owners of the tokens and to use the tokens of any
+	// owner in their bindings.
+	TokenOwnershipAdminUsers []string
+
+	// TokenOwnershipAdminGroups are the groups of the users allowed to change the owners of the tokens and to use
+	// the tokens of any owner in their bindings.
+	TokenOwnershipAdminGroups []string
+
+	// NotificationWebhookUrls are the URLs of the webhooks notified about the invalid and expiring tokens.
+	NotificationWebhookUrls []string
+
+	// TokenExpiryNotificationPeriod is how long before the expiry of the token data the owners are notified. 0 means
+	// no expiry notifications.
+	TokenExpiryNotificationPeriod time.Duration
+
+	// InUseTokenDeletionPolicy specifies how the deletion of the tokens with linked bindings is treated.
+	InUseTokenDeletionPolicy InUseTokenDeletionPolicy
+
+	// ScopeDriftCheckInterval is how often the metadata of the Ready tokens is refreshed from the service providers.
+	// 0 means no periodic refreshes.
+	ScopeDriftCheckInterval time.Duration
+
+	// ClusterId identifies the cluster in the default ProviderUserAgent.
+	ClusterId string
+
+	// ProviderUserAgent is the User-Agent of the requests to the service providers. Empty means the default one.
+	ProviderUserAgent string
+
+	// ProviderRequestTagHeader is the name of the header the requests to the service providers are tagged with. Empty
+	// means no tagging.
+	ProviderRequestTagHeader string
+
+	// ProviderResponseSizeLimit is the maximum size of the body of the responses of the service providers in bytes.
+	ProviderResponseSizeLimit int
+
+	// OAuthBrokerUrl is the base URL of the Keycloak server brokering the OAuth flows or empty if the OAuth flows are
+	// not brokered.
+	OAuthBrokerUrl string
+
+	// OAuthBrokerRealm is the Keycloak realm with the identity providers of the service providers.
+	OAuthBrokerRealm string
+
+	// OAuthBrokerClientId is the client ID of the Keycloak client exchanging the tokens.
+	OAuthBrokerClientId string
+
+	// OAuthBrokerClientSecret is the client secret of the Keycloak client exchanging the tokens.
+	OAuthBrokerClientSecret string
+
+	// CredentialsLookupUsers are the users allowed to use the credentials lookup API.
+	CredentialsLookupUsers []string
+
+	// CredentialsLookupTtl is how long the secrets created by the credentials lookup API exist.
+	CredentialsLookupTtl time.Duration
+
+	// DebugUsers are the users allowed to use the debugging endpoints of the operator.
+	DebugUsers []string
+
+	// ServiceProviderHostAllowList are the hosts of the service providers the tokens and bindings can point to. Empty
+	// means all the hosts.
+	ServiceProviderHostAllowList []string
+
+	// ServiceProviderHostDenyList are the hosts of the service providers the tokens and bindings cannot point to.
+	ServiceProviderHostDenyList []string
 }
 
 // ServiceProviderConfiguration contains configuration for a single service provider configured with the SPI. This
@@ -103,7 +622,8 @@ type ServiceProviderConfiguration struct {
 	// ClientSecret is the client secret of the OAuth application that the SPI uses to access the service provider.
 	ClientSecret string `yaml:"clientSecret"`
 
-	// ServiceProviderType is the type of the service provider. This must be one of the supported values: GitHub, Quay
+	// ServiceProviderType is the type of the service provider. This must be one of the supported values: GitHub, Quay,
+	// Kubernetes
 	ServiceProviderType ServiceProviderType `yaml:"type"`
 
 	// ServiceProviderBaseUrl is the base URL of the service provider. This can be omitted for certain service provider
@@ -113,6 +633,139 @@ type ServiceProviderConfiguration struct {
 	// Extra is the extra configuration required for some service providers to be able to uniquely identify them. E.g.
 	// for Quay, we require to know the organization for which the OAuth application is defined for.
 	Extra map[string]string `yaml:"extra,omitempty"`
+
+	// MaxTokenValidity is the maximum time the tokens of the service provider may stay valid for (e.g. "2160h").
+	// The tokens that don't expire or expire later get the ValidityWarning condition and the ephemeral tokens minted
+	// with a longer validity are rejected. 0 means no limit. The service provider configuration overrides in
+	// the namespaces cannot set it.
+	MaxTokenValidity time.Duration `yaml:"maxTokenValidity,omitempty"`
+
+	// BrokerIdentityProvider is the alias of the identity provider in the oauthBrokerRealm of the Keycloak the OAuth
+	// flows of the service provider are brokered through. The tokens of the service provider are then obtained from
+	// Keycloak instead of the OAuth service, and the clientId and clientSecret are not needed for GitHub and Quay.
+	// The service provider configuration overrides in the namespaces cannot set it.
+	BrokerIdentityProvider string `yaml:"brokerIdentityProvider,omitempty"`
+
+	// MaintenanceWindows are the planned downtimes of the service provider. During a maintenance window, the metadata
+	// of the tokens is not refreshed and the credentials are not validated with the service provider, so that
+	// the tokens keep their phase instead of being flipped to Invalid or Error. The service provider configuration
+	// overrides in the namespaces cannot set it.
+	MaintenanceWindows []MaintenanceWindow `yaml:"maintenanceWindows,omitempty"`
+}
+
+// MaintenanceWindow is a planned downtime of a service provider.
+type MaintenanceWindow struct {
+	// Start is the time the maintenance starts, e.g. 2023-06-10T20:00:00Z.
+	Start time.Time `yaml:"start"`
+	// End is the time the maintenance ends.
+	End time.Time `yaml:"end"`
+}
+
+// serviceProviderConfiguration returns the configuration of the service provider of the provided type and base URL or
+// nil if there is none. The configuration without a base URL applies to the service providers of its type that don't
+// have a configuration with their base URL.
+func (c Configuration) serviceProviderConfiguration(spType ServiceProviderType, baseUrl string) *ServiceProviderConfiguration {
+	baseUrl = strings.TrimSuffix(baseUrl, "/")
+	var fallback *ServiceProviderConfiguration
+	for i := range c.ServiceProviders {
+		spc := &c.ServiceProviders[i]
+		if spc.ServiceProviderType != spType {
+			continue
+		}
+		spcBaseUrl := strings.TrimSuffix(spc.ServiceProviderBaseUrl, "/")
+		if spcBaseUrl == baseUrl {
+			return spc
+		}
+		if spcBaseUrl == "" {
+			fallback = spc
+		}
+	}
+	return fallback
+}
+
+// MaxTokenValidity returns the maximum token validity configured for the service provider of the provided type and
+// base URL or 0 if there is no limit. The configuration without a base URL applies to the service providers of its
+// type that don't have a configuration with their base URL.
+func (c Configuration) MaxTokenValidity(spType ServiceProviderType, baseUrl string) time.Duration {
+	if spc := c.serviceProviderConfiguration(spType, baseUrl); spc != nil {
+		return spc.MaxTokenValidity
+	}
+	return 0
+}
+
+// BrokerIdentityProvider returns the alias of the Keycloak identity provider the OAuth flows of the service provider of
+// the provided type and base URL are brokered through or an empty string if they are not brokered. The configuration
+// without a base URL applies to the service providers of its type that don't have a configuration with their base URL.
+func (c Configuration) BrokerIdentityProvider(spType ServiceProviderType, baseUrl string) string {
+	if c.OAuthBrokerUrl == "" {
+		return ""
+	}
+	if spc := c.serviceProviderConfiguration(spType, baseUrl); spc != nil {
+		return spc.BrokerIdentityProvider
+	}
+	return ""
+}
+
+// ActiveMaintenanceWindow returns the maintenance window of the service provider of the provided type and base URL
+// that is in progress at the provided time or nil if the service provider is not under maintenance. If several
+// windows overlap, the one ending last is returned. The configuration without a base URL applies to the service
+// providers of its type that don't have a configuration with their base URL.
+func (c Configuration) ActiveMaintenanceWindow(spType ServiceProviderType, baseUrl string, now time.Time) *MaintenanceWindow {
+	spc := c.serviceProviderConfiguration(spType, baseUrl)
+	if spc == nil {
+		return nil
+	}
+
+	var active *MaintenanceWindow
+	for i := range spc.MaintenanceWindows {
+		w := &spc.MaintenanceWindows[i]
+		if now.Before(w.Start) || !now.Before(w.End) {
+			continue
+		}
+		if active == nil || w.End.After(active.End) {
+			active = w
+		}
+	}
+	return active
+}
+
+// ServiceProviderHostAllowed checks whether the tokens and bindings can point to the service provider on the provided
+// host according to the ServiceProviderHostAllowList and ServiceProviderHostDenyList.
+func (c Configuration) ServiceProviderHostAllowed(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	for _, pattern := range c.ServiceProviderHostDenyList {
+		if hostMatches(pattern, host) {
+			return false
+		}
+	}
+
+	if len(c.ServiceProviderHostAllowList) == 0 {
+		return true
+	}
+
+	for _, pattern := range c.ServiceProviderHostAllowList {
+		if hostMatches(pattern, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostMatches checks whether the host matches the pattern, which is either the host itself or "*." followed by
+// the domain the host is a subdomain of.
+func hostMatches(pattern string, host string) bool {
+	pattern = strings.ToLower(pattern)
+	if domain := strings.TrimPrefix(pattern, "*"); domain != pattern {
+		return strings.HasSuffix(host, domain) && len(host) > len(domain)
+	}
+	return host == pattern
+}
+
+// isHostPattern checks that the value is a host or a wildcard pattern accepted by hostMatches.
+func isHostPattern(value string) bool {
+	host := strings.TrimPrefix(value, "*.")
+	return host != "" && !strings.ContainsAny(host, "*/:@ ")
 }
 
 // inflate loads the files specified in the persisted configuration and returns a fully initialized configuration
@@ -126,6 +779,28 @@ func (c PersistedConfiguration) inflate() (Configuration, error) {
 		conf.VaultHost = c.VaultHost
 	}
 
+	conf.VaultTokenMount = strings.Trim(c.VaultTokenMount, "/")
+	if conf.VaultTokenMount == "" {
+		conf.VaultTokenMount = DefaultVaultTokenMount
+	}
+
+	if c.VaultKVVersion == 0 {
+		conf.VaultKVVersion = DefaultVaultKVVersion
+	} else {
+		conf.VaultKVVersion = c.VaultKVVersion
+	}
+
+	conf.OAuthStateVaultTransitKey = c.OAuthStateVaultTransitKey
+	conf.OAuthStateVaultTransitMount = strings.Trim(c.OAuthStateVaultTransitMount, "/")
+	if conf.OAuthStateVaultTransitMount == "" {
+		conf.OAuthStateVaultTransitMount = DefaultOAuthStateVaultTransitMount
+	}
+
+	conf.VaultTokenPathTemplate = strings.Trim(c.VaultTokenPathTemplate, "/")
+	if conf.VaultTokenPathTemplate == "" {
+		conf.VaultTokenPathTemplate = DefaultVaultTokenPathTemplate
+	}
+
 	var parseErr error
 	conf.TokenLookupCacheTtl, parseErr = parseDuration(c.TokenLookupCacheTtl, "1h")
 	if parseErr != nil {
@@ -137,6 +812,146 @@ func (c PersistedConfiguration) inflate() (Configuration, error) {
 		return conf, parseErr
 	}
 
+	conf.AccessCheckCacheTtl, parseErr = parseDuration(c.AccessCheckCacheTtl, "5m")
+	if parseErr != nil {
+		return conf, parseErr
+	}
+
+	conf.TokenStorageCacheTtl, parseErr = parseDuration(c.TokenStorageCacheTtl, "1m")
+	if parseErr != nil {
+		return conf, parseErr
+	}
+
+	conf.StatusUpdateCoalescingInterval, parseErr = parseDuration(c.StatusUpdateCoalescingInterval, "0s")
+	if parseErr != nil {
+		return conf, parseErr
+	}
+
+	conf.TokenDataRetention, parseErr = parseDuration(c.TokenDataRetention, "0s")
+	if parseErr != nil {
+		return conf, parseErr
+	}
+
+	conf.TokenExpiryNotificationPeriod, parseErr = parseDuration(c.TokenExpiryNotificationPeriod, "168h")
+	if parseErr != nil {
+		return conf, parseErr
+	}
+
+	conf.OAuthStateClockSkewTolerance, parseErr = parseDuration(c.OAuthStateClockSkewTolerance, "30s")
+	if parseErr != nil {
+		return conf, parseErr
+	}
+
+	conf.ScopeDriftCheckInterval, parseErr = parseDuration(c.ScopeDriftCheckInterval, "24h")
+	if parseErr != nil {
+		return conf, parseErr
+	}
+
+	conf.CredentialsLookupTtl, parseErr = parseDuration(c.CredentialsLookupTtl, "15m")
+	if parseErr != nil {
+		return conf, parseErr
+	}
+
+	if c.TokenStorageCacheSize == 0 {
+		conf.TokenStorageCacheSize = DefaultTokenStorageCacheSize
+	} else {
+		conf.TokenStorageCacheSize = c.TokenStorageCacheSize
+	}
+
+	if c.ProviderResponseSizeLimit == 0 {
+		conf.ProviderResponseSizeLimit = DefaultProviderResponseSizeLimit
+	} else {
+		conf.ProviderResponseSizeLimit = c.ProviderResponseSizeLimit
+	}
+
+	if c.TokenStorage == "" {
+		conf.TokenStorage = DefaultTokenStorage
+	} else {
+		conf.TokenStorage = c.TokenStorage
+	}
+	conf.TokenStorageMigrationSource = c.TokenStorageMigrationSource
+
+	if c.TokenDataHistorySize == 0 {
+		conf.TokenDataHistorySize = DefaultTokenDataHistorySize
+	} else if c.TokenDataHistorySize > 0 {
+		conf.TokenDataHistorySize = c.TokenDataHistorySize
+	}
+
+	if c.TokenPhaseHistorySize == 0 {
+		conf.TokenPhaseHistorySize = DefaultTokenPhaseHistorySize
+	} else if c.TokenPhaseHistorySize > 0 {
+		conf.TokenPhaseHistorySize = c.TokenPhaseHistorySize
+	}
+
+	if c.ServiceProviderStateSizeLimit == 0 {
+		conf.ServiceProviderStateSizeLimit = DefaultServiceProviderStateSizeLimit
+	} else if c.ServiceProviderStateSizeLimit > 0 {
+		conf.ServiceProviderStateSizeLimit = c.ServiceProviderStateSizeLimit
+	}
+
+	if c.TokenLookupConcurrency == 0 {
+		conf.TokenLookupConcurrency = DefaultTokenLookupConcurrency
+	} else {
+		conf.TokenLookupConcurrency = c.TokenLookupConcurrency
+	}
+
+	if c.NamespaceCleanupConcurrency == 0 {
+		conf.NamespaceCleanupConcurrency = DefaultNamespaceCleanupConcurrency
+	} else {
+		conf.NamespaceCleanupConcurrency = c.NamespaceCleanupConcurrency
+	}
+
+	if c.GrantRevocationPolicy == "" {
+		conf.GrantRevocationPolicy = DefaultGrantRevocationPolicy
+	} else {
+		conf.GrantRevocationPolicy = c.GrantRevocationPolicy
+	}
+
+	conf.RelinkBindings = c.RelinkBindings == nil || *c.RelinkBindings
+
+	if c.InUseTokenDeletionPolicy == "" {
+		conf.InUseTokenDeletionPolicy = DefaultInUseTokenDeletionPolicy
+	} else {
+		conf.InUseTokenDeletionPolicy = c.InUseTokenDeletionPolicy
+	}
+
+	if c.RateLimitThreshold == 0 {
+		conf.RateLimitThreshold = DefaultRateLimitThreshold
+	} else if c.RateLimitThreshold > 0 {
+		conf.RateLimitThreshold = c.RateLimitThreshold
+	}
+	conf.RateLimitStatusConfigMap = c.RateLimitStatusConfigMap
+	conf.EgressReportConfigMap = c.EgressReportConfigMap
+	conf.ConfigurationStatusConfigMap = c.ConfigurationStatusConfigMap
+	conf.ScopeTranslationConfigMap = c.ScopeTranslationConfigMap
+	conf.FIPSMode = c.FIPSMode || FIPSBuild
+	conf.BindingWriteBackVaultMount = strings.Trim(c.BindingWriteBackVaultMount, "/")
+	conf.ExternalSecretStore = c.ExternalSecretStore
+	conf.ExternalSecretVaultRolePrefix = c.ExternalSecretVaultRolePrefix
+	if conf.ExternalSecretVaultRolePrefix == "" {
+		conf.ExternalSecretVaultRolePrefix = DefaultExternalSecretVaultRolePrefix
+	}
+	conf.ExternalSecretServiceAccount = c.ExternalSecretServiceAccount
+	if conf.ExternalSecretServiceAccount == "" {
+		conf.ExternalSecretServiceAccount = DefaultExternalSecretServiceAccount
+	}
+	conf.BindingPolicyWebhookUrl = c.BindingPolicyWebhookUrl
+	conf.SelfTestServiceProviderUrl = c.SelfTestServiceProviderUrl
+	conf.TokenOwnershipAdminUsers = c.TokenOwnershipAdminUsers
+	conf.TokenOwnershipAdminGroups = c.TokenOwnershipAdminGroups
+	conf.NotificationWebhookUrls = c.NotificationWebhookUrls
+	conf.ClusterId = c.ClusterId
+	conf.ProviderUserAgent = c.ProviderUserAgent
+	conf.ProviderRequestTagHeader = c.ProviderRequestTagHeader
+	conf.OAuthBrokerUrl = strings.TrimSuffix(c.OAuthBrokerUrl, "/")
+	conf.OAuthBrokerRealm = c.OAuthBrokerRealm
+	conf.OAuthBrokerClientId = c.OAuthBrokerClientId
+	conf.OAuthBrokerClientSecret = c.OAuthBrokerClientSecret
+	conf.CredentialsLookupUsers = c.CredentialsLookupUsers
+	conf.DebugUsers = c.DebugUsers
+	conf.ServiceProviderHostAllowList = c.ServiceProviderHostAllowList
+	conf.ServiceProviderHostDenyList = c.ServiceProviderHostDenyList
+
 	if saTokenPath, ok := os.LookupEnv("SA_TOKEN_PATH"); ok {
 		conf.ServiceAccountTokenFilePath = saTokenPath
 	}
@@ -144,10 +959,281 @@ func (c PersistedConfiguration) inflate() (Configuration, error) {
 	conf.KubernetesAuthAudiences = c.KubernetesAuthAudiences
 	conf.ServiceProviders = c.ServiceProviders
 	conf.SharedSecret = []byte(c.SharedSecret)
+	for _, secret := range c.PreviousSharedSecrets {
+		conf.PreviousSharedSecrets = append(conf.PreviousSharedSecrets, []byte(secret))
+	}
 	conf.BaseUrl = c.BaseUrl
 	return conf, nil
 }
 
+// Validate checks that the configuration is consistent. It returns an aggregate of all the problems found, if any.
+func (c Configuration) Validate() error {
+	errs := make([]error, 0)
+
+	for i, spc := range c.ServiceProviders {
+		for _, err := range spc.validate() {
+			errs = append(errs, fmt.Errorf("serviceProviders[%d]: %w", i, err))
+		}
+	}
+
+	if c.TokenLookupCacheTtl < 0 {
+		errs = append(errs, fmt.Errorf("tokenLookupCacheTtl cannot be negative"))
+	}
+
+	if c.VaultKVVersion != 0 && c.VaultKVVersion != 1 && c.VaultKVVersion != 2 {
+		errs = append(errs, fmt.Errorf("vaultKvVersion must be 1 or 2"))
+	}
+
+	if c.VaultTokenPathTemplate != "" && (!strings.Contains(c.VaultTokenPathTemplate, VaultPathNamespacePlaceholder) || !strings.Contains(c.VaultTokenPathTemplate, VaultPathNamePlaceholder)) {
+		errs = append(errs, fmt.Errorf("vaultTokenPathTemplate must contain both %s and %s", VaultPathNamespacePlaceholder, VaultPathNamePlaceholder))
+	}
+
+	if strings.Contains(c.OAuthStateVaultTransitKey, "/") {
+		errs = append(errs, fmt.Errorf("oauthStateVaultTransitKey cannot contain '/'"))
+	}
+
+	if c.AccessCheckTtl < 0 {
+		errs = append(errs, fmt.Errorf("accessCheckTtl cannot be negative"))
+	}
+
+	if c.AccessCheckCacheTtl < 0 {
+		errs = append(errs, fmt.Errorf("accessCheckCacheTtl cannot be negative"))
+	}
+
+	if c.TokenStorageCacheTtl < 0 {
+		errs = append(errs, fmt.Errorf("tokenStorageCacheTtl cannot be negative"))
+	}
+
+	if c.StatusUpdateCoalescingInterval < 0 {
+		errs = append(errs, fmt.Errorf("statusUpdateCoalescingInterval cannot be negative"))
+	}
+
+	if c.TokenStorageCacheSize < 0 {
+		errs = append(errs, fmt.Errorf("tokenStorageCacheSize cannot be negative"))
+	}
+
+	if c.TokenDataHistorySize < 0 {
+		errs = append(errs, fmt.Errorf("tokenDataHistorySize cannot be negative"))
+	}
+
+	if c.TokenPhaseHistorySize < 0 {
+		errs = append(errs, fmt.Errorf("tokenPhaseHistorySize cannot be negative"))
+	}
+
+	if c.ServiceProviderStateSizeLimit < 0 {
+		errs = append(errs, fmt.Errorf("serviceProviderStateSizeLimit cannot be negative"))
+	}
+
+	if c.TokenLookupConcurrency < 0 {
+		errs = append(errs, fmt.Errorf("tokenLookupConcurrency cannot be negative"))
+	}
+
+	if c.NamespaceCleanupConcurrency < 0 {
+		errs = append(errs, fmt.Errorf("namespaceCleanupConcurrency cannot be negative"))
+	}
+
+	if c.TokenDataRetention < 0 {
+		errs = append(errs, fmt.Errorf("tokenDataRetention cannot be negative"))
+	}
+
+	if c.RateLimitThreshold < 0 {
+		errs = append(errs, fmt.Errorf("rateLimitThreshold cannot be negative"))
+	}
+
+	if c.RateLimitStatusConfigMap != "" && !isNamespacedName(c.RateLimitStatusConfigMap) {
+		errs = append(errs, fmt.Errorf("rateLimitStatusConfigMap must be in the form namespace/name"))
+	}
+
+	if c.EgressReportConfigMap != "" && !isNamespacedName(c.EgressReportConfigMap) {
+		errs = append(errs, fmt.Errorf("egressReportConfigMap must be in the form namespace/name"))
+	}
+
+	if c.ConfigurationStatusConfigMap != "" && !isNamespacedName(c.ConfigurationStatusConfigMap) {
+		errs = append(errs, fmt.Errorf("configurationStatusConfigMap must be in the form namespace/name"))
+	}
+
+	if c.ScopeTranslationConfigMap != "" && !isNamespacedName(c.ScopeTranslationConfigMap) {
+		errs = append(errs, fmt.Errorf("scopeTranslationConfigMap must be in the form namespace/name"))
+	}
+
+	if c.BindingPolicyWebhookUrl != "" {
+		if u, err := url.Parse(c.BindingPolicyWebhookUrl); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("bindingPolicyWebhookUrl must be an absolute http(s) URL"))
+		}
+	}
+
+	if c.SelfTestServiceProviderUrl != "" {
+		if u, err := url.Parse(c.SelfTestServiceProviderUrl); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("selfTestServiceProviderUrl must be an absolute http(s) URL"))
+		}
+	}
+
+	for i, webhookUrl := range c.NotificationWebhookUrls {
+		if u, err := url.Parse(webhookUrl); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("notificationWebhookUrls[%d] must be an absolute http(s) URL", i))
+		}
+	}
+
+	if c.TokenExpiryNotificationPeriod < 0 {
+		errs = append(errs, fmt.Errorf("tokenExpiryNotificationPeriod cannot be negative"))
+	}
+
+	if c.OAuthStateClockSkewTolerance < 0 {
+		errs = append(errs, fmt.Errorf("oauthStateClockSkewTolerance cannot be negative"))
+	}
+
+	if c.ScopeDriftCheckInterval < 0 {
+		errs = append(errs, fmt.Errorf("scopeDriftCheckInterval cannot be negative"))
+	}
+
+	for i, pattern := range c.ServiceProviderHostAllowList {
+		if !isHostPattern(pattern) {
+			errs = append(errs, fmt.Errorf("serviceProviderHostAllowList[%d] '%s' is not a host or a wildcard like '*.acme.com'", i, pattern))
+		}
+	}
+
+	for i, pattern := range c.ServiceProviderHostDenyList {
+		if !isHostPattern(pattern) {
+			errs = append(errs, fmt.Errorf("serviceProviderHostDenyList[%d] '%s' is not a host or a wildcard like '*.acme.com'", i, pattern))
+		}
+	}
+
+	if len(c.CredentialsLookupUsers) > 0 && c.CredentialsLookupTtl <= 0 {
+		errs = append(errs, fmt.Errorf("credentialsLookupTtl must be positive"))
+	}
+
+	if c.ProviderResponseSizeLimit < 0 {
+		errs = append(errs, fmt.Errorf("providerResponseSizeLimit cannot be negative"))
+	}
+
+	if c.ProviderRequestTagHeader != "" && !httpguts.ValidHeaderFieldName(c.ProviderRequestTagHeader) {
+		errs = append(errs, fmt.Errorf("providerRequestTagHeader '%s' is not a valid header name", c.ProviderRequestTagHeader))
+	}
+
+	if c.ProviderUserAgent != "" && !httpguts.ValidHeaderFieldValue(c.ProviderUserAgent) {
+		errs = append(errs, fmt.Errorf("providerUserAgent is not a valid header value"))
+	}
+
+	if c.OAuthBrokerUrl != "" {
+		if u, err := url.Parse(c.OAuthBrokerUrl); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("oauthBrokerUrl must be an absolute http(s) URL"))
+		}
+		if c.OAuthBrokerRealm == "" {
+			errs = append(errs, fmt.Errorf("oauthBrokerRealm is required with oauthBrokerUrl"))
+		}
+		if c.OAuthBrokerClientId == "" || c.OAuthBrokerClientSecret == "" {
+			errs = append(errs, fmt.Errorf("oauthBrokerClientId and oauthBrokerClientSecret are required with oauthBrokerUrl"))
+		}
+	} else {
+		for i, spc := range c.ServiceProviders {
+			if spc.BrokerIdentityProvider != "" {
+				errs = append(errs, fmt.Errorf("serviceProviders[%d]: brokerIdentityProvider requires oauthBrokerUrl to be set", i))
+			}
+		}
+	}
+
+	if c.ExternalSecretStore != "" && c.BindingWriteBackVaultMount == "" {
+		errs = append(errs, fmt.Errorf("externalSecretStore requires bindingWriteBackVaultMount to be set"))
+	}
+
+	if c.FIPSMode {
+		errs = append(errs, c.validateFIPS()...)
+	}
+
+	if c.GrantRevocationPolicy != "" && !c.GrantRevocationPolicy.isKnown() {
+		errs = append(errs, fmt.Errorf("unknown grantRevocationPolicy '%s'", c.GrantRevocationPolicy))
+	}
+
+	if c.InUseTokenDeletionPolicy != "" && !c.InUseTokenDeletionPolicy.isKnown() {
+		errs = append(errs, fmt.Errorf("unknown inUseTokenDeletionPolicy '%s'", c.InUseTokenDeletionPolicy))
+	}
+
+	if c.TokenStorage != "" && !c.TokenStorage.isKnown() {
+		errs = append(errs, fmt.Errorf("unknown tokenStorage '%s'", c.TokenStorage))
+	}
+
+	if c.TokenStorageMigrationSource != "" {
+		if !c.TokenStorageMigrationSource.isKnown() {
+			errs = append(errs, fmt.Errorf("unknown tokenStorageMigrationSource '%s'", c.TokenStorageMigrationSource))
+		} else if c.TokenStorageMigrationSource == c.TokenStorage {
+			errs = append(errs, fmt.Errorf("tokenStorageMigrationSource must differ from tokenStorage"))
+		}
+	}
+
+	return errors.NewAggregate(errs)
+}
+
+// validate checks that the service provider configuration is complete and returns the problems found, if any.
+func (spc ServiceProviderConfiguration) validate() []error {
+	errs := make([]error, 0)
+	brokered := false
+
+	switch spc.ServiceProviderType {
+	case ServiceProviderTypeGitHub, ServiceProviderTypeQuay:
+		if spc.BrokerIdentityProvider != "" {
+			// the OAuth application is configured in the identity provider in Keycloak
+			brokered = true
+		} else if spc.ClientId == "" {
+			errs = append(errs, fmt.Errorf("clientId is required"))
+		}
+	case ServiceProviderTypeKubernetes:
+		// there is no OAuth application in Kubernetes. The clientSecret is the token used to review the uploaded tokens.
+		if spc.ServiceProviderBaseUrl == "" {
+			errs = append(errs, fmt.Errorf("baseUrl is required for the Kubernetes service provider"))
+		}
+	case ServiceProviderTypeNexus:
+		// there is no OAuth application in Nexus. The clientId and clientSecret are the credentials of the user allowed to
+		// read the users, roles and privileges, so that the permissions of the uploaded tokens can be determined.
+		if spc.ServiceProviderBaseUrl == "" {
+			errs = append(errs, fmt.Errorf("baseUrl is required for the Nexus service provider"))
+		}
+		if spc.ClientId == "" {
+			errs = append(errs, fmt.Errorf("clientId is required"))
+		}
+	case ServiceProviderTypeEcho:
+		// the echo service provider is never contacted and needs no credentials, the base URL only identifies it
+		if spc.ServiceProviderBaseUrl == "" {
+			errs = append(errs, fmt.Errorf("baseUrl is required for the Echo service provider"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown service provider type '%s'", spc.ServiceProviderType))
+	}
+
+	if spc.ClientSecret == "" && !brokered && spc.ServiceProviderType != ServiceProviderTypeEcho {
+		errs = append(errs, fmt.Errorf("clientSecret is required"))
+	}
+
+	if spc.MaxTokenValidity < 0 {
+		errs = append(errs, fmt.Errorf("maxTokenValidity cannot be negative"))
+	}
+
+	for i, w := range spc.MaintenanceWindows {
+		if !w.End.After(w.Start) {
+			errs = append(errs, fmt.Errorf("maintenanceWindows[%d]: end must be after start", i))
+		}
+	}
+
+	return errs
+}
+
+func (t TokenStorageType) isKnown() bool {
+	return t == TokenStorageTypeVault || t == TokenStorageTypeSecrets
+}
+
+// isNamespacedName checks that the value is in the form namespace/name.
+func isNamespacedName(value string) bool {
+	parts := strings.Split(value, "/")
+	return len(parts) == 2 && parts[0] != "" && parts[1] != ""
+}
+
+func (p GrantRevocationPolicy) isKnown() bool {
+	return p == GrantRevocationPolicyNever || p == GrantRevocationPolicyOnNamespaceDeletion || p == GrantRevocationPolicyAlways
+}
+
+func (p InUseTokenDeletionPolicy) isKnown() bool {
+	return p == InUseTokenDeletionPolicyWarn || p == InUseTokenDeletionPolicyDeny
+}
+
 func parseDuration(timeString string, defaultValue string) (time.Duration, error) {
 	if timeString == "" {
 		timeString = defaultValue
@@ -155,6 +1241,9 @@ func parseDuration(timeString string, defaultValue string) (time.Duration, error
 	return time.ParseDuration(timeString)
 }
 
+// LoadFrom loads the configuration from the provided file. The configuration is not validated, because the file is
+// shared with the OAuth service and the files accepted before the validation existed need to keep loading. Use
+// Configuration.Validate to check it.
 func LoadFrom(configFile string) (Configuration, error) {
 	cfg := Configuration{}
 	pcfg, err := loadFrom(configFile)
@@ -162,12 +1251,7 @@ func LoadFrom(configFile string) (Configuration, error) {
 		return cfg, err
 	}
 
-	cfg, err = pcfg.inflate()
-	if err != nil {
-		return cfg, err
-	}
-
-	return cfg, nil
+	return pcfg.inflate()
 }
 
 // loadFrom loads the configuration from the provided file-system path. Note that the returned configuration is fully
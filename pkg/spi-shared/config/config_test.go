@@ -50,17 +50,72 @@ users:
 
 	configFileContent := `
 sharedSecret: yaddayadda123$@#**
+previousSharedSecrets:
+- oldsecret
 serviceProviders:
 - type: GitHub
   clientId: "123"
   clientSecret: "42"
+  maxTokenValidity: 2160h
+  maintenanceWindows:
+  - start: 2023-06-10T20:00:00Z
+    end: 2023-06-11T02:00:00Z
 - type: Quay
   clientId: "456"
   clientSecret: "54"
 baseUrl: blabol
 vaultHost: vaultTestHost
+vaultTokenMount: /secret/
+vaultKvVersion: 1
+vaultTokenPathTemplate: teams/{namespace}/spi/{name}
+oauthStateVaultTransitKey: spi-state
+oauthStateVaultTransitMount: /spi-transit/
 accessCheckTtl: 37m
+accessCheckCacheTtl: 2m
 tokenLookupCacheTtl: 62m
+tokenStorageCacheTtl: 2m
+statusUpdateCoalescingInterval: 3s
+tokenDataRetention: 72h
+tokenStorageCacheSize: 42
+providerResponseSizeLimit: 1024
+tokenDataHistorySize: 5
+tokenPhaseHistorySize: 4
+serviceProviderStateSizeLimit: 1024
+tokenLookupConcurrency: 3
+namespaceCleanupConcurrency: 7
+grantRevocationPolicy: always
+inUseTokenDeletionPolicy: deny
+scopeDriftCheckInterval: 6h
+relinkBindings: false
+rateLimitThreshold: 10
+rateLimitStatusConfigMap: spi-system/spi-rate-limits
+egressReportConfigMap: spi-system/spi-egress
+configurationStatusConfigMap: spi-system/spi-config-status
+scopeTranslationConfigMap: spi-system/spi-scopes
+bindingWriteBackVaultMount: /spi-bindings/
+externalSecretStore: spi-bindings
+externalSecretVaultRolePrefix: eso-
+externalSecretServiceAccount: eso
+bindingPolicyWebhookUrl: https://policy.spi-system.svc/bindings
+selfTestServiceProviderUrl: https://echo.spi-system.svc
+tokenOwnershipAdminUsers:
+  - system:serviceaccount:spi-system:spi-oauth-sa
+tokenOwnershipAdminGroups:
+  - spi-admins
+notificationWebhookUrls:
+  - https://hooks.slack.com/services/T0/B0/X
+tokenExpiryNotificationPeriod: 72h
+oauthStateClockSkewTolerance: 5s
+credentialsLookupUsers:
+  - system:serviceaccount:build-service:build-service-controller
+credentialsLookupTtl: 5m
+debugUsers:
+  - alice
+serviceProviderHostAllowList:
+  - github.com
+  - "*.acme.com"
+serviceProviderHostDenyList:
+  - internal.acme.com
 `
 	cfgFilePath := createFile(t, "config", configFileContent)
 	defer os.Remove(cfgFilePath)
@@ -70,10 +125,134 @@ tokenLookupCacheTtl: 62m
 
 	assert.Equal(t, "blabol", cfg.BaseUrl)
 	assert.Equal(t, []byte("yaddayadda123$@#**"), cfg.SharedSecret)
+	assert.Equal(t, [][]byte{[]byte("oldsecret")}, cfg.PreviousSharedSecrets)
 	assert.Equal(t, "vaultTestHost", cfg.VaultHost)
+	assert.Equal(t, "secret", cfg.VaultTokenMount)
+	assert.Equal(t, 1, cfg.VaultKVVersion)
+	assert.Equal(t, "teams/{namespace}/spi/{name}", cfg.VaultTokenPathTemplate)
+	assert.Equal(t, "spi-state", cfg.OAuthStateVaultTransitKey)
+	assert.Equal(t, "spi-transit", cfg.OAuthStateVaultTransitMount)
 	assert.Equal(t, time.Minute*37, cfg.AccessCheckTtl)
+	assert.Equal(t, time.Minute*2, cfg.AccessCheckCacheTtl)
 	assert.Equal(t, time.Minute*62, cfg.TokenLookupCacheTtl)
+	assert.Equal(t, time.Minute*2, cfg.TokenStorageCacheTtl)
+	assert.Equal(t, time.Second*3, cfg.StatusUpdateCoalescingInterval)
+	assert.Equal(t, time.Hour*72, cfg.TokenDataRetention)
+	assert.Equal(t, 42, cfg.TokenStorageCacheSize)
+	assert.Equal(t, 1024, cfg.ProviderResponseSizeLimit)
+	assert.Equal(t, 5, cfg.TokenDataHistorySize)
+	assert.Equal(t, 4, cfg.TokenPhaseHistorySize)
+	assert.Equal(t, 1024, cfg.ServiceProviderStateSizeLimit)
+	assert.Equal(t, 3, cfg.TokenLookupConcurrency)
+	assert.Equal(t, 7, cfg.NamespaceCleanupConcurrency)
+	assert.Equal(t, GrantRevocationPolicyAlways, cfg.GrantRevocationPolicy)
+	assert.Equal(t, InUseTokenDeletionPolicyDeny, cfg.InUseTokenDeletionPolicy)
+	assert.Equal(t, 6*time.Hour, cfg.ScopeDriftCheckInterval)
+	assert.Equal(t, []string{"system:serviceaccount:build-service:build-service-controller"}, cfg.CredentialsLookupUsers)
+	assert.Equal(t, 5*time.Minute, cfg.CredentialsLookupTtl)
+	assert.Equal(t, []string{"alice"}, cfg.DebugUsers)
+	assert.Equal(t, []string{"github.com", "*.acme.com"}, cfg.ServiceProviderHostAllowList)
+	assert.Equal(t, []string{"internal.acme.com"}, cfg.ServiceProviderHostDenyList)
+	assert.False(t, cfg.RelinkBindings)
+	assert.Equal(t, 10, cfg.RateLimitThreshold)
+	assert.Equal(t, "spi-system/spi-rate-limits", cfg.RateLimitStatusConfigMap)
+	assert.Equal(t, "spi-system/spi-egress", cfg.EgressReportConfigMap)
+	assert.Equal(t, "spi-system/spi-config-status", cfg.ConfigurationStatusConfigMap)
+	assert.Equal(t, "spi-system/spi-scopes", cfg.ScopeTranslationConfigMap)
+	assert.Equal(t, "spi-bindings", cfg.BindingWriteBackVaultMount)
+	assert.Equal(t, "spi-bindings", cfg.ExternalSecretStore)
+	assert.Equal(t, "eso-", cfg.ExternalSecretVaultRolePrefix)
+	assert.Equal(t, "eso", cfg.ExternalSecretServiceAccount)
+	assert.Equal(t, "https://policy.spi-system.svc/bindings", cfg.BindingPolicyWebhookUrl)
+	assert.Equal(t, "https://echo.spi-system.svc", cfg.SelfTestServiceProviderUrl)
+	assert.Equal(t, []string{"system:serviceaccount:spi-system:spi-oauth-sa"}, cfg.TokenOwnershipAdminUsers)
+	assert.Equal(t, []string{"spi-admins"}, cfg.TokenOwnershipAdminGroups)
+	assert.Equal(t, []string{"https://hooks.slack.com/services/T0/B0/X"}, cfg.NotificationWebhookUrls)
+	assert.Equal(t, 72*time.Hour, cfg.TokenExpiryNotificationPeriod)
+	assert.Equal(t, 5*time.Second, cfg.OAuthStateClockSkewTolerance)
 	assert.Len(t, cfg.ServiceProviders, 2)
+	assert.Equal(t, 2160*time.Hour, cfg.ServiceProviders[0].MaxTokenValidity)
+	assert.Zero(t, cfg.ServiceProviders[1].MaxTokenValidity)
+	assert.Equal(t, []MaintenanceWindow{{
+		Start: time.Date(2023, 6, 10, 20, 0, 0, 0, time.UTC),
+		End:   time.Date(2023, 6, 11, 2, 0, 0, 0, time.UTC),
+	}}, cfg.ServiceProviders[0].MaintenanceWindows)
+}
+
+func TestMaxTokenValidity(t *testing.T) {
+	cfg := Configuration{
+		ServiceProviders: []ServiceProviderConfiguration{
+			{ServiceProviderType: ServiceProviderTypeGitHub, MaxTokenValidity: time.Hour},
+			{ServiceProviderType: ServiceProviderTypeGitHub, ServiceProviderBaseUrl: "https://ghe.acme.com/", MaxTokenValidity: 2 * time.Hour},
+			{ServiceProviderType: ServiceProviderTypeQuay},
+		},
+	}
+
+	assert.Equal(t, time.Hour, cfg.MaxTokenValidity(ServiceProviderTypeGitHub, "https://github.com"))
+	assert.Equal(t, 2*time.Hour, cfg.MaxTokenValidity(ServiceProviderTypeGitHub, "https://ghe.acme.com"))
+	assert.Zero(t, cfg.MaxTokenValidity(ServiceProviderTypeQuay, "https://quay.io"))
+	assert.Zero(t, cfg.MaxTokenValidity(ServiceProviderTypeKubernetes, "https://api.cluster:6443"))
+}
+
+func TestBrokerIdentityProvider(t *testing.T) {
+	cfg := Configuration{
+		ServiceProviders: []ServiceProviderConfiguration{
+			{ServiceProviderType: ServiceProviderTypeGitHub, BrokerIdentityProvider: "github"},
+			{ServiceProviderType: ServiceProviderTypeGitHub, ServiceProviderBaseUrl: "https://ghe.acme.com/", BrokerIdentityProvider: "ghe"},
+			{ServiceProviderType: ServiceProviderTypeQuay},
+		},
+	}
+
+	// not brokered without the broker
+	assert.Empty(t, cfg.BrokerIdentityProvider(ServiceProviderTypeGitHub, "https://github.com"))
+
+	cfg.OAuthBrokerUrl = "https://sso.acme.com"
+	assert.Equal(t, "github", cfg.BrokerIdentityProvider(ServiceProviderTypeGitHub, "https://github.com"))
+	assert.Equal(t, "ghe", cfg.BrokerIdentityProvider(ServiceProviderTypeGitHub, "https://ghe.acme.com"))
+	assert.Empty(t, cfg.BrokerIdentityProvider(ServiceProviderTypeQuay, "https://quay.io"))
+}
+
+func TestActiveMaintenanceWindow(t *testing.T) {
+	at := func(hour int) time.Time {
+		return time.Date(2023, 6, 10, hour, 0, 0, 0, time.UTC)
+	}
+	cfg := Configuration{
+		ServiceProviders: []ServiceProviderConfiguration{
+			{ServiceProviderType: ServiceProviderTypeGitHub},
+			{ServiceProviderType: ServiceProviderTypeGitHub, ServiceProviderBaseUrl: "https://ghe.acme.com/", MaintenanceWindows: []MaintenanceWindow{
+				{Start: at(10), End: at(14)},
+				{Start: at(12), End: at(16)},
+			}},
+		},
+	}
+
+	assert.Nil(t, cfg.ActiveMaintenanceWindow(ServiceProviderTypeGitHub, "https://github.com", at(12)))
+	assert.Nil(t, cfg.ActiveMaintenanceWindow(ServiceProviderTypeGitHub, "https://ghe.acme.com", at(9)))
+	assert.Equal(t, &MaintenanceWindow{Start: at(10), End: at(14)}, cfg.ActiveMaintenanceWindow(ServiceProviderTypeGitHub, "https://ghe.acme.com", at(10)))
+	assert.Equal(t, &MaintenanceWindow{Start: at(12), End: at(16)}, cfg.ActiveMaintenanceWindow(ServiceProviderTypeGitHub, "https://ghe.acme.com", at(13)))
+	assert.Nil(t, cfg.ActiveMaintenanceWindow(ServiceProviderTypeGitHub, "https://ghe.acme.com", at(16)))
+	assert.Nil(t, cfg.ActiveMaintenanceWindow(ServiceProviderTypeQuay, "https://quay.io", at(12)))
+}
+
+func TestServiceProviderHostAllowed(t *testing.T) {
+	assert.True(t, Configuration{}.ServiceProviderHostAllowed("10.0.0.1"))
+
+	cfg := Configuration{
+		ServiceProviderHostAllowList: []string{"github.com", "*.acme.com"},
+		ServiceProviderHostDenyList:  []string{"internal.acme.com"},
+	}
+	assert.True(t, cfg.ServiceProviderHostAllowed("github.com"))
+	assert.True(t, cfg.ServiceProviderHostAllowed("GitHub.com."))
+	assert.True(t, cfg.ServiceProviderHostAllowed("git.acme.com"))
+	assert.False(t, cfg.ServiceProviderHostAllowed("acme.com"))
+	assert.False(t, cfg.ServiceProviderHostAllowed("notacme.com"))
+	assert.False(t, cfg.ServiceProviderHostAllowed("internal.acme.com"))
+	assert.False(t, cfg.ServiceProviderHostAllowed("gitlab.com"))
+
+	denyOnly := Configuration{ServiceProviderHostDenyList: []string{"*.svc", "localhost"}}
+	assert.True(t, denyOnly.ServiceProviderHostAllowed("gitlab.com"))
+	assert.False(t, denyOnly.ServiceProviderHostAllowed("vault.spi.svc"))
+	assert.False(t, denyOnly.ServiceProviderHostAllowed("localhost"))
 }
 
 func TestDefaults(t *testing.T) {
@@ -86,8 +265,44 @@ func TestDefaults(t *testing.T) {
 	assert.NoError(t, err)
 
 	assert.Equal(t, DefaultVaultHost, cfg.VaultHost)
+	assert.Equal(t, DefaultVaultTokenMount, cfg.VaultTokenMount)
+	assert.Equal(t, DefaultVaultKVVersion, cfg.VaultKVVersion)
+	assert.Equal(t, "{namespace}/{name}", cfg.VaultTokenPathTemplate)
+	assert.Empty(t, cfg.OAuthStateVaultTransitKey)
+	assert.Equal(t, DefaultOAuthStateVaultTransitMount, cfg.OAuthStateVaultTransitMount)
 	assert.Equal(t, time.Minute*30, cfg.AccessCheckTtl)
+	assert.Equal(t, time.Minute*5, cfg.AccessCheckCacheTtl)
 	assert.Equal(t, time.Hour, cfg.TokenLookupCacheTtl)
+	assert.Equal(t, time.Minute, cfg.TokenStorageCacheTtl)
+	assert.Equal(t, time.Duration(0), cfg.StatusUpdateCoalescingInterval)
+	assert.Equal(t, time.Duration(0), cfg.TokenDataRetention)
+	assert.Equal(t, 168*time.Hour, cfg.TokenExpiryNotificationPeriod)
+	assert.Equal(t, 30*time.Second, cfg.OAuthStateClockSkewTolerance)
+	assert.Empty(t, cfg.NotificationWebhookUrls)
+	assert.Equal(t, DefaultTokenStorageCacheSize, cfg.TokenStorageCacheSize)
+	assert.Equal(t, DefaultProviderResponseSizeLimit, cfg.ProviderResponseSizeLimit)
+	assert.Equal(t, TokenStorageTypeVault, cfg.TokenStorage)
+	assert.Empty(t, cfg.TokenStorageMigrationSource)
+	assert.Equal(t, DefaultTokenDataHistorySize, cfg.TokenDataHistorySize)
+	assert.Equal(t, DefaultTokenPhaseHistorySize, cfg.TokenPhaseHistorySize)
+	assert.Equal(t, DefaultServiceProviderStateSizeLimit, cfg.ServiceProviderStateSizeLimit)
+	assert.Equal(t, DefaultTokenLookupConcurrency, cfg.TokenLookupConcurrency)
+	assert.Equal(t, DefaultNamespaceCleanupConcurrency, cfg.NamespaceCleanupConcurrency)
+	assert.Equal(t, GrantRevocationPolicyNever, cfg.GrantRevocationPolicy)
+	assert.Equal(t, InUseTokenDeletionPolicyWarn, cfg.InUseTokenDeletionPolicy)
+	assert.Equal(t, 24*time.Hour, cfg.ScopeDriftCheckInterval)
+	assert.Equal(t, 15*time.Minute, cfg.CredentialsLookupTtl)
+	assert.True(t, cfg.RelinkBindings)
+	assert.Equal(t, DefaultRateLimitThreshold, cfg.RateLimitThreshold)
+	assert.Empty(t, cfg.RateLimitStatusConfigMap)
+	assert.Empty(t, cfg.EgressReportConfigMap)
+	assert.Empty(t, cfg.ConfigurationStatusConfigMap)
+	assert.Empty(t, cfg.BindingWriteBackVaultMount)
+	assert.Empty(t, cfg.ExternalSecretStore)
+	assert.Equal(t, DefaultExternalSecretVaultRolePrefix, cfg.ExternalSecretVaultRolePrefix)
+	assert.Equal(t, DefaultExternalSecretServiceAccount, cfg.ExternalSecretServiceAccount)
+	assert.Empty(t, cfg.BindingPolicyWebhookUrl)
+	assert.Empty(t, cfg.SelfTestServiceProviderUrl)
 }
 
 func TestTtlParseFail(t *testing.T) {
@@ -106,6 +321,18 @@ func TestTtlParseFail(t *testing.T) {
 	t.Run("tokenLookupCacheTtl", func(t *testing.T) {
 		test("tokenLookupCacheTtl: blabol")
 	})
+
+	t.Run("tokenStorageCacheTtl", func(t *testing.T) {
+		test("tokenStorageCacheTtl: blabol")
+	})
+
+	t.Run("statusUpdateCoalescingInterval", func(t *testing.T) {
+		test("statusUpdateCoalescingInterval: blabol")
+	})
+
+	t.Run("tokenDataRetention", func(t *testing.T) {
+		test("tokenDataRetention: blabol")
+	})
 }
 
 func TestParseDuration(t *testing.T) {
@@ -147,3 +374,259 @@ func createFile(t *testing.T, path string, content string) string {
 
 	return filePath
 }
+
+func TestValidate(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		cfg := Configuration{
+			ServiceProviders: []ServiceProviderConfiguration{
+				{ServiceProviderType: ServiceProviderTypeGitHub, ClientId: "123", ClientSecret: "42"},
+				{ServiceProviderType: ServiceProviderTypeQuay, ClientId: "456", ClientSecret: "54"},
+			},
+		}
+		assert.NoError(t, cfg.Validate())
+	})
+
+	t.Run("unknown type", func(t *testing.T) {
+		cfg := Configuration{
+			ServiceProviders: []ServiceProviderConfiguration{
+				{ServiceProviderType: "Acme", ClientId: "123", ClientSecret: "42"},
+			},
+		}
+		assert.Error(t, cfg.Validate())
+	})
+
+	t.Run("missing client credentials", func(t *testing.T) {
+		cfg := Configuration{
+			ServiceProviders: []ServiceProviderConfiguration{
+				{ServiceProviderType: ServiceProviderTypeGitHub},
+			},
+		}
+		assert.Error(t, cfg.Validate())
+	})
+
+	t.Run("kubernetes", func(t *testing.T) {
+		assert.NoError(t, Configuration{ServiceProviders: []ServiceProviderConfiguration{
+			{ServiceProviderType: ServiceProviderTypeKubernetes, ServiceProviderBaseUrl: "https://api.cluster:6443", ClientSecret: "42"},
+		}}.Validate())
+		assert.Error(t, Configuration{ServiceProviders: []ServiceProviderConfiguration{
+			{ServiceProviderType: ServiceProviderTypeKubernetes, ClientSecret: "42"},
+		}}.Validate())
+	})
+
+	t.Run("nexus", func(t *testing.T) {
+		assert.NoError(t, Configuration{ServiceProviders: []ServiceProviderConfiguration{
+			{ServiceProviderType: ServiceProviderTypeNexus, ServiceProviderBaseUrl: "https://nexus.acme.com", ClientId: "spi", ClientSecret: "42"},
+		}}.Validate())
+		assert.Error(t, Configuration{ServiceProviders: []ServiceProviderConfiguration{
+			{ServiceProviderType: ServiceProviderTypeNexus, ClientId: "spi", ClientSecret: "42"},
+		}}.Validate())
+		assert.Error(t, Configuration{ServiceProviders: []ServiceProviderConfiguration{
+			{ServiceProviderType: ServiceProviderTypeNexus, ServiceProviderBaseUrl: "https://nexus.acme.com", ClientSecret: "42"},
+		}}.Validate())
+	})
+
+	t.Run("echo", func(t *testing.T) {
+		assert.NoError(t, Configuration{ServiceProviders: []ServiceProviderConfiguration{
+			{ServiceProviderType: ServiceProviderTypeEcho, ServiceProviderBaseUrl: "https://echo.spi.invalid"},
+		}}.Validate())
+		assert.Error(t, Configuration{ServiceProviders: []ServiceProviderConfiguration{
+			{ServiceProviderType: ServiceProviderTypeEcho},
+		}}.Validate())
+	})
+
+	t.Run("negative values", func(t *testing.T) {
+		assert.Error(t, Configuration{AccessCheckTtl: -time.Second}.Validate())
+		assert.Error(t, Configuration{AccessCheckCacheTtl: -time.Second}.Validate())
+		assert.Error(t, Configuration{TokenLookupCacheTtl: -time.Second}.Validate())
+		assert.Error(t, Configuration{TokenStorageCacheTtl: -time.Second}.Validate())
+		assert.Error(t, Configuration{StatusUpdateCoalescingInterval: -time.Second}.Validate())
+		assert.Error(t, Configuration{TokenDataRetention: -time.Second}.Validate())
+		assert.Error(t, Configuration{TokenExpiryNotificationPeriod: -time.Second}.Validate())
+		assert.Error(t, Configuration{OAuthStateClockSkewTolerance: -time.Second}.Validate())
+		assert.Error(t, Configuration{ScopeDriftCheckInterval: -time.Second}.Validate())
+		assert.Error(t, Configuration{TokenStorageCacheSize: -1}.Validate())
+		assert.Error(t, Configuration{ProviderResponseSizeLimit: -1}.Validate())
+		assert.Error(t, Configuration{TokenDataHistorySize: -1}.Validate())
+		assert.Error(t, Configuration{TokenPhaseHistorySize: -1}.Validate())
+		assert.Error(t, Configuration{ServiceProviderStateSizeLimit: -1}.Validate())
+		assert.Error(t, Configuration{TokenLookupConcurrency: -1}.Validate())
+		assert.Error(t, Configuration{NamespaceCleanupConcurrency: -1}.Validate())
+		assert.Error(t, Configuration{VaultKVVersion: 3}.Validate())
+		assert.Error(t, Configuration{VaultTokenPathTemplate: "spi/{name}"}.Validate())
+		assert.Error(t, Configuration{VaultTokenPathTemplate: "spi/{namespace}"}.Validate())
+		assert.Error(t, Configuration{OAuthStateVaultTransitKey: "spi/state"}.Validate())
+		assert.Error(t, Configuration{ServiceProviders: []ServiceProviderConfiguration{
+			{ServiceProviderType: ServiceProviderTypeGitHub, ClientId: "123", ClientSecret: "42", MaxTokenValidity: -time.Hour},
+		}}.Validate())
+	})
+
+	t.Run("token storage", func(t *testing.T) {
+		assert.NoError(t, Configuration{TokenStorage: TokenStorageTypeSecrets, TokenStorageMigrationSource: TokenStorageTypeVault}.Validate())
+		assert.Error(t, Configuration{TokenStorage: "acme"}.Validate())
+		assert.Error(t, Configuration{TokenStorage: TokenStorageTypeVault, TokenStorageMigrationSource: "acme"}.Validate())
+		assert.Error(t, Configuration{TokenStorage: TokenStorageTypeVault, TokenStorageMigrationSource: TokenStorageTypeVault}.Validate())
+	})
+
+	t.Run("notification webhooks", func(t *testing.T) {
+		assert.NoError(t, Configuration{NotificationWebhookUrls: []string{"https://hooks.slack.com/services/T0/B0/X"}}.Validate())
+		assert.Error(t, Configuration{NotificationWebhookUrls: []string{"https://hooks.slack.com/services/T0/B0/X", "hooks.slack.com"}}.Validate())
+	})
+
+	t.Run("grant revocation policy", func(t *testing.T) {
+		assert.NoError(t, Configuration{GrantRevocationPolicy: GrantRevocationPolicyOnNamespaceDeletion}.Validate())
+		assert.Error(t, Configuration{GrantRevocationPolicy: "sometimes"}.Validate())
+	})
+
+	t.Run("in-use token deletion policy", func(t *testing.T) {
+		assert.NoError(t, Configuration{InUseTokenDeletionPolicy: InUseTokenDeletionPolicyDeny}.Validate())
+		assert.Error(t, Configuration{InUseTokenDeletionPolicy: "ignore"}.Validate())
+	})
+
+	t.Run("rate limits", func(t *testing.T) {
+		assert.NoError(t, Configuration{RateLimitStatusConfigMap: "spi-system/spi-rate-limits"}.Validate())
+		assert.Error(t, Configuration{RateLimitThreshold: -1}.Validate())
+		assert.Error(t, Configuration{RateLimitStatusConfigMap: "spi-rate-limits"}.Validate())
+		assert.Error(t, Configuration{RateLimitStatusConfigMap: "spi-system/"}.Validate())
+	})
+
+	t.Run("egress report", func(t *testing.T) {
+		assert.NoError(t, Configuration{EgressReportConfigMap: "spi-system/spi-egress"}.Validate())
+		assert.Error(t, Configuration{EgressReportConfigMap: "/spi-egress"}.Validate())
+		assert.NoError(t, Configuration{ConfigurationStatusConfigMap: "spi-system/spi-config-status"}.Validate())
+		assert.Error(t, Configuration{ConfigurationStatusConfigMap: "spi-config-status"}.Validate())
+		assert.NoError(t, Configuration{ScopeTranslationConfigMap: "spi-system/spi-scopes"}.Validate())
+		assert.Error(t, Configuration{ScopeTranslationConfigMap: "spi-scopes"}.Validate())
+	})
+
+	t.Run("provider requests", func(t *testing.T) {
+		assert.NoError(t, Configuration{ProviderUserAgent: "my-operator/1.0", ProviderRequestTagHeader: "X-Spi-Initiator"}.Validate())
+		assert.Error(t, Configuration{ProviderRequestTagHeader: "bad header"}.Validate())
+		assert.Error(t, Configuration{ProviderUserAgent: "bad\nagent"}.Validate())
+	})
+
+	t.Run("oauth broker", func(t *testing.T) {
+		broker := Configuration{
+			ServiceProviders: []ServiceProviderConfiguration{
+				{ServiceProviderType: ServiceProviderTypeGitHub, BrokerIdentityProvider: "github"},
+			},
+			OAuthBrokerUrl:          "https://sso.acme.com/auth",
+			OAuthBrokerRealm:        "acme",
+			OAuthBrokerClientId:     "spi",
+			OAuthBrokerClientSecret: "secret",
+		}
+		// the brokered service providers don't need the OAuth application
+		assert.NoError(t, broker.Validate())
+
+		withoutRealm := broker
+		withoutRealm.OAuthBrokerRealm = ""
+		assert.Error(t, withoutRealm.Validate())
+
+		withoutClient := broker
+		withoutClient.OAuthBrokerClientSecret = ""
+		assert.Error(t, withoutClient.Validate())
+
+		badUrl := broker
+		badUrl.OAuthBrokerUrl = "sso.acme.com"
+		assert.Error(t, badUrl.Validate())
+
+		withoutBroker := broker
+		withoutBroker.OAuthBrokerUrl = ""
+		assert.Error(t, withoutBroker.Validate())
+	})
+
+	t.Run("external secret store", func(t *testing.T) {
+		assert.NoError(t, Configuration{BindingWriteBackVaultMount: "spi-bindings", ExternalSecretStore: "spi-bindings"}.Validate())
+		assert.Error(t, Configuration{ExternalSecretStore: "spi-bindings"}.Validate())
+	})
+
+	t.Run("binding policy webhook", func(t *testing.T) {
+		assert.NoError(t, Configuration{BindingPolicyWebhookUrl: "https://policy.spi-system.svc/bindings"}.Validate())
+		assert.Error(t, Configuration{BindingPolicyWebhookUrl: "policy.spi-system.svc/bindings"}.Validate())
+		assert.Error(t, Configuration{BindingPolicyWebhookUrl: "ftp://policy.spi-system.svc"}.Validate())
+		assert.NoError(t, Configuration{SelfTestServiceProviderUrl: "https://echo.spi-system.svc"}.Validate())
+		assert.Error(t, Configuration{SelfTestServiceProviderUrl: "echo.spi-system.svc"}.Validate())
+	})
+
+	t.Run("maintenance windows", func(t *testing.T) {
+		start := time.Date(2023, 6, 10, 20, 0, 0, 0, time.UTC)
+		spc := func(end time.Time) []ServiceProviderConfiguration {
+			return []ServiceProviderConfiguration{{ServiceProviderType: ServiceProviderTypeGitHub, ClientId: "123", ClientSecret: "42",
+				MaintenanceWindows: []MaintenanceWindow{{Start: start, End: end}}}}
+		}
+		assert.NoError(t, Configuration{ServiceProviders: spc(start.Add(time.Hour))}.Validate())
+		assert.Error(t, Configuration{ServiceProviders: spc(start)}.Validate())
+		assert.Error(t, Configuration{ServiceProviders: spc(start.Add(-time.Hour))}.Validate())
+	})
+
+	t.Run("credentials lookup", func(t *testing.T) {
+		users := []string{"system:serviceaccount:build-service:build-service-controller"}
+		assert.NoError(t, Configuration{CredentialsLookupUsers: users, CredentialsLookupTtl: time.Minute}.Validate())
+		assert.Error(t, Configuration{CredentialsLookupUsers: users}.Validate())
+	})
+
+	t.Run("service provider hosts", func(t *testing.T) {
+		assert.NoError(t, Configuration{ServiceProviderHostAllowList: []string{"github.com", "*.acme.com"}}.Validate())
+		assert.Error(t, Configuration{ServiceProviderHostAllowList: []string{"https://github.com"}}.Validate())
+		assert.Error(t, Configuration{ServiceProviderHostDenyList: []string{"internal.*.com"}}.Validate())
+		assert.Error(t, Configuration{ServiceProviderHostDenyList: []string{""}}.Validate())
+	})
+
+	t.Run("fips mode", func(t *testing.T) {
+		compliant := Configuration{
+			FIPSMode:     true,
+			SharedSecret: []byte("a long enough secret"),
+			TokenStorage: TokenStorageTypeVault,
+			VaultHost:    "https://spi-vault:8200",
+		}
+		assert.NoError(t, compliant.Validate())
+
+		shortSecret := compliant
+		shortSecret.SharedSecret = []byte("secret")
+		assert.EqualError(t, shortSecret.Validate(), "sharedSecret must be at least 14 bytes long in the FIPS mode")
+
+		shortPreviousSecret := compliant
+		shortPreviousSecret.PreviousSharedSecrets = [][]byte{[]byte("a long enough secret"), []byte("secret")}
+		assert.EqualError(t, shortPreviousSecret.Validate(), "previousSharedSecrets[1] must be at least 14 bytes long in the FIPS mode")
+
+		plainVault := compliant
+		plainVault.VaultHost = DefaultVaultHost
+		assert.Error(t, plainVault.Validate())
+
+		plainVault.TokenStorage = TokenStorageTypeSecrets
+		assert.NoError(t, plainVault.Validate())
+
+		plainVault.BindingWriteBackVaultMount = "spi-bindings"
+		assert.Error(t, plainVault.Validate())
+		plainVault.BindingWriteBackVaultMount = ""
+
+		plainVault.OAuthStateVaultTransitKey = "spi-state"
+		assert.Error(t, plainVault.Validate())
+		plainVault.OAuthStateVaultTransitKey = ""
+
+		transitOnly := compliant
+		transitOnly.SharedSecret = nil
+		assert.Error(t, transitOnly.Validate())
+		transitOnly.OAuthStateVaultTransitKey = "spi-state"
+		assert.NoError(t, transitOnly.Validate())
+
+		plainVault.FIPSMode = false
+		plainVault.TokenStorage = TokenStorageTypeVault
+		assert.NoError(t, plainVault.Validate())
+	})
+
+	t.Run("not validated on load", func(t *testing.T) {
+		// the configuration is shared with the OAuth service, so the configurations loaded before the validation
+		// existed still need to load
+		cfgFilePath := createFile(t, "config", `
+serviceProviders:
+- type: Acme
+  clientId: "123"
+  clientSecret: "42"
+`)
+		defer os.Remove(cfgFilePath)
+
+		cfg, err := LoadFrom(cfgFilePath)
+		assert.NoError(t, err)
+		assert.Error(t, cfg.Validate())
+	})
+}
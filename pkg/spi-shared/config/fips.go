@@ -0,0 +1,56 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+
+	"k8s.io/apimachinery/pkg/util/errors"
+)
+
+// FIPSBuild is true in the binaries built with the boringcrypto build tag using the Go+BoringCrypto toolchain (see
+// `make build-fips`). The FIPS mode cannot be switched off in such binaries.
+var FIPSBuild = false
+
+// ValidateFIPS checks that the configuration can be used with the FIPS-approved cryptography only. It returns
+// an aggregate of all the problems found, if any. The checks are also part of Validate if the FIPS mode is enabled.
+func (c Configuration) ValidateFIPS() error {
+	return errors.NewAggregate(c.validateFIPS())
+}
+
+// validateFIPS checks that the configuration can be used with the FIPS-approved cryptography only. The OAuth state is
+// signed using HMAC-SHA256 and Vault is only reached over TLS. The SharedSecret is not needed if the states are signed
+// using the Vault transit key.
+func (c Configuration) validateFIPS() []error {
+	var errs []error
+
+	if c.OAuthStateVaultTransitKey == "" && len(c.SharedSecret) < MinFIPSSharedSecretLength {
+		errs = append(errs, fmt.Errorf("sharedSecret must be at least %d bytes long in the FIPS mode", MinFIPSSharedSecretLength))
+	}
+
+	for i, secret := range c.PreviousSharedSecrets {
+		if len(secret) < MinFIPSSharedSecretLength {
+			errs = append(errs, fmt.Errorf("previousSharedSecrets[%d] must be at least %d bytes long in the FIPS mode", i, MinFIPSSharedSecretLength))
+		}
+	}
+
+	if c.TokenStorage == TokenStorageTypeVault || c.TokenStorageMigrationSource == TokenStorageTypeVault || c.BindingWriteBackVaultMount != "" || c.OAuthStateVaultTransitKey != "" {
+		if u, err := url.Parse(c.VaultHost); err != nil || u.Scheme != "https" {
+			errs = append(errs, fmt.Errorf("vaultHost must be an https URL in the FIPS mode, got '%s'", c.VaultHost))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,27 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build boringcrypto
+// +build boringcrypto
+
+package config
+
+// the boringcrypto build tag is set by `make build-fips`, which builds the operator using the Go+BoringCrypto toolchain
+// that replaces the standard library cryptography with the BoringCrypto module. The fipsonly package only exists in
+// that toolchain, so the build with the tag fails with a standard one. It restricts the TLS to the FIPS-approved
+// settings.
+import _ "crypto/tls/fipsonly"
+
+func init() {
+	FIPSBuild = true
+}
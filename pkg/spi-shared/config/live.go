@@ -0,0 +1,210 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// LiveConfiguration holds the current configuration that can be replaced at runtime, e.g. when the configuration file
+// changes. The consumers should always call Get to obtain the configuration instead of holding on to the returned
+// value so that they see the changes.
+type LiveConfiguration struct {
+	lock sync.RWMutex
+	cfg  Configuration
+}
+
+// NewLiveConfiguration returns a new live configuration initialized with the provided configuration.
+func NewLiveConfiguration(cfg Configuration) *LiveConfiguration {
+	return &LiveConfiguration{cfg: cfg}
+}
+
+// Get returns the current configuration.
+func (l *LiveConfiguration) Get() Configuration {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	return l.cfg
+}
+
+// Set replaces the current configuration with the provided one.
+func (l *LiveConfiguration) Set(cfg Configuration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.cfg = cfg
+}
+
+// update replaces the values of the current configuration that can change at runtime with the values from the provided
+// configuration (see reloaded).
+func (l *LiveConfiguration) update(cfg Configuration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.cfg = reloaded(l.cfg, cfg)
+}
+
+// reloaded returns the current configuration with the values that can change at runtime taken from the provided
+// configuration. Only the values read through the LiveConfiguration each time they are used are taken, the rest
+// (vault host, token storage cache settings, etc.) is only read once during the startup and therefore is kept as it is.
+// The new configuration values are not reloaded unless they are added here.
+func reloaded(current Configuration, cfg Configuration) Configuration {
+	current.ServiceProviders = cfg.ServiceProviders
+	current.BaseUrl = cfg.BaseUrl
+	current.SharedSecret = cfg.SharedSecret
+	current.PreviousSharedSecrets = cfg.PreviousSharedSecrets
+	current.OAuthStateClockSkewTolerance = cfg.OAuthStateClockSkewTolerance
+	current.TokenLookupCacheTtl = cfg.TokenLookupCacheTtl
+	current.AccessCheckTtl = cfg.AccessCheckTtl
+	current.AccessCheckCacheTtl = cfg.AccessCheckCacheTtl
+	current.StatusUpdateCoalescingInterval = cfg.StatusUpdateCoalescingInterval
+	current.TokenPhaseHistorySize = cfg.TokenPhaseHistorySize
+	current.TokenLookupConcurrency = cfg.TokenLookupConcurrency
+	current.NamespaceCleanupConcurrency = cfg.NamespaceCleanupConcurrency
+	current.GrantRevocationPolicy = cfg.GrantRevocationPolicy
+	current.TokenDataRetention = cfg.TokenDataRetention
+	current.RelinkBindings = cfg.RelinkBindings
+	current.RateLimitThreshold = cfg.RateLimitThreshold
+	current.RateLimitStatusConfigMap = cfg.RateLimitStatusConfigMap
+	current.EgressReportConfigMap = cfg.EgressReportConfigMap
+	current.ConfigurationStatusConfigMap = cfg.ConfigurationStatusConfigMap
+	current.ScopeTranslationConfigMap = cfg.ScopeTranslationConfigMap
+	current.ExternalSecretVaultRolePrefix = cfg.ExternalSecretVaultRolePrefix
+	current.ExternalSecretServiceAccount = cfg.ExternalSecretServiceAccount
+	current.BindingPolicyWebhookUrl = cfg.BindingPolicyWebhookUrl
+	current.SelfTestServiceProviderUrl = cfg.SelfTestServiceProviderUrl
+	current.TokenOwnershipAdminUsers = cfg.TokenOwnershipAdminUsers
+	current.TokenOwnershipAdminGroups = cfg.TokenOwnershipAdminGroups
+	current.NotificationWebhookUrls = cfg.NotificationWebhookUrls
+	current.TokenExpiryNotificationPeriod = cfg.TokenExpiryNotificationPeriod
+	current.InUseTokenDeletionPolicy = cfg.InUseTokenDeletionPolicy
+	current.ScopeDriftCheckInterval = cfg.ScopeDriftCheckInterval
+	current.OAuthBrokerUrl = cfg.OAuthBrokerUrl
+	current.OAuthBrokerRealm = cfg.OAuthBrokerRealm
+	current.OAuthBrokerClientId = cfg.OAuthBrokerClientId
+	current.OAuthBrokerClientSecret = cfg.OAuthBrokerClientSecret
+	current.CredentialsLookupUsers = cfg.CredentialsLookupUsers
+	current.CredentialsLookupTtl = cfg.CredentialsLookupTtl
+	current.DebugUsers = cfg.DebugUsers
+	current.ServiceProviderHostAllowList = cfg.ServiceProviderHostAllowList
+	current.ServiceProviderHostDenyList = cfg.ServiceProviderHostDenyList
+
+	return current
+}
+
+// FileWatcher periodically checks the configuration file for changes and updates the live configuration with its new
+// contents. If the changed file cannot be loaded or is invalid, the live configuration is left intact. FileWatcher
+// can be added to the controller-runtime manager as a runnable. It runs in all the replicas, not only in the leader.
+type FileWatcher struct {
+	// Path is the path to the configuration file.
+	Path string
+	// Interval is the interval in which the file is checked for changes.
+	Interval time.Duration
+	// Target is the live configuration updated with the contents of the changed file.
+	Target *LiveConfiguration
+	// OnReload is an optional function called after each attempt to reload the changed configuration file with the error
+	// encountered during the reload, if any.
+	OnReload func(err error)
+
+	lastContents []byte
+}
+
+var _ manager.LeaderElectionRunnable = (*FileWatcher)(nil)
+
+// NeedLeaderElection returns false, because all the replicas need to see the configuration changes.
+func (w *FileWatcher) NeedLeaderElection() bool {
+	return false
+}
+
+// Start checks the configuration file for changes until the provided context is done. Note that the first check only
+// records the current contents of the file, because the Target is assumed to be initialized from the same file.
+func (w *FileWatcher) Start(ctx context.Context) error {
+	lg := log.FromContext(ctx)
+
+	w.lastContents, _ = ioutil.ReadFile(w.Path)
+
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			changed, err := w.check()
+			if !changed {
+				continue
+			}
+
+			if err != nil {
+				lg.Error(err, "failed to reload the changed configuration file, keeping the previous configuration", "path", w.Path)
+			} else {
+				lg.Info("configuration reloaded", "path", w.Path)
+			}
+
+			if w.OnReload != nil {
+				w.OnReload(err)
+			}
+		}
+	}
+}
+
+// check reloads the configuration if the file changed since the last check. Returns true if the file changed
+// and the error encountered during the reload, if any.
+func (w *FileWatcher) check() (bool, error) {
+	contents, err := ioutil.ReadFile(w.Path)
+	if err != nil {
+		// the file might be in the middle of being replaced. If it is really gone, we just keep the previous
+		// configuration.
+		return false, nil
+	}
+
+	if bytes.Equal(contents, w.lastContents) {
+		return false, nil
+	}
+	w.lastContents = contents
+
+	pcfg, err := readFrom(bytes.NewReader(contents))
+	if err != nil {
+		return true, err
+	}
+
+	cfg, err := pcfg.inflate()
+	if err != nil {
+		return true, err
+	}
+
+	if err = cfg.Validate(); err != nil {
+		return true, err
+	}
+
+	// the FIPS mode is only set at the startup, but the values it restricts, e.g. the shared secret, are read live
+	if current := w.Target.Get(); current.FIPSMode {
+		if err = reloaded(current, cfg).ValidateFIPS(); err != nil {
+			return true, err
+		}
+	}
+
+	w.Target.update(cfg)
+
+	return true, nil
+}
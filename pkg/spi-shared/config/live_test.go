@@ -0,0 +1,158 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileWatcher_Check(t *testing.T) {
+	cfgFilePath := createFile(t, "config", `
+baseUrl: original
+vaultHost: originalVault
+accessCheckTtl: 10m
+`)
+	defer os.Remove(cfgFilePath)
+
+	cfg, err := LoadFrom(cfgFilePath)
+	assert.NoError(t, err)
+
+	live := NewLiveConfiguration(cfg)
+	watcher := FileWatcher{Path: cfgFilePath, Target: live}
+	watcher.lastContents, _ = ioutil.ReadFile(cfgFilePath)
+
+	t.Run("unchanged", func(t *testing.T) {
+		changed, err := watcher.check()
+		assert.False(t, changed)
+		assert.NoError(t, err)
+		assert.Equal(t, "original", live.Get().BaseUrl)
+	})
+
+	t.Run("changed", func(t *testing.T) {
+		assert.NoError(t, ioutil.WriteFile(cfgFilePath, []byte(`
+baseUrl: changed
+vaultHost: changedVault
+accessCheckTtl: 20m
+`), 0600))
+
+		changed, err := watcher.check()
+		assert.True(t, changed)
+		assert.NoError(t, err)
+		assert.Equal(t, "changed", live.Get().BaseUrl)
+		assert.Equal(t, 20*time.Minute, live.Get().AccessCheckTtl)
+		// vault host cannot change at runtime
+		assert.Equal(t, "originalVault", live.Get().VaultHost)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		assert.NoError(t, ioutil.WriteFile(cfgFilePath, []byte(`
+baseUrl: invalid
+accessCheckTtl: blabol
+`), 0600))
+
+		changed, err := watcher.check()
+		assert.True(t, changed)
+		assert.Error(t, err)
+		assert.Equal(t, "changed", live.Get().BaseUrl)
+	})
+}
+
+func TestReloaded(t *testing.T) {
+	// the fields that main.go reads only once during the startup. The rest of the fields needs to be reloaded.
+	startupOnly := map[string]bool{
+		"KubernetesAuthAudiences":       true,
+		"OAuthStateVaultTransitKey":     true,
+		"OAuthStateVaultTransitMount":   true,
+		"VaultHost":                     true,
+		"VaultTokenMount":               true,
+		"VaultKVVersion":                true,
+		"VaultTokenPathTemplate":        true,
+		"ServiceAccountTokenFilePath":   true,
+		"TokenStorageCacheTtl":          true,
+		"TokenStorageCacheSize":         true,
+		"TokenStorage":                  true,
+		"TokenStorageMigrationSource":   true,
+		"TokenDataHistorySize":          true,
+		"ServiceProviderStateSizeLimit": true,
+		"FIPSMode":                      true,
+		"BindingWriteBackVaultMount":    true,
+		"ExternalSecretStore":           true,
+		"ClusterId":                     true,
+		"ProviderUserAgent":             true,
+		"ProviderRequestTagHeader":      true,
+		"ProviderResponseSizeLimit":     true,
+	}
+
+	cfgType := reflect.TypeOf(Configuration{})
+	for i := 0; i < cfgType.NumField(); i++ {
+		field := cfgType.Field(i)
+		t.Run(field.Name, func(t *testing.T) {
+			cfg := Configuration{}
+			value := reflect.ValueOf(&cfg).Elem().Field(i)
+			switch value.Kind() {
+			case reflect.String:
+				value.SetString("changed")
+			case reflect.Int, reflect.Int64:
+				value.SetInt(1)
+			case reflect.Bool:
+				value.SetBool(true)
+			case reflect.Slice:
+				value.Set(reflect.Append(reflect.MakeSlice(value.Type(), 0, 1), reflect.New(value.Type().Elem()).Elem()))
+			default:
+				t.Fatalf("unsupported kind of the field: %s", value.Kind())
+			}
+
+			changed := !reflect.DeepEqual(reloaded(Configuration{}, cfg), Configuration{})
+			if startupOnly[field.Name] {
+				assert.False(t, changed, "the startup-only field must not be reloaded")
+			} else {
+				assert.True(t, changed, "the field must be either reloaded or listed as startup-only")
+			}
+		})
+	}
+}
+
+func TestFileWatcher_CheckFIPS(t *testing.T) {
+	cfgFilePath := createFile(t, "config", `
+sharedSecret: long-enough-secret
+vaultHost: https://vault
+`)
+	defer os.Remove(cfgFilePath)
+
+	cfg, err := LoadFrom(cfgFilePath)
+	assert.NoError(t, err)
+	cfg.FIPSMode = true
+	assert.NoError(t, cfg.ValidateFIPS())
+
+	live := NewLiveConfiguration(cfg)
+	watcher := FileWatcher{Path: cfgFilePath, Target: live}
+	watcher.lastContents, _ = ioutil.ReadFile(cfgFilePath)
+
+	assert.NoError(t, ioutil.WriteFile(cfgFilePath, []byte(`
+sharedSecret: short
+vaultHost: https://vault
+`), 0600))
+
+	changed, err := watcher.check()
+	assert.True(t, changed)
+	assert.Error(t, err)
+	assert.Equal(t, []byte("long-enough-secret"), live.Get().SharedSecret)
+}
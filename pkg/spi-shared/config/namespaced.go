@@ -0,0 +1,90 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/errors"
+)
+
+const (
+	// ServiceProviderConfigurationLabel marks the secrets in the user namespaces that override the cluster-wide
+	// configuration of a service provider for that namespace. The value of the label is not significant.
+	ServiceProviderConfigurationLabel = "spi.appstudio.redhat.com/service-provider-config"
+
+	serviceProviderTypeKey    = "type"
+	serviceProviderBaseUrlKey = "baseUrl"
+	clientIdKey               = "clientId"
+	clientSecretKey           = "clientSecret"
+	extraKeyPrefix            = "extra."
+)
+
+// ServiceProviderConfigurationFromSecret reads the service provider configuration from the provided secret labeled
+// with the ServiceProviderConfigurationLabel. The secret contains the "type", "clientId", "clientSecret" and
+// optionally also the "baseUrl" keys. The keys prefixed with "extra." are put into the Extra map without the prefix.
+func ServiceProviderConfigurationFromSecret(secret *corev1.Secret) (ServiceProviderConfiguration, error) {
+	spc := ServiceProviderConfiguration{
+		ServiceProviderType:    ServiceProviderType(secret.Data[serviceProviderTypeKey]),
+		ServiceProviderBaseUrl: string(secret.Data[serviceProviderBaseUrlKey]),
+		ClientId:               string(secret.Data[clientIdKey]),
+		ClientSecret:           string(secret.Data[clientSecretKey]),
+	}
+
+	for k, v := range secret.Data {
+		if strings.HasPrefix(k, extraKeyPrefix) {
+			if spc.Extra == nil {
+				spc.Extra = map[string]string{}
+			}
+			spc.Extra[strings.TrimPrefix(k, extraKeyPrefix)] = string(v)
+		}
+	}
+
+	if errs := spc.validate(); len(errs) > 0 {
+		return spc, fmt.Errorf("invalid service provider configuration in secret %s/%s: %w", secret.Namespace, secret.Name, errors.NewAggregate(errs))
+	}
+
+	return spc, nil
+}
+
+// WithServiceProviderOverrides returns a copy of the configuration with the provided service provider configurations
+// taking precedence over the configured ones. An override replaces the configuration of the service provider with
+// the same type and base URL, if any.
+func (c Configuration) WithServiceProviderOverrides(overrides []ServiceProviderConfiguration) Configuration {
+	if len(overrides) == 0 {
+		return c
+	}
+
+	sps := make([]ServiceProviderConfiguration, 0, len(overrides)+len(c.ServiceProviders))
+	sps = append(sps, overrides...)
+
+	for _, spc := range c.ServiceProviders {
+		overridden := false
+		for _, o := range overrides {
+			if o.ServiceProviderType == spc.ServiceProviderType && o.ServiceProviderBaseUrl == spc.ServiceProviderBaseUrl {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			sps = append(sps, spc)
+		}
+	}
+
+	c.ServiceProviders = sps
+	return c
+}
@@ -0,0 +1,86 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestServiceProviderConfigurationFromSecret(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		spc, err := ServiceProviderConfigurationFromSecret(&corev1.Secret{
+			Data: map[string][]byte{
+				"type":          []byte("Quay"),
+				"baseUrl":       []byte("https://quay.io"),
+				"clientId":      []byte("id"),
+				"clientSecret":  []byte("secret"),
+				"extra.orgName": []byte("team"),
+				"somethingElse": []byte("ignored"),
+			},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, ServiceProviderConfiguration{
+			ServiceProviderType:    ServiceProviderTypeQuay,
+			ServiceProviderBaseUrl: "https://quay.io",
+			ClientId:               "id",
+			ClientSecret:           "secret",
+			Extra:                  map[string]string{"orgName": "team"},
+		}, spc)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := ServiceProviderConfigurationFromSecret(&corev1.Secret{
+			Data: map[string][]byte{
+				"type":     []byte("Acme"),
+				"clientId": []byte("id"),
+			},
+		})
+		assert.Error(t, err)
+	})
+}
+
+func TestConfiguration_WithServiceProviderOverrides(t *testing.T) {
+	cfg := Configuration{
+		BaseUrl: "https://spi",
+		ServiceProviders: []ServiceProviderConfiguration{
+			{ServiceProviderType: ServiceProviderTypeGitHub, ClientId: "cluster-gh"},
+			{ServiceProviderType: ServiceProviderTypeQuay, ClientId: "cluster-quay"},
+		},
+	}
+
+	t.Run("no overrides", func(t *testing.T) {
+		assert.Equal(t, cfg, cfg.WithServiceProviderOverrides(nil))
+	})
+
+	t.Run("replaces and adds", func(t *testing.T) {
+		overridden := cfg.WithServiceProviderOverrides([]ServiceProviderConfiguration{
+			{ServiceProviderType: ServiceProviderTypeGitHub, ClientId: "team-gh"},
+			{ServiceProviderType: ServiceProviderTypeQuay, ServiceProviderBaseUrl: "https://my-quay", ClientId: "team-quay"},
+		})
+
+		assert.Equal(t, "https://spi", overridden.BaseUrl)
+		assert.Equal(t, []ServiceProviderConfiguration{
+			{ServiceProviderType: ServiceProviderTypeGitHub, ClientId: "team-gh"},
+			{ServiceProviderType: ServiceProviderTypeQuay, ServiceProviderBaseUrl: "https://my-quay", ClientId: "team-quay"},
+			{ServiceProviderType: ServiceProviderTypeQuay, ClientId: "cluster-quay"},
+		}, overridden.ServiceProviders)
+
+		// the original configuration is left intact
+		assert.Equal(t, "cluster-gh", cfg.ServiceProviders[0].ClientId)
+	})
+}
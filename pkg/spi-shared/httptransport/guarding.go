@@ -0,0 +1,174 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httptransport
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrSchemeNotAllowed is returned by the GuardingRoundTripper for the requests with a scheme it doesn't allow.
+	ErrSchemeNotAllowed = errors.New("the URL scheme is not allowed")
+	// ErrRedirectNotAllowed is returned by the GuardingRoundTripper for the redirects it doesn't follow.
+	ErrRedirectNotAllowed = errors.New("the redirect is not allowed")
+	// ErrResponseTooLarge is returned by the reads of the bodies of the responses exceeding the size limit of
+	// the GuardingRoundTripper.
+	ErrResponseTooLarge = errors.New("the response is too large")
+)
+
+// defaultRedirectTransport is used for the redirects to other hosts if the GuardingRoundTripper doesn't specify its own.
+var defaultRedirectTransport = RefusingInternalAddresses(http.DefaultTransport.(*http.Transport))
+
+// GuardingRoundTripper is a wrapper around an HTTP round tripper protecting the operator from the URLs the users
+// control, i.e. from being used to reach the internal services of the cluster (SSRF) or to exhaust its memory. It
+// rejects the requests with the schemes other than the AllowedSchemes and the redirects downgrading https to http.
+// The redirects to other hosts than the one of the original request are made using the RedirectRoundTripper refusing
+// to connect to private, loopback or link-local addresses, so that a public service provider cannot send the operator
+// into the internal network, while the service providers running in the internal network can still redirect within
+// their host. The reading of the response bodies larger than the MaxResponseSize fails with ErrResponseTooLarge.
+//
+// The http.Client passes every redirect through its transport again, so all the hops are checked.
+type GuardingRoundTripper struct {
+	http.RoundTripper
+	// AllowedSchemes are the allowed URL schemes. Only "https" and "http" are allowed if empty.
+	AllowedSchemes []string
+	// MaxResponseSize is the maximum size of the response bodies in bytes. There's no limit if not positive.
+	MaxResponseSize int64
+	// RedirectRoundTripper makes the redirects to other hosts. It must refuse to connect to the internal addresses,
+	// see RefusingInternalAddresses. The http.DefaultTransport refusing the internal addresses is used if nil.
+	RedirectRoundTripper http.RoundTripper
+}
+
+var _ http.RoundTripper = (*GuardingRoundTripper)(nil)
+
+func (r GuardingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !r.schemeAllowed(req.URL.Scheme) {
+		return nil, fmt.Errorf("%w: %s", ErrSchemeNotAllowed, req.URL.Scheme)
+	}
+
+	roundTripper := r.RoundTripper
+	// the http.Client sets the response causing the redirect on the redirected requests
+	if req.Response != nil && req.Response.Request != nil {
+		from := req.Response.Request
+		if from.URL.Scheme == "https" && req.URL.Scheme != "https" {
+			return nil, fmt.Errorf("%w: %s downgrades from https", ErrRedirectNotAllowed, req.URL.Redacted())
+		}
+
+		// compare with the original request so that a chain of redirects cannot return to the internal network
+		// through a host that was allowed once
+		if originalRequest(req).URL.Hostname() != req.URL.Hostname() {
+			roundTripper = r.RedirectRoundTripper
+			if roundTripper == nil {
+				roundTripper = defaultRedirectTransport
+			}
+		}
+	}
+
+	res, err := roundTripper.RoundTrip(req)
+	if err != nil || res == nil || res.Body == nil || r.MaxResponseSize <= 0 {
+		return res, err
+	}
+
+	res.Body = &limitedBody{ReadCloser: res.Body, remaining: r.MaxResponseSize}
+	return res, nil
+}
+
+func (r GuardingRoundTripper) schemeAllowed(scheme string) bool {
+	allowed := r.AllowedSchemes
+	if len(allowed) == 0 {
+		allowed = []string{"https", "http"}
+	}
+
+	for _, s := range allowed {
+		if s == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+// originalRequest returns the first request of the chain of redirects the request is part of.
+func originalRequest(req *http.Request) *http.Request {
+	for req.Response != nil && req.Response.Request != nil {
+		req = req.Response.Request
+	}
+	return req
+}
+
+// RefusingInternalAddresses returns a clone of the transport that refuses to connect to private, loopback or
+// link-local addresses. The address is checked when connecting, i.e. it is the address the host actually resolved
+// to, so that the host cannot resolve to a public address when checked and to an internal one when connected (DNS
+// rebinding). The returned transport doesn't use any proxy because the proxy would connect to the host instead.
+func RefusingInternalAddresses(transport *http.Transport) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return fmt.Errorf("failed to parse the address %s: %w", address, err)
+			}
+			if ip := net.ParseIP(host); ip == nil || isInternal(ip) {
+				return fmt.Errorf("%w: %s is an internal address", ErrRedirectNotAllowed, host)
+			}
+			return nil
+		},
+	}
+
+	guarded := transport.Clone()
+	guarded.Proxy = nil
+	guarded.DialContext = dialer.DialContext
+	// the custom dial functions would bypass the dialer
+	guarded.Dial = nil
+	guarded.DialTLS = nil
+	guarded.DialTLSContext = nil
+	return guarded
+}
+
+// isInternal checks whether the IP address is not publicly routable.
+func isInternal(ip net.IP) bool {
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified()
+}
+
+// limitedBody fails the reads once more than the remaining bytes are read.
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, ErrResponseTooLarge
+	}
+
+	// read one byte more than remaining to find out whether the body exceeds the limit
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n + int(b.remaining), ErrResponseTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,141 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httptransport
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGuardingRoundTripper_RoundTrip(t *testing.T) {
+	// every request to /redirect is redirected to the URL in the "to" query parameter
+	serve := func(r *http.Request) (*http.Response, error) {
+		if r.URL.Path == "/redirect" {
+			return &http.Response{
+				StatusCode: http.StatusFound,
+				Header:     http.Header{"Location": []string{r.URL.Query().Get("to")}},
+				Body:       io.NopCloser(strings.NewReader("")),
+				Request:    r,
+			}, nil
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader("0123456789")),
+			Request:    r,
+		}, nil
+	}
+
+	var direct, redirected []string
+	cl := &http.Client{Transport: GuardingRoundTripper{
+		RoundTripper: util.FakeRoundTrip(func(r *http.Request) (*http.Response, error) {
+			direct = append(direct, r.URL.Host)
+			return serve(r)
+		}),
+		RedirectRoundTripper: util.FakeRoundTrip(func(r *http.Request) (*http.Response, error) {
+			redirected = append(redirected, r.URL.Host)
+			return serve(r)
+		}),
+		MaxResponseSize: 10,
+	}}
+
+	get := func(url string) error {
+		direct, redirected = nil, nil
+		res, err := cl.Get(url)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		_, err = io.ReadAll(res.Body)
+		return err
+	}
+
+	t.Run("plain request", func(t *testing.T) {
+		assert.NoError(t, get("http://internal.acme.com/api"))
+		assert.Equal(t, []string{"internal.acme.com"}, direct)
+		assert.Empty(t, redirected)
+	})
+
+	t.Run("scheme not allowed", func(t *testing.T) {
+		assert.ErrorIs(t, get("ftp://github.com/api"), ErrSchemeNotAllowed)
+	})
+
+	t.Run("redirect within the host", func(t *testing.T) {
+		assert.NoError(t, get("http://internal.acme.com/redirect?to=/api"))
+		assert.Equal(t, []string{"internal.acme.com", "internal.acme.com"}, direct)
+		assert.Empty(t, redirected)
+	})
+
+	t.Run("redirect to other host", func(t *testing.T) {
+		assert.NoError(t, get("https://acme.com/redirect?to=https://github.com/redirect?to=/api"))
+		assert.Equal(t, []string{"acme.com"}, direct)
+		assert.Equal(t, []string{"github.com", "github.com"}, redirected)
+	})
+
+	t.Run("redirect downgrading https", func(t *testing.T) {
+		assert.ErrorIs(t, get("https://github.com/redirect?to=http://github.com/api"), ErrRedirectNotAllowed)
+	})
+
+	t.Run("response too large", func(t *testing.T) {
+		cl.Transport = GuardingRoundTripper{
+			RoundTripper:    cl.Transport.(GuardingRoundTripper).RoundTripper,
+			MaxResponseSize: 9,
+		}
+		assert.ErrorIs(t, get("https://github.com/api"), ErrResponseTooLarge)
+	})
+}
+
+func TestRefusingInternalAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	res, err := (&http.Client{Transport: http.DefaultTransport}).Get(srv.URL)
+	assert.NoError(t, err)
+	assert.NoError(t, res.Body.Close())
+
+	// the test server listens on the loopback
+	_, err = (&http.Client{Transport: RefusingInternalAddresses(http.DefaultTransport.(*http.Transport))}).Get(srv.URL)
+	assert.ErrorIs(t, err, ErrRedirectNotAllowed)
+}
+
+func TestIsInternal(t *testing.T) {
+	for _, ip := range []string{"10.0.0.1", "172.16.0.1", "192.168.1.1", "127.0.0.1", "169.254.169.254", "::1", "fe80::1", "fd00::1", "0.0.0.0"} {
+		assert.True(t, isInternal(net.ParseIP(ip)), ip)
+	}
+	for _, ip := range []string{"140.82.121.4", "8.8.8.8", "2606:4700::1111"} {
+		assert.False(t, isInternal(net.ParseIP(ip)), ip)
+	}
+}
+
+func TestLimitedBody(t *testing.T) {
+	read := func(body string, limit int64) (string, error) {
+		data, err := io.ReadAll(&limitedBody{ReadCloser: io.NopCloser(strings.NewReader(body)), remaining: limit})
+		return string(data), err
+	}
+
+	data, err := read("0123456789", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, "0123456789", data)
+
+	data, err = read("0123456789a", 10)
+	assert.ErrorIs(t, err, ErrResponseTooLarge)
+	assert.Equal(t, "0123456789", data)
+}
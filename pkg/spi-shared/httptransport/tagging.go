@@ -0,0 +1,73 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httptransport
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+type initiatorContextKeyType struct{}
+
+var initiatorContextKey = initiatorContextKeyType{}
+
+// WithInitiator inserts the description of the object the requests are made for (e.g. "SPIAccessToken ns/name") into
+// the returned context. The requests made with this context by a client having the TaggingRoundTripper as its
+// transport are tagged with it.
+func WithInitiator(ctx context.Context, initiator string) context.Context {
+	return context.WithValue(ctx, initiatorContextKey, initiator)
+}
+
+// UserAgent returns the default User-Agent of the requests made by the operator of the provided version running in
+// the cluster with the provided id, which is omitted if empty.
+func UserAgent(version string, clusterId string) string {
+	ua := fmt.Sprintf("service-provider-integration-operator/%s", version)
+	if clusterId != "" {
+		ua += fmt.Sprintf(" (cluster %s)", clusterId)
+	}
+	return ua
+}
+
+// TaggingRoundTripper is a wrapper around an HTTP round tripper that sets the User-Agent of the requests and tags
+// them with the initiator from the context (if any) in the TagHeader, so that the service providers can attribute
+// the requests to the operator and to the objects they were made for.
+type TaggingRoundTripper struct {
+	http.RoundTripper
+	// UserAgent replaces the User-Agent of the requests if not empty.
+	UserAgent string
+	// TagHeader is the name of the header the initiator is put in. The requests are not tagged if empty.
+	TagHeader string
+}
+
+var _ http.RoundTripper = (*TaggingRoundTripper)(nil)
+
+func (r TaggingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	initiator, _ := req.Context().Value(initiatorContextKey).(string)
+	tag := r.TagHeader != "" && initiator != ""
+
+	if r.UserAgent != "" || tag {
+		// the round trippers must not modify the request
+		req = req.Clone(req.Context())
+		if r.UserAgent != "" {
+			req.Header.Set("User-Agent", r.UserAgent)
+		}
+		if tag {
+			req.Header.Set(r.TagHeader, initiator)
+		}
+	}
+
+	return r.RoundTripper.RoundTrip(req)
+}
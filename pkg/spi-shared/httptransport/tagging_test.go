@@ -0,0 +1,75 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httptransport
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserAgent(t *testing.T) {
+	assert.Equal(t, "service-provider-integration-operator/1.0.0", UserAgent("1.0.0", ""))
+	assert.Equal(t, "service-provider-integration-operator/1.0.0 (cluster prod-1)", UserAgent("1.0.0", "prod-1"))
+}
+
+func TestTaggingRoundTripper_RoundTrip(t *testing.T) {
+	var seen http.Header
+	tr := TaggingRoundTripper{
+		RoundTripper: util.FakeRoundTrip(func(r *http.Request) (*http.Response, error) {
+			seen = r.Header
+			return nil, nil
+		}),
+		UserAgent: "spi/1.0.0",
+		TagHeader: "X-SPI-Initiator",
+	}
+
+	t.Run("tags the requests with the initiator", func(t *testing.T) {
+		req, err := http.NewRequestWithContext(WithInitiator(context.TODO(), "SPIAccessToken ns/token"), "GET", "https://over.the.rainbow", nil)
+		assert.NoError(t, err)
+		req.Header.Set("User-Agent", "go-github")
+
+		_, _ = tr.RoundTrip(req)
+
+		assert.Equal(t, "spi/1.0.0", seen.Get("User-Agent"))
+		assert.Equal(t, "SPIAccessToken ns/token", seen.Get("X-SPI-Initiator"))
+		// the original request is left intact
+		assert.Equal(t, "go-github", req.Header.Get("User-Agent"))
+	})
+
+	t.Run("no initiator", func(t *testing.T) {
+		req, err := http.NewRequestWithContext(context.TODO(), "GET", "https://over.the.rainbow", nil)
+		assert.NoError(t, err)
+
+		_, _ = tr.RoundTrip(req)
+
+		assert.Equal(t, "spi/1.0.0", seen.Get("User-Agent"))
+		assert.Empty(t, seen.Get("X-SPI-Initiator"))
+	})
+
+	t.Run("no tag header", func(t *testing.T) {
+		untagged := tr
+		untagged.TagHeader = ""
+		req, err := http.NewRequestWithContext(WithInitiator(context.TODO(), "SPIAccessToken ns/token"), "GET", "https://over.the.rainbow", nil)
+		assert.NoError(t, err)
+
+		_, _ = untagged.RoundTrip(req)
+
+		assert.Empty(t, seen.Get("X-SPI-Initiator"))
+	})
+}
@@ -0,0 +1,35 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httptransport
+
+import "net/http"
+
+// WithTransport returns the chain of the round trippers of this package with the innermost round tripper replaced
+// by the provided transport, e.g. a transport trusting other certificates. The configuration of the round trippers in
+// the chain is kept and the GuardingRoundTripper is given the transport refusing the internal addresses for
+// the redirects to other hosts. The transport itself is returned if the round tripper is not from this package.
+func WithTransport(roundTripper http.RoundTripper, transport *http.Transport) http.RoundTripper {
+	switch rt := roundTripper.(type) {
+	case TaggingRoundTripper:
+		rt.RoundTripper = WithTransport(rt.RoundTripper, transport)
+		return rt
+	case GuardingRoundTripper:
+		rt.RoundTripper = WithTransport(rt.RoundTripper, transport)
+		rt.RedirectRoundTripper = RefusingInternalAddresses(transport)
+		return rt
+	default:
+		return transport
+	}
+}
@@ -0,0 +1,48 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httptransport
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithTransport(t *testing.T) {
+	transport := &http.Transport{}
+
+	t.Run("keeps the chain", func(t *testing.T) {
+		rt := WithTransport(TaggingRoundTripper{
+			RoundTripper: GuardingRoundTripper{RoundTripper: http.DefaultTransport, MaxResponseSize: 42},
+			UserAgent:    "spi",
+		}, transport)
+
+		tagging, ok := rt.(TaggingRoundTripper)
+		assert.True(t, ok)
+		assert.Equal(t, "spi", tagging.UserAgent)
+
+		guarding, ok := tagging.RoundTripper.(GuardingRoundTripper)
+		assert.True(t, ok)
+		assert.Equal(t, int64(42), guarding.MaxResponseSize)
+		assert.Same(t, transport, guarding.RoundTripper)
+		assert.NotNil(t, guarding.RedirectRoundTripper)
+	})
+
+	t.Run("replaces unknown round tripper", func(t *testing.T) {
+		assert.Same(t, transport, WithTransport(http.DefaultTransport, transport))
+		assert.Same(t, transport, WithTransport(nil, transport))
+	})
+}
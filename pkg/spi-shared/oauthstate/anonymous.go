@@ -15,6 +15,7 @@ package oauthstate
 
 import (
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
@@ -47,8 +48,21 @@ type AnonymousOAuthState struct {
 	ServiceProviderUrl string `json:"serviceProviderUrl"`
 }
 
+// ClockSkewError is returned by the validation of the states issued further in the future than the clock skew
+// tolerance, which means that the clocks of the operator and of the OAuth service are out of sync.
+type ClockSkewError struct {
+	// Skew is how far in the future the state was issued.
+	Skew time.Duration
+	// Tolerance is the clock skew tolerated by the validation.
+	Tolerance time.Duration
+}
+
+func (e *ClockSkewError) Error() string {
+	return fmt.Sprintf("request from the future: the state was issued %s ahead of the local clock, which is more than the clock skew tolerance of %s, check the clock synchronization of the operator and the OAuth service", e.Skew, e.Tolerance)
+}
+
 // ParseAnonymous parses the state from the URL query parameter and returns the anonymous state struct. It also validates
-// the struct using AnonymousOAuthState.Validate method.
+// the struct like AnonymousOAuthState.Validate does, tolerating the clock skew of the codec.
 func (s *Codec) ParseAnonymous(state string) (AnonymousOAuthState, error) {
 	parsedState := AnonymousOAuthState{}
 	err := s.ParseInto(state, &parsedState)
@@ -56,13 +70,31 @@ func (s *Codec) ParseAnonymous(state string) (AnonymousOAuthState, error) {
 		return parsedState, err
 	}
 
-	return parsedState, parsedState.Validate()
+	return parsedState, parsedState.validate(time.Now(), s.ClockSkewTolerance)
 }
 
-// Validate validates that IssuedAt is in the past.
+// Validate validates that IssuedAt is in the past. No clock skew is tolerated, see ValidateWithClockSkew.
 func (s AnonymousOAuthState) Validate() error {
-	if time.Now().Unix() < s.IssuedAt {
-		return fmt.Errorf("request from the future")
+	return s.validate(time.Now(), 0)
+}
+
+// ValidateWithClockSkew validates that IssuedAt is not further in the future than the tolerance. The states issued in
+// the future fail with the ClockSkewError.
+func (s AnonymousOAuthState) ValidateWithClockSkew(tolerance time.Duration) error {
+	return s.validate(time.Now(), tolerance)
+}
+
+// validate validates the state as if it was received at the provided time.
+func (s AnonymousOAuthState) validate(now time.Time, tolerance time.Duration) error {
+	skew := time.Unix(s.IssuedAt, 0).Sub(now.Truncate(time.Second))
+	if skew <= 0 {
+		return nil
+	}
+
+	tolerated := skew <= tolerance
+	clockSkewHistogram.WithLabelValues(strconv.FormatBool(tolerated)).Observe(skew.Seconds())
+	if !tolerated {
+		return &ClockSkewError{Skew: skew, Tolerance: tolerance}
 	}
 	return nil
 }
@@ -14,6 +14,12 @@
 package oauthstate
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
 	"github.com/go-jose/go-jose/v3"
 	"github.com/go-jose/go-jose/v3/jwt"
 )
@@ -22,28 +28,77 @@ import (
 type Codec struct {
 	Signer        jose.Signer
 	SigningSecret []byte
+	// PreviousSecrets are the secrets the states could have been signed with before the signing secret was rotated.
+	// The states signed with them are still accepted, but no new states are signed with them.
+	PreviousSecrets [][]byte
+	// Transit is the Vault transit key the states are signed with instead of the SigningSecret, if set.
+	Transit *VaultTransit
+	// ClockSkewTolerance is how far in the future the parsed states can be issued and still be valid.
+	ClockSkewTolerance time.Duration
 }
 
+// errInvalidSignature is returned when the state is not signed by any of the secrets of the codec.
+var errInvalidSignature = errors.New("the state is not signed by any of the known secrets")
+
+// signingAlgorithm is the algorithm used to sign the state. HMAC-SHA256 is FIPS-approved, so the codec can be used in
+// the FIPS mode.
+const signingAlgorithm = jose.HS256
+
 // NewCodec creates a new codec using the secret used for signing the JWT tokens that represent the state in the
 // query parameters. The signing is used to make it harder to forge malicious OAuth flow requests. We don't need to
 // encrypt the state strings, because they don't contain any information that would not be obtainable from the requests
 // initiating the OAuth flow.
-func NewCodec(signingSecret []byte) (Codec, error) {
+//
+// The previous secrets are used to support the rotation of the signing secret. The states carry the ID of the secret
+// they were signed with (see KeyId) so that the states signed before the rotation can be verified using the right
+// previous secret until they're no longer used.
+func NewCodec(signingSecret []byte, previousSecrets ...[]byte) (Codec, error) {
 	signer, err := jose.NewSigner(jose.SigningKey{
-		Algorithm: jose.HS256,
+		Algorithm: signingAlgorithm,
 		Key:       signingSecret,
+	}, (&jose.SignerOptions{}).WithType("SPI").WithHeader("kid", KeyId(signingSecret)))
+	if err != nil {
+		return Codec{}, err
+	}
+
+	return Codec{
+		Signer:          signer,
+		SigningSecret:   signingSecret,
+		PreviousSecrets: previousSecrets,
+	}, nil
+}
+
+// NewVaultTransitCodec creates a new codec signing the states using the key in the Vault transit secrets engine
+// instead of a secret known to the process. The previous secrets are the in-process secrets the states could have been
+// signed with before switching to the transit key. Their states are still accepted, but no new states are signed with
+// them.
+func NewVaultTransitCodec(transit *VaultTransit, previousSecrets ...[]byte) (Codec, error) {
+	signer, err := jose.NewSigner(jose.SigningKey{
+		Algorithm: signingAlgorithm,
+		Key:       transit,
 	}, (&jose.SignerOptions{}).WithType("SPI"))
 	if err != nil {
 		return Codec{}, err
 	}
 
 	return Codec{
-		Signer:        signer,
-		SigningSecret: signingSecret,
+		Signer:          signer,
+		PreviousSecrets: previousSecrets,
+		Transit:         transit,
 	}, nil
 }
 
-// ParseInto tries to parse the provided state into the dest object. Note that no validation is done on the parsed
+// KeyId returns the ID of the signing secret put in the "kid" header of the signed states. It is derived from
+// the secret, so that the secrets don't need to be given IDs explicitly, but doesn't reveal it.
+func KeyId(secret []byte) string {
+	sum := sha256.Sum256(append([]byte("spi-oauth-state-key-id:"), secret...))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ParseInto tries to parse the provided state into the dest object. Only the states signed using the algorithm
+// the codec signs with and by the signing secret or one of the previous secrets are accepted. The states without
+// the key ID (signed before the key IDs were introduced) are verified against all the secrets. The states carrying
+// the key ID of the Vault transit key of the codec are verified by Vault. Note that no validation is done on the parsed
 // object.
 func (s *Codec) ParseInto(state string, dest interface{}) error {
 	token, err := jwt.ParseSigned(state)
@@ -51,7 +106,44 @@ func (s *Codec) ParseInto(state string, dest interface{}) error {
 		return err
 	}
 
-	return token.Claims(s.SigningSecret, dest)
+	keyId := ""
+	for _, h := range token.Headers {
+		if h.Algorithm != string(signingAlgorithm) {
+			return fmt.Errorf("unsupported state signing algorithm '%s'", h.Algorithm)
+		}
+		keyId = h.KeyID
+	}
+
+	if s.Transit != nil && keyId == s.Transit.KeyId() {
+		if err = token.Claims(s.Transit, dest); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	for _, secret := range s.secrets() {
+		if keyId != "" && keyId != KeyId(secret) {
+			continue
+		}
+
+		if err = token.Claims(secret, dest); err == nil {
+			return nil
+		}
+	}
+
+	return errInvalidSignature
+}
+
+// secrets returns all the secrets the states can be signed with, the signing secret first. The empty secrets are
+// left out, because anyone could sign the states with them.
+func (s *Codec) secrets() [][]byte {
+	ret := make([][]byte, 0, len(s.PreviousSecrets)+1)
+	for _, secret := range append([][]byte{s.SigningSecret}, s.PreviousSecrets...) {
+		if len(secret) > 0 {
+			ret = append(ret, secret)
+		}
+	}
+	return ret
 }
 
 // Encode encodes the provided state as a signed JWT token
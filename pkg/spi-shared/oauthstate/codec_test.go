@@ -18,8 +18,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
 	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
 	"github.com/stretchr/testify/assert"
+	authv1 "k8s.io/api/authentication/v1"
 )
 
 func TestAnonymous(t *testing.T) {
@@ -63,6 +66,39 @@ func TestAnonymous(t *testing.T) {
 	})
 }
 
+func TestEnriched(t *testing.T) {
+	codec := getCodec(t)
+
+	t.Run("valid", func(t *testing.T) {
+		encoded, err := codec.Encode(&EnrichedOAuthState{
+			AnonymousOAuthState: AnonymousOAuthState{
+				TokenName:           "token-name",
+				TokenNamespace:      "default",
+				ServiceProviderType: "sp type",
+				ServiceProviderUrl:  "https://sp",
+			},
+			KubernetesIdentity: authv1.UserInfo{Username: "alois", Groups: []string{"team-a"}},
+		})
+		assert.NoError(t, err)
+
+		decoded, err := codec.ParseEnriched(encoded)
+		assert.NoError(t, err)
+
+		assert.Equal(t, "token-name", decoded.TokenName)
+		assert.Equal(t, "https://sp", decoded.ServiceProviderUrl)
+		assert.Equal(t, "alois", decoded.KubernetesIdentity.Username)
+		assert.Equal(t, []string{"team-a"}, decoded.KubernetesIdentity.Groups)
+	})
+
+	t.Run("anonymous", func(t *testing.T) {
+		encoded, err := codec.Encode(&AnonymousOAuthState{TokenName: "token-name", TokenNamespace: "default"})
+		assert.NoError(t, err)
+
+		_, err = codec.ParseEnriched(encoded)
+		assert.Error(t, err)
+	})
+}
+
 func TestCustom(t *testing.T) {
 	codec := getCodec(t)
 
@@ -98,6 +134,126 @@ func TestCustom(t *testing.T) {
 	})
 }
 
+func TestParseIntoRejectsOtherAlgorithms(t *testing.T) {
+	codec := getCodec(t)
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS512, Key: []byte("secret")}, nil)
+	assert.NoError(t, err)
+	encoded, err := jwt.Signed(signer).Claims(&AnonymousOAuthState{TokenName: "token-name"}).CompactSerialize()
+	assert.NoError(t, err)
+
+	_, err = codec.ParseAnonymous(encoded)
+	assert.EqualError(t, err, "unsupported state signing algorithm 'HS512'")
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldCodec, err := NewCodec([]byte("old"))
+	assert.NoError(t, err)
+	rotatedCodec, err := NewCodec([]byte("new"), []byte("older"), []byte("old"))
+	assert.NoError(t, err)
+
+	t.Run("new states signed with the new secret", func(t *testing.T) {
+		encoded, err := rotatedCodec.Encode(&AnonymousOAuthState{TokenName: "token-name"})
+		assert.NoError(t, err)
+
+		token, err := jwt.ParseSigned(encoded)
+		assert.NoError(t, err)
+		assert.Equal(t, KeyId([]byte("new")), token.Headers[0].KeyID)
+
+		decoded, err := rotatedCodec.ParseAnonymous(encoded)
+		assert.NoError(t, err)
+		assert.Equal(t, "token-name", decoded.TokenName)
+
+		_, err = oldCodec.ParseAnonymous(encoded)
+		assert.Error(t, err)
+	})
+
+	t.Run("old states accepted", func(t *testing.T) {
+		encoded, err := oldCodec.Encode(&AnonymousOAuthState{TokenName: "token-name"})
+		assert.NoError(t, err)
+
+		decoded, err := rotatedCodec.ParseAnonymous(encoded)
+		assert.NoError(t, err)
+		assert.Equal(t, "token-name", decoded.TokenName)
+	})
+
+	t.Run("states without key id accepted", func(t *testing.T) {
+		signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: []byte("old")}, nil)
+		assert.NoError(t, err)
+		encoded, err := jwt.Signed(signer).Claims(&AnonymousOAuthState{TokenName: "token-name"}).CompactSerialize()
+		assert.NoError(t, err)
+
+		decoded, err := rotatedCodec.ParseAnonymous(encoded)
+		assert.NoError(t, err)
+		assert.Equal(t, "token-name", decoded.TokenName)
+	})
+
+	t.Run("states signed by unknown secret rejected", func(t *testing.T) {
+		unknownCodec, err := NewCodec([]byte("unknown"))
+		assert.NoError(t, err)
+		encoded, err := unknownCodec.Encode(&AnonymousOAuthState{TokenName: "token-name"})
+		assert.NoError(t, err)
+
+		_, err = rotatedCodec.ParseAnonymous(encoded)
+		assert.Error(t, err)
+	})
+
+	t.Run("states signed by empty secret rejected", func(t *testing.T) {
+		signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: []byte{}}, nil)
+		assert.NoError(t, err)
+		encoded, err := jwt.Signed(signer).Claims(&AnonymousOAuthState{TokenName: "token-name"}).CompactSerialize()
+		assert.NoError(t, err)
+
+		_, err = (&Codec{PreviousSecrets: [][]byte{[]byte("old")}}).ParseAnonymous(encoded)
+		assert.Error(t, err)
+	})
+}
+
+func TestClockSkewTolerance(t *testing.T) {
+	codec := getCodec(t)
+	codec.ClockSkewTolerance = time.Minute
+
+	encode := func(issuedAt time.Time) string {
+		encoded, err := codec.Encode(&EnrichedOAuthState{
+			AnonymousOAuthState: AnonymousOAuthState{TokenName: "token-name", IssuedAt: issuedAt.Unix()},
+			KubernetesIdentity:  authv1.UserInfo{Username: "alice"},
+		})
+		assert.NoError(t, err)
+		return encoded
+	}
+
+	t.Run("tolerated skew", func(t *testing.T) {
+		encoded := encode(time.Now().Add(30 * time.Second))
+
+		_, err := codec.ParseAnonymous(encoded)
+		assert.NoError(t, err)
+		_, err = codec.ParseEnriched(encoded)
+		assert.NoError(t, err)
+	})
+
+	t.Run("skew beyond tolerance", func(t *testing.T) {
+		encoded := encode(time.Now().Add(5 * time.Minute))
+
+		_, err := codec.ParseEnriched(encoded)
+		skewErr := &ClockSkewError{}
+		assert.ErrorAs(t, err, &skewErr)
+		assert.Equal(t, time.Minute, skewErr.Tolerance)
+		assert.InDelta(t, (5 * time.Minute).Seconds(), skewErr.Skew.Seconds(), 2)
+		assert.Contains(t, err.Error(), "clock skew tolerance of 1m0s")
+	})
+
+	t.Run("no tolerance by default", func(t *testing.T) {
+		state := AnonymousOAuthState{IssuedAt: time.Now().Add(30 * time.Second).Unix()}
+		assert.Error(t, state.Validate())
+		assert.NoError(t, state.ValidateWithClockSkew(time.Minute))
+	})
+
+	t.Run("enriched validation requires identity", func(t *testing.T) {
+		state := EnrichedOAuthState{AnonymousOAuthState: AnonymousOAuthState{IssuedAt: time.Now().Unix()}}
+		assert.Error(t, state.ValidateWithClockSkew(time.Minute))
+	})
+}
+
 func getCodec(t *testing.T) Codec {
 	ret, err := NewCodec([]byte("secret"))
 	assert.NoError(t, err)
@@ -0,0 +1,64 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauthstate
+
+import (
+	"fmt"
+	"time"
+
+	authv1 "k8s.io/api/authentication/v1"
+)
+
+// EnrichedOAuthState is the AnonymousOAuthState enriched by the OAuth service with the Kubernetes identity of the user
+// that accessed the OAuth URL. Once the OAuth flow completes, the OAuth service records the user as the owner of
+// the token in the api.TokenOwnerAnnotation of the SPIAccessToken.
+type EnrichedOAuthState struct {
+	AnonymousOAuthState
+	// KubernetesIdentity is the identity of the user that initiated the OAuth flow.
+	KubernetesIdentity authv1.UserInfo `json:"kubernetesIdentity"`
+}
+
+// ParseEnriched parses the state from the URL query parameter and returns the enriched state struct. It also validates
+// the struct like EnrichedOAuthState.Validate does, tolerating the clock skew of the codec.
+func (s *Codec) ParseEnriched(state string) (EnrichedOAuthState, error) {
+	parsedState := EnrichedOAuthState{}
+	err := s.ParseInto(state, &parsedState)
+	if err != nil {
+		return parsedState, err
+	}
+
+	return parsedState, parsedState.validate(time.Now(), s.ClockSkewTolerance)
+}
+
+// Validate validates the anonymous part of the state and that the identity of the user is known. No clock skew is
+// tolerated, see ValidateWithClockSkew.
+func (s EnrichedOAuthState) Validate() error {
+	return s.validate(time.Now(), 0)
+}
+
+// ValidateWithClockSkew is like Validate but tolerates the states issued at most the tolerance in the future.
+func (s EnrichedOAuthState) ValidateWithClockSkew(tolerance time.Duration) error {
+	return s.validate(time.Now(), tolerance)
+}
+
+func (s EnrichedOAuthState) validate(now time.Time, tolerance time.Duration) error {
+	if err := s.AnonymousOAuthState.validate(now, tolerance); err != nil {
+		return err
+	}
+	if s.KubernetesIdentity.Username == "" {
+		return fmt.Errorf("the identity of the user is missing")
+	}
+	return nil
+}
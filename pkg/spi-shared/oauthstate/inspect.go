@@ -0,0 +1,160 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauthstate
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+)
+
+// StateKind is the kind of the OAuth state.
+type StateKind string
+
+const (
+	// StateKindAnonymous is the kind of the states generated by the operator, see AnonymousOAuthState.
+	StateKindAnonymous StateKind = "anonymous"
+	// StateKindEnriched is the kind of the states enriched with the identity of the user by the OAuth service, see
+	// EnrichedOAuthState.
+	StateKindEnriched StateKind = "enriched"
+)
+
+// Inspection is the result of the inspection of an OAuth state, meant for debugging the OAuth flows. Unlike parsing,
+// the inspection also decodes the states that are not valid, so that it's possible to see why they're rejected.
+type Inspection struct {
+	// Algorithm is the algorithm the state claims to be signed with.
+	Algorithm string `json:"algorithm"`
+	// KeyId is the ID of the key the state claims to be signed with. Empty for the states signed before the key IDs
+	// were introduced.
+	KeyId string `json:"keyId,omitempty"`
+	// Key describes which of the keys of the codec the KeyId belongs to.
+	Key string `json:"key"`
+	// SignatureValid is true if the state is signed by one of the keys of the codec.
+	SignatureValid bool `json:"signatureValid"`
+	// SignatureError is the reason the signature is not valid.
+	SignatureError string `json:"signatureError,omitempty"`
+	// Kind is the kind of the state, i.e. whether it has already been enriched with the identity of the user.
+	Kind StateKind `json:"kind"`
+	// State is the decoded state. The KubernetesIdentity is empty for the anonymous states.
+	State EnrichedOAuthState `json:"state"`
+	// IssuedAt is the time the state was generated, if known.
+	IssuedAt *time.Time `json:"issuedAt,omitempty"`
+	// Age is how long ago the state was generated, if known.
+	Age string `json:"age,omitempty"`
+	// ExpiresAt is the time the state is no longer accepted, if a maximum age is provided and the issue time is known.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// ValidationErrors are the reasons the decoded state is not valid.
+	ValidationErrors []string `json:"validationErrors,omitempty"`
+	// Valid is true if the signature of the state is valid and the state passes the validation.
+	Valid bool `json:"valid"`
+}
+
+// Inspect decodes the state and validates it as if it was received at the provided time. The states older than
+// the maximum age are reported as expired, unless the maximum age is zero. An error is only returned if the state
+// cannot be decoded at all.
+func (s *Codec) Inspect(state string, now time.Time, maxAge time.Duration) (Inspection, error) {
+	token, err := jwt.ParseSigned(state)
+	if err != nil {
+		return Inspection{}, fmt.Errorf("the state is not a signed JWT: %w", err)
+	}
+
+	ret := Inspection{}
+	for _, h := range token.Headers {
+		ret.Algorithm = h.Algorithm
+		ret.KeyId = h.KeyID
+	}
+	ret.Key = s.describeKey(ret.KeyId)
+
+	if err := token.UnsafeClaimsWithoutVerification(&ret.State); err != nil {
+		return Inspection{}, fmt.Errorf("failed to decode the state: %w", err)
+	}
+
+	if err := s.ParseInto(state, &EnrichedOAuthState{}); err != nil {
+		ret.SignatureError = err.Error()
+	} else {
+		ret.SignatureValid = true
+	}
+
+	ret.Kind = StateKindAnonymous
+	if ret.State.KubernetesIdentity.Username != "" {
+		ret.Kind = StateKindEnriched
+	}
+
+	if err := ret.State.AnonymousOAuthState.validate(now, s.ClockSkewTolerance); err != nil {
+		ret.ValidationErrors = append(ret.ValidationErrors, err.Error())
+	}
+
+	if ret.State.IssuedAt != 0 {
+		issuedAt := time.Unix(ret.State.IssuedAt, 0).UTC()
+		ret.IssuedAt = &issuedAt
+		ret.Age = now.Sub(issuedAt).Truncate(time.Second).String()
+
+		if maxAge > 0 {
+			expiresAt := issuedAt.Add(maxAge)
+			ret.ExpiresAt = &expiresAt
+			if !now.Before(expiresAt) {
+				ret.ValidationErrors = append(ret.ValidationErrors, fmt.Sprintf("the state expired %s ago", now.Sub(expiresAt).Truncate(time.Second)))
+			}
+		}
+	}
+
+	if ret.State.TokenName == "" || ret.State.TokenNamespace == "" {
+		ret.ValidationErrors = append(ret.ValidationErrors, "the state doesn't identify the token")
+	}
+
+	ret.Valid = ret.SignatureValid && len(ret.ValidationErrors) == 0
+	return ret, nil
+}
+
+// describeKey returns the human-readable description of the key with the provided ID.
+func (s *Codec) describeKey(keyId string) string {
+	switch {
+	case keyId == "":
+		return "none, the state is verified against all the secrets"
+	case s.Transit != nil && keyId == s.Transit.KeyId():
+		return "the Vault transit key " + s.Transit.mount() + "/" + s.Transit.Key
+	case len(s.SigningSecret) > 0 && keyId == KeyId(s.SigningSecret):
+		return "the current shared secret"
+	}
+
+	for i, secret := range s.PreviousSecrets {
+		if len(secret) > 0 && keyId == KeyId(secret) {
+			return fmt.Sprintf("the previous shared secret #%d", i+1)
+		}
+	}
+
+	return "unknown"
+}
+
+// NewCodecFromConfiguration creates the codec accepting the states signed by any of the keys in the configuration,
+// i.e. the Vault transit key (if not nil), the shared secret and the previous shared secrets, and tolerating
+// the configured clock skew. The new states are signed using the transit key, if provided, or using the shared secret.
+func NewCodecFromConfiguration(cfg config.Configuration, transit *VaultTransit) (Codec, error) {
+	var codec Codec
+	var err error
+	if transit != nil {
+		codec, err = NewVaultTransitCodec(transit, append([][]byte{cfg.SharedSecret}, cfg.PreviousSharedSecrets...)...)
+	} else {
+		codec, err = NewCodec(cfg.SharedSecret, cfg.PreviousSharedSecrets...)
+	}
+	if err != nil {
+		return Codec{}, err
+	}
+
+	codec.ClockSkewTolerance = cfg.OAuthStateClockSkewTolerance
+	return codec, nil
+}
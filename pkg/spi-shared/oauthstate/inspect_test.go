@@ -0,0 +1,117 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauthstate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	authv1 "k8s.io/api/authentication/v1"
+)
+
+func TestInspect(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0).UTC()
+	codec, err := NewCodec([]byte("secret"), []byte("old"))
+	assert.NoError(t, err)
+
+	encode := func(t *testing.T, codec Codec, state interface{}) string {
+		encoded, err := codec.Encode(state)
+		assert.NoError(t, err)
+		return encoded
+	}
+
+	t.Run("valid anonymous", func(t *testing.T) {
+		inspection, err := codec.Inspect(encode(t, codec, &AnonymousOAuthState{
+			TokenName:      "token",
+			TokenNamespace: "ns",
+			IssuedAt:       now.Add(-90 * time.Second).Unix(),
+		}), now, time.Hour)
+		assert.NoError(t, err)
+
+		assert.True(t, inspection.Valid)
+		assert.True(t, inspection.SignatureValid)
+		assert.Equal(t, "HS256", inspection.Algorithm)
+		assert.Equal(t, KeyId([]byte("secret")), inspection.KeyId)
+		assert.Equal(t, "the current shared secret", inspection.Key)
+		assert.Equal(t, StateKindAnonymous, inspection.Kind)
+		assert.Equal(t, "token", inspection.State.TokenName)
+		assert.Equal(t, "1m30s", inspection.Age)
+		assert.Equal(t, now.Add(-90*time.Second), *inspection.IssuedAt)
+		assert.Equal(t, now.Add(time.Hour-90*time.Second), *inspection.ExpiresAt)
+		assert.Empty(t, inspection.ValidationErrors)
+	})
+
+	t.Run("enriched signed with previous secret", func(t *testing.T) {
+		oldCodec, err := NewCodec([]byte("old"))
+		assert.NoError(t, err)
+
+		inspection, err := codec.Inspect(encode(t, oldCodec, &EnrichedOAuthState{
+			AnonymousOAuthState: AnonymousOAuthState{TokenName: "token", TokenNamespace: "ns", IssuedAt: now.Unix()},
+			KubernetesIdentity:  authv1.UserInfo{Username: "alice"},
+		}), now, 0)
+		assert.NoError(t, err)
+
+		assert.True(t, inspection.Valid)
+		assert.Equal(t, "the previous shared secret #1", inspection.Key)
+		assert.Equal(t, StateKindEnriched, inspection.Kind)
+		assert.Equal(t, "alice", inspection.State.KubernetesIdentity.Username)
+		assert.Nil(t, inspection.ExpiresAt)
+	})
+
+	t.Run("expired and from the future", func(t *testing.T) {
+		inspection, err := codec.Inspect(encode(t, codec, &AnonymousOAuthState{
+			TokenName:      "token",
+			TokenNamespace: "ns",
+			IssuedAt:       now.Add(-2 * time.Hour).Unix(),
+		}), now, time.Hour)
+		assert.NoError(t, err)
+		assert.False(t, inspection.Valid)
+		assert.True(t, inspection.SignatureValid)
+		assert.Equal(t, []string{"the state expired 1h0m0s ago"}, inspection.ValidationErrors)
+
+		inspection, err = codec.Inspect(encode(t, codec, &AnonymousOAuthState{
+			TokenName:      "token",
+			TokenNamespace: "ns",
+			IssuedAt:       now.Add(time.Minute).Unix(),
+		}), now, time.Hour)
+		assert.NoError(t, err)
+		assert.False(t, inspection.Valid)
+		assert.Len(t, inspection.ValidationErrors, 1)
+		assert.Contains(t, inspection.ValidationErrors[0], "issued 1m0s ahead of the local clock")
+	})
+
+	t.Run("decodes states with invalid signature", func(t *testing.T) {
+		unknownCodec, err := NewCodec([]byte("unknown"))
+		assert.NoError(t, err)
+
+		inspection, err := codec.Inspect(encode(t, unknownCodec, &AnonymousOAuthState{
+			TokenName:      "token",
+			TokenNamespace: "ns",
+			IssuedAt:       now.Unix(),
+		}), now, time.Hour)
+		assert.NoError(t, err)
+		assert.False(t, inspection.Valid)
+		assert.False(t, inspection.SignatureValid)
+		assert.Equal(t, "unknown", inspection.Key)
+		assert.NotEmpty(t, inspection.SignatureError)
+		assert.Equal(t, "token", inspection.State.TokenName)
+	})
+
+	t.Run("garbage", func(t *testing.T) {
+		_, err := codec.Inspect("not a state", now, time.Hour)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,34 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauthstate
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// clockSkewHistogram measures how far in the future the validated states were issued, i.e. the clock skew between
+// the issuer and the validator of the states. The states rejected because of the skew exceeding the tolerance are
+// distinguished by the tolerated label, so that the administrators can alert on the clocks drifting apart before
+// the OAuth flows start failing.
+var clockSkewHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "spi_oauth_state_clock_skew_seconds",
+	Help:    "How far in the future the validated OAuth states were issued.",
+	Buckets: prometheus.ExponentialBuckets(1, 2, 10),
+}, []string{"tolerated"})
+
+func init() {
+	metrics.Registry.MustRegister(clockSkewHistogram)
+}
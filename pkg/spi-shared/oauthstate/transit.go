@@ -0,0 +1,116 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauthstate
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/go-jose/go-jose/v3"
+	vault "github.com/hashicorp/vault/api"
+)
+
+// defaultTransitMount is the mount path of the Vault transit secrets engine used if none is configured.
+const defaultTransitMount = "transit"
+
+// VaultTransit signs and verifies the states using a key in the Vault transit secrets engine, so that the key never
+// leaves Vault. Vault computes HMAC-SHA256 of the states, i.e. the same algorithm the codec uses with the in-process
+// secrets. The signature of a state is the HMAC as returned by Vault, including the version of the key, so that
+// the states stay verifiable after the key is rotated in Vault.
+type VaultTransit struct {
+	Client *vault.Client
+	// Mount is the mount path of the transit secrets engine. Defaults to "transit".
+	Mount string
+	// Key is the name of the key in the transit secrets engine.
+	Key string
+}
+
+var _ jose.OpaqueSigner = (*VaultTransit)(nil)
+var _ jose.OpaqueVerifier = (*VaultTransit)(nil)
+
+// KeyId returns the ID of the transit key put in the "kid" header of the signed states.
+func (t *VaultTransit) KeyId() string {
+	return "vault-transit:" + t.mount() + "/" + t.Key
+}
+
+// Public implements jose.OpaqueSigner. There's no public key to HMAC, only the key ID is provided.
+func (t *VaultTransit) Public() *jose.JSONWebKey {
+	return &jose.JSONWebKey{KeyID: t.KeyId(), Algorithm: string(signingAlgorithm)}
+}
+
+// Algs implements jose.OpaqueSigner.
+func (t *VaultTransit) Algs() []jose.SignatureAlgorithm {
+	return []jose.SignatureAlgorithm{signingAlgorithm}
+}
+
+// SignPayload implements jose.OpaqueSigner.
+func (t *VaultTransit) SignPayload(payload []byte, alg jose.SignatureAlgorithm) ([]byte, error) {
+	if alg != signingAlgorithm {
+		return nil, jose.ErrUnsupportedAlgorithm
+	}
+
+	s, err := t.Client.Logical().Write(t.path("hmac"), map[string]interface{}{
+		"input": base64.StdEncoding.EncodeToString(payload),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign the state using the Vault transit key %s: %w", t.Key, err)
+	}
+	if s == nil {
+		return nil, fmt.Errorf("no HMAC returned by the Vault transit key %s", t.Key)
+	}
+
+	hmac, ok := s.Data["hmac"].(string)
+	if !ok || hmac == "" {
+		return nil, fmt.Errorf("no HMAC returned by the Vault transit key %s", t.Key)
+	}
+
+	return []byte(hmac), nil
+}
+
+// VerifyPayload implements jose.OpaqueVerifier.
+func (t *VaultTransit) VerifyPayload(payload []byte, signature []byte, alg jose.SignatureAlgorithm) error {
+	if alg != signingAlgorithm {
+		return jose.ErrUnsupportedAlgorithm
+	}
+
+	s, err := t.Client.Logical().Write(t.path("verify"), map[string]interface{}{
+		"input": base64.StdEncoding.EncodeToString(payload),
+		"hmac":  string(signature),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to verify the state using the Vault transit key %s: %w", t.Key, err)
+	}
+
+	if s == nil {
+		return errInvalidSignature
+	}
+	if valid, ok := s.Data["valid"].(bool); !ok || !valid {
+		return errInvalidSignature
+	}
+
+	return nil
+}
+
+func (t *VaultTransit) mount() string {
+	if t.Mount == "" {
+		return defaultTransitMount
+	}
+	return t.Mount
+}
+
+// path returns the path of the operation with the key computing HMAC-SHA256.
+func (t *VaultTransit) path(operation string) string {
+	return t.mount() + "/" + operation + "/" + t.Key + "/sha2-256"
+}
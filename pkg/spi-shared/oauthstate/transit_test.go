@@ -0,0 +1,108 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauthstate
+
+import (
+	"testing"
+
+	"github.com/go-jose/go-jose/v3"
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/builtin/logical/transit"
+	vaulthttp "github.com/hashicorp/vault/http"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/hashicorp/vault/vault"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVaultTransit(t *testing.T) {
+	cluster := vault.NewTestCluster(t, &vault.CoreConfig{
+		LogicalBackends: map[string]logical.Factory{
+			"transit": transit.Factory,
+		},
+	}, &vault.TestClusterOptions{
+		HandlerFunc: vaulthttp.Handler,
+		NumCores:    1,
+	})
+	cluster.Start()
+	defer cluster.Cleanup()
+
+	client := cluster.Cores[0].Client
+	assert.NoError(t, client.Sys().Mount("spi-transit", &vaultapi.MountInput{Type: "transit"}))
+	_, err := client.Logical().Write("spi-transit/keys/spi-state", nil)
+	assert.NoError(t, err)
+
+	transitKey := &VaultTransit{Client: client, Mount: "spi-transit", Key: "spi-state"}
+	codec, err := NewVaultTransitCodec(transitKey, []byte("old secret"))
+	assert.NoError(t, err)
+
+	state := &AnonymousOAuthState{TokenName: "token", TokenNamespace: "default", ServiceProviderType: "sp type"}
+
+	t.Run("round trip", func(t *testing.T) {
+		encoded, err := codec.Encode(state)
+		assert.NoError(t, err)
+
+		decoded, err := codec.ParseAnonymous(encoded)
+		assert.NoError(t, err)
+		assert.Equal(t, *state, decoded)
+	})
+
+	t.Run("verifies after key rotation", func(t *testing.T) {
+		encoded, err := codec.Encode(state)
+		assert.NoError(t, err)
+
+		_, err = client.Logical().Write("spi-transit/keys/spi-state/rotate", nil)
+		assert.NoError(t, err)
+
+		_, err = codec.ParseAnonymous(encoded)
+		assert.NoError(t, err)
+	})
+
+	t.Run("accepts states signed with the previous secrets", func(t *testing.T) {
+		oldCodec, err := NewCodec([]byte("old secret"))
+		assert.NoError(t, err)
+		encoded, err := oldCodec.Encode(state)
+		assert.NoError(t, err)
+
+		_, err = codec.ParseAnonymous(encoded)
+		assert.NoError(t, err)
+	})
+
+	t.Run("rejects forged signatures", func(t *testing.T) {
+		// the state claims to be signed by the transit key but is signed with an empty secret
+		forger, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: []byte{}},
+			(&jose.SignerOptions{}).WithType("SPI").WithHeader("kid", transitKey.KeyId()))
+		assert.NoError(t, err)
+		encoded, err := (&Codec{Signer: forger}).Encode(state)
+		assert.NoError(t, err)
+
+		_, err = codec.ParseAnonymous(encoded)
+		assert.Error(t, err)
+	})
+
+	t.Run("not verifiable without the transit key", func(t *testing.T) {
+		encoded, err := codec.Encode(state)
+		assert.NoError(t, err)
+
+		otherCodec, err := NewCodec([]byte("old secret"))
+		assert.NoError(t, err)
+		_, err = otherCodec.ParseAnonymous(encoded)
+		assert.Error(t, err)
+	})
+}
+
+func TestVaultTransitKeyId(t *testing.T) {
+	assert.Equal(t, "vault-transit:transit/spi-state", (&VaultTransit{Key: "spi-state"}).KeyId())
+	assert.Equal(t, "vault-transit:spi/spi-state", (&VaultTransit{Mount: "spi", Key: "spi-state"}).KeyId())
+}
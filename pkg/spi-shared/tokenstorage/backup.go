@@ -0,0 +1,219 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokenstorage
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// backupMagic prefixes the encrypted backups so that the files that are not backups, or are backups in an unknown
+// format, are recognized before trying to decrypt them.
+const backupMagic = "spi-backup-v1\n"
+
+// ErrBackupKeyMismatch is returned when the backup cannot be decrypted, i.e. when it was encrypted using a different
+// key or was corrupted.
+var ErrBackupKeyMismatch = errors.New("the backup cannot be decrypted with the provided key")
+
+// backup is the content of the backup before the encryption.
+type backup struct {
+	Tokens []backupEntry `json:"tokens"`
+}
+
+// backupEntry is a single token in the backup together with its data from the token storage. The data is nil for
+// the tokens that don't have any.
+type backupEntry struct {
+	Token api.SPIAccessToken `json:"token"`
+	Data  *api.Token         `json:"data,omitempty"`
+}
+
+// Export writes the encrypted backup of all the SPIAccessTokens in the cluster and of their data in the storage to
+// the writer. The backup is encrypted with AES-256-GCM using the SHA-256 of the key, so the key should be random and
+// kept separately from the backup. Returns the number of exported tokens. Unlike Migrate, the export fails on the first
+// token that cannot be read, because an incomplete backup would only be found out when it is needed.
+func Export(ctx context.Context, cl client.Client, storage TokenStorage, key []byte, w io.Writer) (int, error) {
+	tokens := &api.SPIAccessTokenList{}
+	if err := cl.List(ctx, tokens); err != nil {
+		return 0, fmt.Errorf("failed to list the tokens: %w", err)
+	}
+
+	b := backup{Tokens: make([]backupEntry, 0, len(tokens.Items))}
+	for i := range tokens.Items {
+		owner := &tokens.Items[i]
+		data, err := storage.Get(ctx, owner)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read the data of the token %s: %w", client.ObjectKeyFromObject(owner), err)
+		}
+		b.Tokens = append(b.Tokens, backupEntry{Token: *owner, Data: data})
+	}
+
+	plain, err := json.Marshal(&b)
+	if err != nil {
+		return 0, fmt.Errorf("failed to serialize the backup: %w", err)
+	}
+
+	aead, err := backupCipher(key)
+	if err != nil {
+		return 0, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return 0, fmt.Errorf("failed to generate the nonce: %w", err)
+	}
+
+	out := append([]byte(backupMagic), nonce...)
+	out = aead.Seal(out, nonce, plain, []byte(backupMagic))
+	if _, err := w.Write(out); err != nil {
+		return 0, fmt.Errorf("failed to write the backup: %w", err)
+	}
+
+	return len(b.Tokens), nil
+}
+
+// Import restores the tokens from the backup created by Export. The tokens missing in the cluster are re-created
+// (with a new UID, without the owner references and with the status left to the operator to fill in) and their data is
+// written to the storage. The tokens that exist in the cluster only get the data from the backup if they don't have
+// any in the storage, so that the data obtained after the backup was taken is never overwritten. The namespaces of
+// the tokens need to exist. Returns the number of the tokens with the restored data and the aggregate of
+// the errors encountered. Like Migrate, the import doesn't stop on the first failure.
+func Import(ctx context.Context, cl client.Client, storage TokenStorage, key []byte, r io.Reader) (int, error) {
+	b, err := readBackup(key, r)
+	if err != nil {
+		return 0, err
+	}
+
+	lg := log.FromContext(ctx)
+	restored := 0
+	errs := make([]error, 0)
+
+	for i := range b.Tokens {
+		entry := &b.Tokens[i]
+		objKey := client.ObjectKeyFromObject(&entry.Token)
+
+		owner := &api.SPIAccessToken{}
+		if err := cl.Get(ctx, objKey, owner); err != nil {
+			if !apierrors.IsNotFound(err) {
+				errs = append(errs, fmt.Errorf("failed to read the token %s: %w", objKey, err))
+				continue
+			}
+
+			owner = restoredToken(&entry.Token)
+			if err := cl.Create(ctx, owner); err != nil {
+				errs = append(errs, fmt.Errorf("failed to re-create the token %s: %w", objKey, err))
+				continue
+			}
+			lg.Info("re-created token", "token", objKey)
+		}
+
+		if entry.Data == nil {
+			continue
+		}
+
+		existing, err := storage.Get(ctx, owner)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read the data of the token %s: %w", objKey, err))
+			continue
+		}
+		if existing != nil {
+			continue
+		}
+
+		if err := storage.Store(ctx, owner, entry.Data); err != nil {
+			errs = append(errs, fmt.Errorf("failed to store the data of the token %s: %w", objKey, err))
+			continue
+		}
+
+		lg.Info("restored token data", "token", objKey)
+		restored++
+	}
+
+	return restored, utilerrors.NewAggregate(errs)
+}
+
+// restoredToken returns the copy of the token from the backup that can be created in the cluster. The fields set by
+// the cluster are cleared, and so are the finalizers and the owner references, because the owners have new UIDs after the restore, if they
+// exist at all.
+func restoredToken(token *api.SPIAccessToken) *api.SPIAccessToken {
+	return &api.SPIAccessToken{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        token.Name,
+			Namespace:   token.Namespace,
+			Labels:      token.Labels,
+			Annotations: token.Annotations,
+		},
+		Spec: *token.Spec.DeepCopy(),
+	}
+}
+
+func readBackup(key []byte, r io.Reader) (*backup, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the backup: %w", err)
+	}
+
+	aead, err := backupCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < len(backupMagic)+aead.NonceSize() || string(data[:len(backupMagic)]) != backupMagic {
+		return nil, errors.New("the data is not a backup of the tokens")
+	}
+	data = data[len(backupMagic):]
+
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(backupMagic))
+	if err != nil {
+		return nil, ErrBackupKeyMismatch
+	}
+
+	b := &backup{}
+	if err := json.Unmarshal(plain, b); err != nil {
+		return nil, fmt.Errorf("failed to parse the backup: %w", err)
+	}
+	return b, nil
+}
+
+func backupCipher(key []byte) (cipher.AEAD, error) {
+	if len(key) == 0 {
+		return nil, errors.New("the backup key is empty")
+	}
+
+	sum := sha256.Sum256(key)
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize the cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize the cipher: %w", err)
+	}
+	return aead, nil
+}
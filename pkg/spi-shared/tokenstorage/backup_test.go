@@ -0,0 +1,81 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokenstorage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestExportImport(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	source := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tokenObject("a"), tokenObject("b"), tokenObject("c")).Build()
+	sourceData := map[string]string{"a": "token-a", "b": "token-b"}
+
+	buf := &bytes.Buffer{}
+	exported, err := Export(context.TODO(), source, mapStorage(sourceData), key, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, exported)
+	assert.NotContains(t, buf.String(), "token-a")
+
+	t.Run("restores into empty cluster", func(t *testing.T) {
+		target := fake.NewClientBuilder().WithScheme(scheme).Build()
+		targetData := map[string]string{}
+
+		restored, err := Import(context.TODO(), target, mapStorage(targetData), key, bytes.NewReader(buf.Bytes()))
+		assert.NoError(t, err)
+		assert.Equal(t, 2, restored)
+		assert.Equal(t, sourceData, targetData)
+
+		tokens := &api.SPIAccessTokenList{}
+		assert.NoError(t, target.List(context.TODO(), tokens))
+		assert.Len(t, tokens.Items, 3)
+		for _, tkn := range tokens.Items {
+			assert.NotEqual(t, "uid-"+tkn.Name, string(tkn.UID))
+		}
+	})
+
+	t.Run("keeps newer data", func(t *testing.T) {
+		target := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tokenObject("a")).Build()
+		targetData := map[string]string{"a": "newer-a"}
+
+		restored, err := Import(context.TODO(), target, mapStorage(targetData), key, bytes.NewReader(buf.Bytes()))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, restored)
+		assert.Equal(t, map[string]string{"a": "newer-a", "b": "token-b"}, targetData)
+		assert.NoError(t, target.Get(context.TODO(), client.ObjectKeyFromObject(tokenObject("c")), &api.SPIAccessToken{}))
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		target := fake.NewClientBuilder().WithScheme(scheme).Build()
+
+		_, err := Import(context.TODO(), target, mapStorage(map[string]string{}), []byte("other key"), bytes.NewReader(buf.Bytes()))
+		assert.ErrorIs(t, err, ErrBackupKeyMismatch)
+	})
+
+	t.Run("not a backup", func(t *testing.T) {
+		target := fake.NewClientBuilder().WithScheme(scheme).Build()
+
+		_, err := Import(context.TODO(), target, mapStorage(map[string]string{}), key, bytes.NewReader([]byte("tokens: []")))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,32 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokenstorage
+
+import (
+	"context"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/util"
+)
+
+// DeleteAll deletes the data of all the provided tokens from the storage using at most concurrency concurrent
+// deletes. The storage backends don't offer deleting many entries at once, but issuing the deletes concurrently
+// makes deleting the data of many tokens, e.g. when their namespace is deleted, much faster than deleting it one by
+// one. The returned error aggregates the errors of all the failed deletes.
+func DeleteAll(ctx context.Context, storage TokenStorage, owners []*api.SPIAccessToken, concurrency int) error {
+	return util.RunConcurrently(len(owners), concurrency, func(i int) error {
+		return storage.Delete(ctx, owners[i])
+	})
+}
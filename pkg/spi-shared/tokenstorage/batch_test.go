@@ -0,0 +1,80 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokenstorage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDeleteAll(t *testing.T) {
+	owners := make([]*api.SPIAccessToken, 100)
+	for i := range owners {
+		owners[i] = &api.SPIAccessToken{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("token-%d", i), Namespace: "ns"}}
+	}
+
+	t.Run("deletes concurrently", func(t *testing.T) {
+		mutex := sync.Mutex{}
+		deleted := map[string]bool{}
+		running := 0
+		maxRunning := 0
+		storage := TestTokenStorage{DeleteImpl: func(_ context.Context, owner *api.SPIAccessToken) error {
+			mutex.Lock()
+			deleted[owner.Name] = true
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mutex.Unlock()
+
+			time.Sleep(time.Millisecond)
+
+			mutex.Lock()
+			running--
+			mutex.Unlock()
+			return nil
+		}}
+
+		assert.NoError(t, DeleteAll(context.TODO(), storage, owners, 10))
+		assert.Len(t, deleted, len(owners))
+		assert.LessOrEqual(t, maxRunning, 10)
+		assert.Greater(t, maxRunning, 1)
+	})
+
+	t.Run("aggregates errors", func(t *testing.T) {
+		storage := TestTokenStorage{DeleteImpl: func(_ context.Context, owner *api.SPIAccessToken) error {
+			if owner.Name == "token-3" || owner.Name == "token-42" {
+				return fmt.Errorf("failed to delete %s", owner.Name)
+			}
+			return nil
+		}}
+
+		err := DeleteAll(context.TODO(), storage, owners, 5)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "token-3")
+		assert.Contains(t, err.Error(), "token-42")
+	})
+
+	t.Run("no tokens", func(t *testing.T) {
+		assert.NoError(t, DeleteAll(context.TODO(), TestTokenStorage{}, nil, 5))
+	})
+}
@@ -0,0 +1,190 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokenstorage
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CachingTokenStorage is a TokenStorage that keeps the most recently read tokens in memory so that the repeated reads
+// of the same token (e.g. by many bindings linked to it) don't hit the underlying storage every time. The cache is
+// bounded both by the number of entries (least recently used entries are evicted first) and by the time the entries
+// are considered valid.
+//
+// The writes and deletes made through this storage invalidate the cache automatically. The changes made to the
+// underlying storage by other processes (e.g. the OAuth service) need to be reported using the Invalidate method.
+type CachingTokenStorage struct {
+	// TokenStorage is the token storage to delegate the actual storage operations to.
+	TokenStorage TokenStorage
+
+	capacity int
+	ttl      time.Duration
+	lock     sync.Mutex
+	entries  map[types.NamespacedName]*list.Element
+	lru      *list.List
+	// pending tracks the reads from the underlying storage in flight per token so that the data read before
+	// an invalidation of the token is not put into the cache after it.
+	pending map[types.NamespacedName]*pendingRead
+}
+
+// pendingRead counts the reads of a token from the underlying storage in flight and the invalidations of the token
+// made during them.
+type pendingRead struct {
+	reads         int
+	invalidations uint64
+}
+
+type cacheEntry struct {
+	key     types.NamespacedName
+	uid     types.UID
+	token   *api.Token
+	expires time.Time
+}
+
+var _ TokenStorage = (*CachingTokenStorage)(nil)
+
+// NewCachingTokenStorage creates a new caching token storage delegating to the provided storage. The cache holds at
+// most `capacity` tokens, each of which is considered valid for at most `ttl`.
+func NewCachingTokenStorage(storage TokenStorage, capacity int, ttl time.Duration) *CachingTokenStorage {
+	return &CachingTokenStorage{
+		TokenStorage: storage,
+		capacity:     capacity,
+		ttl:          ttl,
+		entries:      map[types.NamespacedName]*list.Element{},
+		lru:          list.New(),
+		pending:      map[types.NamespacedName]*pendingRead{},
+	}
+}
+
+func (c *CachingTokenStorage) Store(ctx context.Context, owner *api.SPIAccessToken, token *api.Token) error {
+	// the cache is invalidated after the write so that the concurrent reads cannot cache the old data
+	defer c.Invalidate(client.ObjectKeyFromObject(owner))
+	return c.TokenStorage.Store(ctx, owner, token)
+}
+
+func (c *CachingTokenStorage) Get(ctx context.Context, owner *api.SPIAccessToken) (*api.Token, error) {
+	key := client.ObjectKeyFromObject(owner)
+
+	token, invalidations := c.get(key, owner.UID)
+	if token != nil {
+		return token, nil
+	}
+
+	token, err := c.TokenStorage.Get(ctx, owner)
+	if err != nil || token == nil {
+		c.put(key, owner.UID, nil, invalidations)
+		return token, err
+	}
+
+	c.put(key, owner.UID, token, invalidations)
+
+	return token, nil
+}
+
+func (c *CachingTokenStorage) Delete(ctx context.Context, owner *api.SPIAccessToken) error {
+	defer c.Invalidate(client.ObjectKeyFromObject(owner))
+	return c.TokenStorage.Delete(ctx, owner)
+}
+
+// Invalidate removes the cached data of the token with the provided key, if any. The data of the token being read
+// from the underlying storage at the same time is not cached.
+func (c *CachingTokenStorage) Invalidate(key types.NamespacedName) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if p, ok := c.pending[key]; ok {
+		p.invalidations++
+	}
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+}
+
+// get returns a copy of the cached data of the token or nil. If nil is returned, the read from the underlying storage
+// is registered as pending and the returned number of the invalidations of the token so far must be passed to put
+// after the read.
+func (c *CachingTokenStorage) get(key types.NamespacedName, uid types.UID) (*api.Token, uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*cacheEntry)
+		// a token with the same name might have been deleted and re-created in the meantime, hence the UID check
+		if entry.uid == uid && !time.Now().After(entry.expires) {
+			c.lru.MoveToFront(el)
+			// return a copy so that the callers cannot modify the cached data
+			return entry.token.DeepCopy(), 0
+		}
+		c.remove(el)
+	}
+
+	p, ok := c.pending[key]
+	if !ok {
+		p = &pendingRead{}
+		c.pending[key] = p
+	}
+	p.reads++
+
+	return nil, p.invalidations
+}
+
+// put finishes the pending read of the token and caches the read data unless it is nil or the token was invalidated
+// since the provided number of invalidations returned by get before the read. The data might be stale in that case.
+func (c *CachingTokenStorage) put(key types.NamespacedName, uid types.UID, token *api.Token, invalidations uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	p := c.pending[key]
+	p.reads--
+	if p.reads == 0 {
+		delete(c.pending, key)
+	}
+
+	if token == nil || c.capacity <= 0 || c.ttl <= 0 || p.invalidations != invalidations {
+		return
+	}
+
+	entry := &cacheEntry{
+		key:     key,
+		uid:     uid,
+		token:   token.DeepCopy(),
+		expires: time.Now().Add(c.ttl),
+	}
+
+	if el, ok := c.entries[key]; ok {
+		el.Value = entry
+		c.lru.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(entry)
+
+	for c.lru.Len() > c.capacity {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove removes the element from the cache. Must be called with the lock held.
+func (c *CachingTokenStorage) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*cacheEntry).key)
+}
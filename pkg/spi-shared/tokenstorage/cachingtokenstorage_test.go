@@ -0,0 +1,250 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokenstorage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func countingStorage(reads *int) TestTokenStorage {
+	return TestTokenStorage{
+		GetImpl: func(ctx context.Context, owner *api.SPIAccessToken) (*api.Token, error) {
+			*reads++
+			return &api.Token{
+				AccessToken: "token-" + owner.Name,
+				Credentials: map[api.CredentialFlavor]string{api.CredentialFlavorPassword: "password-" + owner.Name},
+			}, nil
+		},
+	}
+}
+
+func tokenObject(name string) *api.SPIAccessToken {
+	return &api.SPIAccessToken{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			UID:       types.UID("uid-" + name),
+		},
+	}
+}
+
+func TestCachingTokenStorage_Get(t *testing.T) {
+	t.Run("caches reads", func(t *testing.T) {
+		reads := 0
+		strg := NewCachingTokenStorage(countingStorage(&reads), 10, time.Hour)
+
+		for i := 0; i < 5; i++ {
+			token, err := strg.Get(context.TODO(), tokenObject("a"))
+			assert.NoError(t, err)
+			assert.Equal(t, "token-a", token.AccessToken)
+		}
+
+		assert.Equal(t, 1, reads)
+	})
+
+	t.Run("returns copies", func(t *testing.T) {
+		reads := 0
+		strg := NewCachingTokenStorage(countingStorage(&reads), 10, time.Hour)
+
+		token, _ := strg.Get(context.TODO(), tokenObject("a"))
+		token.AccessToken = "changed"
+
+		token, _ = strg.Get(context.TODO(), tokenObject("a"))
+		assert.Equal(t, "token-a", token.AccessToken)
+	})
+
+	t.Run("returns deep copies", func(t *testing.T) {
+		reads := 0
+		strg := NewCachingTokenStorage(countingStorage(&reads), 10, time.Hour)
+
+		// the first read returns the token from the underlying storage, the second one the cached copy
+		token, _ := strg.Get(context.TODO(), tokenObject("a"))
+		token.Credentials[api.CredentialFlavorPassword] = "changed"
+		token, _ = strg.Get(context.TODO(), tokenObject("a"))
+		token.Credentials[api.CredentialFlavorPassword] = "changed"
+
+		token, _ = strg.Get(context.TODO(), tokenObject("a"))
+		assert.Equal(t, "password-a", token.Credentials[api.CredentialFlavorPassword])
+		assert.Equal(t, 1, reads)
+	})
+
+	t.Run("evicts least recently used", func(t *testing.T) {
+		reads := 0
+		strg := NewCachingTokenStorage(countingStorage(&reads), 2, time.Hour)
+
+		_, _ = strg.Get(context.TODO(), tokenObject("a"))
+		_, _ = strg.Get(context.TODO(), tokenObject("b"))
+		_, _ = strg.Get(context.TODO(), tokenObject("a"))
+		_, _ = strg.Get(context.TODO(), tokenObject("c"))
+		assert.Equal(t, 3, reads)
+
+		// a is still cached, b was evicted
+		_, _ = strg.Get(context.TODO(), tokenObject("a"))
+		assert.Equal(t, 3, reads)
+		_, _ = strg.Get(context.TODO(), tokenObject("b"))
+		assert.Equal(t, 4, reads)
+	})
+
+	t.Run("expires entries", func(t *testing.T) {
+		reads := 0
+		strg := NewCachingTokenStorage(countingStorage(&reads), 10, time.Millisecond)
+
+		_, _ = strg.Get(context.TODO(), tokenObject("a"))
+		time.Sleep(5 * time.Millisecond)
+		_, _ = strg.Get(context.TODO(), tokenObject("a"))
+
+		assert.Equal(t, 2, reads)
+	})
+
+	t.Run("detects re-created tokens", func(t *testing.T) {
+		reads := 0
+		strg := NewCachingTokenStorage(countingStorage(&reads), 10, time.Hour)
+
+		_, _ = strg.Get(context.TODO(), tokenObject("a"))
+		recreated := tokenObject("a")
+		recreated.UID = "other"
+		_, _ = strg.Get(context.TODO(), recreated)
+
+		assert.Equal(t, 2, reads)
+	})
+
+	t.Run("doesn't cache missing data", func(t *testing.T) {
+		reads := 0
+		strg := NewCachingTokenStorage(TestTokenStorage{
+			GetImpl: func(ctx context.Context, token *api.SPIAccessToken) (*api.Token, error) {
+				reads++
+				return nil, nil
+			},
+		}, 10, time.Hour)
+
+		_, _ = strg.Get(context.TODO(), tokenObject("a"))
+		token, err := strg.Get(context.TODO(), tokenObject("a"))
+		assert.NoError(t, err)
+		assert.Nil(t, token)
+		assert.Equal(t, 2, reads)
+	})
+
+	t.Run("disabled with zero capacity", func(t *testing.T) {
+		reads := 0
+		strg := NewCachingTokenStorage(countingStorage(&reads), 0, time.Hour)
+
+		_, _ = strg.Get(context.TODO(), tokenObject("a"))
+		_, _ = strg.Get(context.TODO(), tokenObject("a"))
+
+		assert.Equal(t, 2, reads)
+	})
+}
+
+func TestCachingTokenStorage_Invalidation(t *testing.T) {
+	t.Run("store", func(t *testing.T) {
+		reads := 0
+		strg := NewCachingTokenStorage(countingStorage(&reads), 10, time.Hour)
+
+		_, _ = strg.Get(context.TODO(), tokenObject("a"))
+		assert.NoError(t, strg.Store(context.TODO(), tokenObject("a"), &api.Token{}))
+		_, _ = strg.Get(context.TODO(), tokenObject("a"))
+
+		assert.Equal(t, 2, reads)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		reads := 0
+		strg := NewCachingTokenStorage(countingStorage(&reads), 10, time.Hour)
+
+		_, _ = strg.Get(context.TODO(), tokenObject("a"))
+		assert.NoError(t, strg.Delete(context.TODO(), tokenObject("a")))
+		_, _ = strg.Get(context.TODO(), tokenObject("a"))
+
+		assert.Equal(t, 2, reads)
+	})
+
+	t.Run("explicit", func(t *testing.T) {
+		reads := 0
+		strg := NewCachingTokenStorage(countingStorage(&reads), 10, time.Hour)
+
+		_, _ = strg.Get(context.TODO(), tokenObject("a"))
+		strg.Invalidate(client.ObjectKeyFromObject(tokenObject("a")))
+		_, _ = strg.Get(context.TODO(), tokenObject("a"))
+
+		assert.Equal(t, 2, reads)
+	})
+
+	t.Run("read during the write is not cached", func(t *testing.T) {
+		reads := 0
+		delegate := countingStorage(&reads)
+		var strg *CachingTokenStorage
+		delegate.StoreImpl = func(ctx context.Context, owner *api.SPIAccessToken, token *api.Token) error {
+			// a concurrent read before the write is persisted reads the old data
+			_, _ = strg.Get(ctx, owner)
+			return nil
+		}
+		strg = NewCachingTokenStorage(delegate, 10, time.Hour)
+
+		assert.NoError(t, strg.Store(context.TODO(), tokenObject("a"), &api.Token{}))
+		_, _ = strg.Get(context.TODO(), tokenObject("a"))
+
+		assert.Equal(t, 2, reads)
+	})
+
+	t.Run("read concurrent with the invalidation is not cached", func(t *testing.T) {
+		reads := 0
+		var strg *CachingTokenStorage
+		strg = NewCachingTokenStorage(TestTokenStorage{
+			GetImpl: func(ctx context.Context, owner *api.SPIAccessToken) (*api.Token, error) {
+				reads++
+				if reads == 1 {
+					// the data is updated and the cache invalidated while the old data is being read
+					strg.Invalidate(client.ObjectKeyFromObject(owner))
+				}
+				return &api.Token{AccessToken: "token"}, nil
+			},
+		}, 10, time.Hour)
+
+		_, _ = strg.Get(context.TODO(), tokenObject("a"))
+		_, _ = strg.Get(context.TODO(), tokenObject("a"))
+		_, _ = strg.Get(context.TODO(), tokenObject("a"))
+
+		assert.Equal(t, 2, reads)
+		assert.Empty(t, strg.pending)
+	})
+
+	t.Run("invalidation of other token doesn't prevent caching", func(t *testing.T) {
+		reads := 0
+		var strg *CachingTokenStorage
+		strg = NewCachingTokenStorage(TestTokenStorage{
+			GetImpl: func(ctx context.Context, owner *api.SPIAccessToken) (*api.Token, error) {
+				reads++
+				if reads == 1 {
+					strg.Invalidate(client.ObjectKeyFromObject(tokenObject("b")))
+				}
+				return &api.Token{AccessToken: "token"}, nil
+			},
+		}, 10, time.Hour)
+
+		_, _ = strg.Get(context.TODO(), tokenObject("a"))
+		_, _ = strg.Get(context.TODO(), tokenObject("a"))
+
+		assert.Equal(t, 1, reads)
+		assert.Empty(t, strg.pending)
+	})
+}
@@ -0,0 +1,79 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokenstorage
+
+import (
+	"context"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"golang.org/x/sync/singleflight"
+)
+
+// CoalescingTokenStorage is a TokenStorage that collapses the concurrent reads of the same token into a single read
+// from the underlying storage. Many bindings linked to the same token are often reconciled at the same time (e.g.
+// after the token becomes ready) and would otherwise hit the underlying storage (e.g. Vault) with a burst of identical
+// requests.
+//
+// Unlike the CachingTokenStorage, this storage never returns the data read before the call was made, it only shares
+// the result of the read that is in progress.
+type CoalescingTokenStorage struct {
+	// TokenStorage is the token storage to delegate the actual storage operations to.
+	TokenStorage TokenStorage
+
+	group singleflight.Group
+}
+
+var _ TokenStorage = (*CoalescingTokenStorage)(nil)
+
+func (c *CoalescingTokenStorage) Store(ctx context.Context, owner *api.SPIAccessToken, token *api.Token) error {
+	// the reads starting after the write must not join the read that might still return the old data
+	defer c.group.Forget(coalescingKey(owner))
+	return c.TokenStorage.Store(ctx, owner, token)
+}
+
+// Get reads the data of the token from the underlying storage or waits for the read of the same token that is already
+// in progress. The read is made with the context of the caller that started it, the other callers only stop waiting
+// for it once their context is done.
+func (c *CoalescingTokenStorage) Get(ctx context.Context, owner *api.SPIAccessToken) (*api.Token, error) {
+	ch := c.group.DoChan(coalescingKey(owner), func() (interface{}, error) {
+		return c.TokenStorage.Get(ctx, owner)
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		token := res.Val.(*api.Token)
+		if res.Shared {
+			// each caller needs its own copy so that they cannot modify the data of each other
+			token = token.DeepCopy()
+		}
+		return token, nil
+	}
+}
+
+func (c *CoalescingTokenStorage) Delete(ctx context.Context, owner *api.SPIAccessToken) error {
+	defer c.group.Forget(coalescingKey(owner))
+	return c.TokenStorage.Delete(ctx, owner)
+}
+
+// coalescingKey identifies the reads of the same token. The UID is included so that the read of a token cannot be
+// joined by the reads of a re-created token with the same name.
+func coalescingKey(owner *api.SPIAccessToken) string {
+	return owner.Namespace + "/" + owner.Name + "/" + string(owner.UID)
+}
@@ -0,0 +1,139 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokenstorage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingStorage returns the storage whose reads wait until the release channel is closed.
+func blockingStorage(reads *int32, release <-chan struct{}) TestTokenStorage {
+	return TestTokenStorage{
+		GetImpl: func(ctx context.Context, owner *api.SPIAccessToken) (*api.Token, error) {
+			atomic.AddInt32(reads, 1)
+			<-release
+			return &api.Token{AccessToken: "token-" + owner.Name}, nil
+		},
+	}
+}
+
+func TestCoalescingTokenStorage_Get(t *testing.T) {
+	t.Run("coalesces concurrent reads", func(t *testing.T) {
+		var reads int32
+		release := make(chan struct{})
+		strg := &CoalescingTokenStorage{TokenStorage: blockingStorage(&reads, release)}
+
+		tokens := make([]*api.Token, 5)
+		wg := sync.WaitGroup{}
+		for i := range tokens {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				tokens[i], _ = strg.Get(context.TODO(), tokenObject("a"))
+			}(i)
+		}
+
+		// give the goroutines the chance to join the read in progress
+		assert.Eventually(t, func() bool { return atomic.LoadInt32(&reads) == 1 }, time.Second, time.Millisecond)
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		assert.Equal(t, int32(1), atomic.LoadInt32(&reads))
+		for _, token := range tokens {
+			assert.Equal(t, "token-a", token.AccessToken)
+		}
+		// the callers get their own copies
+		tokens[0].AccessToken = "changed"
+		assert.Equal(t, "token-a", tokens[1].AccessToken)
+	})
+
+	t.Run("doesn't coalesce reads of different tokens", func(t *testing.T) {
+		var reads int32
+		release := make(chan struct{})
+		close(release)
+		strg := &CoalescingTokenStorage{TokenStorage: blockingStorage(&reads, release)}
+
+		a, _ := strg.Get(context.TODO(), tokenObject("a"))
+		b, _ := strg.Get(context.TODO(), tokenObject("b"))
+		_, _ = strg.Get(context.TODO(), tokenObject("a"))
+
+		assert.Equal(t, "token-a", a.AccessToken)
+		assert.Equal(t, "token-b", b.AccessToken)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&reads))
+	})
+
+	t.Run("stops waiting when the context is done", func(t *testing.T) {
+		var reads int32
+		release := make(chan struct{})
+		defer close(release)
+		strg := &CoalescingTokenStorage{TokenStorage: blockingStorage(&reads, release)}
+
+		ctx, cancel := context.WithCancel(context.TODO())
+		cancel()
+
+		token, err := strg.Get(ctx, tokenObject("a"))
+		assert.Nil(t, token)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("returns errors", func(t *testing.T) {
+		strg := &CoalescingTokenStorage{TokenStorage: TestTokenStorage{
+			GetImpl: func(ctx context.Context, owner *api.SPIAccessToken) (*api.Token, error) {
+				return nil, errors.New("intentional")
+			},
+		}}
+
+		token, err := strg.Get(context.TODO(), tokenObject("a"))
+		assert.Nil(t, token)
+		assert.EqualError(t, err, "intentional")
+	})
+}
+
+func TestCoalescingTokenStorage_WritesForgetReadsInProgress(t *testing.T) {
+	var reads int32
+	release := make(chan struct{})
+	blocking := blockingStorage(&reads, release)
+	blocking.StoreImpl = func(ctx context.Context, owner *api.SPIAccessToken, token *api.Token) error {
+		return nil
+	}
+	strg := &CoalescingTokenStorage{TokenStorage: blocking}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = strg.Get(context.TODO(), tokenObject("a"))
+	}()
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&reads) == 1 }, time.Second, time.Millisecond)
+
+	assert.NoError(t, strg.Store(context.TODO(), tokenObject("a"), &api.Token{}))
+
+	// the read after the write doesn't join the read started before it
+	go func() {
+		_, _ = strg.Get(context.TODO(), tokenObject("a"))
+	}()
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&reads) == 2 }, time.Second, time.Millisecond)
+
+	close(release)
+	<-done
+}
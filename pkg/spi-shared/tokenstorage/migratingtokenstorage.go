@@ -0,0 +1,117 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokenstorage
+
+import (
+	"context"
+	"fmt"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// MigratingTokenStorage is a TokenStorage used while moving the tokens from one storage backend to another. All the
+// writes go to the Primary storage. The reads try the Primary storage first and if the token data is not found there,
+// they fall back to the Secondary storage. The data found in the Secondary storage is written forward to the Primary
+// storage so that it is found there the next time. The deletes are performed in both storages so that the deleted
+// data cannot be "resurrected" from the Secondary storage.
+type MigratingTokenStorage struct {
+	// Primary is the storage the tokens are being migrated to.
+	Primary TokenStorage
+
+	// Secondary is the storage the tokens are being migrated from.
+	Secondary TokenStorage
+}
+
+var _ TokenStorage = (*MigratingTokenStorage)(nil)
+
+func (m MigratingTokenStorage) Store(ctx context.Context, owner *api.SPIAccessToken, token *api.Token) error {
+	return m.Primary.Store(ctx, owner, token)
+}
+
+func (m MigratingTokenStorage) Get(ctx context.Context, owner *api.SPIAccessToken) (*api.Token, error) {
+	token, err := m.Primary.Get(ctx, owner)
+	if err != nil || token != nil {
+		return token, err
+	}
+
+	token, err = m.Secondary.Get(ctx, owner)
+	if err != nil || token == nil {
+		return token, err
+	}
+
+	log.FromContext(ctx).Info("migrating the token data to the primary token storage", "token", client.ObjectKeyFromObject(owner))
+
+	if err := m.Primary.Store(ctx, owner, token); err != nil {
+		return nil, fmt.Errorf("failed to migrate the token data to the primary token storage: %w", err)
+	}
+
+	return token, nil
+}
+
+func (m MigratingTokenStorage) Delete(ctx context.Context, owner *api.SPIAccessToken) error {
+	return errors.NewAggregate([]error{m.Primary.Delete(ctx, owner), m.Secondary.Delete(ctx, owner)})
+}
+
+// Migrate copies the data of all the SPIAccessTokens in the cluster from the `from` storage to the `to` storage. The
+// tokens that already have data in the `to` storage are left intact. The data is not deleted from the `from` storage.
+// Returns the number of migrated tokens and the aggregate of the errors encountered. The migration doesn't stop on
+// the first failure so that as many tokens as possible are migrated.
+func Migrate(ctx context.Context, cl client.Client, from TokenStorage, to TokenStorage) (int, error) {
+	lg := log.FromContext(ctx)
+
+	tokens := &api.SPIAccessTokenList{}
+	if err := cl.List(ctx, tokens); err != nil {
+		return 0, fmt.Errorf("failed to list the tokens: %w", err)
+	}
+
+	migrated := 0
+	errs := make([]error, 0)
+
+	for i := range tokens.Items {
+		owner := &tokens.Items[i]
+		key := client.ObjectKeyFromObject(owner)
+
+		existing, err := to.Get(ctx, owner)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read the token %s from the target storage: %w", key, err))
+			continue
+		}
+		if existing != nil {
+			continue
+		}
+
+		token, err := from.Get(ctx, owner)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read the token %s from the source storage: %w", key, err))
+			continue
+		}
+		if token == nil {
+			continue
+		}
+
+		if err := to.Store(ctx, owner, token); err != nil {
+			errs = append(errs, fmt.Errorf("failed to store the token %s to the target storage: %w", key, err))
+			continue
+		}
+
+		lg.Info("migrated token data", "token", key)
+		migrated++
+	}
+
+	return migrated, errors.NewAggregate(errs)
+}
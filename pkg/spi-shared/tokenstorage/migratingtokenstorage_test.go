@@ -0,0 +1,115 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokenstorage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// mapStorage returns a test token storage backed by the provided map of token names to the access tokens.
+func mapStorage(data map[string]string) TestTokenStorage {
+	return TestTokenStorage{
+		StoreImpl: func(ctx context.Context, owner *api.SPIAccessToken, token *api.Token) error {
+			data[owner.Name] = token.AccessToken
+			return nil
+		},
+		GetImpl: func(ctx context.Context, owner *api.SPIAccessToken) (*api.Token, error) {
+			if at, ok := data[owner.Name]; ok {
+				return &api.Token{AccessToken: at}, nil
+			}
+			return nil, nil
+		},
+		DeleteImpl: func(ctx context.Context, owner *api.SPIAccessToken) error {
+			delete(data, owner.Name)
+			return nil
+		},
+	}
+}
+
+func TestMigratingTokenStorage_Get(t *testing.T) {
+	t.Run("prefers primary", func(t *testing.T) {
+		primary := map[string]string{"a": "new"}
+		secondary := map[string]string{"a": "old"}
+		strg := MigratingTokenStorage{Primary: mapStorage(primary), Secondary: mapStorage(secondary)}
+
+		token, err := strg.Get(context.TODO(), tokenObject("a"))
+		assert.NoError(t, err)
+		assert.Equal(t, "new", token.AccessToken)
+	})
+
+	t.Run("writes forward from secondary", func(t *testing.T) {
+		primary := map[string]string{}
+		secondary := map[string]string{"a": "old"}
+		strg := MigratingTokenStorage{Primary: mapStorage(primary), Secondary: mapStorage(secondary)}
+
+		token, err := strg.Get(context.TODO(), tokenObject("a"))
+		assert.NoError(t, err)
+		assert.Equal(t, "old", token.AccessToken)
+		assert.Equal(t, "old", primary["a"])
+	})
+
+	t.Run("missing in both", func(t *testing.T) {
+		strg := MigratingTokenStorage{Primary: mapStorage(map[string]string{}), Secondary: mapStorage(map[string]string{})}
+
+		token, err := strg.Get(context.TODO(), tokenObject("a"))
+		assert.NoError(t, err)
+		assert.Nil(t, token)
+	})
+
+	t.Run("fails when write forward fails", func(t *testing.T) {
+		primary := mapStorage(map[string]string{})
+		primary.StoreImpl = func(ctx context.Context, owner *api.SPIAccessToken, token *api.Token) error {
+			return fmt.Errorf("intentional failure")
+		}
+		strg := MigratingTokenStorage{Primary: primary, Secondary: mapStorage(map[string]string{"a": "old"})}
+
+		token, err := strg.Get(context.TODO(), tokenObject("a"))
+		assert.Error(t, err)
+		assert.Nil(t, token)
+	})
+}
+
+func TestMigratingTokenStorage_StoreAndDelete(t *testing.T) {
+	primary := map[string]string{}
+	secondary := map[string]string{"a": "old"}
+	strg := MigratingTokenStorage{Primary: mapStorage(primary), Secondary: mapStorage(secondary)}
+
+	assert.NoError(t, strg.Store(context.TODO(), tokenObject("a"), &api.Token{AccessToken: "new"}))
+	assert.Equal(t, "new", primary["a"])
+	assert.Equal(t, "old", secondary["a"])
+
+	assert.NoError(t, strg.Delete(context.TODO(), tokenObject("a")))
+	assert.Empty(t, primary)
+	assert.Empty(t, secondary)
+}
+
+func TestMigrate(t *testing.T) {
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tokenObject("a"), tokenObject("b"), tokenObject("c")).Build()
+
+	from := map[string]string{"a": "old-a", "b": "old-b"}
+	to := map[string]string{"b": "new-b"}
+
+	migrated, err := Migrate(context.TODO(), cl, mapStorage(from), mapStorage(to))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, migrated)
+	assert.Equal(t, map[string]string{"a": "old-a", "b": "new-b"}, to)
+	assert.Len(t, from, 2)
+}
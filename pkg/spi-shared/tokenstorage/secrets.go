@@ -16,64 +16,101 @@ package tokenstorage
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/sync"
 
 	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// credentialKeyPrefix is the prefix of the keys in the backing secret that hold the additional credentials of
+// the token. The rest of the key is the credential flavor.
+const credentialKeyPrefix = "credential."
+
 type secretsTokenStorage struct {
 	client.Client
 	syncer sync.Syncer
+	// historySize is the number of the previous versions of the token data kept with the data.
+	historySize int
 }
 
 var _ TokenStorage = (*secretsTokenStorage)(nil)
 
-// NewSecretsStorage creates a new `TokenStorage` instance using the provided Kubernetes client.
-func NewSecretsStorage(cl client.Client) (TokenStorage, error) {
-	return &secretsTokenStorage{Client: cl, syncer: sync.New(cl)}, nil
+// NewSecretsStorage creates a new `TokenStorage` instance using the provided Kubernetes client. The storage keeps
+// the historySize previous versions of the token data.
+func NewSecretsStorage(cl client.Client, historySize int) (TokenStorage, error) {
+	return &secretsTokenStorage{Client: cl, syncer: sync.New(cl), historySize: historySize}, nil
 }
 
 func (s secretsTokenStorage) Store(ctx context.Context, owner *api.SPIAccessToken, token *api.Token) error {
+	current, err := s.Get(ctx, owner)
+	if err != nil {
+		return fmt.Errorf("failed to read the current version of the token data: %w", err)
+	}
+	token = versionToken(current, token, s.historySize)
+
 	data := map[string][]byte{
-		"username":      []byte(token.Username),
-		"token_type":    []byte(token.TokenType),
-		"refresh_token": []byte(token.RefreshToken),
-		"access_token":  []byte(token.AccessToken),
-		"expiry":        []byte(strconv.FormatUint(token.Expiry, 10)),
+		"username":       []byte(token.Username),
+		"token_type":     []byte(token.TokenType),
+		"refresh_token":  []byte(token.RefreshToken),
+		"access_token":   []byte(token.AccessToken),
+		"expiry":         []byte(strconv.FormatUint(token.Expiry, 10)),
+		"schema_version": []byte(strconv.Itoa(schemaVersion)),
+		"version":        []byte(strconv.FormatUint(token.Version, 10)),
+	}
+	for flavor, credential := range token.Credentials {
+		data[credentialKeyPrefix+string(flavor)] = []byte(credential)
+	}
+	if len(token.PreviousVersions) > 0 {
+		previous, err := json.Marshal(token.PreviousVersions)
+		if err != nil {
+			return err
+		}
+		data["previous_versions"] = previous
 	}
 
 	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      "spi-storage-" + owner.Name,
 			Namespace: owner.Namespace,
+			Labels:    map[string]string{config.ManagedSecretLabel: config.ManagedSecretLabelValue},
 		},
 		Data: data,
 		Type: corev1.SecretTypeOpaque,
 	}
 
-	secret.OwnerReferences = []metav1.OwnerReference{
-		{
-			APIVersion: api.GroupVersion.String(),
-			Kind:       "SPIAccessToken",
-			Name:       owner.Name,
-			UID:        owner.UID,
-		},
+	if owner.UID != "" {
+		// the owners without UIDs are not real tokens, e.g. the tombstones of the data of the deleted tokens
+		secret.OwnerReferences = []metav1.OwnerReference{
+			{
+				APIVersion: api.GroupVersion.String(),
+				Kind:       "SPIAccessToken",
+				Name:       owner.Name,
+				UID:        owner.UID,
+			},
+		}
 	}
 
 	if err := s.Create(ctx, secret); err != nil {
 		if errors.IsAlreadyExists(err) {
-			if gerr := s.Client.Get(ctx, client.ObjectKey{Name: owner.Name, Namespace: owner.Namespace}, secret); gerr != nil {
+			if gerr := s.Client.Get(ctx, getSecretKey(owner), secret); gerr != nil {
 				return gerr
 			}
 
 			secret.Data = data
 			secret.Type = corev1.SecretTypeOpaque
+			if secret.Labels == nil {
+				secret.Labels = map[string]string{}
+			}
+			secret.Labels[config.ManagedSecretLabel] = config.ManagedSecretLabelValue
 
 			if owner.UID != "" {
 				// we're resetting the owner here, because we're taking over the secret from whoever created it before.
@@ -116,13 +153,47 @@ func (s secretsTokenStorage) Get(ctx context.Context, owner *api.SPIAccessToken)
 		}
 	}
 
-	return &api.Token{
+	if ver, ok := secret.Data["schema_version"]; ok {
+		version, err := strconv.ParseUint(string(ver), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkSchemaVersion(version); err != nil {
+			return nil, err
+		}
+	}
+
+	token := &api.Token{
 		Username:     string(secret.Data["username"]),
 		AccessToken:  string(secret.Data["access_token"]),
 		TokenType:    string(secret.Data["token_type"]),
 		RefreshToken: string(secret.Data["refresh_token"]),
 		Expiry:       expiry,
-	}, nil
+	}
+
+	if ver, ok := secret.Data["version"]; ok {
+		token.Version, err = strconv.ParseUint(string(ver), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if previous, ok := secret.Data["previous_versions"]; ok {
+		if err := json.Unmarshal(previous, &token.PreviousVersions); err != nil {
+			return nil, err
+		}
+	}
+
+	for k, v := range secret.Data {
+		if strings.HasPrefix(k, credentialKeyPrefix) {
+			if token.Credentials == nil {
+				token.Credentials = map[api.CredentialFlavor]string{}
+			}
+			token.Credentials[api.CredentialFlavor(strings.TrimPrefix(k, credentialKeyPrefix))] = string(v)
+		}
+	}
+
+	return token, nil
 }
 
 func (s secretsTokenStorage) Delete(ctx context.Context, owner *api.SPIAccessToken) error {
@@ -19,6 +19,7 @@ import (
 	"testing"
 
 	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
 	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/sync"
 	"github.com/stretchr/testify/assert"
 	corev1 "k8s.io/api/core/v1"
@@ -123,6 +124,48 @@ func TestSecretsTokenStorage_Get(t *testing.T) {
 		assert.Equal(t, "awesome", data.TokenType)
 		assert.Equal(t, uint64(0), data.Expiry)
 	})
+
+	t.Run("with credentials", func(t *testing.T) {
+		storage := newStorage(token, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "spi-storage-token",
+				Namespace: "default",
+			},
+			Data: map[string][]byte{
+				"access_token":      []byte("access"),
+				"schema_version":    []byte("3"),
+				"credential.SSHKey": []byte("key"),
+				"version":           []byte("7"),
+				"previous_versions": []byte(`[{"access_token":"previous","version":6}]`),
+			},
+			Type: "Opaque",
+		})
+
+		data, err := storage.Get(context.TODO(), token)
+		assert.NoError(t, err)
+		assert.Equal(t, "access", data.AccessToken)
+		assert.Equal(t, map[api.CredentialFlavor]string{api.CredentialFlavorSSHKey: "key"}, data.Credentials)
+		assert.Equal(t, uint64(7), data.Version)
+		assert.Equal(t, []api.Token{{AccessToken: "previous", Version: 6}}, data.PreviousVersions)
+	})
+
+	t.Run("newer schema version", func(t *testing.T) {
+		storage := newStorage(token, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "spi-storage-token",
+				Namespace: "default",
+			},
+			Data: map[string][]byte{
+				"access_token":   []byte("access"),
+				"schema_version": []byte("1000"),
+			},
+			Type: "Opaque",
+		})
+
+		data, err := storage.Get(context.TODO(), token)
+		assert.Error(t, err)
+		assert.Nil(t, data)
+	})
 }
 
 func TestSecretsTokenStorage_Store(t *testing.T) {
@@ -136,6 +179,13 @@ func TestSecretsTokenStorage_Store(t *testing.T) {
 		TokenType:    "happy",
 		RefreshToken: "refresh",
 		Expiry:       42,
+		Credentials: map[api.CredentialFlavor]string{
+			api.CredentialFlavorSSHKey: "key",
+		},
+		Version: 7,
+		PreviousVersions: []api.Token{
+			{AccessToken: "previous", Version: 6},
+		},
 	}
 
 	testSecret := func(t *testing.T, storage *secretsTokenStorage, token *api.SPIAccessToken) {
@@ -147,8 +197,13 @@ func TestSecretsTokenStorage_Store(t *testing.T) {
 		assert.Equal(t, "happy", string(secret.Data["token_type"]))
 		assert.Equal(t, "refresh", string(secret.Data["refresh_token"]))
 		assert.Equal(t, "42", string(secret.Data["expiry"]))
+		assert.Equal(t, "3", string(secret.Data["schema_version"]))
+		assert.Equal(t, "7", string(secret.Data["version"]))
+		assert.Equal(t, `[{"access_token":"previous","version":6}]`, string(secret.Data["previous_versions"]))
+		assert.Equal(t, "key", string(secret.Data["credential.SSHKey"]))
 		assert.Equal(t, 1, len(secret.OwnerReferences))
 		assert.Equal(t, "42", string(secret.OwnerReferences[0].UID))
+		assert.Equal(t, config.ManagedSecretLabelValue, secret.Labels[config.ManagedSecretLabel])
 	}
 
 	t.Run("token with name", func(t *testing.T) {
@@ -29,6 +29,7 @@ import (
 	vtesting "github.com/mitchellh/go-testing-interface"
 
 	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
 )
 
 type TestTokenStorage struct {
@@ -88,5 +89,5 @@ func CreateTestVaultTokenStorage(t vtesting.T) (*vault.TestCluster, TokenStorage
 		t.Fatal(err)
 	}
 
-	return cluster, &vaultTokenStorage{Client: client}
+	return cluster, &vaultTokenStorage{Client: client, historySize: config.DefaultTokenDataHistorySize}
 }
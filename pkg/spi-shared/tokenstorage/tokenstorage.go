@@ -16,6 +16,7 @@ package tokenstorage
 
 import (
 	"context"
+	"fmt"
 
 	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
 )
@@ -27,3 +28,17 @@ type TokenStorage interface {
 	Get(ctx context.Context, owner *api.SPIAccessToken) (*api.Token, error)
 	Delete(ctx context.Context, owner *api.SPIAccessToken) error
 }
+
+// schemaVersion is the current version of the layout of the token data in the token storage. It is stored alongside
+// the token data. Version 1 (or no version at all) is the data without the additional credentials. Version 2 added
+// the Credentials. Version 3 added the Version and the PreviousVersions.
+const schemaVersion = 3
+
+// checkSchemaVersion makes sure that the token data read from the storage is not in a newer layout than this version
+// of the operator understands. Such data would lose the parts unknown to us if we stored it back.
+func checkSchemaVersion(version uint64) error {
+	if version > schemaVersion {
+		return fmt.Errorf("the token data has the schema version %d but only versions up to %d are supported", version, schemaVersion)
+	}
+	return nil
+}
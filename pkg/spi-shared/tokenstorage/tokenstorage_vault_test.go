@@ -19,7 +19,9 @@ import (
 	"encoding/json"
 	"testing"
 
+	vaultapi "github.com/hashicorp/vault/api"
 	"github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
 	"github.com/stretchr/testify/assert"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -49,6 +51,8 @@ func TestStorage(t *testing.T) {
 	gettedToken, err := storage.Get(context.TODO(), testSpiAccessToken)
 	assert.NoError(t, err)
 	assert.NotNil(t, gettedToken)
+	assert.Equal(t, uint64(1), gettedToken.Version)
+	gettedToken.Version = 0
 	assert.EqualValues(t, testToken, gettedToken)
 
 	err = storage.Delete(context.TODO(), testSpiAccessToken)
@@ -59,6 +63,72 @@ func TestStorage(t *testing.T) {
 	assert.Nil(t, gettedToken)
 }
 
+func TestStorageWithCredentialsAndVersions(t *testing.T) {
+	cluster, storage := CreateTestVaultTokenStorage(t)
+	defer cluster.Cleanup()
+
+	token := *testToken
+	token.Credentials = map[v1beta1.CredentialFlavor]string{
+		v1beta1.CredentialFlavorSSHKey: "testSSHKey",
+	}
+	token.Version = 2
+	token.PreviousVersions = []v1beta1.Token{
+		{AccessToken: "testPreviousAccessToken", Expiry: 42, Version: 1},
+	}
+
+	assert.NoError(t, storage.Store(context.TODO(), testSpiAccessToken, &token))
+
+	gettedToken, err := storage.Get(context.TODO(), testSpiAccessToken)
+	assert.NoError(t, err)
+	assert.EqualValues(t, &token, gettedToken)
+}
+
+func TestStorageKVv1WithPathTemplate(t *testing.T) {
+	cluster, storage := CreateTestVaultTokenStorage(t)
+	defer cluster.Cleanup()
+
+	client := storage.(*vaultTokenStorage).Client
+	assert.NoError(t, client.Sys().Mount("kv1", &vaultapi.MountInput{
+		Type: "kv",
+		Options: map[string]string{
+			"version": "1",
+		},
+	}))
+	storage = &vaultTokenStorage{
+		Client:      client,
+		historySize: config.DefaultTokenDataHistorySize,
+		layout:      VaultLayout{Mount: "kv1", KVVersion: 1, PathTemplate: "teams/{namespace}/spi/{name}"},
+	}
+
+	assert.NoError(t, storage.Store(context.TODO(), testSpiAccessToken, testToken))
+
+	raw, err := client.Logical().Read("kv1/teams/testNamespace/spi/testSpiAccessToken")
+	assert.NoError(t, err)
+	assert.NotNil(t, raw)
+
+	gettedToken, err := storage.Get(context.TODO(), testSpiAccessToken)
+	assert.NoError(t, err)
+	assert.NotNil(t, gettedToken)
+	assert.Equal(t, testToken.AccessToken, gettedToken.AccessToken)
+	assert.Equal(t, uint64(1), gettedToken.Version)
+
+	assert.NoError(t, storage.Delete(context.TODO(), testSpiAccessToken))
+
+	gettedToken, err = storage.Get(context.TODO(), testSpiAccessToken)
+	assert.NoError(t, err)
+	assert.Nil(t, gettedToken)
+}
+
+func TestVaultLayoutPath(t *testing.T) {
+	assert.Equal(t, "spi/data/testNamespace/testSpiAccessToken", VaultLayout{}.path(testSpiAccessToken))
+	assert.Equal(t, "kv/data/testNamespace/testSpiAccessToken", VaultLayout{Mount: "kv", KVVersion: 2}.path(testSpiAccessToken))
+	assert.Equal(t, "secret/teams/testNamespace/testSpiAccessToken", VaultLayout{
+		Mount:        "secret",
+		KVVersion:    1,
+		PathTemplate: "teams/{namespace}/{name}",
+	}.path(testSpiAccessToken))
+}
+
 func TestParseToken(t *testing.T) {
 	t.Run("nil data", func(t *testing.T) {
 		token, err := parseToken(nil)
@@ -110,6 +180,22 @@ func TestParseToken(t *testing.T) {
 		assert.Equal(t, uint64(0), token.Expiry)
 	})
 
+	t.Run("with credentials", func(t *testing.T) {
+		data := map[string]interface{}{
+			"access_token": "at",
+			"credentials": map[string]interface{}{
+				"SSHKey":   "key",
+				"Password": "pass",
+			},
+		}
+		token, err := parseToken(data)
+		assert.Nil(t, err)
+		assert.Equal(t, map[v1beta1.CredentialFlavor]string{
+			v1beta1.CredentialFlavorSSHKey:   "key",
+			v1beta1.CredentialFlavorPassword: "pass",
+		}, token.Credentials)
+	})
+
 	t.Run("invalid expiry", func(t *testing.T) {
 		data := map[string]interface{}{
 			"expiry": json.Number("blabol"),
@@ -19,21 +19,47 @@ import (
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"strings"
 
 	vault "github.com/hashicorp/vault/api"
 	auth "github.com/hashicorp/vault/api/auth/kubernetes"
 	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
-const vaultDataPathFormat = "spi/data/%s/%s"
-
 type vaultTokenStorage struct {
 	*vault.Client
+	// historySize is the number of the previous versions of the token data kept with the data.
+	historySize int
+	// layout is where in Vault the token data is stored.
+	layout VaultLayout
+}
+
+// VaultLayout describes where in Vault the token data is stored. The zero values mean the defaults from the config
+// package, i.e. the data is stored at "spi/data/<namespace>/<name>" in the KV version 2 secrets engine.
+type VaultLayout struct {
+	// Mount is the mount path of the KV secrets engine.
+	Mount string
+	// KVVersion is the version of the KV secrets engine, 1 or 2.
+	KVVersion int
+	// PathTemplate is the path of the token data within the mount with the config.VaultPathNamespacePlaceholder and
+	// config.VaultPathNamePlaceholder.
+	PathTemplate string
+}
+
+// NewVaultStorage creates a new `TokenStorage` instance using the provided Vault instance. The storage keeps
+// the historySize previous versions of the token data at the locations given by the layout.
+func NewVaultStorage(role string, vaultHost string, serviceAccountToken string, insecure bool, historySize int, layout VaultLayout) (TokenStorage, error) {
+	vaultClient, err := NewVaultClient(role, vaultHost, serviceAccountToken, insecure)
+	if err != nil {
+		return nil, err
+	}
+	return &vaultTokenStorage{Client: vaultClient, historySize: historySize, layout: layout}, nil
 }
 
-// NewVaultStorage creates a new `TokenStorage` instance using the provided Vault instance.
-func NewVaultStorage(role string, vaultHost string, serviceAccountToken string, insecure bool) (TokenStorage, error) {
+// NewVaultClient creates a new Vault client logged in to the provided Vault instance using the Kubernetes auth method.
+func NewVaultClient(role string, vaultHost string, serviceAccountToken string, insecure bool) (*vault.Client, error) {
 	config := vault.DefaultConfig()
 	config.Address = vaultHost
 
@@ -66,19 +92,29 @@ func NewVaultStorage(role string, vaultHost string, serviceAccountToken string,
 	if authInfo == nil {
 		return nil, fmt.Errorf("no auth info was returned after login to vault")
 	}
-	return &vaultTokenStorage{vaultClient}, nil
+	return vaultClient, nil
 }
 
 func (v *vaultTokenStorage) Store(ctx context.Context, owner *api.SPIAccessToken, token *api.Token) error {
+	current, err := v.Get(ctx, owner)
+	if err != nil {
+		return fmt.Errorf("failed to read the current version of the token data: %w", err)
+	}
+
 	data := map[string]interface{}{
-		"data": token,
+		"data":           versionToken(current, token, v.historySize),
+		"schema_version": schemaVersion,
 	}
-	path := getVaultPath(owner)
+	path := v.layout.path(owner)
 	s, err := v.Client.Logical().Write(path, data)
 	if err != nil {
 		return err
 	}
 	if s == nil {
+		// the KV version 1 secrets engine doesn't respond with anything to the writes
+		if v.layout.KVVersion == 1 {
+			return nil
+		}
 		return fmt.Errorf("failed to store the token, no error but returned nil")
 	}
 	for _, w := range s.Warnings {
@@ -89,7 +125,7 @@ func (v *vaultTokenStorage) Store(ctx context.Context, owner *api.SPIAccessToken
 }
 
 func (v *vaultTokenStorage) Get(ctx context.Context, owner *api.SPIAccessToken) (*api.Token, error) {
-	path := getVaultPath(owner)
+	path := v.layout.path(owner)
 
 	secret, err := v.Client.Logical().Read(path)
 	if err != nil {
@@ -107,6 +143,14 @@ func (v *vaultTokenStorage) Get(ctx context.Context, owner *api.SPIAccessToken)
 		return nil, fmt.Errorf("corrupted data in Vault at '%s'", path)
 	}
 
+	version, err := ifaceMapFieldToUint64(secret.Data, "schema_version")
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSchemaVersion(version); err != nil {
+		return nil, err
+	}
+
 	return parseToken(data)
 }
 
@@ -127,6 +171,30 @@ func parseToken(data interface{}) (*api.Token, error) {
 	}
 	token.Expiry = expiry
 
+	if credentials, ok := dataMap["credentials"].(map[string]interface{}); ok && len(credentials) > 0 {
+		token.Credentials = make(map[api.CredentialFlavor]string, len(credentials))
+		for flavor := range credentials {
+			token.Credentials[api.CredentialFlavor(flavor)] = ifaceMapFieldToString(credentials, flavor)
+		}
+	}
+
+	version, versionErr := ifaceMapFieldToUint64(dataMap, "version")
+	if versionErr != nil {
+		return nil, versionErr
+	}
+	token.Version = version
+
+	if previous, ok := dataMap["previous_versions"].([]interface{}); ok && len(previous) > 0 {
+		token.PreviousVersions = make([]api.Token, 0, len(previous))
+		for _, p := range previous {
+			previousToken, err := parseToken(p)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse the previous version of the token: %w", err)
+			}
+			token.PreviousVersions = append(token.PreviousVersions, *previousToken)
+		}
+	}
+
 	return token, nil
 }
 
@@ -157,7 +225,7 @@ func ifaceMapFieldToString(source map[string]interface{}, fieldName string) stri
 }
 
 func (v *vaultTokenStorage) Delete(ctx context.Context, owner *api.SPIAccessToken) error {
-	s, err := v.Client.Logical().Delete(getVaultPath(owner))
+	s, err := v.Client.Logical().Delete(v.layout.path(owner))
 	if err != nil {
 		return err
 	}
@@ -165,6 +233,23 @@ func (v *vaultTokenStorage) Delete(ctx context.Context, owner *api.SPIAccessToke
 	return nil
 }
 
-func getVaultPath(owner *api.SPIAccessToken) string {
-	return fmt.Sprintf(vaultDataPathFormat, owner.Namespace, owner.Name)
+// path returns the path of the data of the token in Vault. The KV version 2 secrets engine expects the data under
+// the "data/" prefix within the mount, while the version 1 engine stores it directly at the path. The stored data has
+// the same shape in both versions, because the version 1 engine keeps the whole written object, "data" key included.
+func (l VaultLayout) path(owner *api.SPIAccessToken) string {
+	mount := l.Mount
+	if mount == "" {
+		mount = config.DefaultVaultTokenMount
+	}
+	template := l.PathTemplate
+	if template == "" {
+		template = config.DefaultVaultTokenPathTemplate
+	}
+
+	path := strings.NewReplacer(config.VaultPathNamespacePlaceholder, owner.Namespace, config.VaultPathNamePlaceholder, owner.Name).Replace(template)
+
+	if l.KVVersion == 1 {
+		return mount + "/" + path
+	}
+	return mount + "/data/" + path
 }
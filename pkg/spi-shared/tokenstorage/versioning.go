@@ -0,0 +1,85 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokenstorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+)
+
+// ErrVersionNotFound is returned by Rollback if the requested version is not among the previous versions of the token
+// data.
+var ErrVersionNotFound = errors.New("the requested version of the token data is not available")
+
+// versionToken returns the copy of the token data to store in place of the current data. The version of the data is
+// increased and up to historySize previous versions are kept together with the data so that the data can be rolled
+// back using the Rollback function. 0 historySize means no previous versions are kept, but the versions of the data
+// are still numbered. The token storages version the data themselves so that all the writers of the data (e.g. the OAuth
+// service uploading the data) produce the same layout.
+//
+// If there's no current data, the token data that already has a version is stored as is, so that the data migrated
+// between the storages keeps its history.
+func versionToken(current *api.Token, token *api.Token, historySize int) *api.Token {
+	versioned := token.DeepCopy()
+
+	if current == nil {
+		if versioned.Version == 0 {
+			versioned.Version = 1
+			versioned.PreviousVersions = nil
+		}
+		return versioned
+	}
+
+	versioned.Version = current.Version + 1
+	versioned.PreviousVersions = nil
+
+	if historySize > 0 {
+		previous := current.DeepCopy()
+		previous.PreviousVersions = nil
+
+		versioned.PreviousVersions = make([]api.Token, 0, historySize)
+		versioned.PreviousVersions = append(versioned.PreviousVersions, *previous)
+		versioned.PreviousVersions = append(versioned.PreviousVersions, current.PreviousVersions...)
+		if len(versioned.PreviousVersions) > historySize {
+			versioned.PreviousVersions = versioned.PreviousVersions[:historySize]
+		}
+	}
+
+	return versioned
+}
+
+// Rollback replaces the token data in the storage with the data of the provided previous version. The old data is
+// stored as a new version so that the rollback itself can be rolled back. Returns ErrVersionNotFound if the version is
+// not among the previous versions of the data, e.g. because the storage doesn't keep them.
+func Rollback(ctx context.Context, storage TokenStorage, owner *api.SPIAccessToken, version uint64) error {
+	current, err := storage.Get(ctx, owner)
+	if err != nil {
+		return fmt.Errorf("failed to read the token data: %w", err)
+	}
+	if current == nil {
+		return ErrVersionNotFound
+	}
+
+	for i := range current.PreviousVersions {
+		if current.PreviousVersions[i].Version == version {
+			return storage.Store(ctx, owner, &current.PreviousVersions[i])
+		}
+	}
+
+	return ErrVersionNotFound
+}
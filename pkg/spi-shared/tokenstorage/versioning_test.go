@@ -0,0 +1,99 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokenstorage
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersionToken(t *testing.T) {
+	t.Run("numbers the first version", func(t *testing.T) {
+		versioned := versionToken(nil, &api.Token{AccessToken: "a"}, 2)
+		assert.Equal(t, &api.Token{AccessToken: "a", Version: 1}, versioned)
+	})
+
+	t.Run("keeps the version of the migrated data", func(t *testing.T) {
+		token := &api.Token{AccessToken: "b", Version: 2, PreviousVersions: []api.Token{{AccessToken: "a", Version: 1}}}
+		assert.Equal(t, token, versionToken(nil, token, 2))
+	})
+
+	t.Run("keeps the history", func(t *testing.T) {
+		current := &api.Token{AccessToken: "c", Version: 3, PreviousVersions: []api.Token{{AccessToken: "b", Version: 2}, {AccessToken: "a", Version: 1}}}
+
+		versioned := versionToken(current, &api.Token{AccessToken: "d"}, 2)
+		assert.Equal(t, "d", versioned.AccessToken)
+		assert.Equal(t, uint64(4), versioned.Version)
+		assert.Equal(t, []api.Token{{AccessToken: "c", Version: 3}, {AccessToken: "b", Version: 2}}, versioned.PreviousVersions)
+	})
+
+	t.Run("without history", func(t *testing.T) {
+		current := &api.Token{AccessToken: "a", Version: 1}
+
+		versioned := versionToken(current, &api.Token{AccessToken: "b"}, 0)
+		assert.Equal(t, uint64(2), versioned.Version)
+		assert.Empty(t, versioned.PreviousVersions)
+	})
+
+	t.Run("doesn't modify the stored token", func(t *testing.T) {
+		token := &api.Token{AccessToken: "b"}
+		versionToken(&api.Token{AccessToken: "a", Version: 1}, token, 2)
+		assert.Equal(t, &api.Token{AccessToken: "b"}, token)
+	})
+}
+
+func TestSecretsTokenStorage_Versioning(t *testing.T) {
+	owner := tokenObject("token")
+	strg := newStorage(owner)
+	strg.historySize = 2
+
+	// the token data is uploaded without any version, like the OAuth service does
+	for _, at := range []string{"a", "b", "c"} {
+		assert.NoError(t, strg.Store(context.TODO(), owner, &api.Token{AccessToken: at}))
+	}
+
+	t.Run("numbers the versions and keeps the history", func(t *testing.T) {
+		stored, err := strg.Get(context.TODO(), owner)
+		assert.NoError(t, err)
+		assert.Equal(t, "c", stored.AccessToken)
+		assert.Equal(t, uint64(3), stored.Version)
+		assert.Equal(t, []api.Token{{AccessToken: "b", Version: 2}, {AccessToken: "a", Version: 1}}, stored.PreviousVersions)
+	})
+
+	t.Run("rolls back to a previous version", func(t *testing.T) {
+		assert.NoError(t, Rollback(context.TODO(), strg, owner, 2))
+
+		stored, err := strg.Get(context.TODO(), owner)
+		assert.NoError(t, err)
+		assert.Equal(t, "b", stored.AccessToken)
+		assert.Equal(t, uint64(4), stored.Version)
+		assert.Equal(t, []api.Token{{AccessToken: "c", Version: 3}, {AccessToken: "b", Version: 2}}, stored.PreviousVersions)
+	})
+
+	t.Run("doesn't roll back to an unknown version", func(t *testing.T) {
+		assert.ErrorIs(t, Rollback(context.TODO(), strg, owner, 1), ErrVersionNotFound)
+
+		stored, err := strg.Get(context.TODO(), owner)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(4), stored.Version)
+	})
+
+	t.Run("doesn't roll back without data", func(t *testing.T) {
+		assert.ErrorIs(t, Rollback(context.TODO(), strg, tokenObject("other"), 1), ErrVersionNotFound)
+	})
+}
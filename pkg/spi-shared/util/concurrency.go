@@ -0,0 +1,61 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/errors"
+)
+
+// RunConcurrently calls fn with the indices 0 to n-1 using at most the provided number of concurrent workers and
+// returns the aggregated errors of the failed calls. It is meant for the batches of independent requests, e.g. to
+// the token storage or the cluster, that would take too long if made one by one.
+func RunConcurrently(n int, workers int, fn func(i int) error) error {
+	if workers <= 0 {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+
+	queue := make(chan int)
+	go func() {
+		defer close(queue)
+		for i := 0; i < n; i++ {
+			queue <- i
+		}
+	}()
+
+	errs := make([]error, 0)
+	mutex := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				if err := fn(i); err != nil {
+					mutex.Lock()
+					errs = append(errs, err)
+					mutex.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return errors.NewAggregate(errs)
+}
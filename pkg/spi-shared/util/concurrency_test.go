@@ -0,0 +1,38 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunConcurrently(t *testing.T) {
+	calls := int32(0)
+	err := RunConcurrently(10, 3, func(i int) error {
+		atomic.AddInt32(&calls, 1)
+		if i == 4 {
+			return fmt.Errorf("failed %d", i)
+		}
+		return nil
+	})
+	assert.Equal(t, int32(10), calls)
+	assert.EqualError(t, err, "failed 4")
+
+	assert.NoError(t, RunConcurrently(0, 3, func(int) error { return nil }))
+}
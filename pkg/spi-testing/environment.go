@@ -0,0 +1,344 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !release
+// +build !release
+
+// Package spitesting contains the helpers for running integration tests against the SPI controllers. It is meant for
+// the components that depend on SPI and need the SPI CRDs and controllers running in their tests without deploying
+// the whole operator. The service provider used by the controllers is the TestServiceProvider that the tests can
+// customize as they need.
+package spitesting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/controllers"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/tokenstorage"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	authzv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbac "k8s.io/api/rbac/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// TestServiceProviderType is the type of the service provider under which the TestServiceProvider is registered.
+const TestServiceProviderType config.ServiceProviderType = "TestServiceProvider"
+
+// TestServiceProviderBaseUrl is the base URL of the repositories that are matched with the TestServiceProvider by
+// the default probe of the Environment.
+const TestServiceProviderBaseUrl = "test-provider://"
+
+var errManagerNotStarted = errors.New("the controller manager didn't start")
+
+// Environment is a running envtest API server with the SPI CRDs installed and the SPI controllers running against it.
+// It is created using the EnvironmentBuilder.
+type Environment struct {
+	// Client is a client with the admin privileges in the cluster.
+	Client client.Client
+	// NoPrivsClient is a client of a user without any privileges in the cluster.
+	NoPrivsClient client.Client
+	// TestEnvironment is the underlying envtest environment.
+	TestEnvironment *envtest.Environment
+	// Context is the context the controllers run in. It is cancelled by Stop.
+	Context context.Context
+	// Cancel stops the controllers.
+	Cancel context.CancelFunc
+	// TokenStorage is the token storage used by the controllers wrapped in the tokenstorage.NotifyingTokenStorage so
+	// that the controllers are notified about the token data stored by the tests.
+	TokenStorage tokenstorage.TokenStorage
+	// TestServiceProvider is the service provider used by the controllers for all the repositories recognized by
+	// TestServiceProviderProbe. The tests can modify it at will and the controllers pick up the changes.
+	TestServiceProvider TestServiceProvider
+	// TestServiceProviderProbe recognizes the repositories served by the TestServiceProvider.
+	TestServiceProviderProbe serviceprovider.Probe
+}
+
+// EnvironmentBuilder configures and starts the Environment. Use NewEnvironment to create a builder with
+// the defaults.
+type EnvironmentBuilder struct {
+	crdDirectoryPaths []string
+	configuration     config.Configuration
+	tokenStorage      tokenstorage.TokenStorage
+	schemeFuncs       []func(*k8sruntime.Scheme) error
+	probe             serviceprovider.Probe
+	serviceProvider   TestServiceProvider
+}
+
+// NewEnvironment returns a builder of the Environment that uses the CRDs of this module, the MemoryTokenStorage and
+// a configuration with the TestServiceProvider being the only configured service provider.
+func NewEnvironment() *EnvironmentBuilder {
+	return &EnvironmentBuilder{
+		crdDirectoryPaths: []string{CRDDirectoryPath()},
+		configuration: config.Configuration{
+			ServiceProviders: []config.ServiceProviderConfiguration{
+				{
+					ClientId:            "testClient",
+					ClientSecret:        "testSecret",
+					ServiceProviderType: TestServiceProviderType,
+				},
+			},
+			SharedSecret:   []byte("secret"),
+			BaseUrl:        "https://spi.test",
+			AccessCheckTtl: 10 * time.Second,
+			RelinkBindings: true,
+		},
+		tokenStorage: &MemoryTokenStorage{},
+		probe: serviceprovider.ProbeFunc(func(_ *http.Client, baseUrl string) (string, error) {
+			if strings.HasPrefix(baseUrl, TestServiceProviderBaseUrl) {
+				return TestServiceProviderBaseUrl, nil
+			}
+
+			return "", nil
+		}),
+	}
+}
+
+// CRDDirectoryPath returns the path to the directory with the SPI CRDs. This works both in this repository and when
+// this package is used from the Go module cache.
+func CRDDirectoryPath() string {
+	_, thisFile, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(thisFile), "..", "..", "config", "crd", "bases")
+}
+
+// WithCRDDirectoryPaths adds the directories with additional CRDs to install into the API server, e.g. the CRDs of
+// the component under test.
+func (b *EnvironmentBuilder) WithCRDDirectoryPaths(paths ...string) *EnvironmentBuilder {
+	b.crdDirectoryPaths = append(b.crdDirectoryPaths, paths...)
+	return b
+}
+
+// WithConfiguration replaces the default operator configuration. Note that the TestServiceProvider is only used if
+// the configuration contains a service provider of the TestServiceProviderType.
+func (b *EnvironmentBuilder) WithConfiguration(cfg config.Configuration) *EnvironmentBuilder {
+	b.configuration = cfg
+	return b
+}
+
+// WithTokenStorage replaces the default MemoryTokenStorage, e.g. with the Vault storage created by
+// tokenstorage.CreateTestVaultTokenStorage.
+func (b *EnvironmentBuilder) WithTokenStorage(storage tokenstorage.TokenStorage) *EnvironmentBuilder {
+	b.tokenStorage = storage
+	return b
+}
+
+// WithScheme registers additional types into the scheme of the clients and the controller manager.
+func (b *EnvironmentBuilder) WithScheme(addToScheme func(*k8sruntime.Scheme) error) *EnvironmentBuilder {
+	b.schemeFuncs = append(b.schemeFuncs, addToScheme)
+	return b
+}
+
+// WithServiceProviderProbe replaces the probe recognizing the repositories of the TestServiceProvider. By default,
+// the URLs starting with TestServiceProviderBaseUrl are recognized.
+func (b *EnvironmentBuilder) WithServiceProviderProbe(probe serviceprovider.Probe) *EnvironmentBuilder {
+	b.probe = probe
+	return b
+}
+
+// WithServiceProvider sets the initial implementation of the TestServiceProvider.
+func (b *EnvironmentBuilder) WithServiceProvider(sp TestServiceProvider) *EnvironmentBuilder {
+	b.serviceProvider = sp
+	return b
+}
+
+// Start starts the API server and the SPI controllers. The controllers run until the returned environment is stopped or
+// the provided context is cancelled.
+func (b *EnvironmentBuilder) Start(ctx context.Context) (*Environment, error) {
+	env := &Environment{
+		TestServiceProvider:      b.serviceProvider,
+		TestServiceProviderProbe: b.probe,
+	}
+	env.Context, env.Cancel = context.WithCancel(ctx)
+
+	env.TestEnvironment = &envtest.Environment{
+		CRDDirectoryPaths:     b.crdDirectoryPaths,
+		ErrorIfCRDPathMissing: true,
+	}
+
+	cfg, err := env.TestEnvironment.Start()
+	if err != nil {
+		env.Cancel()
+		return nil, fmt.Errorf("failed to start the test environment: %w", err)
+	}
+
+	if err := env.setup(b, cfg); err != nil {
+		_ = env.Stop()
+		return nil, err
+	}
+
+	return env, nil
+}
+
+func (env *Environment) setup(b *EnvironmentBuilder, cfg *rest.Config) error {
+	scheme := k8sruntime.NewScheme()
+	for _, add := range append([]func(*k8sruntime.Scheme) error{corev1.AddToScheme, api.AddToScheme, admissionv1beta1.AddToScheme, authzv1.AddToScheme, rbac.AddToScheme}, b.schemeFuncs...) {
+		if err := add(scheme); err != nil {
+			return fmt.Errorf("failed to initialize the scheme: %w", err)
+		}
+	}
+
+	noPrivsUser, err := env.TestEnvironment.AddUser(envtest.User{
+		Name:   "test-user",
+		Groups: []string{},
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create the unprivileged user: %w", err)
+	}
+
+	if env.Client, err = client.New(cfg, client.Options{Scheme: scheme}); err != nil {
+		return fmt.Errorf("failed to create the client: %w", err)
+	}
+
+	if env.NoPrivsClient, err = client.New(noPrivsUser.Config(), client.Options{Scheme: scheme}); err != nil {
+		return fmt.Errorf("failed to create the unprivileged client: %w", err)
+	}
+
+	webhookInstallOptions := &env.TestEnvironment.WebhookInstallOptions
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+		Scheme:             scheme,
+		Host:               webhookInstallOptions.LocalServingHost,
+		Port:               webhookInstallOptions.LocalServingPort,
+		CertDir:            webhookInstallOptions.LocalServingCertDir,
+		LeaderElection:     false,
+		MetricsBindAddress: "0",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create the controller manager: %w", err)
+	}
+
+	if err := serviceprovider.RegisterTokenIndexes(env.Context, mgr.GetFieldIndexer()); err != nil {
+		return fmt.Errorf("failed to register the token indexes: %w", err)
+	}
+
+	// the controllers themselves do not need the notifying token storage because they operate in the cluster
+	// the notifying token storage is only needed if changes are only made to the storage and the cluster needs to be
+	// notified about it. This only happens in OAuth service or in tests. So the test code is using notifying token
+	// storage so that the controllers can react to the changes made to the token storage by the tests but the
+	// controllers themselves use the "raw" token storage because they only write to the storage based on the conditions
+	// in the cluster.
+	env.TokenStorage = &tokenstorage.NotifyingTokenStorage{
+		Client:       env.Client,
+		TokenStorage: b.tokenStorage,
+	}
+
+	if err := env.setupControllers(mgr, config.NewLiveConfiguration(b.configuration), b.tokenStorage); err != nil {
+		return err
+	}
+
+	go func() {
+		if err := mgr.Start(env.Context); err != nil {
+			logf.FromContext(env.Context).Error(err, "failed to run the controller manager")
+		}
+	}()
+
+	if !mgr.GetCache().WaitForCacheSync(env.Context) {
+		return errManagerNotStarted
+	}
+
+	return nil
+}
+
+func (env *Environment) setupControllers(mgr ctrl.Manager, operatorCfg *config.LiveConfiguration, strg tokenstorage.TokenStorage) error {
+	factory := serviceprovider.Factory{
+		Configuration:    operatorCfg,
+		KubernetesClient: mgr.GetClient(),
+		HttpClient:       http.DefaultClient,
+		Initializers: map[config.ServiceProviderType]serviceprovider.Initializer{
+			TestServiceProviderType: {
+				Probe: serviceprovider.ProbeFunc(func(cl *http.Client, baseUrl string) (string, error) {
+					return env.TestServiceProviderProbe.Examine(cl, baseUrl)
+				}),
+				Constructor: serviceprovider.ConstructorFunc(func(f *serviceprovider.Factory, _ string) (serviceprovider.ServiceProvider, error) {
+					return env.TestServiceProvider, nil
+				}),
+			},
+		},
+		TokenStorage: strg,
+	}
+
+	reconcilers := []interface {
+		SetupWithManager(ctrl.Manager) error
+	}{
+		&controllers.SPIAccessTokenReconciler{
+			Client:                 mgr.GetClient(),
+			Scheme:                 mgr.GetScheme(),
+			TokenStorage:           strg,
+			Configuration:          operatorCfg,
+			ServiceProviderFactory: factory,
+		},
+		&controllers.SPIAccessTokenBindingReconciler{
+			Client:                 mgr.GetClient(),
+			Scheme:                 mgr.GetScheme(),
+			TokenStorage:           strg,
+			ServiceProviderFactory: factory,
+		},
+		&controllers.SPIAccessibilityReportReconciler{
+			Client:                 mgr.GetClient(),
+			Scheme:                 mgr.GetScheme(),
+			ServiceProviderFactory: factory,
+		},
+		&controllers.SPIAccessTokenDataUpdateReconciler{
+			Client: mgr.GetClient(),
+		},
+		&controllers.SPIAccessCheckReconciler{
+			Client:                 mgr.GetClient(),
+			Scheme:                 mgr.GetScheme(),
+			ServiceProviderFactory: factory,
+			Configuration:          operatorCfg,
+		},
+		&controllers.SPIRepositoryDiscoveryReconciler{
+			Client:                 mgr.GetClient(),
+			Scheme:                 mgr.GetScheme(),
+			ServiceProviderFactory: factory,
+			Configuration:          operatorCfg,
+		},
+		&controllers.SPIRepositoryWebhookReconciler{
+			Client:                 mgr.GetClient(),
+			Scheme:                 mgr.GetScheme(),
+			ServiceProviderFactory: factory,
+		},
+	}
+
+	for _, r := range reconcilers {
+		if err := r.SetupWithManager(mgr); err != nil {
+			return fmt.Errorf("failed to set up the controller: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Stop stops the controllers and the API server.
+func (env *Environment) Stop() error {
+	env.Cancel()
+	if err := env.TestEnvironment.Stop(); err != nil {
+		return fmt.Errorf("failed to stop the test environment: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spitesting
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMemoryTokenStorage(t *testing.T) {
+	strg := &MemoryTokenStorage{}
+	owner := &api.SPIAccessToken{ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "ns"}}
+	other := &api.SPIAccessToken{ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "other"}}
+
+	data, err := strg.Get(context.TODO(), owner)
+	assert.NoError(t, err)
+	assert.Nil(t, data)
+
+	token := &api.Token{AccessToken: "42"}
+	assert.NoError(t, strg.Store(context.TODO(), owner, token))
+	token.AccessToken = "changed"
+
+	data, err = strg.Get(context.TODO(), owner)
+	assert.NoError(t, err)
+	assert.Equal(t, "42", data.AccessToken)
+
+	data, err = strg.Get(context.TODO(), other)
+	assert.NoError(t, err)
+	assert.Nil(t, data)
+
+	assert.NoError(t, strg.Delete(context.TODO(), owner))
+	data, err = strg.Get(context.TODO(), owner)
+	assert.NoError(t, err)
+	assert.Nil(t, data)
+}
+
+func TestNewEnvironment(t *testing.T) {
+	b := NewEnvironment()
+
+	assert.DirExists(t, CRDDirectoryPath())
+	assert.Equal(t, TestServiceProviderType, b.configuration.ServiceProviders[0].ServiceProviderType)
+
+	baseUrl, err := b.probe.Examine(nil, "test-provider://acme/repo")
+	assert.NoError(t, err)
+	assert.Equal(t, TestServiceProviderBaseUrl, baseUrl)
+
+	baseUrl, err = b.probe.Examine(nil, "https://github.com/acme/repo")
+	assert.NoError(t, err)
+	assert.Empty(t, baseUrl)
+
+	b.WithCRDDirectoryPaths("my/crds")
+	assert.Equal(t, []string{CRDDirectoryPath(), "my/crds"}, b.crdDirectoryPaths)
+}
@@ -12,7 +12,10 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package integrationtests
+//go:build !release
+// +build !release
+
+package spitesting
 
 import (
 	"context"
@@ -27,17 +30,21 @@ import (
 // supplying custom implementations of each of the interface methods. It provides dummy implementations of them, too, so
 // that no null pointer dereferences should occur under normal operation.
 type TestServiceProvider struct {
-	LookupTokenImpl           func(context.Context, client.Client, *api.SPIAccessTokenBinding) (*api.SPIAccessToken, error)
-	PersistMetadataImpl       func(context.Context, client.Client, *api.SPIAccessToken) error
-	GetBaseUrlImpl            func() string
-	TranslateToScopesImpl     func(permission api.Permission) []string
-	GetTypeImpl               func() api.ServiceProviderType
-	GetOauthEndpointImpl      func() string
-	CheckRepositoryAccessImpl func(context.Context, client.Client, *api.SPIAccessCheck) (*api.SPIAccessCheckStatus, error)
-	MapTokenImpl              func(context.Context, *api.SPIAccessTokenBinding, *api.SPIAccessToken, *api.Token) (serviceprovider.AccessTokenMapper, error)
-	ValidateImpl              func(context.Context, serviceprovider.Validated) (serviceprovider.ValidationResult, error)
+	LookupTokenImpl            func(context.Context, client.Client, *api.SPIAccessTokenBinding) (*api.SPIAccessToken, error)
+	PersistMetadataImpl        func(context.Context, client.Client, *api.SPIAccessToken) error
+	GetBaseUrlImpl             func() string
+	TranslateToScopesImpl      func(permission api.Permission) []string
+	GetTypeImpl                func() api.ServiceProviderType
+	GetOauthEndpointImpl       func() string
+	CheckRepositoryAccessImpl  func(context.Context, client.Client, *api.SPIAccessCheck) (*api.SPIAccessCheckStatus, error)
+	MapTokenImpl               func(context.Context, *api.SPIAccessTokenBinding, *api.SPIAccessToken, *api.Token) (serviceprovider.AccessTokenMapper, error)
+	ValidateImpl               func(context.Context, serviceprovider.Validated) (serviceprovider.ValidationResult, error)
+	ValidateCredentialsImpl    func(context.Context, *api.Token) error
+	GetAccessibleResourcesImpl func(context.Context, *api.SPIAccessToken) (serviceprovider.AccessibleResources, error)
 }
 
+var _ serviceprovider.ServiceProvider = (*TestServiceProvider)(nil)
+
 func (t TestServiceProvider) CheckRepositoryAccess(ctx context.Context, cl client.Client, accessCheck *api.SPIAccessCheck) (*api.SPIAccessCheckStatus, error) {
 	if t.CheckRepositoryAccessImpl == nil {
 		return &api.SPIAccessCheckStatus{}, nil
@@ -104,6 +111,23 @@ func (t TestServiceProvider) Validate(ctx context.Context, validated serviceprov
 	return t.ValidateImpl(ctx, validated)
 }
 
+func (t TestServiceProvider) ValidateCredentials(ctx context.Context, tokenData *api.Token) error {
+	if t.ValidateCredentialsImpl == nil {
+		return nil
+	}
+
+	return t.ValidateCredentialsImpl(ctx, tokenData)
+}
+
+func (t TestServiceProvider) GetAccessibleResources(ctx context.Context, token *api.SPIAccessToken) (serviceprovider.AccessibleResources, error) {
+	if t.GetAccessibleResourcesImpl == nil {
+		return serviceprovider.AccessibleResources{}, nil
+	}
+
+	return t.GetAccessibleResourcesImpl(ctx, token)
+}
+
+// Reset clears all the custom implementations so that the dummy ones are used again.
 func (t *TestServiceProvider) Reset() {
 	t.LookupTokenImpl = nil
 	t.GetBaseUrlImpl = nil
@@ -114,6 +138,8 @@ func (t *TestServiceProvider) Reset() {
 	t.CheckRepositoryAccessImpl = nil
 	t.MapTokenImpl = nil
 	t.ValidateImpl = nil
+	t.ValidateCredentialsImpl = nil
+	t.GetAccessibleResourcesImpl = nil
 }
 
 // LookupConcreteToken returns a function that can be used as the TestServiceProvider.LookupTokenImpl that just returns
@@ -0,0 +1,69 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !release
+// +build !release
+
+package spitesting
+
+import (
+	"context"
+	"sync"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/tokenstorage"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// MemoryTokenStorage is a token storage keeping the token data in memory. It is meant to replace Vault in the tests that
+// don't need to exercise the real token storage. Unlike the real storages, it doesn't keep the previous versions of
+// the token data. The zero value is ready to use.
+type MemoryTokenStorage struct {
+	lock   sync.RWMutex
+	tokens map[client.ObjectKey]*api.Token
+}
+
+var _ tokenstorage.TokenStorage = (*MemoryTokenStorage)(nil)
+
+func (m *MemoryTokenStorage) Store(_ context.Context, owner *api.SPIAccessToken, token *api.Token) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.tokens == nil {
+		m.tokens = map[client.ObjectKey]*api.Token{}
+	}
+
+	m.tokens[client.ObjectKeyFromObject(owner)] = token.DeepCopy()
+	return nil
+}
+
+func (m *MemoryTokenStorage) Get(_ context.Context, owner *api.SPIAccessToken) (*api.Token, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	token, ok := m.tokens[client.ObjectKeyFromObject(owner)]
+	if !ok {
+		return nil, nil
+	}
+
+	return token.DeepCopy(), nil
+}
+
+func (m *MemoryTokenStorage) Delete(_ context.Context, owner *api.SPIAccessToken) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	delete(m.tokens, client.ObjectKeyFromObject(owner))
+	return nil
+}
@@ -0,0 +1,416 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package stateoffload keeps the SPIAccessTokens small by moving the large service provider states out of their status.
+package stateoffload
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	stderrors "errors"
+	"fmt"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// SecretNamePrefix is the prefix of the names of the secrets holding the states moved out of the tokens. The rest
+	// of the name is the name of the token.
+	SecretNamePrefix = "spi-state-"
+	// stateKey is the key of the state in the secret.
+	stateKey = "state"
+	// refPrefix is the prefix of the ServiceProviderStateRef, identifying the hash function.
+	refPrefix = "sha256:"
+)
+
+// ErrStateSecretNotOwned is returned when the secret the state of a token would be moved to exists, but is not owned
+// by the token, e.g. because the user created a secret with the same name.
+var ErrStateSecretNotOwned = stderrors.New("the secret for the service provider state exists and is not owned by the token")
+
+// Client is a client.Client that moves the ServiceProviderState of the SPIAccessTokens larger than the SizeLimit out
+// of their status when the status is written and loads it back when the tokens are read. The state is kept in
+// a secret owned by the token and the status only references it by the hash of its content. Thanks to the hash,
+// the secret is only written when the state changes and the state is never read from a secret that doesn't match
+// the status. The secret is deleted once the state fits into the status again. The secrets not owned by the token are
+// never overwritten nor deleted.
+//
+// The rest of the code therefore always works with the tokens with the full state. If the secret with the state is
+// lost, the metadata of the token is dropped so that it gets fetched from the service provider again.
+type Client struct {
+	client.Client
+	// SizeLimit is the maximum size of the state kept in the status. 0 means the states are never moved out of
+	// the status, the states moved out before are still loaded.
+	SizeLimit int
+}
+
+var _ client.Client = (*Client)(nil)
+
+func (c *Client) Get(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	if err := c.Client.Get(ctx, key, obj); err != nil {
+		return err
+	}
+	return c.load(ctx, obj)
+}
+
+func (c *Client) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	if err := c.Client.List(ctx, list, opts...); err != nil {
+		return err
+	}
+
+	if tokens, ok := list.(*api.SPIAccessTokenList); ok {
+		for i := range tokens.Items {
+			if err := c.load(ctx, &tokens.Items[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Client) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if err := c.Client.Create(ctx, obj, opts...); err != nil {
+		return err
+	}
+	return c.load(ctx, obj)
+}
+
+// Update updates the object. The status is not written by the updates of the tokens, but the status returned by
+// the cluster replaces the status of the object.
+func (c *Client) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	state := keepState(obj)
+	if err := c.Client.Update(ctx, obj, opts...); err != nil {
+		return err
+	}
+	return c.restoreOrLoad(ctx, obj, state)
+}
+
+func (c *Client) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	state := keepState(obj)
+	if err := c.Client.Patch(ctx, obj, patch, opts...); err != nil {
+		return err
+	}
+	return c.restoreOrLoad(ctx, obj, state)
+}
+
+func (c *Client) Status() client.StatusWriter {
+	return &statusWriter{StatusWriter: c.Client.Status(), client: c}
+}
+
+// statusWriter moves the large states out of the written statuses of the tokens.
+type statusWriter struct {
+	client.StatusWriter
+	client *Client
+}
+
+func (w *statusWriter) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	state, staleRef, err := w.client.offload(ctx, obj)
+	if err != nil {
+		return err
+	}
+	if err := w.StatusWriter.Update(ctx, obj, opts...); err != nil {
+		return err
+	}
+	if staleRef {
+		w.client.deleteState(ctx, obj)
+	}
+	return w.client.restoreOrLoad(ctx, obj, state)
+}
+
+func (w *statusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	state, staleRef, err := w.client.offload(ctx, obj)
+	if err != nil {
+		return err
+	}
+	if err := w.StatusWriter.Patch(ctx, obj, patch, opts...); err != nil {
+		return err
+	}
+	if staleRef {
+		w.client.deleteState(ctx, obj)
+	}
+	return w.client.restoreOrLoad(ctx, obj, state)
+}
+
+// StateRef returns the reference of the state, i.e. the hash of its content.
+func StateRef(state []byte) string {
+	hash := sha256.Sum256(state)
+	return refPrefix + hex.EncodeToString(hash[:])
+}
+
+// keptState is the state of the token that was in the object before it was written to the cluster, so that it can be
+// put back to the object returned from the cluster.
+type keptState struct {
+	ref   string
+	state []byte
+}
+
+// keepState returns the state of the token or nil if the object is not a token or has no state.
+func keepState(obj client.Object) *keptState {
+	ref, state := stateOf(obj)
+	if len(state) == 0 {
+		return nil
+	}
+	if ref == "" {
+		ref = StateRef(state)
+	}
+	return &keptState{ref: ref, state: state}
+}
+
+// offload moves the state of the token to the secret if it is larger than the size limit and replaces it with
+// the reference to the secret. Returns the offloaded state that needs to be restored once the status is written and
+// whether the state moved back to the status, so that the secret can be deleted once the status is written.
+func (c *Client) offload(ctx context.Context, obj client.Object) (*keptState, bool, error) {
+	ref, state := stateOf(obj)
+	if len(state) == 0 {
+		return nil, false, nil
+	}
+
+	if c.SizeLimit <= 0 || len(state) <= c.SizeLimit {
+		// the state fits into the status, the reference to the secret would be stale
+		setState(obj, "", state)
+		return nil, ref != "", nil
+	}
+
+	newRef := StateRef(state)
+	if newRef != ref {
+		// the secret only needs to be written if the state changed since it was loaded
+		if err := c.storeState(ctx, obj, state); err != nil {
+			return nil, false, err
+		}
+		log.FromContext(ctx).V(1).Info("moved the service provider state out of the status of the token", "size", len(state), "ref", newRef)
+	}
+
+	setState(obj, newRef, nil)
+	return &keptState{ref: newRef, state: state}, false, nil
+}
+
+// restoreOrLoad puts the state back to the object returned from the cluster if the object still references it.
+// Otherwise, the state referenced by the object is loaded.
+func (c *Client) restoreOrLoad(ctx context.Context, obj client.Object, kept *keptState) error {
+	if kept != nil {
+		if ref, state := stateOf(obj); ref == kept.ref && len(state) == 0 {
+			setState(obj, ref, kept.state)
+			return nil
+		}
+	}
+	return c.load(ctx, obj)
+}
+
+// load loads the state referenced by the token from the secret. If the secret is missing or holds a different state,
+// the metadata of the token is dropped so that it is fetched from the service provider again.
+func (c *Client) load(ctx context.Context, obj client.Object) error {
+	token, ok := obj.(*api.SPIAccessToken)
+	if !ok || token.Status.TokenMetadata == nil {
+		return nil
+	}
+	metadata := token.Status.TokenMetadata
+	if metadata.ServiceProviderStateRef == "" || len(metadata.ServiceProviderState) > 0 {
+		return nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := c.Client.Get(ctx, client.ObjectKey{Name: SecretNamePrefix + token.Name, Namespace: token.Namespace}, secret); err != nil {
+		if !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to read the service provider state of the token: %w", err)
+		}
+	} else if state := secret.Data[stateKey]; StateRef(state) == metadata.ServiceProviderStateRef {
+		metadata.ServiceProviderState = state
+		return nil
+	}
+
+	log.FromContext(ctx).Info("the service provider state of the token is lost, dropping the metadata so that it is refreshed", "token", token.Name, "ref", metadata.ServiceProviderStateRef)
+	token.Status.TokenMetadata = nil
+	return nil
+}
+
+// storeState writes the state to the secret owned by the token. Fails with ErrStateSecretNotOwned if the secret exists
+// and is not owned by the token.
+func (c *Client) storeState(ctx context.Context, obj client.Object, state []byte) error {
+	uid, err := c.tokenUID(ctx, obj)
+	if err != nil {
+		return err
+	}
+
+	secret := &corev1.Secret{}
+	key := client.ObjectKey{Name: SecretNamePrefix + obj.GetName(), Namespace: obj.GetNamespace()}
+	if err := c.Client.Get(ctx, key, secret); err != nil {
+		if !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to read the secret with the service provider state: %w", err)
+		}
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			Type:       corev1.SecretTypeOpaque,
+		}
+		ownState(secret, obj.GetName(), uid, state)
+		if err := c.Client.Create(ctx, secret); err != nil {
+			if errors.IsAlreadyExists(err) {
+				// created by someone else since we read it, it cannot be ours
+				return fmt.Errorf("%w: %s", ErrStateSecretNotOwned, key.Name)
+			}
+			return fmt.Errorf("failed to create the secret with the service provider state: %w", err)
+		}
+		return nil
+	}
+
+	if !ownedBy(secret, uid) {
+		return fmt.Errorf("%w: %s", ErrStateSecretNotOwned, key.Name)
+	}
+
+	ownState(secret, obj.GetName(), uid, state)
+	if err := c.Client.Update(ctx, secret); err != nil {
+		return fmt.Errorf("failed to update the secret with the service provider state: %w", err)
+	}
+	return nil
+}
+
+// deleteState deletes the secret with the state of the token once the state is back in the status. The failures are
+// only logged, because the status is already written and the secret is deleted together with the token anyway.
+func (c *Client) deleteState(ctx context.Context, obj client.Object) {
+	lg := log.FromContext(ctx)
+
+	uid, err := c.tokenUID(ctx, obj)
+	if err != nil {
+		lg.Error(err, "failed to delete the stale secret with the service provider state")
+		return
+	}
+
+	secret := &corev1.Secret{}
+	if err := c.Client.Get(ctx, client.ObjectKey{Name: SecretNamePrefix + obj.GetName(), Namespace: obj.GetNamespace()}, secret); err != nil {
+		if !errors.IsNotFound(err) {
+			lg.Error(err, "failed to read the stale secret with the service provider state")
+		}
+		return
+	}
+
+	if !ownedBy(secret, uid) {
+		return
+	}
+
+	if err := c.Client.Delete(ctx, secret, client.Preconditions{UID: &secret.UID}); err != nil && !errors.IsNotFound(err) {
+		lg.Error(err, "failed to delete the stale secret with the service provider state")
+		return
+	}
+	lg.V(1).Info("moved the service provider state back to the status of the token", "secret", secret.Name)
+}
+
+// tokenUID returns the UID of the token, reading the token if the object doesn't carry it.
+func (c *Client) tokenUID(ctx context.Context, obj client.Object) (types.UID, error) {
+	if uid := obj.GetUID(); uid != "" {
+		return uid, nil
+	}
+
+	// the applied statuses only carry the name of the token
+	token := &api.SPIAccessToken{}
+	if err := c.Client.Get(ctx, client.ObjectKeyFromObject(obj), token); err != nil {
+		return "", fmt.Errorf("failed to read the token of the service provider state: %w", err)
+	}
+	return token.UID, nil
+}
+
+// ownedBy checks that the secret is a managed secret owned by the token with the provided UID.
+func ownedBy(secret *corev1.Secret, uid types.UID) bool {
+	if secret.Labels[config.ManagedSecretLabel] != config.ManagedSecretLabelValue {
+		return false
+	}
+	for _, ref := range secret.OwnerReferences {
+		if ref.UID == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// ownState puts the state into the secret and makes the token its owner, so that the secret is deleted together with
+// the token.
+func ownState(secret *corev1.Secret, tokenName string, uid types.UID, state []byte) {
+	if secret.Labels == nil {
+		secret.Labels = map[string]string{}
+	}
+	secret.Labels[config.ManagedSecretLabel] = config.ManagedSecretLabelValue
+	secret.Data = map[string][]byte{stateKey: state}
+	secret.OwnerReferences = []metav1.OwnerReference{
+		{
+			APIVersion: api.GroupVersion.String(),
+			Kind:       "SPIAccessToken",
+			Name:       tokenName,
+			UID:        uid,
+		},
+	}
+}
+
+// stateOf returns the state reference and the state of the token, either typed or unstructured (as written by
+// the status applies).
+func stateOf(obj client.Object) (string, []byte) {
+	switch o := obj.(type) {
+	case *api.SPIAccessToken:
+		if o.Status.TokenMetadata == nil {
+			return "", nil
+		}
+		return o.Status.TokenMetadata.ServiceProviderStateRef, o.Status.TokenMetadata.ServiceProviderState
+	case *unstructured.Unstructured:
+		if !isToken(o) {
+			return "", nil
+		}
+		ref, _, _ := unstructured.NestedString(o.Object, "status", "tokenMetadata", "serviceProviderStateRef")
+		encoded, _, _ := unstructured.NestedString(o.Object, "status", "tokenMetadata", "serviceProviderState")
+		state, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return ref, nil
+		}
+		return ref, state
+	default:
+		return "", nil
+	}
+}
+
+// setState sets the state reference and the state of the token, either typed or unstructured. Only the tokens with
+// metadata are changed.
+func setState(obj client.Object, ref string, state []byte) {
+	switch o := obj.(type) {
+	case *api.SPIAccessToken:
+		if o.Status.TokenMetadata != nil {
+			o.Status.TokenMetadata.ServiceProviderStateRef = ref
+			o.Status.TokenMetadata.ServiceProviderState = state
+		}
+	case *unstructured.Unstructured:
+		metadata, ok, _ := unstructured.NestedMap(o.Object, "status", "tokenMetadata")
+		if !isToken(o) || !ok {
+			return
+		}
+		if ref == "" {
+			delete(metadata, "serviceProviderStateRef")
+		} else {
+			metadata["serviceProviderStateRef"] = ref
+		}
+		if len(state) == 0 {
+			delete(metadata, "serviceProviderState")
+		} else {
+			metadata["serviceProviderState"] = base64.StdEncoding.EncodeToString(state)
+		}
+		_ = unstructured.SetNestedMap(o.Object, metadata, "status", "tokenMetadata")
+	}
+}
+
+func isToken(obj *unstructured.Unstructured) bool {
+	return obj.GroupVersionKind() == api.GroupVersion.WithKind("SPIAccessToken")
+}
@@ -0,0 +1,181 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stateoffload
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/statusupdate"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var largeState = []byte(strings.Repeat("x", 100))
+var smallState = []byte("small")
+
+func testClient(t *testing.T, objs ...client.Object) (*Client, client.Client) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, api.AddToScheme(sch))
+	assert.NoError(t, corev1.AddToScheme(sch))
+
+	inner := fake.NewClientBuilder().WithScheme(sch).WithObjects(objs...).Build()
+	return &Client{Client: statusupdate.FakeApplyClient{Client: inner}, SizeLimit: 10}, inner
+}
+
+func testToken() *api.SPIAccessToken {
+	return &api.SPIAccessToken{
+		ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "ns", UID: "token-uid"},
+	}
+}
+
+func stateSecret(cl client.Client) *corev1.Secret {
+	secret := &corev1.Secret{}
+	if err := cl.Get(context.TODO(), client.ObjectKey{Name: "spi-state-token", Namespace: "ns"}, secret); err != nil {
+		return nil
+	}
+	return secret
+}
+
+func TestClient_OffloadsLargeStates(t *testing.T) {
+	cl, inner := testClient(t, testToken())
+
+	token := &api.SPIAccessToken{}
+	assert.NoError(t, cl.Get(context.TODO(), client.ObjectKey{Name: "token", Namespace: "ns"}, token))
+	token.Status.TokenMetadata = &api.TokenMetadata{Username: "alois", ServiceProviderState: largeState}
+	assert.NoError(t, statusupdate.Apply(context.TODO(), cl, token))
+
+	// the caller keeps working with the full state
+	assert.Equal(t, largeState, token.Status.TokenMetadata.ServiceProviderState)
+	assert.Equal(t, StateRef(largeState), token.Status.TokenMetadata.ServiceProviderStateRef)
+
+	// the cluster only has the reference
+	stored := &api.SPIAccessToken{}
+	assert.NoError(t, inner.Get(context.TODO(), client.ObjectKey{Name: "token", Namespace: "ns"}, stored))
+	assert.Empty(t, stored.Status.TokenMetadata.ServiceProviderState)
+	assert.Equal(t, StateRef(largeState), stored.Status.TokenMetadata.ServiceProviderStateRef)
+
+	secret := stateSecret(inner)
+	assert.NotNil(t, secret)
+	assert.Equal(t, largeState, secret.Data["state"])
+	assert.Equal(t, "true", secret.Labels["spi.appstudio.redhat.com/managed"])
+	assert.Equal(t, "token-uid", string(secret.OwnerReferences[0].UID))
+
+	// the reads load the state
+	read := &api.SPIAccessToken{}
+	assert.NoError(t, cl.Get(context.TODO(), client.ObjectKey{Name: "token", Namespace: "ns"}, read))
+	assert.Equal(t, largeState, read.Status.TokenMetadata.ServiceProviderState)
+
+	list := &api.SPIAccessTokenList{}
+	assert.NoError(t, cl.List(context.TODO(), list))
+	assert.Equal(t, largeState, list.Items[0].Status.TokenMetadata.ServiceProviderState)
+}
+
+func TestClient_KeepsSmallStates(t *testing.T) {
+	cl, inner := testClient(t, testToken())
+
+	token := &api.SPIAccessToken{}
+	assert.NoError(t, cl.Get(context.TODO(), client.ObjectKey{Name: "token", Namespace: "ns"}, token))
+	token.Status.TokenMetadata = &api.TokenMetadata{ServiceProviderState: largeState}
+	assert.NoError(t, cl.Status().Update(context.TODO(), token))
+	assert.Equal(t, largeState, token.Status.TokenMetadata.ServiceProviderState)
+	assert.NotNil(t, stateSecret(inner))
+
+	// the state shrinks and moves back to the status
+	token.Status.TokenMetadata.ServiceProviderState = smallState
+	assert.NoError(t, cl.Status().Update(context.TODO(), token))
+	assert.Nil(t, stateSecret(inner))
+
+	stored := &api.SPIAccessToken{}
+	assert.NoError(t, inner.Get(context.TODO(), client.ObjectKey{Name: "token", Namespace: "ns"}, stored))
+	assert.Equal(t, smallState, stored.Status.TokenMetadata.ServiceProviderState)
+	assert.Empty(t, stored.Status.TokenMetadata.ServiceProviderStateRef)
+}
+
+func TestClient_DoesNotTakeOverUnownedSecret(t *testing.T) {
+	userSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "spi-state-token", Namespace: "ns"},
+		Data:       map[string][]byte{"password": []byte("hunter2")},
+	}
+	cl, inner := testClient(t, testToken(), userSecret)
+
+	token := &api.SPIAccessToken{}
+	assert.NoError(t, cl.Get(context.TODO(), client.ObjectKey{Name: "token", Namespace: "ns"}, token))
+	token.Status.TokenMetadata = &api.TokenMetadata{ServiceProviderState: largeState}
+	assert.ErrorIs(t, cl.Status().Update(context.TODO(), token), ErrStateSecretNotOwned)
+
+	secret := stateSecret(inner)
+	assert.Equal(t, []byte("hunter2"), secret.Data["password"])
+	assert.Empty(t, secret.OwnerReferences)
+
+	// nor deletes it when the state fits into the status
+	stored := &api.SPIAccessToken{}
+	assert.NoError(t, inner.Get(context.TODO(), client.ObjectKey{Name: "token", Namespace: "ns"}, stored))
+	stored.Status.TokenMetadata = &api.TokenMetadata{ServiceProviderState: smallState, ServiceProviderStateRef: StateRef(largeState)}
+	assert.NoError(t, cl.Status().Update(context.TODO(), stored))
+	assert.NotNil(t, stateSecret(inner))
+}
+
+func TestClient_DisabledSizeLimit(t *testing.T) {
+	cl, inner := testClient(t, testToken())
+	cl.SizeLimit = 0
+
+	token := &api.SPIAccessToken{}
+	assert.NoError(t, cl.Get(context.TODO(), client.ObjectKey{Name: "token", Namespace: "ns"}, token))
+	token.Status.TokenMetadata = &api.TokenMetadata{ServiceProviderState: largeState}
+	assert.NoError(t, cl.Status().Update(context.TODO(), token))
+
+	stored := &api.SPIAccessToken{}
+	assert.NoError(t, inner.Get(context.TODO(), client.ObjectKey{Name: "token", Namespace: "ns"}, stored))
+	assert.Equal(t, largeState, stored.Status.TokenMetadata.ServiceProviderState)
+	assert.Nil(t, stateSecret(inner))
+}
+
+func TestClient_DropsMetadataWithLostState(t *testing.T) {
+	token := testToken()
+	token.Status.TokenMetadata = &api.TokenMetadata{ServiceProviderStateRef: StateRef(largeState)}
+	cl, inner := testClient(t, token)
+
+	read := &api.SPIAccessToken{}
+	assert.NoError(t, cl.Get(context.TODO(), client.ObjectKey{Name: "token", Namespace: "ns"}, read))
+	assert.Nil(t, read.Status.TokenMetadata)
+
+	// a secret with a different state is not used either
+	assert.NoError(t, inner.Create(context.TODO(), &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "spi-state-token", Namespace: "ns"},
+		Data:       map[string][]byte{"state": smallState},
+	}))
+	assert.NoError(t, cl.Get(context.TODO(), client.ObjectKey{Name: "token", Namespace: "ns"}, read))
+	assert.Nil(t, read.Status.TokenMetadata)
+}
+
+func TestClient_UpdateKeepsState(t *testing.T) {
+	cl, _ := testClient(t, testToken())
+
+	token := &api.SPIAccessToken{}
+	assert.NoError(t, cl.Get(context.TODO(), client.ObjectKey{Name: "token", Namespace: "ns"}, token))
+	token.Status.TokenMetadata = &api.TokenMetadata{ServiceProviderState: largeState}
+	assert.NoError(t, cl.Status().Update(context.TODO(), token))
+
+	token.Labels = map[string]string{"a": "b"}
+	assert.NoError(t, cl.Update(context.TODO(), token))
+	assert.Equal(t, largeState, token.Status.TokenMetadata.ServiceProviderState)
+}
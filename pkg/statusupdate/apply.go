@@ -0,0 +1,174 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package statusupdate writes the statuses of the SPI objects using the server-side apply, so that the operator
+// only owns the status fields and the writes don't need to replace the whole object.
+package statusupdate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+)
+
+// FieldManager is the name of the field manager the statuses are applied as.
+const FieldManager = "spi-operator"
+
+// Apply writes the status of the provided object to the cluster using the server-side apply and updates the object
+// with the response. The resource version of the object is part of the applied configuration, so the apply fails
+// with a conflict if the object changed in the meantime, the same way the status update would.
+func Apply(ctx context.Context, cl client.Client, obj client.Object) error {
+	gvk, err := apiutil.GVKForObject(obj, cl.Scheme())
+	if err != nil {
+		return fmt.Errorf("failed to determine the kind of the object: %w", err)
+	}
+
+	if err := claimStatusFields(ctx, cl, obj, gvk.GroupVersion().String(), gvk.Kind); err != nil {
+		return err
+	}
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return fmt.Errorf("failed to convert the object to unstructured: %w", err)
+	}
+
+	// only the status is applied, so that the field manager doesn't claim the ownership of the fields of the spec
+	// that the status writes cannot change anyway.
+	applied := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	applied.SetGroupVersionKind(gvk)
+	applied.SetName(obj.GetName())
+	applied.SetNamespace(obj.GetNamespace())
+	// claiming the fields might have changed the resource version, so it is only read now
+	applied.SetResourceVersion(obj.GetResourceVersion())
+	if status, ok := content["status"]; ok {
+		applied.Object["status"] = status
+	}
+
+	if err := cl.Status().Patch(ctx, applied, client.Apply, client.FieldOwner(FieldManager), client.ForceOwnership); err != nil {
+		return fmt.Errorf("failed to apply the status: %w", err)
+	}
+
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(applied.UnstructuredContent(), obj); err != nil {
+		return fmt.Errorf("failed to convert the applied object: %w", err)
+	}
+
+	return nil
+}
+
+// claimStatusFields transfers the ownership of the status fields written by the status updates to the FieldManager.
+// The objects created before the statuses were applied have their status fields owned by the update operations.
+// The apply could neither remove such fields nor change them without conflicts, so the ownership is transferred once
+// before the first apply. The object is updated with the new resource version and managed fields.
+func claimStatusFields(ctx context.Context, cl client.Client, obj client.Object, apiVersion string, kind string) error {
+	managedFields, changed, err := claimStatusManagedFields(obj.GetManagedFields(), apiVersion)
+	if err != nil || !changed {
+		return err
+	}
+
+	patch, err := json.Marshal([]map[string]interface{}{
+		{"op": "test", "path": "/metadata/resourceVersion", "value": obj.GetResourceVersion()},
+		{"op": "replace", "path": "/metadata/managedFields", "value": managedFields},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to serialize the managed fields patch: %w", err)
+	}
+
+	meta := &metav1.PartialObjectMetadata{}
+	meta.APIVersion = apiVersion
+	meta.Kind = kind
+	meta.Name = obj.GetName()
+	meta.Namespace = obj.GetNamespace()
+	if err := cl.Patch(ctx, meta, client.RawPatch(types.JSONPatchType, patch)); err != nil {
+		return fmt.Errorf("failed to claim the ownership of the status fields: %w", err)
+	}
+
+	obj.SetResourceVersion(meta.ResourceVersion)
+	obj.SetManagedFields(meta.ManagedFields)
+
+	return nil
+}
+
+// claimStatusManagedFields merges the managed fields entries of the update operations of the status into the entry of
+// the FieldManager applying the status. It returns the new managed fields and whether they differ from the provided
+// ones.
+func claimStatusManagedFields(entries []metav1.ManagedFieldsEntry, apiVersion string) ([]metav1.ManagedFieldsEntry, bool, error) {
+	isStatusUpdate := func(e *metav1.ManagedFieldsEntry) bool {
+		return e.Operation == metav1.ManagedFieldsOperationUpdate && e.Subresource == "status"
+	}
+	isStatusApply := func(e *metav1.ManagedFieldsEntry) bool {
+		return e.Operation == metav1.ManagedFieldsOperationApply && e.Subresource == "status" && e.Manager == FieldManager
+	}
+
+	claimed := &fieldpath.Set{}
+	var applyEntry *metav1.ManagedFieldsEntry
+	result := make([]metav1.ManagedFieldsEntry, 0, len(entries))
+	changed := false
+	for i := range entries {
+		e := &entries[i]
+		if !isStatusUpdate(e) && !isStatusApply(e) {
+			result = append(result, *e)
+			continue
+		}
+
+		if isStatusUpdate(e) {
+			changed = true
+		} else {
+			applyEntry = e
+		}
+
+		if e.FieldsV1 == nil {
+			continue
+		}
+		fields := &fieldpath.Set{}
+		if err := fields.FromJSON(bytes.NewReader(e.FieldsV1.Raw)); err != nil {
+			return nil, false, fmt.Errorf("failed to parse the managed fields of %s: %w", e.Manager, err)
+		}
+		claimed = claimed.Union(fields)
+	}
+
+	if !changed {
+		return entries, false, nil
+	}
+
+	raw, err := claimed.ToJSON()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to serialize the claimed fields: %w", err)
+	}
+
+	claim := metav1.ManagedFieldsEntry{
+		Manager:     FieldManager,
+		Operation:   metav1.ManagedFieldsOperationApply,
+		APIVersion:  apiVersion,
+		FieldsType:  "FieldsV1",
+		FieldsV1:    &metav1.FieldsV1{Raw: raw},
+		Subresource: "status",
+	}
+	if applyEntry != nil {
+		claim.Time = applyEntry.Time
+	} else {
+		now := metav1.Now()
+		claim.Time = &now
+	}
+
+	return append(result, claim), true, nil
+}
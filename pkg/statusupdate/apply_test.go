@@ -0,0 +1,140 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statusupdate
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type recordingStatusWriter struct {
+	client.StatusWriter
+	applied *unstructured.Unstructured
+}
+
+func (w *recordingStatusWriter) Patch(_ context.Context, obj client.Object, _ client.Patch, _ ...client.PatchOption) error {
+	w.applied = obj.(*unstructured.Unstructured).DeepCopy()
+	return nil
+}
+
+type recordingClient struct {
+	client.Client
+	writer *recordingStatusWriter
+}
+
+func (c recordingClient) Status() client.StatusWriter {
+	return c.writer
+}
+
+func TestApply(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, api.AddToScheme(sch))
+
+	token := &api.SPIAccessToken{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "token",
+			Namespace:       "default",
+			ResourceVersion: "42",
+			Labels:          map[string]string{"a": "b"},
+		},
+		Spec: api.SPIAccessTokenSpec{
+			ServiceProviderUrl: "https://github.com",
+		},
+		Status: api.SPIAccessTokenStatus{
+			Phase: api.SPIAccessTokenPhaseReady,
+		},
+	}
+
+	cl := recordingClient{Client: fake.NewClientBuilder().WithScheme(sch).Build(), writer: &recordingStatusWriter{}}
+
+	assert.NoError(t, Apply(context.TODO(), cl, token.DeepCopy()))
+
+	applied := cl.writer.applied
+	assert.Equal(t, "appstudio.redhat.com/v1beta1", applied.GetAPIVersion())
+	assert.Equal(t, "SPIAccessToken", applied.GetKind())
+	assert.Equal(t, "token", applied.GetName())
+	assert.Equal(t, "default", applied.GetNamespace())
+	assert.Equal(t, "42", applied.GetResourceVersion())
+	assert.Empty(t, applied.GetLabels())
+	assert.NotContains(t, applied.Object, "spec")
+	phase, _, _ := unstructured.NestedString(applied.Object, "status", "phase")
+	assert.Equal(t, string(api.SPIAccessTokenPhaseReady), phase)
+}
+
+func TestClaimStatusManagedFields(t *testing.T) {
+	specUpdate := metav1.ManagedFieldsEntry{
+		Manager:    "kubectl",
+		Operation:  metav1.ManagedFieldsOperationUpdate,
+		APIVersion: "appstudio.redhat.com/v1beta1",
+		FieldsType: "FieldsV1",
+		FieldsV1:   &metav1.FieldsV1{Raw: []byte(`{"f:spec":{"f:serviceProviderUrl":{}}}`)},
+	}
+	statusUpdate := metav1.ManagedFieldsEntry{
+		Manager:     "manager",
+		Operation:   metav1.ManagedFieldsOperationUpdate,
+		APIVersion:  "appstudio.redhat.com/v1beta1",
+		FieldsType:  "FieldsV1",
+		FieldsV1:    &metav1.FieldsV1{Raw: []byte(`{"f:status":{".":{},"f:phase":{}}}`)},
+		Subresource: "status",
+	}
+	statusApply := metav1.ManagedFieldsEntry{
+		Manager:     FieldManager,
+		Operation:   metav1.ManagedFieldsOperationApply,
+		APIVersion:  "appstudio.redhat.com/v1beta1",
+		FieldsType:  "FieldsV1",
+		FieldsV1:    &metav1.FieldsV1{Raw: []byte(`{"f:status":{"f:errorMessage":{}}}`)},
+		Subresource: "status",
+	}
+
+	t.Run("nothing to claim", func(t *testing.T) {
+		entries := []metav1.ManagedFieldsEntry{specUpdate, statusApply}
+		result, changed, err := claimStatusManagedFields(entries, "appstudio.redhat.com/v1beta1")
+		assert.NoError(t, err)
+		assert.False(t, changed)
+		assert.Equal(t, entries, result)
+	})
+
+	t.Run("claims the updated fields", func(t *testing.T) {
+		result, changed, err := claimStatusManagedFields([]metav1.ManagedFieldsEntry{specUpdate, statusUpdate, statusApply}, "appstudio.redhat.com/v1beta1")
+		assert.NoError(t, err)
+		assert.True(t, changed)
+		assert.Len(t, result, 2)
+		assert.Equal(t, specUpdate, result[0])
+
+		claim := result[1]
+		assert.Equal(t, FieldManager, claim.Manager)
+		assert.Equal(t, metav1.ManagedFieldsOperationApply, claim.Operation)
+		assert.Equal(t, "status", claim.Subresource)
+		assert.JSONEq(t, `{"f:status":{".":{},"f:errorMessage":{},"f:phase":{}}}`, string(claim.FieldsV1.Raw))
+	})
+
+	t.Run("creates the apply entry", func(t *testing.T) {
+		result, changed, err := claimStatusManagedFields([]metav1.ManagedFieldsEntry{statusUpdate}, "appstudio.redhat.com/v1beta1")
+		assert.NoError(t, err)
+		assert.True(t, changed)
+		assert.Len(t, result, 1)
+		assert.Equal(t, FieldManager, result[0].Manager)
+		assert.NotNil(t, result[0].Time)
+		assert.JSONEq(t, `{"f:status":{".":{},"f:phase":{}}}`, string(result[0].FieldsV1.Raw))
+	})
+}
@@ -0,0 +1,71 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !release
+// +build !release
+
+package statusupdate
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// FakeApplyClient wraps the fake client of the controller-runtime, that doesn't support the server-side apply, and
+// carries out the status applies as status updates. It is meant to be used in the tests only.
+type FakeApplyClient struct {
+	client.Client
+}
+
+func (c FakeApplyClient) Status() client.StatusWriter {
+	return fakeApplyStatusWriter{StatusWriter: c.Client.Status(), client: c.Client}
+}
+
+type fakeApplyStatusWriter struct {
+	client.StatusWriter
+	client client.Client
+}
+
+func (w fakeApplyStatusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch.Type() != types.ApplyPatchType {
+		return w.StatusWriter.Patch(ctx, obj, patch, opts...)
+	}
+
+	applied, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return fmt.Errorf("only unstructured objects can be applied, got %T", obj)
+	}
+
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(applied.GroupVersionKind())
+	if err := w.client.Get(ctx, client.ObjectKeyFromObject(applied), current); err != nil {
+		return err
+	}
+	if applied.GetResourceVersion() != "" && applied.GetResourceVersion() != current.GetResourceVersion() {
+		return errors.NewConflict(current.GroupVersionKind().GroupVersion().WithResource(current.GetKind()).GroupResource(), current.GetName(), fmt.Errorf("the object has been modified"))
+	}
+
+	current.Object["status"] = applied.Object["status"]
+	if err := w.StatusWriter.Update(ctx, current); err != nil {
+		return err
+	}
+
+	applied.Object = current.Object
+	return nil
+}
@@ -0,0 +1,64 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	authnv1 "k8s.io/api/authentication/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// maxRequestBodySize limits the size of the bodies of the requests to the endpoints served by the webhook server.
+const maxRequestBodySize = 1 << 20
+
+// authenticateBearer reviews the bearer token of the request. Only the tokens issued for the audience are accepted.
+// If the audience is empty, the tokens issued for the API server are accepted. The returned status is http.StatusOK if
+// the token is authenticated.
+func authenticateBearer(r *http.Request, cl client.Client, audience string) (*authnv1.UserInfo, int, error) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return nil, http.StatusUnauthorized, nil
+	}
+
+	review := &authnv1.TokenReview{
+		Spec: authnv1.TokenReviewSpec{
+			Token: strings.TrimPrefix(auth, "Bearer "),
+		},
+	}
+	if audience != "" {
+		review.Spec.Audiences = []string{audience}
+	}
+	if err := cl.Create(r.Context(), review); err != nil {
+		return nil, 0, fmt.Errorf("failed to create the TokenReview: %w", err)
+	}
+
+	if !review.Status.Authenticated || (audience != "" && !containsString(review.Status.Audiences, audience)) {
+		return nil, http.StatusUnauthorized, nil
+	}
+
+	return &review.Status.User, http.StatusOK, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
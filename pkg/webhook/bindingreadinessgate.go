@@ -0,0 +1,90 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// BindingReadinessGateInjectorPath is the path on which the BindingReadinessGateInjector is served by the webhook
+// server.
+const BindingReadinessGateInjectorPath = "/mutate-binding-readiness-gate"
+
+//+kubebuilder:webhook:path=/mutate-binding-readiness-gate,mutating=true,failurePolicy=ignore,sideEffects=None,groups="",resources=pods,verbs=create,versions=v1,name=mbindingreadinessgate.spi.appstudio.redhat.com,admissionReviewVersions=v1
+
+// BindingReadinessGateInjector is an admission handler adding the readiness gate with the api.BindingsReadyPodCondition
+// to the pods annotated with the api.WaitForBindingsAnnotation, so that the pods don't become ready before the secrets
+// of the bindings they use are injected. The condition is maintained by the operator in the status of the pods
+// labeled with the api.BindingReadinessGateLabel, which is added together with the readiness gate.
+type BindingReadinessGateInjector struct{}
+
+var _ admission.Handler = (*BindingReadinessGateInjector)(nil)
+
+func (i *BindingReadinessGateInjector) Handle(_ context.Context, req admission.Request) admission.Response {
+	pod := &corev1.Pod{}
+	if err := json.Unmarshal(req.Object.Raw, pod); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	if pod.Annotations[api.WaitForBindingsAnnotation] == "" {
+		return admission.Allowed("")
+	}
+
+	for _, name := range WaitedBindings(pod) {
+		if msgs := validation.IsDNS1123Subdomain(name); len(msgs) > 0 {
+			return admission.Denied(fmt.Sprintf("the %s annotation contains an invalid binding name '%s': %s", api.WaitForBindingsAnnotation, name, strings.Join(msgs, ", ")))
+		}
+	}
+
+	for _, gate := range pod.Spec.ReadinessGates {
+		if gate.ConditionType == api.BindingsReadyPodCondition {
+			// already injected
+			return admission.Allowed("")
+		}
+	}
+
+	pod.Spec.ReadinessGates = append(pod.Spec.ReadinessGates, corev1.PodReadinessGate{ConditionType: api.BindingsReadyPodCondition})
+	if pod.Labels == nil {
+		pod.Labels = map[string]string{}
+	}
+	pod.Labels[api.BindingReadinessGateLabel] = "true"
+
+	marshaled, err := json.Marshal(pod)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
+
+// WaitedBindings returns the names of the bindings in the api.WaitForBindingsAnnotation of the pod.
+func WaitedBindings(pod *corev1.Pod) []string {
+	names := []string{}
+	for _, name := range strings.Split(pod.Annotations[api.WaitForBindingsAnnotation], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,87 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestBindingReadinessGateInjector_Handle(t *testing.T) {
+	injector := &BindingReadinessGateInjector{}
+
+	request := func(pod *corev1.Pod) admission.Request {
+		raw, err := json.Marshal(pod)
+		assert.NoError(t, err)
+		return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		}}
+	}
+
+	pod := func(waitFor string) *corev1.Pod {
+		p := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "ns"}}
+		if waitFor != "" {
+			p.Annotations = map[string]string{api.WaitForBindingsAnnotation: waitFor}
+		}
+		return p
+	}
+
+	t.Run("not annotated", func(t *testing.T) {
+		res := injector.Handle(context.TODO(), request(pod("")))
+		assert.True(t, res.Allowed)
+		assert.Empty(t, res.Patches)
+	})
+
+	t.Run("annotated", func(t *testing.T) {
+		res := injector.Handle(context.TODO(), request(pod("git, registry")))
+		assert.True(t, res.Allowed)
+
+		paths := []string{}
+		for _, p := range res.Patches {
+			paths = append(paths, p.Path)
+		}
+		assert.Contains(t, paths, "/spec/readinessGates")
+		assert.Contains(t, paths, "/metadata/labels")
+	})
+
+	t.Run("already injected", func(t *testing.T) {
+		p := pod("git")
+		p.Spec.ReadinessGates = []corev1.PodReadinessGate{{ConditionType: api.BindingsReadyPodCondition}}
+		res := injector.Handle(context.TODO(), request(p))
+		assert.True(t, res.Allowed)
+		assert.Empty(t, res.Patches)
+	})
+
+	t.Run("invalid binding name", func(t *testing.T) {
+		res := injector.Handle(context.TODO(), request(pod("git,Not_A_Name")))
+		assert.False(t, res.Allowed)
+	})
+}
+
+func TestWaitedBindings(t *testing.T) {
+	p := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{api.WaitForBindingsAnnotation: " git,,registry "}}}
+	assert.Equal(t, []string{"git", "registry"}, WaitedBindings(p))
+	assert.Empty(t, WaitedBindings(&corev1.Pod{}))
+}
@@ -0,0 +1,94 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// BindingValidatorPath is the path on which the BindingValidator is served by the webhook server.
+const BindingValidatorPath = "/validate-bindings"
+
+//+kubebuilder:webhook:path=/validate-bindings,mutating=false,failurePolicy=ignore,sideEffects=None,groups=appstudio.redhat.com,resources=spiaccesstokenbindings,verbs=create;update,versions=v1beta1,name=vbindings.spi.appstudio.redhat.com,admissionReviewVersions=v1
+
+// BindingValidator is an admission handler rejecting the SPIAccessTokenBindings requesting secrets that cannot be
+// created with the credentials of their service provider (see serviceprovider.ValidateSecretSpec). Without it, such
+// bindings would only fail during the reconciliation. The updates are only validated if they change the requested
+// secret so that the bindings created before the validation existed can still be updated (e.g. by the operator itself).
+type BindingValidator struct {
+	ServiceProviderFactory serviceprovider.Factory
+}
+
+var _ admission.Handler = (*BindingValidator)(nil)
+
+func (v *BindingValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	lg := log.FromContext(ctx, "kind", req.Kind.Kind, "name", req.Name, "namespace", req.Namespace)
+
+	if req.Kind.Kind != "SPIAccessTokenBinding" {
+		return admission.Allowed("")
+	}
+
+	binding := &api.SPIAccessTokenBinding{}
+	if err := json.Unmarshal(req.Object.Raw, binding); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	if binding.DeletionTimestamp != nil {
+		return admission.Allowed("")
+	}
+
+	if req.Operation == admissionv1.Update {
+		old := &api.SPIAccessTokenBinding{}
+		if err := json.Unmarshal(req.OldObject.Raw, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if !secretRequestChanged(old, binding) {
+			return admission.Allowed("")
+		}
+	}
+
+	sp, err := v.ServiceProviderFactory.FromRepoUrlInNamespace(ctx, binding.Spec.RepoUrl, req.Namespace)
+	if err != nil {
+		lg.Info("could not determine the service provider, skipping the secret validation", "url", binding.Spec.RepoUrl, "error", err.Error())
+		return admission.Allowed("")
+	}
+
+	if errs := serviceprovider.ValidateSecretSpec(sp, binding); len(errs) > 0 {
+		msgs := make([]string, len(errs))
+		for i, e := range errs {
+			msgs[i] = e.Error()
+		}
+		return admission.Denied(strings.Join(msgs, ", "))
+	}
+
+	return admission.Allowed("")
+}
+
+// secretRequestChanged checks whether the update of the binding changes anything the validity of the requested secret
+// depends on.
+func secretRequestChanged(old *api.SPIAccessTokenBinding, updated *api.SPIAccessTokenBinding) bool {
+	return old.Spec.RepoUrl != updated.Spec.RepoUrl || old.Spec.CredentialFlavor != updated.Spec.CredentialFlavor ||
+		!equality.Semantic.DeepEqual(old.Spec.Secret, updated.Spec.Secret)
+}
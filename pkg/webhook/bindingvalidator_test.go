@@ -0,0 +1,132 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider/github"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider/quay"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestBindingValidator_Handle(t *testing.T) {
+	v := &BindingValidator{
+		ServiceProviderFactory: serviceprovider.Factory{
+			Configuration: config.NewLiveConfiguration(config.Configuration{
+				ServiceProviders: []config.ServiceProviderConfiguration{
+					{
+						ServiceProviderType: config.ServiceProviderTypeGitHub,
+						ClientId:            "id",
+						ClientSecret:        "secret",
+					},
+					{
+						ServiceProviderType: config.ServiceProviderTypeQuay,
+						ClientId:            "id",
+						ClientSecret:        "secret",
+					},
+				},
+			}),
+			KubernetesClient: fake.NewClientBuilder().Build(),
+			HttpClient:       http.DefaultClient,
+			Initializers: map[config.ServiceProviderType]serviceprovider.Initializer{
+				config.ServiceProviderTypeGitHub: github.Initializer,
+				config.ServiceProviderTypeQuay:   quay.Initializer,
+			},
+		},
+	}
+
+	request := func(kind string, obj interface{}) admission.Request {
+		raw, err := json.Marshal(obj)
+		assert.NoError(t, err)
+		return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			Operation: admissionv1.Create,
+			Kind:      metav1.GroupVersionKind{Group: api.GroupVersion.Group, Version: api.GroupVersion.Version, Kind: kind},
+			Object:    runtime.RawExtension{Raw: raw},
+		}}
+	}
+
+	update := func(old *api.SPIAccessTokenBinding, updated *api.SPIAccessTokenBinding) admission.Request {
+		req := request("SPIAccessTokenBinding", updated)
+		raw, err := json.Marshal(old)
+		assert.NoError(t, err)
+		req.Operation = admissionv1.Update
+		req.OldObject = runtime.RawExtension{Raw: raw}
+		return req
+	}
+
+	binding := func(repoUrl string, secretType corev1.SecretType, flavor api.CredentialFlavor) *api.SPIAccessTokenBinding {
+		return &api.SPIAccessTokenBinding{
+			Spec: api.SPIAccessTokenBindingSpec{
+				RepoUrl:          repoUrl,
+				Secret:           api.SecretSpec{Type: secretType},
+				CredentialFlavor: flavor,
+			},
+		}
+	}
+
+	t.Run("valid binding", func(t *testing.T) {
+		res := v.Handle(context.TODO(), request("SPIAccessTokenBinding", binding("quay.io/acme/repo", corev1.SecretTypeDockerConfigJson, "")))
+		assert.True(t, res.Allowed)
+	})
+
+	t.Run("unsupported secret type", func(t *testing.T) {
+		res := v.Handle(context.TODO(), request("SPIAccessTokenBinding", binding("quay.io/acme/repo", corev1.SecretTypeSSHAuth, api.CredentialFlavorSSHKey)))
+		assert.False(t, res.Allowed)
+		assert.Equal(t, "the Quay service provider doesn't support secrets of type 'kubernetes.io/ssh-auth'", string(res.Result.Reason))
+	})
+
+	t.Run("ssh key on github", func(t *testing.T) {
+		res := v.Handle(context.TODO(), request("SPIAccessTokenBinding", binding("https://github.com/acme/repo", corev1.SecretTypeSSHAuth, api.CredentialFlavorSSHKey)))
+		assert.True(t, res.Allowed)
+	})
+
+	t.Run("unknown service provider", func(t *testing.T) {
+		res := v.Handle(context.TODO(), request("SPIAccessTokenBinding", binding("https://acme.com/acme/repo", corev1.SecretTypeSSHAuth, "")))
+		assert.True(t, res.Allowed)
+	})
+
+	t.Run("update not changing the secret", func(t *testing.T) {
+		old := binding("quay.io/acme/repo", corev1.SecretTypeSSHAuth, "")
+		updated := old.DeepCopy()
+		updated.Labels = map[string]string{"a": "b"}
+		res := v.Handle(context.TODO(), update(old, updated))
+		assert.True(t, res.Allowed)
+	})
+
+	t.Run("update changing the secret", func(t *testing.T) {
+		old := binding("quay.io/acme/repo", corev1.SecretTypeDockerConfigJson, "")
+		updated := binding("quay.io/acme/repo", corev1.SecretTypeSSHAuth, api.CredentialFlavorSSHKey)
+		res := v.Handle(context.TODO(), update(old, updated))
+		assert.False(t, res.Allowed)
+	})
+
+	t.Run("other kinds", func(t *testing.T) {
+		res := v.Handle(context.TODO(), request("SPIAccessToken", &api.SPIAccessToken{}))
+		assert.True(t, res.Allowed)
+	})
+}
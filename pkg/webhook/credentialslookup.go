@@ -0,0 +1,168 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// CredentialsLookupPath is the path on which the CredentialsLookupServer is served by the webhook server.
+const CredentialsLookupPath = "/lookup-credentials"
+
+// CredentialsLookupAudience is the audience of the service account tokens the trusted services authenticate with to
+// the CredentialsLookupServer. The tokens with this audience are not accepted by the API server, so the operator
+// cannot misuse them.
+const CredentialsLookupAudience = "spi-credentials-lookup"
+
+// credentialsLookupBindingPrefix is the prefix of the names of the bindings and secrets created by
+// the CredentialsLookupServer.
+const credentialsLookupBindingPrefix = "spi-lookup-"
+
+// CredentialsLookupRequest is the body of the requests to the CredentialsLookupServer.
+type CredentialsLookupRequest struct {
+	// Namespace is the namespace on behalf of which the credentials are requested and into which the secret is created.
+	Namespace string `json:"namespace"`
+	// RepoUrl is the URL of the repository the credentials are requested for.
+	RepoUrl     string          `json:"repoUrl"`
+	Permissions api.Permissions `json:"permissions"`
+	// SecretType is the type of the created secret, see api.SecretSpec.
+	SecretType corev1.SecretType `json:"secretType,omitempty"`
+}
+
+// CredentialsLookupResponse is the body of the responses of the CredentialsLookupServer to the accepted requests.
+type CredentialsLookupResponse struct {
+	Namespace string `json:"namespace"`
+	// BindingName is the name of the binding created for the request. Its status reports the progress of
+	// the lookup, e.g. the OAuth URL if there are no matching credentials yet.
+	BindingName string `json:"bindingName"`
+	// SecretName is the name of the secret the credentials are delivered in once the binding is injected.
+	SecretName string `json:"secretName"`
+	// ExpirationTime is the time the binding and the secret are deleted.
+	ExpirationTime metav1.Time `json:"expirationTime"`
+}
+
+// CredentialsLookupServer is an HTTP handler that lets the trusted services obtain the credentials for a repository
+// on behalf of a namespace without implementing the token lookup themselves. Each request creates a binding in
+// the namespace that expires after the configured credentialsLookupTtl (see api.BindingExpiresAtAnnotation) and
+// the reference to its secret is returned.
+//
+// The callers authenticate using a service account token with the CredentialsLookupAudience and must be one of
+// the configured credentialsLookupUsers. All the requests are logged for audit and the created bindings record
+// the caller in the api.BindingRequestedByAnnotation.
+type CredentialsLookupServer struct {
+	Client        client.Client
+	Configuration *config.LiveConfiguration
+}
+
+var _ http.Handler = (*CredentialsLookupServer)(nil)
+
+func (s *CredentialsLookupServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, status, err := authenticateBearer(r, s.Client, CredentialsLookupAudience)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "failed to authenticate the credentials lookup request")
+		http.Error(w, "failed to authenticate the request", http.StatusInternalServerError)
+		return
+	}
+	if status != http.StatusOK {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	req := CredentialsLookupRequest{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize)).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("failed to parse the request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// the audit log of all the requests of the authenticated callers, whether they're allowed or not
+	lg := log.FromContext(ctx, "audit", true, "user", user.Username, "namespace", req.Namespace, "repoUrl", req.RepoUrl, "permissions", req.Permissions)
+
+	cfg := s.Configuration.Get()
+	if !containsString(cfg.CredentialsLookupUsers, user.Username) {
+		lg.Info("credentials lookup denied, the user is not allowed to use the credentials lookup API")
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	if req.Namespace == "" || req.RepoUrl == "" {
+		http.Error(w, "namespace and repoUrl are required", http.StatusBadRequest)
+		return
+	}
+
+	name := credentialsLookupBindingPrefix + utilrand.String(8)
+	expiration := metav1.NewTime(time.Now().Add(cfg.CredentialsLookupTtl).Truncate(time.Second))
+	binding := &api.SPIAccessTokenBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: req.Namespace,
+			Annotations: map[string]string{
+				api.BindingExpiresAtAnnotation:   expiration.UTC().Format(time.RFC3339),
+				api.BindingRequestedByAnnotation: user.Username,
+			},
+		},
+		Spec: api.SPIAccessTokenBindingSpec{
+			RepoUrl:     req.RepoUrl,
+			Permissions: req.Permissions,
+			Secret: api.SecretSpec{
+				Name: name,
+				Type: req.SecretType,
+			},
+		},
+	}
+
+	if err := s.Client.Create(ctx, binding); err != nil {
+		if apierrors.IsInvalid(err) || apierrors.IsBadRequest(err) || apierrors.IsForbidden(err) || apierrors.IsNotFound(err) {
+			lg.Info("credentials lookup rejected", "reason", err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		lg.Error(err, "failed to create the binding of the credentials lookup")
+		http.Error(w, "failed to create the binding", http.StatusInternalServerError)
+		return
+	}
+
+	lg.Info("credentials lookup accepted", "binding", name, "expirationTime", expiration)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(&CredentialsLookupResponse{
+		Namespace:      req.Namespace,
+		BindingName:    name,
+		SecretName:     name,
+		ExpirationTime: expiration,
+	}); err != nil {
+		lg.Error(err, "failed to write the credentials lookup response")
+	}
+}
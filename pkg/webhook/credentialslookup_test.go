@@ -0,0 +1,160 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/stretchr/testify/assert"
+	authnv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const trustedService = "system:serviceaccount:build-service:controller"
+
+// serviceReviewingClient answers the TokenReviews like the API server would for the tokens "<service>-<audience>" of
+// the "trusted" and "untrusted" services.
+type serviceReviewingClient struct {
+	client.Client
+}
+
+func (c serviceReviewingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if review, ok := obj.(*authnv1.TokenReview); ok {
+		users := map[string]string{"trusted": trustedService, "untrusted": "system:serviceaccount:ns:default"}
+		for service, username := range users {
+			for _, audience := range review.Spec.Audiences {
+				if review.Spec.Token == service+"-"+audience {
+					review.Status.Authenticated = true
+					review.Status.Audiences = []string{audience}
+					review.Status.User = authnv1.UserInfo{Username: username}
+				}
+			}
+		}
+		return nil
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func TestCredentialsLookupServer_ServeHTTP(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, api.AddToScheme(sch))
+
+	newServer := func() (*CredentialsLookupServer, client.Client) {
+		cl := fake.NewClientBuilder().WithScheme(sch).Build()
+		return &CredentialsLookupServer{
+			Client: serviceReviewingClient{Client: cl},
+			Configuration: config.NewLiveConfiguration(config.Configuration{
+				CredentialsLookupUsers: []string{trustedService},
+				CredentialsLookupTtl:   10 * time.Minute,
+			}),
+		}, cl
+	}
+
+	serve := func(s *CredentialsLookupServer, bearer string, req CredentialsLookupRequest) (*httptest.ResponseRecorder, CredentialsLookupResponse) {
+		body, err := json.Marshal(req)
+		assert.NoError(t, err)
+		r := httptest.NewRequest(http.MethodPost, CredentialsLookupPath, bytes.NewReader(body))
+		if bearer != "" {
+			r.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+
+		resp := CredentialsLookupResponse{}
+		if w.Code == http.StatusCreated {
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		}
+		return w, resp
+	}
+
+	lookup := CredentialsLookupRequest{
+		Namespace: "ns",
+		RepoUrl:   "https://github.com/acme/app",
+		Permissions: api.Permissions{
+			Required: []api.Permission{{Type: api.PermissionTypeRead, Area: api.PermissionAreaRepository}},
+		},
+		SecretType: corev1.SecretTypeBasicAuth,
+	}
+
+	t.Run("creates an expiring binding", func(t *testing.T) {
+		s, cl := newServer()
+		before := time.Now()
+		w, resp := serve(s, "trusted-"+CredentialsLookupAudience, lookup)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, "ns", resp.Namespace)
+		assert.True(t, strings.HasPrefix(resp.BindingName, credentialsLookupBindingPrefix))
+		assert.Equal(t, resp.BindingName, resp.SecretName)
+		assert.WithinDuration(t, before.Add(10*time.Minute), resp.ExpirationTime.Time, 2*time.Second)
+
+		binding := &api.SPIAccessTokenBinding{}
+		assert.NoError(t, cl.Get(context.TODO(), client.ObjectKey{Name: resp.BindingName, Namespace: "ns"}, binding))
+		assert.Equal(t, lookup.RepoUrl, binding.Spec.RepoUrl)
+		assert.Equal(t, lookup.Permissions, binding.Spec.Permissions)
+		assert.Equal(t, resp.SecretName, binding.Spec.Secret.Name)
+		assert.Equal(t, corev1.SecretTypeBasicAuth, binding.Spec.Secret.Type)
+		assert.Equal(t, trustedService, binding.Annotations[api.BindingRequestedByAnnotation])
+
+		expiresAt, err := time.Parse(time.RFC3339, binding.Annotations[api.BindingExpiresAtAnnotation])
+		assert.NoError(t, err)
+		assert.True(t, expiresAt.Equal(resp.ExpirationTime.Time))
+	})
+
+	t.Run("rejects the services not allowed to use the API", func(t *testing.T) {
+		s, cl := newServer()
+		w, _ := serve(s, "untrusted-"+CredentialsLookupAudience, lookup)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		bindings := &api.SPIAccessTokenBindingList{}
+		assert.NoError(t, cl.List(context.TODO(), bindings))
+		assert.Empty(t, bindings.Items)
+	})
+
+	t.Run("rejects the tokens with other audiences", func(t *testing.T) {
+		s, _ := newServer()
+		w, _ := serve(s, "trusted-"+PodCredentialsAudience, lookup)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("rejects the unauthenticated requests", func(t *testing.T) {
+		s, _ := newServer()
+		w, _ := serve(s, "", lookup)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("requires the namespace and repository", func(t *testing.T) {
+		s, _ := newServer()
+		w, _ := serve(s, "trusted-"+CredentialsLookupAudience, CredentialsLookupRequest{Namespace: "ns"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("only accepts POST", func(t *testing.T) {
+		s, _ := newServer()
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, CredentialsLookupPath, nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+}
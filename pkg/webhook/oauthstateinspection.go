@@ -0,0 +1,119 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/oauthstate"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// OAuthStateInspectionPath is the path on which the OAuthStateInspector is served by the webhook server.
+const OAuthStateInspectionPath = "/debug/oauth-state"
+
+// DebugAudience is the audience of the service account tokens the users configured in debugUsers authenticate with to
+// the debugging endpoints.
+const DebugAudience = "spi-debug"
+
+// OAuthStateInspectionRequest is the body of the requests to the OAuthStateInspector.
+type OAuthStateInspectionRequest struct {
+	// State is the OAuth state to inspect, i.e. the value of the state query parameter of the OAuth URL.
+	State string `json:"state"`
+	// MaxAge is the age after which the state is considered expired, e.g. "15m". The expiration is not checked if
+	// empty.
+	MaxAge string `json:"maxAge,omitempty"`
+}
+
+// OAuthStateInspector is an HTTP handler that decodes the OAuth states and reports whether they're valid and why not,
+// see oauthstate.Inspection. It uses the signing keys of the operator, so that the states can be inspected without
+// handing the keys out. The callers authenticate using a token with the DebugAudience and must be one of
+// the configured debugUsers.
+type OAuthStateInspector struct {
+	Client        client.Client
+	Configuration *config.LiveConfiguration
+	// Transit is the Vault transit key the states are signed with, if configured.
+	Transit *oauthstate.VaultTransit
+}
+
+var _ http.Handler = (*OAuthStateInspector)(nil)
+
+func (s *OAuthStateInspector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, status, err := authenticateBearer(r, s.Client, DebugAudience)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "failed to authenticate the OAuth state inspection request")
+		http.Error(w, "failed to authenticate the request", http.StatusInternalServerError)
+		return
+	}
+	if status != http.StatusOK {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	cfg := s.Configuration.Get()
+	lg := log.FromContext(ctx, "audit", true, "user", user.Username)
+	if !containsString(cfg.DebugUsers, user.Username) {
+		lg.Info("OAuth state inspection denied, the user is not allowed to use the debugging endpoints")
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	req := OAuthStateInspectionRequest{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize)).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("failed to parse the request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var maxAge time.Duration
+	if req.MaxAge != "" {
+		if maxAge, err = time.ParseDuration(req.MaxAge); err != nil {
+			http.Error(w, fmt.Sprintf("invalid maxAge: %s", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	codec, err := oauthstate.NewCodecFromConfiguration(cfg, s.Transit)
+	if err != nil {
+		lg.Error(err, "failed to instantiate the OAuth state codec")
+		http.Error(w, "failed to instantiate the OAuth state codec", http.StatusInternalServerError)
+		return
+	}
+
+	inspection, err := codec.Inspect(req.State, time.Now(), maxAge)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lg.Info("OAuth state inspected", "tokenName", inspection.State.TokenName, "tokenNamespace", inspection.State.TokenNamespace, "valid", inspection.Valid)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&inspection); err != nil {
+		lg.Error(err, "failed to write the OAuth state inspection response")
+	}
+}
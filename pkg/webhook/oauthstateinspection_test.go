@@ -0,0 +1,110 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/oauthstate"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestOAuthStateInspector_ServeHTTP(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, api.AddToScheme(sch))
+
+	s := &OAuthStateInspector{
+		Client: serviceReviewingClient{Client: fake.NewClientBuilder().WithScheme(sch).Build()},
+		Configuration: config.NewLiveConfiguration(config.Configuration{
+			SharedSecret: []byte("secret"),
+			DebugUsers:   []string{trustedService},
+		}),
+	}
+
+	codec, err := oauthstate.NewCodec([]byte("secret"))
+	assert.NoError(t, err)
+	state, err := codec.Encode(&oauthstate.AnonymousOAuthState{
+		TokenName:      "token",
+		TokenNamespace: "ns",
+		IssuedAt:       time.Now().Add(-time.Hour).Unix(),
+	})
+	assert.NoError(t, err)
+
+	serve := func(bearer string, req OAuthStateInspectionRequest) (*httptest.ResponseRecorder, oauthstate.Inspection) {
+		body, err := json.Marshal(req)
+		assert.NoError(t, err)
+		r := httptest.NewRequest(http.MethodPost, OAuthStateInspectionPath, bytes.NewReader(body))
+		if bearer != "" {
+			r.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+
+		inspection := oauthstate.Inspection{}
+		if w.Code == http.StatusOK {
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &inspection))
+		}
+		return w, inspection
+	}
+
+	t.Run("inspects the state", func(t *testing.T) {
+		w, inspection := serve("trusted-"+DebugAudience, OAuthStateInspectionRequest{State: state})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.True(t, inspection.Valid)
+		assert.Equal(t, "token", inspection.State.TokenName)
+		assert.Equal(t, "the current shared secret", inspection.Key)
+	})
+
+	t.Run("checks the expiry", func(t *testing.T) {
+		w, inspection := serve("trusted-"+DebugAudience, OAuthStateInspectionRequest{State: state, MaxAge: "15m"})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.False(t, inspection.Valid)
+		assert.True(t, inspection.SignatureValid)
+		assert.Len(t, inspection.ValidationErrors, 1)
+	})
+
+	t.Run("rejects invalid requests", func(t *testing.T) {
+		w, _ := serve("trusted-"+DebugAudience, OAuthStateInspectionRequest{State: "garbage"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w, _ = serve("trusted-"+DebugAudience, OAuthStateInspectionRequest{State: state, MaxAge: "forever"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("rejects the users not allowed to debug", func(t *testing.T) {
+		w, _ := serve("untrusted-"+DebugAudience, OAuthStateInspectionRequest{State: state})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("rejects the tokens with other audiences", func(t *testing.T) {
+		w, _ := serve("trusted-"+CredentialsLookupAudience, OAuthStateInspectionRequest{State: state})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("only accepts POST", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, OAuthStateInspectionPath, nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+}
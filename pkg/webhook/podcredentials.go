@@ -0,0 +1,299 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	authnv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// PodCredentialsPath is the path on which the PodCredentialsServer is served by the webhook server.
+const PodCredentialsPath = "/pod-credentials"
+
+// PodCredentialsInjectorPath is the path on which the PodCredentialsInjector is served by the webhook server.
+const PodCredentialsInjectorPath = "/mutate-pod-credentials"
+
+// PodCredentialsAudience is the audience of the service account tokens the pods authenticate with to
+// the PodCredentialsServer. The tokens with this audience are not accepted by the API server, so the operator cannot
+// misuse them.
+const PodCredentialsAudience = "spi-pod-credentials"
+
+const (
+	// DefaultCredentialsMountPath is the directory the data of the binding is mounted to if the pod doesn't specify
+	// the api.CredentialsMountPathAnnotation.
+	DefaultCredentialsMountPath = "/var/run/spi/credentials"
+
+	podCredentialsVolume      = "spi-credentials"
+	podCredentialsTokenVolume = "spi-credentials-token"
+	podCredentialsContainer   = "spi-credentials"
+	podCredentialsTokenDir    = "/var/run/spi/token"
+	// podCredentialsTokenExpiration is the minimum expiration of the projected service account tokens.
+	podCredentialsTokenExpiration int64 = 600
+
+	// the extra user info with which the API server describes the pod the service account token is bound to
+	podNameExtra = "authentication.kubernetes.io/pod-name"
+	podUIDExtra  = "authentication.kubernetes.io/pod-uid"
+)
+
+// ErrBindingDataUnavailable is returned by the BindingDataRenderer when the binding cannot provide its data, e.g.
+// because the token data has not been uploaded yet. The pods retry the requests answered with this error.
+var ErrBindingDataUnavailable = errors.New("the data of the binding is not available")
+
+// ErrBindingDataForbidden is returned by the BindingDataRenderer when the binding may never provide its data to
+// the pods, e.g. because it doesn't use the "Pod" delivery. The pods don't retry the requests answered with this error.
+var ErrBindingDataForbidden = errors.New("the data of the binding is not available to the pods")
+
+// ErrBindingDataConflict is returned by the BindingDataRenderer when the token data doesn't match the binding, e.g.
+// because it lacks the credential the binding requires. This doesn't change until different token data is uploaded,
+// so the pods don't retry the requests answered with this error.
+var ErrBindingDataConflict = errors.New("the token data doesn't match the binding")
+
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get
+
+//+kubebuilder:webhook:path=/mutate-pod-credentials,mutating=true,failurePolicy=ignore,sideEffects=None,groups="",resources=pods,verbs=create,versions=v1,name=mpodcredentials.spi.appstudio.redhat.com,admissionReviewVersions=v1
+
+// BindingDataRenderer renders the data of the bindings with the "Pod" delivery.
+type BindingDataRenderer interface {
+	// Render returns the data of the binding with the provided name, keyed by the names of the files it is mounted
+	// to. ErrBindingDataUnavailable is returned if the binding cannot provide the data yet, ErrBindingDataForbidden or
+	// ErrBindingDataConflict if it cannot provide them at all.
+	Render(ctx context.Context, namespace string, name string) (map[string]string, error)
+}
+
+// PodCredentialsResponse is the body of the responses of the PodCredentialsServer.
+type PodCredentialsResponse struct {
+	// Data maps the names of the files to their contents.
+	Data map[string]string `json:"data"`
+}
+
+// PodCredentialsServer is an HTTP handler serving the data of the bindings with the "Pod" delivery to the init
+// containers injected into the pods by the PodCredentialsInjector, so that the data is never stored in the cluster.
+//
+// The callers authenticate using a service account token bound to their pod with the PodCredentialsAudience. Only
+// the data of the binding named by the api.InjectBindingAnnotation of the pod is served, so the data of a binding is
+// available to anyone who can create the pods in its namespace, just like the data of the secrets.
+type PodCredentialsServer struct {
+	Client client.Client
+	// Reader reads the pods. The pods are read directly from the cluster rather than from a cache so that the operator
+	// doesn't need to watch all the pods in the cluster.
+	Reader   client.Reader
+	Renderer BindingDataRenderer
+}
+
+var _ http.Handler = (*PodCredentialsServer)(nil)
+
+func (s *PodCredentialsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "only GET is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, status, err := authenticateBearer(r, s.Client, PodCredentialsAudience)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "failed to authenticate the pod credentials request")
+		http.Error(w, "failed to authenticate the request", http.StatusInternalServerError)
+		return
+	}
+	if status != http.StatusOK {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	namespace, podName, podUID, ok := podOf(user)
+	if !ok {
+		http.Error(w, "the token is not bound to a pod", http.StatusForbidden)
+		return
+	}
+
+	lg := log.FromContext(ctx, "namespace", namespace, "pod", podName)
+
+	pod := &corev1.Pod{}
+	if err := s.Reader.Get(ctx, client.ObjectKey{Name: podName, Namespace: namespace}, pod); err != nil {
+		if apierrors.IsNotFound(err) {
+			http.Error(w, "the pod does not exist", http.StatusForbidden)
+			return
+		}
+		lg.Error(err, "failed to read the pod requesting the credentials")
+		http.Error(w, "failed to read the pod", http.StatusInternalServerError)
+		return
+	}
+
+	bindingName := pod.Annotations[api.InjectBindingAnnotation]
+	if string(pod.UID) != podUID || bindingName == "" {
+		http.Error(w, fmt.Sprintf("the pod is not annotated with %s", api.InjectBindingAnnotation), http.StatusForbidden)
+		return
+	}
+
+	data, err := s.Renderer.Render(ctx, namespace, bindingName)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrBindingDataUnavailable):
+			w.Header().Set("Retry-After", "5")
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		case errors.Is(err, ErrBindingDataForbidden):
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		case errors.Is(err, ErrBindingDataConflict):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		lg.Error(err, "failed to render the data of the binding", "binding", bindingName)
+		http.Error(w, "failed to render the data of the binding", http.StatusInternalServerError)
+		return
+	}
+
+	lg.Info("serving the data of the binding to the pod", "binding", bindingName)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&PodCredentialsResponse{Data: data}); err != nil {
+		lg.Error(err, "failed to write the pod credentials response")
+	}
+}
+
+// podOf returns the namespace, name and UID of the pod the service account token of the user is bound to.
+func podOf(user *authnv1.UserInfo) (namespace string, name string, uid string, ok bool) {
+	parts := strings.Split(user.Username, ":")
+	if len(parts) != 4 || parts[0] != "system" || parts[1] != "serviceaccount" {
+		return "", "", "", false
+	}
+
+	if len(user.Extra[podNameExtra]) != 1 || len(user.Extra[podUIDExtra]) != 1 {
+		return "", "", "", false
+	}
+
+	return parts[2], user.Extra[podNameExtra][0], user.Extra[podUIDExtra][0], true
+}
+
+// PodCredentialsInjector is an admission handler adding an init container to the pods annotated with
+// the api.InjectBindingAnnotation. The init container fetches the data of the binding from the PodCredentialsServer
+// into an in-memory volume that is mounted into all the containers of the pod.
+type PodCredentialsInjector struct {
+	// Image is the image of the init container. It must contain the spi command.
+	Image string
+	// Url is the URL of the PodCredentialsServer as reachable from the pods.
+	Url string
+	// CACert is the PEM-encoded certificate of the CA the PodCredentialsServer is verified with. The system CAs are
+	// used if empty.
+	CACert string
+}
+
+var _ admission.Handler = (*PodCredentialsInjector)(nil)
+
+func (i *PodCredentialsInjector) Handle(_ context.Context, req admission.Request) admission.Response {
+	pod := &corev1.Pod{}
+	if err := json.Unmarshal(req.Object.Raw, pod); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	if pod.Annotations[api.InjectBindingAnnotation] == "" {
+		return admission.Allowed("")
+	}
+
+	for _, v := range pod.Spec.Volumes {
+		if v.Name == podCredentialsVolume {
+			// already injected
+			return admission.Allowed("")
+		}
+	}
+
+	mountPath := pod.Annotations[api.CredentialsMountPathAnnotation]
+	if mountPath == "" {
+		mountPath = DefaultCredentialsMountPath
+	}
+	if !path.IsAbs(mountPath) {
+		return admission.Denied(fmt.Sprintf("the %s annotation must be an absolute path", api.CredentialsMountPathAnnotation))
+	}
+
+	i.inject(pod, mountPath)
+
+	marshaled, err := json.Marshal(pod)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
+
+// inject adds the init container fetching the data of the binding and the volumes it needs to the pod and mounts
+// the data into all the containers.
+func (i *PodCredentialsInjector) inject(pod *corev1.Pod, mountPath string) {
+	expiration := podCredentialsTokenExpiration
+	pod.Spec.Volumes = append(pod.Spec.Volumes,
+		corev1.Volume{
+			Name: podCredentialsVolume,
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{Medium: corev1.StorageMediumMemory},
+			},
+		},
+		corev1.Volume{
+			Name: podCredentialsTokenVolume,
+			VolumeSource: corev1.VolumeSource{
+				Projected: &corev1.ProjectedVolumeSource{
+					Sources: []corev1.VolumeProjection{{
+						ServiceAccountToken: &corev1.ServiceAccountTokenProjection{
+							Audience:          PodCredentialsAudience,
+							ExpirationSeconds: &expiration,
+							Path:              "token",
+						},
+					}},
+				},
+			},
+		})
+
+	mount := corev1.VolumeMount{Name: podCredentialsVolume, MountPath: mountPath, ReadOnly: true}
+	for c := range pod.Spec.InitContainers {
+		pod.Spec.InitContainers[c].VolumeMounts = append(pod.Spec.InitContainers[c].VolumeMounts, mount)
+	}
+	for c := range pod.Spec.Containers {
+		pod.Spec.Containers[c].VolumeMounts = append(pod.Spec.Containers[c].VolumeMounts, mount)
+	}
+
+	fetch := corev1.Container{
+		Name:  podCredentialsContainer,
+		Image: i.Image,
+		Command: []string{"/spi", "fetch-credentials",
+			"--url", i.Url,
+			"--token-file", path.Join(podCredentialsTokenDir, "token"),
+			"--dir", DefaultCredentialsMountPath,
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: podCredentialsVolume, MountPath: DefaultCredentialsMountPath},
+			{Name: podCredentialsTokenVolume, MountPath: podCredentialsTokenDir, ReadOnly: true},
+		},
+	}
+	if i.CACert != "" {
+		fetch.Env = []corev1.EnvVar{{Name: "SPI_CA_CERT", Value: i.CACert}}
+	}
+
+	// the data must be available before any other init container runs
+	pod.Spec.InitContainers = append([]corev1.Container{fetch}, pod.Spec.InitContainers...)
+}
@@ -0,0 +1,258 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	authnv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// podReviewingClient answers the TokenReviews like the API server would for the tokens "<pod>-<audience>" bound to
+// the pods in the "ns" namespace with the UID "<pod>-uid".
+type podReviewingClient struct {
+	client.Client
+}
+
+func (c podReviewingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if review, ok := obj.(*authnv1.TokenReview); ok {
+		for _, pod := range []string{"annotated", "plain", "deleted"} {
+			for _, audience := range review.Spec.Audiences {
+				if review.Spec.Token == pod+"-"+audience {
+					review.Status.Authenticated = true
+					review.Status.Audiences = []string{audience}
+					review.Status.User = authnv1.UserInfo{
+						Username: "system:serviceaccount:ns:default",
+						Extra: map[string]authnv1.ExtraValue{
+							podNameExtra: {pod},
+							podUIDExtra:  {pod + "-uid"},
+						},
+					}
+				}
+			}
+		}
+		if review.Spec.Token == "user-"+PodCredentialsAudience {
+			review.Status.Authenticated = true
+			review.Status.Audiences = []string{PodCredentialsAudience}
+			review.Status.User = authnv1.UserInfo{Username: "alice"}
+		}
+		return nil
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+// mapRenderer renders the data of the bindings from the map. The bindings missing in the map are not available.
+type mapRenderer map[string]map[string]string
+
+func (r mapRenderer) Render(_ context.Context, namespace string, name string) (map[string]string, error) {
+	switch name {
+	case "failing":
+		return nil, fmt.Errorf("failed to read the binding")
+	case "secret":
+		return nil, fmt.Errorf("%w: delivered as a secret", ErrBindingDataForbidden)
+	case "mismatched":
+		return nil, fmt.Errorf("%w: no such credential", ErrBindingDataConflict)
+	}
+	data, ok := r[namespace+"/"+name]
+	if !ok {
+		return nil, fmt.Errorf("%w: not injected yet", ErrBindingDataUnavailable)
+	}
+	return data, nil
+}
+
+func TestPodCredentialsServer_ServeHTTP(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, corev1.AddToScheme(sch))
+
+	pod := func(name string, binding string) *corev1.Pod {
+		p := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns", UID: "annotated-uid"}}
+		if binding != "" {
+			p.Annotations = map[string]string{api.InjectBindingAnnotation: binding}
+		}
+		return p
+	}
+
+	newServer := func(pods ...client.Object) *PodCredentialsServer {
+		cl := fake.NewClientBuilder().WithScheme(sch).WithObjects(pods...).Build()
+		return &PodCredentialsServer{
+			Client:   podReviewingClient{Client: cl},
+			Reader:   cl,
+			Renderer: mapRenderer{"ns/binding": {"password": "secret"}},
+		}
+	}
+
+	serve := func(s *PodCredentialsServer, method string, bearer string) (*httptest.ResponseRecorder, PodCredentialsResponse) {
+		r := httptest.NewRequest(method, PodCredentialsPath, nil)
+		if bearer != "" {
+			r.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+
+		resp := PodCredentialsResponse{}
+		if w.Code == http.StatusOK {
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		}
+		return w, resp
+	}
+
+	t.Run("serves the data of the annotated binding", func(t *testing.T) {
+		w, resp := serve(newServer(pod("annotated", "binding")), http.MethodGet, "annotated-"+PodCredentialsAudience)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, map[string]string{"password": "secret"}, resp.Data)
+	})
+
+	t.Run("binding not ready yet", func(t *testing.T) {
+		w, _ := serve(newServer(pod("annotated", "other")), http.MethodGet, "annotated-"+PodCredentialsAudience)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "5", w.Header().Get("Retry-After"))
+	})
+
+	t.Run("binding never available", func(t *testing.T) {
+		w, _ := serve(newServer(pod("annotated", "secret")), http.MethodGet, "annotated-"+PodCredentialsAudience)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Empty(t, w.Header().Get("Retry-After"))
+	})
+
+	t.Run("token data not matching the binding", func(t *testing.T) {
+		w, _ := serve(newServer(pod("annotated", "mismatched")), http.MethodGet, "annotated-"+PodCredentialsAudience)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Empty(t, w.Header().Get("Retry-After"))
+	})
+
+	t.Run("rendering failure", func(t *testing.T) {
+		w, _ := serve(newServer(pod("annotated", "failing")), http.MethodGet, "annotated-"+PodCredentialsAudience)
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+
+	t.Run("pod without the annotation", func(t *testing.T) {
+		w, _ := serve(newServer(pod("plain", "")), http.MethodGet, "plain-"+PodCredentialsAudience)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("recreated pod of the same name", func(t *testing.T) {
+		// the token is bound to the pod with the "plain-uid" UID
+		w, _ := serve(newServer(pod("plain", "binding")), http.MethodGet, "plain-"+PodCredentialsAudience)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("deleted pod", func(t *testing.T) {
+		w, _ := serve(newServer(), http.MethodGet, "deleted-"+PodCredentialsAudience)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("token not bound to a pod", func(t *testing.T) {
+		w, _ := serve(newServer(pod("annotated", "binding")), http.MethodGet, "user-"+PodCredentialsAudience)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("token for another audience", func(t *testing.T) {
+		w, _ := serve(newServer(pod("annotated", "binding")), http.MethodGet, "annotated-api")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("anonymous request", func(t *testing.T) {
+		w, _ := serve(newServer(pod("annotated", "binding")), http.MethodGet, "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("only GET", func(t *testing.T) {
+		w, _ := serve(newServer(pod("annotated", "binding")), http.MethodPost, "annotated-"+PodCredentialsAudience)
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+}
+
+func TestPodCredentialsInjector_Handle(t *testing.T) {
+	i := &PodCredentialsInjector{Image: "spi:latest", Url: "https://spi-webhook.spi.svc/pod-credentials", CACert: "ca"}
+
+	request := func(pod *corev1.Pod) admission.Request {
+		raw, err := json.Marshal(pod)
+		assert.NoError(t, err)
+		return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			Operation: admissionv1.Create,
+			Namespace: "ns",
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Object:    runtime.RawExtension{Raw: raw},
+		}}
+	}
+
+	pod := func(annotations map[string]string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "ns", Annotations: annotations},
+			Spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{{Name: "init", Image: "init"}},
+				Containers:     []corev1.Container{{Name: "app", Image: "app"}},
+			},
+		}
+	}
+
+	t.Run("pods without the annotation are untouched", func(t *testing.T) {
+		resp := i.Handle(context.TODO(), request(pod(nil)))
+		assert.True(t, resp.Allowed)
+		assert.Empty(t, resp.Patches)
+	})
+
+	t.Run("annotated pods are patched", func(t *testing.T) {
+		resp := i.Handle(context.TODO(), request(pod(map[string]string{api.InjectBindingAnnotation: "binding"})))
+		assert.True(t, resp.Allowed)
+		assert.NotEmpty(t, resp.Patches)
+	})
+
+	t.Run("injected pods are not patched again", func(t *testing.T) {
+		p := pod(map[string]string{api.InjectBindingAnnotation: "binding"})
+		i.inject(p, DefaultCredentialsMountPath)
+		resp := i.Handle(context.TODO(), request(p))
+		assert.True(t, resp.Allowed)
+		assert.Empty(t, resp.Patches)
+	})
+
+	t.Run("relative mount path is denied", func(t *testing.T) {
+		resp := i.Handle(context.TODO(), request(pod(map[string]string{api.InjectBindingAnnotation: "binding", api.CredentialsMountPathAnnotation: "creds"})))
+		assert.False(t, resp.Allowed)
+	})
+
+	t.Run("injection", func(t *testing.T) {
+		p := pod(nil)
+		i.inject(p, "/creds")
+
+		assert.Len(t, p.Spec.Volumes, 2)
+		assert.Equal(t, corev1.StorageMediumMemory, p.Spec.Volumes[0].EmptyDir.Medium)
+		assert.Equal(t, PodCredentialsAudience, p.Spec.Volumes[1].Projected.Sources[0].ServiceAccountToken.Audience)
+
+		assert.Len(t, p.Spec.InitContainers, 2)
+		fetch := p.Spec.InitContainers[0]
+		assert.Equal(t, "spi:latest", fetch.Image)
+		assert.Contains(t, fetch.Command, "https://spi-webhook.spi.svc/pod-credentials")
+		assert.Equal(t, []corev1.EnvVar{{Name: "SPI_CA_CERT", Value: "ca"}}, fetch.Env)
+
+		expectedMount := corev1.VolumeMount{Name: podCredentialsVolume, MountPath: "/creds", ReadOnly: true}
+		assert.Equal(t, []corev1.VolumeMount{expectedMount}, p.Spec.InitContainers[1].VolumeMounts)
+		assert.Equal(t, []corev1.VolumeMount{expectedMount}, p.Spec.Containers[0].VolumeMounts)
+	})
+}
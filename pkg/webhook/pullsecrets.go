@@ -0,0 +1,228 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// PullSecretInjectorPath is the path on which the PullSecretInjector is served by the webhook server.
+const PullSecretInjectorPath = "/mutate-pull-secrets"
+
+const (
+	// pullSecretBindingPrefix is the prefix of the names of the bindings (and their secrets) created for the tokens by
+	// the PullSecretInjector.
+	pullSecretBindingPrefix = "spi-pull-"
+	// pullSecretTokenLabel is put on the bindings created by the PullSecretInjector and contains the name of the token
+	// they were created for.
+	pullSecretTokenLabel = "spi.appstudio.redhat.com/pull-secret-for-token"
+	// dockerHubHost is the registry of the images without an explicit registry host.
+	dockerHubHost = "docker.io"
+)
+
+//+kubebuilder:webhook:path=/mutate-pull-secrets,mutating=true,failurePolicy=ignore,sideEffects=NoneOnDryRun,groups="",resources=pods,verbs=create,versions=v1,name=mpullsecrets.spi.appstudio.redhat.com,admissionReviewVersions=v1
+
+// PullSecretInjector is an admission handler adding the pull secrets to the pods created in the namespaces labeled with
+// api.InjectPullSecretsLabel. For each registry of the images of the pod, a Ready SPIAccessToken for the registry host
+// is looked up in the namespace of the pod. For each such token, a binding producing a dockerconfigjson secret is
+// created (if it doesn't exist yet) and the secret is appended to the imagePullSecrets of the pod. The kubelet retries
+// the pulls until the binding injects the secret.
+//
+// Only the tokens without an owner are used, because the pods cannot be tied to the owners of the tokens.
+type PullSecretInjector struct {
+	Client client.Client
+}
+
+var _ admission.Handler = (*PullSecretInjector)(nil)
+
+func (i *PullSecretInjector) Handle(ctx context.Context, req admission.Request) admission.Response {
+	pod := &corev1.Pod{}
+	if err := json.Unmarshal(req.Object.Raw, pod); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	ns := &corev1.Namespace{}
+	if err := i.Client.Get(ctx, client.ObjectKey{Name: req.Namespace}, ns); err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if ns.Labels[api.InjectPullSecretsLabel] != "true" {
+		return admission.Allowed("")
+	}
+
+	tokens := &api.SPIAccessTokenList{}
+	if err := i.Client.List(ctx, tokens, client.InNamespace(req.Namespace)); err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	dryRun := req.DryRun != nil && *req.DryRun
+	changed := false
+	for _, host := range imageRegistryHosts(pod) {
+		token := findRegistryToken(tokens.Items, host)
+		if token == nil {
+			continue
+		}
+
+		secretName, err := i.ensurePullSecretBinding(ctx, req.Namespace, token, dryRun)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "failed to create the binding for the pull secret", "token", token.Name)
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		if secretName != "" && !hasPullSecret(pod, secretName) {
+			pod.Spec.ImagePullSecrets = append(pod.Spec.ImagePullSecrets, corev1.LocalObjectReference{Name: secretName})
+			changed = true
+		}
+	}
+
+	if !changed {
+		return admission.Allowed("")
+	}
+
+	marshaled, err := json.Marshal(pod)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
+
+// ensurePullSecretBinding makes sure the binding producing the pull secret from the token exists and returns the name
+// of its secret. An empty name is returned if a binding of the same name exists but was not created for the token.
+func (i *PullSecretInjector) ensurePullSecretBinding(ctx context.Context, namespace string, token *api.SPIAccessToken, dryRun bool) (string, error) {
+	name := pullSecretBindingPrefix + token.Name
+
+	existing := &api.SPIAccessTokenBinding{}
+	if err := i.Client.Get(ctx, client.ObjectKey{Name: name, Namespace: namespace}, existing); err == nil {
+		if existing.Labels[pullSecretTokenLabel] != token.Name {
+			log.FromContext(ctx).Info("the binding for the pull secret exists and was not created for the token", "binding", name, "token", token.Name)
+			return "", nil
+		}
+		return existing.Spec.Secret.Name, nil
+	} else if !apierrors.IsNotFound(err) {
+		return "", err
+	}
+
+	if dryRun {
+		return name, nil
+	}
+
+	binding := &api.SPIAccessTokenBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]string{pullSecretTokenLabel: token.Name},
+		},
+		Spec: api.SPIAccessTokenBindingSpec{
+			RepoUrl: token.Spec.ServiceProviderUrl,
+			Permissions: api.Permissions{
+				Required: []api.Permission{{Type: api.PermissionTypeRead, Area: api.PermissionAreaRepository}},
+			},
+			TokenPolicy: api.TokenPolicy{Type: api.TokenPolicyTypeNamed, TokenName: token.Name},
+			Secret: api.SecretSpec{
+				Name: name,
+				Type: corev1.SecretTypeDockerConfigJson,
+			},
+		},
+	}
+	if err := i.Client.Create(ctx, binding); err != nil && !apierrors.IsAlreadyExists(err) {
+		return "", err
+	}
+
+	log.FromContext(ctx).Info("created the binding for the pull secret", "binding", name, "token", token.Name)
+
+	return name, nil
+}
+
+// findRegistryToken returns the first (by name) Ready token without an owner for the registry host or nil if there is
+// none.
+func findRegistryToken(tokens []api.SPIAccessToken, host string) *api.SPIAccessToken {
+	var found *api.SPIAccessToken
+	for idx := range tokens {
+		token := &tokens[idx]
+		if token.Status.Phase != api.SPIAccessTokenPhaseReady || token.Annotations[api.TokenOwnerAnnotation] != "" || token.DeletionTimestamp != nil {
+			continue
+		}
+		u, err := url.Parse(token.Spec.ServiceProviderUrl)
+		if err != nil || normalizeRegistryHost(u.Host) != host {
+			continue
+		}
+		if found == nil || token.Name < found.Name {
+			found = token
+		}
+	}
+	return found
+}
+
+// imageRegistryHosts returns the sorted registry hosts of the images of all the containers of the pod.
+func imageRegistryHosts(pod *corev1.Pod) []string {
+	hosts := map[string]bool{}
+	for _, c := range pod.Spec.InitContainers {
+		hosts[imageRegistryHost(c.Image)] = true
+	}
+	for _, c := range pod.Spec.Containers {
+		hosts[imageRegistryHost(c.Image)] = true
+	}
+
+	ret := make([]string, 0, len(hosts))
+	for h := range hosts {
+		ret = append(ret, h)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// imageRegistryHost returns the registry host of the image reference. Like in Docker, the first component of
+// the reference is only the registry host if it contains a dot or a port or is "localhost".
+func imageRegistryHost(image string) string {
+	slash := strings.Index(image, "/")
+	if slash < 0 {
+		return dockerHubHost
+	}
+
+	host := image[:slash]
+	if !strings.ContainsAny(host, ".:") && host != "localhost" {
+		return dockerHubHost
+	}
+	return normalizeRegistryHost(host)
+}
+
+func normalizeRegistryHost(host string) string {
+	switch host {
+	case "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		return dockerHubHost
+	}
+	return host
+}
+
+func hasPullSecret(pod *corev1.Pod, name string) bool {
+	for _, s := range pod.Spec.ImagePullSecrets {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestImageRegistryHost(t *testing.T) {
+	assert.Equal(t, "docker.io", imageRegistryHost("busybox"))
+	assert.Equal(t, "docker.io", imageRegistryHost("library/busybox:1.35"))
+	assert.Equal(t, "docker.io", imageRegistryHost("index.docker.io/library/busybox"))
+	assert.Equal(t, "quay.io", imageRegistryHost("quay.io/acme/app@sha256:abcd"))
+	assert.Equal(t, "registry.acme.com:5000", imageRegistryHost("registry.acme.com:5000/app"))
+	assert.Equal(t, "localhost", imageRegistryHost("localhost/app"))
+}
+
+func TestPullSecretInjector_Handle(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, api.AddToScheme(sch))
+	assert.NoError(t, corev1.AddToScheme(sch))
+
+	token := func(name string, url string, phase api.SPIAccessTokenPhase, owner string) *api.SPIAccessToken {
+		tkn := &api.SPIAccessToken{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns"},
+			Spec:       api.SPIAccessTokenSpec{ServiceProviderUrl: url},
+			Status:     api.SPIAccessTokenStatus{Phase: phase},
+		}
+		if owner != "" {
+			tkn.Annotations = map[string]string{api.TokenOwnerAnnotation: owner}
+		}
+		return tkn
+	}
+
+	newInjector := func(labels map[string]string, objs ...client.Object) (*PullSecretInjector, client.Client) {
+		objs = append(objs,
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns", Labels: labels}},
+			token("quay", "https://quay.io", api.SPIAccessTokenPhaseReady, ""),
+			token("a-quay-owned", "https://quay.io", api.SPIAccessTokenPhaseReady, "alice"),
+			token("a-quay-waiting", "https://quay.io", api.SPIAccessTokenPhaseAwaitingTokenData, ""),
+			token("github", "https://github.com", api.SPIAccessTokenPhaseReady, ""),
+		)
+		cl := fake.NewClientBuilder().WithScheme(sch).WithObjects(objs...).Build()
+		return &PullSecretInjector{Client: cl}, cl
+	}
+
+	request := func(dryRun bool, images ...string) admission.Request {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "ns"}}
+		for _, image := range images {
+			pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: image, Image: image})
+		}
+		raw, err := json.Marshal(pod)
+		assert.NoError(t, err)
+		return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			Operation: admissionv1.Create,
+			Namespace: "ns",
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Object:    runtime.RawExtension{Raw: raw},
+			DryRun:    &dryRun,
+		}}
+	}
+
+	pullSecretsPatch := func(t *testing.T, resp admission.Response) interface{} {
+		assert.True(t, resp.Allowed)
+		for _, p := range resp.Patches {
+			if p.Path == "/spec/imagePullSecrets" {
+				return p.Value
+			}
+		}
+		return nil
+	}
+
+	enabled := map[string]string{api.InjectPullSecretsLabel: "true"}
+
+	t.Run("injects the secret of the shared ready token", func(t *testing.T) {
+		i, cl := newInjector(enabled)
+		resp := i.Handle(context.TODO(), request(false, "quay.io/acme/app", "busybox"))
+		assert.Equal(t, []interface{}{map[string]interface{}{"name": "spi-pull-quay"}}, pullSecretsPatch(t, resp))
+
+		binding := &api.SPIAccessTokenBinding{}
+		assert.NoError(t, cl.Get(context.TODO(), client.ObjectKey{Name: "spi-pull-quay", Namespace: "ns"}, binding))
+		assert.Equal(t, "quay", binding.Spec.TokenPolicy.TokenName)
+		assert.Equal(t, api.TokenPolicyTypeNamed, binding.Spec.TokenPolicy.Type)
+		assert.Equal(t, "https://quay.io", binding.Spec.RepoUrl)
+		assert.Equal(t, corev1.SecretTypeDockerConfigJson, binding.Spec.Secret.Type)
+		assert.Equal(t, "spi-pull-quay", binding.Spec.Secret.Name)
+	})
+
+	t.Run("reuses the existing binding", func(t *testing.T) {
+		i, _ := newInjector(enabled, &api.SPIAccessTokenBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "spi-pull-quay", Namespace: "ns", Labels: map[string]string{pullSecretTokenLabel: "quay"}},
+			Spec:       api.SPIAccessTokenBindingSpec{Secret: api.SecretSpec{Name: "spi-pull-quay"}},
+		})
+		resp := i.Handle(context.TODO(), request(false, "quay.io/acme/app"))
+		assert.Equal(t, []interface{}{map[string]interface{}{"name": "spi-pull-quay"}}, pullSecretsPatch(t, resp))
+	})
+
+	t.Run("doesn't use the binding of the user", func(t *testing.T) {
+		i, _ := newInjector(enabled, &api.SPIAccessTokenBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "spi-pull-quay", Namespace: "ns"},
+			Spec:       api.SPIAccessTokenBindingSpec{Secret: api.SecretSpec{Name: "users-secret"}},
+		})
+		resp := i.Handle(context.TODO(), request(false, "quay.io/acme/app"))
+		assert.True(t, resp.Allowed)
+		assert.Empty(t, resp.Patches)
+	})
+
+	t.Run("dry run creates nothing", func(t *testing.T) {
+		i, cl := newInjector(enabled)
+		resp := i.Handle(context.TODO(), request(true, "quay.io/acme/app"))
+		assert.NotNil(t, pullSecretsPatch(t, resp))
+
+		bindings := &api.SPIAccessTokenBindingList{}
+		assert.NoError(t, cl.List(context.TODO(), bindings))
+		assert.Empty(t, bindings.Items)
+	})
+
+	t.Run("no token for the registry", func(t *testing.T) {
+		i, _ := newInjector(enabled)
+		resp := i.Handle(context.TODO(), request(false, "registry.acme.com/app"))
+		assert.True(t, resp.Allowed)
+		assert.Empty(t, resp.Patches)
+	})
+
+	t.Run("namespaces without the label are untouched", func(t *testing.T) {
+		i, cl := newInjector(nil)
+		resp := i.Handle(context.TODO(), request(false, "quay.io/acme/app"))
+		assert.True(t, resp.Allowed)
+		assert.Empty(t, resp.Patches)
+
+		bindings := &api.SPIAccessTokenBindingList{}
+		assert.NoError(t, cl.List(context.TODO(), bindings))
+		assert.Empty(t, bindings.Items)
+	})
+}
@@ -0,0 +1,119 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	admissionv1 "k8s.io/api/admission/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// ScopeValidatorPath is the path on which the ScopeValidator is served by the webhook server.
+const ScopeValidatorPath = "/validate-scopes"
+
+//+kubebuilder:webhook:path=/validate-scopes,mutating=false,failurePolicy=ignore,sideEffects=None,groups=appstudio.redhat.com,resources=spiaccesstokens;spiaccesstokenbindings,verbs=create;update,versions=v1beta1,name=vscopes.spi.appstudio.redhat.com,admissionReviewVersions=v1
+
+// ScopeValidator is an admission handler rejecting the SPIAccessTokens and SPIAccessTokenBindings with permissions
+// that their service provider doesn't support. Without it, such objects would only fail later, during the
+// reconciliation or even during the OAuth flow.
+//
+// It also rejects the objects pointing to the hosts not allowed by the configuration (see
+// serviceprovider.ErrUrlNotAllowed). The updates are only rejected for that reason if they change the URL, so that
+// the objects created before the host was denied can still be finalized.
+//
+// The objects for which the service provider cannot be determined otherwise are admitted, because the controllers
+// report that condition in their status.
+type ScopeValidator struct {
+	ServiceProviderFactory serviceprovider.Factory
+}
+
+var _ admission.Handler = (*ScopeValidator)(nil)
+
+func (v *ScopeValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	lg := log.FromContext(ctx, "kind", req.Kind.Kind, "name", req.Name, "namespace", req.Namespace)
+
+	var validated serviceprovider.Validated
+	var url string
+
+	switch req.Kind.Kind {
+	case "SPIAccessToken":
+		token := &api.SPIAccessToken{}
+		if err := json.Unmarshal(req.Object.Raw, token); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		validated = token
+		url = token.Spec.ServiceProviderUrl
+	case "SPIAccessTokenBinding":
+		binding := &api.SPIAccessTokenBinding{}
+		if err := json.Unmarshal(req.Object.Raw, binding); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		validated = binding
+		url = binding.Spec.RepoUrl
+	default:
+		return admission.Allowed("")
+	}
+
+	sp, err := v.ServiceProviderFactory.FromRepoUrl(url)
+	if errors.Is(err, serviceprovider.ErrUrlNotAllowed) && (req.Operation != admissionv1.Update || urlChanged(req, url)) {
+		return admission.Denied(err.Error())
+	}
+	if err != nil {
+		lg.Info("could not determine the service provider, skipping the scope validation", "url", url, "error", err.Error())
+		return admission.Allowed("")
+	}
+
+	result, err := sp.Validate(ctx, validated)
+	if err != nil {
+		lg.Error(err, "failed to validate the permissions")
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	if len(result.ScopeValidation) > 0 {
+		msgs := make([]string, len(result.ScopeValidation))
+		for i, e := range result.ScopeValidation {
+			msgs[i] = e.Error()
+		}
+		return admission.Denied(strings.Join(msgs, ", "))
+	}
+
+	return admission.Allowed("")
+}
+
+// urlChanged checks whether the URL of the object differs from the URL of the object before the update. The old object
+// is either an SPIAccessToken with the serviceProviderUrl or an SPIAccessTokenBinding with the repoUrl.
+func urlChanged(req admission.Request, url string) bool {
+	old := struct {
+		Spec struct {
+			ServiceProviderUrl string `json:"serviceProviderUrl"`
+			RepoUrl            string `json:"repoUrl"`
+		} `json:"spec"`
+	}{}
+	if err := json.Unmarshal(req.OldObject.Raw, &old); err != nil {
+		return true
+	}
+	if old.Spec.ServiceProviderUrl != "" {
+		return old.Spec.ServiceProviderUrl != url
+	}
+	return old.Spec.RepoUrl != url
+}
@@ -0,0 +1,129 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider/github"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestScopeValidator_Handle(t *testing.T) {
+	v := &ScopeValidator{
+		ServiceProviderFactory: serviceprovider.Factory{
+			Configuration: config.NewLiveConfiguration(config.Configuration{
+				ServiceProviders: []config.ServiceProviderConfiguration{
+					{
+						ServiceProviderType: config.ServiceProviderTypeGitHub,
+						ClientId:            "id",
+						ClientSecret:        "secret",
+					},
+				},
+			}),
+			HttpClient: http.DefaultClient,
+			Initializers: map[config.ServiceProviderType]serviceprovider.Initializer{
+				config.ServiceProviderTypeGitHub: github.Initializer,
+			},
+		},
+	}
+
+	request := func(kind string, obj interface{}) admission.Request {
+		raw, err := json.Marshal(obj)
+		assert.NoError(t, err)
+		return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			Kind:   metav1.GroupVersionKind{Group: api.GroupVersion.Group, Version: api.GroupVersion.Version, Kind: kind},
+			Object: runtime.RawExtension{Raw: raw},
+		}}
+	}
+
+	binding := func(repoUrl string, scopes ...string) *api.SPIAccessTokenBinding {
+		return &api.SPIAccessTokenBinding{
+			Spec: api.SPIAccessTokenBindingSpec{
+				RepoUrl:     repoUrl,
+				Permissions: api.Permissions{AdditionalScopes: scopes},
+			},
+		}
+	}
+
+	t.Run("valid binding", func(t *testing.T) {
+		res := v.Handle(context.TODO(), request("SPIAccessTokenBinding", binding("https://github.com/acme/repo", "repo")))
+		assert.True(t, res.Allowed)
+	})
+
+	t.Run("invalid binding", func(t *testing.T) {
+		res := v.Handle(context.TODO(), request("SPIAccessTokenBinding", binding("https://github.com/acme/repo", "repo:stauts")))
+		assert.False(t, res.Allowed)
+		assert.True(t, strings.Contains(string(res.Result.Reason), "did you mean 'repo:status'?"))
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		res := v.Handle(context.TODO(), request("SPIAccessToken", &api.SPIAccessToken{
+			Spec: api.SPIAccessTokenSpec{
+				ServiceProviderUrl: "https://github.com",
+				Permissions:        api.Permissions{AdditionalScopes: []string{"blah"}},
+			},
+		}))
+		assert.False(t, res.Allowed)
+		assert.True(t, strings.HasPrefix(string(res.Result.Reason), "unknown scope: 'blah' ("))
+		assert.Contains(t, string(res.Result.Reason), "https://docs.github.com/")
+	})
+
+	t.Run("unknown service provider", func(t *testing.T) {
+		res := v.Handle(context.TODO(), request("SPIAccessTokenBinding", binding("https://acme.com/acme/repo", "blah")))
+		assert.True(t, res.Allowed)
+	})
+
+	t.Run("other kinds", func(t *testing.T) {
+		res := v.Handle(context.TODO(), request("SPIAccessCheck", &api.SPIAccessCheck{}))
+		assert.True(t, res.Allowed)
+	})
+
+	t.Run("denied host", func(t *testing.T) {
+		denying := &ScopeValidator{ServiceProviderFactory: v.ServiceProviderFactory}
+		denying.ServiceProviderFactory.Configuration = config.NewLiveConfiguration(config.Configuration{
+			ServiceProviderHostDenyList: []string{"*.svc"},
+		})
+
+		created := request("SPIAccessTokenBinding", binding("https://vault.spi.svc/v1/secret"))
+		created.Operation = admissionv1.Create
+		res := denying.Handle(context.TODO(), created)
+		assert.False(t, res.Allowed)
+		assert.Contains(t, string(res.Result.Reason), "vault.spi.svc")
+
+		unchanged := request("SPIAccessTokenBinding", binding("https://vault.spi.svc/v1/secret"))
+		unchanged.Operation = admissionv1.Update
+		unchanged.OldObject = unchanged.Object
+		res = denying.Handle(context.TODO(), unchanged)
+		assert.True(t, res.Allowed)
+
+		changed := request("SPIAccessTokenBinding", binding("https://vault.spi.svc/v1/secret"))
+		changed.Operation = admissionv1.Update
+		changed.OldObject = request("SPIAccessTokenBinding", binding("https://github.com/acme/repo")).Object
+		res = denying.Handle(context.TODO(), changed)
+		assert.False(t, res.Allowed)
+	})
+}
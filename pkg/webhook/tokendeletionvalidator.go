@@ -0,0 +1,114 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	opconfig "github.com/redhat-appstudio/service-provider-integration-operator/pkg/config"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// TokenDeletionValidatorPath is the path on which the TokenDeletionValidator is served by the webhook server.
+const TokenDeletionValidatorPath = "/validate-token-deletion"
+
+// maxListedBindings limits the number of the bindings named in the deletion warning.
+const maxListedBindings = 5
+
+//+kubebuilder:webhook:path=/validate-token-deletion,mutating=false,failurePolicy=ignore,sideEffects=None,groups=appstudio.redhat.com,resources=spiaccesstokens,verbs=delete,versions=v1beta1,name=vtokendeletion.spi.appstudio.redhat.com,admissionReviewVersions=v1
+
+// TokenDeletionValidator is an admission handler giving an immediate feedback to the users deleting
+// the SPIAccessTokens that still have linked bindings. Such tokens are only removed once their bindings are deleted (or
+// relinked), so without the webhook, the deletion seemingly does nothing. Depending on the configured
+// config.InUseTokenDeletionPolicy, the deletion is either allowed with a warning or denied.
+type TokenDeletionValidator struct {
+	// Client is used to list the bindings linked to the token. If nil, the bindings recorded in the status of
+	// the token are used.
+	Client        client.Client
+	Configuration *config.LiveConfiguration
+}
+
+var _ admission.Handler = (*TokenDeletionValidator)(nil)
+
+func (v *TokenDeletionValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Kind.Kind != "SPIAccessToken" || len(req.OldObject.Raw) == 0 {
+		return admission.Allowed("")
+	}
+
+	token := &api.SPIAccessToken{}
+	if err := json.Unmarshal(req.OldObject.Raw, token); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	bindings, err := v.linkedBindings(ctx, token)
+	if err != nil {
+		log.FromContext(ctx, "name", req.Name, "namespace", req.Namespace).Error(err, "failed to list the bindings linked to the deleted token")
+		return admission.Allowed("")
+	}
+
+	if len(bindings) == 0 {
+		return admission.Allowed("")
+	}
+
+	if v.Configuration != nil && v.Configuration.Get().InUseTokenDeletionPolicy == config.InUseTokenDeletionPolicyDeny {
+		return admission.Denied(fmt.Sprintf("the token '%s' is used by %s, delete them first", token.Name, describeBindings(bindings)))
+	}
+
+	return admission.Allowed("").WithWarnings(fmt.Sprintf("the token '%s' is used by %s, it is only deleted once they are deleted", token.Name, describeBindings(bindings)))
+}
+
+// linkedBindings returns the sorted names of the bindings linked to the token.
+func (v *TokenDeletionValidator) linkedBindings(ctx context.Context, token *api.SPIAccessToken) ([]string, error) {
+	if v.Client == nil {
+		return token.Status.LinkedBindings, nil
+	}
+
+	list := &api.SPIAccessTokenBindingList{}
+	if err := v.Client.List(ctx, list, client.InNamespace(token.Namespace), client.MatchingLabels{
+		opconfig.SPIAccessTokenLinkLabel: token.Name,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to list the linked bindings: %w", err)
+	}
+
+	names := make([]string, 0, len(list.Items))
+	for i := range list.Items {
+		if list.Items[i].DeletionTimestamp == nil {
+			names = append(names, list.Items[i].Name)
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func describeBindings(names []string) string {
+	listed := names
+	more := ""
+	if len(names) > maxListedBindings {
+		more = fmt.Sprintf(" and %d more", len(names)-maxListedBindings)
+		listed = names[:maxListedBindings]
+	}
+
+	return fmt.Sprintf("%d binding(s) (%s%s)", len(names), strings.Join(listed, ", "), more)
+}
@@ -0,0 +1,96 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	opconfig "github.com/redhat-appstudio/service-provider-integration-operator/pkg/config"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestTokenDeletionValidator_Handle(t *testing.T) {
+	deletion := func(recordedBindings ...string) admission.Request {
+		token := &api.SPIAccessToken{
+			ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "ns"},
+			Status: api.SPIAccessTokenStatus{
+				LinkedBindings:     recordedBindings,
+				LinkedBindingCount: len(recordedBindings),
+			},
+		}
+		raw, err := json.Marshal(token)
+		assert.NoError(t, err)
+		return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			Operation: admissionv1.Delete,
+			Kind:      metav1.GroupVersionKind{Group: api.GroupVersion.Group, Version: api.GroupVersion.Version, Kind: "SPIAccessToken"},
+			OldObject: runtime.RawExtension{Raw: raw},
+		}}
+	}
+
+	clientWithBindings := func(tokenNames ...string) client.Client {
+		sch := runtime.NewScheme()
+		assert.NoError(t, api.AddToScheme(sch))
+		objs := make([]client.Object, 0, len(tokenNames))
+		for i, tokenName := range tokenNames {
+			objs = append(objs, &api.SPIAccessTokenBinding{ObjectMeta: metav1.ObjectMeta{
+				Name:      string(rune('a' + i)),
+				Namespace: "ns",
+				Labels:    map[string]string{opconfig.SPIAccessTokenLinkLabel: tokenName},
+			}})
+		}
+		return fake.NewClientBuilder().WithScheme(sch).WithObjects(objs...).Build()
+	}
+
+	t.Run("no linked bindings", func(t *testing.T) {
+		v := &TokenDeletionValidator{Client: clientWithBindings("other")}
+		res := v.Handle(context.TODO(), deletion())
+		assert.True(t, res.Allowed)
+		assert.Empty(t, res.Warnings)
+	})
+
+	t.Run("warns about linked bindings", func(t *testing.T) {
+		v := &TokenDeletionValidator{Client: clientWithBindings("token", "other", "token")}
+		res := v.Handle(context.TODO(), deletion())
+		assert.True(t, res.Allowed)
+		assert.Equal(t, []string{"the token 'token' is used by 2 binding(s) (a, c), it is only deleted once they are deleted"}, res.Warnings)
+	})
+
+	t.Run("denies per configuration", func(t *testing.T) {
+		v := &TokenDeletionValidator{
+			Client:        clientWithBindings("token"),
+			Configuration: config.NewLiveConfiguration(config.Configuration{InUseTokenDeletionPolicy: config.InUseTokenDeletionPolicyDeny}),
+		}
+		res := v.Handle(context.TODO(), deletion())
+		assert.False(t, res.Allowed)
+		assert.Equal(t, "the token 'token' is used by 1 binding(s) (a), delete them first", string(res.Result.Reason))
+	})
+
+	t.Run("uses the status without client", func(t *testing.T) {
+		v := &TokenDeletionValidator{}
+		res := v.Handle(context.TODO(), deletion("a", "b", "c", "d", "e", "f", "g"))
+		assert.True(t, res.Allowed)
+		assert.Equal(t, []string{"the token 'token' is used by 7 binding(s) (a, b, c, d, e and 2 more), it is only deleted once they are deleted"}, res.Warnings)
+	})
+}
@@ -0,0 +1,190 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	admissionv1 "k8s.io/api/admission/v1"
+	authv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// TokenOwnershipPath is the path on which the TokenOwnershipWebhook is served by the webhook server.
+const TokenOwnershipPath = "/mutate-token-ownership"
+
+//+kubebuilder:webhook:path=/mutate-token-ownership,mutating=true,failurePolicy=fail,sideEffects=None,groups=appstudio.redhat.com,resources=spiaccesstokens;spiaccesstokenbindings,verbs=create;update,versions=v1beta1,name=mownership.spi.appstudio.redhat.com,admissionReviewVersions=v1
+
+// TokenOwnershipWebhook is an admission handler enforcing the ownership of the tokens recorded in
+// the api.TokenOwnerAnnotation. Only the token ownership admins can set or change the owner of a token. The bindings
+// are annotated with their creator so that the operator only lets them use the tokens of that user (see
+// api.SPIAccessTokenBinding.MayUseToken), and the bindings naming a token owned by someone else are rejected outright.
+// The creator annotations cannot be changed once set.
+type TokenOwnershipWebhook struct {
+	Client        client.Client
+	Configuration *config.LiveConfiguration
+}
+
+var _ admission.Handler = (*TokenOwnershipWebhook)(nil)
+
+func (w *TokenOwnershipWebhook) Handle(ctx context.Context, req admission.Request) admission.Response {
+	switch req.Kind.Kind {
+	case "SPIAccessToken":
+		return w.handleToken(req)
+	case "SPIAccessTokenBinding":
+		return w.handleBinding(ctx, req)
+	default:
+		return admission.Allowed("")
+	}
+}
+
+func (w *TokenOwnershipWebhook) handleToken(req admission.Request) admission.Response {
+	token := &api.SPIAccessToken{}
+	if err := json.Unmarshal(req.Object.Raw, token); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	oldOwner := ""
+	if req.Operation == admissionv1.Update {
+		old := &api.SPIAccessToken{}
+		if err := json.Unmarshal(req.OldObject.Raw, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		oldOwner = old.Annotations[api.TokenOwnerAnnotation]
+	}
+
+	if token.Annotations[api.TokenOwnerAnnotation] != oldOwner && !w.isAdmin(req.UserInfo) {
+		return admission.Denied("only the token ownership admins can change the owner of the token")
+	}
+
+	return admission.Allowed("")
+}
+
+func (w *TokenOwnershipWebhook) handleBinding(ctx context.Context, req admission.Request) admission.Response {
+	binding := &api.SPIAccessTokenBinding{}
+	if err := json.Unmarshal(req.Object.Raw, binding); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	var old *api.SPIAccessTokenBinding
+	if req.Operation == admissionv1.Update {
+		old = &api.SPIAccessTokenBinding{}
+		if err := json.Unmarshal(req.OldObject.Raw, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+	}
+
+	if old == nil || namedToken(binding) != namedToken(old) {
+		if resp := w.checkNamedToken(ctx, req, binding); resp != nil {
+			return *resp
+		}
+	}
+
+	if binding.Annotations == nil {
+		binding.Annotations = map[string]string{}
+	}
+	if old == nil {
+		binding.Annotations[api.BindingCreatorAnnotation] = req.UserInfo.Username
+		if w.isAdmin(req.UserInfo) {
+			binding.Annotations[api.BindingCreatedByAdminAnnotation] = "true"
+		} else {
+			delete(binding.Annotations, api.BindingCreatedByAdminAnnotation)
+		}
+	} else {
+		restoreAnnotation(binding, old, api.BindingCreatorAnnotation)
+		restoreAnnotation(binding, old, api.BindingCreatedByAdminAnnotation)
+	}
+
+	marshaled, err := json.Marshal(binding)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
+
+// checkNamedToken rejects the binding if it names a token (either in its token reference or in its token policy) owned
+// by another user than the one making the request. Returns nil if the binding can be admitted.
+func (w *TokenOwnershipWebhook) checkNamedToken(ctx context.Context, req admission.Request, binding *api.SPIAccessTokenBinding) *admission.Response {
+	tokenName := namedToken(binding)
+	if tokenName == "" {
+		return nil
+	}
+
+	token := &api.SPIAccessToken{}
+	if err := w.Client.Get(ctx, client.ObjectKey{Name: tokenName, Namespace: req.Namespace}, token); err != nil {
+		if errors.IsNotFound(err) {
+			// the binding waits for the token and the operator checks the ownership once the token exists
+			return nil
+		}
+		log.FromContext(ctx).Error(err, "failed to read the named token")
+		resp := admission.Errored(http.StatusInternalServerError, err)
+		return &resp
+	}
+
+	owner := token.Annotations[api.TokenOwnerAnnotation]
+	if owner == "" || owner == req.UserInfo.Username || w.isAdmin(req.UserInfo) {
+		return nil
+	}
+
+	resp := admission.Denied(fmt.Sprintf("the token %s is owned by another user", token.Name))
+	return &resp
+}
+
+// namedToken returns the name of the token the binding names either in its token reference or in its token policy or
+// an empty string if it names none.
+func namedToken(binding *api.SPIAccessTokenBinding) string {
+	if binding.Spec.TokenRef != nil {
+		return binding.Spec.TokenRef.Name
+	} else if binding.Spec.TokenPolicy.Type == api.TokenPolicyTypeNamed {
+		return binding.Spec.TokenPolicy.TokenName
+	}
+	return ""
+}
+
+// isAdmin checks whether the user is one of the configured token ownership admins.
+func (w *TokenOwnershipWebhook) isAdmin(user authv1.UserInfo) bool {
+	cfg := w.Configuration.Get()
+	for _, u := range cfg.TokenOwnershipAdminUsers {
+		if u == user.Username {
+			return true
+		}
+	}
+	for _, g := range cfg.TokenOwnershipAdminGroups {
+		for _, ug := range user.Groups {
+			if g == ug {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// restoreAnnotation sets the annotation of the updated binding to its value in the old binding.
+func restoreAnnotation(updated *api.SPIAccessTokenBinding, old *api.SPIAccessTokenBinding, annotation string) {
+	if value, ok := old.Annotations[annotation]; ok {
+		updated.Annotations[annotation] = value
+	} else {
+		delete(updated.Annotations, annotation)
+	}
+}
@@ -0,0 +1,219 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	authv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestTokenOwnershipWebhook_Handle(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, api.AddToScheme(sch))
+
+	w := &TokenOwnershipWebhook{
+		Client: fake.NewClientBuilder().WithScheme(sch).WithObjects(
+			&api.SPIAccessToken{ObjectMeta: metav1.ObjectMeta{Name: "owned", Namespace: "ns", Annotations: map[string]string{
+				api.TokenOwnerAnnotation: "alice",
+			}}},
+			&api.SPIAccessToken{ObjectMeta: metav1.ObjectMeta{Name: "shared", Namespace: "ns"}},
+		).Build(),
+		Configuration: config.NewLiveConfiguration(config.Configuration{
+			TokenOwnershipAdminUsers:  []string{"system:serviceaccount:spi:oauth"},
+			TokenOwnershipAdminGroups: []string{"admins"},
+		}),
+	}
+
+	alice := authv1.UserInfo{Username: "alice"}
+	bob := authv1.UserInfo{Username: "bob"}
+	admin := authv1.UserInfo{Username: "carol", Groups: []string{"admins"}}
+
+	request := func(user authv1.UserInfo, kind string, old interface{}, obj interface{}) admission.Request {
+		raw, err := json.Marshal(obj)
+		assert.NoError(t, err)
+		req := admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			Operation: admissionv1.Create,
+			Namespace: "ns",
+			UserInfo:  user,
+			Kind:      metav1.GroupVersionKind{Group: api.GroupVersion.Group, Version: api.GroupVersion.Version, Kind: kind},
+			Object:    runtime.RawExtension{Raw: raw},
+		}}
+		if old != nil {
+			oldRaw, err := json.Marshal(old)
+			assert.NoError(t, err)
+			req.Operation = admissionv1.Update
+			req.OldObject = runtime.RawExtension{Raw: oldRaw}
+		}
+		return req
+	}
+
+	token := func(owner string) *api.SPIAccessToken {
+		tkn := &api.SPIAccessToken{ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "ns"}}
+		if owner != "" {
+			tkn.Annotations = map[string]string{api.TokenOwnerAnnotation: owner}
+		}
+		return tkn
+	}
+
+	binding := func(tokenName string, annotations map[string]string) *api.SPIAccessTokenBinding {
+		b := &api.SPIAccessTokenBinding{ObjectMeta: metav1.ObjectMeta{Name: "binding", Namespace: "ns", Annotations: annotations}}
+		if tokenName != "" {
+			b.Spec.TokenPolicy = api.TokenPolicy{Type: api.TokenPolicyTypeNamed, TokenName: tokenName}
+		}
+		return b
+	}
+
+	patchedAnnotations := func(t *testing.T, resp admission.Response) map[string]interface{} {
+		assert.True(t, resp.Allowed)
+		annos := map[string]interface{}{}
+		for _, p := range resp.Patches {
+			if p.Path == "/metadata/annotations" {
+				for k, v := range p.Value.(map[string]interface{}) {
+					annos[k] = v
+				}
+			} else if strings.HasPrefix(p.Path, "/metadata/annotations/") {
+				annos[strings.ReplaceAll(p.Path[len("/metadata/annotations/"):], "~1", "/")] = p.Value
+			}
+		}
+		return annos
+	}
+
+	t.Run("token owner set by admin", func(t *testing.T) {
+		resp := w.Handle(context.TODO(), request(admin, "SPIAccessToken", nil, token("alice")))
+		assert.True(t, resp.Allowed)
+	})
+
+	t.Run("token owner set by user", func(t *testing.T) {
+		resp := w.Handle(context.TODO(), request(alice, "SPIAccessToken", nil, token("alice")))
+		assert.False(t, resp.Allowed)
+	})
+
+	t.Run("token owner changed by user", func(t *testing.T) {
+		resp := w.Handle(context.TODO(), request(bob, "SPIAccessToken", token("alice"), token("bob")))
+		assert.False(t, resp.Allowed)
+	})
+
+	t.Run("token without owner", func(t *testing.T) {
+		resp := w.Handle(context.TODO(), request(bob, "SPIAccessToken", nil, token("")))
+		assert.True(t, resp.Allowed)
+	})
+
+	t.Run("token with unchanged owner", func(t *testing.T) {
+		resp := w.Handle(context.TODO(), request(bob, "SPIAccessToken", token("alice"), token("alice")))
+		assert.True(t, resp.Allowed)
+	})
+
+	t.Run("binding records the creator", func(t *testing.T) {
+		annos := patchedAnnotations(t, w.Handle(context.TODO(), request(bob, "SPIAccessTokenBinding", nil, binding("", nil))))
+		assert.Equal(t, "bob", annos[api.BindingCreatorAnnotation])
+		assert.NotContains(t, annos, api.BindingCreatedByAdminAnnotation)
+	})
+
+	t.Run("binding records the admin", func(t *testing.T) {
+		annos := patchedAnnotations(t, w.Handle(context.TODO(), request(admin, "SPIAccessTokenBinding", nil, binding("", nil))))
+		assert.Equal(t, "carol", annos[api.BindingCreatorAnnotation])
+		assert.Equal(t, "true", annos[api.BindingCreatedByAdminAnnotation])
+	})
+
+	t.Run("binding cannot forge the creator", func(t *testing.T) {
+		resp := w.Handle(context.TODO(), request(bob, "SPIAccessTokenBinding", nil, binding("", map[string]string{
+			api.BindingCreatorAnnotation:        "alice",
+			api.BindingCreatedByAdminAnnotation: "true",
+		})))
+		assert.True(t, resp.Allowed)
+		annos := patchedAnnotations(t, resp)
+		assert.Equal(t, "bob", annos[api.BindingCreatorAnnotation])
+		removed := false
+		for _, p := range resp.Patches {
+			removed = removed || (p.Operation == "remove" && p.Path == "/metadata/annotations/spi.appstudio.redhat.com~1created-by-admin")
+		}
+		assert.True(t, removed)
+	})
+
+	t.Run("binding update restores the creator", func(t *testing.T) {
+		old := binding("", map[string]string{api.BindingCreatorAnnotation: "alice"})
+		updated := binding("", map[string]string{api.BindingCreatorAnnotation: "bob"})
+		annos := patchedAnnotations(t, w.Handle(context.TODO(), request(bob, "SPIAccessTokenBinding", old, updated)))
+		assert.Equal(t, "alice", annos[api.BindingCreatorAnnotation])
+	})
+
+	t.Run("binding naming token of another user", func(t *testing.T) {
+		resp := w.Handle(context.TODO(), request(bob, "SPIAccessTokenBinding", nil, binding("owned", nil)))
+		assert.False(t, resp.Allowed)
+	})
+
+	t.Run("binding referencing token of another user", func(t *testing.T) {
+		b := binding("", nil)
+		b.Spec.TokenRef = &api.TokenReference{Name: "owned"}
+		resp := w.Handle(context.TODO(), request(bob, "SPIAccessTokenBinding", nil, b))
+		assert.False(t, resp.Allowed)
+	})
+
+	t.Run("binding naming token of another user by admin", func(t *testing.T) {
+		resp := w.Handle(context.TODO(), request(admin, "SPIAccessTokenBinding", nil, binding("owned", nil)))
+		assert.True(t, resp.Allowed)
+	})
+
+	t.Run("binding naming own token", func(t *testing.T) {
+		resp := w.Handle(context.TODO(), request(alice, "SPIAccessTokenBinding", nil, binding("owned", nil)))
+		assert.True(t, resp.Allowed)
+	})
+
+	t.Run("binding naming unowned token", func(t *testing.T) {
+		resp := w.Handle(context.TODO(), request(bob, "SPIAccessTokenBinding", nil, binding("shared", nil)))
+		assert.True(t, resp.Allowed)
+	})
+
+	t.Run("binding naming missing token", func(t *testing.T) {
+		resp := w.Handle(context.TODO(), request(bob, "SPIAccessTokenBinding", nil, binding("missing", nil)))
+		assert.True(t, resp.Allowed)
+	})
+
+	t.Run("binding update switching to token of another user", func(t *testing.T) {
+		old := binding("shared", map[string]string{api.BindingCreatorAnnotation: "bob"})
+		updated := binding("owned", map[string]string{api.BindingCreatorAnnotation: "bob"})
+		resp := w.Handle(context.TODO(), request(bob, "SPIAccessTokenBinding", old, updated))
+		assert.False(t, resp.Allowed)
+	})
+
+	t.Run("binding update switching the reference to token of another user", func(t *testing.T) {
+		old := binding("", map[string]string{api.BindingCreatorAnnotation: "bob"})
+		old.Spec.TokenRef = &api.TokenReference{Name: "shared"}
+		updated := old.DeepCopy()
+		updated.Spec.TokenRef.Name = "owned"
+		resp := w.Handle(context.TODO(), request(bob, "SPIAccessTokenBinding", old, updated))
+		assert.False(t, resp.Allowed)
+	})
+
+	t.Run("binding update keeping the token of another user", func(t *testing.T) {
+		old := binding("owned", map[string]string{api.BindingCreatorAnnotation: "bob"})
+		updated := old.DeepCopy()
+		updated.Labels = map[string]string{"a": "b"}
+		resp := w.Handle(context.TODO(), request(bob, "SPIAccessTokenBinding", old, updated))
+		assert.True(t, resp.Allowed)
+	})
+}
@@ -0,0 +1,209 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	sperrors "github.com/redhat-appstudio/service-provider-integration-operator/pkg/errors"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	authnv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// TokenValidationPath is the path on which the TokenValidator is served by the webhook server.
+const TokenValidationPath = "/validate-token"
+
+//+kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+//+kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+// TokenValidationRequest is the body of the requests to the TokenValidator.
+type TokenValidationRequest struct {
+	// Namespace is the namespace into which the token is about to be uploaded. The service provider configuration
+	// overrides of the namespace are taken into account.
+	Namespace          string `json:"namespace"`
+	ServiceProviderUrl string `json:"serviceProviderUrl"`
+	// Username is only required for the username and password credentials.
+	Username string `json:"username,omitempty"`
+	Token    string `json:"token"`
+}
+
+// TokenValidationResponse is the body of the responses of the TokenValidator to the processed requests.
+type TokenValidationResponse struct {
+	Valid    bool     `json:"valid"`
+	Username string   `json:"username,omitempty"`
+	Scopes   []string `json:"scopes,omitempty"`
+	// RepositoryPermissions is only returned for the tokens that are granted the permissions per repository instead of
+	// the scopes, like the GitHub fine-grained personal access tokens.
+	RepositoryPermissions map[string]api.RepositoryPermissions `json:"repositoryPermissions,omitempty"`
+	// Message describes why the token is not valid.
+	Message string `json:"message,omitempty"`
+}
+
+// TokenValidator is an HTTP handler checking the credentials with the service provider before they are uploaded so
+// that the users get an immediate feedback on e.g. a mistyped token. Nothing is stored by the validation.
+//
+// The callers authenticate using their Kubernetes bearer token and need to be allowed to create the SPIAccessTokens
+// in the namespace of the request, so that the endpoint cannot be used to probe the service providers anonymously.
+type TokenValidator struct {
+	Client                 client.Client
+	ServiceProviderFactory serviceprovider.Factory
+}
+
+var _ http.Handler = (*TokenValidator)(nil)
+
+func (v *TokenValidator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req := TokenValidationRequest{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize)).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("failed to parse the request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if req.Namespace == "" || req.ServiceProviderUrl == "" {
+		http.Error(w, "namespace and serviceProviderUrl are required", http.StatusBadRequest)
+		return
+	}
+
+	lg := log.FromContext(ctx, "namespace", req.Namespace, "serviceProviderUrl", req.ServiceProviderUrl)
+
+	// the users authenticate with their ordinary tokens issued for the API server
+	user, status, err := authenticateBearer(r, v.Client, "")
+	if err != nil {
+		lg.Error(err, "failed to authenticate the token validation request")
+		http.Error(w, "failed to authenticate the request", http.StatusInternalServerError)
+		return
+	}
+	if status != http.StatusOK {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	allowed, err := v.authorize(r, user, req.Namespace)
+	if err != nil {
+		lg.Error(err, "failed to authorize the token validation request")
+		http.Error(w, "failed to authorize the request", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		http.Error(w, fmt.Sprintf("not allowed to create the SPIAccessTokens in the namespace '%s'", req.Namespace), http.StatusForbidden)
+		return
+	}
+
+	sp, err := v.ServiceProviderFactory.FromRepoUrlInNamespace(ctx, req.ServiceProviderUrl, req.Namespace)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if window := v.ServiceProviderFactory.Configuration.Get().ActiveMaintenanceWindow(config.ServiceProviderType(sp.GetType()), sp.GetBaseUrl(), time.Now()); window != nil {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(window.End).Seconds()))))
+		http.Error(w, fmt.Sprintf("the service provider is under maintenance until %s", window.End.UTC().Format(time.RFC3339)), http.StatusServiceUnavailable)
+		return
+	}
+
+	tokenData := &api.Token{
+		Username:    req.Username,
+		AccessToken: req.Token,
+	}
+	if req.Username != "" {
+		tokenData.TokenType = api.BasicAuthTokenType
+	}
+
+	resp := TokenValidationResponse{}
+
+	if err = sp.ValidateCredentials(ctx, tokenData); err != nil {
+		if sperrors.IsServiceProviderError(err) && !sperrors.IsInvalidAccessToken(err) {
+			lg.Error(err, "failed to validate the credentials")
+			http.Error(w, "failed to validate the credentials with the service provider", http.StatusInternalServerError)
+			return
+		}
+		resp.Message = err.Error()
+		writeTokenValidationResponse(w, &resp)
+		return
+	}
+
+	resp.Valid = true
+	if inspector, ok := sp.(serviceprovider.CredentialsInspector); ok {
+		metadata, err := inspector.InspectCredentials(ctx, tokenData)
+		if err != nil {
+			if !sperrors.IsInvalidAccessToken(err) {
+				lg.Error(err, "failed to inspect the credentials")
+				http.Error(w, "failed to inspect the credentials with the service provider", http.StatusInternalServerError)
+				return
+			}
+			resp.Valid = false
+			resp.Message = err.Error()
+		} else {
+			resp.Username = metadata.Username
+			resp.Scopes = metadata.Scopes
+			resp.RepositoryPermissions = metadata.RepositoryPermissions
+		}
+	}
+
+	writeTokenValidationResponse(w, &resp)
+}
+
+// authorize checks that the user can create the SPIAccessTokens in the provided namespace.
+func (v *TokenValidator) authorize(r *http.Request, user *authnv1.UserInfo, namespace string) (bool, error) {
+	extra := make(map[string]authzv1.ExtraValue, len(user.Extra))
+	for k, v := range user.Extra {
+		extra[k] = authzv1.ExtraValue(v)
+	}
+
+	review := &authzv1.SubjectAccessReview{
+		Spec: authzv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			UID:    user.UID,
+			Groups: user.Groups,
+			Extra:  extra,
+			ResourceAttributes: &authzv1.ResourceAttributes{
+				Namespace: namespace,
+				Verb:      "create",
+				Group:     api.GroupVersion.Group,
+				Version:   api.GroupVersion.Version,
+				Resource:  "spiaccesstokens",
+			},
+		},
+	}
+	if err := v.Client.Create(r.Context(), review); err != nil {
+		return false, fmt.Errorf("failed to create the SubjectAccessReview: %w", err)
+	}
+
+	return review.Status.Allowed, nil
+}
+
+func writeTokenValidationResponse(w http.ResponseWriter, resp *TokenValidationResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Log.Error(err, "failed to write the token validation response")
+	}
+}
@@ -0,0 +1,215 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	sperrors "github.com/redhat-appstudio/service-provider-integration-operator/pkg/errors"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/serviceprovider"
+	"github.com/redhat-appstudio/service-provider-integration-operator/pkg/spi-shared/config"
+	"github.com/stretchr/testify/assert"
+	authnv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// reviewingClient answers the TokenReviews and SubjectAccessReviews like the API server would. Only the "user-token"
+// is authenticated and only in the "allowed" namespace the user can create the SPIAccessTokens.
+type reviewingClient struct {
+	client.Client
+}
+
+func (c reviewingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	switch o := obj.(type) {
+	case *authnv1.TokenReview:
+		if o.Spec.Token == "user-token" {
+			o.Status.Authenticated = true
+			o.Status.User = authnv1.UserInfo{Username: "alice"}
+		}
+		return nil
+	case *authzv1.SubjectAccessReview:
+		o.Status.Allowed = o.Spec.User == "alice" && o.Spec.ResourceAttributes.Namespace == "allowed" &&
+			o.Spec.ResourceAttributes.Resource == "spiaccesstokens" && o.Spec.ResourceAttributes.Verb == "create"
+		return nil
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+// inspectingServiceProvider accepts only the "good" token. It only implements the methods used by the
+// TokenValidator.
+type inspectingServiceProvider struct {
+	serviceprovider.ServiceProvider
+}
+
+func (p inspectingServiceProvider) GetType() api.ServiceProviderType {
+	return "Acme"
+}
+
+func (p inspectingServiceProvider) GetBaseUrl() string {
+	return "https://acme.com"
+}
+
+func (p inspectingServiceProvider) ValidateCredentials(_ context.Context, tokenData *api.Token) error {
+	if tokenData.IsBasicAuth() {
+		return fmt.Errorf("username and password are not supported")
+	}
+	return serviceprovider.DefaultValidateCredentials(tokenData)
+}
+
+func (p inspectingServiceProvider) InspectCredentials(_ context.Context, tokenData *api.Token) (*api.TokenMetadata, error) {
+	switch tokenData.AccessToken {
+	case "good":
+		return &api.TokenMetadata{Username: "acme-user", Scopes: []string{"read", "write"}}, nil
+	case "failing":
+		return nil, &sperrors.ServiceProviderError{StatusCode: http.StatusServiceUnavailable, Response: "unavailable"}
+	default:
+		return nil, &sperrors.ServiceProviderError{StatusCode: http.StatusUnauthorized, Response: "bad credentials"}
+	}
+}
+
+func TestTokenValidator_ServeHTTP(t *testing.T) {
+	sch := runtime.NewScheme()
+	assert.NoError(t, corev1.AddToScheme(sch))
+	cl := reviewingClient{Client: fake.NewClientBuilder().WithScheme(sch).Build()}
+
+	v := &TokenValidator{
+		Client: cl,
+		ServiceProviderFactory: serviceprovider.Factory{
+			Configuration:    config.NewLiveConfiguration(config.Configuration{ServiceProviders: []config.ServiceProviderConfiguration{{ServiceProviderType: "Acme"}}}),
+			KubernetesClient: cl,
+			Initializers: map[config.ServiceProviderType]serviceprovider.Initializer{
+				"Acme": {
+					Probe: serviceprovider.ProbeFunc(func(_ *http.Client, url string) (string, error) {
+						if strings.HasPrefix(url, "https://acme.com") {
+							return "https://acme.com", nil
+						}
+						return "", nil
+					}),
+					Constructor: serviceprovider.ConstructorFunc(func(_ *serviceprovider.Factory, _ string) (serviceprovider.ServiceProvider, error) {
+						return inspectingServiceProvider{}, nil
+					}),
+				},
+			},
+		},
+	}
+
+	serve := func(method string, bearer string, req TokenValidationRequest) (*httptest.ResponseRecorder, TokenValidationResponse) {
+		body, err := json.Marshal(req)
+		assert.NoError(t, err)
+		r := httptest.NewRequest(method, TokenValidationPath, strings.NewReader(string(body)))
+		if bearer != "" {
+			r.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		w := httptest.NewRecorder()
+		v.ServeHTTP(w, r)
+
+		resp := TokenValidationResponse{}
+		if w.Code == http.StatusOK {
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		}
+		return w, resp
+	}
+
+	request := func(token string) TokenValidationRequest {
+		return TokenValidationRequest{Namespace: "allowed", ServiceProviderUrl: "https://acme.com", Token: token}
+	}
+
+	t.Run("valid token", func(t *testing.T) {
+		w, resp := serve(http.MethodPost, "user-token", request("good"))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.True(t, resp.Valid)
+		assert.Equal(t, "acme-user", resp.Username)
+		assert.Equal(t, []string{"read", "write"}, resp.Scopes)
+		assert.Empty(t, resp.Message)
+	})
+
+	t.Run("rejected token", func(t *testing.T) {
+		w, resp := serve(http.MethodPost, "user-token", request("bad"))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.False(t, resp.Valid)
+		assert.Contains(t, resp.Message, "bad credentials")
+	})
+
+	t.Run("invalid credentials", func(t *testing.T) {
+		req := request("good")
+		req.Username = "alice"
+		w, resp := serve(http.MethodPost, "user-token", req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.False(t, resp.Valid)
+		assert.Equal(t, "username and password are not supported", resp.Message)
+	})
+
+	t.Run("service provider failure", func(t *testing.T) {
+		w, _ := serve(http.MethodPost, "user-token", request("failing"))
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+
+	t.Run("unknown service provider", func(t *testing.T) {
+		req := request("good")
+		req.ServiceProviderUrl = "https://unknown.com"
+		w, _ := serve(http.MethodPost, "user-token", req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		w, _ := serve(http.MethodPost, "", request("good"))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w, _ = serve(http.MethodPost, "other-token", request("good"))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("forbidden namespace", func(t *testing.T) {
+		req := request("good")
+		req.Namespace = "forbidden"
+		w, _ := serve(http.MethodPost, "user-token", req)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("wrong method", func(t *testing.T) {
+		w, _ := serve(http.MethodGet, "user-token", request("good"))
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+
+	t.Run("missing fields", func(t *testing.T) {
+		w, _ := serve(http.MethodPost, "user-token", TokenValidationRequest{Token: "good"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("service provider under maintenance", func(t *testing.T) {
+		cfg := v.ServiceProviderFactory.Configuration
+		defer cfg.Set(cfg.Get())
+		cfg.Set(config.Configuration{ServiceProviders: []config.ServiceProviderConfiguration{{
+			ServiceProviderType: "Acme",
+			MaintenanceWindows:  []config.MaintenanceWindow{{Start: time.Now().Add(-time.Hour), End: time.Now().Add(time.Hour)}},
+		}}})
+
+		w, _ := serve(http.MethodPost, "user-token", request("good"))
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	})
+}
@@ -0,0 +1,148 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writeback
+
+import (
+	"context"
+	"fmt"
+
+	vault "github.com/hashicorp/vault/api"
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// The keys of the custom metadata recording the binding the data was written for.
+const (
+	bindingUIDMetadataKey       = "spi-binding-uid"
+	bindingNamespaceMetadataKey = "spi-binding-namespace"
+	bindingNameMetadataKey      = "spi-binding-name"
+)
+
+type vaultStore struct {
+	client *vault.Client
+	mount  string
+}
+
+var _ Store = (*vaultStore)(nil)
+
+// NewVaultStore creates a store writing the data to the KV version 2 secrets engine mounted at the provided path in
+// Vault. The binding that the data was written for is recorded in the custom metadata of the Vault secret.
+func NewVaultStore(client *vault.Client, mount string) Store {
+	return &vaultStore{client: client, mount: mount}
+}
+
+func (s *vaultStore) Write(ctx context.Context, binding *api.SPIAccessTokenBinding, path string, data map[string]string) error {
+	if err := ValidatePath(path); err != nil {
+		return err
+	}
+
+	exists, uid, err := s.owner(binding, path)
+	if err != nil {
+		return err
+	}
+	if exists && uid != string(binding.UID) {
+		return ErrNotOwned
+	}
+
+	if exists {
+		current, err := s.client.Logical().Read(s.path("data", binding, path))
+		if err != nil {
+			return fmt.Errorf("failed to read the data from Vault: %w", err)
+		}
+		if current != nil && sameData(current.Data["data"], data) {
+			return nil
+		}
+	}
+
+	// the ownership is recorded first so that the data is never left in Vault without it
+	if _, err := s.client.Logical().Write(s.path("metadata", binding, path), map[string]interface{}{
+		"custom_metadata": map[string]interface{}{
+			bindingUIDMetadataKey:       string(binding.UID),
+			bindingNamespaceMetadataKey: binding.Namespace,
+			bindingNameMetadataKey:      binding.Name,
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to write the ownership metadata to Vault: %w", err)
+	}
+
+	if _, err := s.client.Logical().Write(s.path("data", binding, path), map[string]interface{}{"data": data}); err != nil {
+		return fmt.Errorf("failed to write the data to Vault: %w", err)
+	}
+
+	return nil
+}
+
+func (s *vaultStore) Delete(ctx context.Context, binding *api.SPIAccessTokenBinding, path string) error {
+	if err := ValidatePath(path); err != nil {
+		return err
+	}
+
+	exists, uid, err := s.owner(binding, path)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+	if uid != string(binding.UID) {
+		logf.FromContext(ctx).Info("not deleting the write-back data not written for the binding", "path", path)
+		return nil
+	}
+
+	// deleting the metadata deletes all the versions of the data, too
+	if _, err := s.client.Logical().Delete(s.path("metadata", binding, path)); err != nil {
+		return fmt.Errorf("failed to delete the data from Vault: %w", err)
+	}
+
+	return nil
+}
+
+// owner checks whether there is a secret at the path and returns the UID of the binding it was written for. The UID
+// is empty if the secret was not written by the operator.
+func (s *vaultStore) owner(binding *api.SPIAccessTokenBinding, path string) (bool, string, error) {
+	secret, err := s.client.Logical().Read(s.path("metadata", binding, path))
+	if err != nil {
+		return false, "", fmt.Errorf("failed to read the metadata from Vault: %w", err)
+	}
+	if secret == nil {
+		return false, "", nil
+	}
+
+	custom, ok := secret.Data["custom_metadata"].(map[string]interface{})
+	if !ok {
+		return true, "", nil
+	}
+
+	uid, _ := custom[bindingUIDMetadataKey].(string)
+	return true, uid, nil
+}
+
+// sameData checks whether the data read from Vault is the same as the provided data.
+func sameData(vaultData interface{}, data map[string]string) bool {
+	m, ok := vaultData.(map[string]interface{})
+	if !ok || len(m) != len(data) {
+		return false
+	}
+	for k, v := range data {
+		if m[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *vaultStore) path(kind string, binding *api.SPIAccessTokenBinding, path string) string {
+	return fmt.Sprintf("%s/%s/%s/%s", s.mount, kind, binding.Namespace, path)
+}
@@ -0,0 +1,127 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writeback
+
+import (
+	"context"
+	"testing"
+
+	kv "github.com/hashicorp/vault-plugin-secrets-kv"
+	vaultapi "github.com/hashicorp/vault/api"
+	vaulthttp "github.com/hashicorp/vault/http"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/hashicorp/vault/vault"
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestVaultStore(t *testing.T) {
+	cluster := vault.NewTestCluster(t, &vault.CoreConfig{
+		LogicalBackends: map[string]logical.Factory{
+			"kv": kv.Factory,
+		},
+	}, &vault.TestClusterOptions{
+		HandlerFunc: vaulthttp.Handler,
+		NumCores:    1,
+	})
+	cluster.Start()
+	defer cluster.Cleanup()
+
+	client := cluster.Cores[0].Client
+	assert.NoError(t, client.Sys().Mount("spi-bindings", &vaultapi.MountInput{
+		Type:    "kv",
+		Options: map[string]string{"version": "2"},
+	}))
+
+	store := NewVaultStore(client, "spi-bindings")
+	binding := &api.SPIAccessTokenBinding{ObjectMeta: metav1.ObjectMeta{Name: "binding", Namespace: "ns", UID: "binding-uid"}}
+	other := &api.SPIAccessTokenBinding{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "ns", UID: "other-uid"}}
+
+	read := func(path string) map[string]interface{} {
+		secret, err := client.Logical().Read("spi-bindings/data/" + path)
+		assert.NoError(t, err)
+		if secret == nil || secret.Data["data"] == nil {
+			return nil
+		}
+		return secret.Data["data"].(map[string]interface{})
+	}
+
+	t.Run("writes to the namespace of the binding", func(t *testing.T) {
+		assert.NoError(t, store.Write(context.TODO(), binding, "app/git", map[string]string{"password": "token"}))
+		assert.Equal(t, map[string]interface{}{"password": "token"}, read("ns/app/git"))
+
+		metadata, err := client.Logical().Read("spi-bindings/metadata/ns/app/git")
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"spi-binding-uid":       "binding-uid",
+			"spi-binding-namespace": "ns",
+			"spi-binding-name":      "binding",
+		}, metadata.Data["custom_metadata"])
+	})
+
+	t.Run("overwrites own data", func(t *testing.T) {
+		assert.NoError(t, store.Write(context.TODO(), binding, "app/git", map[string]string{"password": "new"}))
+		assert.Equal(t, map[string]interface{}{"password": "new"}, read("ns/app/git"))
+	})
+
+	t.Run("doesn't rewrite unchanged data", func(t *testing.T) {
+		before, err := client.Logical().Read("spi-bindings/metadata/ns/app/git")
+		assert.NoError(t, err)
+
+		assert.NoError(t, store.Write(context.TODO(), binding, "app/git", map[string]string{"password": "new"}))
+
+		after, err := client.Logical().Read("spi-bindings/metadata/ns/app/git")
+		assert.NoError(t, err)
+		assert.Equal(t, before.Data["current_version"], after.Data["current_version"])
+	})
+
+	t.Run("repairs modified data", func(t *testing.T) {
+		_, err := client.Logical().Write("spi-bindings/data/ns/app/git", map[string]interface{}{"data": map[string]interface{}{"password": "tampered"}})
+		assert.NoError(t, err)
+
+		assert.NoError(t, store.Write(context.TODO(), binding, "app/git", map[string]string{"password": "new"}))
+		assert.Equal(t, map[string]interface{}{"password": "new"}, read("ns/app/git"))
+	})
+
+	t.Run("refuses to overwrite data of other bindings", func(t *testing.T) {
+		assert.ErrorIs(t, store.Write(context.TODO(), other, "app/git", map[string]string{"password": "other"}), ErrNotOwned)
+		assert.Equal(t, map[string]interface{}{"password": "new"}, read("ns/app/git"))
+	})
+
+	t.Run("refuses to overwrite data not written by the operator", func(t *testing.T) {
+		_, err := client.Logical().Write("spi-bindings/data/ns/manual", map[string]interface{}{"data": map[string]interface{}{"key": "value"}})
+		assert.NoError(t, err)
+
+		assert.ErrorIs(t, store.Write(context.TODO(), binding, "manual", map[string]string{"password": "token"}), ErrNotOwned)
+		assert.NoError(t, store.Delete(context.TODO(), binding, "manual"))
+		assert.Equal(t, map[string]interface{}{"key": "value"}, read("ns/manual"))
+	})
+
+	t.Run("deletes only own data", func(t *testing.T) {
+		assert.NoError(t, store.Delete(context.TODO(), other, "app/git"))
+		assert.NotNil(t, read("ns/app/git"))
+
+		assert.NoError(t, store.Delete(context.TODO(), binding, "app/git"))
+		assert.Nil(t, read("ns/app/git"))
+
+		assert.NoError(t, store.Delete(context.TODO(), binding, "app/git"))
+	})
+
+	t.Run("rejects invalid paths", func(t *testing.T) {
+		assert.Error(t, store.Write(context.TODO(), binding, "../other-ns/app", map[string]string{}))
+		assert.Error(t, store.Delete(context.TODO(), binding, "/app"))
+	})
+}
@@ -0,0 +1,58 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package writeback contains the external secret stores the data of the bindings can be written back to.
+package writeback
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	api "github.com/redhat-appstudio/service-provider-integration-operator/api/v1beta1"
+)
+
+// ErrNotOwned is returned when the path in the store already contains data that was not written on behalf of
+// the binding.
+var ErrNotOwned = errors.New("the path already contains data not written for the binding")
+
+// Store is an external secret store the data of the bindings can be written back to. The paths are relative to
+// the namespace of the binding so that the bindings can only write to the part of the store belonging to their
+// namespace.
+type Store interface {
+	// Write writes the data to the path on behalf of the binding, replacing the data previously written for it. Returns
+	// ErrNotOwned if the path contains data written for another binding. Writing the data that is already in the store
+	// should not modify the store so that the data can be re-written each time the binding is reconciled to repair
+	// the data changed or deleted in the store by someone else.
+	Write(ctx context.Context, binding *api.SPIAccessTokenBinding, path string, data map[string]string) error
+	// Delete deletes the data at the path if it was written on behalf of the binding. The data not written for
+	// the binding is left untouched.
+	Delete(ctx context.Context, binding *api.SPIAccessTokenBinding, path string) error
+}
+
+// ValidatePath checks that the path is a relative path that doesn't escape the namespace of the binding.
+func ValidatePath(path string) error {
+	if path == "" {
+		return fmt.Errorf("the write-back path cannot be empty")
+	}
+
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("the write-back path '%s' must be a relative path without empty, '.' or '..' segments", path)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+//
+// Copyright (c) 2021 Red Hat, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writeback
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatePath(t *testing.T) {
+	assert.NoError(t, ValidatePath("app"))
+	assert.NoError(t, ValidatePath("app/git/credentials"))
+
+	assert.Error(t, ValidatePath(""))
+	assert.Error(t, ValidatePath("/app"))
+	assert.Error(t, ValidatePath("app/"))
+	assert.Error(t, ValidatePath("app//git"))
+	assert.Error(t, ValidatePath("./app"))
+	assert.Error(t, ValidatePath("../other-namespace/app"))
+	assert.Error(t, ValidatePath("app/../../other-namespace"))
+}